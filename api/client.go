@@ -4,6 +4,11 @@
 // The ollama command-line client itself uses this package to interact with
 // the backend service.
 //
+// Requests that fail because the server is busy or rate limited, with a
+// status of 429, 502, 503 or 504, are retried a few times with backoff.
+// Errors from the server are returned as a [StatusError], which matches
+// errors such as [ErrNotFound] with [errors.Is].
+//
 // # Examples
 //
 // Several examples of using this package are available [in the GitHub
@@ -17,13 +22,23 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"iter"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
@@ -35,6 +50,9 @@ import (
 type Client struct {
 	base *url.URL
 	http *http.Client
+
+	// apiKey is sent as a bearer token if set
+	apiKey string
 }
 
 func checkError(resp *http.Response, body []byte) error {
@@ -50,6 +68,14 @@ func checkError(resp *http.Response, body []byte) error {
 		apiError.ErrorMessage = string(body)
 	}
 
+	if apiError.ErrorMessage == "" {
+		apiError.Status = resp.Status
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiError.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
 	return apiError
 }
 
@@ -60,12 +86,50 @@ func checkError(resp *http.Response, body []byte) error {
 //
 //	<scheme>://<host>:<port>
 //
+// or unix://<path> for a server listening on a Unix domain socket.
+//
 // If the variable is not specified, a default ollama host and port will be
-// used.
+// used. The API key in OLLAMA_API_KEY, if any, is sent with each request,
+// and the client certificate in OLLAMA_TLS_CLIENT_CERT and
+// OLLAMA_TLS_CLIENT_KEY, if any, with each TLS connection.
 func ClientFromEnvironment() (*Client, error) {
+	base, client := envconfig.Host(), http.DefaultClient
+	var transport *http.Transport
+	if certFile, keyFile := envconfig.TLSClientCert(), envconfig.TLSClientKey(); certFile != "" || keyFile != "" {
+		// for servers that require client certificates
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	if base.Scheme == "unix" {
+		// requests are sent over the socket as if to localhost
+		socket := base.Path
+		if transport == nil {
+			transport = http.DefaultTransport.(*http.Transport).Clone()
+		}
+
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+
+		base = &url.URL{Scheme: "http", Host: "localhost"}
+	}
+
+	if transport != nil {
+		client = &http.Client{Transport: transport}
+	}
+
 	return &Client{
-		base: envconfig.Host(),
-		http: http.DefaultClient,
+		base:   base,
+		http:   client,
+		apiKey: envconfig.APIKey(),
 	}, nil
 }
 
@@ -76,11 +140,110 @@ func NewClient(base *url.URL, http *http.Client) *Client {
 	}
 }
 
+// maxRetries is how many times a request that fails with a transient error,
+// such as the server being busy, is retried.
+const maxRetries = 3
+
+// maxRetryWait is the longest a request waits to be retried. Errors asking
+// to wait longer, such as an exhausted rate limit, are returned instead.
+const maxRetryWait = 10 * time.Second
+
+// retryBackoff is the wait before the first retry, which doubles for each
+// retry after it.
+var retryBackoff = 500 * time.Millisecond
+
+type noRetryKey struct{}
+
+// retryWait returns how long to wait before retrying a request that failed
+// with err for the attempt-th time, or false if it shouldn't be retried.
+func retryWait(ctx context.Context, attempt int, err error) (time.Duration, bool) {
+	var statusError StatusError
+	if attempt >= maxRetries || ctx.Value(noRetryKey{}) != nil || !errors.As(err, &statusError) {
+		return 0, false
+	}
+
+	switch statusError.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+	default:
+		return 0, false
+	}
+
+	if statusError.RetryAfter > 0 {
+		return statusError.RetryAfter, statusError.RetryAfter <= maxRetryWait
+	}
+
+	wait := retryBackoff << attempt
+	return wait + rand.N(wait/2+1), true
+}
+
+// send sends a request with body to path, retrying it while it fails with a
+// transient error unless body can't be read again. A response that isn't
+// successful is closed and returned as a [StatusError].
+func (c *Client) send(ctx context.Context, method, path string, body io.Reader, accept string) (*http.Response, error) {
+	// only bodies that can be rewound are sent again
+	var offset int64
+	replay, ok := body.(io.ReadSeeker)
+	if ok {
+		var err error
+		if offset, err = replay.Seek(0, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+
+	path, query, _ := strings.Cut(path, "?")
+	requestURL := c.base.JoinPath(path)
+	requestURL.RawQuery = query
+
+	for attempt := 0; ; attempt++ {
+		if replay != nil {
+			if _, err := replay.Seek(offset, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+
+		request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), body)
+		if err != nil {
+			return nil, err
+		}
+
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Accept", accept)
+		request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
+		if c.apiKey != "" {
+			request.Header.Set("Authorization", "Bearer "+c.apiKey)
+		}
+
+		response, err := c.http.Do(request)
+		if err != nil {
+			return nil, err
+		}
+
+		if response.StatusCode < http.StatusBadRequest {
+			return response, nil
+		}
+
+		respBody, err := io.ReadAll(io.LimitReader(response.Body, maxBufferSize))
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		err = checkError(response, respBody)
+		wait, ok := retryWait(ctx, attempt, err)
+		if !ok || body != nil && replay == nil {
+			return nil, err
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
 func (c *Client) do(ctx context.Context, method, path string, reqData, respData any) error {
 	var reqBody io.Reader
-	var data []byte
-	var err error
-
 	switch reqData := reqData.(type) {
 	case io.Reader:
 		// reqData is already an io.Reader
@@ -88,7 +251,7 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 	case nil:
 		// noop
 	default:
-		data, err = json.Marshal(reqData)
+		data, err := json.Marshal(reqData)
 		if err != nil {
 			return err
 		}
@@ -96,17 +259,7 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 		reqBody = bytes.NewReader(data)
 	}
 
-	requestURL := c.base.JoinPath(path)
-	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), reqBody)
-	if err != nil {
-		return err
-	}
-
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Accept", "application/json")
-	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
-
-	respObj, err := c.http.Do(request)
+	respObj, err := c.send(ctx, method, path, reqBody, "application/json")
 	if err != nil {
 		return err
 	}
@@ -117,10 +270,6 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 		return err
 	}
 
-	if err := checkError(respObj, respBody); err != nil {
-		return err
-	}
-
 	if len(respBody) > 0 && respData != nil {
 		if err := json.Unmarshal(respBody, respData); err != nil {
 			return err
@@ -132,27 +281,17 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 const maxBufferSize = 512 * format.KiloByte
 
 func (c *Client) stream(ctx context.Context, method, path string, data any, fn func([]byte) error) error {
-	var buf *bytes.Buffer
+	var reqBody io.Reader
 	if data != nil {
 		bts, err := json.Marshal(data)
 		if err != nil {
 			return err
 		}
 
-		buf = bytes.NewBuffer(bts)
+		reqBody = bytes.NewReader(bts)
 	}
 
-	requestURL := c.base.JoinPath(path)
-	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), buf)
-	if err != nil {
-		return err
-	}
-
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Accept", "application/x-ndjson")
-	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
-
-	response, err := c.http.Do(request)
+	response, err := c.send(ctx, method, path, reqBody, "application/x-ndjson")
 	if err != nil {
 		return err
 	}
@@ -176,20 +315,12 @@ func (c *Client) stream(ctx context.Context, method, path string, data any, fn f
 			return errors.New(errorResponse.Error)
 		}
 
-		if response.StatusCode >= http.StatusBadRequest {
-			return StatusError{
-				StatusCode:   response.StatusCode,
-				Status:       response.Status,
-				ErrorMessage: errorResponse.Error,
-			}
-		}
-
 		if err := fn(bts); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return scanner.Err()
 }
 
 // GenerateResponseFunc is a function that [Client.Generate] invokes every time
@@ -231,6 +362,51 @@ func (c *Client) Chat(ctx context.Context, req *ChatRequest, fn ChatResponseFunc
 	})
 }
 
+// errStopIteration stops a stream once the loop over its iterator ends.
+var errStopIteration = errors.New("stop iteration")
+
+// iterate returns an iterator over the responses fn streams to its callback.
+// An error ends the iteration with a zero response and the error.
+func iterate[T any](fn func(func(T) error) error) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		if err := fn(func(resp T) error {
+			if !yield(resp, nil) {
+				return errStopIteration
+			}
+
+			return nil
+		}); err != nil && !errors.Is(err, errStopIteration) {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
+
+// GenerateStream is like [Client.Generate] but returns an iterator over the
+// responses, such as each token as it is generated:
+//
+//	for resp, err := range client.GenerateStream(ctx, req) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Print(resp.Response)
+//	}
+//
+// Ending the loop early stops generating.
+func (c *Client) GenerateStream(ctx context.Context, req *GenerateRequest) iter.Seq2[GenerateResponse, error] {
+	return iterate(func(fn func(GenerateResponse) error) error {
+		return c.Generate(ctx, req, fn)
+	})
+}
+
+// ChatStream is like [Client.Chat] but returns an iterator over the
+// responses, as with [Client.GenerateStream].
+func (c *Client) ChatStream(ctx context.Context, req *ChatRequest) iter.Seq2[ChatResponse, error] {
+	return iterate(func(fn func(ChatResponse) error) error {
+		return c.Chat(ctx, req, fn)
+	})
+}
+
 // PullProgressFunc is a function that [Client.Pull] invokes every time there
 // is progress with a "pull" request sent to the service. If this function
 // returns an error, [Client.Pull] will stop the process and return this error.
@@ -250,6 +426,62 @@ func (c *Client) Pull(ctx context.Context, req *PullRequest, fn PullProgressFunc
 	})
 }
 
+// PullWithProgress is like [Client.Pull] but sends progress as typed events
+// on the returned channel, which is closed once the pull completes. A failed
+// pull sends a final event of kind [PullEventError]. Callers that stop
+// reading before the channel is closed should cancel ctx.
+func (c *Client) PullWithProgress(ctx context.Context, req *PullRequest) <-chan PullEvent {
+	ch := make(chan PullEvent)
+	send := func(e PullEvent) error {
+		select {
+		case ch <- e:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	go func() {
+		defer close(ch)
+		if err := c.Pull(ctx, req, func(resp ProgressResponse) error {
+			return send(newPullEvent(resp))
+		}); err != nil && ctx.Err() == nil {
+			send(PullEvent{Kind: PullEventError, Status: err.Error(), Err: err})
+		}
+	}()
+
+	return ch
+}
+
+// newPullEvent classifies a progress response of a pull by its status.
+func newPullEvent(resp ProgressResponse) PullEvent {
+	e := PullEvent{
+		Status:    resp.Status,
+		Digest:    resp.Digest,
+		Total:     resp.Total,
+		Completed: resp.Completed,
+	}
+
+	switch {
+	case resp.Status == "pulling manifest":
+		e.Kind = PullEventManifest
+	case resp.Digest != "" && strings.HasPrefix(resp.Status, "pulling "):
+		e.Kind = PullEventLayer
+	case resp.Status == "verifying sha256 digest":
+		e.Kind = PullEventVerify
+	case resp.Status == "writing manifest":
+		e.Kind = PullEventWrite
+	case resp.Status == "removing unused layers":
+		e.Kind = PullEventCleanup
+	case resp.Status == "success":
+		e.Kind = PullEventSuccess
+	default:
+		e.Kind = PullEventStatus
+	}
+
+	return e
+}
+
 // PushProgressFunc is a function that [Client.Push] invokes when progress is
 // made.
 // It's similar to other progress function types like [PullProgressFunc].
@@ -289,6 +521,78 @@ func (c *Client) Create(ctx context.Context, req *CreateRequest, fn CreateProgre
 	})
 }
 
+// Modelfile is a parsed Modelfile, such as the one returned by the parser
+// package's ParseFile.
+type Modelfile interface {
+	CreateRequest(relativeDir string) (*CreateRequest, error)
+}
+
+// CreateFromModelfile creates the model name from a parsed Modelfile. Local
+// files referenced by the Modelfile, such as weights and adapters, are
+// resolved relative to dir and uploaded as blobs unless the server already
+// has them. fn is called as with [Client.Create], including once for each
+// uploaded file.
+func (c *Client) CreateFromModelfile(ctx context.Context, name string, modelfile Modelfile, dir string, fn CreateProgressFunc) error {
+	req, err := modelfile.CreateRequest(dir)
+	if err != nil {
+		return err
+	}
+
+	req.Model = name
+	for _, files := range []*map[string]string{&req.Files, &req.Adapters, &req.Tokenizer} {
+		if len(*files) == 0 {
+			continue
+		}
+
+		uploaded := make(map[string]string, len(*files))
+		for path, digest := range *files {
+			if err := c.uploadBlob(ctx, path, digest, fn); err != nil {
+				return err
+			}
+			uploaded[filepath.Base(path)] = digest
+		}
+		*files = uploaded
+	}
+
+	return c.Create(ctx, req, fn)
+}
+
+// uploadBlob uploads the file at path as the blob digest if the server does
+// not have it.
+func (c *Client) uploadBlob(ctx context.Context, path, digest string, fn CreateProgressFunc) error {
+	err := c.do(ctx, http.MethodHead, fmt.Sprintf("/api/blobs/%s", digest), nil, nil)
+	var statusError StatusError
+	switch {
+	case errors.As(err, &statusError) && statusError.StatusCode == http.StatusNotFound:
+	case err != nil:
+		return err
+	default:
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	status := fmt.Sprintf("copying file %s", digest)
+	if err := fn(ProgressResponse{Status: status, Digest: digest, Total: fi.Size()}); err != nil {
+		return err
+	}
+
+	if err := c.CreateBlob(ctx, digest, f); err != nil {
+		return err
+	}
+
+	return fn(ProgressResponse{Status: status, Digest: digest, Total: fi.Size(), Completed: fi.Size()})
+}
+
 // List lists models that are available locally.
 func (c *Client) List(ctx context.Context) (*ListResponse, error) {
 	var lr ListResponse
@@ -298,6 +602,18 @@ func (c *Client) List(ctx context.Context) (*ListResponse, error) {
 	return &lr, nil
 }
 
+// Search lists the local models matching query, such as "code 7b q4", best
+// matches first. Each word of query is matched against the names, families,
+// parameter sizes and quantization levels, allowing for typos, and system
+// prompts of the models.
+func (c *Client) Search(ctx context.Context, query string) (*ListResponse, error) {
+	var lr ListResponse
+	if err := c.do(ctx, http.MethodGet, "/api/tags?"+url.Values{"q": {query}}.Encode(), nil, &lr); err != nil {
+		return nil, err
+	}
+	return &lr, nil
+}
+
 // ListRunning lists running models.
 func (c *Client) ListRunning(ctx context.Context) (*ProcessResponse, error) {
 	var lr ProcessResponse
@@ -307,6 +623,127 @@ func (c *Client) ListRunning(ctx context.Context) (*ProcessResponse, error) {
 	return &lr, nil
 }
 
+// UpdateModel changes the settings a model is loaded with, returning the
+// configuration it now runs with.
+func (c *Client) UpdateModel(ctx context.Context, req *UpdateModelRequest) (*EffectiveConfig, error) {
+	var resp EffectiveConfig
+	if err := c.do(ctx, http.MethodPatch, "/api/model", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListTransfers lists the pulls and pushes in progress.
+func (c *Client) ListTransfers(ctx context.Context) (*ListTransfersResponse, error) {
+	var resp ListTransfersResponse
+	if err := c.do(ctx, http.MethodGet, "/api/transfers", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CancelTransfer cancels the pull or push with the id from [Client.ListTransfers].
+func (c *Client) CancelTransfer(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/transfers/"+url.PathEscape(id), nil, nil)
+}
+
+// Unload unloads a model immediately rather than when its keep alive
+// expires, returning once its memory has been released. Requests the model is
+// serving finish first.
+func (c *Client) Unload(ctx context.Context, req *UnloadRequest) (*UnloadResponse, error) {
+	var resp UnloadResponse
+	if err := c.do(ctx, http.MethodPost, "/api/unload", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Defrag unloads the idle models loaded on GPUs and loads them again, largest
+// first, to compact VRAM fragmented by many loads and unloads. Models that
+// are serving requests are left loaded.
+func (c *Client) Defrag(ctx context.Context) (*DefragResponse, error) {
+	var resp DefragResponse
+	if err := c.do(ctx, http.MethodPost, "/api/defrag", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Health returns the health of the server. An unhealthy server responds
+// with a [StatusError] of status 503 listing the causes.
+func (c *Client) Health(ctx context.Context) (*HealthResponse, error) {
+	var resp HealthResponse
+	// an unhealthy server isn't expected to recover between retries
+	ctx = context.WithValue(ctx, noRetryKey{}, true)
+	if err := c.do(ctx, http.MethodGet, "/api/health", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListKeys lists the users of the API keys of the server.
+func (c *Client) ListKeys(ctx context.Context) (*ListKeysResponse, error) {
+	var resp ListKeysResponse
+	if err := c.do(ctx, http.MethodGet, "/api/admin/keys", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CreateKey creates a key for the user req.Name, creating the user or
+// replacing what they may do with req.
+func (c *Client) CreateKey(ctx context.Context, req *APIKeyUser) (*CreateKeyResponse, error) {
+	var resp CreateKeyResponse
+	if err := c.do(ctx, http.MethodPost, "/api/admin/keys", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteKey deletes a key, or a user with all their keys.
+func (c *Client) DeleteKey(ctx context.Context, req *DeleteKeyRequest) error {
+	if err := c.do(ctx, http.MethodDelete, "/api/admin/keys", req, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+// LogLevel returns the level the server logs at.
+func (c *Client) LogLevel(ctx context.Context) (*LogLevel, error) {
+	var resp LogLevel
+	if err := c.do(ctx, http.MethodGet, "/api/admin/log-level", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SetLogLevel changes the level the server logs at until it restarts.
+func (c *Client) SetLogLevel(ctx context.Context, req *LogLevel) (*LogLevel, error) {
+	var resp LogLevel
+	if err := c.do(ctx, http.MethodPost, "/api/admin/log-level", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// EventFunc is a function that [Client.Events] invokes for each event. If
+// this function returns an error, [Client.Events] will stop and return this
+// error.
+type EventFunc func(Event) error
+
+// Events streams server events, such as the progress of model loads, until
+// ctx is canceled.
+func (c *Client) Events(ctx context.Context, fn EventFunc) error {
+	return c.stream(ctx, http.MethodGet, "/api/events", nil, func(bts []byte) error {
+		var event Event
+		if err := json.Unmarshal(bts, &event); err != nil {
+			return err
+		}
+
+		return fn(event)
+	})
+}
+
 // Copy copies a model - creating a model with another name from an existing
 // model.
 func (c *Client) Copy(ctx context.Context, req *CopyRequest) error {
@@ -333,6 +770,134 @@ func (c *Client) Show(ctx context.Context, req *ShowRequest) (*ShowResponse, err
 	return &resp, nil
 }
 
+// ShowTyped is like [Client.Show] but also decodes the model's parameters
+// into option values and parses its template.
+func (c *Client) ShowTyped(ctx context.Context, req *ShowRequest) (*ShowTypedResponse, error) {
+	resp, err := c.Show(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := parseParameters(resp.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("parameters: %w", err)
+	}
+
+	// the template is parsed with the functions the server makes available
+	tmpl, err := template.New("").Option("missingkey=zero").Funcs(template.FuncMap{
+		"json": func(v any) string {
+			b, _ := json.Marshal(v)
+			return string(b)
+		},
+	}).Parse(resp.Template)
+	if err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+
+	return &ShowTypedResponse{ShowResponse: *resp, Options: opts, ParsedTemplate: tmpl}, nil
+}
+
+// parseParameters parses the parameters of a [ShowResponse], one "key value"
+// pair per line with Go-syntax values, into option values.
+func parseParameters(s string) (map[string]any, error) {
+	params := make(map[string][]string)
+	for _, line := range strings.Split(s, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+
+		params[key] = append(params[key], value)
+	}
+
+	return FormatParams(params)
+}
+
+// Prefix pins a system prompt for a model. The server evaluates the prompt
+// ahead of time so requests referencing the returned id can reuse it.
+func (c *Client) Prefix(ctx context.Context, req *PrefixRequest) (*PrefixResponse, error) {
+	var resp PrefixResponse
+	if err := c.do(ctx, http.MethodPost, "/api/prefixes", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CreateAlias creates or updates an alias that refers to a model. The alias
+// can be used in place of the model's name without copying the model.
+func (c *Client) CreateAlias(ctx context.Context, req *AliasRequest) (*Alias, error) {
+	var resp Alias
+	if err := c.do(ctx, http.MethodPost, "/api/alias", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteAlias deletes an alias. The model it refers to is kept.
+func (c *Client) DeleteAlias(ctx context.Context, req *AliasRequest) error {
+	return c.do(ctx, http.MethodDelete, "/api/alias", req, nil)
+}
+
+// ListAliases lists the aliases of models.
+func (c *Client) ListAliases(ctx context.Context) (*ListAliasesResponse, error) {
+	var resp ListAliasesResponse
+	if err := c.do(ctx, http.MethodGet, "/api/alias", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListHistory lists the generate and chat requests recently served, newest
+// first.
+func (c *Client) ListHistory(ctx context.Context) (*ListHistoryResponse, error) {
+	var resp ListHistoryResponse
+	if err := c.do(ctx, http.MethodGet, "/api/history", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ShowHistory returns the entry with the id from [Client.ListHistory],
+// including the exchange if it was captured.
+func (c *Client) ShowHistory(ctx context.Context, id string) (*HistoryEntry, error) {
+	var resp HistoryEntry
+	if err := c.do(ctx, http.MethodGet, "/api/history/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListSessions lists the sessions whose KV cache is kept, most recently
+// used first.
+func (c *Client) ListSessions(ctx context.Context) (*ListSessionsResponse, error) {
+	var resp ListSessionsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/sessions", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteSession removes the KV cache kept for the session with the id.
+func (c *Client) DeleteSession(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/sessions/"+url.PathEscape(id), nil, nil)
+}
+
+// Recovered returns the response kept with the id in the [Recover] of a
+// request whose client disconnected. If the response is still being
+// generated, it waits until it is done.
+func (c *Client) Recovered(ctx context.Context, id string) (*RecoveredResponse, error) {
+	var resp RecoveredResponse
+	if err := c.do(ctx, http.MethodGet, "/api/recover/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Heartbeat checks if the server has started and is responsive; if yes, it
 // returns nil, otherwise an error.
 func (c *Client) Heartbeat(ctx context.Context) error {
@@ -351,6 +916,52 @@ func (c *Client) Embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse,
 	return &resp, nil
 }
 
+// Classify scores one or more inputs with a model that has a classification
+// head.
+func (c *Client) Classify(ctx context.Context, req *ClassifyRequest) (*ClassifyResponse, error) {
+	var resp ClassifyResponse
+	if err := c.do(ctx, http.MethodPost, "/api/classify", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ImageGenerateResponseFunc is a function that [Client.GenerateImage] invokes
+// with the progress of the image and, last, the image.
+type ImageGenerateResponseFunc func(ImageGenerateResponse) error
+
+// GenerateImage generates an image from a prompt with a diffusion model. Image
+// generation is experimental.
+func (c *Client) GenerateImage(ctx context.Context, req *ImageGenerateRequest, fn ImageGenerateResponseFunc) error {
+	return c.stream(ctx, http.MethodPost, "/api/images/generate", req, func(bts []byte) error {
+		var resp ImageGenerateResponse
+		if err := json.Unmarshal(bts, &resp); err != nil {
+			return err
+		}
+
+		return fn(resp)
+	})
+}
+
+// Tokenize turns text into the tokens of a model, optionally rendered with
+// the model's template first.
+func (c *Client) Tokenize(ctx context.Context, req *TokenizeRequest) (*TokenizeResponse, error) {
+	var resp TokenizeResponse
+	if err := c.do(ctx, http.MethodPost, "/api/tokenize", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Detokenize turns the tokens of a model back into text.
+func (c *Client) Detokenize(ctx context.Context, req *DetokenizeRequest) (*DetokenizeResponse, error) {
+	var resp DetokenizeResponse
+	if err := c.do(ctx, http.MethodPost, "/api/detokenize", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Embeddings generates an embedding from a model.
 func (c *Client) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
 	var resp EmbeddingResponse
@@ -366,6 +977,16 @@ func (c *Client) CreateBlob(ctx context.Context, digest string, r io.Reader) err
 	return c.do(ctx, http.MethodPost, fmt.Sprintf("/api/blobs/%s", digest), r, nil)
 }
 
+// System returns the hardware the server found, such as its CPU features and
+// GPUs, and the runner builds it loads models with.
+func (c *Client) System(ctx context.Context) (*SystemResponse, error) {
+	var resp SystemResponse
+	if err := c.do(ctx, http.MethodGet, "/api/system", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Version returns the Ollama server version as a string.
 func (c *Client) Version(ctx context.Context) (string, error) {
 	var version struct {
@@ -1,7 +1,21 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestClientFromEnvironment(t *testing.T) {
@@ -43,3 +57,339 @@ func TestClientFromEnvironment(t *testing.T) {
 		})
 	}
 }
+
+func TestClientFromEnvironmentUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "ollama.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("unix domain sockets not supported:", err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/version" || r.Host != "localhost" {
+			http.NotFound(w, r)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"version": "1.2.3"})
+	}))
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	t.Setenv("OLLAMA_HOST", "unix://"+socket)
+	client, err := ClientFromEnvironment()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := client.Version(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != "1.2.3" {
+		t.Errorf("expected version 1.2.3, got %s", version)
+	}
+}
+
+func newTestClient(t *testing.T, h http.HandlerFunc) *Client {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	base, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewClient(base, srv.Client())
+}
+
+func TestPullWithProgress(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		for _, resp := range []ProgressResponse{
+			{Status: "pulling manifest"},
+			{Status: "pulling 0123456789ab", Digest: "sha256:0123456789ab", Total: 10, Completed: 5},
+			{Status: "verifying sha256 digest"},
+			{Status: "writing manifest"},
+			{Status: "success"},
+		} {
+			json.NewEncoder(w).Encode(resp)
+		}
+	})
+
+	var kinds []PullEventKind
+	for e := range client.PullWithProgress(context.Background(), &PullRequest{Model: "test"}) {
+		kinds = append(kinds, e.Kind)
+		if e.Kind == PullEventLayer && (e.Digest != "sha256:0123456789ab" || e.Total != 10 || e.Completed != 5) {
+			t.Errorf("unexpected layer event %+v", e)
+		}
+	}
+
+	want := []PullEventKind{PullEventManifest, PullEventLayer, PullEventVerify, PullEventWrite, PullEventSuccess}
+	if fmt.Sprint(kinds) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, kinds)
+	}
+}
+
+func TestPullWithProgressError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ProgressResponse{Status: "pulling manifest"})
+		fmt.Fprintln(w, `{"error":"pull model manifest: file does not exist"}`)
+	})
+
+	var last PullEvent
+	for e := range client.PullWithProgress(context.Background(), &PullRequest{Model: "test"}) {
+		last = e
+	}
+
+	if last.Kind != PullEventError || last.Err == nil || !strings.Contains(last.Err.Error(), "file does not exist") {
+		t.Errorf("expected error event, got %+v", last)
+	}
+}
+
+type testModelfile struct {
+	req *CreateRequest
+}
+
+func (f testModelfile) CreateRequest(string) (*CreateRequest, error) {
+	return f.req, nil
+}
+
+func TestCreateFromModelfile(t *testing.T) {
+	var mu sync.Mutex
+	blobs := map[string]string{"sha256:existing": ""}
+	var created CreateRequest
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/api/blobs/"):
+			if _, ok := blobs[strings.TrimPrefix(r.URL.Path, "/api/blobs/")]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/blobs/"):
+			b, _ := io.ReadAll(r.Body)
+			blobs[strings.TrimPrefix(r.URL.Path, "/api/blobs/")] = string(b)
+			w.WriteHeader(http.StatusCreated)
+		case r.URL.Path == "/api/create":
+			json.NewDecoder(r.Body).Decode(&created)
+			json.NewEncoder(w).Encode(ProgressResponse{Status: "success"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	dir := t.TempDir()
+	weights := filepath.Join(dir, "model.gguf")
+	if err := os.WriteFile(weights, []byte("weights"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	modelfile := testModelfile{&CreateRequest{
+		Files:    map[string]string{weights: "sha256:weights"},
+		Adapters: map[string]string{filepath.Join(dir, "adapter.gguf"): "sha256:existing"},
+		System:   "You are a helpful assistant.",
+	}}
+
+	var statuses []string
+	if err := client.CreateFromModelfile(context.Background(), "test", modelfile, dir, func(resp ProgressResponse) error {
+		statuses = append(statuses, resp.Status)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if blobs["sha256:weights"] != "weights" {
+		t.Errorf("expected weights to be uploaded, got %q", blobs["sha256:weights"])
+	}
+
+	if created.Model != "test" || created.Files["model.gguf"] != "sha256:weights" || created.Adapters["adapter.gguf"] != "sha256:existing" {
+		t.Errorf("unexpected create request %+v", created)
+	}
+
+	want := []string{"copying file sha256:weights", "copying file sha256:weights", "success"}
+	if fmt.Sprint(statuses) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, statuses)
+	}
+}
+
+func TestShowTyped(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ShowResponse{
+			Parameters: strings.Join([]string{
+				`num_ctx                        4096`,
+				`temperature                    0.7`,
+				`stop                           "<|start_header_id|>"`,
+				`stop                           "<|eot_id|>"`,
+			}, "\n"),
+			Template: `{{ range .Messages }}{{ json .Content }}{{ end }}`,
+		})
+	})
+
+	resp, err := client.ShowTyped(context.Background(), &ShowRequest{Model: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Options["num_ctx"] != int64(4096) || resp.Options["temperature"] != float32(0.7) {
+		t.Errorf("unexpected options %v", resp.Options)
+	}
+
+	if stop, ok := resp.Options["stop"].([]string); !ok || len(stop) != 2 || stop[1] != "<|eot_id|>" {
+		t.Errorf("unexpected stop %v", resp.Options["stop"])
+	}
+
+	var sb strings.Builder
+	if err := resp.ParsedTemplate.Execute(&sb, map[string]any{"Messages": []Message{{Content: "hi"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if sb.String() != `"hi"` {
+		t.Errorf("unexpected template output %q", sb.String())
+	}
+}
+
+func TestShowTypedInvalidParameters(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ShowResponse{Parameters: "num_ctx abc"})
+	})
+
+	if _, err := client.ShowTyped(context.Background(), &ShowRequest{Model: "test"}); err == nil {
+		t.Error("expected an error")
+	} else if errors.As(err, new(StatusError)) {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
+
+func TestStatusErrorIs(t *testing.T) {
+	err := fmt.Errorf("show: %w", StatusError{StatusCode: http.StatusNotFound, ErrorMessage: "model not found"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Error("expected ErrNotFound")
+	}
+
+	if errors.Is(err, ErrForbidden) {
+		t.Error("expected not ErrForbidden")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	cases := []struct {
+		name       string
+		status     int
+		retryAfter string
+		calls      int
+		err        error
+	}{
+		{"busy", http.StatusServiceUnavailable, "", 3, nil},
+		{"rate limited", http.StatusTooManyRequests, "", 3, nil},
+		{"rate limited too long", http.StatusTooManyRequests, "60", 1, ErrRateLimited},
+		{"not found", http.StatusNotFound, "", 1, ErrNotFound},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				calls++
+
+				var req CopyRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Source != "a" {
+					t.Errorf("unexpected request %+v, %v", req, err)
+				}
+
+				// fail twice, then succeed
+				if calls < 3 {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+
+					w.WriteHeader(tt.status)
+					json.NewEncoder(w).Encode(map[string]string{"error": "failed"})
+				}
+			})
+
+			err := client.Copy(context.Background(), &CopyRequest{Source: "a", Destination: "b"})
+			if !errors.Is(err, tt.err) || (tt.err == nil) != (err == nil) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+
+			if calls != tt.calls {
+				t.Errorf("expected %d calls, got %d", tt.calls, calls)
+			}
+
+			var statusError StatusError
+			if tt.retryAfter == "60" && (!errors.As(err, &statusError) || statusError.RetryAfter != time.Minute) {
+				t.Errorf("expected to retry after a minute, got %v", err)
+			}
+		})
+	}
+
+	t.Run("health", func(t *testing.T) {
+		var calls int
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+
+		if _, err := client.Health(context.Background()); !errors.Is(err, ErrUnavailable) {
+			t.Errorf("expected ErrUnavailable, got %v", err)
+		}
+
+		if calls != 1 {
+			t.Errorf("expected 1 call, got %d", calls)
+		}
+	})
+}
+
+func TestGenerateStream(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		for _, s := range []string{"a", "b", "c"} {
+			json.NewEncoder(w).Encode(GenerateResponse{Response: s})
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"error": "out of memory"})
+	})
+
+	var sb strings.Builder
+	var last error
+	for resp, err := range client.GenerateStream(context.Background(), &GenerateRequest{Model: "test"}) {
+		if err != nil {
+			last = err
+			break
+		}
+
+		sb.WriteString(resp.Response)
+	}
+
+	if sb.String() != "abc" {
+		t.Errorf("expected abc, got %q", sb.String())
+	}
+
+	if last == nil || last.Error() != "out of memory" {
+		t.Errorf("expected the error of the stream, got %v", last)
+	}
+
+	t.Run("break", func(t *testing.T) {
+		var n int
+		for _, err := range client.ChatStream(context.Background(), &ChatRequest{Model: "test"}) {
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			n++
+			break
+		}
+
+		if n != 1 {
+			t.Errorf("expected 1 response, got %d", n)
+		}
+	})
+}
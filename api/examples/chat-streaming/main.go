@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/ollama/ollama/api"
+)
+
+func main() {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	req := &api.ChatRequest{
+		Model: "llama3.2",
+		Messages: []api.Message{
+			{Role: "user", Content: "why is the sky blue?"},
+		},
+	}
+
+	// Each iteration is a chunk of the response as it is generated. Breaking
+	// out of the loop stops generating.
+	for resp, err := range client.ChatStream(context.Background(), req) {
+		if errors.Is(err, api.ErrNotFound) {
+			log.Fatalf("%s isn't installed, run: ollama pull %s", req.Model, req.Model)
+		} else if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Print(resp.Message.Content)
+	}
+	fmt.Println()
+}
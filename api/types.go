@@ -2,21 +2,59 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math"
+	"net/http"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 )
 
-// StatusError is an error with an HTTP status code and message.
+// StatusError is an error with an HTTP status code and message. It matches
+// the error of its status code, such as [ErrNotFound], with [errors.Is].
 type StatusError struct {
 	StatusCode   int
 	Status       string
 	ErrorMessage string `json:"error"`
+
+	// RetryAfter is how long the server asked to wait before trying again,
+	// if it did.
+	RetryAfter time.Duration `json:"-"`
+}
+
+// Errors of the status codes of a [StatusError].
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrUnavailable  = errors.New("service unavailable")
+)
+
+// Is reports whether target is the error of the status code of e.
+func (e StatusError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrUnavailable:
+		return e.StatusCode == http.StatusServiceUnavailable
+	default:
+		return false
+	}
 }
 
 func (e StatusError) Error() string {
@@ -33,6 +71,18 @@ func (e StatusError) Error() string {
 	}
 }
 
+// Shed is returned alongside the error of a request shed with a 503 because
+// its predicted wait for a first token is longer than the model's
+// first_token_slo.
+type Shed struct {
+	PredictedWait time.Duration `json:"predicted_wait"`
+	FirstTokenSLO time.Duration `json:"first_token_slo"`
+
+	// Alternatives are loaded models predicted to respond within the SLO,
+	// soonest first
+	Alternatives []string `json:"alternatives,omitempty"`
+}
+
 // ImageData represents the raw binary data of an image file.
 type ImageData []byte
 
@@ -80,6 +130,67 @@ type GenerateRequest struct {
 	// Options lists model-specific options. For example, temperature can be
 	// set through this field, if the model supports it.
 	Options map[string]interface{} `json:"options"`
+
+	// Profile selects a named parameter profile of the model. Options take
+	// precedence over the profile's parameters.
+	Profile string `json:"profile,omitempty"`
+
+	// Prefix is the id of a pinned prefix registered with [Client.Prefix]. Its
+	// system prompt is used unless System is set.
+	Prefix string `json:"prefix,omitempty"`
+
+	// Render post-processes the model's markdown output into another format
+	// on the server. Valid values are "markdown" (the default), "html" and
+	// "plain". It is only supported for non-streaming requests.
+	Render string `json:"render,omitempty"`
+
+	// Checkpoint is an id chosen by the client under which the progress of
+	// a long generation is periodically saved. Repeating the request with
+	// the same id after a crash or restart resumes the generation; the
+	// response then starts with the text generated before the last
+	// checkpoint.
+	Checkpoint string `json:"checkpoint,omitempty"`
+
+	// Tokens is a prompt of token ids from the model's vocabulary, evaluated
+	// as is without templating or tokenization. It can't be combined with
+	// Prompt, Suffix, System, Template, Context or Images.
+	Tokens []int `json:"tokens,omitempty"`
+
+	// ReturnTokens returns the ids of the generated tokens with the final
+	// response.
+	ReturnTokens bool `json:"return_tokens,omitempty"`
+
+	// Adapter is a LoRA adapter applied to the model for this request only:
+	// the name of a model created with one ADAPTER from the same base model,
+	// or the absolute path of an adapter file on the server. The base model
+	// stays loaded when switching adapters.
+	Adapter string `json:"adapter,omitempty"`
+
+	// Logprobs returns the log probability of each generated token with the
+	// response.
+	Logprobs bool `json:"logprobs,omitempty"`
+
+	// TopLogprobs is the number of most likely alternatives, up to 20,
+	// returned with the log probability of each token. It requires Logprobs.
+	TopLogprobs int `json:"top_logprobs,omitempty"`
+
+	// Recover finishes the response if the client disconnects before it is
+	// done and keeps it to be fetched with [Client.Recovered].
+	Recover *Recover `json:"recover,omitempty"`
+
+	// Coalesce combines the tokens of a streamed response into fewer
+	// chunks.
+	Coalesce *Coalesce `json:"coalesce,omitempty"`
+
+	// Variables are available to the prompt template and the model's system
+	// prompt as {{ .Variables.name }}, along with {{ .Now }} and
+	// {{ .Model }}.
+	Variables map[string]string `json:"variables,omitempty"`
+
+	// SessionID is an id chosen by the client under which the KV cache of
+	// the request is kept, so that a follow-up request with the same id only
+	// processes the part of its prompt that is new.
+	SessionID string `json:"session_id,omitempty"`
 }
 
 // ChatRequest describes a request sent by [Client.Chat].
@@ -105,6 +216,114 @@ type ChatRequest struct {
 
 	// Options lists model-specific options.
 	Options map[string]interface{} `json:"options"`
+
+	// Profile selects a named parameter profile, as in [GenerateRequest].
+	Profile string `json:"profile,omitempty"`
+
+	// Prefix is the id of a pinned prefix registered with [Client.Prefix]. Its
+	// system prompt is used unless Messages begins with a system message.
+	Prefix string `json:"prefix,omitempty"`
+
+	// Checkpoint saves the progress of long generations, as in
+	// [GenerateRequest].
+	Checkpoint string `json:"checkpoint,omitempty"`
+
+	// Adapter is a LoRA adapter applied for this request only, as in
+	// [GenerateRequest].
+	Adapter string `json:"adapter,omitempty"`
+
+	// Logprobs and TopLogprobs return token log probabilities, as in
+	// [GenerateRequest].
+	Logprobs    bool `json:"logprobs,omitempty"`
+	TopLogprobs int  `json:"top_logprobs,omitempty"`
+
+	// Recover keeps the response if the client disconnects, as in
+	// [GenerateRequest].
+	Recover *Recover `json:"recover,omitempty"`
+
+	// Coalesce combines the tokens of a streamed response into fewer
+	// chunks, as in [GenerateRequest].
+	Coalesce *Coalesce `json:"coalesce,omitempty"`
+
+	// Variables are available to the prompt template and the model's system
+	// prompt, as in [GenerateRequest].
+	Variables map[string]string `json:"variables,omitempty"`
+
+	// SessionID keeps the KV cache for follow-up requests, as in
+	// [GenerateRequest].
+	SessionID string `json:"session_id,omitempty"`
+
+	// ExecuteTools lets the server run calls to the tools it has been
+	// configured with and return the model's final reply. It is only
+	// supported for non-streaming requests.
+	ExecuteTools bool `json:"execute_tools,omitempty"`
+
+	// Conversation is the id of a server-side conversation. When set, the
+	// stored history is prepended to Messages and the exchange is appended
+	// to the conversation once generation completes.
+	Conversation string `json:"conversation,omitempty"`
+
+	// Consent records that the user agreed to the exchange being kept for
+	// training. Exchanges with models that mirror requests are only added to
+	// the dataset if it is set.
+	Consent *Consent `json:"consent,omitempty"`
+}
+
+// Coalesce configures a streamed response to combine the tokens generated
+// close together into one chunk, for clients that read many tokens quickly
+// and would rather have fewer chunks than each token as soon as it is
+// generated. A chunk is written once it has Tokens tokens or its first
+// token has waited Interval, whichever is first. The server may lower
+// either, and returns those it uses in the X-Ollama-Coalesce header.
+type Coalesce struct {
+	// Interval is the longest a token is held back. It defaults to 100ms
+	// if only Tokens is set.
+	Interval Duration `json:"interval,omitempty"`
+
+	// Tokens is the most tokens in a chunk. 0 is no limit.
+	Tokens int `json:"tokens,omitempty"`
+}
+
+// Recover configures the recovery of a response whose client disconnected
+// before it was done.
+type Recover struct {
+	// ID is the id the response is kept under. It defaults to the
+	// X-Request-Id header of the request, or else a new id. The id is
+	// returned in the X-Request-Id header of the response.
+	ID string `json:"id,omitempty"`
+
+	// Budget is the most tokens generated after the client disconnects. If
+	// it is 0 the response is generated to the end.
+	Budget int `json:"budget,omitempty"`
+
+	// TTL is how long the response is kept once it is done. It defaults
+	// to 10 minutes.
+	TTL *Duration `json:"ttl,omitempty"`
+}
+
+// RecoveredResponse is a response finished after its client disconnected,
+// returned by [Client.Recovered].
+type RecoveredResponse struct {
+	ID string `json:"id"`
+
+	// Generate is the response of a request to /api/generate and Chat the
+	// response of one to /api/chat. It holds the whole response, including
+	// what was streamed before the client disconnected.
+	Generate *GenerateResponse `json:"generate,omitempty"`
+	Chat     *ChatResponse     `json:"chat,omitempty"`
+
+	// ExpiresAt is when the response is no longer kept.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Consent is the consent of a user to their chat exchanges being kept in the
+// local dataset of a model for fine-tuning.
+type Consent struct {
+	// User identifies the user who consented.
+	User string `json:"user,omitempty"`
+
+	// GrantedAt is when the user consented.
+	GrantedAt time.Time `json:"granted_at"`
 }
 
 type Tools []Tool
@@ -192,9 +411,75 @@ type ChatResponse struct {
 
 	Done bool `json:"done"`
 
+	// Load is set on responses streamed while the model is loaded for the
+	// request. These responses have no message content.
+	Load *LoadEvent `json:"load,omitempty"`
+
+	// Language is the detected language of the message, set on the final
+	// response if the language or detect_language option is set.
+	Language string `json:"language,omitempty"`
+
+	// RoutedTo is the model that served the request, if Model is a router
+	// model.
+	RoutedTo string `json:"routed_to,omitempty"`
+
+	// Logprobs are the log probabilities of the tokens of this response's
+	// message content if Logprobs is set in the request.
+	Logprobs []Logprob `json:"logprobs,omitempty"`
+
+	// Degenerate is set on the final response if the watchdog option is set
+	// and it detected degenerate output.
+	Degenerate *Degeneration `json:"degenerate,omitempty"`
+
+	// ToolCalls lists the tool calls of a streamed response in order, on the
+	// final response. Each one was also streamed in a response of its own as
+	// soon as the model finished generating it.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+
 	Metrics
 }
 
+// Degeneration describes degenerate output detected by the watchdog.
+type Degeneration struct {
+	// Kind is "repetition" if the same tokens were repeated over and over,
+	// or "low_entropy" if tokens were generated with next to no uncertainty.
+	Kind string `json:"kind"`
+
+	// At is the number of tokens generated when it was detected.
+	At int `json:"at"`
+
+	// Window is the number of tokens that were degenerate.
+	Window int `json:"window"`
+
+	// Repeated is the text that was repeated, for repetition.
+	Repeated string `json:"repeated,omitempty"`
+
+	// Entropy is the mean entropy in nats of the distributions the window
+	// was sampled from.
+	Entropy float64 `json:"entropy"`
+}
+
+// TokenLogprob is the log probability of a token.
+type TokenLogprob struct {
+	// Token is the text of the token.
+	Token string `json:"token"`
+
+	// Logprob is the natural logarithm of the probability of the token.
+	Logprob float64 `json:"logprob"`
+
+	// Bytes is the UTF-8 encoding of the token, which may be part of a
+	// multi-byte character.
+	Bytes []int `json:"bytes,omitempty"`
+}
+
+// Logprob is the log probability of a generated token and, if requested, the
+// most likely tokens at its position.
+type Logprob struct {
+	TokenLogprob
+
+	TopLogprobs []TokenLogprob `json:"top_logprobs,omitempty"`
+}
+
 type Metrics struct {
 	TotalDuration      time.Duration `json:"total_duration,omitempty"`
 	LoadDuration       time.Duration `json:"load_duration,omitempty"`
@@ -202,6 +487,14 @@ type Metrics struct {
 	PromptEvalDuration time.Duration `json:"prompt_eval_duration,omitempty"`
 	EvalCount          int           `json:"eval_count,omitempty"`
 	EvalDuration       time.Duration `json:"eval_duration,omitempty"`
+
+	// QueueDuration is the part of LoadDuration spent waiting for the
+	// scheduler rather than loading the model.
+	QueueDuration time.Duration `json:"queue_duration,omitempty"`
+
+	// PromptCacheCount is the number of prompt tokens reused from the cache
+	// instead of being evaluated.
+	PromptCacheCount int `json:"prompt_cache_count,omitempty"`
 }
 
 // Options specified in [GenerateRequest].  If you add a new option here, also
@@ -226,6 +519,51 @@ type Options struct {
 	MirostatTau      float32  `json:"mirostat_tau,omitempty"`
 	MirostatEta      float32  `json:"mirostat_eta,omitempty"`
 	Stop             []string `json:"stop,omitempty"`
+
+	// StopTokens are tokens that stop generation when sampled, given as
+	// token ids or as the text of a single token, such as the name of a
+	// special token like "<|eot_id|>". Unlike Stop, they trigger however
+	// the text before them was tokenized.
+	StopTokens []string `json:"stop_tokens,omitempty"`
+
+	// Language keeps the response in the script of a language, such as "ja"
+	// or "ru", by biasing against tokens in other scripts. The detected
+	// language of the response is returned in its Language field.
+	Language string `json:"language,omitempty"`
+
+	// DetectLanguage returns the detected language of the response without
+	// constraining generation.
+	DetectLanguage bool `json:"detect_language,omitempty"`
+
+	// Mirror appends chat exchanges that complete, and whose request carries
+	// consent, to the model's local dataset. It is usually set for a model
+	// with PARAMETER mirror true.
+	Mirror bool `json:"mirror,omitempty"`
+
+	// BannedStrings are strings the response never contains. When one is
+	// generated, generation backtracks to where it started and samples a
+	// different token there.
+	BannedStrings []string `json:"banned_strings,omitempty"`
+
+	// TokenHealing removes the last token of the prompt and constrains the
+	// first generated token to start with its text, so generation isn't
+	// skewed by how the prompt happened to be tokenized.
+	TokenHealing bool `json:"token_healing,omitempty"`
+
+	// FirstTokenSLO is the longest a request should wait for its first
+	// token, in milliseconds. Requests predicted to wait longer are shed
+	// with a 503 rather than queued.
+	FirstTokenSLO int `json:"first_token_slo,omitempty"`
+
+	// Watchdog detects degenerate output, the same tokens repeated over and
+	// over or a long stretch generated with next to no uncertainty. With
+	// "warn" it is reported in the final response; with "stop" generation
+	// also stops with the done reason "degenerate". It is off by default.
+	Watchdog string `json:"watchdog,omitempty"`
+
+	// WatchdogWindow is the number of tokens that must be degenerate for
+	// the watchdog to detect it.
+	WatchdogWindow int `json:"watchdog_window,omitempty"`
 }
 
 // Runner options which must be set when the model is loaded into memory
@@ -241,6 +579,76 @@ type Runner struct {
 	UseMMap   *bool `json:"use_mmap,omitempty"`
 	UseMLock  bool  `json:"use_mlock,omitempty"`
 	NumThread int   `json:"num_thread,omitempty"`
+
+	// NumParallel is the number of requests the model serves at the same
+	// time, overriding OLLAMA_NUM_PARALLEL.
+	NumParallel int `json:"num_parallel,omitempty"`
+
+	// TensorSplit is the proportion of the layers to put on each GPU, in the
+	// order they were detected, such as "3,1".
+	TensorSplit string `json:"tensor_split,omitempty"`
+
+	// GPULayers is the number of layers to put on each GPU, in the order
+	// they were detected, such as "30,10". Cannot be set with TensorSplit.
+	GPULayers string `json:"gpu_layers,omitempty"`
+}
+
+// SystemResponse is the response from [Client.System], describing the
+// hardware the server found and how it runs models on it.
+type SystemResponse struct {
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+
+	CPU  SystemCPU   `json:"cpu"`
+	GPUs []SystemGPU `json:"gpus"`
+
+	// Metal is set if models run on the GPU of Apple silicon through Metal.
+	Metal bool `json:"metal"`
+
+	// Runner is the runner build models are loaded with, such as
+	// "cuda_v12_avx", or "cpu_avx2" if there is no usable GPU.
+	Runner string `json:"runner"`
+
+	// Runners are the runner builds available to the server.
+	Runners []string `json:"runners"`
+
+	// Issues explain why GPUs were left unused, with what can be done about
+	// them.
+	Issues []string `json:"issues,omitempty"`
+}
+
+// SystemCPU describes the CPU of the server in a [SystemResponse].
+type SystemCPU struct {
+	Name    string `json:"name,omitempty"`
+	Cores   int    `json:"cores"`
+	Threads int    `json:"threads"`
+
+	// Features are the vector extensions inference uses, such as "avx2".
+	Features []string `json:"features"`
+
+	TotalMemory uint64 `json:"total_memory"`
+	FreeMemory  uint64 `json:"free_memory"`
+}
+
+// SystemGPU describes a GPU of the server in a [SystemResponse].
+type SystemGPU struct {
+	ID      string `json:"id"`
+	Library string `json:"library"`
+	Name    string `json:"name,omitempty"`
+
+	// Compute is the CUDA compute capability, such as "8.9", or the ROCm
+	// gfx version, such as "gfx1100".
+	Compute string `json:"compute,omitempty"`
+	Driver  string `json:"driver,omitempty"`
+
+	TotalMemory uint64 `json:"total_memory"`
+	FreeMemory  uint64 `json:"free_memory"`
+
+	// Runner is the runner build models on this GPU are loaded with.
+	Runner string `json:"runner,omitempty"`
+
+	// Unsupported is why the GPU can't be used, if it can't.
+	Unsupported string `json:"unsupported,omitempty"`
 }
 
 // EmbedRequest is the request passed to [Client.Embed].
@@ -248,7 +656,8 @@ type EmbedRequest struct {
 	// Model is the model name.
 	Model string `json:"model"`
 
-	// Input is the input to embed.
+	// Input is the input to embed: a string, an [EmbedInput], or a list of
+	// either.
 	Input any `json:"input"`
 
 	// KeepAlive controls how long the model will stay loaded in memory following
@@ -257,8 +666,22 @@ type EmbedRequest struct {
 
 	Truncate *bool `json:"truncate,omitempty"`
 
+	// BatchSize is the number of inputs sent to the model at a time. By
+	// default all of them are.
+	BatchSize int `json:"batch_size,omitempty"`
+
 	// Options lists model-specific options.
 	Options map[string]interface{} `json:"options"`
+
+	// Profile selects a named parameter profile, as in [GenerateRequest].
+	Profile string `json:"profile,omitempty"`
+}
+
+// EmbedInput is an input to [Client.Embed] that may include images, which
+// multimodal models embed in the same space as text.
+type EmbedInput struct {
+	Text   string      `json:"text,omitempty"`
+	Images []ImageData `json:"images,omitempty"`
 }
 
 // EmbedResponse is the response from [Client.Embed].
@@ -269,6 +692,170 @@ type EmbedResponse struct {
 	TotalDuration   time.Duration `json:"total_duration,omitempty"`
 	LoadDuration    time.Duration `json:"load_duration,omitempty"`
 	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+
+	// PromptEvalCounts are the number of tokens of each input, in order
+	PromptEvalCounts []int `json:"prompt_eval_counts,omitempty"`
+}
+
+// ClassifyRequest is the request passed to [Client.Classify].
+type ClassifyRequest struct {
+	// Model is the model name. The model must have a classification head.
+	Model string `json:"model"`
+
+	// Input is the input to classify, either a string or a list of strings.
+	Input any `json:"input"`
+
+	// KeepAlive controls how long the model will stay loaded in memory following
+	// this request.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+
+	Truncate *bool `json:"truncate,omitempty"`
+
+	// Options lists model-specific options.
+	Options map[string]interface{} `json:"options"`
+
+	// Profile selects a named parameter profile, as in [GenerateRequest].
+	Profile string `json:"profile,omitempty"`
+}
+
+// ClassifyResponse is the response from [Client.Classify].
+type ClassifyResponse struct {
+	Model string `json:"model"`
+
+	// Classifications holds the labels of each input, most probable first.
+	Classifications [][]LabelProbability `json:"classifications"`
+
+	TotalDuration   time.Duration `json:"total_duration,omitempty"`
+	LoadDuration    time.Duration `json:"load_duration,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+}
+
+// LabelProbability is the probability of a label for an input.
+type LabelProbability struct {
+	Label       string  `json:"label"`
+	Probability float32 `json:"probability"`
+}
+
+// ImageGenerateRequest is the request passed to [Client.GenerateImage].
+// Image generation is experimental.
+type ImageGenerateRequest struct {
+	// Model is the model name. The model must be a diffusion model.
+	Model string `json:"model"`
+
+	// Prompt describes the image to generate.
+	Prompt string `json:"prompt"`
+
+	// NegativePrompt describes what the image shouldn't have.
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+
+	// Size is the size of the image as WIDTHxHEIGHT in pixels, 512x512 by
+	// default.
+	Size string `json:"size,omitempty"`
+
+	// Steps is the number of sampling steps, 20 by default.
+	Steps int `json:"steps,omitempty"`
+
+	// Seed makes the image reproducible. A random seed is used if unset.
+	Seed *int64 `json:"seed,omitempty"`
+
+	// Preview streams a preview of the image with the progress of each step.
+	Preview bool `json:"preview,omitempty"`
+
+	// Stream specifies whether the progress should be streamed.
+	Stream *bool `json:"stream,omitempty"`
+}
+
+// ImageGenerateResponse is the response passed to the function given to
+// [Client.GenerateImage].
+type ImageGenerateResponse struct {
+	Model     string    `json:"model"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Completed is the number of sampling steps completed out of Total.
+	Completed int `json:"completed,omitempty"`
+	Total     int `json:"total,omitempty"`
+
+	// Preview is a PNG preview of the image, if requested.
+	Preview ImageData `json:"preview,omitempty"`
+
+	// Image is the generated PNG image, set once Done.
+	Image ImageData `json:"image,omitempty"`
+
+	// Seed is the seed the image was generated with, set once Done.
+	Seed int64 `json:"seed,omitempty"`
+
+	Done          bool          `json:"done"`
+	TotalDuration time.Duration `json:"total_duration,omitempty"`
+}
+
+// TokenizeRequest is the request passed to [Client.Tokenize].
+type TokenizeRequest struct {
+	// Model is the model name.
+	Model string `json:"model"`
+
+	// Prompt is the text to tokenize.
+	Prompt string `json:"prompt,omitempty"`
+
+	// Template renders Prompt with the model's template, system message
+	// and messages first, as generate does.
+	Template bool `json:"template,omitempty"`
+
+	// Messages are rendered with the model's template, as chat does, and
+	// tokenized instead of Prompt.
+	Messages []Message `json:"messages,omitempty"`
+
+	// Tools are rendered with Messages.
+	Tools `json:"tools,omitempty"`
+
+	// KeepAlive controls how long the model will stay loaded in memory following
+	// this request.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+
+	// Options lists model-specific options.
+	Options map[string]interface{} `json:"options"`
+
+	// Profile selects a named parameter profile, as in [GenerateRequest].
+	Profile string `json:"profile,omitempty"`
+}
+
+// TokenizeResponse is the response from [Client.Tokenize].
+type TokenizeResponse struct {
+	Model  string `json:"model"`
+	Tokens []int  `json:"tokens"`
+	Count  int    `json:"count"`
+
+	// Prompt is the rendered text that was tokenized, if a template was
+	// applied.
+	Prompt string `json:"prompt,omitempty"`
+
+	// ContextLength is the context window of the model as loaded, for
+	// comparing Count with.
+	ContextLength int `json:"context_length"`
+}
+
+// DetokenizeRequest is the request passed to [Client.Detokenize].
+type DetokenizeRequest struct {
+	// Model is the model name.
+	Model string `json:"model"`
+
+	// Tokens are the tokens to turn back into text.
+	Tokens []int `json:"tokens"`
+
+	// KeepAlive controls how long the model will stay loaded in memory following
+	// this request.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+
+	// Options lists model-specific options.
+	Options map[string]interface{} `json:"options"`
+
+	// Profile selects a named parameter profile, as in [GenerateRequest].
+	Profile string `json:"profile,omitempty"`
+}
+
+// DetokenizeResponse is the response from [Client.Detokenize].
+type DetokenizeResponse struct {
+	Model string `json:"model"`
+	Text  string `json:"text"`
 }
 
 // EmbeddingRequest is the request passed to [Client.Embeddings].
@@ -301,18 +888,38 @@ type CreateRequest struct {
 	From       string            `json:"from,omitempty"`
 	Files      map[string]string `json:"files,omitempty"`
 	Adapters   map[string]string `json:"adapters,omitempty"`
+	Tokenizer  map[string]string `json:"tokenizer,omitempty"`
 	Template   string            `json:"template,omitempty"`
 	License    any               `json:"license,omitempty"`
 	System     string            `json:"system,omitempty"`
 	Parameters map[string]any    `json:"parameters,omitempty"`
 	Messages   []Message         `json:"messages,omitempty"`
 
+	// Profiles are named sets of parameters that requests can select with
+	// their Profile field.
+	Profiles map[string]map[string]any `json:"profiles,omitempty"`
+
+	// Router makes the model a router model that dispatches each request to
+	// another model. Router models have no weights of their own.
+	Router *Router `json:"router,omitempty"`
+
 	// Deprecated: set the model name with Model instead
 	Name string `json:"name"`
 	// Deprecated: use Quantize instead
 	Quantization string `json:"quantization,omitempty"`
 }
 
+// Router configures a router model. The prompt of each request is labeled
+// by a classifier model and the request is served by the model routed to
+// from the most probable label that has a route.
+type Router struct {
+	// Classifier is a model with a sequence classification head
+	Classifier string `json:"classifier"`
+
+	// Routes maps labels of the classifier to the models that serve them
+	Routes map[string]string `json:"routes"`
+}
+
 // DeleteRequest is the request passed to [Client.Delete].
 type DeleteRequest struct {
 	Model string `json:"model"`
@@ -338,16 +945,88 @@ type ShowRequest struct {
 
 // ShowResponse is the response returned from [Client.Show].
 type ShowResponse struct {
-	License       string         `json:"license,omitempty"`
-	Modelfile     string         `json:"modelfile,omitempty"`
-	Parameters    string         `json:"parameters,omitempty"`
-	Template      string         `json:"template,omitempty"`
-	System        string         `json:"system,omitempty"`
-	Details       ModelDetails   `json:"details,omitempty"`
-	Messages      []Message      `json:"messages,omitempty"`
-	ModelInfo     map[string]any `json:"model_info,omitempty"`
-	ProjectorInfo map[string]any `json:"projector_info,omitempty"`
-	ModifiedAt    time.Time      `json:"modified_at,omitempty"`
+	License         string                    `json:"license,omitempty"`
+	Modelfile       string                    `json:"modelfile,omitempty"`
+	Parameters      string                    `json:"parameters,omitempty"`
+	Template        string                    `json:"template,omitempty"`
+	System          string                    `json:"system,omitempty"`
+	Details         ModelDetails              `json:"details,omitempty"`
+	Messages        []Message                 `json:"messages,omitempty"`
+	Profiles        map[string]map[string]any `json:"profiles,omitempty"`
+	Router          *Router                   `json:"router,omitempty"`
+	ModelInfo       map[string]any            `json:"model_info,omitempty"`
+	ProjectorInfo   map[string]any            `json:"projector_info,omitempty"`
+	EffectiveConfig *EffectiveConfig          `json:"effective_config,omitempty"`
+	Embedding       *EmbeddingInfo            `json:"embedding,omitempty"`
+	ModifiedAt      time.Time                 `json:"modified_at,omitempty"`
+
+	// Name is the fully qualified name of the model, after resolving
+	// aliases, split into its parts.
+	Name *ModelName `json:"name,omitempty"`
+
+	// Digest is the digest of the model's manifest.
+	Digest string `json:"digest,omitempty"`
+
+	// Size is the total size of the model's layers in bytes.
+	Size int64 `json:"size,omitempty"`
+}
+
+// ModelName is a model name split into its parts.
+type ModelName struct {
+	Host      string `json:"host"`
+	Namespace string `json:"namespace"`
+	Model     string `json:"model"`
+	Tag       string `json:"tag"`
+}
+
+// EmbeddingInfo describes the embeddings an embedding model generates.
+type EmbeddingInfo struct {
+	// Dimension is the length of each embedding.
+	Dimension int `json:"dimension"`
+
+	// MaxSequenceLength is the most tokens of an input that are embedded,
+	// the smaller of the model's context length and the context window it
+	// runs with. Longer inputs are truncated or rejected.
+	MaxSequenceLength int `json:"max_sequence_length"`
+
+	// PoolingType is how the embeddings of the tokens of an input are
+	// pooled into one: "none", "mean", "cls" or "last".
+	PoolingType string `json:"pooling_type"`
+
+	// Normalized is true if [Client.Embed] returns embeddings of unit
+	// length.
+	Normalized bool `json:"normalized"`
+}
+
+// EffectiveConfig is the configuration a model runs with when a request does
+// not override it.
+type EffectiveConfig struct {
+	NumCtx int `json:"num_ctx"`
+
+	// ContextPolicy is the policy NumCtx was sized to the available memory
+	// with, if any.
+	ContextPolicy string `json:"context_policy,omitempty"`
+
+	// KeepAlive is how long the model stays loaded after a request that
+	// doesn't set keep_alive.
+	KeepAlive Duration `json:"keep_alive"`
+
+	// NumParallel is the number of requests the model serves at the same
+	// time, or 0 if it's chosen from the memory available when it's loaded.
+	NumParallel int `json:"num_parallel"`
+}
+
+// ShowTypedResponse is the response returned from [Client.ShowTyped].
+type ShowTypedResponse struct {
+	ShowResponse
+
+	// Options are the model's parameters decoded into the types of the
+	// corresponding [Options] fields, keyed by their JSON names.
+	Options map[string]any
+
+	// ParsedTemplate is the model's template, parsed with the functions
+	// available to templates on the server.
+	ParsedTemplate *template.Template
 }
 
 // CopyRequest is the request passed to [Client.Copy].
@@ -377,6 +1056,33 @@ type ProgressResponse struct {
 	Completed int64  `json:"completed,omitempty"`
 }
 
+// PullEventKind is the kind of a [PullEvent].
+type PullEventKind int
+
+const (
+	// PullEventStatus is any status not covered by another kind.
+	PullEventStatus PullEventKind = iota
+	PullEventManifest
+	// PullEventLayer reports download progress of the layer Digest.
+	PullEventLayer
+	PullEventVerify
+	PullEventWrite
+	PullEventCleanup
+	PullEventSuccess
+	// PullEventError ends a failed pull. Err is the reason it failed.
+	PullEventError
+)
+
+// PullEvent is a progress event sent by [Client.PullWithProgress].
+type PullEvent struct {
+	Kind      PullEventKind
+	Status    string
+	Digest    string
+	Total     int64
+	Completed int64
+	Err       error
+}
+
 // PushRequest is the request passed to [Client.Push].
 type PushRequest struct {
 	Model    string `json:"model"`
@@ -418,6 +1124,292 @@ type ProcessModelResponse struct {
 	Details   ModelDetails `json:"details,omitempty"`
 	ExpiresAt time.Time    `json:"expires_at"`
 	SizeVRAM  int64        `json:"size_vram"`
+
+	// GPULayers is the number of the model's Layers offloaded to GPUs.
+	GPULayers int `json:"gpu_layers,omitempty"`
+	Layers    int `json:"layers,omitempty"`
+
+	// NumParallel is the number of requests the model serves at the same
+	// time.
+	NumParallel int `json:"num_parallel,omitempty"`
+}
+
+// Transfer is an in-flight pull or push.
+type Transfer struct {
+	ID string `json:"id"`
+
+	// Type is "pull" or "push".
+	Type      string    `json:"type"`
+	Model     string    `json:"model"`
+	Status    string    `json:"status"`
+	StartedAt time.Time `json:"started_at"`
+
+	// Completed and Total are the bytes transferred so far and the size of
+	// the layers started.
+	Completed int64 `json:"completed"`
+	Total     int64 `json:"total"`
+}
+
+// ListTransfersResponse is the response from [Client.ListTransfers].
+type ListTransfersResponse struct {
+	Transfers []Transfer `json:"transfers"`
+}
+
+// UpdateModelRequest is the request passed to [Client.UpdateModel]. Settings
+// left nil are unchanged.
+type UpdateModelRequest struct {
+	Model string `json:"model"`
+
+	KeepAlive   *Duration `json:"keep_alive,omitempty"`
+	NumCtx      *int      `json:"num_ctx,omitempty"`
+	NumParallel *int      `json:"num_parallel,omitempty"`
+}
+
+// UnloadRequest is the request passed to [Client.Unload].
+type UnloadRequest struct {
+	Model string `json:"model"`
+}
+
+// UnloadResponse is the response from [Client.Unload].
+type UnloadResponse struct {
+	Model string `json:"model"`
+
+	// Status is "unloaded" once the model has been unloaded and its memory
+	// released, or "not loaded" if it wasn't loaded.
+	Status string `json:"status"`
+}
+
+// DefragResponse is the response from [Client.Defrag].
+type DefragResponse struct {
+	Models []DefragModel `json:"models"`
+}
+
+// DefragModel is the result of compacting the memory of a loaded model in
+// [DefragResponse].
+type DefragModel struct {
+	Model string `json:"model"`
+
+	// Status is "reloaded" if the model was unloaded and loaded again,
+	// "busy" if it was serving requests and left as is, or "failed" if it
+	// could not be loaded again.
+	Status   string `json:"status"`
+	SizeVRAM int64  `json:"size_vram"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HealthResponse is the response from [Client.Health].
+type HealthResponse struct {
+	// Status is "healthy", "degraded" if the server works with less
+	// capacity than it has, such as after losing a GPU, or "unhealthy" if
+	// it can't serve requests well. It is the worst status of Causes.
+	Status string `json:"status"`
+
+	// Causes are why the server isn't healthy.
+	Causes []HealthCause `json:"causes,omitempty"`
+}
+
+// HealthCause is a reason a server is degraded or unhealthy.
+type HealthCause struct {
+	// Kind is "gpu_lost", "disk_nearly_full" or "disk_full".
+	Kind    string `json:"kind"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// APIKeyUser is a user of the API keys of a server, as passed to
+// [Client.CreateKey] and returned from [Client.ListKeys].
+type APIKeyUser struct {
+	Name string `json:"name"`
+
+	// Keys are the last characters of the keys of the user, for telling
+	// them apart. They are only listed.
+	Keys []string `json:"keys,omitempty"`
+
+	// Run, Pull and Delete are patterns of the models the user may run,
+	// pull and delete.
+	Run    []string `json:"run,omitempty"`
+	Pull   []string `json:"pull,omitempty"`
+	Delete []string `json:"delete,omitempty"`
+
+	// Admin lets the user change the configuration of the server, such as
+	// its API keys.
+	Admin bool `json:"admin,omitempty"`
+
+	// RequestsPerMinute and TokensPerMinute limit the requests and the
+	// tokens of each key of the user. 0 is unlimited.
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	TokensPerMinute   int `json:"tokens_per_minute,omitempty"`
+}
+
+// ListKeysResponse is the response from [Client.ListKeys].
+type ListKeysResponse struct {
+	Users []APIKeyUser `json:"users"`
+}
+
+// CreateKeyResponse is the response from [Client.CreateKey].
+type CreateKeyResponse struct {
+	Name string `json:"name"`
+
+	// Key is the new key. It is only returned once.
+	Key string `json:"key"`
+}
+
+// DeleteKeyRequest is the request passed to [Client.DeleteKey]. It deletes
+// Key, or the user Name with all their keys.
+type DeleteKeyRequest struct {
+	Name string `json:"name,omitempty"`
+	Key  string `json:"key,omitempty"`
+}
+
+// LogLevel is the level the server logs at, as passed to and returned from
+// [Client.SetLogLevel]: one of "debug", "info", "warn" or "error".
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+// PrefixRequest is the request passed to [Client.Prefix].
+type PrefixRequest struct {
+	// Model is the model the prefix is evaluated with.
+	Model string `json:"model"`
+
+	// System is the system prompt to pin.
+	System string `json:"system"`
+
+	// KeepAlive controls how long the model will stay loaded into memory
+	// following the request.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+}
+
+// PrefixResponse is the response returned by [Client.Prefix].
+type PrefixResponse struct {
+	ID    string `json:"id"`
+	Model string `json:"model"`
+}
+
+// AliasRequest is the request passed to [Client.CreateAlias] and
+// [Client.DeleteAlias].
+type AliasRequest struct {
+	// Alias is the name the target is known by.
+	Alias string `json:"alias"`
+
+	// Target is the model the alias refers to. It is unused when deleting.
+	Target string `json:"target,omitempty"`
+}
+
+// Alias is a name that refers to a model.
+type Alias struct {
+	Alias  string `json:"alias"`
+	Target string `json:"target"`
+}
+
+// ListAliasesResponse is the response from [Client.ListAliases].
+type ListAliasesResponse struct {
+	Aliases []Alias `json:"aliases"`
+}
+
+// ConversationMessage is a single message stored in a server-side
+// conversation.
+type ConversationMessage struct {
+	ID      string  `json:"id"`
+	Message Message `json:"message"`
+}
+
+// Conversation is a server-side chat history. A conversation forked from
+// another references its parent and shares the parent's history up to and
+// including ParentMessage.
+type Conversation struct {
+	ID            string                `json:"id"`
+	Parent        string                `json:"parent,omitempty"`
+	ParentMessage string                `json:"parent_message,omitempty"`
+	CreatedAt     time.Time             `json:"created_at"`
+	Title         string                `json:"title,omitempty"`
+	Summary       string                `json:"summary,omitempty"`
+	Seed          int                   `json:"seed"`
+	Variant       int                   `json:"variant,omitempty"`
+	Messages      []ConversationMessage `json:"messages"`
+}
+
+// ConversationRequest is the request passed to create a conversation. Seed
+// is the base of the sampling seeds of chat turns in the conversation; if it
+// is nil, a random seed is chosen.
+type ConversationRequest struct {
+	Messages []Message `json:"messages,omitempty"`
+	Seed     *int      `json:"seed,omitempty"`
+}
+
+// SummarizeRequest is the request passed to generate a title and summary for
+// a conversation. If Model is empty, the server's configured summary model is
+// used.
+type SummarizeRequest struct {
+	Model string `json:"model,omitempty"`
+}
+
+// ForkRequest is the request passed to fork a conversation. The new
+// conversation shares history up to and including MessageID, followed by
+// Messages. The fork inherits the parent's seed, so regenerating a turn
+// reproduces the original reply unless Regenerate is set, in which case the
+// fork samples a different, but still deterministic, variant.
+type ForkRequest struct {
+	MessageID  string    `json:"message_id"`
+	Messages   []Message `json:"messages,omitempty"`
+	Regenerate bool      `json:"regenerate,omitempty"`
+}
+
+// HistoryEntry is a generate or chat request recorded in the server's local
+// history. The exchange itself, Prompt and Response for generate or Messages
+// for chat, is only kept when the server captures exchanges and is only
+// returned by [Client.ShowHistory].
+type HistoryEntry struct {
+	ID        string    `json:"id"`
+	Endpoint  string    `json:"endpoint"`
+	Model     string    `json:"model"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// User is the name of the user who sent the request, if access control
+	// is enabled.
+	User string `json:"user,omitempty"`
+
+	// PromptHash is the SHA-256 of the prompt evaluated by the model, after
+	// templating.
+	PromptHash string `json:"prompt_hash"`
+
+	DoneReason      string        `json:"done_reason,omitempty"`
+	TotalDuration   time.Duration `json:"total_duration"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+
+	Captured bool      `json:"captured"`
+	Prompt   string    `json:"prompt,omitempty"`
+	Response string    `json:"response,omitempty"`
+	Messages []Message `json:"messages,omitempty"`
+}
+
+// ListHistoryResponse is the response from [Client.ListHistory], newest
+// first.
+type ListHistoryResponse struct {
+	Entries []HistoryEntry `json:"entries"`
+}
+
+// Session is a KV cache kept for the follow-up requests of a session.
+type Session struct {
+	ID    string `json:"id"`
+	Model string `json:"model"`
+
+	// Tokens is the number of tokens in the cache.
+	Tokens int `json:"tokens"`
+
+	// Size is the size of the cache on disk in bytes.
+	Size int64 `json:"size"`
+
+	// UsedAt is when the session was last saved or resumed. Sessions are
+	// evicted least recently used first.
+	UsedAt time.Time `json:"used_at"`
+}
+
+// ListSessionsResponse is the response from [Client.ListSessions], most
+// recently used first.
+type ListSessionsResponse struct {
+	Sessions []Session `json:"sessions"`
 }
 
 type RetrieveModelResponse struct {
@@ -452,9 +1444,97 @@ type GenerateResponse struct {
 	// can be sent in the next request to keep a conversational memory.
 	Context []int `json:"context,omitempty"`
 
+	// Language is the detected language of the response, set on the final
+	// response if the language or detect_language option is set.
+	Language string `json:"language,omitempty"`
+
+	// RoutedTo is the model that served the request, if Model is a router
+	// model.
+	RoutedTo string `json:"routed_to,omitempty"`
+
+	// Load is set on responses streamed while the model is loaded for the
+	// request. These responses have no textual response.
+	Load *LoadEvent `json:"load,omitempty"`
+
+	// Tokens are the ids of the generated tokens, set on the final response
+	// if ReturnTokens is set in the request.
+	Tokens []int `json:"tokens,omitempty"`
+
+	// Logprobs are the log probabilities of the tokens of this response if
+	// Logprobs is set in the request.
+	Logprobs []Logprob `json:"logprobs,omitempty"`
+
+	// Degenerate is set on the final response if the watchdog option is set
+	// and it detected degenerate output.
+	Degenerate *Degeneration `json:"degenerate,omitempty"`
+
 	Metrics
 }
 
+// LoadEvent is the progress of loading a model.
+type LoadEvent struct {
+	// Model is the name of the model being loaded.
+	Model string `json:"model"`
+
+	// Stage is the step of loading the model: "starting", "loading weights",
+	// "allocating cache", "loading adapters", "loading projector", and
+	// finally "ready" or "failed".
+	Stage string `json:"stage"`
+
+	// Progress is the fraction of the model weights read.
+	Progress float32 `json:"progress"`
+
+	// GPULayers is the number of layers offloaded to the GPU out of Layers.
+	GPULayers int `json:"gpu_layers"`
+	Layers    int `json:"layers"`
+
+	// Error is the reason the load failed.
+	Error string `json:"error,omitempty"`
+}
+
+// ScrubEvent is the result of re-verifying blobs in the background.
+type ScrubEvent struct {
+	// Stage is "corrupt" for a blob whose content no longer matches its
+	// digest, or "completed" at the end of a pass over all blobs.
+	Stage string `json:"stage"`
+
+	// Digest is the digest of the corrupt blob, and Models are the models
+	// using it, which need to be pulled or created again.
+	Digest string   `json:"digest,omitempty"`
+	Models []string `json:"models,omitempty"`
+
+	// Verified and Corrupt are the number of blobs checked by a completed
+	// pass and how many of them were corrupt.
+	Verified int `json:"verified,omitempty"`
+	Corrupt  int `json:"corrupt,omitempty"`
+}
+
+// ScheduleEvent is the outcome of a scheduled load or unload of a model.
+type ScheduleEvent struct {
+	// Model is the name of the model in the schedule.
+	Model string `json:"model"`
+
+	// Action is "load" or "unload".
+	Action string `json:"action"`
+
+	// Stage is "completed", or "failed" with the reason in Error.
+	Stage string `json:"stage"`
+	Error string `json:"error,omitempty"`
+}
+
+// Event is a server event streamed by [Client.Events].
+type Event struct {
+	// Type is the kind of event. Events of type "load" have Load set,
+	// events of type "scrub" have Scrub set and events of type "schedule"
+	// have Schedule set.
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	Load     *LoadEvent     `json:"load,omitempty"`
+	Scrub    *ScrubEvent    `json:"scrub,omitempty"`
+	Schedule *ScheduleEvent `json:"schedule,omitempty"`
+}
+
 // ModelDetails provides details about a model.
 type ModelDetails struct {
 	ParentModel       string   `json:"parent_model"`
@@ -470,17 +1550,26 @@ func (m *Metrics) Summary() {
 		fmt.Fprintf(os.Stderr, "total duration:       %v\n", m.TotalDuration)
 	}
 
+	if m.QueueDuration > 0 {
+		fmt.Fprintf(os.Stderr, "queue duration:       %v\n", m.QueueDuration)
+	}
+
 	if m.LoadDuration > 0 {
-		fmt.Fprintf(os.Stderr, "load duration:        %v\n", m.LoadDuration)
+		fmt.Fprintf(os.Stderr, "load duration:        %v\n", m.LoadDuration-m.QueueDuration)
 	}
 
 	if m.PromptEvalCount > 0 {
 		fmt.Fprintf(os.Stderr, "prompt eval count:    %d token(s)\n", m.PromptEvalCount)
 	}
 
+	if m.PromptCacheCount > 0 {
+		fmt.Fprintf(os.Stderr, "prompt cache hits:    %d token(s) (%.1f%%)\n", m.PromptCacheCount, 100*float64(m.PromptCacheCount)/float64(m.PromptEvalCount))
+	}
+
 	if m.PromptEvalDuration > 0 {
+		// only tokens missing from the cache are evaluated
 		fmt.Fprintf(os.Stderr, "prompt eval duration: %s\n", m.PromptEvalDuration)
-		fmt.Fprintf(os.Stderr, "prompt eval rate:     %.2f tokens/s\n", float64(m.PromptEvalCount)/m.PromptEvalDuration.Seconds())
+		fmt.Fprintf(os.Stderr, "prompt eval rate:     %.2f tokens/s\n", float64(m.PromptEvalCount-m.PromptCacheCount)/m.PromptEvalDuration.Seconds())
 	}
 
 	if m.EvalCount > 0 {
@@ -558,11 +1647,18 @@ func (opts *Options) FromMap(m map[string]interface{}) error {
 				// convert []interface{} to []string
 				slice := make([]string, len(val))
 				for i, item := range val {
-					str, ok := item.(string)
-					if !ok {
+					switch item := item.(type) {
+					case string:
+						slice[i] = item
+					case float64:
+						// token ids, such as of stop_tokens
+						if item != math.Trunc(item) {
+							return fmt.Errorf("option %q must be of an array of strings or integers", key)
+						}
+						slice[i] = strconv.FormatInt(int64(item), 10)
+					default:
 						return fmt.Errorf("option %q must be of an array of strings", key)
 					}
-					slice[i] = str
 				}
 				field.Set(reflect.ValueOf(slice))
 			case reflect.Pointer:
@@ -606,6 +1702,7 @@ func DefaultOptions() Options {
 		MirostatTau:      5.0,
 		MirostatEta:      0.1,
 		Seed:             -1,
+		WatchdogWindow:   128,
 
 		Runner: Runner{
 			// options set when the model is loaded
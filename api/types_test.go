@@ -209,6 +209,47 @@ func TestUseMmapFormatParams(t *testing.T) {
 	}
 }
 
+func TestStopTokensParsingFromJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		req  string
+		exp  []string
+		err  bool
+	}{
+		{
+			name: "Names",
+			req:  `{ "stop_tokens": ["<|eot_id|>", "<|eom_id|>"] }`,
+			exp:  []string{"<|eot_id|>", "<|eom_id|>"},
+		},
+		{
+			name: "Ids",
+			req:  `{ "stop_tokens": [128009, "<|eom_id|>"] }`,
+			exp:  []string{"128009", "<|eom_id|>"},
+		},
+		{
+			name: "Fraction",
+			req:  `{ "stop_tokens": [1.5] }`,
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var oMap map[string]interface{}
+			err := json.Unmarshal([]byte(test.req), &oMap)
+			require.NoError(t, err)
+			opts := DefaultOptions()
+			err = opts.FromMap(oMap)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.exp, opts.StopTokens)
+		})
+	}
+}
+
 func TestMessage_UnmarshalJSON(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ErrNoCredentials is returned when no credentials are stored for a registry.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Credentials are the username and password, or token, of a registry.
+type Credentials struct {
+	Username string
+	Secret   string
+}
+
+// credentialsConfig is the credentials file, ~/.ollama/credentials.json. It
+// has the "auths", "credsStore" and "credHelpers" of Docker's config.json so
+// the same credential helpers, such as docker-credential-osxkeychain, keep
+// secrets in the system keychain. Credentials for registries without a
+// helper are kept in the file.
+type credentialsConfig struct {
+	Auths       map[string]authConfig `json:"auths,omitempty"`
+	CredsStore  string                `json:"credsStore,omitempty"`
+	CredHelpers map[string]string     `json:"credHelpers,omitempty"`
+}
+
+type authConfig struct {
+	// Auth is the base64 of "<username>:<password>"
+	Auth string `json:"auth"`
+}
+
+func credentialsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "credentials.json"), nil
+}
+
+func readCredentialsConfig() (*credentialsConfig, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	var config credentialsConfig
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &config, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &config, nil
+}
+
+func (c *credentialsConfig) write() error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0o600)
+}
+
+// helper returns the credential helper for host: the one configured for it,
+// the configured store, or the helper of the system keychain if it is
+// installed. It returns "" if credentials are kept in the file.
+func (c *credentialsConfig) helper(host string) string {
+	if h, ok := c.CredHelpers[host]; ok {
+		return h
+	}
+
+	if c.CredsStore != "" {
+		return c.CredsStore
+	}
+
+	var keychain string
+	switch runtime.GOOS {
+	case "darwin":
+		keychain = "osxkeychain"
+	case "windows":
+		keychain = "wincred"
+	default:
+		keychain = "secretservice"
+	}
+
+	if _, err := exec.LookPath("docker-credential-" + keychain); err == nil {
+		return keychain
+	}
+
+	return ""
+}
+
+// runHelper runs the credential helper docker-credential-<helper> with action,
+// writing input to its stdin, and returns its stdout.
+func runHelper(ctx context.Context, helper, action string, input []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker-credential-"+helper, action)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		// helpers report errors on stdout
+		msg := strings.TrimSpace(stdout.String() + stderr.String())
+		if strings.Contains(msg, "credentials not found") {
+			return nil, ErrNoCredentials
+		}
+
+		return nil, fmt.Errorf("credential helper %s: %w: %s", helper, err, msg)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// LookupCredentials returns the credentials stored for the registry host,
+// or ErrNoCredentials.
+func LookupCredentials(ctx context.Context, host string) (Credentials, error) {
+	config, err := readCredentialsConfig()
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	if helper := config.helper(host); helper != "" {
+		out, err := runHelper(ctx, helper, "get", []byte(host))
+		if err != nil {
+			return Credentials{}, err
+		}
+
+		var c Credentials
+		if err := json.Unmarshal(out, &c); err != nil {
+			return Credentials{}, fmt.Errorf("credential helper %s: %w", helper, err)
+		}
+
+		return c, nil
+	}
+
+	a, ok := config.Auths[host]
+	if !ok {
+		return Credentials{}, ErrNoCredentials
+	}
+
+	b, err := base64.StdEncoding.DecodeString(a.Auth)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("credentials for %s: %w", host, err)
+	}
+
+	username, secret, _ := strings.Cut(string(b), ":")
+	return Credentials{Username: username, Secret: secret}, nil
+}
+
+// StoreCredentials stores the credentials of the registry host with its
+// credential helper, or in the credentials file if it has none.
+func StoreCredentials(ctx context.Context, host string, c Credentials) error {
+	config, err := readCredentialsConfig()
+	if err != nil {
+		return err
+	}
+
+	if helper := config.helper(host); helper != "" {
+		b, err := json.Marshal(map[string]string{"ServerURL": host, "Username": c.Username, "Secret": c.Secret})
+		if err != nil {
+			return err
+		}
+
+		_, err = runHelper(ctx, helper, "store", b)
+		return err
+	}
+
+	if config.Auths == nil {
+		config.Auths = make(map[string]authConfig)
+	}
+
+	config.Auths[host] = authConfig{Auth: base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Secret))}
+	return config.write()
+}
+
+// EraseCredentials removes the credentials stored for the registry host.
+func EraseCredentials(ctx context.Context, host string) error {
+	config, err := readCredentialsConfig()
+	if err != nil {
+		return err
+	}
+
+	if helper := config.helper(host); helper != "" {
+		_, err := runHelper(ctx, helper, "erase", []byte(host))
+		return err
+	}
+
+	if _, ok := config.Auths[host]; !ok {
+		return ErrNoCredentials
+	}
+
+	delete(config.Auths, host)
+	return config.write()
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCredentialsFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", t.TempDir())
+	t.Setenv("PATH", t.TempDir())
+
+	ctx := context.Background()
+	if _, err := LookupCredentials(ctx, "registry.example.com"); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected %v, got %v", ErrNoCredentials, err)
+	}
+
+	want := Credentials{Username: "alice", Secret: "pass:word"}
+	if err := StoreCredentials(ctx, "registry.example.com", want); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := credentialsPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if runtime.GOOS != "windows" && fi.Mode().Perm() != 0o600 {
+		t.Errorf("expected mode 0600, got %v", fi.Mode().Perm())
+	}
+
+	if got, err := LookupCredentials(ctx, "registry.example.com"); err != nil || got != want {
+		t.Errorf("expected %v, got %v, %v", want, got, err)
+	}
+
+	if err := EraseCredentials(ctx, "registry.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LookupCredentials(ctx, "registry.example.com"); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected %v after erase, got %v", ErrNoCredentials, err)
+	}
+}
+
+func TestCredentialsHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helper script requires a POSIX shell")
+	}
+
+	home, bin := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PATH", bin)
+
+	// a helper that knows credentials for one registry
+	helper := `#!/bin/sh
+read host
+if [ "$1" = get ] && [ "$host" = registry.example.com ]; then
+	printf '{"ServerURL":"%s","Username":"bob","Secret":"token"}' "$host"
+	exit 0
+fi
+echo "credentials not found in native keychain"
+exit 1
+`
+	if err := os.WriteFile(filepath.Join(bin, "docker-credential-test"), []byte(helper), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(home, ".ollama"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(home, ".ollama", "credentials.json"), []byte(`{"credHelpers":{"registry.example.com":"test"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	want := Credentials{Username: "bob", Secret: "token"}
+	if got, err := LookupCredentials(ctx, "registry.example.com"); err != nil || got != want {
+		t.Errorf("expected %v, got %v, %v", want, got, err)
+	}
+
+	// other registries have no helper and nothing in the file
+	if _, err := LookupCredentials(ctx, "other.example.com"); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected %v, got %v", ErrNoCredentials, err)
+	}
+}
@@ -10,10 +10,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"math"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -138,6 +140,17 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 		req.Adapters = fileMap
 	}
 
+	if len(req.Tokenizer) > 0 {
+		fileMap := map[string]string{}
+		for f, digest := range req.Tokenizer {
+			if _, err := createBlob(cmd, client, f, digest, p); err != nil {
+				return err
+			}
+			fileMap[filepath.Base(f)] = digest
+		}
+		req.Tokenizer = fileMap
+	}
+
 	bars := make(map[string]*progress.Bar)
 	fn := func(resp api.ProgressResponse) error {
 		if resp.Digest != "" {
@@ -244,7 +257,26 @@ func loadOrUnloadModel(cmd *cobra.Command, opts *runOptions) error {
 		KeepAlive: opts.KeepAlive,
 	}
 
-	return client.Generate(cmd.Context(), req, func(api.GenerateResponse) error { return nil })
+	return client.Generate(cmd.Context(), req, func(resp api.GenerateResponse) error {
+		if resp.Load != nil {
+			spinner.SetMessage(loadStatus(resp.Load))
+		}
+		return nil
+	})
+}
+
+// loadStatus describes the progress of a model load for a spinner.
+func loadStatus(e *api.LoadEvent) string {
+	switch e.Stage {
+	case "starting":
+		if e.Layers > 0 {
+			return fmt.Sprintf("starting (%d/%d layers on gpu)", e.GPULayers, e.Layers)
+		}
+	case "loading weights":
+		return fmt.Sprintf("loading weights %d%%", int(e.Progress*100))
+	}
+
+	return e.Stage
 }
 
 func StopHandler(cmd *cobra.Command, args []string) error {
@@ -416,6 +448,9 @@ func PushHandler(cmd *cobra.Command, args []string) error {
 			spinner.Stop()
 		}
 		if strings.Contains(err.Error(), "access denied") {
+			if !strings.HasSuffix(n.Host, ".ollama.ai") && !strings.HasSuffix(n.Host, ".ollama.com") {
+				return fmt.Errorf("you are not authorized to push to %s, run 'ollama login %s' first", n.Host, n.Host)
+			}
 			return errors.New("you are not authorized to push to this namespace, create the model under a namespace you own")
 		}
 		return err
@@ -427,6 +462,8 @@ func PushHandler(cmd *cobra.Command, args []string) error {
 	destination := n.String()
 	if strings.HasSuffix(n.Host, ".ollama.ai") || strings.HasSuffix(n.Host, ".ollama.com") {
 		destination = "https://ollama.com/" + strings.TrimSuffix(n.DisplayShortest(), ":latest")
+	} else if n.Host == "hf.co" || n.Host == "huggingface.co" {
+		destination = "https://huggingface.co/" + n.Namespace + "/" + n.Model
 	}
 	fmt.Printf("\nYou can find your model at:\n\n")
 	fmt.Printf("\t%s\n", destination)
@@ -440,15 +477,39 @@ func ListHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	models, err := client.List(cmd.Context())
+	var models *api.ListResponse
+	if query, _ := cmd.Flags().GetString("search"); query != "" {
+		// best matches first
+		models, err = client.Search(cmd.Context(), query)
+	} else {
+		models, err = client.List(cmd.Context())
+	}
 	if err != nil {
 		return err
 	}
 
+	// a filter with wildcards, such as "example.com/*/mistral", is matched
+	// against each part of the name; any other filter is a prefix
+	match := func(name string) bool {
+		return len(args) == 0 || strings.HasPrefix(strings.ToLower(name), strings.ToLower(args[0]))
+	}
+
+	if len(args) > 0 && strings.ContainsAny(args[0], "*?[") {
+		filter := args[0]
+		if strings.LastIndex(filter, ":") <= strings.LastIndex(filter, "/") {
+			filter += ":*"
+		}
+
+		pattern := model.ParseName(filter)
+		match = func(name string) bool {
+			return model.ParseName(name).Match(pattern)
+		}
+	}
+
 	var data [][]string
 
 	for _, m := range models.Models {
-		if len(args) == 0 || strings.HasPrefix(strings.ToLower(m.Name), strings.ToLower(args[0])) {
+		if match(m.Name) {
 			data = append(data, []string{m.Name, m.Digest[:12], format.HumanBytes(m.Size), format.HumanTime(m.ModifiedAt, "Never")})
 		}
 	}
@@ -521,6 +582,66 @@ func ListRunningHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func InfoHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	info, err := client.System(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	features := strings.Join(info.CPU.Features, " ")
+	if features == "" {
+		features = "none"
+	}
+
+	fmt.Printf("Platform:  %s/%s\n", info.OS, info.Arch)
+	fmt.Printf("CPU:       %s (%d cores, %d threads)\n", info.CPU.Name, info.CPU.Cores, info.CPU.Threads)
+	fmt.Printf("Features:  %s\n", features)
+	fmt.Printf("Memory:    %s free of %s\n", format.HumanBytes2(info.CPU.FreeMemory), format.HumanBytes2(info.CPU.TotalMemory))
+	if info.Metal {
+		fmt.Println("Metal:     available")
+	}
+	fmt.Printf("Runner:    %s\n", info.Runner)
+	fmt.Printf("Available: %s\n", strings.Join(info.Runners, " "))
+
+	if len(info.GPUs) > 0 {
+		var data [][]string
+		for _, gpu := range info.GPUs {
+			runner := gpu.Runner
+			if gpu.Unsupported != "" {
+				runner = "unsupported: " + gpu.Unsupported
+			}
+
+			data = append(data, []string{gpu.ID, gpu.Name, gpu.Library, gpu.Compute, gpu.Driver, format.HumanBytes2(gpu.FreeMemory), format.HumanBytes2(gpu.TotalMemory), runner})
+		}
+
+		fmt.Println()
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"GPU", "NAME", "LIBRARY", "COMPUTE", "DRIVER", "FREE", "TOTAL", "RUNNER"})
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetHeaderLine(false)
+		table.SetBorder(false)
+		table.SetNoWhiteSpace(true)
+		table.SetTablePadding("    ")
+		table.AppendBulk(data)
+		table.Render()
+	}
+
+	if len(info.Issues) > 0 {
+		fmt.Println()
+		for _, issue := range info.Issues {
+			fmt.Println("Issue:", issue)
+		}
+	}
+
+	return nil
+}
+
 func DeleteHandler(cmd *cobra.Command, args []string) error {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
@@ -669,6 +790,16 @@ func showInfo(resp *api.ShowResponse, w io.Writer) error {
 		})
 	}
 
+	if resp.Embedding != nil {
+		tableRender("Embedding", func() (rows [][]string) {
+			rows = append(rows, []string{"", "dimension", strconv.Itoa(resp.Embedding.Dimension)})
+			rows = append(rows, []string{"", "max sequence length", strconv.Itoa(resp.Embedding.MaxSequenceLength)})
+			rows = append(rows, []string{"", "pooling", resp.Embedding.PoolingType})
+			rows = append(rows, []string{"", "normalized", strconv.FormatBool(resp.Embedding.Normalized)})
+			return
+		})
+	}
+
 	if resp.Parameters != "" {
 		tableRender("Parameters", func() (rows [][]string) {
 			scanner := bufio.NewScanner(strings.NewReader(resp.Parameters))
@@ -720,6 +851,167 @@ func CopyHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// AliasHandler creates an alias of a model, deletes one with --delete, or
+// lists the aliases when given no arguments.
+func AliasHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	del, err := cmd.Flags().GetBool("delete")
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case del:
+		if len(args) != 1 {
+			return errors.New("--delete requires an alias")
+		}
+
+		if err := client.DeleteAlias(cmd.Context(), &api.AliasRequest{Alias: args[0]}); err != nil {
+			return err
+		}
+		fmt.Printf("deleted alias '%s'\n", args[0])
+	case len(args) == 2:
+		alias, err := client.CreateAlias(cmd.Context(), &api.AliasRequest{Alias: args[0], Target: args[1]})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("'%s' is an alias of '%s'\n", alias.Alias, alias.Target)
+	case len(args) == 0:
+		resp, err := client.ListAliases(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		var data [][]string
+		for _, a := range resp.Aliases {
+			data = append(data, []string{a.Alias, a.Target})
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"ALIAS", "TARGET"})
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetHeaderLine(false)
+		table.SetBorder(false)
+		table.SetNoWhiteSpace(true)
+		table.SetTablePadding("    ")
+		table.AppendBulk(data)
+		table.Render()
+	default:
+		return errors.New("alias requires an alias and a target model")
+	}
+
+	return nil
+}
+
+func HistoryHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ListHistory(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	var data [][]string
+	for _, e := range resp.Entries {
+		data = append(data, []string{
+			e.ID,
+			e.Model,
+			e.Endpoint,
+			e.PromptHash[:min(12, len(e.PromptHash))],
+			fmt.Sprintf("%d/%d", e.PromptEvalCount, e.EvalCount),
+			e.TotalDuration.Round(time.Millisecond).String(),
+			format.HumanTime(e.CreatedAt, "Never"),
+		})
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"ID", "MODEL", "ENDPOINT", "PROMPT", "TOKENS", "DURATION", "CREATED"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.AppendBulk(data)
+	table.Render()
+
+	return nil
+}
+
+func HistoryShowHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	e, err := client.ShowHistory(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("id         %s\n", e.ID)
+	fmt.Printf("model      %s\n", e.Model)
+	fmt.Printf("endpoint   %s\n", e.Endpoint)
+	fmt.Printf("created    %s\n", e.CreatedAt.Local().Format(time.DateTime))
+	fmt.Printf("duration   %s\n", e.TotalDuration.Round(time.Millisecond))
+	fmt.Printf("tokens     %d prompt, %d generated\n", e.PromptEvalCount, e.EvalCount)
+	fmt.Printf("prompt     %s\n", e.PromptHash)
+	if e.DoneReason != "" {
+		fmt.Printf("done       %s\n", e.DoneReason)
+	}
+	fmt.Println()
+
+	switch {
+	case !e.Captured:
+		fmt.Println("The exchange was not captured. Start the server with OLLAMA_HISTORY_CAPTURE=1 to keep prompts and responses.")
+	case e.Endpoint == "chat":
+		for _, msg := range e.Messages {
+			fmt.Printf(">>> %s\n%s\n\n", msg.Role, msg.Content)
+		}
+	default:
+		fmt.Printf(">>> prompt\n%s\n\n>>> response\n%s\n", e.Prompt, e.Response)
+	}
+
+	return nil
+}
+
+// cancelPull cancels the in-progress pulls of the named model.
+func cancelPull(ctx context.Context, client *api.Client, name string) error {
+	resp, err := client.ListTransfers(ctx)
+	if err != nil {
+		return err
+	}
+
+	n := model.ParseName(name)
+	var canceled bool
+	for _, t := range resp.Transfers {
+		if t.Type != "pull" || !model.ParseName(t.Model).EqualFold(n) {
+			continue
+		}
+
+		if err := client.CancelTransfer(ctx, t.ID); err != nil {
+			return err
+		}
+
+		canceled = true
+	}
+
+	if !canceled {
+		return fmt.Errorf("no pull of '%s' in progress", name)
+	}
+
+	fmt.Printf("canceled pull of '%s'\n", name)
+	return nil
+}
+
 func PullHandler(cmd *cobra.Command, args []string) error {
 	insecure, err := cmd.Flags().GetBool("insecure")
 	if err != nil {
@@ -731,6 +1023,10 @@ func PullHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if cancel, _ := cmd.Flags().GetBool("cancel"); cancel {
+		return cancelPull(cmd.Context(), client, args[0])
+	}
+
 	p := progress.NewProgress(os.Stderr)
 	defer p.Stop()
 
@@ -872,6 +1168,11 @@ func chat(cmd *cobra.Command, opts runOptions) (*api.Message, error) {
 	var role string
 
 	fn := func(response api.ChatResponse) error {
+		if response.Load != nil {
+			spinner.SetMessage(loadStatus(response.Load))
+			return nil
+		}
+
 		p.StopAndClear()
 
 		latest = response
@@ -919,11 +1220,38 @@ func chat(cmd *cobra.Command, opts runOptions) (*api.Message, error) {
 
 	if verbose {
 		latest.Summary()
+		runnerSummary(cmd.Context(), client, opts.Model)
 	}
 
 	return &api.Message{Role: role, Content: fullResponse.String()}, nil
 }
 
+// runnerSummary prints how the runner serving model is split between GPU and
+// CPU. Failure to get it isn't an error since the response already completed.
+func runnerSummary(ctx context.Context, client *api.Client, name string) {
+	models, err := client.ListRunning(ctx)
+	if err != nil {
+		return
+	}
+
+	n := model.ParseName(name)
+	for _, m := range models.Models {
+		if !model.ParseName(m.Name).EqualFold(n) {
+			continue
+		}
+
+		if m.Layers > 0 {
+			fmt.Fprintf(os.Stderr, "gpu layers:           %d/%d\n", m.GPULayers, m.Layers)
+		}
+
+		if m.Size > 0 {
+			fmt.Fprintf(os.Stderr, "memory:               %s GPU, %s CPU\n", format.HumanBytes(m.SizeVRAM), format.HumanBytes(max(m.Size-m.SizeVRAM, 0)))
+		}
+
+		return
+	}
+}
+
 func generate(cmd *cobra.Command, opts runOptions) error {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
@@ -957,6 +1285,11 @@ func generate(cmd *cobra.Command, opts runOptions) error {
 	var state *displayResponseState = &displayResponseState{}
 
 	fn := func(response api.GenerateResponse) error {
+		if response.Load != nil {
+			spinner.SetMessage(loadStatus(response.Load))
+			return nil
+		}
+
 		p.StopAndClear()
 
 		latest = response
@@ -1012,6 +1345,7 @@ func generate(cmd *cobra.Command, opts runOptions) error {
 
 	if verbose {
 		latest.Summary()
+		runnerSummary(cmd.Context(), client, opts.Model)
 	}
 
 	ctx = context.WithValue(cmd.Context(), generateContextKey("context"), latest.Context)
@@ -1020,14 +1354,23 @@ func generate(cmd *cobra.Command, opts runOptions) error {
 	return nil
 }
 
-func RunServer(_ *cobra.Command, _ []string) error {
+func RunServer(cmd *cobra.Command, _ []string) error {
 	if err := initializeKeypair(); err != nil {
 		return err
 	}
 
-	ln, err := net.Listen("tcp", envconfig.Host().Host)
+	if registry, _ := cmd.Flags().GetBool("registry"); registry {
+		os.Setenv("OLLAMA_REGISTRY", "1")
+	}
+
+	ln, err := activationListener()
 	if err != nil {
 		return err
+	} else if ln == nil {
+		ln, err = listen(envconfig.Host())
+		if err != nil {
+			return err
+		}
 	}
 
 	err = server.Serve(ln)
@@ -1038,6 +1381,40 @@ func RunServer(_ *cobra.Command, _ []string) error {
 	return err
 }
 
+// listen listens on the TCP address of host or, if its scheme is "unix", on
+// the Unix domain socket at its path. The socket may be used by its owner and
+// group, and is removed once the listener is closed.
+func listen(host *url.URL) (net.Listener, error) {
+	if host.Scheme != "unix" {
+		return net.Listen("tcp", host.Host)
+	}
+
+	// remove the socket of a server that didn't exit cleanly, unless it is
+	// still in use
+	if fi, err := os.Lstat(host.Path); err == nil && fi.Mode().Type() == fs.ModeSocket {
+		if conn, err := net.Dial("unix", host.Path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("listen unix %s: address already in use", host.Path)
+		}
+
+		if err := os.Remove(host.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", host.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(host.Path, 0o660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	return ln, nil
+}
+
 func initializeKeypair() error {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -1218,6 +1595,8 @@ func NewCLI() *cobra.Command {
 		RunE:    RunServer,
 	}
 
+	serveCmd.Flags().Bool("registry", false, "Serve local models as a registry for pull and push")
+
 	pullCmd := &cobra.Command{
 		Use:     "pull MODEL",
 		Short:   "Pull a model from a registry",
@@ -1227,6 +1606,7 @@ func NewCLI() *cobra.Command {
 	}
 
 	pullCmd.Flags().Bool("insecure", false, "Use an insecure registry")
+	pullCmd.Flags().Bool("cancel", false, "Cancel an in-progress pull of the model")
 
 	pushCmd := &cobra.Command{
 		Use:     "push MODEL",
@@ -1238,6 +1618,24 @@ func NewCLI() *cobra.Command {
 
 	pushCmd.Flags().Bool("insecure", false, "Use an insecure registry")
 
+	loginCmd := &cobra.Command{
+		Use:   "login REGISTRY",
+		Short: "Store credentials for a registry",
+		Long:  "Store credentials for a registry, such as registry.example.com, used when pushing and pulling models. Credentials are kept by a Docker credential helper if one is configured or installed, and in ~/.ollama/credentials.json otherwise.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  LoginHandler,
+	}
+
+	loginCmd.Flags().StringP("username", "u", "", "Username")
+	loginCmd.Flags().Bool("password-stdin", false, "Read the password or token from stdin")
+
+	logoutCmd := &cobra.Command{
+		Use:   "logout REGISTRY",
+		Short: "Remove stored credentials for a registry",
+		Args:  cobra.ExactArgs(1),
+		RunE:  LogoutHandler,
+	}
+
 	listCmd := &cobra.Command{
 		Use:     "list",
 		Aliases: []string{"ls"},
@@ -1246,6 +1644,8 @@ func NewCLI() *cobra.Command {
 		RunE:    ListHandler,
 	}
 
+	listCmd.Flags().String("search", "", "Search the names, details and system prompts of models (e.g. \"code 7b q4\")")
+
 	psCmd := &cobra.Command{
 		Use:     "ps",
 		Short:   "List running models",
@@ -1253,6 +1653,14 @@ func NewCLI() *cobra.Command {
 		RunE:    ListRunningHandler,
 	}
 
+	infoCmd := &cobra.Command{
+		Use:     "info",
+		Short:   "Show the CPU, GPUs and runner the server uses",
+		Args:    cobra.NoArgs,
+		PreRunE: checkServerHeartbeat,
+		RunE:    InfoHandler,
+	}
+
 	copyCmd := &cobra.Command{
 		Use:     "cp SOURCE DESTINATION",
 		Short:   "Copy a model",
@@ -1261,6 +1669,16 @@ func NewCLI() *cobra.Command {
 		RunE:    CopyHandler,
 	}
 
+	aliasCmd := &cobra.Command{
+		Use:     "alias [ALIAS TARGET]",
+		Short:   "Create, delete, or list aliases of models",
+		Args:    cobra.RangeArgs(0, 2),
+		PreRunE: checkServerHeartbeat,
+		RunE:    AliasHandler,
+	}
+
+	aliasCmd.Flags().Bool("delete", false, "Delete the alias")
+
 	deleteCmd := &cobra.Command{
 		Use:     "rm MODEL [MODEL...]",
 		Short:   "Remove a model",
@@ -1269,6 +1687,60 @@ func NewCLI() *cobra.Command {
 		RunE:    DeleteHandler,
 	}
 
+	fmtCmd := &cobra.Command{
+		Use:   "fmt [MODELFILE...]",
+		Short: "Format Modelfiles",
+		RunE:  FmtHandler,
+	}
+
+	fmtCmd.Flags().Bool("check", false, "List Modelfiles that are not formatted and exit with an error instead of rewriting them")
+
+	historyCmd := &cobra.Command{
+		Use:     "history",
+		Short:   "List recent generate and chat requests",
+		Args:    cobra.NoArgs,
+		PreRunE: checkServerHeartbeat,
+		RunE:    HistoryHandler,
+	}
+
+	historyShowCmd := &cobra.Command{
+		Use:     "show ID",
+		Short:   "Show a request from the history",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    HistoryShowHandler,
+	}
+
+	historyCmd.AddCommand(historyShowCmd)
+
+	traceCmd := &cobra.Command{
+		Use:   "trace",
+		Short: "Inspect sampler traces",
+	}
+
+	traceViewCmd := &cobra.Command{
+		Use:   "view FILE",
+		Short: "Step through the sampler decisions of a trace",
+		Args:  cobra.ExactArgs(1),
+		RunE:  TraceViewHandler,
+	}
+
+	traceCmd.AddCommand(traceViewCmd)
+
+	templateCmd := &cobra.Command{
+		Use:   "template",
+		Short: "Check chat templates",
+	}
+
+	templateConformanceCmd := &cobra.Command{
+		Use:   "conformance",
+		Short: "Compare the built in chat templates against reference renders",
+		Args:  cobra.NoArgs,
+		RunE:  TemplateConformanceHandler,
+	}
+
+	templateCmd.AddCommand(templateConformanceCmd)
+
 	runnerCmd := &cobra.Command{
 		Use:    "runner",
 		Short:  llama.PrintSystemInfo(),
@@ -1295,7 +1767,9 @@ func NewCLI() *cobra.Command {
 		pushCmd,
 		listCmd,
 		psCmd,
+		infoCmd,
 		copyCmd,
+		aliasCmd,
 		deleteCmd,
 		serveCmd,
 	} {
@@ -1305,21 +1779,46 @@ func NewCLI() *cobra.Command {
 		case serveCmd:
 			appendEnvDocs(cmd, []envconfig.EnvVar{
 				envVars["OLLAMA_DEBUG"],
+				envVars["OLLAMA_LOG_FORMAT"],
 				envVars["OLLAMA_HOST"],
+				envVars["OLLAMA_TLS_CERT"],
+				envVars["OLLAMA_TLS_KEY"],
+				envVars["OLLAMA_TLS_CLIENT_CA"],
+				envVars["OLLAMA_IDLE_TIMEOUT"],
 				envVars["OLLAMA_KEEP_ALIVE"],
 				envVars["OLLAMA_MAX_LOADED_MODELS"],
 				envVars["OLLAMA_MAX_QUEUE"],
+				envVars["OLLAMA_MAX_DOWNLOAD_PARTS"],
 				envVars["OLLAMA_MODELS"],
+				envVars["OLLAMA_CHECKPOINTS"],
+				envVars["OLLAMA_SESSIONS"],
+				envVars["OLLAMA_MAX_SESSIONS"],
+				envVars["OLLAMA_PROMPT_CACHE"],
+				envVars["OLLAMA_MAX_PROMPT_CACHES"],
+				envVars["OLLAMA_DIFFUSION_RUNNER"],
+				envVars["OLLAMA_DATASETS"],
+				envVars["OLLAMA_HISTORY_FILE"],
+				envVars["OLLAMA_HISTORY_CAPTURE"],
+				envVars["OLLAMA_NOHISTORY"],
 				envVars["OLLAMA_NUM_PARALLEL"],
 				envVars["OLLAMA_NOPRUNE"],
 				envVars["OLLAMA_ORIGINS"],
+				envVars["OLLAMA_PRELOAD_MODEL"],
+				envVars["OLLAMA_REGISTRY"],
 				envVars["OLLAMA_SCHED_SPREAD"],
+				envVars["OLLAMA_SCHEDULES"],
+				envVars["OLLAMA_SCRUB_INTERVAL"],
+				envVars["OLLAMA_SUMMARY_MODEL"],
+				envVars["OLLAMA_TOOLS"],
+				envVars["OLLAMA_MCP_SERVERS"],
 				envVars["OLLAMA_TMPDIR"],
 				envVars["OLLAMA_FLASH_ATTENTION"],
 				envVars["OLLAMA_KV_CACHE_TYPE"],
 				envVars["OLLAMA_LLM_LIBRARY"],
 				envVars["OLLAMA_GPU_OVERHEAD"],
 				envVars["OLLAMA_LOAD_TIMEOUT"],
+				envVars["OLLAMA_SAMPLER_TRACE"],
+				envVars["OLLAMA_CHAOS"],
 			})
 		default:
 			appendEnvDocs(cmd, envs)
@@ -1334,10 +1833,18 @@ func NewCLI() *cobra.Command {
 		stopCmd,
 		pullCmd,
 		pushCmd,
+		loginCmd,
+		logoutCmd,
 		listCmd,
 		psCmd,
+		infoCmd,
 		copyCmd,
+		aliasCmd,
 		deleteCmd,
+		fmtCmd,
+		historyCmd,
+		traceCmd,
+		templateCmd,
 		runnerCmd,
 	)
 
@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -616,3 +621,49 @@ func TestCreateHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestListenUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "ollama.sock")
+	host := &url.URL{Scheme: "unix", Path: socket}
+
+	ln, err := listen(host)
+	if err != nil {
+		t.Skip("unix domain sockets not supported:", err)
+	}
+
+	fi, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0o660 {
+		t.Errorf("expected mode 0660, got %s", fi.Mode().Perm())
+	}
+
+	if _, err := listen(host); err == nil {
+		t.Error("expected an error while the socket is in use")
+	}
+
+	// a socket left behind by a server that didn't exit cleanly is replaced
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	ln, err = listen(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+
+	if _, err := os.Stat(socket); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the socket to be removed, got %v", err)
+	}
+
+	// files other than sockets are left alone
+	if err := os.WriteFile(socket, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := listen(host); err == nil {
+		t.Error("expected an error for a file that isn't a socket")
+	}
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/parser"
+)
+
+var errUnformatted = errors.New("some Modelfiles are not formatted")
+
+// FmtHandler rewrites each Modelfile in canonical form, or with --check
+// lists the ones that are not and fails without changing them.
+func FmtHandler(cmd *cobra.Command, args []string) error {
+	check, err := cmd.Flags().GetBool("check")
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		args = []string{"Modelfile"}
+	}
+
+	var unformatted bool
+	for _, filename := range args {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		formatted, err := formatModelfile(b)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+
+		if bytes.Equal(b, formatted) {
+			continue
+		}
+
+		if check {
+			fmt.Println(filename)
+			unformatted = true
+			continue
+		}
+
+		fi, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(filename, formatted, fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	if unformatted {
+		return errUnformatted
+	}
+
+	return nil
+}
+
+func formatModelfile(b []byte) ([]byte, error) {
+	f, err := parser.Parse(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(parser.FormatModelfile(f)), nil
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestFmtHandler(t *testing.T) {
+	const (
+		unformatted = "from llama3.2\nparameter   temperature 0.7\n"
+		formatted   = "FROM llama3.2\nPARAMETER temperature 0.7\n"
+	)
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "Modelfile")
+	if err := os.WriteFile(filename, []byte(unformatted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	newCmd := func(check bool) *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().Bool("check", false, "")
+		if check {
+			if err := cmd.Flags().Set("check", "true"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return cmd
+	}
+
+	t.Run("check", func(t *testing.T) {
+		if err := FmtHandler(newCmd(true), []string{filename}); !errors.Is(err, errUnformatted) {
+			t.Fatalf("expected %v, got %v", errUnformatted, err)
+		}
+
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != unformatted {
+			t.Errorf("--check changed the file:\n%s", b)
+		}
+	})
+
+	t.Run("write", func(t *testing.T) {
+		if err := FmtHandler(newCmd(false), []string{filename}); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != formatted {
+			t.Errorf("expected %q, got %q", formatted, b)
+		}
+
+		if err := FmtHandler(newCmd(true), []string{filename}); err != nil {
+			t.Errorf("formatted file failed --check: %v", err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		invalid := filepath.Join(dir, "Invalid")
+		if err := os.WriteFile(invalid, []byte("FROM foo\nBADCOMMAND bar\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := FmtHandler(newCmd(false), []string{invalid}); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
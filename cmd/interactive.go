@@ -18,6 +18,7 @@ import (
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/readline"
 	"github.com/ollama/ollama/types/errtypes"
+	"github.com/ollama/ollama/types/model"
 )
 
 type MultilineState int
@@ -216,7 +217,11 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 			err = client.Create(cmd.Context(), req, fn)
 			if err != nil {
 				if strings.Contains(err.Error(), errtypes.InvalidModelNameErrMsg) {
-					fmt.Printf("error: The model name '%s' is invalid\n", args[1])
+					if _, err := model.ParseNameStrict(args[1]); err != nil {
+						fmt.Printf("error: The model name '%s' is invalid: %v\n", args[1], err)
+					} else {
+						fmt.Printf("error: The model name '%s' is invalid\n", args[1])
+					}
 					continue
 				}
 				return err
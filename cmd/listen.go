@@ -0,0 +1,37 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// listenFdsStart is the first file descriptor passed by socket activation.
+const listenFdsStart = 3
+
+// activationListener returns the socket passed to the server by systemd
+// socket activation, or nil if the server was not started that way.
+func activationListener() (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	if n, err := strconv.Atoi(os.Getenv("LISTEN_FDS")); err != nil || n < 1 {
+		return nil, nil
+	}
+
+	// the variables are meant for this process rather than the runners it
+	// starts
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	syscall.CloseOnExec(listenFdsStart)
+	f := os.NewFile(listenFdsStart, "LISTEN_FD_3")
+	defer f.Close()
+
+	return net.FileListener(f)
+}
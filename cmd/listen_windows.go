@@ -0,0 +1,9 @@
+package cmd
+
+import "net"
+
+// activationListener returns nil as socket activation is not supported on
+// Windows.
+func activationListener() (net.Listener, error) {
+	return nil, nil
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/ollama/ollama/auth"
+)
+
+// LoginHandler stores the credentials of a registry for pushing and pulling
+// models. The username and password are prompted for unless given with
+// --username and --password-stdin.
+func LoginHandler(cmd *cobra.Command, args []string) error {
+	host := args[0]
+
+	username, err := cmd.Flags().GetString("username")
+	if err != nil {
+		return err
+	}
+
+	passwordStdin, err := cmd.Flags().GetBool("password-stdin")
+	if err != nil {
+		return err
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	if username == "" {
+		if passwordStdin {
+			return errors.New("--password-stdin requires --username")
+		}
+
+		fmt.Fprint(os.Stderr, "Username: ")
+		username, err = stdin.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		username = strings.TrimSpace(username)
+	}
+
+	var password string
+	if passwordStdin || !term.IsTerminal(int(os.Stdin.Fd())) {
+		b, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		password = strings.TrimRight(string(b), "\r\n")
+	} else {
+		fmt.Fprint(os.Stderr, "Password: ")
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		password = string(b)
+	}
+
+	if username == "" || password == "" {
+		return errors.New("username and password are required")
+	}
+
+	if err := auth.StoreCredentials(cmd.Context(), host, auth.Credentials{Username: username, Secret: password}); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Login to %s succeeded\n", host)
+	return nil
+}
+
+// LogoutHandler removes the stored credentials of a registry.
+func LogoutHandler(cmd *cobra.Command, args []string) error {
+	host := args[0]
+	if err := auth.EraseCredentials(cmd.Context(), host); errors.Is(err, auth.ErrNoCredentials) {
+		return fmt.Errorf("not logged in to %s", host)
+	} else if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Removed credentials for %s\n", host)
+	return nil
+}
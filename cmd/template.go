@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/template"
+)
+
+var errNonconformant = errors.New("some templates do not match their reference renders")
+
+// TemplateConformanceHandler renders the built in chat templates for a set
+// of conversations and compares them against the renders of the Jinja
+// templates they're converted from, failing if any differ.
+func TemplateConformanceHandler(cmd *cobra.Command, args []string) error {
+	results, err := template.CheckConformance()
+	if err != nil {
+		return err
+	}
+
+	var nonconformant bool
+	var data [][]string
+	for _, r := range results {
+		result := "ok"
+		if r.Mismatch != nil {
+			result = r.Mismatch.String()
+			nonconformant = true
+		}
+
+		data = append(data, []string{r.Template, r.Case, result})
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"TEMPLATE", "CASE", "RESULT"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.SetAutoWrapText(false)
+	table.AppendBulk(data)
+	table.Render()
+
+	if nonconformant {
+		return errNonconformant
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/ollama/ollama/readline"
+	"github.com/ollama/ollama/sampletrace"
+)
+
+const traceViewHelp = "←/h previous  →/l next  c next token not chosen by the model  g/G first/last  q quit"
+
+func TraceViewHandler(cmd *cobra.Command, args []string) error {
+	trace, err := sampletrace.Open(args[0])
+	if err != nil {
+		return err
+	}
+
+	if len(trace.Tokens) == 0 {
+		return errors.New("trace has no sampled tokens")
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		for i := range trace.Tokens {
+			renderTraceToken(os.Stdout, trace, i)
+			fmt.Println()
+		}
+		return nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state) //nolint:errcheck
+
+	fmt.Print(readline.CursorHide)
+	defer fmt.Print(readline.CursorShow)
+
+	r := bufio.NewReader(os.Stdin)
+	i := 0
+	for {
+		var sb strings.Builder
+		renderTraceToken(&sb, trace, i)
+		fmt.Fprintf(&sb, "\n%s%s%s\n", readline.ColorGrey, traceViewHelp, readline.ColorDefault)
+
+		// the terminal is in raw mode so lines must also return the carriage
+		fmt.Print(readline.ClearScreen + readline.CursorReset + strings.ReplaceAll(sb.String(), "\n", "\r\n"))
+
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil
+		}
+
+		switch b {
+		case 'q', readline.CharInterrupt, readline.CharDelete:
+			fmt.Print(readline.ClearScreen + readline.CursorReset)
+			return nil
+		case 'h', 'p':
+			i = max(i-1, 0)
+		case 'l', 'n', readline.CharSpace:
+			i = min(i+1, len(trace.Tokens)-1)
+		case 'g':
+			i = 0
+		case 'G':
+			i = len(trace.Tokens) - 1
+		case 'c':
+			for j := i + 1; j < len(trace.Tokens); j++ {
+				if trace.Tokens[j].Decisive() != 0 {
+					i = j
+					break
+				}
+			}
+		case readline.CharEsc:
+			if b, _ := r.ReadByte(); b != readline.CharEscapeEx {
+				continue
+			}
+
+			switch b, _ := r.ReadByte(); b {
+			case readline.KeyLeft:
+				i = max(i-1, 0)
+			case readline.KeyRight:
+				i = min(i+1, len(trace.Tokens)-1)
+			}
+		}
+	}
+}
+
+// traceContext is the number of preceding tokens shown for context.
+const traceContext = 32
+
+// renderTraceToken writes the sampler stages of the i-th token of trace.
+func renderTraceToken(w io.Writer, trace *sampletrace.Trace, i int) {
+	tok := trace.Tokens[i]
+
+	fmt.Fprintf(w, "%s  token %d/%d  (%d prompt tokens)\n\n", trace.Model, i+1, len(trace.Tokens), trace.PromptTokens)
+
+	var sb strings.Builder
+	for _, t := range trace.Tokens[max(i-traceContext, 0):i] {
+		sb.WriteString(t.Piece)
+	}
+	fmt.Fprintf(w, "…%s[%s]\n\n", strings.ReplaceAll(sb.String(), "\n", "⏎"), strings.ReplaceAll(tok.Piece, "\n", "⏎"))
+
+	decisive := tok.Decisive()
+	for j, stage := range tok.Stages {
+		marker := " "
+		if j == decisive {
+			marker = ">"
+		}
+
+		fmt.Fprintf(w, "%s %-16s %8d candidates ", marker, stage.Name, stage.Candidates)
+		for _, c := range stage.Top {
+			chosen := " "
+			if c.Token == tok.Token {
+				chosen = "*"
+			}
+			fmt.Fprintf(w, " %s%s %.3f", chosen, strconv.Quote(c.Piece), c.Prob)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w)
+	switch {
+	case decisive < 0:
+		fmt.Fprintf(w, "%q was drawn at random: it was never the most likely candidate\n", tok.Piece)
+	case decisive == 0:
+		fmt.Fprintf(w, "%q was the model's most likely token\n", tok.Piece)
+	default:
+		fmt.Fprintf(w, "%q became the most likely token after %s\n", tok.Piece, tok.Stages[decisive].Name)
+	}
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/sampletrace"
+)
+
+func TestRenderTraceToken(t *testing.T) {
+	trace := &sampletrace.Trace{
+		Header: sampletrace.Header{Model: "test", PromptTokens: 4},
+		Tokens: []sampletrace.Token{
+			{
+				Token: 1,
+				Piece: "Hello",
+				Stages: []sampletrace.Stage{
+					{Name: "logits", Candidates: 3, Top: []sampletrace.Candidate{{Token: 1, Piece: "Hello", Prob: 0.9}}},
+					{Name: "dist", Candidates: 3, Top: []sampletrace.Candidate{{Token: 1, Piece: "Hello", Prob: 0.9}}},
+				},
+			},
+			{
+				Token: 2,
+				Piece: " world",
+				Stages: []sampletrace.Stage{
+					{Name: "logits", Candidates: 3, Top: []sampletrace.Candidate{{Token: 3, Piece: " there", Prob: 0.6}, {Token: 2, Piece: " world", Prob: 0.4}}},
+					{Name: "penalties", Candidates: 3, Top: []sampletrace.Candidate{{Token: 2, Piece: " world", Prob: 0.7}, {Token: 3, Piece: " there", Prob: 0.3}}},
+					{Name: "dist", Candidates: 3, Top: []sampletrace.Candidate{{Token: 2, Piece: " world", Prob: 0.7}, {Token: 3, Piece: " there", Prob: 0.3}}},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		token int
+		want  []string
+	}{
+		{0, []string{"token 1/2", `…[Hello]`, `"Hello" was the model's most likely token`}},
+		{1, []string{"token 2/2", `…Hello[ world]`, `> penalties`, `*" world" 0.700`, `" world" became the most likely token after penalties`}},
+	}
+
+	for _, tt := range cases {
+		var sb strings.Builder
+		renderTraceToken(&sb, trace, tt.token)
+		for _, want := range tt.want {
+			if !strings.Contains(sb.String(), want) {
+				t.Errorf("token %d: expected output to contain %q, got:\n%s", tt.token, want, sb.String())
+			}
+		}
+	}
+}
@@ -76,6 +76,15 @@ func AMDGetGPUInfo() ([]RocmGPUInfo, error) {
 	}
 
 	gfxOverride := envconfig.HsaOverrideGfxVersion()
+	if gfxOverride != "" && !validGFXOverride(gfxOverride) {
+		addIssue(Issue{
+			Library:     "rocm",
+			Kind:        IssueInvalidOverride,
+			Message:     fmt.Sprintf("HSA_OVERRIDE_GFX_VERSION %q is not a version", gfxOverride),
+			Remediation: "set HSA_OVERRIDE_GFX_VERSION to a version of the form 10.3.0",
+		})
+	}
+
 	var supported []string
 	depPaths := LibraryDirs()
 	libDir := ""
@@ -195,7 +204,7 @@ func AMDGetGPUInfo() ([]RocmGPUInfo, error) {
 		// Look up the memory for the current node
 		totalMemory := uint64(0)
 		usedMemory := uint64(0)
-		var usedFile string
+		var usedFile, pciID string
 		mapping := []struct {
 			id       uint64
 			filename string
@@ -239,6 +248,10 @@ func AMDGetGPUInfo() ([]RocmGPUInfo, error) {
 
 			// Found the matching DRM directory
 			slog.Debug("matched", "amdgpu", match, "drm", devDir)
+			// The device links to its PCI address, which Vulkan reports too
+			if dev, err := filepath.EvalSymlinks(devDir); err == nil {
+				pciID = filepath.Base(dev)
+			}
 			totalFile := filepath.Join(devDir, DRMTotalMemoryFile)
 			buf, err := os.ReadFile(totalFile)
 			if err != nil {
@@ -289,6 +302,7 @@ func AMDGetGPUInfo() ([]RocmGPUInfo, error) {
 			},
 			usedFilepath: usedFile,
 			index:        gpuID,
+			pciID:        pciID,
 		}
 
 		// iGPU detection, remove this check once we can support an iGPU variant of the rocm library
@@ -346,7 +360,12 @@ func AMDGetGPUInfo() ([]RocmGPUInfo, error) {
 			libDir, err = AMDValidateLibDir()
 			if err != nil {
 				err = fmt.Errorf("unable to verify rocm library: %w", err)
-				slog.Warn(err.Error())
+				addIssue(Issue{
+					Library:     "rocm",
+					Kind:        IssueMissingLibrary,
+					Message:     err.Error(),
+					Remediation: "install ROCm v6, or follow https://github.com/ollama/ollama/blob/main/docs/linux.md#manual-install",
+				})
 				unsupportedGPUs = append(unsupportedGPUs, UnsupportedGPUInfo{
 					GpuInfo: gpuInfo.GpuInfo,
 					Reason:  err.Error(),
@@ -375,14 +394,12 @@ func AMDGetGPUInfo() ([]RocmGPUInfo, error) {
 			gfx := gpuInfo.Compute
 			if !slices.Contains[[]string, string](supported, gfx) {
 				reason := fmt.Sprintf("amdgpu is not supported (supported types:%s)", supported)
-				slog.Warn(reason, "gpu_type", gfx, "gpu", gpuInfo.ID, "library", libDir)
+				slog.Debug(reason, "gpu_type", gfx, "gpu", gpuInfo.ID, "library", libDir)
 				unsupportedGPUs = append(unsupportedGPUs, UnsupportedGPUInfo{
 					GpuInfo: gpuInfo.GpuInfo,
 					Reason:  reason,
 				})
-
-				// TODO - consider discrete markdown just for ROCM troubleshooting?
-				slog.Warn("See https://github.com/ollama/ollama/blob/main/docs/gpu.md#overrides for HSA_OVERRIDE_GFX_VERSION usage")
+				addIssue(unsupportedGFXIssue(gpuInfo.ID, gfx, supported))
 				continue
 			} else {
 				slog.Info("amdgpu is supported", "gpu", gpuInfo.ID, "gpu_type", gfx)
@@ -406,7 +423,12 @@ func AMDGetGPUInfo() ([]RocmGPUInfo, error) {
 	}
 	if err := verifyKFDDriverAccess(); err != nil {
 		err = fmt.Errorf("amdgpu devices detected but permission problems block access: %w", err)
-		slog.Error(err.Error())
+		addIssue(Issue{
+			Library:     "rocm",
+			Kind:        IssuePermission,
+			Message:     err.Error(),
+			Remediation: "run ollama as a user in the render group, or pass --device /dev/kfd --device /dev/dri to the container",
+		})
 		return nil, err
 	}
 	return resp, nil
@@ -485,8 +507,10 @@ func (gpus RocmGPUInfoList) RefreshFreeMemory() error {
 	for i := range gpus {
 		usedMemory, err := getFreeMemory(gpus[i].usedFilepath)
 		if err != nil {
+			lostGPUs[gpus[i].ID] = true
 			return err
 		}
+		delete(lostGPUs, gpus[i].ID)
 		slog.Debug("updating rocm free memory", "gpu", gpus[i].ID, "name", gpus[i].Name, "before", format.HumanBytes2(gpus[i].FreeMemory), "now", format.HumanBytes2(gpus[i].TotalMemory-usedMemory))
 		gpus[i].FreeMemory = gpus[i].TotalMemory - usedMemory
 	}
@@ -99,8 +99,10 @@ func AMDGetGPUInfo() ([]RocmGPUInfo, error) {
 		freeMemory, totalMemory, err := hl.HipMemGetInfo()
 		if err != nil {
 			slog.Warn("get mem info", "id", i, "error", err)
+			lostGPUs[gpus[i].ID] = true
 			continue
 		}
+		delete(lostGPUs, gpus[i].ID)
 
 		gpuInfo := RocmGPUInfo{
 			GpuInfo: GpuInfo{
@@ -137,12 +139,19 @@ func AMDGetGPUInfo() ([]RocmGPUInfo, error) {
 		// Strip off Target Features when comparing
 		if !slices.Contains[[]string, string](supported, strings.Split(gfx, ":")[0]) {
 			reason := fmt.Sprintf("amdgpu is not supported (supported types:%s)", supported)
-			slog.Warn(reason, "gpu_type", gfx, "gpu", gpuInfo.ID, "library", libDir)
+			slog.Debug(reason, "gpu_type", gfx, "gpu", gpuInfo.ID, "library", libDir)
 			unsupportedGPUs = append(unsupportedGPUs, UnsupportedGPUInfo{
 				GpuInfo: gpuInfo.GpuInfo,
 				Reason:  reason,
 			})
 			// HSA_OVERRIDE_GFX_VERSION not supported on windows
+			addIssue(Issue{
+				Library:     "rocm",
+				GPU:         gpuInfo.ID,
+				Kind:        IssueUnsupportedGFX,
+				Message:     fmt.Sprintf("amdgpu type %s is not supported by the ROCm library", gfx),
+				Remediation: "HSA_OVERRIDE_GFX_VERSION is not supported on Windows, models run on the CPU",
+			})
 			continue
 		} else {
 			slog.Debug("amdgpu is supported", "gpu", i, "gpu_type", gfx)
@@ -11,6 +11,7 @@ package discover
 import "C"
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -38,9 +39,16 @@ type oneapiHandles struct {
 	deviceCount int
 }
 
+type vulkanHandles struct {
+	vulkan      *C.vk_handle_t
+	deviceCount int
+}
+
 const (
 	cudaMinimumMemory = 457 * format.MebiByte
 	rocmMinimumMemory = 457 * format.MebiByte
+	// TODO Vulkan minimum memory, assume it's like ROCm until measured
+	vulkanMinimumMemory = 457 * format.MebiByte
 	// TODO OneAPI minimum memory
 )
 
@@ -52,9 +60,11 @@ var (
 	nvcudaLibPath string
 	cudartLibPath string
 	oneapiLibPath string
+	vulkanLibPath string
 	nvmlLibPath   string
 	rocmGPUs      []RocmGPUInfo
 	oneapiGPUs    []OneapiGPUInfo
+	vulkanGPUs    []VulkanGPUInfo
 
 	// If any discovered GPUs are incompatible, report why
 	unsupportedGPUs []UnsupportedGPUInfo
@@ -62,6 +72,10 @@ var (
 	// Keep track of errors during bootstrapping so that if GPUs are missing
 	// they expected to be present this may explain why
 	bootstrapErrors []error
+
+	// lostGPUs are the IDs of the GPUs whose memory could not be read
+	// during the last refresh
+	lostGPUs = make(map[string]bool)
 )
 
 // With our current CUDA compile flags, older than 5.0 will not work properly
@@ -139,6 +153,10 @@ func initCudaHandles() *cudaHandles {
 		}
 		if err != nil {
 			bootstrapErrors = append(bootstrapErrors, err)
+			var issue Issue
+			if errors.As(err, &issue) {
+				addIssue(issue)
+			}
 		}
 	}
 
@@ -183,6 +201,29 @@ func initOneAPIHandles() *oneapiHandles {
 	return oHandles
 }
 
+// Note: gpuMutex must already be held
+func initVulkanHandles() *vulkanHandles {
+	vHandles := &vulkanHandles{}
+
+	// Short Circuit if we already know which library to use
+	// ignore bootstrap errors in this case since we already recorded them
+	if vulkanLibPath != "" {
+		vHandles.deviceCount, vHandles.vulkan, _, _ = loadVulkanMgmt([]string{vulkanLibPath})
+		return vHandles
+	}
+
+	vulkanLibPaths := FindGPULibs(VulkanMgmtName, VulkanGlobs)
+	if len(vulkanLibPaths) > 0 {
+		var err error
+		vHandles.deviceCount, vHandles.vulkan, vulkanLibPath, err = loadVulkanMgmt(vulkanLibPaths)
+		if err != nil {
+			bootstrapErrors = append(bootstrapErrors, err)
+		}
+	}
+
+	return vHandles
+}
+
 func GetCPUInfo() GpuInfoList {
 	gpuMutex.Lock()
 	if !bootstrapped {
@@ -202,6 +243,7 @@ func GetGPUInfo() GpuInfoList {
 	needRefresh := true
 	var cHandles *cudaHandles
 	var oHandles *oneapiHandles
+	var vHandles *vulkanHandles
 	defer func() {
 		if cHandles != nil {
 			if cHandles.cudart != nil {
@@ -220,6 +262,9 @@ func GetGPUInfo() GpuInfoList {
 				C.oneapi_release(*oHandles.oneapi)
 			}
 		}
+		if vHandles != nil && vHandles.vulkan != nil {
+			C.vk_release(*vHandles.vulkan)
+		}
 	}()
 
 	if !bootstrapped {
@@ -233,6 +278,7 @@ func GetGPUInfo() GpuInfoList {
 			slog.Error("invalid CudaComputeMinorMin setting", "value", CudaComputeMinorMin, "error", err)
 		}
 		bootstrapErrors = []error{}
+		issues = nil
 		needRefresh = false
 		var memInfo C.mem_info_t
 
@@ -311,11 +357,30 @@ func GetGPUInfo() GpuInfoList {
 				gpuInfo.Variant = variant
 
 				if int(memInfo.major) < cudaComputeMajorMin || (int(memInfo.major) == cudaComputeMajorMin && int(memInfo.minor) < cudaComputeMinorMin) {
+					issue := Issue{
+						Library:     "cuda",
+						GPU:         gpuInfo.ID,
+						Kind:        IssueComputeTooOld,
+						Message:     fmt.Sprintf("CUDA compute capability %d.%d is below the minimum %d.%d", memInfo.major, memInfo.minor, cudaComputeMajorMin, cudaComputeMinorMin),
+						Remediation: "the GPU is too old to be used, models run on the CPU",
+					}
+					addIssue(issue)
 					unsupportedGPUs = append(unsupportedGPUs,
 						UnsupportedGPUInfo{
 							GpuInfo: gpuInfo.GpuInfo,
+							Reason:  issue.Message,
+						})
+					continue
+				}
+
+				if issue := cudaDriverIssue(driverMajor, driverMinor); issue != nil {
+					issue.GPU = gpuInfo.ID
+					addIssue(*issue)
+					unsupportedGPUs = append(unsupportedGPUs,
+						UnsupportedGPUInfo{
+							GpuInfo: gpuInfo.GpuInfo,
+							Reason:  issue.Message,
 						})
-					slog.Info(fmt.Sprintf("[%d] CUDA GPU is too old. Compute Capability detected: %d.%d", i, memInfo.major, memInfo.minor))
 					continue
 				}
 
@@ -387,9 +452,72 @@ func GetGPUInfo() GpuInfoList {
 		if err != nil {
 			bootstrapErrors = append(bootstrapErrors, err)
 		}
+
+		// Vulkan, for the GPUs none of the libraries above support
+		if hasVulkanRunner() {
+			vHandles = initVulkanHandles()
+			var devInfo C.vk_device_info_t
+			for i := range vHandles.deviceCount {
+				C.vk_bootstrap(*vHandles.vulkan, C.int(i), &devInfo)
+				if devInfo.err != nil {
+					slog.Info("error looking up vulkan GPU", "error", C.GoString(devInfo.err))
+					C.free(unsafe.Pointer(devInfo.err))
+					continue
+				}
+				gpuInfo := VulkanGPUInfo{
+					GpuInfo: GpuInfo{
+						Library: "vulkan",
+						// ggml-vulkan selects devices by their index
+						ID:            strconv.Itoa(i),
+						Name:          C.GoString(&devInfo.name[0]),
+						Compute:       fmt.Sprintf("%d.%d", devInfo.api_major, devInfo.api_minor),
+						MinimumMemory: vulkanMinimumMemory,
+						// without VK_EXT_memory_budget only the total is known
+						UnreliableFreeMemory: devInfo.has_budget == 0,
+						DependencyPath:       depPaths,
+					},
+					index:      i,
+					uuid:       C.GoString(&devInfo.uuid[0]),
+					pciID:      C.GoString(&devInfo.pci_id[0]),
+					vendorID:   uint32(devInfo.vendor_id),
+					deviceType: int(devInfo.device_type),
+				}
+				gpuInfo.TotalMemory = uint64(devInfo.total)
+				gpuInfo.FreeMemory = uint64(devInfo.free)
+
+				if reason := vulkanSkipReason(gpuInfo, cudaGPUs, rocmGPUs, oneapiGPUs, vulkanGPUs); reason != "" {
+					slog.Debug("skipping vulkan device", "id", gpuInfo.ID, "name", gpuInfo.Name, "reason", reason)
+					continue
+				}
+
+				if int(devInfo.api_major) < vulkanMinimumVersion[0] || int(devInfo.api_major) == vulkanMinimumVersion[0] && int(devInfo.api_minor) < vulkanMinimumVersion[1] {
+					issue := Issue{
+						Library:     "vulkan",
+						GPU:         gpuInfo.ID,
+						Kind:        IssueComputeTooOld,
+						Message:     fmt.Sprintf("Vulkan %s is below the minimum %d.%d", gpuInfo.Compute, vulkanMinimumVersion[0], vulkanMinimumVersion[1]),
+						Remediation: "upgrade the GPU driver, or the GPU is too old to be used and models run on the CPU",
+					}
+					addIssue(issue)
+					unsupportedGPUs = append(unsupportedGPUs,
+						UnsupportedGPUInfo{
+							GpuInfo: gpuInfo.GpuInfo,
+							Reason:  issue.Message,
+						})
+					continue
+				}
+
+				vulkanGPUs = append(vulkanGPUs, gpuInfo)
+			}
+		}
+
 		bootstrapped = true
-		if len(cudaGPUs) == 0 && len(rocmGPUs) == 0 && len(oneapiGPUs) == 0 {
-			slog.Info("no compatible GPUs were discovered")
+		if len(cudaGPUs) == 0 && len(rocmGPUs) == 0 && len(oneapiGPUs) == 0 && len(vulkanGPUs) == 0 {
+			if len(issues) > 0 {
+				slog.Warn("no compatible GPUs were discovered, models will run on the CPU", "issues", len(issues))
+			} else {
+				slog.Info("no compatible GPUs were discovered")
+			}
 		}
 
 		// TODO verify we have runners for the discovered GPUs, filter out any that aren't supported with good error messages
@@ -443,12 +571,15 @@ func GetGPUInfo() GpuInfoList {
 			if memInfo.err != nil {
 				slog.Warn("error looking up nvidia GPU memory", "error", C.GoString(memInfo.err))
 				C.free(unsafe.Pointer(memInfo.err))
+				lostGPUs[gpu.ID] = true
 				continue
 			}
 			if memInfo.free == 0 {
 				slog.Warn("error looking up nvidia GPU memory")
+				lostGPUs[gpu.ID] = true
 				continue
 			}
+			delete(lostGPUs, gpu.ID)
 			if cHandles.nvml != nil && gpu.OSOverhead > 0 {
 				// When using the management library update based on recorded overhead
 				memInfo.free -= C.uint64_t(gpu.OSOverhead)
@@ -492,6 +623,39 @@ func GetGPUInfo() GpuInfoList {
 		if err != nil {
 			slog.Debug("problem refreshing ROCm free memory", "error", err)
 		}
+
+		if vHandles == nil && len(vulkanGPUs) > 0 {
+			vHandles = initVulkanHandles()
+		}
+		for i, gpu := range vulkanGPUs {
+			if vHandles.vulkan == nil {
+				// shouldn't happen
+				slog.Warn("no valid vulkan library loaded to refresh vram usage")
+				break
+			}
+			C.vk_get_free(*vHandles.vulkan, C.int(gpu.index), &memInfo.free, &memInfo.total)
+			if memInfo.total == 0 {
+				slog.Warn("error looking up vulkan GPU memory", "gpu", gpu.ID)
+				lostGPUs[gpu.ID] = true
+				continue
+			}
+			delete(lostGPUs, gpu.ID)
+			slog.Debug("updating vulkan memory data",
+				"gpu", gpu.ID,
+				"name", gpu.Name,
+				slog.Group(
+					"before",
+					"total", format.HumanBytes2(gpu.TotalMemory),
+					"free", format.HumanBytes2(gpu.FreeMemory),
+				),
+				slog.Group(
+					"now",
+					"total", format.HumanBytes2(uint64(memInfo.total)),
+					"free", format.HumanBytes2(uint64(memInfo.free)),
+				),
+			)
+			vulkanGPUs[i].FreeMemory = uint64(memInfo.free)
+		}
 	}
 
 	resp := []GpuInfo{}
@@ -501,6 +665,9 @@ func GetGPUInfo() GpuInfoList {
 	for _, gpu := range rocmGPUs {
 		resp = append(resp, gpu.GpuInfo)
 	}
+	for _, gpu := range vulkanGPUs {
+		resp = append(resp, gpu.GpuInfo)
+	}
 	for _, gpu := range oneapiGPUs {
 		resp = append(resp, gpu.GpuInfo)
 	}
@@ -612,9 +779,20 @@ func loadNVCUDAMgmt(nvcudaLibPaths []string) (int, *C.nvcuda_handle_t, string, e
 		if resp.err != nil {
 			// Decide what log level based on the type of error message to help users understand why
 			switch resp.cudaErr {
-			case C.CUDA_ERROR_INSUFFICIENT_DRIVER, C.CUDA_ERROR_SYSTEM_DRIVER_MISMATCH:
-				err = fmt.Errorf("version mismatch between driver and cuda driver library - reboot or upgrade may be required: library %s", libPath)
-				slog.Warn(err.Error())
+			case C.CUDA_ERROR_INSUFFICIENT_DRIVER:
+				err = Issue{
+					Library:     "cuda",
+					Kind:        IssueDriverTooOld,
+					Message:     fmt.Sprintf("the NVIDIA driver is older than the cuda driver library %s", libPath),
+					Remediation: "upgrade the NVIDIA driver",
+				}
+			case C.CUDA_ERROR_SYSTEM_DRIVER_MISMATCH:
+				err = Issue{
+					Library:     "cuda",
+					Kind:        IssueDriverMismatch,
+					Message:     fmt.Sprintf("the loaded NVIDIA kernel module does not match the cuda driver library %s", libPath),
+					Remediation: "reboot, or reload the nvidia kernel modules, after upgrading the driver",
+				}
 			case C.CUDA_ERROR_NO_DEVICE:
 				err = fmt.Errorf("no nvidia devices detected by library %s", libPath)
 				slog.Info(err.Error())
@@ -687,6 +865,28 @@ func loadOneapiMgmt(oneapiLibPaths []string) (int, *C.oneapi_handle_t, string, e
 	return 0, nil, "", err
 }
 
+// bootstrap the Vulkan loader
+// Returns: num devices, handle, libPath, error
+func loadVulkanMgmt(vulkanLibPaths []string) (int, *C.vk_handle_t, string, error) {
+	var resp C.vk_init_resp_t
+	resp.vh.verbose = getVerboseState()
+	var err error
+	for _, libPath := range vulkanLibPaths {
+		lib := C.CString(libPath)
+		defer C.free(unsafe.Pointer(lib))
+		C.vk_init(lib, &resp)
+		if resp.err != nil {
+			err = fmt.Errorf("Unable to load vulkan library %s: %s", libPath, C.GoString(resp.err))
+			slog.Debug(err.Error())
+			C.free(unsafe.Pointer(resp.err))
+		} else {
+			err = nil
+			return int(resp.num_devices), &resp.vh, libPath, err
+		}
+	}
+	return 0, nil, "", err
+}
+
 func getVerboseState() C.uint16_t {
 	if envconfig.Debug() {
 		return C.uint16_t(1)
@@ -709,6 +909,8 @@ func (l GpuInfoList) GetVisibleDevicesEnv() (string, string) {
 		return rocmGetVisibleDevicesEnv(l)
 	case "oneapi":
 		return oneapiGetVisibleDevicesEnv(l)
+	case "vulkan":
+		return vulkanGetVisibleDevicesEnv(l)
 	default:
 		slog.Debug("no filter required for library " + l[0].Library)
 		return "", ""
@@ -749,10 +951,19 @@ func GetSystemInfo() SystemInfo {
 		gpus = []GpuInfo{}
 	}
 
+	var lost []string
+	for _, gpu := range gpus {
+		if lostGPUs[gpu.ID] {
+			lost = append(lost, gpu.ID)
+		}
+	}
+
 	return SystemInfo{
 		System:          cpus[0],
 		GPUs:            gpus,
 		UnsupportedGPUs: unsupportedGPUs,
 		DiscoveryErrors: discoveryErrors,
+		Issues:          append([]Issue{}, issues...),
+		LostGPUs:        lost,
 	}
 }
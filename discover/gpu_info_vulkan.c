@@ -0,0 +1,233 @@
+#ifndef __APPLE__
+
+#include <string.h>
+
+#include "gpu_info_vulkan.h"
+
+void vk_init(char *vk_lib_path, vk_init_resp_t *resp) {
+  VkResult ret;
+  resp->err = NULL;
+  resp->num_devices = 0;
+  resp->vh.instance = NULL;
+  resp->vh.devices = NULL;
+  resp->vh.num_devices = 0;
+  const int buflen = 256;
+  char buf[buflen + 1];
+  int i;
+
+  struct lookup {
+    char *s;
+    void **p;
+  } l[] = {
+      {"vkCreateInstance", (void *)&resp->vh.vkCreateInstance},
+      {"vkDestroyInstance", (void *)&resp->vh.vkDestroyInstance},
+      {"vkEnumeratePhysicalDevices", (void *)&resp->vh.vkEnumeratePhysicalDevices},
+      {"vkGetPhysicalDeviceProperties", (void *)&resp->vh.vkGetPhysicalDeviceProperties},
+      {"vkGetPhysicalDeviceProperties2", (void *)&resp->vh.vkGetPhysicalDeviceProperties2},
+      {"vkGetPhysicalDeviceMemoryProperties2", (void *)&resp->vh.vkGetPhysicalDeviceMemoryProperties2},
+      {"vkEnumerateDeviceExtensionProperties", (void *)&resp->vh.vkEnumerateDeviceExtensionProperties},
+      {NULL, NULL},
+  };
+
+  resp->vh.handle = LOAD_LIBRARY(vk_lib_path, RTLD_LAZY);
+  if (!resp->vh.handle) {
+    char *msg = LOAD_ERR();
+    LOG(resp->vh.verbose, "library %s load err: %s\n", vk_lib_path, msg);
+    snprintf(buf, buflen,
+             "Unable to load %s library to query for Vulkan GPUs: %s",
+             vk_lib_path, msg);
+    free(msg);
+    resp->err = strdup(buf);
+    return;
+  }
+
+  for (i = 0; l[i].s != NULL; i++) {
+    *l[i].p = LOAD_SYMBOL(resp->vh.handle, l[i].s);
+    if (!*(l[i].p)) {
+      char *msg = LOAD_ERR();
+      LOG(resp->vh.verbose, "dlerr: %s\n", msg);
+      UNLOAD_LIBRARY(resp->vh.handle);
+      resp->vh.handle = NULL;
+      snprintf(buf, buflen, "symbol lookup for %s failed: %s", l[i].s,
+               msg);
+      free(msg);
+      resp->err = strdup(buf);
+      return;
+    }
+  }
+
+  VkApplicationInfo app = {0};
+  app.sType = VK_STRUCTURE_TYPE_APPLICATION_INFO;
+  app.pApplicationName = "ollama";
+  app.pEngineName = "ollama";
+  app.apiVersion = VK_MAKE_API_VERSION(0, 1, 2, 0);
+
+  VkInstanceCreateInfo info = {0};
+  info.sType = VK_STRUCTURE_TYPE_INSTANCE_CREATE_INFO;
+  info.pApplicationInfo = &app;
+
+  ret = (*resp->vh.vkCreateInstance)(&info, NULL, &resp->vh.instance);
+  if (ret != VK_SUCCESS) {
+    LOG(resp->vh.verbose, "vkCreateInstance err: %d\n", ret);
+    UNLOAD_LIBRARY(resp->vh.handle);
+    resp->vh.handle = NULL;
+    snprintf(buf, buflen, "vulkan instance creation failure: %d", ret);
+    resp->err = strdup(buf);
+    return;
+  }
+
+  ret = (*resp->vh.vkEnumeratePhysicalDevices)(resp->vh.instance, &resp->vh.num_devices, NULL);
+  if (ret == VK_SUCCESS && resp->vh.num_devices > 0) {
+    resp->vh.devices = malloc(resp->vh.num_devices * sizeof(VkPhysicalDevice));
+    ret = (*resp->vh.vkEnumeratePhysicalDevices)(resp->vh.instance, &resp->vh.num_devices, resp->vh.devices);
+    if (ret == VK_INCOMPLETE) {
+      ret = VK_SUCCESS;
+    }
+  }
+  if (ret != VK_SUCCESS) {
+    LOG(resp->vh.verbose, "vkEnumeratePhysicalDevices err: %d\n", ret);
+    vk_release(resp->vh);
+    resp->vh.handle = NULL;
+    snprintf(buf, buflen, "unable to get vulkan device count: %d", ret);
+    resp->err = strdup(buf);
+    return;
+  }
+
+  resp->num_devices = resp->vh.num_devices;
+}
+
+static int vk_has_extension(vk_handle_t h, VkPhysicalDevice device, const char *name) {
+  uint32_t count = 0;
+  if ((*h.vkEnumerateDeviceExtensionProperties)(device, NULL, &count, NULL) != VK_SUCCESS || count == 0) {
+    return 0;
+  }
+
+  VkExtensionProperties *extensions = malloc(count * sizeof(VkExtensionProperties));
+  int found = 0;
+  if ((*h.vkEnumerateDeviceExtensionProperties)(device, NULL, &count, extensions) == VK_SUCCESS) {
+    for (uint32_t i = 0; i < count; i++) {
+      if (strcmp(extensions[i].extensionName, name) == 0) {
+        found = 1;
+        break;
+      }
+    }
+  }
+  free(extensions);
+  return found;
+}
+
+// vk_get_memory reports the largest device local heap, which is the one
+// ggml-vulkan allocates from
+static void vk_get_memory(vk_handle_t h, VkPhysicalDevice device, int budget, uint64_t *free, uint64_t *total) {
+  VkPhysicalDeviceMemoryBudgetPropertiesEXT budgetProps = {0};
+  budgetProps.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_MEMORY_BUDGET_PROPERTIES_EXT;
+
+  VkPhysicalDeviceMemoryProperties2 memProps = {0};
+  memProps.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_MEMORY_PROPERTIES_2;
+  if (budget) {
+    memProps.pNext = &budgetProps;
+  }
+  (*h.vkGetPhysicalDeviceMemoryProperties2)(device, &memProps);
+
+  *total = 0;
+  *free = 0;
+  for (uint32_t i = 0; i < memProps.memoryProperties.memoryHeapCount && i < VK_MAX_MEMORY_HEAPS; i++) {
+    VkMemoryHeap heap = memProps.memoryProperties.memoryHeaps[i];
+    if (!(heap.flags & VK_MEMORY_HEAP_DEVICE_LOCAL_BIT) || heap.size <= *total) {
+      continue;
+    }
+
+    *total = heap.size;
+    *free = heap.size;
+    if (budget) {
+      uint64_t usage = budgetProps.heapUsage[i];
+      *free = budgetProps.heapBudget[i] > usage ? budgetProps.heapBudget[i] - usage : 0;
+    }
+  }
+}
+
+void vk_bootstrap(vk_handle_t h, int i, vk_device_info_t *resp) {
+  const int buflen = 256;
+  char buf[buflen + 1];
+  resp->err = NULL;
+  resp->uuid[0] = '\0';
+  resp->pci_id[0] = '\0';
+  resp->has_budget = 0;
+  resp->total = 0;
+  resp->free = 0;
+
+  if (i < 0 || (uint32_t)i >= h.num_devices) {
+    snprintf(buf, buflen, "vulkan device %d out of range", i);
+    resp->err = strdup(buf);
+    return;
+  }
+  VkPhysicalDevice device = h.devices[i];
+
+  // properties2 requires vulkan 1.1 on the device, which ggml-vulkan needs anyway
+  VkPhysicalDeviceProperties props = {0};
+  (*h.vkGetPhysicalDeviceProperties)(device, &props);
+  resp->vendor_id = props.vendorID;
+  resp->device_type = props.deviceType;
+  resp->api_major = VK_API_VERSION_MAJOR(props.apiVersion);
+  resp->api_minor = VK_API_VERSION_MINOR(props.apiVersion);
+  snprintf(resp->name, GPU_NAME_LEN, "%s", props.deviceName);
+  if (props.apiVersion < VK_MAKE_API_VERSION(0, 1, 1, 0)) {
+    LOG(h.verbose, "[%d] vulkan %d.%d is too old to query\n", i, resp->api_major, resp->api_minor);
+    return;
+  }
+
+  int pciBusInfo = vk_has_extension(h, device, "VK_EXT_pci_bus_info");
+  resp->has_budget = vk_has_extension(h, device, "VK_EXT_memory_budget");
+
+  VkPhysicalDevicePCIBusInfoPropertiesEXT pciProps = {0};
+  pciProps.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_PCI_BUS_INFO_PROPERTIES_EXT;
+
+  VkPhysicalDeviceIDProperties idProps = {0};
+  idProps.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_ID_PROPERTIES;
+  if (pciBusInfo) {
+    idProps.pNext = &pciProps;
+  }
+
+  VkPhysicalDeviceProperties2 props2 = {0};
+  props2.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_PROPERTIES_2;
+  props2.pNext = &idProps;
+  (*h.vkGetPhysicalDeviceProperties2)(device, &props2);
+
+  // Same format as CUDA so NVIDIA GPUs found by both can be matched up
+  // GPU-d110a105-ac29-1d54-7b49-9c90440f215b
+  uint8_t *uuid = idProps.deviceUUID;
+  snprintf(&resp->uuid[0], GPU_ID_LEN,
+           "GPU-%02x%02x%02x%02x-%02x%02x-%02x%02x-%02x%02x-%02x%02x%02x%02x%02x%02x",
+           uuid[0], uuid[1], uuid[2], uuid[3], uuid[4], uuid[5], uuid[6], uuid[7],
+           uuid[8], uuid[9], uuid[10], uuid[11], uuid[12], uuid[13], uuid[14], uuid[15]);
+
+  if (pciBusInfo) {
+    snprintf(&resp->pci_id[0], GPU_ID_LEN, "%04x:%02x:%02x.%x",
+             pciProps.pciDomain, pciProps.pciBus, pciProps.pciDevice, pciProps.pciFunction);
+  }
+
+  vk_get_memory(h, device, resp->has_budget, &resp->free, &resp->total);
+  LOG(h.verbose, "[%s] %s vulkan %d.%d totalMem %lu freeMem %lu\n", resp->uuid, resp->name,
+      resp->api_major, resp->api_minor, resp->total, resp->free);
+}
+
+void vk_get_free(vk_handle_t h, int i, uint64_t *free, uint64_t *total) {
+  if (i < 0 || (uint32_t)i >= h.num_devices) {
+    *free = 0;
+    *total = 0;
+    return;
+  }
+  VkPhysicalDevice device = h.devices[i];
+  vk_get_memory(h, device, vk_has_extension(h, device, "VK_EXT_memory_budget"), free, total);
+}
+
+void vk_release(vk_handle_t h) {
+  LOG(h.verbose, "releasing vulkan library\n");
+  free(h.devices);
+  if (h.instance != NULL) {
+    (*h.vkDestroyInstance)(h.instance, NULL);
+  }
+  UNLOAD_LIBRARY(h.handle);
+}
+
+#endif  // __APPLE__
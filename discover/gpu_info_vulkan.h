@@ -0,0 +1,182 @@
+#ifndef __APPLE__
+#ifndef __GPU_INFO_VULKAN_H__
+#define __GPU_INFO_VULKAN_H__
+#include "gpu_info.h"
+
+// Just enough typedef's to dlopen/dlsym for device and memory information
+
+#ifdef _WIN32
+#define VKAPI_CALL __stdcall
+#else
+#define VKAPI_CALL
+#endif
+
+typedef int32_t VkResult;
+#define VK_SUCCESS 0
+#define VK_INCOMPLETE 5
+
+typedef struct VkInstance_T *VkInstance;
+typedef struct VkPhysicalDevice_T *VkPhysicalDevice;
+
+#define VK_MAKE_API_VERSION(variant, major, minor, patch) \
+  ((((uint32_t)(variant)) << 29) | (((uint32_t)(major)) << 22) | (((uint32_t)(minor)) << 12) | ((uint32_t)(patch)))
+#define VK_API_VERSION_MAJOR(version) (((uint32_t)(version) >> 22) & 0x7FU)
+#define VK_API_VERSION_MINOR(version) (((uint32_t)(version) >> 12) & 0x3FFU)
+
+#define VK_STRUCTURE_TYPE_APPLICATION_INFO 0
+#define VK_STRUCTURE_TYPE_INSTANCE_CREATE_INFO 1
+#define VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_PROPERTIES_2 1000059001
+#define VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_MEMORY_PROPERTIES_2 1000059006
+#define VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_ID_PROPERTIES 1000071004
+#define VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_PCI_BUS_INFO_PROPERTIES_EXT 1000212000
+#define VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_MEMORY_BUDGET_PROPERTIES_EXT 1000237000
+
+#define VK_MEMORY_HEAP_DEVICE_LOCAL_BIT 0x00000001
+#define VK_MAX_MEMORY_TYPES 32
+#define VK_MAX_MEMORY_HEAPS 16
+#define VK_MAX_EXTENSION_NAME_SIZE 256
+#define VK_MAX_PHYSICAL_DEVICE_NAME_SIZE 256
+#define VK_UUID_SIZE 16
+
+typedef struct VkApplicationInfo {
+  int32_t sType;
+  const void *pNext;
+  const char *pApplicationName;
+  uint32_t applicationVersion;
+  const char *pEngineName;
+  uint32_t engineVersion;
+  uint32_t apiVersion;
+} VkApplicationInfo;
+
+typedef struct VkInstanceCreateInfo {
+  int32_t sType;
+  const void *pNext;
+  uint32_t flags;
+  const VkApplicationInfo *pApplicationInfo;
+  uint32_t enabledLayerCount;
+  const char *const *ppEnabledLayerNames;
+  uint32_t enabledExtensionCount;
+  const char *const *ppEnabledExtensionNames;
+} VkInstanceCreateInfo;
+
+typedef struct VkPhysicalDeviceProperties {
+  uint32_t apiVersion;
+  uint32_t driverVersion;
+  uint32_t vendorID;
+  uint32_t deviceID;
+  int32_t deviceType;
+  char deviceName[VK_MAX_PHYSICAL_DEVICE_NAME_SIZE];
+  uint8_t pipelineCacheUUID[VK_UUID_SIZE];
+  // VkPhysicalDeviceLimits and VkPhysicalDeviceSparseProperties, unused
+  uint64_t limits[66];
+} VkPhysicalDeviceProperties;
+
+typedef struct VkPhysicalDeviceProperties2 {
+  int32_t sType;
+  void *pNext;
+  VkPhysicalDeviceProperties properties;
+} VkPhysicalDeviceProperties2;
+
+typedef struct VkPhysicalDeviceIDProperties {
+  int32_t sType;
+  void *pNext;
+  uint8_t deviceUUID[VK_UUID_SIZE];
+  uint8_t driverUUID[VK_UUID_SIZE];
+  uint8_t deviceLUID[8];
+  uint32_t deviceNodeMask;
+  uint32_t deviceLUIDValid;
+} VkPhysicalDeviceIDProperties;
+
+typedef struct VkPhysicalDevicePCIBusInfoPropertiesEXT {
+  int32_t sType;
+  void *pNext;
+  uint32_t pciDomain;
+  uint32_t pciBus;
+  uint32_t pciDevice;
+  uint32_t pciFunction;
+} VkPhysicalDevicePCIBusInfoPropertiesEXT;
+
+typedef struct VkMemoryType {
+  uint32_t propertyFlags;
+  uint32_t heapIndex;
+} VkMemoryType;
+
+typedef struct VkMemoryHeap {
+  uint64_t size;
+  uint32_t flags;
+} VkMemoryHeap;
+
+typedef struct VkPhysicalDeviceMemoryProperties {
+  uint32_t memoryTypeCount;
+  VkMemoryType memoryTypes[VK_MAX_MEMORY_TYPES];
+  uint32_t memoryHeapCount;
+  VkMemoryHeap memoryHeaps[VK_MAX_MEMORY_HEAPS];
+} VkPhysicalDeviceMemoryProperties;
+
+typedef struct VkPhysicalDeviceMemoryProperties2 {
+  int32_t sType;
+  void *pNext;
+  VkPhysicalDeviceMemoryProperties memoryProperties;
+} VkPhysicalDeviceMemoryProperties2;
+
+typedef struct VkPhysicalDeviceMemoryBudgetPropertiesEXT {
+  int32_t sType;
+  void *pNext;
+  uint64_t heapBudget[VK_MAX_MEMORY_HEAPS];
+  uint64_t heapUsage[VK_MAX_MEMORY_HEAPS];
+} VkPhysicalDeviceMemoryBudgetPropertiesEXT;
+
+typedef struct VkExtensionProperties {
+  char extensionName[VK_MAX_EXTENSION_NAME_SIZE];
+  uint32_t specVersion;
+} VkExtensionProperties;
+
+// Device types reported in vk_device_info_t
+#define VK_PHYSICAL_DEVICE_TYPE_OTHER 0
+#define VK_PHYSICAL_DEVICE_TYPE_INTEGRATED_GPU 1
+#define VK_PHYSICAL_DEVICE_TYPE_DISCRETE_GPU 2
+#define VK_PHYSICAL_DEVICE_TYPE_VIRTUAL_GPU 3
+#define VK_PHYSICAL_DEVICE_TYPE_CPU 4
+
+typedef struct vk_handle {
+  void *handle;
+  uint16_t verbose;
+  VkInstance instance;
+  uint32_t num_devices;
+  VkPhysicalDevice *devices;
+  VkResult (VKAPI_CALL *vkCreateInstance)(const VkInstanceCreateInfo *, const void *, VkInstance *);
+  void (VKAPI_CALL *vkDestroyInstance)(VkInstance, const void *);
+  VkResult (VKAPI_CALL *vkEnumeratePhysicalDevices)(VkInstance, uint32_t *, VkPhysicalDevice *);
+  void (VKAPI_CALL *vkGetPhysicalDeviceProperties)(VkPhysicalDevice, VkPhysicalDeviceProperties *);
+  void (VKAPI_CALL *vkGetPhysicalDeviceProperties2)(VkPhysicalDevice, VkPhysicalDeviceProperties2 *);
+  void (VKAPI_CALL *vkGetPhysicalDeviceMemoryProperties2)(VkPhysicalDevice, VkPhysicalDeviceMemoryProperties2 *);
+  VkResult (VKAPI_CALL *vkEnumerateDeviceExtensionProperties)(VkPhysicalDevice, const char *, uint32_t *, VkExtensionProperties *);
+} vk_handle_t;
+
+typedef struct vk_init_resp {
+  char *err;  // If err is non-null handle is invalid
+  int num_devices;
+  vk_handle_t vh;
+} vk_init_resp_t;
+
+typedef struct vk_device_info {
+  char *err;  // If non-nill, caller responsible for freeing
+  char uuid[GPU_ID_LEN];
+  char pci_id[GPU_ID_LEN];  // empty if the driver doesn't report the PCI address
+  char name[GPU_NAME_LEN];
+  uint32_t vendor_id;
+  uint32_t device_type;
+  int api_major;
+  int api_minor;
+  int has_budget;  // free memory is only known with VK_EXT_memory_budget
+  uint64_t total;
+  uint64_t free;
+} vk_device_info_t;
+
+void vk_init(char *vk_lib_path, vk_init_resp_t *resp);
+void vk_bootstrap(vk_handle_t h, int i, vk_device_info_t *resp);
+void vk_get_free(vk_handle_t h, int i, uint64_t *free, uint64_t *total);
+void vk_release(vk_handle_t h);
+
+#endif  // __GPU_INFO_VULKAN_H__
+#endif  // __APPLE__
@@ -47,11 +47,18 @@ var OneapiGlobs = []string{
 	"/usr/lib*/libze_intel_gpu.so*",
 }
 
+var VulkanGlobs = []string{
+	"/usr/lib/*-linux-gnu/libvulkan.so*",
+	"/usr/lib*/libvulkan.so*",
+	"/usr/local/lib*/libvulkan.so*",
+}
+
 var (
 	CudartMgmtName = "libcudart.so*"
 	NvcudaMgmtName = "libcuda.so*"
 	NvmlMgmtName   = "" // not currently wired on linux
 	OneapiMgmtName = "libze_intel_gpu.so*"
+	VulkanMgmtName = "libvulkan.so*"
 )
 
 func GetCPUMem() (memInfo, error) {
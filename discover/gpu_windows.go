@@ -42,11 +42,16 @@ var OneapiGlobs = []string{
 	"c:\\Windows\\System32\\DriverStore\\FileRepository\\*\\ze_intel_gpu64.dll",
 }
 
+var VulkanGlobs = []string{
+	"c:\\Windows\\System32\\vulkan-1.dll",
+}
+
 var (
 	CudartMgmtName = "cudart64_*.dll"
 	NvcudaMgmtName = "nvcuda.dll"
 	NvmlMgmtName   = "nvml.dll"
 	OneapiMgmtName = "ze_intel_gpu64.dll"
+	VulkanMgmtName = "vulkan-1.dll"
 )
 
 func GetCPUMem() (memInfo, error) {
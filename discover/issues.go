@@ -0,0 +1,143 @@
+package discover
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// Kinds of [Issue].
+const (
+	IssueDriverTooOld    = "driver_too_old"
+	IssueDriverMismatch  = "driver_mismatch"
+	IssueRuntimeMismatch = "runtime_mismatch"
+	IssueComputeTooOld   = "compute_too_old"
+	IssueUnsupportedGFX  = "unsupported_gfx"
+	IssueInvalidOverride = "invalid_override"
+	IssueMissingLibrary  = "missing_library"
+	IssuePermission      = "permission"
+	IssueLibraryLoad     = "library_load"
+)
+
+// Issue is a problem found while discovering GPUs that leaves a GPU unused,
+// so models run on the CPU instead, along with what can be done about it.
+type Issue struct {
+	Library     string `json:"library"`
+	GPU         string `json:"gpu,omitempty"`
+	Kind        string `json:"kind"`
+	Message     string `json:"message"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+func (i Issue) Error() string {
+	if i.Remediation == "" {
+		return i.Message
+	}
+
+	return i.Message + ": " + i.Remediation
+}
+
+// issues are the problems found during the last discovery
+var issues []Issue
+
+// addIssue logs and records a discovery issue. The GPU lock must be held.
+func addIssue(i Issue) {
+	slog.Warn(i.Message, "library", i.Library, "gpu", i.GPU, "remediation", i.Remediation)
+	issues = append(issues, i)
+}
+
+// cudaDriverIssue returns the issue with an NVIDIA driver that supports CUDA
+// major.minor, or nil if the bundled CUDA runtimes can use it. Drivers that
+// don't report a version are given the benefit of the doubt.
+func cudaDriverIssue(major, minor int) *Issue {
+	if major == 0 || major >= 11 {
+		return nil
+	}
+
+	return &Issue{
+		Library:     "cuda",
+		Kind:        IssueRuntimeMismatch,
+		Message:     fmt.Sprintf("the NVIDIA driver supports CUDA %d.%d but the bundled CUDA runtime needs 11.0 or newer", major, minor),
+		Remediation: "upgrade the NVIDIA driver to version 450 or newer",
+	}
+}
+
+// gfxOverride returns the HSA_OVERRIDE_GFX_VERSION value that runs the AMD
+// GPU of type gfx with a supported type of the same major and minor version,
+// or "" if there is none. Types are of the form gfx1031, with the last two
+// digits in hexadecimal.
+func gfxOverride(gfx string, supported []string) string {
+	major, minor, _, ok := parseGFX(gfx)
+	if !ok {
+		return ""
+	}
+
+	for _, s := range supported {
+		if smajor, sminor, spatch, ok := parseGFX(s); ok && smajor == major && sminor == minor {
+			return fmt.Sprintf("%d.%d.%d", smajor, sminor, spatch)
+		}
+	}
+
+	return ""
+}
+
+// validGFXOverride reports whether s is a valid HSA_OVERRIDE_GFX_VERSION.
+func validGFXOverride(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return false
+	}
+
+	for _, p := range parts {
+		if _, err := strconv.Atoi(p); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func parseGFX(s string) (major, minor, patch int, ok bool) {
+	s, ok = strings.CutPrefix(s, "gfx")
+	if !ok || len(s) < 3 {
+		return 0, 0, 0, false
+	}
+
+	major, err := strconv.Atoi(s[:len(s)-2])
+	if err != nil {
+		return 0, 0, 0, false
+	}
+
+	m, err := strconv.ParseUint(s[len(s)-2:len(s)-1], 16, 8)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+
+	p, err := strconv.ParseUint(s[len(s)-1:], 16, 8)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+
+	return major, int(m), int(p), true
+}
+
+// unsupportedGFXIssue returns the issue with an AMD GPU of a type the ROCm
+// library wasn't built for, suggesting an override where one is likely to
+// work.
+func unsupportedGFXIssue(id, gfx string, supported []string) Issue {
+	i := Issue{
+		Library: "rocm",
+		GPU:     id,
+		Kind:    IssueUnsupportedGFX,
+		Message: fmt.Sprintf("amdgpu type %s is not supported by the ROCm library", gfx),
+	}
+
+	if v := gfxOverride(gfx, supported); v != "" {
+		i.Remediation = fmt.Sprintf("set HSA_OVERRIDE_GFX_VERSION=%s to run it as a supported type of the same family", v)
+	} else {
+		i.Remediation = "no supported type of the same family is available, see https://github.com/ollama/ollama/blob/main/docs/gpu.md#overrides"
+	}
+
+	return i
+}
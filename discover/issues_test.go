@@ -0,0 +1,52 @@
+package discover
+
+import "testing"
+
+func TestGFXOverride(t *testing.T) {
+	supported := []string{"gfx900", "gfx1030", "gfx1100", "gfx90a"}
+
+	cases := []struct {
+		gfx  string
+		want string
+	}{
+		{"gfx1031", "10.3.0"},
+		{"gfx1032", "10.3.0"},
+		{"gfx1101", "11.0.0"},
+		{"gfx90c", "9.0.0"},
+		{"gfx1010", ""},
+		{"gfx803", ""},
+		{"bogus", ""},
+	}
+
+	for _, tt := range cases {
+		if got := gfxOverride(tt.gfx, supported); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.gfx, tt.want, got)
+		}
+	}
+}
+
+func TestValidGFXOverride(t *testing.T) {
+	for s, want := range map[string]bool{
+		"10.3.0":  true,
+		"9.0.0":   true,
+		"10.3":    false,
+		"gfx1030": false,
+		"10.3.x":  false,
+	} {
+		if got := validGFXOverride(s); got != want {
+			t.Errorf("%s: expected %v, got %v", s, want, got)
+		}
+	}
+}
+
+func TestCudaDriverIssue(t *testing.T) {
+	if issue := cudaDriverIssue(10, 2); issue == nil || issue.Kind != IssueRuntimeMismatch {
+		t.Errorf("expected a runtime mismatch, got %v", issue)
+	}
+
+	for _, v := range [][2]int{{0, 0}, {11, 0}, {12, 4}} {
+		if issue := cudaDriverIssue(v[0], v[1]); issue != nil {
+			t.Errorf("%d.%d: expected no issue, got %v", v[0], v[1], issue)
+		}
+	}
+}
@@ -83,6 +83,7 @@ type RocmGPUInfo struct {
 	GpuInfo
 	usedFilepath string //nolint:unused,nolintlint
 	index        int    //nolint:unused,nolintlint
+	pciID        string //nolint:unused,nolintlint
 }
 type RocmGPUInfoList []RocmGPUInfo
 
@@ -93,6 +94,16 @@ type OneapiGPUInfo struct {
 }
 type OneapiGPUInfoList []OneapiGPUInfo
 
+type VulkanGPUInfo struct {
+	GpuInfo
+	index      int    //nolint:unused,nolintlint
+	uuid       string //nolint:unused,nolintlint
+	pciID      string //nolint:unused,nolintlint
+	vendorID   uint32 //nolint:unused,nolintlint
+	deviceType int    //nolint:unused,nolintlint
+}
+type VulkanGPUInfoList []VulkanGPUInfo
+
 type GpuInfoList []GpuInfo
 
 type UnsupportedGPUInfo struct {
@@ -153,6 +164,14 @@ type SystemInfo struct {
 	GPUs            []GpuInfo            `json:"gpus"`
 	UnsupportedGPUs []UnsupportedGPUInfo `json:"unsupported_gpus"`
 	DiscoveryErrors []string             `json:"discovery_errors"`
+
+	// Issues are the problems that left GPUs unused, with what can be done
+	// about them.
+	Issues []Issue `json:"issues"`
+
+	// LostGPUs are the IDs of the GPUs in GPUs that stopped responding
+	// since they were discovered, such as GPUs that fell off the bus.
+	LostGPUs []string `json:"lost_gpus,omitempty"`
 }
 
 // Return the optimal number of threads to use for inference
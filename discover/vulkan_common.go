@@ -0,0 +1,109 @@
+//go:build linux || windows
+
+package discover
+
+import (
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ollama/ollama/runners"
+)
+
+// Vulkan device types, as reported by VkPhysicalDeviceProperties
+const (
+	vulkanDeviceOther      = 0
+	vulkanDeviceIntegrated = 1
+	vulkanDeviceCPU        = 4
+)
+
+// vulkanMinimumVersion is the Vulkan version ggml-vulkan requires
+var vulkanMinimumVersion = [2]int{1, 2}
+
+// vulkanVisibleDevices are the indexes of the Vulkan devices ggml-vulkan is
+// limited to by GGML_VK_VISIBLE_DEVICES, or nil if all are visible.
+func vulkanVisibleDevices() []string {
+	if s := os.Getenv("GGML_VK_VISIBLE_DEVICES"); s != "" {
+		return strings.Split(s, ",")
+	}
+
+	return nil
+}
+
+func vulkanGetVisibleDevicesEnv(gpuInfo []GpuInfo) (string, string) {
+	ids := []string{}
+	for _, info := range gpuInfo {
+		if info.Library != "vulkan" {
+			// TODO shouldn't happen if things are wired correctly...
+			slog.Debug("vulkanGetVisibleDevicesEnv skipping over non-vulkan device", "library", info.Library)
+			continue
+		}
+		ids = append(ids, info.ID)
+	}
+	return "GGML_VK_VISIBLE_DEVICES", strings.Join(ids, ",")
+}
+
+// hasVulkanRunner reports whether a Vulkan runner is installed. Vulkan GPUs
+// are only discovered if one is, since no other runner can use them.
+func hasVulkanRunner() bool {
+	for name := range runners.GetAvailableServers() {
+		if strings.HasPrefix(name, "vulkan") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// vulkanSkipReason returns why gpu is left to another library or not used at
+// all, or "" if models should run on it with Vulkan. GPUs that CUDA or ROCm
+// support run with them, so Vulkan only picks up the rest, such as Intel Arc
+// and AMD GPUs ROCm doesn't support.
+func vulkanSkipReason(gpu VulkanGPUInfo, cuda []CudaGPUInfo, rocm []RocmGPUInfo, oneapi []OneapiGPUInfo, vulkan []VulkanGPUInfo) string {
+	switch gpu.deviceType {
+	case vulkanDeviceCPU, vulkanDeviceOther:
+		return "not a GPU"
+	case vulkanDeviceIntegrated:
+		return "integrated GPUs are not supported"
+	}
+
+	if visible := vulkanVisibleDevices(); visible != nil && !slices.Contains(visible, strconv.Itoa(gpu.index)) {
+		return "filtering out device per user request"
+	}
+
+	for _, g := range cuda {
+		if g.ID == gpu.uuid {
+			return "supported by cuda"
+		}
+	}
+
+	for _, g := range rocm {
+		// match by PCI address where both know it, as ROCm names GPUs by
+		// their PCI IDs on linux
+		if g.pciID != "" && gpu.pciID != "" {
+			if g.pciID == gpu.pciID {
+				return "supported by rocm"
+			}
+		} else if strings.EqualFold(g.Name, gpu.Name) {
+			return "supported by rocm"
+		}
+	}
+
+	for _, g := range oneapi {
+		if strings.EqualFold(g.Name, gpu.Name) {
+			return "supported by oneapi"
+		}
+	}
+
+	// the same GPU is listed once for each of its Vulkan drivers, such as
+	// both RADV and AMDVLK
+	for _, g := range vulkan {
+		if g.uuid == gpu.uuid {
+			return "already found by another vulkan driver"
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,49 @@
+//go:build linux || windows
+
+package discover
+
+import "testing"
+
+func TestVulkanSkipReason(t *testing.T) {
+	arc := VulkanGPUInfo{GpuInfo: GpuInfo{Name: "Intel(R) Arc(TM) A770 Graphics"}, index: 0, uuid: "GPU-1", pciID: "0000:03:00.0", deviceType: 2}
+	rtx := VulkanGPUInfo{GpuInfo: GpuInfo{Name: "NVIDIA GeForce RTX 4090"}, index: 1, uuid: "GPU-2", pciID: "0000:01:00.0", deviceType: 2}
+	radeon := VulkanGPUInfo{GpuInfo: GpuInfo{Name: "AMD Radeon RX 7900 XTX (RADV NAVI31)"}, index: 2, uuid: "GPU-3", pciID: "0000:05:00.0", deviceType: 2}
+
+	cuda := []CudaGPUInfo{{GpuInfo: GpuInfo{ID: "GPU-2", Name: "NVIDIA GeForce RTX 4090"}}}
+	rocm := []RocmGPUInfo{{GpuInfo: GpuInfo{ID: "GPU-4a3b", Name: "1002:744c"}, pciID: "0000:05:00.0"}}
+
+	cases := []struct {
+		name   string
+		gpu    VulkanGPUInfo
+		vulkan []VulkanGPUInfo
+		want   string
+	}{
+		{"unsupported elsewhere", arc, nil, ""},
+		{"cuda", rtx, nil, "supported by cuda"},
+		{"rocm", radeon, nil, "supported by rocm"},
+		{"rocm without pci address", VulkanGPUInfo{GpuInfo: GpuInfo{Name: "1002:744c"}, uuid: "GPU-5", deviceType: 2}, nil, "supported by rocm"},
+		{"other driver", arc, []VulkanGPUInfo{arc}, "already found by another vulkan driver"},
+		{"integrated", VulkanGPUInfo{deviceType: 1}, nil, "integrated GPUs are not supported"},
+		{"software", VulkanGPUInfo{GpuInfo: GpuInfo{Name: "llvmpipe (LLVM 17.0.6, 256 bits)"}, deviceType: 4}, nil, "not a GPU"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := vulkanSkipReason(tt.gpu, cuda, rocm, nil, tt.vulkan); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("visible devices", func(t *testing.T) {
+		t.Setenv("GGML_VK_VISIBLE_DEVICES", "1,2")
+		if got := vulkanSkipReason(arc, nil, nil, nil, nil); got != "filtering out device per user request" {
+			t.Errorf("expected %s to be filtered out, got %q", arc.Name, got)
+		}
+
+		arc.index = 2
+		if got := vulkanSkipReason(arc, nil, nil, nil, nil); got != "" {
+			t.Errorf("expected %s to be visible, got %q", arc.Name, got)
+		}
+	})
+}
@@ -15,7 +15,8 @@ import (
 )
 
 // Host returns the scheme and host. Host can be configured via the OLLAMA_HOST environment variable.
-// Default is scheme "http" and host "127.0.0.1:11434"
+// Default is scheme "http" and host "127.0.0.1:11434". A Unix domain socket, such as
+// unix:///run/ollama.sock, has scheme "unix" and the path of the socket.
 func Host() *url.URL {
 	defaultPort := "11434"
 
@@ -28,6 +29,8 @@ func Host() *url.URL {
 		defaultPort = "80"
 	case scheme == "https":
 		defaultPort = "443"
+	case scheme == "unix":
+		return &url.URL{Scheme: scheme, Path: hostport}
 	}
 
 	hostport, path, _ := strings.Cut(hostport, "/")
@@ -93,6 +96,66 @@ func Models() string {
 	return filepath.Join(home, ".ollama", "models")
 }
 
+// Datasets returns the path to the directory of the datasets of models that mirror chat exchanges. Datasets can be configured via the OLLAMA_DATASETS environment variable.
+// Default is $HOME/.ollama/datasets
+func Datasets() string {
+	if s := Var("OLLAMA_DATASETS"); s != "" {
+		return s
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+
+	return filepath.Join(home, ".ollama", "datasets")
+}
+
+// HistoryFile returns the path to the file where the server records the generate and chat requests it serves. The file can be configured via the OLLAMA_HISTORY_FILE environment variable.
+// Default is $HOME/.ollama/history.jsonl
+func HistoryFile() string {
+	if s := Var("OLLAMA_HISTORY_FILE"); s != "" {
+		return s
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+
+	return filepath.Join(home, ".ollama", "history.jsonl")
+}
+
+// Sessions returns the path to the directory the KV cache of sessions is saved to. Sessions can be configured via the OLLAMA_SESSIONS environment variable.
+// Default is $HOME/.ollama/sessions
+func Sessions() string {
+	if s := Var("OLLAMA_SESSIONS"); s != "" {
+		return s
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+
+	return filepath.Join(home, ".ollama", "sessions")
+}
+
+// Checkpoints returns the path to the checkpoints directory. Checkpoints can be configured via the OLLAMA_CHECKPOINTS environment variable.
+// Default is $HOME/.ollama/checkpoints
+func Checkpoints() string {
+	if s := Var("OLLAMA_CHECKPOINTS"); s != "" {
+		return s
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+
+	return filepath.Join(home, ".ollama", "checkpoints")
+}
+
 // KeepAlive returns the duration that models stay loaded in memory. KeepAlive can be configured via the OLLAMA_KEEP_ALIVE environment variable.
 // Negative values are treated as infinite. Zero is treated as no keep alive.
 // Default is 5 minutes.
@@ -133,6 +196,36 @@ func LoadTimeout() (loadTimeout time.Duration) {
 	return loadTimeout
 }
 
+// IdleTimeout returns how long the server waits without requests before it exits. IdleTimeout can be configured via the OLLAMA_IDLE_TIMEOUT environment variable.
+// Zero or negative values keep the server running.
+// Default is 0.
+func IdleTimeout() (idleTimeout time.Duration) {
+	if s := Var("OLLAMA_IDLE_TIMEOUT"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			idleTimeout = d
+		} else if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			idleTimeout = time.Duration(n) * time.Second
+		}
+	}
+
+	return max(idleTimeout, 0)
+}
+
+// ScrubInterval returns how often the server re-verifies the digests of its blobs while idle. ScrubInterval can be configured via the OLLAMA_SCRUB_INTERVAL environment variable.
+// Zero or negative values disable scrubbing.
+// Default is 0.
+func ScrubInterval() (scrubInterval time.Duration) {
+	if s := Var("OLLAMA_SCRUB_INTERVAL"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			scrubInterval = d
+		} else if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			scrubInterval = time.Duration(n) * time.Second
+		}
+	}
+
+	return max(scrubInterval, 0)
+}
+
 func Bool(k string) func() bool {
 	return func() bool {
 		if s := Var(k); s != "" {
@@ -155,16 +248,22 @@ var (
 	FlashAttention = Bool("OLLAMA_FLASH_ATTENTION")
 	// KvCacheType is the quantization type for the K/V cache.
 	KvCacheType = String("OLLAMA_KV_CACHE_TYPE")
-	// NoHistory disables readline history.
+	// NoHistory disables readline history and the server's request history.
 	NoHistory = Bool("OLLAMA_NOHISTORY")
+	// HistoryCapture keeps the prompts and responses of requests in the server's request history.
+	HistoryCapture = Bool("OLLAMA_HISTORY_CAPTURE")
 	// NoPrune disables pruning of model blobs on startup.
 	NoPrune = Bool("OLLAMA_NOPRUNE")
 	// SchedSpread allows scheduling models across all GPUs.
 	SchedSpread = Bool("OLLAMA_SCHED_SPREAD")
+	// Registry serves local models to other clients over the registry API.
+	Registry = Bool("OLLAMA_REGISTRY")
 	// IntelGPU enables experimental Intel GPU detection.
 	IntelGPU = Bool("OLLAMA_INTEL_GPU")
 	// MultiUserCache optimizes prompt caching for multi-user scenarios
 	MultiUserCache = Bool("OLLAMA_MULTIUSER_CACHE")
+	// Chaos injects the failures requested in the X-Ollama-Chaos header of requests, for testing clients.
+	Chaos = Bool("OLLAMA_CHAOS")
 )
 
 func String(s string) func() string {
@@ -175,6 +274,38 @@ func String(s string) func() string {
 
 var (
 	LLMLibrary = String("OLLAMA_LLM_LIBRARY")
+	// PreloadModel is the model loaded when the server starts.
+	PreloadModel = String("OLLAMA_PRELOAD_MODEL")
+	// SummaryModel is the model used to generate conversation titles and summaries.
+	SummaryModel = String("OLLAMA_SUMMARY_MODEL")
+	// Tools is the path to a file defining tools the server may execute.
+	Tools = String("OLLAMA_TOOLS")
+	// MCPServers is the path to a file defining MCP servers whose tools are made available to models.
+	MCPServers = String("OLLAMA_MCP_SERVERS")
+	// SamplerTrace is the directory to write sampler traces to. Tracing is disabled if unset.
+	SamplerTrace = String("OLLAMA_SAMPLER_TRACE")
+	// PromptCache is the directory the KV cache of system prompts is saved to. Prompt caching is disabled if unset.
+	PromptCache = String("OLLAMA_PROMPT_CACHE")
+	// LogFormat is the format of the logs: text, or json for JSON lines.
+	LogFormat = String("OLLAMA_LOG_FORMAT")
+	// DiffusionRunner is the stable-diffusion.cpp executable images are generated with. sd in the PATH is used if unset.
+	DiffusionRunner = String("OLLAMA_DIFFUSION_RUNNER")
+	// ContextPolicy sizes the default context length of models to the available memory: conservative, balanced or max.
+	ContextPolicy = String("OLLAMA_CONTEXT_POLICY")
+	// ACL is the path to a file of the API keys of the server, the models they can run, pull and delete and their rate limits.
+	ACL = String("OLLAMA_ACL")
+	// Schedules is the path to a file of cron schedules for loading and unloading models.
+	Schedules = String("OLLAMA_SCHEDULES")
+	// APIKey is the API key the client sends to the server.
+	APIKey = String("OLLAMA_API_KEY")
+	// TLSCert and TLSKey are the paths to the PEM certificate and key the server listens with TLS with.
+	TLSCert = String("OLLAMA_TLS_CERT")
+	TLSKey  = String("OLLAMA_TLS_KEY")
+	// TLSClientCA is the path to the PEM certificates of the CAs client certificates must be signed by. Client certificates are not required if unset.
+	TLSClientCA = String("OLLAMA_TLS_CLIENT_CA")
+	// TLSClientCert and TLSClientKey are the paths to the PEM certificate and key the client sends to the server.
+	TLSClientCert = String("OLLAMA_TLS_CLIENT_CERT")
+	TLSClientKey  = String("OLLAMA_TLS_CLIENT_KEY")
 
 	CudaVisibleDevices    = String("CUDA_VISIBLE_DEVICES")
 	HipVisibleDevices     = String("HIP_VISIBLE_DEVICES")
@@ -206,6 +337,12 @@ var (
 	MaxQueue = Uint("OLLAMA_MAX_QUEUE", 512)
 	// MaxVRAM sets a maximum VRAM override in bytes. MaxVRAM can be configured via the OLLAMA_MAX_VRAM environment variable.
 	MaxVRAM = Uint("OLLAMA_MAX_VRAM", 0)
+	// MaxDownloadParts sets the maximum number of parts of a blob downloaded at the same time. MaxDownloadParts can be configured via the OLLAMA_MAX_DOWNLOAD_PARTS environment variable.
+	MaxDownloadParts = Uint("OLLAMA_MAX_DOWNLOAD_PARTS", 16)
+	// MaxSessions sets the maximum number of sessions kept, evicting the least recently used. MaxSessions can be configured via the OLLAMA_MAX_SESSIONS environment variable.
+	MaxSessions = Uint("OLLAMA_MAX_SESSIONS", 32)
+	// MaxPromptCaches sets the maximum number of prompt caches kept, evicting the least recently used. MaxPromptCaches can be configured via the OLLAMA_MAX_PROMPT_CACHES environment variable.
+	MaxPromptCaches = Uint("OLLAMA_MAX_PROMPT_CACHES", 16)
 )
 
 func Uint64(key string, defaultValue uint64) func() uint64 {
@@ -233,23 +370,49 @@ type EnvVar struct {
 
 func AsMap() map[string]EnvVar {
 	ret := map[string]EnvVar{
-		"OLLAMA_DEBUG":             {"OLLAMA_DEBUG", Debug(), "Show additional debug information (e.g. OLLAMA_DEBUG=1)"},
-		"OLLAMA_FLASH_ATTENTION":   {"OLLAMA_FLASH_ATTENTION", FlashAttention(), "Enabled flash attention"},
-		"OLLAMA_KV_CACHE_TYPE":     {"OLLAMA_KV_CACHE_TYPE", KvCacheType(), "Quantization type for the K/V cache (default: f16)"},
-		"OLLAMA_GPU_OVERHEAD":      {"OLLAMA_GPU_OVERHEAD", GpuOverhead(), "Reserve a portion of VRAM per GPU (bytes)"},
-		"OLLAMA_HOST":              {"OLLAMA_HOST", Host(), "IP Address for the ollama server (default 127.0.0.1:11434)"},
-		"OLLAMA_KEEP_ALIVE":        {"OLLAMA_KEEP_ALIVE", KeepAlive(), "The duration that models stay loaded in memory (default \"5m\")"},
-		"OLLAMA_LLM_LIBRARY":       {"OLLAMA_LLM_LIBRARY", LLMLibrary(), "Set LLM library to bypass autodetection"},
-		"OLLAMA_LOAD_TIMEOUT":      {"OLLAMA_LOAD_TIMEOUT", LoadTimeout(), "How long to allow model loads to stall before giving up (default \"5m\")"},
-		"OLLAMA_MAX_LOADED_MODELS": {"OLLAMA_MAX_LOADED_MODELS", MaxRunners(), "Maximum number of loaded models per GPU"},
-		"OLLAMA_MAX_QUEUE":         {"OLLAMA_MAX_QUEUE", MaxQueue(), "Maximum number of queued requests"},
-		"OLLAMA_MODELS":            {"OLLAMA_MODELS", Models(), "The path to the models directory"},
-		"OLLAMA_NOHISTORY":         {"OLLAMA_NOHISTORY", NoHistory(), "Do not preserve readline history"},
-		"OLLAMA_NOPRUNE":           {"OLLAMA_NOPRUNE", NoPrune(), "Do not prune model blobs on startup"},
-		"OLLAMA_NUM_PARALLEL":      {"OLLAMA_NUM_PARALLEL", NumParallel(), "Maximum number of parallel requests"},
-		"OLLAMA_ORIGINS":           {"OLLAMA_ORIGINS", Origins(), "A comma separated list of allowed origins"},
-		"OLLAMA_SCHED_SPREAD":      {"OLLAMA_SCHED_SPREAD", SchedSpread(), "Always schedule model across all GPUs"},
-		"OLLAMA_MULTIUSER_CACHE":   {"OLLAMA_MULTIUSER_CACHE", MultiUserCache(), "Optimize prompt caching for multi-user scenarios"},
+		"OLLAMA_DEBUG":              {"OLLAMA_DEBUG", Debug(), "Show additional debug information (e.g. OLLAMA_DEBUG=1)"},
+		"OLLAMA_FLASH_ATTENTION":    {"OLLAMA_FLASH_ATTENTION", FlashAttention(), "Enabled flash attention"},
+		"OLLAMA_KV_CACHE_TYPE":      {"OLLAMA_KV_CACHE_TYPE", KvCacheType(), "Quantization type for the K/V cache (default: f16)"},
+		"OLLAMA_GPU_OVERHEAD":       {"OLLAMA_GPU_OVERHEAD", GpuOverhead(), "Reserve a portion of VRAM per GPU (bytes)"},
+		"OLLAMA_HOST":               {"OLLAMA_HOST", Host(), "IP Address, or unix:// socket path, for the ollama server (default 127.0.0.1:11434)"},
+		"OLLAMA_IDLE_TIMEOUT":       {"OLLAMA_IDLE_TIMEOUT", IdleTimeout(), "Exit the server after this long without requests (default: never)"},
+		"OLLAMA_KEEP_ALIVE":         {"OLLAMA_KEEP_ALIVE", KeepAlive(), "The duration that models stay loaded in memory (default \"5m\")"},
+		"OLLAMA_LLM_LIBRARY":        {"OLLAMA_LLM_LIBRARY", LLMLibrary(), "Set LLM library to bypass autodetection"},
+		"OLLAMA_LOAD_TIMEOUT":       {"OLLAMA_LOAD_TIMEOUT", LoadTimeout(), "How long to allow model loads to stall before giving up (default \"5m\")"},
+		"OLLAMA_MAX_LOADED_MODELS":  {"OLLAMA_MAX_LOADED_MODELS", MaxRunners(), "Maximum number of loaded models per GPU"},
+		"OLLAMA_MAX_QUEUE":          {"OLLAMA_MAX_QUEUE", MaxQueue(), "Maximum number of queued requests"},
+		"OLLAMA_MAX_DOWNLOAD_PARTS": {"OLLAMA_MAX_DOWNLOAD_PARTS", MaxDownloadParts(), "Maximum number of parts of a blob downloaded at the same time (default 16)"},
+		"OLLAMA_MODELS":             {"OLLAMA_MODELS", Models(), "The path to the models directory"},
+		"OLLAMA_NOHISTORY":          {"OLLAMA_NOHISTORY", NoHistory(), "Do not preserve readline history or record requests"},
+		"OLLAMA_NOPRUNE":            {"OLLAMA_NOPRUNE", NoPrune(), "Do not prune model blobs on startup"},
+		"OLLAMA_NUM_PARALLEL":       {"OLLAMA_NUM_PARALLEL", NumParallel(), "Maximum number of parallel requests"},
+		"OLLAMA_ORIGINS":            {"OLLAMA_ORIGINS", Origins(), "A comma separated list of allowed origins"},
+		"OLLAMA_PRELOAD_MODEL":      {"OLLAMA_PRELOAD_MODEL", PreloadModel(), "Model to load when the server starts"},
+		"OLLAMA_SCRUB_INTERVAL":     {"OLLAMA_SCRUB_INTERVAL", ScrubInterval(), "Re-verify the digests of blobs this often while idle (default: never)"},
+		"OLLAMA_REGISTRY":           {"OLLAMA_REGISTRY", Registry(), "Serve local models as a registry for pull and push"},
+		"OLLAMA_SCHED_SPREAD":       {"OLLAMA_SCHED_SPREAD", SchedSpread(), "Always schedule model across all GPUs"},
+		"OLLAMA_SUMMARY_MODEL":      {"OLLAMA_SUMMARY_MODEL", SummaryModel(), "Model used to generate conversation titles and summaries"},
+		"OLLAMA_TOOLS":              {"OLLAMA_TOOLS", Tools(), "Path to a file defining tools the server may execute"},
+		"OLLAMA_MCP_SERVERS":        {"OLLAMA_MCP_SERVERS", MCPServers(), "Path to a file defining MCP servers to connect to"},
+		"OLLAMA_MULTIUSER_CACHE":    {"OLLAMA_MULTIUSER_CACHE", MultiUserCache(), "Optimize prompt caching for multi-user scenarios"},
+		"OLLAMA_CHAOS":              {"OLLAMA_CHAOS", Chaos(), "Inject the failures requested in the X-Ollama-Chaos header, for testing clients"},
+		"OLLAMA_CHECKPOINTS":        {"OLLAMA_CHECKPOINTS", Checkpoints(), "The path to the directory for checkpoints of long generations"},
+		"OLLAMA_SESSIONS":           {"OLLAMA_SESSIONS", Sessions(), "The path to the directory for the KV cache of sessions"},
+		"OLLAMA_MAX_SESSIONS":       {"OLLAMA_MAX_SESSIONS", MaxSessions(), "Maximum number of sessions kept, least recently used evicted first (default 32)"},
+		"OLLAMA_PROMPT_CACHE":       {"OLLAMA_PROMPT_CACHE", PromptCache(), "Directory to save the KV cache of system prompts to for reuse across requests"},
+		"OLLAMA_MAX_PROMPT_CACHES":  {"OLLAMA_MAX_PROMPT_CACHES", MaxPromptCaches(), "Maximum number of prompt caches kept, least recently used evicted first (default 16)"},
+		"OLLAMA_LOG_FORMAT":         {"OLLAMA_LOG_FORMAT", LogFormat(), "Format of the logs: text or json (default: text)"},
+		"OLLAMA_DIFFUSION_RUNNER":   {"OLLAMA_DIFFUSION_RUNNER", DiffusionRunner(), "Path to the stable-diffusion.cpp executable to generate images with (default: sd in the PATH)"},
+		"OLLAMA_DATASETS":           {"OLLAMA_DATASETS", Datasets(), "The path to the directory for datasets of mirrored chat exchanges"},
+		"OLLAMA_SAMPLER_TRACE":      {"OLLAMA_SAMPLER_TRACE", SamplerTrace(), "Directory to write sampler traces to for debugging"},
+		"OLLAMA_CONTEXT_POLICY":     {"OLLAMA_CONTEXT_POLICY", ContextPolicy(), "Size the default context length to available memory: conservative, balanced or max (default: 2048)"},
+		"OLLAMA_ACL":                {"OLLAMA_ACL", ACL(), "Path to a file of API keys, the models they can use and their rate limits"},
+		"OLLAMA_SCHEDULES":          {"OLLAMA_SCHEDULES", Schedules(), "Path to a file of schedules for loading and unloading models"},
+		"OLLAMA_TLS_CERT":           {"OLLAMA_TLS_CERT", TLSCert(), "Path to the certificate to serve TLS with, reloaded when it changes"},
+		"OLLAMA_TLS_KEY":            {"OLLAMA_TLS_KEY", TLSKey(), "Path to the key of the TLS certificate"},
+		"OLLAMA_TLS_CLIENT_CA":      {"OLLAMA_TLS_CLIENT_CA", TLSClientCA(), "Path to the CA certificates to require client certificates signed by"},
+		"OLLAMA_HISTORY_FILE":       {"OLLAMA_HISTORY_FILE", HistoryFile(), "The path to the file recording recent generate and chat requests"},
+		"OLLAMA_HISTORY_CAPTURE":    {"OLLAMA_HISTORY_CAPTURE", HistoryCapture(), "Keep prompts and responses in the request history"},
 
 		// Informational
 		"HTTP_PROXY":  {"HTTP_PROXY", String("HTTP_PROXY")(), "HTTP proxy"},
@@ -13,28 +13,30 @@ func TestHost(t *testing.T) {
 		value  string
 		expect string
 	}{
-		"empty":               {"", "http://127.0.0.1:11434"},
-		"only address":        {"1.2.3.4", "http://1.2.3.4:11434"},
-		"only port":           {":1234", "http://:1234"},
-		"address and port":    {"1.2.3.4:1234", "http://1.2.3.4:1234"},
-		"hostname":            {"example.com", "http://example.com:11434"},
-		"hostname and port":   {"example.com:1234", "http://example.com:1234"},
-		"zero port":           {":0", "http://:0"},
-		"too large port":      {":66000", "http://:11434"},
-		"too small port":      {":-1", "http://:11434"},
-		"ipv6 localhost":      {"[::1]", "http://[::1]:11434"},
-		"ipv6 world open":     {"[::]", "http://[::]:11434"},
-		"ipv6 no brackets":    {"::1", "http://[::1]:11434"},
-		"ipv6 + port":         {"[::1]:1337", "http://[::1]:1337"},
-		"extra space":         {" 1.2.3.4 ", "http://1.2.3.4:11434"},
-		"extra quotes":        {"\"1.2.3.4\"", "http://1.2.3.4:11434"},
-		"extra space+quotes":  {" \" 1.2.3.4 \" ", "http://1.2.3.4:11434"},
-		"extra single quotes": {"'1.2.3.4'", "http://1.2.3.4:11434"},
-		"http":                {"http://1.2.3.4", "http://1.2.3.4:80"},
-		"http port":           {"http://1.2.3.4:4321", "http://1.2.3.4:4321"},
-		"https":               {"https://1.2.3.4", "https://1.2.3.4:443"},
-		"https port":          {"https://1.2.3.4:4321", "https://1.2.3.4:4321"},
-		"proxy path":          {"https://example.com/ollama", "https://example.com:443/ollama"},
+		"empty":                {"", "http://127.0.0.1:11434"},
+		"only address":         {"1.2.3.4", "http://1.2.3.4:11434"},
+		"only port":            {":1234", "http://:1234"},
+		"address and port":     {"1.2.3.4:1234", "http://1.2.3.4:1234"},
+		"hostname":             {"example.com", "http://example.com:11434"},
+		"hostname and port":    {"example.com:1234", "http://example.com:1234"},
+		"zero port":            {":0", "http://:0"},
+		"too large port":       {":66000", "http://:11434"},
+		"too small port":       {":-1", "http://:11434"},
+		"ipv6 localhost":       {"[::1]", "http://[::1]:11434"},
+		"ipv6 world open":      {"[::]", "http://[::]:11434"},
+		"ipv6 no brackets":     {"::1", "http://[::1]:11434"},
+		"ipv6 + port":          {"[::1]:1337", "http://[::1]:1337"},
+		"extra space":          {" 1.2.3.4 ", "http://1.2.3.4:11434"},
+		"extra quotes":         {"\"1.2.3.4\"", "http://1.2.3.4:11434"},
+		"extra space+quotes":   {" \" 1.2.3.4 \" ", "http://1.2.3.4:11434"},
+		"extra single quotes":  {"'1.2.3.4'", "http://1.2.3.4:11434"},
+		"http":                 {"http://1.2.3.4", "http://1.2.3.4:80"},
+		"http port":            {"http://1.2.3.4:4321", "http://1.2.3.4:4321"},
+		"https":                {"https://1.2.3.4", "https://1.2.3.4:443"},
+		"https port":           {"https://1.2.3.4:4321", "https://1.2.3.4:4321"},
+		"proxy path":           {"https://example.com/ollama", "https://example.com:443/ollama"},
+		"unix socket":          {"unix:///run/ollama.sock", "unix:///run/ollama.sock"},
+		"relative unix socket": {"unix://ollama.sock", "unix://ollama.sock"},
 	}
 
 	for name, tt := range cases {
@@ -253,6 +255,46 @@ func TestLoadTimeout(t *testing.T) {
 	}
 }
 
+func TestIdleTimeout(t *testing.T) {
+	cases := map[string]time.Duration{
+		"":    0,
+		"0":   0,
+		"10m": 10 * time.Minute,
+		"90":  90 * time.Second,
+		"-1":  0,
+		"???": 0,
+	}
+
+	for tt, expect := range cases {
+		t.Run(tt, func(t *testing.T) {
+			t.Setenv("OLLAMA_IDLE_TIMEOUT", tt)
+			if actual := IdleTimeout(); actual != expect {
+				t.Errorf("%s: expected %s, got %s", tt, expect, actual)
+			}
+		})
+	}
+}
+
+func TestScrubInterval(t *testing.T) {
+	cases := map[string]time.Duration{
+		"":    0,
+		"0":   0,
+		"24h": 24 * time.Hour,
+		"60":  time.Minute,
+		"-1h": 0,
+		"???": 0,
+	}
+
+	for tt, expect := range cases {
+		t.Run(tt, func(t *testing.T) {
+			t.Setenv("OLLAMA_SCRUB_INTERVAL", tt)
+			if actual := ScrubInterval(); actual != expect {
+				t.Errorf("%s: expected %s, got %s", tt, expect, actual)
+			}
+		})
+	}
+}
+
 func TestVar(t *testing.T) {
 	cases := map[string]string{
 		"value":       "value",
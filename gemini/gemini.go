@@ -0,0 +1,475 @@
+// gemini package provides middleware for partial compatibility with the
+// Google Generative Language (Gemini) REST API
+package gemini
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+type Blob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type FunctionCall struct {
+	Name string         `json:"name"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+type FunctionResponse struct {
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type Part struct {
+	Text             string            `json:"text,omitempty"`
+	InlineData       *Blob             `json:"inlineData,omitempty"`
+	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type Content struct {
+	Role  string `json:"role,omitempty"`
+	Parts []Part `json:"parts"`
+}
+
+type FunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type Tool struct {
+	FunctionDeclarations []FunctionDeclaration `json:"functionDeclarations,omitempty"`
+}
+
+type GenerationConfig struct {
+	StopSequences    []string        `json:"stopSequences,omitempty"`
+	ResponseMimeType string          `json:"responseMimeType,omitempty"`
+	ResponseSchema   json.RawMessage `json:"responseSchema,omitempty"`
+	CandidateCount   *int            `json:"candidateCount,omitempty"`
+	MaxOutputTokens  *int            `json:"maxOutputTokens,omitempty"`
+	Temperature      *float64        `json:"temperature,omitempty"`
+	TopP             *float64        `json:"topP,omitempty"`
+	TopK             *int            `json:"topK,omitempty"`
+	Seed             *int            `json:"seed,omitempty"`
+	PresencePenalty  *float64        `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float64        `json:"frequencyPenalty,omitempty"`
+}
+
+type GenerateContentRequest struct {
+	Contents          []Content         `json:"contents"`
+	SystemInstruction *Content          `json:"systemInstruction,omitempty"`
+	Tools             []Tool            `json:"tools,omitempty"`
+	GenerationConfig  *GenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type Candidate struct {
+	Content      Content `json:"content"`
+	FinishReason string  `json:"finishReason,omitempty"`
+	Index        int     `json:"index"`
+}
+
+type UsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+type GenerateContentResponse struct {
+	Candidates    []Candidate    `json:"candidates"`
+	UsageMetadata *UsageMetadata `json:"usageMetadata,omitempty"`
+	ModelVersion  string         `json:"modelVersion,omitempty"`
+}
+
+func NewError(code int, message string) ErrorResponse {
+	var status string
+	switch code {
+	case http.StatusBadRequest:
+		status = "INVALID_ARGUMENT"
+	case http.StatusNotFound:
+		status = "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		status = "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		status = "UNAVAILABLE"
+	default:
+		status = "INTERNAL"
+	}
+
+	return ErrorResponse{Error{Code: code, Message: message, Status: status}}
+}
+
+// lowerTypes lowercases the types of a schema, which the Gemini API writes
+// in upper case (e.g. "OBJECT") but JSON schema and tools use in lower case
+func lowerTypes(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if s, ok := e.(string); ok && k == "type" {
+				v[k] = strings.ToLower(s)
+			} else {
+				v[k] = lowerTypes(e)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = lowerTypes(e)
+		}
+	}
+
+	return v
+}
+
+func fromSchema(schema json.RawMessage) (json.RawMessage, error) {
+	var v any
+	if err := json.Unmarshal(schema, &v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(lowerTypes(v))
+}
+
+func fromContent(c Content) ([]api.Message, error) {
+	role := c.Role
+	switch role {
+	case "", "user":
+		role = "user"
+	case "model":
+		role = "assistant"
+	default:
+		return nil, fmt.Errorf("invalid role '%s'", c.Role)
+	}
+
+	var messages []api.Message
+	for _, p := range c.Parts {
+		switch {
+		case p.InlineData != nil:
+			if !strings.HasPrefix(p.InlineData.MimeType, "image/") {
+				return nil, fmt.Errorf("unsupported inline data type '%s'", p.InlineData.MimeType)
+			}
+
+			img, err := base64.StdEncoding.DecodeString(p.InlineData.Data)
+			if err != nil {
+				return nil, errors.New("invalid inline data")
+			}
+
+			messages = append(messages, api.Message{Role: role, Images: []api.ImageData{img}})
+		case p.FunctionCall != nil:
+			messages = append(messages, api.Message{Role: role, ToolCalls: []api.ToolCall{{
+				Function: api.ToolCallFunction{Name: p.FunctionCall.Name, Arguments: p.FunctionCall.Args},
+			}}})
+		case p.FunctionResponse != nil:
+			b, err := json.Marshal(p.FunctionResponse.Response)
+			if err != nil {
+				return nil, err
+			}
+
+			messages = append(messages, api.Message{Role: "tool", Content: string(b)})
+		default:
+			messages = append(messages, api.Message{Role: role, Content: p.Text})
+		}
+	}
+
+	return messages, nil
+}
+
+func fromGenerateContentRequest(model string, stream bool, r GenerateContentRequest) (*api.ChatRequest, error) {
+	var messages []api.Message
+	if r.SystemInstruction != nil {
+		var system []string
+		for _, p := range r.SystemInstruction.Parts {
+			system = append(system, p.Text)
+		}
+
+		messages = append(messages, api.Message{Role: "system", Content: strings.Join(system, "\n")})
+	}
+
+	for _, c := range r.Contents {
+		m, err := fromContent(c)
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, m...)
+	}
+
+	var tools []api.Tool
+	for _, t := range r.Tools {
+		for _, fd := range t.FunctionDeclarations {
+			tool := api.Tool{Type: "function"}
+			tool.Function.Name = fd.Name
+			tool.Function.Description = fd.Description
+			if len(fd.Parameters) > 0 {
+				params, err := fromSchema(fd.Parameters)
+				if err != nil {
+					return nil, fmt.Errorf("invalid parameters for function '%s': %w", fd.Name, err)
+				}
+
+				if err := json.Unmarshal(params, &tool.Function.Parameters); err != nil {
+					return nil, fmt.Errorf("invalid parameters for function '%s': %w", fd.Name, err)
+				}
+			}
+
+			tools = append(tools, tool)
+		}
+	}
+
+	options := make(map[string]any)
+	var format json.RawMessage
+	if gc := r.GenerationConfig; gc != nil {
+		if gc.CandidateCount != nil && *gc.CandidateCount > 1 {
+			return nil, errors.New("only one candidate is supported")
+		}
+
+		if len(gc.StopSequences) > 0 {
+			options["stop"] = gc.StopSequences
+		}
+
+		if gc.MaxOutputTokens != nil {
+			options["num_predict"] = *gc.MaxOutputTokens
+		}
+
+		if gc.Temperature != nil {
+			options["temperature"] = *gc.Temperature
+		}
+
+		if gc.TopP != nil {
+			options["top_p"] = *gc.TopP
+		}
+
+		if gc.TopK != nil {
+			options["top_k"] = *gc.TopK
+		}
+
+		if gc.Seed != nil {
+			options["seed"] = *gc.Seed
+		}
+
+		if gc.PresencePenalty != nil {
+			options["presence_penalty"] = *gc.PresencePenalty
+		}
+
+		if gc.FrequencyPenalty != nil {
+			options["frequency_penalty"] = *gc.FrequencyPenalty
+		}
+
+		switch {
+		case len(gc.ResponseSchema) > 0:
+			schema, err := fromSchema(gc.ResponseSchema)
+			if err != nil {
+				return nil, fmt.Errorf("invalid response schema: %w", err)
+			}
+
+			format = schema
+		case gc.ResponseMimeType == "application/json":
+			format = json.RawMessage(`"json"`)
+		}
+	}
+
+	return &api.ChatRequest{
+		Model:    model,
+		Messages: messages,
+		Format:   format,
+		Options:  options,
+		Stream:   &stream,
+		Tools:    tools,
+	}, nil
+}
+
+func toFinishReason(r api.ChatResponse) string {
+	if !r.Done {
+		return ""
+	}
+
+	if r.DoneReason == "length" {
+		return "MAX_TOKENS"
+	}
+
+	return "STOP"
+}
+
+func toGenerateContentResponse(r api.ChatResponse) GenerateContentResponse {
+	var parts []Part
+	if r.Message.Content != "" {
+		parts = append(parts, Part{Text: r.Message.Content})
+	}
+
+	for _, tc := range r.Message.ToolCalls {
+		parts = append(parts, Part{FunctionCall: &FunctionCall{Name: tc.Function.Name, Args: tc.Function.Arguments}})
+	}
+
+	resp := GenerateContentResponse{
+		Candidates: []Candidate{{
+			Content:      Content{Role: "model", Parts: parts},
+			FinishReason: toFinishReason(r),
+		}},
+		ModelVersion: r.Model,
+	}
+
+	if r.Done {
+		resp.UsageMetadata = &UsageMetadata{
+			PromptTokenCount:     r.PromptEvalCount,
+			CandidatesTokenCount: r.EvalCount,
+			TotalTokenCount:      r.PromptEvalCount + r.EvalCount,
+		}
+	}
+
+	return resp
+}
+
+type GenerateContentWriter struct {
+	gin.ResponseWriter
+	stream bool
+
+	// sse streams server-sent events rather than a JSON array
+	sse bool
+
+	// started is set once the first streamed response is written
+	started bool
+}
+
+func (w *GenerateContentWriter) writeError(data []byte) (int, error) {
+	var serr api.StatusError
+	if err := json.Unmarshal(data, &serr); err != nil {
+		return 0, err
+	}
+
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w.ResponseWriter).Encode(NewError(w.ResponseWriter.Status(), serr.Error())); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (w *GenerateContentWriter) writeResponse(data []byte) (int, error) {
+	var chatResponse api.ChatResponse
+	if err := json.Unmarshal(data, &chatResponse); err != nil {
+		return 0, err
+	}
+
+	// model load progress has no equivalent in the gemini api
+	if chatResponse.Load != nil {
+		return len(data), nil
+	}
+
+	d, err := json.Marshal(toGenerateContentResponse(chatResponse))
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case !w.stream:
+		w.ResponseWriter.Header().Set("Content-Type", "application/json")
+		_, err = w.ResponseWriter.Write(d)
+	case w.sse:
+		w.ResponseWriter.Header().Set("Content-Type", "text/event-stream")
+		_, err = fmt.Fprintf(w.ResponseWriter, "data: %s\n\n", d)
+	default:
+		// without alt=sse responses are streamed as the elements of a
+		// JSON array
+		w.ResponseWriter.Header().Set("Content-Type", "application/json")
+		sep := ",\r\n"
+		if !w.started {
+			sep = "["
+		}
+
+		w.started = true
+		if _, err = fmt.Fprintf(w.ResponseWriter, "%s%s", sep, d); err == nil && chatResponse.Done {
+			_, err = w.ResponseWriter.Write([]byte("]"))
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (w *GenerateContentWriter) Write(data []byte) (int, error) {
+	code := w.ResponseWriter.Status()
+	if code != http.StatusOK {
+		return w.writeError(data)
+	}
+
+	return w.writeResponse(data)
+}
+
+// GenerateContentMiddleware translates requests to the route
+// models/*model, where the model is followed by ":generateContent" or
+// ":streamGenerateContent", into chat requests.
+func GenerateContentMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		model, method, ok := cutMethod(strings.TrimPrefix(c.Param("model"), "/"))
+		if !ok || (method != "generateContent" && method != "streamGenerateContent") {
+			c.AbortWithStatusJSON(http.StatusNotFound, NewError(http.StatusNotFound, fmt.Sprintf("unknown method '%s'", method)))
+			return
+		}
+
+		var req GenerateContentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		if len(req.Contents) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, "contents must not be empty"))
+			return
+		}
+
+		stream := method == "streamGenerateContent"
+		chatReq, err := fromGenerateContentRequest(model, stream, req)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(chatReq); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.Request.Body = io.NopCloser(&b)
+		c.Writer = &GenerateContentWriter{
+			ResponseWriter: c.Writer,
+			stream:         stream,
+			sse:            c.Query("alt") == "sse",
+		}
+
+		c.Next()
+	}
+}
+
+// cutMethod splits "llama3.2:latest:generateContent" into the model and the
+// method after its last colon, since model names have colons of their own.
+func cutMethod(s string) (model, method string, ok bool) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return s, "", false
+	}
+
+	return s[:i], s[i+1:], true
+}
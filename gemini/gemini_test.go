@@ -0,0 +1,253 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+var (
+	False = false
+	True  = true
+)
+
+func TestGenerateContentMiddleware(t *testing.T) {
+	type testCase struct {
+		name string
+		path string
+		body string
+		req  api.ChatRequest
+		err  ErrorResponse
+	}
+
+	var capturedRequest *api.ChatRequest
+
+	testCases := []testCase{
+		{
+			name: "generate content",
+			path: "/v1beta/models/test-model:generateContent",
+			body: `{
+				"contents": [{"role": "user", "parts": [{"text": "Hello"}]}]
+			}`,
+			req: api.ChatRequest{
+				Model:    "test-model",
+				Messages: []api.Message{{Role: "user", Content: "Hello"}},
+				Options:  map[string]any{},
+				Stream:   &False,
+			},
+		},
+		{
+			name: "stream generate content with tag and options",
+			path: "/v1beta/models/test-model:latest:streamGenerateContent",
+			body: `{
+				"systemInstruction": {"parts": [{"text": "Be brief."}]},
+				"contents": [
+					{"role": "user", "parts": [{"text": "Hello"}, {"inlineData": {"mimeType": "image/png", "data": "aGVsbG8="}}]},
+					{"role": "model", "parts": [{"text": "Hi"}]},
+					{"parts": [{"text": "Bye"}]}
+				],
+				"generationConfig": {
+					"stopSequences": ["\n"],
+					"maxOutputTokens": 100,
+					"temperature": 0.5,
+					"topP": 0.9,
+					"topK": 20,
+					"seed": 42,
+					"responseMimeType": "application/json",
+					"responseSchema": {"type": "OBJECT", "properties": {"name": {"type": "STRING"}}}
+				}
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model:latest",
+				Messages: []api.Message{
+					{Role: "system", Content: "Be brief."},
+					{Role: "user", Content: "Hello"},
+					{Role: "user", Images: []api.ImageData{[]byte("hello")}},
+					{Role: "assistant", Content: "Hi"},
+					{Role: "user", Content: "Bye"},
+				},
+				Format: json.RawMessage(`{"properties":{"name":{"type":"string"}},"type":"object"}`),
+				Options: map[string]any{
+					"stop":        []any{"\n"},
+					"num_predict": 100.0,
+					"temperature": 0.5,
+					"top_p":       0.9,
+					"top_k":       20.0,
+					"seed":        42.0,
+				},
+				Stream: &True,
+			},
+		},
+		{
+			name: "function calling",
+			path: "/v1beta/models/test-model:generateContent",
+			body: `{
+				"contents": [
+					{"role": "user", "parts": [{"text": "What's the weather in Paris?"}]},
+					{"role": "model", "parts": [{"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}}]},
+					{"role": "user", "parts": [{"functionResponse": {"name": "get_weather", "response": {"temperature": 20}}}]}
+				],
+				"tools": [{"functionDeclarations": [{
+					"name": "get_weather",
+					"description": "Get the weather",
+					"parameters": {"type": "OBJECT", "properties": {"city": {"type": "STRING", "description": "The city"}}, "required": ["city"]}
+				}]}]
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{Role: "user", Content: "What's the weather in Paris?"},
+					{Role: "assistant", ToolCalls: []api.ToolCall{{Function: api.ToolCallFunction{Name: "get_weather", Arguments: map[string]any{"city": "Paris"}}}}},
+					{Role: "tool", Content: `{"temperature":20}`},
+				},
+				Tools: []api.Tool{
+					{
+						Type: "function",
+						Function: api.ToolFunction{
+							Name:        "get_weather",
+							Description: "Get the weather",
+							Parameters: struct {
+								Type       string   `json:"type"`
+								Required   []string `json:"required"`
+								Properties map[string]struct {
+									Type        string   `json:"type"`
+									Description string   `json:"description"`
+									Enum        []string `json:"enum,omitempty"`
+								} `json:"properties"`
+							}{
+								Type:     "object",
+								Required: []string{"city"},
+								Properties: map[string]struct {
+									Type        string   `json:"type"`
+									Description string   `json:"description"`
+									Enum        []string `json:"enum,omitempty"`
+								}{
+									"city": {Type: "string", Description: "The city"},
+								},
+							},
+						},
+					},
+				},
+				Options: map[string]any{},
+				Stream:  &False,
+			},
+		},
+		{
+			name: "unknown method",
+			path: "/v1beta/models/test-model:countTokens",
+			body: `{"contents": [{"parts": [{"text": "Hello"}]}]}`,
+			err:  NewError(http.StatusNotFound, "unknown method 'countTokens'"),
+		},
+		{
+			name: "empty contents",
+			path: "/v1beta/models/test-model:generateContent",
+			body: `{"contents": []}`,
+			err:  NewError(http.StatusBadRequest, "contents must not be empty"),
+		},
+		{
+			name: "several candidates",
+			path: "/v1beta/models/test-model:generateContent",
+			body: `{"contents": [{"parts": [{"text": "Hello"}]}], "generationConfig": {"candidateCount": 2}}`,
+			err:  NewError(http.StatusBadRequest, "only one candidate is supported"),
+		},
+	}
+
+	endpoint := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(GenerateContentMiddleware(), func(c *gin.Context) {
+		bodyBytes, _ := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		if err := json.Unmarshal(bodyBytes, &capturedRequest); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, "failed to unmarshal request")
+		}
+		c.Next()
+	})
+	router.Handle(http.MethodPost, "/v1beta/models/*model", endpoint)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			defer func() { capturedRequest = nil }()
+
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			var errResp ErrorResponse
+			if resp.Code != http.StatusOK {
+				if err := json.Unmarshal(resp.Body.Bytes(), &errResp); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if diff := cmp.Diff(tc.err, errResp); diff != "" {
+				t.Fatalf("errors did not match (-want +got):\n%s", diff)
+			}
+
+			if capturedRequest != nil {
+				if diff := cmp.Diff(&tc.req, capturedRequest); diff != "" {
+					t.Fatalf("requests did not match (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateContentWriter(t *testing.T) {
+	responses := []api.ChatResponse{
+		{Model: "test-model", Message: api.Message{Role: "assistant", Content: "Hel"}},
+		{Model: "test-model", Message: api.Message{Role: "assistant", Content: "lo"}, Done: true, DoneReason: "length", Metrics: api.Metrics{PromptEvalCount: 3, EvalCount: 2}},
+	}
+
+	write := func(stream, sse bool) string {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		w := &GenerateContentWriter{ResponseWriter: c.Writer, stream: stream, sse: sse}
+		for _, r := range responses {
+			b, err := json.Marshal(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := w.Write(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return rec.Body.String()
+	}
+
+	first := `{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]},"index":0}],"modelVersion":"test-model"}`
+	last := `{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},"finishReason":"MAX_TOKENS","index":0}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":2,"totalTokenCount":5},"modelVersion":"test-model"}`
+
+	cases := []struct {
+		name        string
+		stream, sse bool
+		want        string
+	}{
+		{"array", true, false, "[" + first + ",\r\n" + last + "]"},
+		{"sse", true, true, "data: " + first + "\n\ndata: " + last + "\n\n"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := write(tt.stream, tt.sse); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+// Package language detects the language of model responses and describes
+// which scripts a language is written in so generation can be kept to them.
+//
+// Languages are identified by their ISO 639-1 code, such as "en" or "ja".
+// Regional subtags, as in "pt-BR", are ignored.
+package language
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var scripts = map[string][]*unicode.RangeTable{
+	"ar": {unicode.Arabic},
+	"bg": {unicode.Cyrillic},
+	"bn": {unicode.Bengali},
+	"el": {unicode.Greek},
+	"fa": {unicode.Arabic},
+	"he": {unicode.Hebrew},
+	"hi": {unicode.Devanagari},
+	"hy": {unicode.Armenian},
+	"ja": {unicode.Han, unicode.Hiragana, unicode.Katakana},
+	"ka": {unicode.Georgian},
+	"kk": {unicode.Cyrillic},
+	"ko": {unicode.Hangul, unicode.Han},
+	"mr": {unicode.Devanagari},
+	"ne": {unicode.Devanagari},
+	"ru": {unicode.Cyrillic},
+	"sr": {unicode.Cyrillic},
+	"ta": {unicode.Tamil},
+	"te": {unicode.Telugu},
+	"th": {unicode.Thai},
+	"uk": {unicode.Cyrillic},
+	"ur": {unicode.Arabic},
+	"zh": {unicode.Han},
+}
+
+func init() {
+	for _, lang := range []string{
+		"cs", "da", "de", "en", "es", "fi", "fr", "hu", "id", "it",
+		"ms", "nl", "no", "pl", "pt", "ro", "sv", "tl", "tr", "vi",
+	} {
+		scripts[lang] = []*unicode.RangeTable{unicode.Latin}
+	}
+}
+
+// primary returns the primary subtag of lang in lower case.
+func primary(lang string) string {
+	lang, _, _ = strings.Cut(lang, "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	return strings.ToLower(lang)
+}
+
+// Supported reports whether lang is a language known to this package.
+func Supported(lang string) bool {
+	_, ok := scripts[primary(lang)]
+	return ok
+}
+
+// Scripts returns the scripts lang is written in, or nil if lang is not
+// supported.
+func Scripts(lang string) []*unicode.RangeTable {
+	return scripts[primary(lang)]
+}
+
+// InScripts reports whether every letter of s belongs to one of scripts.
+// Letters shared by several scripts, such as the Japanese prolonged sound
+// mark, and text that is not valid UTF-8, such as a token holding part of a
+// character, are accepted.
+func InScripts(s string, scripts []*unicode.RangeTable) bool {
+	for _, r := range s {
+		if r == unicode.ReplacementChar || !unicode.IsLetter(r) || unicode.In(r, unicode.Common, unicode.Inherited) {
+			continue
+		}
+
+		if !unicode.In(r, scripts...) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// detectable are the scripts Detect counts, with the language each one
+// indicates. Han and the kana are resolved separately since Japanese mixes
+// them.
+var detectable = []struct {
+	script *unicode.RangeTable
+	lang   string
+}{
+	{unicode.Latin, ""},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Han, "zh"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Thai, "th"},
+	{unicode.Bengali, "bn"},
+	{unicode.Tamil, "ta"},
+	{unicode.Telugu, "te"},
+	{unicode.Georgian, "ka"},
+	{unicode.Armenian, "hy"},
+}
+
+// stopwords are frequent words that tell apart languages written in Latin
+// script.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "of", "to", "in", "that", "it", "you", "for", "with", "this", "are", "was"},
+	"fr": {"le", "la", "les", "et", "est", "des", "une", "un", "du", "que", "pour", "dans", "pas", "vous"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "mit", "sie", "ich", "auf", "den"},
+	"es": {"el", "los", "las", "y", "es", "una", "del", "que", "por", "para", "con", "se", "como", "está"},
+	"it": {"il", "di", "che", "e", "è", "gli", "della", "per", "una", "non", "sono", "con", "del", "questo"},
+	"pt": {"o", "os", "e", "é", "uma", "do", "da", "que", "não", "para", "com", "em", "se", "você"},
+	"nl": {"de", "het", "een", "en", "is", "van", "niet", "dat", "op", "te", "zijn", "met", "voor", "ik"},
+}
+
+// Detect returns the language s is most likely written in, or "" if s has
+// too few letters to tell.
+func Detect(s string) string {
+	counts := make([]int, len(detectable))
+	var letters int
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+
+		for i, d := range detectable {
+			if unicode.Is(d.script, r) {
+				counts[i]++
+				letters++
+				break
+			}
+		}
+	}
+
+	if letters < 3 {
+		return ""
+	}
+
+	best := 0
+	for i, n := range counts {
+		if n > counts[best] {
+			best = i
+		}
+	}
+
+	switch lang := detectable[best].lang; lang {
+	case "":
+		return detectLatin(s)
+	case "zh":
+		// Japanese is mostly kanji, but any kana rule out Chinese
+		for i, d := range detectable {
+			if d.lang == "ja" && counts[i] > 0 {
+				return "ja"
+			}
+		}
+		return lang
+	case "ru":
+		if strings.ContainsAny(s, "ієїґІЄЇҐ") {
+			return "uk"
+		}
+		return lang
+	case "ar":
+		if strings.ContainsAny(s, "پچژگ") {
+			return "fa"
+		}
+		return lang
+	default:
+		return lang
+	}
+}
+
+// detectLatin returns the language of Latin script text with the most
+// stopwords, defaulting to English.
+func detectLatin(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	best, most := "en", 0
+	for _, lang := range []string{"en", "fr", "de", "es", "it", "pt", "nl"} {
+		var n int
+		for _, w := range words {
+			if slices.Contains(stopwords[lang], w) {
+				n++
+			}
+		}
+
+		if n > most {
+			best, most = lang, n
+		}
+	}
+
+	return best
+}
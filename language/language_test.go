@@ -0,0 +1,63 @@
+package language
+
+import (
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	cases := map[string]string{
+		"":   "",
+		"42": "",
+		"The sky is blue because of the way sunlight is scattered.": "en",
+		"Le ciel est bleu à cause de la diffusion de la lumière.":   "fr",
+		"Der Himmel ist blau, weil das Licht gestreut wird.":        "de",
+		"El cielo es azul por la forma en que se dispersa la luz.":  "es",
+		"空が青いのは、太陽の光が散乱するためです。":                                     "ja",
+		"天空是蓝色的，因为阳光被散射了。":                                          "zh",
+		"하늘이 파란 이유는 빛이 산란되기 때문입니다.":                                 "ko",
+		"Небо голубое из-за рассеяния света.":                       "ru",
+		"Небо блакитне через розсіювання світла.":                   "uk",
+		"السماء زرقاء بسبب تشتت الضوء.":                             "ar",
+	}
+
+	for input, want := range cases {
+		if got := Detect(input); got != want {
+			t.Errorf("Detect(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestInScripts(t *testing.T) {
+	ja := Scripts("ja")
+	cases := []struct {
+		input string
+		want  bool
+	}{
+		{"こんにちは", true},
+		{"コーヒー", true},
+		{"日本語", true},
+		{" 123, ", true},
+		{"\xe3\x81", true},
+		{"hello", false},
+		{"日本 hello", false},
+		{"привет", false},
+	}
+
+	for _, tt := range cases {
+		if got := InScripts(tt.input, ja); got != tt.want {
+			t.Errorf("InScripts(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSupported(t *testing.T) {
+	for _, lang := range []string{"en", "ja", "pt-BR", "ZH_tw"} {
+		if !Supported(lang) {
+			t.Errorf("expected %q to be supported", lang)
+		}
+	}
+
+	if Supported("klingon") {
+		t.Error("expected klingon to be unsupported")
+	}
+}
@@ -68,6 +68,7 @@ struct llama_hparams {
     uint32_t n_expert = 0;
     uint32_t n_expert_used = 0;
     uint32_t n_vocab_type = 0; // for BERT-style token types
+    uint32_t n_cls_out = 1; // number of classifier outputs
     uint32_t n_rel_attn_bkts = 0;
 
     // for WavTokenizer
@@ -47,9 +47,12 @@ package llama
 #cgo linux,arm64,sve CXXFLAGS: -march=armv8.6-a+sve
 #cgo linux,cuda LDFLAGS: -lcuda -lcudart -lcublas -lcublasLt -lpthread -lrt -lresolv
 #cgo linux,rocm LDFLAGS: -lpthread -lrt -lresolv
+#cgo linux,vulkan LDFLAGS: -lggml_vulkan -lvulkan -lpthread -lrt
 #cgo rocm CFLAGS: -DGGML_USE_CUDA -DGGML_USE_HIP -DGGML_CUDA_DMMV_X=32 -DGGML_CUDA_PEER_MAX_BATCH_SIZE=128 -DGGML_CUDA_MMV_Y=1 -DGGML_BUILD=1
 #cgo rocm CXXFLAGS: -DGGML_USE_CUDA -DGGML_USE_HIP -DGGML_CUDA_DMMV_X=32 -DGGML_CUDA_PEER_MAX_BATCH_SIZE=128 -DGGML_CUDA_MMV_Y=1 -DGGML_BUILD=1
 #cgo rocm LDFLAGS: -L${SRCDIR} -lggml_rocm -lhipblas -lamdhip64 -lrocblas
+#cgo vulkan CFLAGS: -DGGML_USE_VULKAN
+#cgo vulkan CXXFLAGS: -DGGML_USE_VULKAN
 #cgo windows CFLAGS: -Wno-discarded-qualifiers -D_WIN32_WINNT=0x602
 #cgo windows CXXFLAGS: -D_WIN32_WINNT=0x602
 #cgo windows LDFLAGS: -lmsvcrt -static-libstdc++ -static-libgcc -static
@@ -59,6 +62,7 @@ package llama
 #cgo windows,arm64 LDFLAGS: -L${SRCDIR}/build/windows-arm64
 #cgo windows,cuda LDFLAGS: -lcuda -lcudart -lcublas -lcublasLt
 #cgo windows,rocm LDFLAGS: -lggml_rocm -lhipblas -lamdhip64 -lrocblas
+#cgo windows,vulkan LDFLAGS: -lggml_vulkan -lvulkan-1
 
 #include <stdlib.h>
 #include "llama.h"
@@ -86,7 +90,9 @@ COMPILER inline get_compiler() {
 import "C"
 
 import (
+	"bufio"
 	_ "embed"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
@@ -241,13 +247,114 @@ func (c *Context) KvCacheDefrag() {
 	C.llama_kv_cache_defrag(c.c)
 }
 
-// Get the embeddings for a sequence id
+// StateSeqSaveFile saves the KV cache of a sequence, and the tokens it was
+// computed from, to a file.
+func (c *Context) StateSeqSaveFile(path string, seqId int, tokens []int) error {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	cTokens := make([]C.llama_token, len(tokens))
+	for i, t := range tokens {
+		cTokens[i] = C.llama_token(t)
+	}
+
+	var tokensPtr *C.llama_token
+	if len(cTokens) > 0 {
+		tokensPtr = &cTokens[0]
+	}
+
+	if C.llama_state_seq_save_file(c.c, cPath, C.llama_seq_id(seqId), tokensPtr, C.size_t(len(cTokens))) == 0 {
+		return fmt.Errorf("failed to save state of sequence %d", seqId)
+	}
+
+	return nil
+}
+
+// StateSeqGetData copies the KV cache of a sequence to memory, so that it
+// can be written with WriteStateSeqFile without holding up decoding.
+func (c *Context) StateSeqGetData(seqId int) ([]byte, error) {
+	size := C.llama_state_seq_get_size(c.c, C.llama_seq_id(seqId))
+	if size == 0 {
+		return nil, fmt.Errorf("failed to get state size of sequence %d", seqId)
+	}
+
+	data := make([]byte, size)
+	if C.llama_state_seq_get_data(c.c, (*C.uint8_t)(unsafe.Pointer(&data[0])), size, C.llama_seq_id(seqId)) == 0 {
+		return nil, fmt.Errorf("failed to get state of sequence %d", seqId)
+	}
+
+	return data, nil
+}
+
+// WriteStateSeqFile writes the state of a sequence copied with
+// StateSeqGetData, and the tokens it was computed from, to a file in the
+// format of StateSeqSaveFile so that it can be loaded with StateSeqLoadFile.
+func WriteStateSeqFile(path string, tokens []int, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	header := []uint32{C.LLAMA_STATE_SEQ_MAGIC, C.LLAMA_STATE_SEQ_VERSION, uint32(len(tokens))}
+	if err := binary.Write(w, binary.NativeEndian, header); err != nil {
+		return err
+	}
+
+	cTokens := make([]int32, len(tokens))
+	for i, t := range tokens {
+		cTokens[i] = int32(t)
+	}
+
+	if err := binary.Write(w, binary.NativeEndian, cTokens); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// StateSeqLoadFile restores the KV cache of a sequence saved with
+// StateSeqSaveFile, replacing its contents, and returns the tokens it was
+// computed from. maxTokens limits the number of tokens that can be loaded.
+func (c *Context) StateSeqLoadFile(path string, seqId int, maxTokens int) ([]int, error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	cTokens := make([]C.llama_token, max(maxTokens, 1))
+	var n C.size_t
+	if C.llama_state_seq_load_file(c.c, cPath, C.llama_seq_id(seqId), &cTokens[0], C.size_t(len(cTokens)), &n) == 0 {
+		return nil, fmt.Errorf("failed to load state of sequence %d", seqId)
+	}
+
+	tokens := make([]int, n)
+	for i := range tokens {
+		tokens[i] = int(cTokens[i])
+	}
+
+	return tokens, nil
+}
+
+// Get the embeddings for a sequence id. For models with a classification
+// head, these are the outputs of the head.
 func (c *Context) GetEmbeddingsSeq(seqId int) []float32 {
 	embeddings := unsafe.Pointer(C.llama_get_embeddings_seq(c.c, C.int(seqId)))
 	if embeddings == nil {
 		return nil
 	}
 
+	if C.llama_pooling_type(c.c) == C.LLAMA_POOLING_TYPE_RANK {
+		return unsafe.Slice((*float32)(embeddings), c.Model().NClsOut())
+	}
+
 	return unsafe.Slice((*float32)(embeddings), c.Model().NEmbd())
 }
 
@@ -260,6 +367,18 @@ func (c *Context) GetEmbeddingsIth(i int) []float32 {
 	return unsafe.Slice((*float32)(embeddings), c.Model().NEmbd())
 }
 
+// GetLogitsIth returns the logits of the i-th output of the last batch. They
+// can be changed to rule out tokens before sampling from them, until the next
+// call to Decode.
+func (c *Context) GetLogitsIth(i int) []float32 {
+	logits := unsafe.Pointer(C.llama_get_logits_ith(c.c, C.int32_t(i)))
+	if logits == nil {
+		return nil
+	}
+
+	return unsafe.Slice((*float32)(logits), c.Model().NumVocab())
+}
+
 type ModelParams struct {
 	NumGpuLayers int
 	MainGpu      int
@@ -340,10 +459,18 @@ func (m *Model) TokenIsEog(token int) bool {
 	return bool(C.llama_token_is_eog(m.c, C.llama_token(token)))
 }
 
+func (m *Model) TokenIsControl(token int) bool {
+	return bool(C.llama_token_is_control(m.c, C.llama_token(token)))
+}
+
 func (m *Model) AddBOSToken() bool {
 	return bool(C.llama_add_bos_token(m.c))
 }
 
+func (m *Model) TokenBOS() int {
+	return int(C.llama_token_bos(m.c))
+}
+
 func (m *Model) ApplyLoraFromFile(context *Context, loraPath string, scale float32, threads int) error {
 	cLoraPath := C.CString(loraPath)
 	defer C.free(unsafe.Pointer(cLoraPath))
@@ -364,6 +491,36 @@ func (m *Model) ApplyLoraFromFile(context *Context, loraPath string, scale float
 	return nil
 }
 
+// LoraAdapter is a LoRA adapter loaded for a model, which can be added to
+// and removed from its contexts without reloading the model.
+type LoraAdapter struct {
+	c *C.struct_llama_lora_adapter
+}
+
+func (m *Model) LoadLoraAdapter(path string) (*LoraAdapter, error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	a := C.llama_lora_adapter_init(m.c, cPath)
+	if a == nil {
+		return nil, errors.New("unable to load lora")
+	}
+
+	return &LoraAdapter{c: a}, nil
+}
+
+func (c *Context) SetLoraAdapter(a *LoraAdapter, scale float32) error {
+	if C.llama_lora_adapter_set(c.c, a.c, C.float(scale)) != 0 {
+		return errors.New("error applying lora")
+	}
+
+	return nil
+}
+
+func (c *Context) RemoveLoraAdapter(a *LoraAdapter) {
+	C.llama_lora_adapter_remove(c.c, a.c)
+}
+
 type Batch struct {
 	c         C.struct_llama_batch
 	batchSize int
@@ -523,6 +680,11 @@ func (m *Model) NEmbd() int {
 	return int(C.llama_n_embd(m.c))
 }
 
+// NClsOut returns the number of outputs of the model's classification head
+func (m *Model) NClsOut() int {
+	return int(C.llama_model_n_cls_out(m.c))
+}
+
 func Quantize(infile, outfile string, ftype uint32) error {
 	cinfile := C.CString(infile)
 	defer C.free(unsafe.Pointer(cinfile))
@@ -674,6 +836,7 @@ type SamplingParams struct {
 	PenalizeNl     bool
 	Seed           uint32
 	Grammar        string
+	LogitBias      map[int]float32
 }
 
 func NewSamplingContext(model *Model, params SamplingParams) (*SamplingContext, error) {
@@ -696,6 +859,22 @@ func NewSamplingContext(model *Model, params SamplingParams) (*SamplingContext,
 	defer C.free(unsafe.Pointer(grammar))
 
 	cparams.grammar = grammar
+
+	if len(params.LogitBias) > 0 {
+		// the biases are copied by the sampler so they can be freed after init
+		biases := unsafe.Slice((*C.llama_logit_bias)(C.malloc(C.size_t(len(params.LogitBias))*C.size_t(unsafe.Sizeof(C.llama_logit_bias{})))), len(params.LogitBias))
+		defer C.free(unsafe.Pointer(&biases[0]))
+
+		var i int
+		for token, bias := range params.LogitBias {
+			biases[i] = C.llama_logit_bias{token: C.llama_token(token), bias: C.float(bias)}
+			i++
+		}
+
+		cparams.logit_bias = &biases[0]
+		cparams.n_logit_bias = C.size_t(len(params.LogitBias))
+	}
+
 	context := &SamplingContext{c: C.common_sampler_cinit(model.c, &cparams)}
 	if context.c == nil {
 		return nil, errors.New("unable to create sampling context")
@@ -714,6 +893,52 @@ func (s *SamplingContext) Sample(llamaContext *Context, idx int) int {
 	return int(C.common_sampler_csample(s.c, llamaContext.c, C.int(idx)))
 }
 
+// SamplerStage is the state of the candidates after a stage of sampling.
+type SamplerStage struct {
+	Name string
+
+	// Candidates is the number of tokens that can still be sampled
+	Candidates int
+
+	// Top are the most likely candidates, most likely first
+	Top []TokenProb
+}
+
+// TokenProb is a candidate token and its probability over the remaining
+// candidates at a stage of sampling.
+type TokenProb struct {
+	Token int
+	Logit float32
+	Prob  float32
+}
+
+// SampleTrace is like Sample but also returns the candidates after each
+// stage of the sampler.
+func (s *SamplingContext) SampleTrace(llamaContext *Context, idx int) (int, []SamplerStage) {
+	var trace C.struct_common_sampler_ctrace
+	token := int(C.common_sampler_csample_trace(s.c, llamaContext.c, C.int(idx), &trace))
+
+	stages := make([]SamplerStage, trace.n_stages)
+	for i := range stages {
+		cs := &trace.stages[i]
+		stages[i] = SamplerStage{
+			Name:       C.GoString(&cs.name[0]),
+			Candidates: int(cs.n_candidates),
+			Top:        make([]TokenProb, cs.n_top),
+		}
+
+		for j := range stages[i].Top {
+			stages[i].Top[j] = TokenProb{
+				Token: int(cs.top_tokens[j]),
+				Logit: float32(cs.top_logits[j]),
+				Prob:  float32(cs.top_probs[j]),
+			}
+		}
+	}
+
+	return token, stages
+}
+
 func (s *SamplingContext) Accept(id int, applyGrammar bool) {
 	C.common_sampler_caccept(s.c, C.llama_token(id), C.bool(applyGrammar))
 }
@@ -736,3 +961,18 @@ func SchemaToGrammar(schema []byte) []byte {
 	}
 	return buf[:n]
 }
+
+// ValidateGrammar returns an error describing why grammar is not a GBNF
+// grammar that can match some output.
+func ValidateGrammar(grammar string) error {
+	cStr := C.CString(grammar)
+	defer C.free(unsafe.Pointer(cStr))
+
+	buf := make([]byte, 256)
+	if C.grammar_validate(cStr, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf))) != 0 {
+		msg, _, _ := strings.Cut(C.GoString((*C.char)(unsafe.Pointer(&buf[0]))), "\n")
+		return errors.New(msg)
+	}
+
+	return nil
+}
@@ -517,6 +517,9 @@ extern "C" {
     // Returns the total number of parameters in the model
     LLAMA_API uint64_t llama_model_n_params(const struct llama_model * model);
 
+    // Returns the number of classifier outputs, which is 1 for models without labels
+    LLAMA_API uint32_t llama_model_n_cls_out(const struct llama_model * model);
+
     // Returns true if the model contains an encoder that requires llama_encode() call
     LLAMA_API bool llama_model_has_encoder(const struct llama_model * model);
 
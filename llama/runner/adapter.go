@@ -0,0 +1,55 @@
+package runner
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/ollama/ollama/llama"
+)
+
+// loadAdapter loads the LoRA adapter at path the first time it is requested.
+// Adapters stay loaded, so switching between them doesn't reload the model's
+// weights. It must be called with s.mu held.
+func (s *Server) loadAdapter(path string) error {
+	if _, ok := s.adapters[path]; ok {
+		return nil
+	}
+
+	slog.Info("loading adapter", "path", path)
+	a, err := s.model.LoadLoraAdapter(path)
+	if err != nil {
+		return fmt.Errorf("adapter %s: %w", path, err)
+	}
+
+	if s.adapters == nil {
+		s.adapters = make(map[string]*llama.LoraAdapter)
+	}
+
+	s.adapters[path] = a
+	return nil
+}
+
+// applyAdapter makes the loaded adapter at path the one applied to the
+// context, in addition to those the model was loaded with. An empty path
+// removes the adapter applied last.
+func (s *Server) applyAdapter(path string) error {
+	if path == s.adapter {
+		return nil
+	}
+
+	if s.adapter != "" {
+		s.lc.RemoveLoraAdapter(s.adapters[s.adapter])
+		s.adapter = ""
+	}
+
+	if path == "" {
+		return nil
+	}
+
+	if err := s.lc.SetLoraAdapter(s.adapters[path], 1.0); err != nil {
+		return fmt.Errorf("adapter %s: %w", path, err)
+	}
+
+	s.adapter = path
+	return nil
+}
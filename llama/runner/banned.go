@@ -0,0 +1,115 @@
+package runner
+
+import (
+	"math"
+	"strings"
+)
+
+// vocabPieces returns the pieces of the tokens of the vocabulary, computed
+// once from the model.
+func (s *Server) vocabPieces() []string {
+	s.piecesOnce.Do(func() {
+		s.pieces = make([]string, s.model.NumVocab())
+		for token := range s.pieces {
+			s.pieces[token] = s.tokenToPiece(token)
+		}
+	})
+
+	return s.pieces
+}
+
+// ruleOut sets the logits of the tokens seq cannot sample next to negative
+// infinity: tokens that started a banned string at the same point, and for
+// the first token of a healed prompt, tokens not starting with the healed
+// text.
+func (s *Server) ruleOut(seq *Sequence) {
+	bans := seq.bans[seq.numGenerated]
+	heal := seq.numGenerated == 0 && seq.heal != ""
+	if len(bans) == 0 && !heal {
+		return
+	}
+
+	logits := s.lc.GetLogitsIth(seq.iBatch)
+	if logits == nil {
+		return
+	}
+
+	for _, token := range bans {
+		logits[token] = float32(math.Inf(-1))
+	}
+
+	if heal {
+		for token, piece := range s.vocabPieces() {
+			if !strings.HasPrefix(piece, seq.heal) {
+				logits[token] = float32(math.Inf(-1))
+			}
+		}
+	}
+}
+
+// pieceAt returns the index of the piece that the byte at index of the
+// joined pieces is in.
+func pieceAt(pieces []string, index int) int {
+	var end int
+	for i, piece := range pieces {
+		end += len(piece)
+		if index < end {
+			return i
+		}
+	}
+
+	return len(pieces) - 1
+}
+
+// backtrack removes the pending tokens of seq from the one the banned string
+// starting at index of its pending output begins in, and bans that token so
+// a different one is sampled in its place. It returns false if the tokens
+// cannot be removed from the cache, in which case the output is kept.
+//
+// The sampler has already accepted the removed tokens, so they still count
+// towards repetition penalties.
+func (s *Server) backtrack(seq *Sequence, index int) bool {
+	k := pieceAt(seq.pendingResponses, index)
+	back := len(seq.pendingResponses) - k
+
+	// the last token sampled has not been added to the cache, so the token
+	// starting the banned string is at pos and the logits it was sampled
+	// from came from the token before it
+	pos := len(seq.cache.Inputs) - back + 1
+	if pos < 1 {
+		return false
+	}
+
+	token := seq.inputs[0].token
+	if back > 1 {
+		token = seq.cache.Inputs[pos].token
+	}
+
+	if !s.lc.KvCacheSeqRm(seq.cache.Id, pos-1, -1) {
+		return false
+	}
+
+	seq.inputs = []input{seq.cache.Inputs[pos-1]}
+	seq.cache.Inputs = seq.cache.Inputs[:pos-1]
+	seq.pendingResponses = seq.pendingResponses[:k]
+	seq.pendingTokens = seq.pendingTokens[:k]
+	if seq.logprobs {
+		seq.pendingLogprobs = seq.pendingLogprobs[:k]
+	}
+	seq.numGenerated -= back
+
+	// bans further on were for text that is no longer there
+	for n := range seq.bans {
+		if n > seq.numGenerated {
+			delete(seq.bans, n)
+		}
+	}
+	seq.bans[seq.numGenerated] = append(seq.bans[seq.numGenerated], token)
+
+	if seq.checkpoint != nil {
+		generated := seq.checkpoint.generated
+		seq.checkpoint.generated = generated[:max(len(generated)-back, 0)]
+	}
+
+	return true
+}
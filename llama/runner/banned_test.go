@@ -0,0 +1,51 @@
+package runner
+
+import "testing"
+
+func TestPieceAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		pieces   []string
+		index    int
+		expected int
+	}{
+		{
+			name:     "First piece",
+			pieces:   []string{"As", " an", " AI"},
+			index:    0,
+			expected: 0,
+		},
+		{
+			name:     "Start of piece",
+			pieces:   []string{"Sure", " as", " an", " AI"},
+			index:    4,
+			expected: 1,
+		},
+		{
+			name:     "Middle of piece",
+			pieces:   []string{"Hello", " there", "!"},
+			index:    8,
+			expected: 1,
+		},
+		{
+			name:     "Last byte",
+			pieces:   []string{"Hello", " there", "!"},
+			index:    11,
+			expected: 2,
+		},
+		{
+			name:     "Empty pieces",
+			pieces:   []string{"Hi", "", "", " you"},
+			index:    2,
+			expected: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pieceAt(tt.pieces, tt.index); got != tt.expected {
+				t.Errorf("pieceAt(%q, %d) = %d, want %d", tt.pieces, tt.index, got, tt.expected)
+			}
+		})
+	}
+}
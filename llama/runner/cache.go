@@ -56,6 +56,9 @@ type InputCacheSlot struct {
 	// Inputs that are stored in the KV cache
 	Inputs []input
 
+	// path of the LoRA adapter the inputs were processed with, if any
+	Adapter string
+
 	// is this cache actively being processed as part of a sequence?
 	InUse bool
 
@@ -63,7 +66,9 @@ type InputCacheSlot struct {
 	lastUsed time.Time
 }
 
-func (c *InputCache) LoadCacheSlot(prompt []input, cachePrompt bool) (*InputCacheSlot, []input, error) {
+// LoadCacheSlot finds a slot for prompt, reusing the inputs in the cache it
+// has in common with a slot processed with the same adapter.
+func (c *InputCache) LoadCacheSlot(prompt []input, adapter string, cachePrompt bool) (*InputCacheSlot, []input, error) {
 	var slot *InputCacheSlot
 	var numPast int
 	var err error
@@ -75,9 +80,9 @@ func (c *InputCache) LoadCacheSlot(prompt []input, cachePrompt bool) (*InputCach
 	// at the cost of worse performance when we miss the input cache (because it causes
 	// GPU L2 cache misses due to spreading out accesses across VRAM).
 	if !c.multiUserCache {
-		slot, numPast, err = c.findLongestCacheSlot(prompt)
+		slot, numPast, err = c.findLongestCacheSlot(prompt, adapter)
 	} else {
-		slot, numPast, err = c.findBestCacheSlot(prompt)
+		slot, numPast, err = c.findBestCacheSlot(prompt, adapter)
 	}
 	if err != nil {
 		return nil, nil, err
@@ -89,6 +94,7 @@ func (c *InputCache) LoadCacheSlot(prompt []input, cachePrompt bool) (*InputCach
 
 	slot.InUse = true
 	slot.lastUsed = time.Now()
+	slot.Adapter = adapter
 
 	if numPast == len(prompt) {
 		// Leave one input to sample so we can get a response
@@ -110,7 +116,7 @@ func (c *InputCache) LoadCacheSlot(prompt []input, cachePrompt bool) (*InputCach
 	return slot, prompt, nil
 }
 
-func (c *InputCache) findLongestCacheSlot(prompt []input) (*InputCacheSlot, int, error) {
+func (c *InputCache) findLongestCacheSlot(prompt []input, adapter string) (*InputCacheSlot, int, error) {
 	longest := -1
 	var longestSlot *InputCacheSlot
 
@@ -119,7 +125,7 @@ func (c *InputCache) findLongestCacheSlot(prompt []input) (*InputCacheSlot, int,
 			continue
 		}
 
-		count := countCommonPrefix(s.Inputs, prompt)
+		count := s.commonPrefix(prompt, adapter)
 		if count > longest {
 			longest = count
 			longestSlot = &c.slots[i]
@@ -133,7 +139,7 @@ func (c *InputCache) findLongestCacheSlot(prompt []input) (*InputCacheSlot, int,
 	return longestSlot, longest, nil
 }
 
-func (c *InputCache) findBestCacheSlot(prompt []input) (*InputCacheSlot, int, error) {
+func (c *InputCache) findBestCacheSlot(prompt []input, adapter string) (*InputCacheSlot, int, error) {
 	oldest := time.Now()
 	var oldestSlot *InputCacheSlot
 
@@ -141,7 +147,7 @@ func (c *InputCache) findBestCacheSlot(prompt []input) (*InputCacheSlot, int, er
 	var longestSlot *InputCacheSlot
 
 	for i, s := range c.slots {
-		count := countCommonPrefix(s.Inputs, prompt)
+		count := s.commonPrefix(prompt, adapter)
 		if count > longest {
 			longest = count
 			longestSlot = &c.slots[i]
@@ -181,6 +187,16 @@ func (c *InputCache) findBestCacheSlot(prompt []input) (*InputCacheSlot, int, er
 	return oldestSlot, longest, nil
 }
 
+// commonPrefix returns the number of inputs of prompt at the start of the
+// slot, none if they were processed with another adapter.
+func (s *InputCacheSlot) commonPrefix(prompt []input, adapter string) int {
+	if s.Adapter != adapter {
+		return 0
+	}
+
+	return countCommonPrefix(s.Inputs, prompt)
+}
+
 func countCommonPrefix(a []input, b []input) int {
 	var count int
 
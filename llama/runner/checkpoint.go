@@ -0,0 +1,201 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// checkpointInterval is the number of tokens generated between checkpoints
+const checkpointInterval = 1024
+
+// checkpointTTL is how long checkpoints of generations that were neither
+// finished nor resumed are kept
+const checkpointTTL = 24 * time.Hour
+
+// checkpoint tracks the progress of a generation that is periodically
+// saved so that it can be resumed. A checkpoint is two files: the KV cache
+// of the sequence and its metadata, which is written last.
+type checkpoint struct {
+	// path of the checkpoint files without their extension
+	path string
+
+	// prompt is a hash of the prompt tokens, used to check that a resumed
+	// request is the same as the one checkpointed
+	prompt string
+
+	// generated are the tokens sampled so far
+	generated []int
+
+	// output is the text sent in responses so far
+	output strings.Builder
+
+	// saved is the number of tokens predicted at the last save
+	saved int
+}
+
+type checkpointMetadata struct {
+	Model     string `json:"model"`
+	Prompt    string `json:"prompt"`
+	NumTokens int    `json:"num_tokens"`
+	Generated []int  `json:"generated"`
+	Output    string `json:"output"`
+}
+
+func newCheckpoint(dir, id string, prompt []input) *checkpoint {
+	sum := sha256.Sum256([]byte(id))
+
+	h := sha256.New()
+	for _, input := range prompt {
+		binary.Write(h, binary.LittleEndian, int32(input.token)) //nolint:errcheck
+	}
+
+	return &checkpoint{
+		path:   filepath.Join(dir, hex.EncodeToString(sum[:])),
+		prompt: hex.EncodeToString(h.Sum(nil)),
+	}
+}
+
+// saveCheckpoint saves the progress of seq. It must only be called when
+// all of the output of seq has been sent and its last sampled token is the
+// only input left to process.
+func (s *Server) saveCheckpoint(seq *Sequence) error {
+	cp := seq.checkpoint
+	if err := os.MkdirAll(filepath.Dir(cp.path), 0o755); err != nil {
+		return err
+	}
+
+	tokens := make([]int, len(seq.cache.Inputs))
+	for i, input := range seq.cache.Inputs {
+		tokens[i] = input.token
+	}
+
+	if err := s.lc.StateSeqSaveFile(cp.path+".kv.tmp", seq.cache.Id, tokens); err != nil {
+		return err
+	}
+
+	bts, err := json.Marshal(checkpointMetadata{
+		Model:     s.modelName,
+		Prompt:    cp.prompt,
+		NumTokens: len(tokens),
+		Generated: cp.generated,
+		Output:    cp.output.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(cp.path+".json.tmp", bts, 0o644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(cp.path+".kv.tmp", cp.path+".kv"); err != nil {
+		return err
+	}
+
+	if err := os.Rename(cp.path+".json.tmp", cp.path+".json"); err != nil {
+		return err
+	}
+
+	cp.saved = seq.numPredicted
+	slog.DebugContext(seq.ctx, "saved checkpoint", "path", cp.path, "tokens", len(tokens), "predicted", seq.numPredicted)
+	return nil
+}
+
+// resumeCheckpoint restores the progress of seq from its checkpoint, if it
+// has one for the same model and prompt, and returns the text generated
+// before it was saved. seq must have its cache slot loaded; prompt are the
+// inputs of seq before that.
+func (s *Server) resumeCheckpoint(seq *Sequence, prompt []input) (string, error) {
+	cp := seq.checkpoint
+
+	bts, err := os.ReadFile(cp.path + ".json")
+	if err != nil {
+		return "", err
+	}
+
+	var m checkpointMetadata
+	if err := json.Unmarshal(bts, &m); err != nil {
+		return "", err
+	}
+
+	switch {
+	case m.Model != s.modelName:
+		return "", errors.New("checkpoint is of a different model")
+	case m.Prompt != cp.prompt:
+		return "", errors.New("checkpoint is of a different prompt")
+	case len(m.Generated) == 0:
+		return "", errors.New("checkpoint has no generated tokens")
+	}
+
+	tokens, err := s.lc.StateSeqLoadFile(cp.path+".kv", seq.cache.Id, s.cache.numCtx)
+	if err == nil && len(tokens) != m.NumTokens {
+		err = fmt.Errorf("checkpoint has %d tokens, expected %d", len(tokens), m.NumTokens)
+	}
+
+	if err != nil {
+		// loading replaces the contents of the cache slot, start over
+		s.lc.KvCacheSeqRm(seq.cache.Id, 0, -1)
+		seq.cache.Inputs = seq.cache.Inputs[:0]
+		seq.inputs = prompt
+		seq.numCachedInputs = 0
+		return "", err
+	}
+
+	seq.cache.Inputs = make([]input, len(tokens))
+	for i, token := range tokens {
+		seq.cache.Inputs[i] = input{token: token}
+	}
+
+	// the last token sampled has not been processed yet
+	seq.inputs = []input{{token: m.Generated[len(m.Generated)-1]}}
+	for _, token := range m.Generated {
+		seq.samplingCtx.Accept(token, true)
+	}
+
+	seq.numPredicted = len(m.Generated)
+	seq.numGenerated = len(m.Generated)
+	seq.numCachedInputs = seq.numPromptInputs
+	seq.generated = slices.Clone(m.Generated)
+
+	cp.generated = m.Generated
+	cp.output.WriteString(m.Output)
+	cp.saved = seq.numPredicted
+
+	return m.Output, nil
+}
+
+// removeCheckpoint removes the checkpoint files of seq, once its generation
+// has finished.
+func (s *Server) removeCheckpoint(seq *Sequence) {
+	for _, ext := range []string{".kv", ".json", ".kv.tmp", ".json.tmp"} {
+		if err := os.Remove(seq.checkpoint.path + ext); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.WarnContext(seq.ctx, "failed to remove checkpoint", "error", err)
+		}
+	}
+}
+
+// pruneCheckpoints removes checkpoints in dir older than checkpointTTL.
+func pruneCheckpoints(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > checkpointTTL {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				slog.Warn("failed to remove expired checkpoint", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	prompt := []input{{token: 1}, {token: 2}, {token: 3}}
+
+	a := newCheckpoint(dir, "job-1", prompt)
+	b := newCheckpoint(dir, "job-1", []input{{token: 1}, {token: 2}, {token: 3}})
+	if a.path != b.path || a.prompt != b.prompt {
+		t.Errorf("expected the same checkpoint for the same id and prompt, got %+v and %+v", a, b)
+	}
+
+	if filepath.Dir(a.path) != dir {
+		t.Errorf("expected checkpoint in %s, got %s", dir, a.path)
+	}
+
+	if c := newCheckpoint(dir, "../job-1", prompt); filepath.Dir(c.path) != dir || c.path == a.path {
+		t.Errorf("expected a distinct checkpoint in %s, got %s", dir, c.path)
+	}
+
+	if c := newCheckpoint(dir, "job-1", prompt[:2]); c.prompt == a.prompt {
+		t.Error("expected a different prompt hash for a different prompt")
+	}
+}
+
+func TestPruneCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"old.json", "old.kv", "new.json", "new.kv"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := time.Now().Add(-2 * checkpointTTL)
+	for _, name := range []string{"old.json", "old.kv"} {
+		if err := os.Chtimes(filepath.Join(dir, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruneCheckpoints(dir)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	if len(names) != 2 || names[0] != "new.json" || names[1] != "new.kv" {
+		t.Errorf("expected only new checkpoints to remain, got %v", names)
+	}
+}
@@ -0,0 +1,92 @@
+package runner
+
+import (
+	"math"
+
+	"github.com/ollama/ollama/api"
+)
+
+// maxTopLogprobs is the largest number of alternatives returned for a token
+const maxTopLogprobs = 20
+
+// tokenProb is the log probability of a token in the vocabulary
+type tokenProb struct {
+	token   int
+	logprob float64
+}
+
+// logSoftmax returns the log probability of token under logits and the n
+// most likely tokens, most likely first.
+func logSoftmax(logits []float32, token, n int) (float64, []tokenProb) {
+	maxLogit := math.Inf(-1)
+	for _, l := range logits {
+		maxLogit = max(maxLogit, float64(l))
+	}
+
+	var sum float64
+	for _, l := range logits {
+		sum += math.Exp(float64(l) - maxLogit)
+	}
+	norm := maxLogit + math.Log(sum)
+
+	// n is small, so the top tokens are kept in a sorted slice
+	top := make([]tokenProb, 0, n+1)
+	for t, l := range logits {
+		if n == 0 {
+			break
+		}
+
+		if len(top) == n && float64(l) <= top[n-1].logprob {
+			continue
+		}
+
+		i := len(top)
+		for i > 0 && top[i-1].logprob < float64(l) {
+			i--
+		}
+
+		top = append(top, tokenProb{})
+		copy(top[i+1:], top[i:])
+		top[i] = tokenProb{token: t, logprob: float64(l)}
+		top = top[:min(len(top), n)]
+	}
+
+	for i := range top {
+		top[i].logprob -= norm
+	}
+
+	return float64(logits[token]) - norm, top
+}
+
+// logprob returns the log probability of token, whose text is piece, and
+// the n most likely alternatives from the logits it was sampled from.
+func (s *Server) logprob(seq *Sequence, token int, piece string, n int) api.Logprob {
+	lp := api.Logprob{TokenLogprob: api.TokenLogprob{Token: piece, Bytes: tokenBytes(piece)}}
+
+	logits := s.lc.GetLogitsIth(seq.iBatch)
+	if logits == nil {
+		return lp
+	}
+
+	var top []tokenProb
+	lp.Logprob, top = logSoftmax(logits, token, n)
+	for _, t := range top {
+		piece := s.tokenToPiece(t.token)
+		lp.TopLogprobs = append(lp.TopLogprobs, api.TokenLogprob{
+			Token:   piece,
+			Logprob: t.logprob,
+			Bytes:   tokenBytes(piece),
+		})
+	}
+
+	return lp
+}
+
+func tokenBytes(piece string) []int {
+	b := make([]int, len(piece))
+	for i := range len(piece) {
+		b[i] = int(piece[i])
+	}
+
+	return b
+}
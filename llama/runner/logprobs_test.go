@@ -0,0 +1,40 @@
+package runner
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLogSoftmax(t *testing.T) {
+	logits := []float32{1, 3, 2, 3, float32(math.Inf(-1))}
+
+	logprob, top := logSoftmax(logits, 2, 3)
+
+	var sum float64
+	for _, l := range logits {
+		sum += math.Exp(float64(l))
+	}
+
+	if want := 2 - math.Log(sum); math.Abs(logprob-want) > 1e-9 {
+		t.Errorf("expected logprob %v, got %v", want, logprob)
+	}
+
+	tokens := []int{1, 3, 2}
+	if len(top) != len(tokens) {
+		t.Fatalf("expected %d top tokens, got %d", len(tokens), len(top))
+	}
+
+	for i, tp := range top {
+		if tp.token != tokens[i] {
+			t.Errorf("expected top token %d to be %d, got %d", i, tokens[i], tp.token)
+		}
+
+		if want := float64(logits[tp.token]) - math.Log(sum); math.Abs(tp.logprob-want) > 1e-9 {
+			t.Errorf("expected top logprob %d to be %v, got %v", i, want, tp.logprob)
+		}
+	}
+
+	if _, top := logSoftmax(logits, 0, 0); len(top) != 0 {
+		t.Errorf("expected no top tokens, got %v", top)
+	}
+}
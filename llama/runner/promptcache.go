@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// minPromptCacheInputs is the shortest prefix worth saving to disk, shorter
+// ones are processed faster than they are loaded
+const minPromptCacheInputs = 256
+
+// promptCache is the KV cache of a prefix of prompts, such as a long system
+// prompt, saved to disk the first time it is processed and loaded by the
+// prompts starting with it that follow, even if the cache slot was reused or
+// the model reloaded since. It is named by the hash of the model and the
+// tokens of the prefix so that any request with the same prefix finds it.
+type promptCache struct {
+	// path of the prompt cache files without their extension
+	path string
+
+	// numInputs is the number of inputs of the prefix
+	numInputs int
+
+	// saved is set once the prefix doesn't need to be saved
+	saved bool
+}
+
+type promptCacheMetadata struct {
+	Model  string `json:"model"`
+	Tokens []int  `json:"tokens"`
+}
+
+// newPromptCache returns the prompt cache for the inputs of prompt that
+// prefix, the text at its beginning, is tokenized to with the LoRA adapter
+// at path adapter applied, or nil if there are too few to be worth caching.
+func (s *Server) newPromptCache(prefix string, prompt []input, adapter string) (*promptCache, error) {
+	inputs, err := s.inputs(prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// the last token of the prefix may be merged with the text after it
+	numInputs := countCommonPrefix(inputs, prompt)
+
+	// leave one input to sample so we can get a response
+	numInputs = min(numInputs, len(prompt)-1)
+	if numInputs < minPromptCacheInputs {
+		return nil, nil
+	}
+
+	h := sha256.New()
+	h.Write([]byte(s.modelName))
+	h.Write([]byte{0})
+	h.Write([]byte(adapter))
+	for _, input := range prompt[:numInputs] {
+		binary.Write(h, binary.LittleEndian, int32(input.token)) //nolint:errcheck
+	}
+
+	return &promptCache{
+		path:      filepath.Join(s.promptCacheDir, hex.EncodeToString(h.Sum(nil))),
+		numInputs: numInputs,
+	}, nil
+}
+
+// restorePromptCache loads the prompt cache of seq into its cache slot, if
+// the slot doesn't already have the prefix. seq must have its cache slot
+// loaded; prompt are the inputs of seq before that.
+func (s *Server) restorePromptCache(seq *Sequence, prompt []input) error {
+	pc := seq.promptCache
+
+	bts, err := os.ReadFile(pc.path + ".json")
+	if err != nil {
+		return err
+	}
+
+	var m promptCacheMetadata
+	if err := json.Unmarshal(bts, &m); err != nil {
+		return err
+	}
+
+	saved := make([]input, len(m.Tokens))
+	for i, token := range m.Tokens {
+		saved[i] = input{token: token}
+	}
+
+	if m.Model != s.modelName || len(saved) != pc.numInputs || countCommonPrefix(saved, prompt) != pc.numInputs {
+		return errors.New("prompt cache is of a different prefix")
+	}
+
+	pc.saved = true
+
+	// mark the prompt cache as used for eviction
+	now := time.Now()
+	os.Chtimes(pc.path+".json", now, now) //nolint:errcheck
+
+	if pc.numInputs <= len(seq.cache.Inputs) {
+		return nil
+	}
+
+	if err := s.loadState(seq, pc.path+".kv", pc.numInputs, pc.numInputs, prompt); err != nil {
+		return err
+	}
+
+	slog.DebugContext(seq.ctx, "restored prompt cache", "path", pc.path, "inputs", pc.numInputs)
+	return nil
+}
+
+// savePromptCache saves the prompt cache of seq, whose cache slot must
+// hold exactly the prefix, and evicts prompt caches if there are more than
+// maxPromptCaches.
+func (s *Server) savePromptCache(seq *Sequence) error {
+	pc := seq.promptCache
+	pc.saved = true
+
+	tokens := make([]int, len(seq.cache.Inputs))
+	for i, input := range seq.cache.Inputs {
+		tokens[i] = input.token
+	}
+
+	if err := s.saveState(seq, pc.path, tokens, promptCacheMetadata{Model: s.modelName, Tokens: tokens}); err != nil {
+		return err
+	}
+
+	slog.DebugContext(seq.ctx, "saved prompt cache", "path", pc.path, "inputs", len(tokens))
+	pruneSessions(filepath.Dir(pc.path), s.maxPromptCaches)
+	return nil
+}
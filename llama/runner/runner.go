@@ -6,7 +6,6 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"log/slog"
 	"net"
 	"net/http"
@@ -14,6 +13,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,7 +23,12 @@ import (
 	"golang.org/x/sync/semaphore"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/language"
 	"github.com/ollama/ollama/llama"
+	"github.com/ollama/ollama/logutil"
+	"github.com/ollama/ollama/sampletrace"
+	"github.com/ollama/ollama/tokenizer"
+	"github.com/ollama/ollama/tracing"
 )
 
 // input is an element of the prompt to process, either
@@ -36,6 +41,10 @@ type input struct {
 }
 
 type Sequence struct {
+	// ctx is the context of the request of the sequence, for its request ID
+	// in logs
+	ctx context.Context //nolint:containedctx
+
 	// batch index
 	iBatch int
 
@@ -51,6 +60,15 @@ type Sequence struct {
 	// tokens that have been generated but not returned yet (e.g. for stop sequences)
 	pendingResponses []string
 
+	// ids of the tokens in pendingResponses
+	pendingTokens []int
+
+	// log probabilities of the tokens in pendingResponses, if requested
+	pendingLogprobs []api.Logprob
+
+	// ids of the generated tokens that have been returned
+	generated []int
+
 	// input cache being used by this sequence
 	cache *InputCacheSlot
 
@@ -59,7 +77,7 @@ type Sequence struct {
 	crossAttention bool
 
 	// channel to send responses over
-	responses chan string
+	responses chan response
 
 	// channel to stop decoding (such as if the remote connection is closed)
 	quit chan bool
@@ -75,12 +93,55 @@ type Sequence struct {
 	// stop sequences
 	stop []string
 
+	// stopTokens are tokens that stop generation when sampled, without
+	// being returned
+	stopTokens []int
+
+	// banned strings, backtracked out of the output when generated
+	banned []string
+
+	// bans are tokens ruled out when sampling, by the number of generated
+	// tokens before them
+	bans map[int][]int
+
+	// heal is the text of the last prompt token when it was removed for
+	// token healing. The first generated token must start with it.
+	heal string
+
+	// number of generated tokens, not counting those backtracked
+	numGenerated int
+
 	// number of inputs to keep at the beginning when shifting context window
 	numKeep int
 
 	// true if an embedding are to be returned instead of text generation
 	embeddingOnly bool
 
+	// path of the LoRA adapter applied to the model for this sequence, if any
+	adapter string
+
+	// logprobs returns the log probability of each token with its response,
+	// and topLogprobs the number of most likely alternatives
+	logprobs    bool
+	topLogprobs int
+
+	// trace records the sampler stages of each token, if tracing is enabled
+	trace *sampletrace.Writer
+
+	// checkpoint saves the progress of the generation, if requested
+	checkpoint *checkpoint
+
+	// session saves the KV cache for the next request of a conversation,
+	// if requested
+	session *session
+
+	// watchdog detects degenerate output, if requested
+	watchdog *watchdog
+
+	// promptCache saves the KV cache of the prefix of the prompt to disk,
+	// if requested
+	promptCache *promptCache
+
 	doneReason string
 
 	// Metrics
@@ -88,25 +149,55 @@ type Sequence struct {
 	startGenerationTime time.Time
 	numDecoded          int
 	numPromptInputs     int
+	numCachedInputs     int
+}
+
+// response is generated text sent to the client
+type response struct {
+	content  string
+	logprobs []api.Logprob
 }
 
 type NewSequenceParams struct {
+	tokens         []int
+	adapter        string
 	numPredict     int
 	stop           []string
+	stopTokens     []int
+	banned         []string
+	tokenHealing   bool
+	logprobs       bool
+	topLogprobs    int
 	numKeep        int
 	samplingParams *llama.SamplingParams
 	embedding      bool
 }
 
-func (s *Server) NewSequence(prompt string, images []ImageData, params NewSequenceParams) (*Sequence, error) {
+func (s *Server) NewSequence(ctx context.Context, prompt string, images []ImageData, params NewSequenceParams) (*Sequence, error) {
 	s.ready.Wait()
 
 	startTime := time.Now()
 
-	inputs, err := s.inputs(prompt, images)
-	if err != nil {
-		return nil, fmt.Errorf("failed to process inputs: %w", err)
-	} else if len(inputs) == 0 {
+	var inputs []input
+	var err error
+	if params.tokens != nil {
+		// token prompts are evaluated as given, without tokenizing or
+		// adding special tokens
+		for _, t := range params.tokens {
+			if t < 0 || t >= s.model.NumVocab() {
+				return nil, fmt.Errorf("invalid token %d", t)
+			}
+
+			inputs = append(inputs, input{token: t})
+		}
+	} else {
+		inputs, err = s.inputs(prompt, images)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process inputs: %w", err)
+		}
+	}
+
+	if len(inputs) == 0 {
 		return nil, errors.New("no input provided")
 	}
 
@@ -126,10 +217,21 @@ func (s *Server) NewSequence(prompt string, images []ImageData, params NewSequen
 		newInputs := inputs[:params.numKeep]
 		newInputs = append(newInputs, inputs[params.numKeep+discard:]...)
 
-		slog.Warn("truncating input prompt", "limit", s.cache.numCtx, "prompt", len(inputs), "keep", params.numKeep, "new", len(newInputs))
+		slog.WarnContext(ctx, "truncating input prompt", "limit", s.cache.numCtx, "prompt", len(inputs), "keep", params.numKeep, "new", len(newInputs))
 		inputs = newInputs
 	}
 
+	// token healing removes the last token of the prompt and has the model
+	// generate it again, which lets it pick a longer token starting with the
+	// same text if the prompt ended partway through one
+	var heal string
+	if params.tokenHealing && len(inputs) > 1 {
+		if last := inputs[len(inputs)-1]; last.embed == nil && !s.model.TokenIsControl(last.token) && !s.model.TokenIsEog(last.token) {
+			heal = s.tokenToPiece(last.token)
+			inputs = inputs[:len(inputs)-1]
+		}
+	}
+
 	var sc *llama.SamplingContext
 	if params.samplingParams != nil {
 		sc, err = llama.NewSamplingContext(s.model, *params.samplingParams)
@@ -144,21 +246,158 @@ func (s *Server) NewSequence(prompt string, images []ImageData, params NewSequen
 	}
 
 	return &Sequence{
+		ctx:                 ctx,
 		inputs:              inputs,
 		numPromptInputs:     len(inputs),
 		startProcessingTime: startTime,
 		numPredict:          params.numPredict,
 		pendingResponses:    make([]string, 0),
-		responses:           make(chan string, 100),
+		responses:           make(chan response, 100),
 		quit:                make(chan bool, 1),
 		embedding:           make(chan []float32, 1),
 		samplingCtx:         sc,
 		embeddingOnly:       params.embedding,
+		adapter:             params.adapter,
 		stop:                params.stop,
+		stopTokens:          params.stopTokens,
+		banned:              params.banned,
+		bans:                make(map[int][]int),
+		heal:                heal,
+		logprobs:            params.logprobs,
+		topLogprobs:         params.topLogprobs,
 		numKeep:             params.numKeep,
 	}, nil
 }
 
+// tokenize converts text to tokens, with the external tokenizer if there is one
+func (s *Server) tokenize(text string, addSpecial bool) ([]int, error) {
+	if s.tokenizer != nil {
+		return s.tokenizer.Encode(text, addSpecial)
+	}
+
+	return s.lc.Model().Tokenize(text, addSpecial, true)
+}
+
+func (s *Server) tokenToPiece(token int) string {
+	if s.tokenizer != nil {
+		if piece, err := s.tokenizer.Decode([]int{token}); err == nil {
+			return piece
+		}
+	}
+
+	return s.model.TokenToPiece(token)
+}
+
+// languageBias is applied to tokens outside the scripts of a requested
+// language. It rules them out in practice while leaving sampling well
+// defined if nothing else is likely.
+const languageBias = -100
+
+// languageBiases returns the logit biases that keep generation to the
+// scripts of lang. They are computed once per language from the vocabulary.
+func (s *Server) languageBiases(lang string) map[int]float32 {
+	s.biasMu.Lock()
+	defer s.biasMu.Unlock()
+
+	if biases, ok := s.biases[lang]; ok {
+		return biases
+	}
+
+	scripts := language.Scripts(lang)
+	if scripts == nil {
+		return nil
+	}
+
+	biases := make(map[int]float32)
+	for token := range s.model.NumVocab() {
+		if s.model.TokenIsEog(token) || s.model.TokenIsControl(token) {
+			continue
+		}
+
+		if !language.InScripts(s.tokenToPiece(token), scripts) {
+			biases[token] = languageBias
+		}
+	}
+
+	if s.biases == nil {
+		s.biases = make(map[string]map[int]float32)
+	}
+	s.biases[lang] = biases
+
+	return biases
+}
+
+// newTrace creates a sampler trace for seq in the trace directory. Tracing
+// is best effort: if the trace can't be created, seq is run without one.
+func (s *Server) newTrace(seq *Sequence, opts Options) *sampletrace.Writer {
+	if err := os.MkdirAll(s.traceDir, 0o755); err != nil {
+		slog.WarnContext(seq.ctx, "failed to create sampler trace directory", "error", err)
+		return nil
+	}
+
+	name := fmt.Sprintf("%s-%d%s", time.Now().UTC().Format("20060102T150405.000000000"), seq.cache.Id, sampletrace.Ext)
+	path := filepath.Join(s.traceDir, name)
+	trace, err := sampletrace.Create(path, sampletrace.Header{
+		Model:        s.modelName,
+		PromptTokens: seq.numPromptInputs,
+		Options: map[string]any{
+			"temperature":       opts.Temperature,
+			"top_k":             opts.TopK,
+			"top_p":             opts.TopP,
+			"min_p":             opts.MinP,
+			"typical_p":         opts.TypicalP,
+			"repeat_last_n":     opts.RepeatLastN,
+			"repeat_penalty":    opts.RepeatPenalty,
+			"presence_penalty":  opts.PresencePenalty,
+			"frequency_penalty": opts.FrequencyPenalty,
+			"mirostat":          opts.Mirostat,
+			"mirostat_tau":      opts.MirostatTau,
+			"mirostat_eta":      opts.MirostatEta,
+			"seed":              opts.Seed,
+		},
+	})
+	if err != nil {
+		slog.WarnContext(seq.ctx, "failed to create sampler trace", "error", err)
+		return nil
+	}
+
+	slog.InfoContext(seq.ctx, "writing sampler trace", "path", path)
+	return trace
+}
+
+// writeTrace appends a sampled token and its sampler stages to the trace of
+// seq. The trace is dropped if it can't be written.
+func (s *Server) writeTrace(seq *Sequence, token int, stages []llama.SamplerStage) {
+	t := sampletrace.Token{
+		Token:  token,
+		Piece:  s.tokenToPiece(token),
+		Stages: make([]sampletrace.Stage, len(stages)),
+	}
+
+	for i, stage := range stages {
+		t.Stages[i] = sampletrace.Stage{
+			Name:       stage.Name,
+			Candidates: stage.Candidates,
+			Top:        make([]sampletrace.Candidate, len(stage.Top)),
+		}
+
+		for j, c := range stage.Top {
+			t.Stages[i].Top[j] = sampletrace.Candidate{
+				Token: c.Token,
+				Piece: s.tokenToPiece(c.Token),
+				Logit: c.Logit,
+				Prob:  c.Prob,
+			}
+		}
+	}
+
+	if err := seq.trace.Write(t); err != nil {
+		slog.WarnContext(seq.ctx, "failed to write sampler trace", "error", err)
+		seq.trace.Close()
+		seq.trace = nil
+	}
+}
+
 // inputs processes the prompt and images into a list of inputs
 // by splitting the prompt on [img-<n>] tags, tokenizing text and
 // generating image embeddings for each image
@@ -177,7 +416,7 @@ func (s *Server) inputs(prompt string, images []ImageData) ([]input, error) {
 
 	for i, part := range parts {
 		// text - tokenize
-		tokens, err := s.lc.Model().Tokenize(part, i == 0, true)
+		tokens, err := s.tokenize(part, i == 0)
 		if err != nil {
 			return nil, err
 		}
@@ -227,12 +466,42 @@ type Server struct {
 	// image model context for multi-modal models
 	image *ImageContext
 
+	// external tokenizer used in place of the model's own, if any
+	tokenizer tokenizer.Tokenizer
+
+	// name of the model file, recorded in sampler traces
+	modelName string
+
+	// directory to write sampler traces to, if any
+	traceDir string
+
+	// directory to save checkpoints of long generations to, if any
+	checkpointDir string
+
+	// directory to save the KV cache of sessions to, if any, and the most
+	// sessions kept there
+	sessionDir  string
+	maxSessions int
+
+	// serializes writing sessions, which happens outside of mu
+	sessionMu sync.Mutex
+
+	// directory to save the KV cache of prompt prefixes to, if any, and the
+	// most prompt caches kept there
+	promptCacheDir  string
+	maxPromptCaches int
+
 	// status for external health reporting - loading, ready to serve, etc.
 	status ServerStatus
 
 	// current progress on loading the model
 	progress float32
 
+	// current step of loading the model, set while loading and read by
+	// the health handler
+	stageMu sync.Mutex
+	stage   string
+
 	// number of simultaneous requests to handle
 	parallel int
 
@@ -240,6 +509,14 @@ type Server struct {
 	// TODO (jmorganca): make this n_batch
 	batchSize int
 
+	// logit biases keeping generation to the scripts of a language, by language
+	biasMu sync.Mutex
+	biases map[string]map[int]float32
+
+	// pieces of the tokens of the vocabulary, for token healing
+	piecesOnce sync.Once
+	pieces     []string
+
 	// protects access to everything below this line
 	// this is context state needed for decoding
 	mu sync.Mutex
@@ -262,6 +539,11 @@ type Server struct {
 
 	// next sequence for prompt processing to avoid starvation
 	nextSeq int
+
+	// LoRA adapters requested by sequences, by path, and the one currently
+	// applied to the context
+	adapters map[string]*llama.LoraAdapter
+	adapter  string
 }
 
 func (s *Server) allNil() bool {
@@ -276,6 +558,10 @@ func (s *Server) allNil() bool {
 func flushPending(seq *Sequence) bool {
 	joined := strings.Join(seq.pendingResponses, "")
 	seq.pendingResponses = []string{}
+	seq.generated = append(seq.generated, seq.pendingTokens...)
+	seq.pendingTokens = nil
+	logprobs := seq.pendingLogprobs
+	seq.pendingLogprobs = nil
 
 	// Check if there are any partial UTF-8 characters remaining.
 	// We already check and queue as we are generating but some may
@@ -287,12 +573,15 @@ func flushPending(seq *Sequence) bool {
 		joined = joined[:len(joined)-1]
 	}
 
-	if len(joined) == 0 {
+	if len(joined) == 0 && len(logprobs) == 0 {
 		return true
 	}
 
 	select {
-	case seq.responses <- joined:
+	case seq.responses <- response{content: joined, logprobs: logprobs}:
+		if seq.checkpoint != nil {
+			seq.checkpoint.output.WriteString(joined)
+		}
 		return true
 	case <-seq.quit:
 		return false
@@ -304,6 +593,20 @@ func (s *Server) removeSequence(seqIndex int, reason string) {
 
 	flushPending(seq)
 	seq.doneReason = reason
+	finished := reason == "stop" || reason == "limit" || reason == "degenerate"
+	if seq.checkpoint != nil && finished {
+		s.removeCheckpoint(seq)
+	}
+	if seq.session != nil && finished {
+		if err := s.saveSession(seq); err != nil {
+			slog.WarnContext(seq.ctx, "failed to save session", "error", err)
+		}
+	}
+	if seq.trace != nil {
+		if err := seq.trace.Close(); err != nil {
+			slog.WarnContext(seq.ctx, "failed to write sampler trace", "error", err)
+		}
+	}
 	close(seq.responses)
 	close(seq.embedding)
 	seq.cache.InUse = false
@@ -367,6 +670,11 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 	var batch *llama.Batch
 	crossAttention := false
 
+	// the adapter applies to the whole batch, so sequences using another
+	// one wait for the next batch
+	var adapter *string
+	var deferred bool
+
 	seqIdx := s.nextSeq - 1
 	for range s.seqs {
 		seqIdx = (seqIdx + 1) % len(s.seqs)
@@ -376,13 +684,39 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 			continue
 		}
 
+		// stop as soon as the client is gone rather than finishing the
+		// prompt or waiting for the next token to be sent
+		select {
+		case <-seq.quit:
+			s.removeSequence(seqIdx, "connection")
+			continue
+		default:
+		}
+
 		// if past the num predict limit
 		if seq.numPredict > 0 && seq.numPredicted >= seq.numPredict {
 			s.removeSequence(seqIdx, "limit")
 			continue
 		}
 
+		if len(seq.inputs) > 0 {
+			if adapter == nil {
+				adapter = &seq.adapter
+			} else if seq.adapter != *adapter {
+				if !deferred {
+					s.nextSeq = seqIdx
+					deferred = true
+				}
+				continue
+			}
+		}
+
 		for i, input := range seq.inputs {
+			// the cache slot must hold exactly the prefix when it is saved
+			if pc := seq.promptCache; pc != nil && !pc.saved && len(seq.cache.Inputs)+len(seq.pendingInputs) == pc.numInputs {
+				break
+			}
+
 			if len(seq.cache.Inputs)+len(seq.pendingInputs)+1 > s.cache.numCtx {
 				if len(seq.pendingInputs) == 0 {
 					err := s.cache.ShiftCacheSlot(seq.cache, seq.numKeep)
@@ -431,6 +765,10 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 
 	s.lc.SetCrossAttention(crossAttention)
 
+	if err := s.applyAdapter(*adapter); err != nil {
+		return err
+	}
+
 	err := s.lc.Decode(batch)
 	if err != nil {
 		return fmt.Errorf("failed to decode batch: %w", err)
@@ -454,6 +792,12 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 			seq.pendingInputs = []input{}
 		}
 
+		if pc := seq.promptCache; pc != nil && !pc.saved && len(seq.cache.Inputs) == pc.numInputs {
+			if err := s.savePromptCache(seq); err != nil {
+				slog.WarnContext(seq.ctx, "failed to save prompt cache", "error", err)
+			}
+		}
+
 		// don't sample prompt processing
 		if len(seq.inputs) != 0 {
 			continue
@@ -476,15 +820,41 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 			continue
 		}
 
+		s.ruleOut(seq)
+
+		var h float64
+		if seq.watchdog != nil {
+			if logits := s.lc.GetLogitsIth(seq.iBatch); logits != nil {
+				h = entropy(logits)
+			}
+		}
+
 		// sample a token
-		token := seq.samplingCtx.Sample(s.lc, seq.iBatch)
+		var token int
+		if seq.trace != nil {
+			var stages []llama.SamplerStage
+			token, stages = seq.samplingCtx.SampleTrace(s.lc, seq.iBatch)
+			s.writeTrace(seq, token, stages)
+		} else {
+			token = seq.samplingCtx.Sample(s.lc, seq.iBatch)
+		}
 		seq.samplingCtx.Accept(token, true)
-		piece := s.model.TokenToPiece(token)
+		piece := s.tokenToPiece(token)
+		if seq.numGenerated == 0 {
+			// the healed text is already part of the prompt
+			piece = strings.TrimPrefix(piece, seq.heal)
+		}
+
+		var logprob api.Logprob
+		if seq.logprobs {
+			logprob = s.logprob(seq, token, piece, seq.topLogprobs)
+		}
 
 		seq.numPredicted++
+		seq.numGenerated++
 
 		// if it's an end of sequence token, break
-		if s.model.TokenIsEog(token) {
+		if s.model.TokenIsEog(token) || slices.Contains(seq.stopTokens, token) {
 			// TODO (jmorganca): we should send this back
 			// as it's important for the /api/generate context
 			// seq.responses <- piece
@@ -493,19 +863,51 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 			continue
 		}
 
+		if seq.watchdog != nil {
+			if degenerate, repeated := seq.watchdog.observe(token, h); degenerate {
+				var sb strings.Builder
+				for _, t := range repeated {
+					sb.WriteString(s.tokenToPiece(t))
+				}
+				seq.watchdog.detected.Repeated = sb.String()
+				slog.WarnContext(seq.ctx, "degenerate output", "kind", seq.watchdog.detected.Kind, "at", seq.watchdog.detected.At, "repeated", seq.watchdog.detected.Repeated)
+			}
+		}
+
 		seq.inputs = []input{{token: token}}
+		if seq.checkpoint != nil {
+			seq.checkpoint.generated = append(seq.checkpoint.generated, token)
+		}
 
 		seq.pendingResponses = append(seq.pendingResponses, piece)
+		seq.pendingTokens = append(seq.pendingTokens, token)
+		if seq.logprobs {
+			seq.pendingLogprobs = append(seq.pendingLogprobs, logprob)
+		}
 		sequence := strings.Join(seq.pendingResponses, "")
 
+		if ok, banned := findStop(sequence, seq.banned); ok && s.backtrack(seq, strings.Index(sequence, banned)) {
+			slog.DebugContext(seq.ctx, "backtracking banned string", "banned", banned)
+			continue
+		}
+
 		if ok, stop := findStop(sequence, seq.stop); ok {
-			slog.Debug("hit stop token", "pending", seq.pendingResponses, "stop", stop)
+			slog.DebugContext(seq.ctx, "hit stop token", "pending", seq.pendingResponses, "stop", stop)
 
 			var tokenTruncated bool
 			origLen := len(seq.pendingResponses)
 			seq.pendingResponses, tokenTruncated = truncateStop(seq.pendingResponses, stop)
 			newLen := len(seq.pendingResponses)
 
+			// a token only partly returned isn't counted as generated
+			seq.pendingTokens = seq.pendingTokens[:newLen]
+			if tokenTruncated {
+				seq.pendingTokens = seq.pendingTokens[:newLen-1]
+			}
+			if seq.logprobs {
+				seq.pendingLogprobs = seq.pendingLogprobs[:newLen]
+			}
+
 			// Update the cache based on the tokens that will be returned:
 			// - We have 1 token more than is currently in the cache because
 			// the last one generated wasn't submitted to Decode
@@ -524,7 +926,7 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 			continue
 		}
 
-		if containsStopSuffix(sequence, seq.stop) {
+		if containsStopSuffix(sequence, seq.stop) || containsStopSuffix(sequence, seq.banned) {
 			continue
 		}
 
@@ -534,6 +936,21 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 
 		if !flushPending(seq) {
 			s.removeSequence(i, "connection")
+			continue
+		}
+
+		// degenerate output is returned up to where it was detected, which
+		// may have been held back until now
+		if seq.watchdog != nil && seq.watchdog.stop && seq.watchdog.detected != nil {
+			s.removeSequence(i, "degenerate")
+			continue
+		}
+
+		if seq.checkpoint != nil && seq.numPredicted-seq.checkpoint.saved >= checkpointInterval {
+			if err := s.saveCheckpoint(seq); err != nil {
+				slog.WarnContext(seq.ctx, "failed to save checkpoint", "error", err)
+				seq.checkpoint.saved = seq.numPredicted
+			}
 		}
 	}
 
@@ -562,6 +979,15 @@ type Options struct {
 	MirostatTau      float32  `json:"mirostat_tau"`
 	MirostatEta      float32  `json:"mirostat_eta"`
 	Stop             []string `json:"stop"`
+	StopTokens       []string `json:"stop_tokens"`
+	Language         string   `json:"language"`
+	DetectLanguage   bool     `json:"detect_language"`
+	Mirror           bool     `json:"mirror"`
+	BannedStrings    []string `json:"banned_strings"`
+	TokenHealing     bool     `json:"token_healing"`
+	FirstTokenSLO    int      `json:"first_token_slo"`
+	Watchdog         string   `json:"watchdog"`
+	WatchdogWindow   int      `json:"watchdog_window"`
 }
 
 type ImageData struct {
@@ -575,6 +1001,26 @@ type CompletionRequest struct {
 	Images      []ImageData `json:"image_data"`
 	Grammar     string      `json:"grammar"`
 	CachePrompt bool        `json:"cache_prompt"`
+	Checkpoint  string      `json:"checkpoint"`
+	Session     string      `json:"session"`
+
+	// CachePrefix is the text at the beginning of Prompt whose KV cache is
+	// saved to disk for other prompts starting with it
+	CachePrefix string `json:"cache_prefix"`
+
+	// Tokens is a prompt of token ids, evaluated in place of Prompt
+	Tokens []int `json:"tokens"`
+
+	// ReturnTokens returns the generated token ids with the final response
+	ReturnTokens bool `json:"return_tokens"`
+
+	// Adapter is the path of a LoRA adapter applied for this request only
+	Adapter string `json:"adapter"`
+
+	// Logprobs returns the log probability of each generated token, with
+	// the TopLogprobs most likely alternatives
+	Logprobs    bool `json:"logprobs"`
+	TopLogprobs int  `json:"top_logprobs"`
 
 	Options
 }
@@ -584,20 +1030,30 @@ type Timings struct {
 	PredictedMS float64 `json:"predicted_ms"`
 	PromptN     int     `json:"prompt_n"`
 	PromptMS    float64 `json:"prompt_ms"`
+
+	// PromptCachedN is the number of prompt inputs reused from the cache
+	PromptCachedN int `json:"prompt_cached_n,omitempty"`
 }
 
 type CompletionResponse struct {
-	Content string `json:"content"`
-	Stop    bool   `json:"stop"`
+	Content  string        `json:"content"`
+	Logprobs []api.Logprob `json:"logprobs,omitempty"`
+	Stop     bool          `json:"stop"`
 
 	Model        string  `json:"model,omitempty"`
 	Prompt       string  `json:"prompt,omitempty"`
 	StoppedLimit bool    `json:"stopped_limit,omitempty"`
+	Tokens       []int   `json:"tokens,omitempty"`
 	PredictedN   int     `json:"predicted_n,omitempty"`
 	PredictedMS  float64 `json:"predicted_ms,omitempty"`
 	PromptN      int     `json:"prompt_n,omitempty"`
 	PromptMS     float64 `json:"prompt_ms,omitempty"`
 
+	// StoppedDegenerate is set if the watchdog stopped generation, and
+	// Degenerate describes the degenerate output it detected
+	StoppedDegenerate bool              `json:"stopped_degenerate,omitempty"`
+	Degenerate        *api.Degeneration `json:"degenerate,omitempty"`
+
 	Timings Timings `json:"timings"`
 }
 
@@ -609,6 +1065,10 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	r = r.WithContext(logutil.WithRequestID(r.Context(), r.Header.Get(logutil.RequestIDHeader)))
+	ctx, span := tracing.StartServer(r, "runner.completion")
+	defer span.End()
+
 	// Set the headers to indicate streaming
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Transfer-Encoding", "chunked")
@@ -634,10 +1094,43 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 	samplingParams.MirostatEta = req.MirostatEta
 	samplingParams.Seed = uint32(req.Seed)
 	samplingParams.Grammar = req.Grammar
+	if req.Language != "" {
+		samplingParams.LogitBias = s.languageBiases(req.Language)
+	}
+
+	// the grammar state cannot be rolled back, and the grammar constrains the
+	// output from its start rather than the healed text of the prompt
+	if req.Grammar != "" && len(req.BannedStrings) > 0 {
+		http.Error(w, "banned strings cannot be used with a format", http.StatusBadRequest)
+		return
+	}
 
-	seq, err := s.NewSequence(req.Prompt, req.Images, NewSequenceParams{
+	if req.Adapter != "" {
+		s.mu.Lock()
+		err := s.loadAdapter(req.Adapter)
+		s.mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	stopTokens, err := s.stopTokens(req.StopTokens)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	seq, err := s.NewSequence(ctx, req.Prompt, req.Images, NewSequenceParams{
+		tokens:         req.Tokens,
+		adapter:        req.Adapter,
 		numPredict:     req.NumPredict,
 		stop:           req.Stop,
+		stopTokens:     stopTokens,
+		banned:         req.BannedStrings,
+		tokenHealing:   req.TokenHealing && req.Grammar == "",
+		logprobs:       req.Logprobs,
+		topLogprobs:    min(max(req.TopLogprobs, 0), maxTopLogprobs),
 		numKeep:        req.NumKeep,
 		samplingParams: &samplingParams,
 		embedding:      false,
@@ -648,27 +1141,70 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Ensure there is a place to put the sequence, released when removed from s.seqs
+	waitStart := time.Now()
 	if err := s.seqsSem.Acquire(r.Context(), 1); err != nil {
 		if errors.Is(err, context.Canceled) {
-			slog.Info("aborting completion request due to client closing the connection")
+			slog.InfoContext(ctx, "aborting completion request due to client closing the connection")
 		} else {
-			slog.Error("Failed to acquire semaphore", "error", err)
+			slog.ErrorContext(ctx, "Failed to acquire semaphore", "error", err)
 		}
 		return
 	}
+	waitEnd := time.Now()
+	tracing.Record(ctx, "wait for slot", waitStart, waitEnd)
 
 	s.mu.Lock()
 	found := false
 	for i, sq := range s.seqs {
 		if sq == nil {
-			seq.cache, seq.inputs, err = s.cache.LoadCacheSlot(seq.inputs, req.CachePrompt)
+			prompt := seq.inputs
+			seq.cache, seq.inputs, err = s.cache.LoadCacheSlot(seq.inputs, seq.adapter, req.CachePrompt)
 			if err != nil {
 				s.mu.Unlock()
 				http.Error(w, fmt.Sprintf("Failed to load cache: %v", err), http.StatusInternalServerError)
 				return
 			}
+			seq.numCachedInputs = seq.numPromptInputs - len(seq.inputs)
+
+			if s.promptCacheDir != "" && req.CachePrefix != "" && len(req.Images) == 0 {
+				seq.promptCache, err = s.newPromptCache(req.CachePrefix, prompt, seq.adapter)
+				if err != nil {
+					slog.WarnContext(ctx, "not caching prompt prefix", "error", err)
+				} else if seq.promptCache != nil {
+					if err := s.restorePromptCache(seq, prompt); err != nil && !errors.Is(err, os.ErrNotExist) {
+						slog.WarnContext(ctx, "not restoring prompt cache", "error", err)
+					}
+				}
+			}
+
+			if s.sessionDir != "" && req.Session != "" && len(req.Images) == 0 {
+				seq.session = newSession(s.sessionDir, req.Session)
+				if err := s.restoreSession(seq, prompt); err != nil && !errors.Is(err, os.ErrNotExist) {
+					slog.WarnContext(ctx, "not restoring session", "error", err)
+				}
+			}
+
+			if s.checkpointDir != "" && req.Checkpoint != "" && len(req.Images) == 0 {
+				seq.checkpoint = newCheckpoint(s.checkpointDir, req.Checkpoint, prompt)
+				if output, err := s.resumeCheckpoint(seq, prompt); err == nil {
+					slog.InfoContext(ctx, "resuming generation from checkpoint", "predicted", seq.numPredicted)
+					seq.responses <- response{content: output}
+				} else if !errors.Is(err, os.ErrNotExist) {
+					slog.WarnContext(ctx, "not resuming generation from checkpoint", "error", err)
+				}
+			}
+
+			// the prefix is only saved when it is processed
+			if pc := seq.promptCache; pc != nil && len(seq.cache.Inputs) >= pc.numInputs {
+				pc.saved = true
+			}
 
 			seq.crossAttention = s.image.NeedCrossAttention(seq.cache.Inputs...)
+			seq.watchdog = newWatchdog(req.Watchdog, req.WatchdogWindow)
+
+			if s.traceDir != "" {
+				seq.trace = s.newTrace(seq, req.Options)
+			}
 
 			s.seqs[i] = seq
 			s.cond.Signal()
@@ -688,10 +1224,11 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 		case <-r.Context().Done():
 			close(seq.quit)
 			return
-		case content, ok := <-seq.responses:
+		case resp, ok := <-seq.responses:
 			if ok {
 				if err := json.NewEncoder(w).Encode(&CompletionResponse{
-					Content: content,
+					Content:  resp.content,
+					Logprobs: resp.logprobs,
 				}); err != nil {
 					http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
 					close(seq.quit)
@@ -701,14 +1238,40 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 				flusher.Flush()
 			} else {
 				// Send the final response
+				var tokens []int
+				if req.ReturnTokens {
+					tokens = seq.generated
+				}
+
+				var degenerate *api.Degeneration
+				if seq.watchdog != nil {
+					degenerate = seq.watchdog.detected
+				}
+
+				span.SetAttributes(
+					tracing.Int("prompt_eval_count", seq.numPromptInputs),
+					tracing.Int("prompt_cache_count", seq.numCachedInputs),
+					tracing.Int("eval_count", seq.numDecoded),
+					tracing.String("done_reason", seq.doneReason),
+				)
+
+				if !seq.startGenerationTime.IsZero() {
+					tracing.Record(ctx, "prompt eval", waitEnd, seq.startGenerationTime, tracing.Int("tokens", seq.numPromptInputs-seq.numCachedInputs))
+					tracing.Record(ctx, "generate", seq.startGenerationTime, time.Now(), tracing.Int("tokens", seq.numDecoded))
+				}
+
 				if err := json.NewEncoder(w).Encode(&CompletionResponse{
-					Stop:         true,
-					StoppedLimit: seq.doneReason == "limit",
+					Stop:              true,
+					StoppedLimit:      seq.doneReason == "limit",
+					StoppedDegenerate: seq.doneReason == "degenerate",
+					Degenerate:        degenerate,
+					Tokens:            tokens,
 					Timings: Timings{
-						PromptN:     seq.numPromptInputs,
-						PromptMS:    float64(seq.startGenerationTime.Sub(seq.startProcessingTime).Milliseconds()),
-						PredictedN:  seq.numDecoded,
-						PredictedMS: float64(time.Since(seq.startGenerationTime).Milliseconds()),
+						PromptN:       seq.numPromptInputs,
+						PromptMS:      float64(seq.startGenerationTime.Sub(seq.startProcessingTime).Milliseconds()),
+						PromptCachedN: seq.numCachedInputs,
+						PredictedN:    seq.numDecoded,
+						PredictedMS:   float64(time.Since(seq.startGenerationTime).Milliseconds()),
 					},
 				}); err != nil {
 					http.Error(w, fmt.Sprintf("failed to encode final response: %v", err), http.StatusInternalServerError)
@@ -721,8 +1284,9 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 }
 
 type EmbeddingRequest struct {
-	Content     string `json:"content"`
-	CachePrompt bool   `json:"cache_prompt"`
+	Content     string      `json:"content"`
+	Images      []ImageData `json:"image_data"`
+	CachePrompt bool        `json:"cache_prompt"`
 }
 
 type EmbeddingResponse struct {
@@ -738,9 +1302,10 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
-	slog.Debug("embedding request", "content", req.Content)
+	ctx := logutil.WithRequestID(r.Context(), r.Header.Get(logutil.RequestIDHeader))
+	slog.DebugContext(ctx, "embedding request", "content", req.Content)
 
-	seq, err := s.NewSequence(req.Content, nil, NewSequenceParams{embedding: true})
+	seq, err := s.NewSequence(ctx, req.Content, req.Images, NewSequenceParams{embedding: true})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create new sequence: %v", err), http.StatusInternalServerError)
 		return
@@ -749,9 +1314,9 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 	// Ensure there is a place to put the sequence, released when removed from s.seqs
 	if err := s.seqsSem.Acquire(r.Context(), 1); err != nil {
 		if errors.Is(err, context.Canceled) {
-			slog.Info("aborting embeddings request due to client closing the connection")
+			slog.InfoContext(ctx, "aborting embeddings request due to client closing the connection")
 		} else {
-			slog.Error("Failed to acquire semaphore", "error", err)
+			slog.ErrorContext(ctx, "Failed to acquire semaphore", "error", err)
 		}
 		return
 	}
@@ -760,7 +1325,7 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 	found := false
 	for i, sq := range s.seqs {
 		if sq == nil {
-			seq.cache, seq.inputs, err = s.cache.LoadCacheSlot(seq.inputs, req.CachePrompt)
+			seq.cache, seq.inputs, err = s.cache.LoadCacheSlot(seq.inputs, "", req.CachePrompt)
 			if err != nil {
 				s.mu.Unlock()
 				http.Error(w, fmt.Sprintf("Failed to load cache: %v", err), http.StatusInternalServerError)
@@ -779,7 +1344,13 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	embedding := <-seq.embedding
+	var embedding []float32
+	select {
+	case <-r.Context().Done():
+		close(seq.quit)
+		return
+	case embedding = <-seq.embedding:
+	}
 
 	if err := json.NewEncoder(w).Encode(&EmbeddingResponse{
 		Embedding: embedding,
@@ -791,6 +1362,7 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 type HealthResponse struct {
 	Status   string  `json:"status"`
 	Progress float32 `json:"progress"`
+	Stage    string  `json:"stage,omitempty"`
 }
 
 type ServerStatus int
@@ -812,11 +1384,22 @@ func (s ServerStatus) ToString() string {
 	}
 }
 
+func (s *Server) setStage(stage string) {
+	s.stageMu.Lock()
+	defer s.stageMu.Unlock()
+	s.stage = stage
+}
+
 func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	s.stageMu.Lock()
+	stage := s.stage
+	s.stageMu.Unlock()
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(&HealthResponse{
 		Status:   s.status.ToString(),
 		Progress: s.progress,
+		Stage:    stage,
 	}); err != nil {
 		http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
 	}
@@ -838,6 +1421,7 @@ func (s *Server) loadModel(
 	mpath string,
 	lpath multiLPath,
 	ppath string,
+	tpath string,
 	kvSize int,
 	kvCacheType string,
 	flashAttention bool,
@@ -846,12 +1430,21 @@ func (s *Server) loadModel(
 ) {
 	llama.BackendInit()
 
+	s.setStage("loading weights")
 	var err error
 	s.model, err = llama.LoadModelFromFile(mpath, params)
 	if err != nil {
 		panic(err)
 	}
 
+	if tpath != "" {
+		s.tokenizer, err = tokenizer.Open(tpath, s.model)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	s.setStage("allocating cache")
 	ctxParams := llama.NewContextParams(kvSize, s.batchSize*s.parallel, s.parallel, threads, flashAttention, kvCacheType)
 	s.lc, err = llama.NewContextWithModel(s.model, ctxParams)
 	if err != nil {
@@ -859,6 +1452,7 @@ func (s *Server) loadModel(
 	}
 
 	if lpath.String() != "" {
+		s.setStage("loading adapters")
 		for _, path := range lpath {
 			err := s.model.ApplyLoraFromFile(s.lc, path, 1.0, threads)
 			if err != nil {
@@ -868,6 +1462,7 @@ func (s *Server) loadModel(
 	}
 
 	if ppath != "" {
+		s.setStage("loading projector")
 		var err error
 		s.image, err = NewImageContext(s.lc, ppath)
 		if err != nil {
@@ -880,6 +1475,7 @@ func (s *Server) loadModel(
 		panic(err)
 	}
 
+	s.setStage("")
 	s.status = ServerStatusReady
 	s.ready.Done()
 }
@@ -891,6 +1487,7 @@ func Execute(args []string) error {
 	fs := flag.NewFlagSet("runner", flag.ExitOnError)
 	mpath := fs.String("model", "", "Path to model binary file")
 	ppath := fs.String("mmproj", "", "Path to projector binary file")
+	tpath := fs.String("tokenizer", "", "Path to external tokenizer definition")
 	parallel := fs.Int("parallel", 1, "Number of sequences to handle simultaneously")
 	batchSize := fs.Int("batch-size", 512, "Batch size")
 	nGpuLayers := fs.Int("n-gpu-layers", 0, "Number of layers to offload to GPU")
@@ -905,6 +1502,12 @@ func Execute(args []string) error {
 	mlock := fs.Bool("mlock", false, "force system to keep model in RAM rather than swapping or compressing")
 	tensorSplit := fs.String("tensor-split", "", "fraction of the model to offload to each GPU, comma-separated list of proportions")
 	multiUserCache := fs.Bool("multiuser-cache", false, "optimize input cache algorithm for multiple users")
+	traceDir := fs.String("trace-dir", "", "Directory to write sampler traces to")
+	checkpointDir := fs.String("checkpoint-dir", "", "Directory to save checkpoints of long generations to")
+	sessionDir := fs.String("session-dir", "", "Directory to save the KV cache of sessions to")
+	maxSessions := fs.Int("max-sessions", 0, "Maximum number of sessions to keep (default: no limit)")
+	promptCacheDir := fs.String("prompt-cache-dir", "", "Directory to save the KV cache of prompt prefixes to")
+	maxPromptCaches := fs.Int("max-prompt-caches", 0, "Maximum number of prompt caches to keep (default: no limit)")
 
 	var lpaths multiLPath
 	fs.Var(&lpaths, "lora", "Path to lora layer file (can be specified multiple times)")
@@ -921,27 +1524,36 @@ func Execute(args []string) error {
 		level = slog.LevelDebug
 		llama.EnableDebug()
 	}
-	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-		Level:     level,
-		AddSource: true,
-		ReplaceAttr: func(_ []string, attr slog.Attr) slog.Attr {
-			if attr.Key == slog.SourceKey {
-				source := attr.Value.Any().(*slog.Source)
-				source.File = filepath.Base(source.File)
-			}
-			return attr
-		},
-	})
-	slog.SetDefault(slog.New(handler))
+	slog.SetDefault(logutil.NewLogger(os.Stderr, level))
 	slog.Info("starting go runner")
 	slog.Info("system", "info", llama.PrintSystemInfo(), "threads", *threads)
 
 	server := &Server{
-		batchSize: *batchSize,
-		parallel:  *parallel,
-		seqs:      make([]*Sequence, *parallel),
-		seqsSem:   semaphore.NewWeighted(int64(*parallel)),
-		status:    ServerStatusLoadingModel,
+		batchSize:     *batchSize,
+		parallel:      *parallel,
+		seqs:          make([]*Sequence, *parallel),
+		seqsSem:       semaphore.NewWeighted(int64(*parallel)),
+		status:        ServerStatusLoadingModel,
+		modelName:     filepath.Base(*mpath),
+		traceDir:      *traceDir,
+		checkpointDir: *checkpointDir,
+		sessionDir:    *sessionDir,
+		maxSessions:   *maxSessions,
+
+		promptCacheDir:  *promptCacheDir,
+		maxPromptCaches: *maxPromptCaches,
+	}
+
+	if server.checkpointDir != "" {
+		go pruneCheckpoints(server.checkpointDir)
+	}
+
+	if server.sessionDir != "" {
+		go pruneSessions(server.sessionDir, server.maxSessions)
+	}
+
+	if server.promptCacheDir != "" {
+		go pruneSessions(server.promptCacheDir, server.maxPromptCaches)
 	}
 
 	var tensorSplitFloats []float32
@@ -966,8 +1578,15 @@ func Execute(args []string) error {
 		},
 	}
 
+	tracing.Init("ollama-runner")
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		tracing.Shutdown(ctx) //nolint:errcheck
+	}()
+
 	server.ready.Add(1)
-	go server.loadModel(params, *mpath, lpaths, *ppath, *kvSize, *kvCacheType, *flashAttention, *threads, *multiUserCache)
+	go server.loadModel(params, *mpath, lpaths, *ppath, *tpath, *kvSize, *kvCacheType, *flashAttention, *threads, *multiUserCache)
 
 	server.cond = sync.NewCond(&server.mu)
 
@@ -992,9 +1611,10 @@ func Execute(args []string) error {
 		Handler: mux,
 	}
 
-	log.Println("Server listening on", addr)
+	slog.Info("server listening", "addr", addr)
 	if err := httpServer.Serve(listener); err != nil {
-		log.Fatal("server error:", err)
+		slog.Error("server error", "error", err)
+		cancel()
 		return err
 	}
 
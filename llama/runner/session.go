@@ -0,0 +1,253 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/llama"
+)
+
+// sessionTTL is how long sessions that are not used are kept
+const sessionTTL = 24 * time.Hour
+
+// session is the KV cache of a conversation saved after each request so
+// that the next request of the session only processes the new part of its
+// prompt, even if the cache slot was reused or the model reloaded since. A
+// session is two files: the KV cache of the sequence and its metadata,
+// which is written last.
+type session struct {
+	id string
+
+	// path of the session files without their extension
+	path string
+}
+
+type sessionMetadata struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Adapter string `json:"adapter,omitempty"`
+	Tokens  []int  `json:"tokens"`
+}
+
+func newSession(dir, id string) *session {
+	sum := sha256.Sum256([]byte(id))
+	return &session{id: id, path: filepath.Join(dir, hex.EncodeToString(sum[:]))}
+}
+
+// restoreSession loads the KV cache saved for the session of seq into its
+// cache slot, if it has more of prompt than the slot does. seq must have
+// its cache slot loaded; prompt are the inputs of seq before that.
+func (s *Server) restoreSession(seq *Sequence, prompt []input) error {
+	sess := seq.session
+
+	bts, err := os.ReadFile(sess.path + ".json")
+	if err != nil {
+		return err
+	}
+
+	var m sessionMetadata
+	if err := json.Unmarshal(bts, &m); err != nil {
+		return err
+	}
+
+	if m.Model != s.modelName {
+		return errors.New("session is of a different model")
+	}
+
+	if m.Adapter != seq.adapter {
+		return errors.New("session is of a different adapter")
+	}
+
+	// mark the session as used for eviction
+	now := time.Now()
+	os.Chtimes(sess.path+".json", now, now) //nolint:errcheck
+
+	saved := make([]input, len(m.Tokens))
+	for i, token := range m.Tokens {
+		saved[i] = input{token: token}
+	}
+
+	numPast := countCommonPrefix(saved, prompt)
+	if numPast == len(prompt) {
+		// leave one input to sample so we can get a response
+		numPast--
+	}
+
+	if numPast <= len(seq.cache.Inputs) {
+		return nil
+	}
+
+	if err := s.loadState(seq, sess.path+".kv", len(m.Tokens), numPast, prompt); err != nil {
+		return err
+	}
+
+	slog.DebugContext(seq.ctx, "restored session", "session", len(m.Tokens), "used", numPast)
+	return nil
+}
+
+// loadState loads the KV cache of numTokens tokens saved at path into the
+// cache slot of seq and keeps the first numPast, which must be the first
+// inputs of prompt. If it fails the slot is left empty to process all of
+// prompt.
+func (s *Server) loadState(seq *Sequence, path string, numTokens, numPast int, prompt []input) error {
+	tokens, err := s.lc.StateSeqLoadFile(path, seq.cache.Id, s.cache.numCtx)
+	if err == nil && len(tokens) != numTokens {
+		err = fmt.Errorf("saved state has %d tokens, expected %d", len(tokens), numTokens)
+	}
+
+	if err == nil && !s.lc.KvCacheSeqRm(seq.cache.Id, numPast, -1) {
+		err = errors.New("model does not support partial removal from the cache")
+	}
+
+	if err != nil {
+		// loading replaces the contents of the cache slot, start over
+		s.lc.KvCacheSeqRm(seq.cache.Id, 0, -1)
+		seq.cache.Inputs = seq.cache.Inputs[:0]
+		seq.inputs = prompt
+		seq.numCachedInputs = 0
+		return err
+	}
+
+	seq.cache.Inputs = slices.Clone(prompt[:numPast])
+	seq.inputs = prompt[numPast:]
+	seq.numCachedInputs = seq.numPromptInputs - len(seq.inputs)
+	return nil
+}
+
+// saveSession saves the KV cache of seq for the next request of its
+// session and evicts sessions if there are more than maxSessions. Only
+// copying the cache to memory holds up the batch, it is written to disk in
+// the background.
+func (s *Server) saveSession(seq *Sequence) error {
+	sess := seq.session
+	tokens := make([]int, len(seq.cache.Inputs))
+	for i, input := range seq.cache.Inputs {
+		tokens[i] = input.token
+	}
+
+	state, err := s.lc.StateSeqGetData(seq.cache.Id)
+	if err != nil {
+		return err
+	}
+
+	ctx := seq.ctx
+	metadata := sessionMetadata{ID: sess.id, Model: s.modelName, Adapter: seq.adapter, Tokens: tokens}
+	go func() {
+		s.sessionMu.Lock()
+		defer s.sessionMu.Unlock()
+
+		if err := writeState(sess.path, tokens, state, metadata); err != nil {
+			slog.WarnContext(ctx, "failed to save session", "error", err)
+			return
+		}
+
+		slog.DebugContext(ctx, "saved session", "path", sess.path, "tokens", len(tokens))
+		pruneSessions(filepath.Dir(sess.path), s.maxSessions)
+	}()
+
+	return nil
+}
+
+// saveState saves the KV cache of seq, holding tokens, to path with the
+// extension .kv, and then metadata to path with the extension .json.
+func (s *Server) saveState(seq *Sequence, path string, tokens []int, metadata any) error {
+	state, err := s.lc.StateSeqGetData(seq.cache.Id)
+	if err != nil {
+		return err
+	}
+
+	return writeState(path, tokens, state, metadata)
+}
+
+// writeState writes state, a KV cache holding tokens, to path with the
+// extension .kv, and then metadata to path with the extension .json.
+func writeState(path string, tokens []int, state []byte, metadata any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	if err := llama.WriteStateSeqFile(path+".kv.tmp", tokens, state); err != nil {
+		return err
+	}
+
+	bts, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path+".json.tmp", bts, 0o644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(path+".kv.tmp", path+".kv"); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".json.tmp", path+".json")
+}
+
+// pruneSessions removes sessions in dir not used for sessionTTL, and then
+// the least recently used sessions beyond the newest maxSessions. A
+// maxSessions of 0 keeps any number of sessions. Prompt caches are pruned
+// the same way.
+func pruneSessions(dir string, maxSessions int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	type usedSession struct {
+		path string
+		used time.Time
+	}
+
+	var sessions []usedSession
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if base, ok := strings.CutSuffix(path, ".json"); ok {
+			sessions = append(sessions, usedSession{path: base, used: info.ModTime()})
+			continue
+		}
+
+		// remove files left behind by saves that didn't finish
+		base := strings.TrimSuffix(strings.TrimSuffix(path, ".tmp"), filepath.Ext(strings.TrimSuffix(path, ".tmp")))
+		if _, err := os.Stat(base + ".json"); errors.Is(err, os.ErrNotExist) && time.Since(info.ModTime()) > sessionTTL {
+			os.Remove(path) //nolint:errcheck
+		}
+	}
+
+	// most recently used first
+	slices.SortFunc(sessions, func(a, b usedSession) int {
+		return b.used.Compare(a.used)
+	})
+
+	for i, sess := range sessions {
+		if time.Since(sess.used) > sessionTTL || (maxSessions > 0 && i >= maxSessions) {
+			removeSession(sess.path)
+		}
+	}
+}
+
+// removeSession removes the files of the session at path, metadata first
+// so that a session is never listed without its KV cache.
+func removeSession(path string) {
+	for _, ext := range []string{".json", ".kv", ".json.tmp", ".kv.tmp"} {
+		if err := os.Remove(path + ext); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("failed to remove session", "error", err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNewSession(t *testing.T) {
+	dir := t.TempDir()
+
+	a := newSession(dir, "chat-1")
+	if b := newSession(dir, "chat-1"); a.path != b.path {
+		t.Errorf("expected the same session for the same id, got %s and %s", a.path, b.path)
+	}
+
+	if filepath.Dir(a.path) != dir {
+		t.Errorf("expected session in %s, got %s", dir, a.path)
+	}
+
+	if c := newSession(dir, "../chat-1"); filepath.Dir(c.path) != dir || c.path == a.path {
+		t.Errorf("expected a distinct session in %s, got %s", dir, c.path)
+	}
+}
+
+func TestPruneSessions(t *testing.T) {
+	dir := t.TempDir()
+
+	touch := func(name string, age time.Duration) {
+		t.Helper()
+
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		at := time.Now().Add(-age)
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// sessions are used as of their metadata
+	touch("a.json", time.Minute)
+	touch("a.kv", 3*sessionTTL)
+	touch("b.json", 2*time.Minute)
+	touch("b.kv", 2*time.Minute)
+	touch("c.json", 3*time.Minute)
+	touch("c.kv", 3*time.Minute)
+	touch("expired.json", 2*sessionTTL)
+	touch("expired.kv", 2*sessionTTL)
+	touch("orphan.kv.tmp", 2*sessionTTL)
+	touch("saving.kv.tmp", time.Minute)
+
+	pruneSessions(dir, 2)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	if want := []string{"a.json", "a.kv", "b.json", "b.kv", "saving.kv.tmp"}; !slices.Equal(names, want) {
+		t.Errorf("expected %v to remain, got %v", want, names)
+	}
+}
+
+func TestRestoreSessionAdapter(t *testing.T) {
+	dir := t.TempDir()
+	s := &Server{modelName: "test"}
+	seq := &Sequence{session: newSession(dir, "chat-1"), adapter: "b.gguf"}
+
+	if err := writeState(seq.session.path, nil, nil, sessionMetadata{ID: "chat-1", Model: "test", Adapter: "a.gguf"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.restoreSession(seq, nil); err == nil || err.Error() != "session is of a different adapter" {
+		t.Errorf("expected a different adapter to be rejected, got %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package runner
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -94,3 +96,32 @@ func incompleteUnicode(token string) bool {
 
 	return incomplete
 }
+
+// stopTokens returns the ids of stop tokens given as ids or as the text of a
+// single token, such as the name of a special token like <|eot_id|>.
+func (s *Server) stopTokens(stops []string) ([]int, error) {
+	var ids []int
+	for _, stop := range stops {
+		if id, err := strconv.Atoi(stop); err == nil {
+			if id < 0 || id >= s.model.NumVocab() {
+				return nil, fmt.Errorf("invalid stop token %d", id)
+			}
+
+			ids = append(ids, id)
+			continue
+		}
+
+		tokens, err := s.tokenize(stop, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(tokens) != 1 {
+			return nil, fmt.Errorf("stop token %q is not a single token", stop)
+		}
+
+		ids = append(ids, tokens[0])
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,144 @@
+package runner
+
+import (
+	"math"
+
+	"github.com/ollama/ollama/api"
+)
+
+// lowEntropy is the entropy in nats below which a token was sampled with
+// next to no uncertainty
+const lowEntropy = 0.01
+
+// watchdog detects degenerate output as it is generated: the last window
+// tokens being the same n-gram repeated at least four times, or having all
+// been sampled with low entropy.
+type watchdog struct {
+	// stop generation once degenerate output is detected, rather than only
+	// reporting it
+	stop bool
+
+	window int
+
+	// tokens and entropies are the last window tokens generated and the
+	// entropy of the distributions they were sampled from
+	tokens    []int
+	entropies []float64
+
+	// runs is, for each period p, the number of tokens in a row equal to
+	// the token p before them
+	runs []int
+
+	// lowRun is the number of tokens in a row sampled with low entropy
+	lowRun int
+
+	generated int
+
+	// detected is the first degenerate output detected
+	detected *api.Degeneration
+}
+
+// newWatchdog returns a watchdog for the watchdog option mode, or nil if it
+// is off.
+func newWatchdog(mode string, window int) *watchdog {
+	if mode != "warn" && mode != "stop" {
+		return nil
+	}
+
+	// a window needs room for four repetitions
+	window = max(window, 4)
+	return &watchdog{
+		stop:   mode == "stop",
+		window: window,
+		runs:   make([]int, window/4+1),
+	}
+}
+
+// observe records a generated token and the entropy of the distribution it
+// was sampled from, and returns true if it makes the output degenerate. It
+// returns the repeated tokens, if any, to be turned into text.
+func (w *watchdog) observe(token int, entropy float64) (bool, []int) {
+	w.generated++
+	w.tokens = append(w.tokens, token)
+	w.entropies = append(w.entropies, entropy)
+
+	n := len(w.tokens)
+	for p := 1; p < len(w.runs); p++ {
+		if n > p && w.tokens[n-1] == w.tokens[n-1-p] {
+			w.runs[p]++
+		} else {
+			w.runs[p] = 0
+		}
+	}
+
+	if entropy < lowEntropy {
+		w.lowRun++
+	} else {
+		w.lowRun = 0
+	}
+
+	// only the last window tokens are needed, keep up to twice as many to
+	// trim them less often
+	if n > 2*w.window {
+		w.tokens = append(w.tokens[:0], w.tokens[n-w.window:]...)
+		w.entropies = append(w.entropies[:0], w.entropies[n-w.window:]...)
+	}
+
+	if w.detected != nil {
+		return false, nil
+	}
+
+	// the shortest period is the n-gram repeated
+	for p := 1; p < len(w.runs); p++ {
+		if w.runs[p] >= w.window-p {
+			w.detect("repetition")
+			return true, w.tokens[len(w.tokens)-p:]
+		}
+	}
+
+	if w.lowRun >= w.window {
+		w.detect("low_entropy")
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (w *watchdog) detect(kind string) {
+	var sum float64
+	for _, e := range w.entropies[len(w.entropies)-w.window:] {
+		sum += e
+	}
+
+	w.detected = &api.Degeneration{
+		Kind:    kind,
+		At:      w.generated,
+		Window:  w.window,
+		Entropy: sum / float64(w.window),
+	}
+}
+
+// entropy returns the entropy in nats of the distribution of the softmax of
+// logits.
+func entropy(logits []float32) float64 {
+	maxLogit := math.Inf(-1)
+	for _, l := range logits {
+		maxLogit = max(maxLogit, float64(l))
+	}
+
+	// H = log Z - sum(p * x) with x shifted by the max logit
+	var z, weighted float64
+	for _, l := range logits {
+		x := float64(l) - maxLogit
+		e := math.Exp(x)
+		if e == 0 {
+			// tokens ruled out have no probability
+			continue
+		}
+
+		z += e
+		weighted += e * x
+	}
+
+	return max(math.Log(z)-weighted/z, 0)
+}
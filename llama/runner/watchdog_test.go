@@ -0,0 +1,123 @@
+package runner
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestNewWatchdog(t *testing.T) {
+	if w := newWatchdog("", 128); w != nil {
+		t.Errorf("expected no watchdog by default, got %+v", w)
+	}
+
+	if w := newWatchdog("off", 128); w != nil {
+		t.Errorf("expected no watchdog when off, got %+v", w)
+	}
+
+	if w := newWatchdog("warn", 128); w == nil || w.stop {
+		t.Errorf("expected a watchdog that doesn't stop, got %+v", w)
+	}
+
+	if w := newWatchdog("stop", 0); w == nil || !w.stop || w.window != 4 {
+		t.Errorf("expected a watchdog that stops with the smallest window, got %+v", w)
+	}
+}
+
+func TestWatchdogRepetition(t *testing.T) {
+	cases := []struct {
+		name     string
+		tokens   []int
+		at       int
+		repeated []int
+	}{
+		{
+			name:   "varied",
+			tokens: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20},
+		},
+		{
+			name:     "same token",
+			tokens:   []int{1, 2, 3, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7},
+			at:       19,
+			repeated: []int{7},
+		},
+		{
+			name:     "ngram",
+			tokens:   []int{1, 2, 3, 4, 5, 6, 4, 5, 6, 4, 5, 6, 4, 5, 6, 4, 5, 6, 4, 5, 6},
+			at:       19,
+			repeated: []int{5, 6, 4},
+		},
+		{
+			name:   "broken repetition",
+			tokens: []int{4, 5, 6, 4, 5, 6, 4, 5, 6, 4, 5, 6, 4, 5, 1, 4, 5, 6, 4, 5, 6},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newWatchdog("stop", 16)
+
+			var at int
+			var repeated []int
+			for i, token := range tt.tokens {
+				if ok, r := w.observe(token, 1); ok {
+					if at != 0 {
+						t.Fatalf("expected degenerate output to be detected once, again at %d", i+1)
+					}
+
+					at, repeated = i+1, slices.Clone(r)
+				}
+			}
+
+			if at != tt.at {
+				t.Errorf("expected detection at %d, got %d", tt.at, at)
+			}
+
+			if !slices.Equal(repeated, tt.repeated) {
+				t.Errorf("expected repeated %v, got %v", tt.repeated, repeated)
+			}
+
+			if at != 0 && (w.detected.Kind != "repetition" || w.detected.At != at || w.detected.Window != 16) {
+				t.Errorf("unexpected detection %+v", w.detected)
+			}
+		})
+	}
+}
+
+func TestWatchdogLowEntropy(t *testing.T) {
+	w := newWatchdog("warn", 8)
+
+	for i := range 20 {
+		h := 0.001
+		if i == 5 {
+			h = 2
+		}
+
+		ok, repeated := w.observe(i, h)
+		if ok != (i == 13) {
+			t.Errorf("token %d: expected detection %v, got %v", i, i == 13, ok)
+		}
+
+		if repeated != nil {
+			t.Errorf("token %d: expected no repeated tokens, got %v", i, repeated)
+		}
+	}
+
+	if w.detected == nil || w.detected.Kind != "low_entropy" || w.detected.At != 14 || math.Abs(w.detected.Entropy-0.001) > 1e-9 {
+		t.Errorf("unexpected detection %+v", w.detected)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	if h := entropy([]float32{1, 1, 1, 1}); math.Abs(h-math.Log(4)) > 1e-6 {
+		t.Errorf("expected the entropy of a uniform distribution to be log(4), got %f", h)
+	}
+
+	if h := entropy([]float32{100, 0, 0, 0}); h > lowEntropy {
+		t.Errorf("expected next to no entropy, got %f", h)
+	}
+
+	if h := entropy([]float32{float32(math.Inf(-1)), 3, 3}); math.Abs(h-math.Log(2)) > 1e-6 {
+		t.Errorf("expected masked logits to be ignored, got %f", h)
+	}
+}
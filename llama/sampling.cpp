@@ -291,18 +291,42 @@ void common_perf_print(const struct llama_context * ctx, const struct common_sam
     }
 }
 
-llama_token common_sampler_sample(struct common_sampler * gsmpl, struct llama_context * ctx, int idx, bool grammar_first) {
+static void common_sampler_trace(struct common_sampler * gsmpl, const char * stage, common_sampler_trace_cb trace_cb, void * user_data) {
+    if (trace_cb != nullptr) {
+        trace_cb(stage, &gsmpl->cur_p, user_data);
+    }
+}
+
+static void common_sampler_apply_grammar(struct common_sampler * gsmpl, common_sampler_trace_cb trace_cb, void * user_data) {
+    llama_sampler_apply(gsmpl->grmr, &gsmpl->cur_p);
+    common_sampler_trace(gsmpl, "grammar", trace_cb, user_data);
+}
+
+static void common_sampler_apply_chain(struct common_sampler * gsmpl, common_sampler_trace_cb trace_cb, void * user_data) {
+    if (trace_cb == nullptr) {
+        llama_sampler_apply(gsmpl->chain, &gsmpl->cur_p);
+        return;
+    }
+
+    for (int i = 0; i < llama_sampler_chain_n(gsmpl->chain); i++) {
+        struct llama_sampler * smpl = llama_sampler_chain_get(gsmpl->chain, i);
+        llama_sampler_apply(smpl, &gsmpl->cur_p);
+        common_sampler_trace(gsmpl, llama_sampler_name(smpl), trace_cb, user_data);
+    }
+}
+
+static llama_token common_sampler_sample_impl(struct common_sampler * gsmpl, struct llama_context * ctx, int idx, bool grammar_first, common_sampler_trace_cb trace_cb, void * user_data) {
     gsmpl->set_logits(ctx, idx);
+    common_sampler_trace(gsmpl, "logits", trace_cb, user_data);
 
     auto & grmr  = gsmpl->grmr;
-    auto & chain = gsmpl->chain;
     auto & cur_p = gsmpl->cur_p; // initialized by set_logits
 
     if (grammar_first) {
-        llama_sampler_apply(grmr, &cur_p);
+        common_sampler_apply_grammar(gsmpl, trace_cb, user_data);
     }
 
-    llama_sampler_apply(chain, &cur_p);
+    common_sampler_apply_chain(gsmpl, trace_cb, user_data);
 
     GGML_ASSERT(cur_p.selected != -1 && "no selected token during sampling - check your sampling configuration");
 
@@ -328,15 +352,24 @@ llama_token common_sampler_sample(struct common_sampler * gsmpl, struct llama_co
     // resampling:
     // if the token is not valid, sample again, but first apply the grammar sampler and then the sampling chain
     gsmpl->set_logits(ctx, idx);
+    common_sampler_trace(gsmpl, "logits", trace_cb, user_data);
 
-    llama_sampler_apply(grmr,  &cur_p);
-    llama_sampler_apply(chain, &cur_p);
+    common_sampler_apply_grammar(gsmpl, trace_cb, user_data);
+    common_sampler_apply_chain(gsmpl, trace_cb, user_data);
 
     GGML_ASSERT(cur_p.selected != -1 && "no selected token during re-sampling - check your sampling configuration");
 
     return cur_p.data[cur_p.selected].id;
 }
 
+llama_token common_sampler_sample(struct common_sampler * gsmpl, struct llama_context * ctx, int idx, bool grammar_first) {
+    return common_sampler_sample_impl(gsmpl, ctx, idx, grammar_first, nullptr, nullptr);
+}
+
+llama_token common_sampler_sample_trace(struct common_sampler * gsmpl, struct llama_context * ctx, int idx, common_sampler_trace_cb trace_cb, void * user_data) {
+    return common_sampler_sample_impl(gsmpl, ctx, idx, false, trace_cb, user_data);
+}
+
 std::vector<llama_token> common_sampler_sample_and_accept_n(struct common_sampler * gsmpl, struct llama_context * ctx, const std::vector<int> & idxs, const llama_tokens & draft, bool grammar_first) {
     GGML_ASSERT(idxs.size() == draft.size() + 1 && "idxs.size() must be draft.size() + 1");
 
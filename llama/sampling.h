@@ -86,6 +86,13 @@ void common_perf_print(const struct llama_context * ctx, const struct common_sam
 //
 llama_token common_sampler_sample(struct common_sampler * gsmpl, struct llama_context * ctx, int idx, bool grammar_first = false);
 
+// called with the candidates after each stage of sampling: "logits" for the raw logits, "grammar" when the grammar is applied,
+// and the name of each sampler in the chain
+typedef void (*common_sampler_trace_cb)(const char * stage, const llama_token_data_array * cur_p, void * user_data);
+
+// same as common_sampler_sample, but calls trace_cb after each stage
+llama_token common_sampler_sample_trace(struct common_sampler * gsmpl, struct llama_context * ctx, int idx, common_sampler_trace_cb trace_cb, void * user_data);
+
 // generalized version of common_sampler_sample
 //
 // will cross-reference the sampled tokens with a batch of draft tokens and accept those that match
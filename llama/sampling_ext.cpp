@@ -2,6 +2,11 @@
 #include "sampling.h"
 #include "sampling_ext.h"
 #include "json-schema-to-grammar.h"
+#include "llama-grammar.h"
+
+#include <algorithm>
+#include <cmath>
+#include <cstring>
 
 struct common_sampler *common_sampler_cinit(const struct llama_model *model, struct common_sampler_cparams *params) {
     try {
@@ -20,6 +25,7 @@ struct common_sampler *common_sampler_cinit(const struct llama_model *model, str
         sparams.mirostat_eta = params->mirostat_eta;
         sparams.seed = params->seed;
         sparams.grammar = params->grammar;
+        sparams.logit_bias.assign(params->logit_bias, params->logit_bias + params->n_logit_bias);
         sparams.xtc_probability = 0.0;
         sparams.xtc_threshold = 0.5;
         return common_sampler_init(model, sparams);
@@ -44,6 +50,66 @@ llama_token common_sampler_csample(struct common_sampler *sampler, struct llama_
     return common_sampler_sample(sampler, ctx, idx);
 }
 
+static void common_sampler_ctrace_stage(const char *stage, const llama_token_data_array *cur_p, void *user_data) {
+    auto *trace = static_cast<common_sampler_ctrace *>(user_data);
+    if (strcmp(stage, "logits") == 0) {
+        // sampling starts over when the grammar rejects a token, keep only
+        // the stages of the pass that chose it
+        trace->n_stages = 0;
+    }
+
+    if (trace->n_stages >= COMMON_SAMPLER_TRACE_MAX_STAGES) {
+        return;
+    }
+
+    auto &out = trace->stages[trace->n_stages++];
+    strncpy(out.name, stage, sizeof(out.name) - 1);
+    out.name[sizeof(out.name) - 1] = '\0';
+    out.n_candidates = 0;
+    out.n_top = 0;
+
+    float max_logit = -INFINITY;
+    for (size_t i = 0; i < cur_p->size; i++) {
+        const auto &td = cur_p->data[i];
+        if (td.logit == -INFINITY) {
+            continue;
+        }
+
+        out.n_candidates++;
+        max_logit = std::max(max_logit, td.logit);
+
+        // insert into the top candidates, which are kept sorted by logit
+        if (out.n_top == COMMON_SAMPLER_TRACE_TOP && td.logit <= out.top_logits[COMMON_SAMPLER_TRACE_TOP - 1]) {
+            continue;
+        }
+
+        int j = out.n_top < COMMON_SAMPLER_TRACE_TOP ? out.n_top++ : COMMON_SAMPLER_TRACE_TOP - 1;
+        for (; j > 0 && out.top_logits[j - 1] < td.logit; j--) {
+            out.top_tokens[j] = out.top_tokens[j - 1];
+            out.top_logits[j] = out.top_logits[j - 1];
+        }
+
+        out.top_tokens[j] = td.id;
+        out.top_logits[j] = td.logit;
+    }
+
+    double sum = 0.0;
+    for (size_t i = 0; i < cur_p->size; i++) {
+        if (cur_p->data[i].logit != -INFINITY) {
+            sum += std::exp(cur_p->data[i].logit - max_logit);
+        }
+    }
+
+    for (int i = 0; i < out.n_top; i++) {
+        out.top_probs[i] = sum > 0 ? std::exp(out.top_logits[i] - max_logit) / sum : 0.0f;
+    }
+}
+
+llama_token common_sampler_csample_trace(struct common_sampler *sampler, struct llama_context *ctx, int idx, struct common_sampler_ctrace *trace) {
+    trace->n_stages = 0;
+    return common_sampler_sample_trace(sampler, ctx, idx, common_sampler_ctrace_stage, trace);
+}
+
 int schema_to_grammar(const char *json_schema, char *grammar, size_t max_len)
 {
     try
@@ -64,3 +130,91 @@ int schema_to_grammar(const char *json_schema, char *grammar, size_t max_len)
         return 0;
     }
 }
+
+// grammar_productive reports whether the rules of a grammar can produce a
+// finite string starting from rule root
+static bool grammar_productive(const llama_grammar_rules &rules, uint32_t root)
+{
+    std::vector<bool> productive(rules.size());
+    for (bool changed = true; changed;) {
+        changed = false;
+        for (size_t i = 0; i < rules.size(); i++) {
+            if (productive[i]) {
+                continue;
+            }
+
+            // a rule is productive if any of its alternates only refers to
+            // productive rules
+            bool ok = true;
+            for (const auto &elem : rules[i]) {
+                if (elem.type == LLAMA_GRETYPE_END || (elem.type == LLAMA_GRETYPE_ALT && ok)) {
+                    break;
+                } else if (elem.type == LLAMA_GRETYPE_ALT) {
+                    ok = true;
+                } else if (elem.type == LLAMA_GRETYPE_RULE_REF && !productive[elem.value]) {
+                    ok = false;
+                }
+            }
+
+            if (ok) {
+                productive[i] = true;
+                changed = true;
+            }
+        }
+    }
+
+    return productive[root];
+}
+
+int grammar_validate(const char *grammar, char *err, size_t max_len)
+{
+    auto fail = [&](const std::string &msg) {
+        strncpy(err, msg.c_str(), max_len - 1);
+        err[max_len - 1] = '\0';
+        return 1;
+    };
+
+    llama_grammar_parser parser;
+    try {
+        // same as llama_grammar_parser::parse, which only logs errors
+        const char *pos = grammar;
+        while (*pos == ' ' || *pos == '\t' || *pos == '\r' || *pos == '\n' || *pos == '#') {
+            if (*pos == '#') {
+                while (*pos && *pos != '\r' && *pos != '\n') {
+                    pos++;
+                }
+            } else {
+                pos++;
+            }
+        }
+
+        while (*pos) {
+            pos = parser.parse_rule(pos);
+        }
+
+        for (const auto &kv : parser.symbol_ids) {
+            if (kv.second >= parser.rules.size() || parser.rules[kv.second].empty()) {
+                throw std::runtime_error("undefined rule '" + kv.first + "'");
+            }
+        }
+    } catch (const std::exception &e) {
+        return fail(e.what());
+    }
+
+    auto root = parser.symbol_ids.find("root");
+    if (root == parser.symbol_ids.end()) {
+        return fail("grammar does not contain a 'root' rule");
+    }
+
+    if (!grammar_productive(parser.rules, root->second)) {
+        return fail("grammar cannot match any output");
+    }
+
+    struct llama_grammar *g = llama_grammar_init_impl(nullptr, grammar, "root");
+    if (g == nullptr) {
+        return fail("grammar is left recursive");
+    }
+    llama_grammar_free_impl(g);
+
+    return 0;
+}
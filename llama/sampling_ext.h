@@ -25,6 +25,28 @@ extern "C"
         float mirostat_eta;
         uint32_t seed;
         char *grammar;
+        const llama_logit_bias *logit_bias;
+        size_t n_logit_bias;
+    };
+
+#define COMMON_SAMPLER_TRACE_TOP 8
+#define COMMON_SAMPLER_TRACE_MAX_STAGES 24
+
+    // the candidates after a stage of sampling
+    struct common_sampler_ctrace_stage {
+        char name[32];
+        // number of tokens that can still be sampled
+        int32_t n_candidates;
+        // most likely tokens and their probabilities over the remaining candidates
+        int32_t n_top;
+        int32_t top_tokens[COMMON_SAMPLER_TRACE_TOP];
+        float top_logits[COMMON_SAMPLER_TRACE_TOP];
+        float top_probs[COMMON_SAMPLER_TRACE_TOP];
+    };
+
+    struct common_sampler_ctrace {
+        int32_t n_stages;
+        struct common_sampler_ctrace_stage stages[COMMON_SAMPLER_TRACE_MAX_STAGES];
     };
 
     struct common_sampler *common_sampler_cinit(const struct llama_model *model, struct common_sampler_cparams *params);
@@ -32,8 +54,10 @@ extern "C"
     void common_sampler_creset(struct common_sampler *sampler);
     void common_sampler_caccept(struct common_sampler *sampler, llama_token id, bool apply_grammar);
     llama_token common_sampler_csample(struct common_sampler *sampler, struct llama_context *ctx, int idx);
+    llama_token common_sampler_csample_trace(struct common_sampler *sampler, struct llama_context *ctx, int idx, struct common_sampler_ctrace *trace);
 
     int schema_to_grammar(const char *json_schema, char *grammar, size_t max_len);
+    int grammar_validate(const char *grammar, char *err, size_t max_len);
 
 #ifdef __cplusplus
 }
@@ -122,6 +122,47 @@ func (kv KV) ChatTemplate() string {
 	return s
 }
 
+// poolingTypes are the names of llama.cpp's pooling types, by value.
+var poolingTypes = []string{"none", "mean", "cls", "last", "rank"}
+
+// PoolingType returns how an embedding model pools the embeddings of its
+// tokens, or "" if the model isn't an embedding model.
+func (kv KV) PoolingType() string {
+	key := fmt.Sprintf("%s.pooling_type", kv.Architecture())
+	if _, ok := kv[key]; !ok {
+		return ""
+	}
+
+	if t := kv.u64(key); t < uint64(len(poolingTypes)) {
+		return poolingTypes[t]
+	}
+
+	return "unknown"
+}
+
+// HasClassifier reports whether the model has a classification head. Such
+// models pool with LLAMA_POOLING_TYPE_RANK.
+func (kv KV) HasClassifier() bool {
+	return kv.u64(fmt.Sprintf("%s.pooling_type", kv.Architecture())) == 4
+}
+
+// ClassifierLabels returns the labels of the outputs of a classification
+// head. It is nil if the labels were not decoded or the model has none.
+func (kv KV) ClassifierLabels() []string {
+	a, ok := kv[fmt.Sprintf("%s.classifier.output_labels", kv.Architecture())].(*array)
+	if !ok || a.values == nil {
+		return nil
+	}
+
+	labels := make([]string, 0, len(a.values))
+	for _, v := range a.values {
+		s, _ := v.(string)
+		labels = append(labels, s)
+	}
+
+	return labels
+}
+
 type Tensors struct {
 	Items  []*Tensor
 	Offset uint64
@@ -0,0 +1,330 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// FormatError is returned by Completion when a request for JSON output
+// produces text that can no longer become valid JSON, however it continues.
+// Generation is stopped as soon as that happens.
+type FormatError struct {
+	// Offset is the byte offset in the output of the first invalid byte.
+	Offset int
+	// Reason describes what was expected instead.
+	Reason string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("output is not valid JSON at offset %d: %s", e.Offset, e.Reason)
+}
+
+type jsonState int
+
+const (
+	jsonValue           jsonState = iota // a value
+	jsonValueOrEnd                       // a value or ']'
+	jsonKeyOrEnd                         // a key or '}'
+	jsonKey                              // a key
+	jsonColon                            // ':' after a key
+	jsonAfterValue                       // ',' or the end of the container
+	jsonString                           // inside a string
+	jsonEscape                           // after '\' in a string
+	jsonUnicode                          // inside a \u escape
+	jsonLiteral                          // inside true, false or null
+	jsonNumberSign                       // after '-'
+	jsonNumberZero                       // after a leading 0
+	jsonNumberInt                        // in the integer part
+	jsonNumberDot                        // after '.'
+	jsonNumberFrac                       // in the fraction
+	jsonNumberExp                        // after 'e'
+	jsonNumberExpSign                    // after the sign of the exponent
+	jsonNumberExpDigits                  // in the exponent
+	jsonDone                             // after the top-level value
+)
+
+// jsonValidator checks JSON as it is written, a chunk at a time, and fails on
+// the first byte that cannot be part of a valid document.
+type jsonValidator struct {
+	state  jsonState
+	stack  []byte
+	offset int
+	// inKey is set while the string being read is an object key
+	inKey bool
+	// rest is the rest of the literal or \u escape being read
+	rest string
+	// top is the bracket the document must start with, if the schema
+	// requires an object or an array
+	top byte
+	err *FormatError
+}
+
+// newJSONValidator returns a validator for output requested in format, or
+// nil if format does not ask for JSON.
+func newJSONValidator(format json.RawMessage) *jsonValidator {
+	switch string(format) {
+	case "", "null", `""`:
+		return nil
+	case `"json"`:
+		return &jsonValidator{}
+	}
+
+	var schema struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(format, &schema); err != nil {
+		return nil
+	}
+
+	v := &jsonValidator{}
+	switch schema.Type {
+	case "object":
+		v.top = '{'
+	case "array":
+		v.top = '['
+	}
+
+	return v
+}
+
+// Write validates the next chunk of output.
+func (v *jsonValidator) Write(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+
+	for i, c := range p {
+		if reason := v.step(c); reason != "" {
+			v.err = &FormatError{Offset: v.offset, Reason: reason}
+			return i, v.err
+		}
+		v.offset++
+	}
+
+	return len(p), nil
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// step advances the validator by c and returns why c is invalid, if it is.
+func (v *jsonValidator) step(c byte) string {
+	switch v.state {
+	case jsonValue, jsonValueOrEnd:
+		if isJSONSpace(c) {
+			return ""
+		} else if c == ']' && v.state == jsonValueOrEnd {
+			return v.closeContainer('[')
+		}
+		return v.startValue(c)
+	case jsonKeyOrEnd, jsonKey:
+		switch {
+		case isJSONSpace(c):
+			return ""
+		case c == '}' && v.state == jsonKeyOrEnd:
+			return v.closeContainer('{')
+		case c == '"':
+			v.state, v.inKey = jsonString, true
+			return ""
+		}
+		return fmt.Sprintf("expected a string key, got %q", c)
+	case jsonColon:
+		switch {
+		case isJSONSpace(c):
+			return ""
+		case c == ':':
+			v.state = jsonValue
+			return ""
+		}
+		return fmt.Sprintf("expected ':' after key, got %q", c)
+	case jsonAfterValue:
+		switch {
+		case isJSONSpace(c):
+			return ""
+		case c == ',' && len(v.stack) > 0:
+			if v.stack[len(v.stack)-1] == '{' {
+				v.state = jsonKey
+			} else {
+				v.state = jsonValue
+			}
+			return ""
+		case c == '}':
+			return v.closeContainer('{')
+		case c == ']':
+			return v.closeContainer('[')
+		}
+		return fmt.Sprintf("expected ',' or the end of a container, got %q", c)
+	case jsonString:
+		switch {
+		case c == '"':
+			if v.inKey {
+				v.state, v.inKey = jsonColon, false
+			} else {
+				v.endValue()
+			}
+		case c == '\\':
+			v.state = jsonEscape
+		case c < 0x20:
+			return "control character in string"
+		}
+		return ""
+	case jsonEscape:
+		switch c {
+		case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			v.state = jsonString
+		case 'u':
+			v.state, v.rest = jsonUnicode, "xxxx"
+		default:
+			return fmt.Sprintf("invalid escape %q", c)
+		}
+		return ""
+	case jsonUnicode:
+		if !isDigit(c) && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+			return fmt.Sprintf("invalid hexadecimal digit %q in \\u escape", c)
+		}
+		if v.rest = v.rest[1:]; v.rest == "" {
+			v.state = jsonString
+		}
+		return ""
+	case jsonLiteral:
+		if c != v.rest[0] {
+			return fmt.Sprintf("invalid literal, expected %q", v.rest[0])
+		}
+		if v.rest = v.rest[1:]; v.rest == "" {
+			v.endValue()
+		}
+		return ""
+	case jsonNumberSign:
+		switch {
+		case c == '0':
+			v.state = jsonNumberZero
+		case isDigit(c):
+			v.state = jsonNumberInt
+		default:
+			return "expected a digit after '-'"
+		}
+		return ""
+	case jsonNumberZero, jsonNumberInt:
+		switch {
+		case isDigit(c) && v.state == jsonNumberInt:
+			return ""
+		case c == '.':
+			v.state = jsonNumberDot
+			return ""
+		case c == 'e' || c == 'E':
+			v.state = jsonNumberExp
+			return ""
+		}
+		return v.endNumber(c)
+	case jsonNumberDot:
+		if !isDigit(c) {
+			return "expected a digit after '.'"
+		}
+		v.state = jsonNumberFrac
+		return ""
+	case jsonNumberFrac:
+		switch {
+		case isDigit(c):
+			return ""
+		case c == 'e' || c == 'E':
+			v.state = jsonNumberExp
+			return ""
+		}
+		return v.endNumber(c)
+	case jsonNumberExp:
+		switch {
+		case c == '+' || c == '-':
+			v.state = jsonNumberExpSign
+		case isDigit(c):
+			v.state = jsonNumberExpDigits
+		default:
+			return "expected a digit in exponent"
+		}
+		return ""
+	case jsonNumberExpSign:
+		if !isDigit(c) {
+			return "expected a digit in exponent"
+		}
+		v.state = jsonNumberExpDigits
+		return ""
+	case jsonNumberExpDigits:
+		if isDigit(c) {
+			return ""
+		}
+		return v.endNumber(c)
+	case jsonDone:
+		if isJSONSpace(c) {
+			return ""
+		}
+		return fmt.Sprintf("unexpected %q after the end of the document", c)
+	}
+
+	return "invalid state"
+}
+
+func (v *jsonValidator) startValue(c byte) string {
+	if len(v.stack) == 0 && v.top != 0 && c != v.top {
+		return fmt.Sprintf("expected %q to start the document as required by the schema, got %q", v.top, c)
+	}
+
+	switch {
+	case c == '{':
+		v.stack = append(v.stack, '{')
+		v.state = jsonKeyOrEnd
+	case c == '[':
+		v.stack = append(v.stack, '[')
+		v.state = jsonValueOrEnd
+	case c == '"':
+		v.state = jsonString
+	case c == 't':
+		v.state, v.rest = jsonLiteral, "rue"
+	case c == 'f':
+		v.state, v.rest = jsonLiteral, "alse"
+	case c == 'n':
+		v.state, v.rest = jsonLiteral, "ull"
+	case c == '-':
+		v.state = jsonNumberSign
+	case c == '0':
+		v.state = jsonNumberZero
+	case isDigit(c):
+		v.state = jsonNumberInt
+	default:
+		return fmt.Sprintf("expected a value, got %q", c)
+	}
+
+	return ""
+}
+
+// endNumber ends the number being read at c, which must then be valid after
+// a value.
+func (v *jsonValidator) endNumber(c byte) string {
+	if len(v.stack) == 0 && !isJSONSpace(c) {
+		return fmt.Sprintf("unexpected %q in number", c)
+	}
+
+	v.endValue()
+	return v.step(c)
+}
+
+func (v *jsonValidator) closeContainer(open byte) string {
+	if len(v.stack) == 0 || v.stack[len(v.stack)-1] != open {
+		return "mismatched closing bracket"
+	}
+
+	v.stack = v.stack[:len(v.stack)-1]
+	v.endValue()
+	return ""
+}
+
+func (v *jsonValidator) endValue() {
+	if len(v.stack) == 0 {
+		v.state = jsonDone
+	} else {
+		v.state = jsonAfterValue
+	}
+}
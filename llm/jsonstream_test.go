@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestJSONValidator(t *testing.T) {
+	cases := []struct {
+		name   string
+		format string
+		chunks []string
+		// offset of the first invalid byte, or -1 if the output is valid
+		offset int
+	}{
+		{"object", `"json"`, []string{`{"a": [1, -2.5e+3, 0`, `.1, true, null], "b`, `\"é": {}}`, "\n "}, -1},
+		{"scalars", `"json"`, []string{`"x"`}, -1},
+		{"number at end", `"json"`, []string{`[1`, `2]`}, -1},
+		{"empty containers", `"json"`, []string{`{"a":[],"b":{}}`}, -1},
+		{"trailing comma", `"json"`, []string{`{"a": 1,`, ` }`}, 9},
+		{"missing colon", `"json"`, []string{`{"a" 1}`}, 5},
+		{"unquoted key", `"json"`, []string{`{a: 1}`}, 1},
+		{"mismatched bracket", `"json"`, []string{`[1}`}, 2},
+		{"leading zero", `"json"`, []string{`[01]`}, 2},
+		{"bad literal", `"json"`, []string{`[tru`, `e, nul1]`}, 10},
+		{"bad escape", `"json"`, []string{`"\x"`}, 2},
+		{"after document", `"json"`, []string{`{}`, ` {}`}, 3},
+		{"prose", `"json"`, []string{`Sure! {"a": 1}`}, 0},
+		{"schema object", `{"type":"object"}`, []string{`[1]`}, 0},
+		{"schema array", `{"type":"array"}`, []string{` [1]`}, -1},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newJSONValidator(json.RawMessage(tt.format))
+			var err error
+			for _, chunk := range tt.chunks {
+				if _, err = v.Write([]byte(chunk)); err != nil {
+					break
+				}
+			}
+
+			var formatErr *FormatError
+			switch {
+			case tt.offset < 0 && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.offset >= 0 && !errors.As(err, &formatErr):
+				t.Errorf("expected a format error at offset %d, got %v", tt.offset, err)
+			case tt.offset >= 0 && formatErr.Offset != tt.offset:
+				t.Errorf("error at offset %d, want %d: %v", formatErr.Offset, tt.offset, err)
+			}
+		})
+	}
+}
+
+func TestNewJSONValidator(t *testing.T) {
+	for _, format := range []string{``, `null`, `""`} {
+		if v := newJSONValidator(json.RawMessage(format)); v != nil {
+			t.Errorf("newJSONValidator(%q) = %v; want nil", format, v)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package llm
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -21,19 +23,71 @@ func PredictServerFit(allGpus discover.GpuInfoList, ggml *GGML, adapters, projec
 		var layerCount int
 		estimate := EstimateGPULayers(gpus, ggml, projectors, opts)
 		layerCount, estimatedVRAM = estimate.Layers, estimate.VRAMSize
-		if opts.NumGPU < 0 {
-			if layerCount > 0 && layerCount >= int(ggml.KV().BlockCount()+1) {
-				return true, estimatedVRAM
-			}
-		} else {
-			if layerCount > 0 && layerCount >= opts.NumGPU {
-				return true, estimatedVRAM
-			}
+
+		// layers left on the CPU by gpu_layers don't count against the fit
+		want := int(ggml.KV().BlockCount() + 1)
+		if opts.NumGPU >= 0 {
+			want = opts.NumGPU
+		}
+		if _, layers, err := SplitLayers(opts, len(gpus)); err == nil && layers != nil {
+			want = min(want, sum(layers))
+		}
+
+		if layerCount > 0 && layerCount >= want {
+			return true, estimatedVRAM
 		}
 	}
 	return false, estimatedVRAM
 }
 
+// SplitLayers returns how opts split the layers of a model across n GPUs,
+// in the order they were detected: the weight of each GPU, from the
+// tensor_split or gpu_layers option, and with gpu_layers the most layers
+// each holds. weights is nil if neither option is set.
+func SplitLayers(opts api.Options, n int) (weights []float64, layers []int, err error) {
+	key, s := "tensor_split", opts.TensorSplit
+	switch {
+	case opts.TensorSplit != "" && opts.GPULayers != "":
+		return nil, nil, errors.New("tensor_split and gpu_layers cannot both be set")
+	case opts.GPULayers != "":
+		key, s = "gpu_layers", opts.GPULayers
+	case opts.TensorSplit == "":
+		return nil, nil, nil
+	}
+
+	fields := strings.Split(s, ",")
+	if len(fields) != n {
+		return nil, nil, fmt.Errorf("%s has %d values but %d GPUs were detected", key, len(fields), n)
+	}
+
+	var total float64
+	for _, f := range fields {
+		w, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || w < 0 || key == "gpu_layers" && w != math.Trunc(w) {
+			return nil, nil, fmt.Errorf("invalid %s value %q", key, f)
+		}
+
+		weights = append(weights, w)
+		if key == "gpu_layers" {
+			layers = append(layers, int(w))
+		}
+		total += w
+	}
+
+	if total == 0 {
+		return nil, nil, fmt.Errorf("%s must put layers on at least one GPU", key)
+	}
+
+	return weights, layers, nil
+}
+
+func sum(s []int) (n int) {
+	for _, v := range s {
+		n += v
+	}
+	return n
+}
+
 type MemoryEstimate struct {
 	// How many layers we predict we can load
 	Layers int
@@ -167,6 +221,13 @@ func EstimateGPULayers(gpus []discover.GpuInfo, ggml *GGML, projectors []string,
 	// Output layer handled at the end if we have space
 	gpuZeroOverhead := projectorWeights + projectorGraph
 
+	// a split set by the user weighs where layers go instead of spreading
+	// them evenly
+	weights, maxLayers, err := SplitLayers(opts, len(gpus))
+	if err != nil {
+		slog.Debug("ignoring gpu split", "error", err)
+	}
+
 	// Reduce set of GPUs to only those that have sufficient space to fit overhead and at least one layer
 	var layerCount int
 	layerCounts := make([]int, len(gpus))
@@ -176,6 +237,31 @@ func EstimateGPULayers(gpus []discover.GpuInfo, ggml *GGML, projectors []string,
 		g *discover.GpuInfo
 	}
 	gpusWithSpace := []gs{}
+
+	// pick returns the index in gpusWithSpace of the GPU to put the nth
+	// layer on: the next in turn, or the one furthest below its share of
+	// the split. It returns -1 if every GPU has all the layers it can take.
+	pick := func(n int) int {
+		if weights == nil {
+			return n % len(gpusWithSpace)
+		}
+
+		best := -1
+		var bestShare float64
+		for k, g := range gpusWithSpace {
+			w := weights[g.i]
+			if w == 0 || maxLayers != nil && layerCounts[g.i] >= maxLayers[g.i] {
+				continue
+			}
+
+			if share := float64(layerCounts[g.i]+1) / w; best < 0 || share < bestShare {
+				best, bestShare = k, share
+			}
+		}
+
+		return best
+	}
+
 	for i := range gpus {
 		var gzo uint64
 		if len(gpusWithSpace) == 0 {
@@ -225,8 +311,13 @@ func EstimateGPULayers(gpus []discover.GpuInfo, ggml *GGML, projectors []string,
 		}
 
 		// distribute the layers across the GPU(s) that have space
-		for j := len(gpusWithSpace); j > 0; j-- {
-			g := gpusWithSpace[i%j]
+		for len(gpusWithSpace) > 0 {
+			k := pick(i)
+			if k < 0 {
+				break
+			}
+
+			g := gpusWithSpace[k]
 			used := gpuAllocations[g.i] + max(graphPartialOffload, graphFullOffload)
 			if g.g.FreeMemory > overhead+used+layerSize {
 				gpuAllocations[g.i] += layerSize
@@ -234,7 +325,7 @@ func EstimateGPULayers(gpus []discover.GpuInfo, ggml *GGML, projectors []string,
 				layerCount++
 				break
 			} else {
-				gpusWithSpace = append(gpusWithSpace[:i%j], gpusWithSpace[i%j+1:]...)
+				gpusWithSpace = append(gpusWithSpace[:k], gpusWithSpace[k+1:]...)
 			}
 		}
 	}
@@ -249,7 +340,17 @@ func EstimateGPULayers(gpus []discover.GpuInfo, ggml *GGML, projectors []string,
 	// Determine if we need to consider output then find where it fits
 	if memoryLayerOutput > 0 && (opts.NumGPU < 0 || layerCount < opts.NumGPU) {
 		for j := len(gpusWithSpace); j > 0; j-- {
-			g := gpusWithSpace[layerCount%j]
+			k := layerCount % j
+			if weights != nil {
+				// with a split, the output goes where the split puts it or
+				// stays on the CPU
+				if k = pick(layerCount); k < 0 {
+					break
+				}
+				j = 1
+			}
+
+			g := gpusWithSpace[k]
 			used := gpuAllocations[g.i] + max(graphPartialOffload, graphFullOffload)
 			if g.g.FreeMemory > overhead+used+memoryLayerOutput {
 				gpuAllocations[g.i] += memoryLayerOutput
@@ -126,4 +126,63 @@ func TestEstimateGPULayers(t *testing.T) {
 			}
 		})
 	}
+
+	// room for every layer on both GPUs, placed as the split says
+	for _, s := range []struct {
+		tensorSplit, gpuLayers string
+		layers                 int
+		expect                 string
+	}{
+		{"2,1", "", 6, "4,2"},
+		{"0,1", "", 6, "0,6"},
+		{"", "1,3", 4, "1,3"},
+		{"", "5,1", 6, "5,1"},
+	} {
+		t.Run(fmt.Sprintf("split %v", s), func(t *testing.T) {
+			for i := range gpus {
+				gpus[i].FreeMemory = memoryLayerOutput + gpuMinimumMemory + 7*layerSize + max(graphFullOffload, graphPartialOffload) + 1
+			}
+
+			opts := api.DefaultOptions()
+			opts.TensorSplit, opts.GPULayers = s.tensorSplit, s.gpuLayers
+			estimate := EstimateGPULayers(gpus, ggml, projectors, opts)
+			assert.Equal(t, s.layers, estimate.Layers)
+			assert.Equal(t, s.expect, estimate.TensorSplit)
+		})
+	}
+}
+
+func TestSplitLayers(t *testing.T) {
+	cases := []struct {
+		tensorSplit, gpuLayers string
+		weights                []float64
+		layers                 []int
+		err                    bool
+	}{
+		{"", "", nil, nil, false},
+		{"3,1", "", []float64{3, 1}, nil, false},
+		{"0.75, 0.25", "", []float64{0.75, 0.25}, nil, false},
+		{"", "30,10", []float64{30, 10}, []int{30, 10}, false},
+		{"3", "", nil, nil, true},
+		{"3,1,1", "", nil, nil, true},
+		{"3,-1", "", nil, nil, true},
+		{"0,0", "", nil, nil, true},
+		{"a,b", "", nil, nil, true},
+		{"", "30.5,10", nil, nil, true},
+		{"3,1", "30,10", nil, nil, true},
+	}
+
+	for _, tt := range cases {
+		opts := api.DefaultOptions()
+		opts.TensorSplit, opts.GPULayers = tt.tensorSplit, tt.gpuLayers
+		weights, layers, err := SplitLayers(opts, 2)
+		if tt.err {
+			assert.Error(t, err, "%+v", tt)
+			continue
+		}
+
+		require.NoError(t, err, "%+v", tt)
+		assert.Equal(t, tt.weights, weights)
+		assert.Equal(t, tt.layers, layers)
+	}
 }
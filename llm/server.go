@@ -8,7 +8,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"log/slog"
 	"math/rand"
 	"net"
@@ -29,20 +28,35 @@ import (
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/llama"
+	"github.com/ollama/ollama/logutil"
 	"github.com/ollama/ollama/runners"
+	"github.com/ollama/ollama/tokenizer"
+	"github.com/ollama/ollama/tracing"
 )
 
 type LlamaServer interface {
 	Ping(ctx context.Context) error
 	WaitUntilRunning(ctx context.Context) error
 	Completion(ctx context.Context, req CompletionRequest, fn func(CompletionResponse)) error
-	Embedding(ctx context.Context, input string) ([]float32, error)
+	Embedding(ctx context.Context, input string, images []ImageData) ([]float32, error)
 	Tokenize(ctx context.Context, content string) ([]int, error)
 	Detokenize(ctx context.Context, tokens []int) (string, error)
 	Close() error
 	EstimatedVRAM() uint64 // Total VRAM across all GPUs
 	EstimatedTotal() uint64
 	EstimatedVRAMByGPU(gpuID string) uint64
+	EstimatedLayers() (offloaded, total int)
+	LoadProgress() LoadProgress
+}
+
+// LoadProgress is how far a runner is through loading its model.
+type LoadProgress struct {
+	// Stage is the step the runner is on, such as "loading weights" or
+	// "allocating cache"
+	Stage string
+
+	// Progress is the fraction of the model weights read
+	Progress float32
 }
 
 // llmServer is an instance of the llama.cpp server
@@ -57,12 +71,20 @@ type llmServer struct {
 	modelLock   sync.Mutex   // Temporary until we switch fully to Go server
 	model       *llama.Model // If non-nil, the runner is a new Go server
 
+	// tokenizerPath is an external tokenizer definition used in place of
+	// the model's own tokenizer
+	tokenizerPath string
+	tokenizer     tokenizer.Tokenizer
+
 	estimate    MemoryEstimate
 	totalLayers uint64
 	// gpuCount     int
 	gpus         discover.GpuInfoList // Recorded just before the model loaded, free space will be incorrect
 	loadDuration time.Duration        // Record how long it took the model to load
+
+	progressMu   sync.Mutex
 	loadProgress float32
+	loadStage    string
 
 	sem *semaphore.Weighted
 }
@@ -89,7 +111,7 @@ func LoadModel(model string, maxArraySize int) (*GGML, error) {
 
 // NewLlamaServer will run a server for the given GPUs
 // The gpu list must be a single family.
-func NewLlamaServer(gpus discover.GpuInfoList, model string, ggml *GGML, adapters, projectors []string, opts api.Options, numParallel int) (LlamaServer, error) {
+func NewLlamaServer(gpus discover.GpuInfoList, model string, ggml *GGML, adapters, projectors []string, tokenizerPath string, opts api.Options, numParallel int) (LlamaServer, error) {
 	var err error
 	var cpuRunner string
 	var estimate MemoryEstimate
@@ -180,7 +202,7 @@ func NewLlamaServer(gpus discover.GpuInfoList, model string, ggml *GGML, adapter
 		params = append(params, "--n-gpu-layers", strconv.Itoa(opts.NumGPU))
 	}
 
-	if envconfig.Debug() {
+	if logutil.Level.Level() <= slog.LevelDebug {
 		params = append(params, "--verbose")
 	}
 
@@ -199,6 +221,10 @@ func NewLlamaServer(gpus discover.GpuInfoList, model string, ggml *GGML, adapter
 		params = append(params, "--mmproj", projectors[0])
 	}
 
+	if tokenizerPath != "" {
+		params = append(params, "--tokenizer", tokenizerPath)
+	}
+
 	defaultThreads := systemInfo.GetOptimalThreadCount()
 	if opts.NumThread > 0 {
 		params = append(params, "--threads", strconv.Itoa(opts.NumThread))
@@ -270,6 +296,17 @@ func NewLlamaServer(gpus discover.GpuInfoList, model string, ggml *GGML, adapter
 		params = append(params, "--multiuser-cache")
 	}
 
+	if dir := envconfig.SamplerTrace(); dir != "" {
+		params = append(params, "--trace-dir", dir)
+	}
+
+	params = append(params, "--checkpoint-dir", envconfig.Checkpoints())
+	params = append(params, "--session-dir", envconfig.Sessions(), "--max-sessions", strconv.FormatUint(uint64(envconfig.MaxSessions()), 10))
+
+	if dir := envconfig.PromptCache(); dir != "" {
+		params = append(params, "--prompt-cache-dir", dir, "--max-prompt-caches", strconv.FormatUint(uint64(envconfig.MaxPromptCaches()), 10))
+	}
+
 	for i := range servers {
 		builtin := servers[i] == runners.BuiltinName()
 		server := availableServers[servers[i]]
@@ -320,23 +357,32 @@ func NewLlamaServer(gpus discover.GpuInfoList, model string, ggml *GGML, adapter
 			libraryPaths = append(gpus[0].DependencyPath, libraryPaths...)
 		}
 
+		// keep logs JSON lines if the runner writes other output
+		var stdout, stderr io.Writer = os.Stdout, os.Stderr
+		if logutil.JSON() {
+			logger := slog.Default().With("runner", port)
+			stdout = logutil.NewLineWriter(os.Stdout, logger)
+			stderr = logutil.NewLineWriter(os.Stderr, logger)
+		}
+
 		// TODO - once fully switched to the Go runner, load the model here for tokenize/detokenize cgo access
 		s := &llmServer{
-			port:        port,
-			cmd:         exec.Command(server, finalParams...),
-			status:      NewStatusWriter(os.Stderr),
-			options:     opts,
-			modelPath:   model,
-			estimate:    estimate,
-			numParallel: numParallel,
-			sem:         semaphore.NewWeighted(int64(numParallel)),
-			totalLayers: ggml.KV().BlockCount() + 1,
-			gpus:        gpus,
-			done:        make(chan error, 1),
+			port:          port,
+			cmd:           exec.Command(server, finalParams...),
+			status:        NewStatusWriter(stderr),
+			options:       opts,
+			modelPath:     model,
+			tokenizerPath: tokenizerPath,
+			estimate:      estimate,
+			numParallel:   numParallel,
+			sem:           semaphore.NewWeighted(int64(numParallel)),
+			totalLayers:   ggml.KV().BlockCount() + 1,
+			gpus:          gpus,
+			done:          make(chan error, 1),
 		}
 
 		s.cmd.Env = os.Environ()
-		s.cmd.Stdout = os.Stdout
+		s.cmd.Stdout = stdout
 		s.cmd.Stderr = s.status
 		s.cmd.SysProcAttr = LlamaServerSysProcAttr
 
@@ -461,6 +507,7 @@ type ServerStatusResp struct {
 	SlotsProcessing int     `json:"slots_processing"`
 	Error           string  `json:"error"`
 	Progress        float32 `json:"progress"`
+	Stage           string  `json:"stage"`
 }
 
 func (s *llmServer) getServerStatus(ctx context.Context) (ServerStatus, error) {
@@ -508,7 +555,10 @@ func (s *llmServer) getServerStatus(ctx context.Context) (ServerStatus, error) {
 	case "no slot available":
 		return ServerStatusNoSlotsAvailable, nil
 	case "loading model":
+		s.progressMu.Lock()
 		s.loadProgress = status.Progress
+		s.loadStage = status.Stage
+		s.progressMu.Unlock()
 		return ServerStatusLoadingModel, nil
 	default:
 		return ServerStatusError, fmt.Errorf("server error: %+v", status)
@@ -571,7 +621,7 @@ func (s *llmServer) WaitUntilRunning(ctx context.Context) error {
 			if s.status != nil && s.status.LastErrMsg != "" {
 				msg = s.status.LastErrMsg
 			}
-			return fmt.Errorf("timed out waiting for llama runner to start - progress %0.2f - %s", s.loadProgress, msg)
+			return fmt.Errorf("timed out waiting for llama runner to start - progress %0.2f - %s", s.LoadProgress().Progress, msg)
 		}
 		if s.cmd.ProcessState != nil {
 			msg := ""
@@ -582,8 +632,9 @@ func (s *llmServer) WaitUntilRunning(ctx context.Context) error {
 		}
 		ctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
 		defer cancel()
-		priorProgress := s.loadProgress
+		priorProgress := s.LoadProgress().Progress
 		status, _ := s.getServerStatus(ctx)
+		progress := s.LoadProgress().Progress
 		if lastStatus != status && status != ServerStatusReady {
 			// Only log on status changes
 			slog.Info("waiting for server to become available", "status", status.ToString())
@@ -596,10 +647,10 @@ func (s *llmServer) WaitUntilRunning(ctx context.Context) error {
 		default:
 			lastStatus = status
 			// Reset the timer as long as we're making forward progress on the load
-			if priorProgress != s.loadProgress {
-				slog.Debug(fmt.Sprintf("model load progress %0.2f", s.loadProgress))
+			if priorProgress != progress {
+				slog.Debug(fmt.Sprintf("model load progress %0.2f", progress))
 				stallTimer = time.Now().Add(stallDuration)
-			} else if !fullyLoaded && int(s.loadProgress*100.0) >= 100 {
+			} else if !fullyLoaded && int(progress*100.0) >= 100 {
 				slog.Debug("model load completed, waiting for server to become available", "status", status.ToString())
 				stallTimer = time.Now().Add(stallDuration)
 				fullyLoaded = true
@@ -610,6 +661,45 @@ func (s *llmServer) WaitUntilRunning(ctx context.Context) error {
 	}
 }
 
+var ErrInvalidFormat = errors.New("invalid format")
+
+// FormatGrammar returns the grammar that constrains output to format: "json",
+// a JSON Schema object or a string holding a GBNF grammar. It returns "" if
+// format is unset.
+func FormatGrammar(format json.RawMessage) (string, error) {
+	switch string(format) {
+	case "", `null`, `""`:
+		// Field was set, but "missing" a value. We accept
+		// these as "not set".
+		return "", nil
+	case `"json"`:
+		return grammarJSON, nil
+	}
+
+	switch format[0] {
+	case '{':
+		// User provided a JSON schema
+		g := llama.SchemaToGrammar(format)
+		if g == nil {
+			return "", fmt.Errorf("%w: invalid JSON schema", ErrInvalidFormat)
+		}
+		return string(g), nil
+	case '"':
+		// User provided a GBNF grammar
+		var g string
+		if err := json.Unmarshal(format, &g); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidFormat, err)
+		}
+
+		if err := llama.ValidateGrammar(g); err != nil {
+			return "", fmt.Errorf("%w: invalid grammar: %w", ErrInvalidFormat, err)
+		}
+		return g, nil
+	default:
+		return "", fmt.Errorf("%w: %q; expected \"json\", a JSON Schema object or a GBNF grammar", ErrInvalidFormat, format)
+	}
+}
+
 var grammarJSON = `
 root   ::= object
 value  ::= object | array | string | number | ("true" | "false" | "null") ws
@@ -647,12 +737,19 @@ type completion struct {
 	Prompt       string `json:"prompt"`
 	Stop         bool   `json:"stop"`
 	StoppedLimit bool   `json:"stopped_limit"`
+	Tokens       []int  `json:"tokens"`
+
+	Logprobs []api.Logprob `json:"logprobs"`
+
+	StoppedDegenerate bool              `json:"stopped_degenerate"`
+	Degenerate        *api.Degeneration `json:"degenerate"`
 
 	Timings struct {
-		PredictedN  int     `json:"predicted_n"`
-		PredictedMS float64 `json:"predicted_ms"`
-		PromptN     int     `json:"prompt_n"`
-		PromptMS    float64 `json:"prompt_ms"`
+		PredictedN    int     `json:"predicted_n"`
+		PredictedMS   float64 `json:"predicted_ms"`
+		PromptN       int     `json:"prompt_n"`
+		PromptMS      float64 `json:"prompt_ms"`
+		PromptCachedN int     `json:"prompt_cached_n"`
 	}
 }
 
@@ -661,6 +758,34 @@ type CompletionRequest struct {
 	Format  json.RawMessage
 	Images  []ImageData
 	Options *api.Options
+
+	// Checkpoint is the id under which the progress of the generation is
+	// saved, if any
+	Checkpoint string
+
+	// Session is the id under which the KV cache is saved for the next
+	// request of a conversation, if any
+	Session string
+
+	// CachePrefix is the text at the beginning of Prompt, such as its system
+	// prompt, whose KV cache is saved to disk for other prompts starting
+	// with it, if prompt caching is enabled
+	CachePrefix string
+
+	// Tokens is a prompt of token ids evaluated as is in place of Prompt
+	Tokens []int
+
+	// ReturnTokens returns the ids of the generated tokens with the final
+	// response
+	ReturnTokens bool
+
+	// Adapter is the path of a LoRA adapter applied for this request only
+	Adapter string
+
+	// Logprobs returns the log probability of each generated token with the
+	// TopLogprobs most likely alternatives
+	Logprobs    bool
+	TopLogprobs int
 }
 
 type CompletionResponse struct {
@@ -669,8 +794,19 @@ type CompletionResponse struct {
 	Done               bool
 	PromptEvalCount    int
 	PromptEvalDuration time.Duration
+	PromptCacheCount   int
 	EvalCount          int
 	EvalDuration       time.Duration
+
+	// Tokens are the ids of the generated tokens, if requested
+	Tokens []int
+
+	// Logprobs are the log probabilities of the tokens of Content, if
+	// requested
+	Logprobs []api.Logprob
+
+	// Degenerate is the degenerate output detected by the watchdog, if any
+	Degenerate *api.Degeneration
 }
 
 func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn func(CompletionResponse)) error {
@@ -694,37 +830,38 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 		"mirostat_eta":      req.Options.MirostatEta,
 		"seed":              req.Options.Seed,
 		"stop":              req.Options.Stop,
+		"stop_tokens":       req.Options.StopTokens,
+		"banned_strings":    req.Options.BannedStrings,
+		"token_healing":     req.Options.TokenHealing,
+		"watchdog":          req.Options.Watchdog,
+		"watchdog_window":   req.Options.WatchdogWindow,
+		"language":          req.Options.Language,
 		"image_data":        req.Images,
 		"cache_prompt":      true,
+		"checkpoint":        req.Checkpoint,
+		"session":           req.Session,
+		"cache_prefix":      req.CachePrefix,
+		"tokens":            req.Tokens,
+		"return_tokens":     req.ReturnTokens,
+		"adapter":           req.Adapter,
+		"logprobs":          req.Logprobs,
+		"top_logprobs":      req.TopLogprobs,
 	}
 
-	if len(req.Format) > 0 {
-		switch string(req.Format) {
-		case `null`, `""`:
-			// Field was set, but "missing" a value. We accept
-			// these as "not set".
-			break
-		case `"json"`:
-			request["grammar"] = grammarJSON
-		default:
-			if req.Format[0] != '{' {
-				return fmt.Errorf("invalid format: %q; expected \"json\" or a valid JSON Schema object", req.Format)
-			}
+	grammar, err := FormatGrammar(req.Format)
+	if err != nil {
+		return err
+	}
 
-			// User provided a JSON schema
-			g := llama.SchemaToGrammar(req.Format)
-			if g == nil {
-				return fmt.Errorf("invalid JSON schema in format")
-			}
-			request["grammar"] = string(g)
-		}
+	if grammar != "" {
+		request["grammar"] = grammar
 	}
 
 	if err := s.sem.Acquire(ctx, 1); err != nil {
 		if errors.Is(err, context.Canceled) {
-			slog.Info("aborting completion request due to client closing the connection")
+			slog.InfoContext(ctx, "aborting completion request due to client closing the connection")
 		} else {
-			slog.Error("Failed to acquire semaphore", "error", err)
+			slog.ErrorContext(ctx, "Failed to acquire semaphore", "error", err)
 		}
 		return err
 	}
@@ -758,9 +895,14 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 		return fmt.Errorf("error creating POST request: %v", err)
 	}
 	serverReq.Header.Set("Content-Type", "application/json")
+	serverReq.Header.Set(logutil.RequestIDHeader, logutil.RequestID(ctx))
+
+	_, span := tracing.StartClient(ctx, serverReq.Header, "completion")
+	defer span.End()
 
 	res, err := http.DefaultClient.Do(serverReq)
 	if err != nil {
+		span.SetError(err)
 		return fmt.Errorf("POST predict: %v", err)
 	}
 	defer res.Body.Close()
@@ -770,7 +912,7 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 		if err != nil {
 			return fmt.Errorf("failed reading llm error response: %w", err)
 		}
-		log.Printf("llm predict error: %s", bodyBytes)
+		slog.ErrorContext(ctx, "llm predict error", "error", string(bodyBytes))
 		return fmt.Errorf("%s", bodyBytes)
 	}
 
@@ -778,6 +920,10 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 	buf := make([]byte, 0, maxBufferSize)
 	scanner.Buffer(buf, maxBufferSize)
 
+	// output requested as JSON is validated as it is generated so it can
+	// be stopped once it can no longer become valid
+	validator := newJSONValidator(req.Format)
+
 	// keep track of the last token generated, this is used to abort if the model starts looping
 	var lastToken string
 	var tokenRepeat int
@@ -813,13 +959,20 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 
 			// 30 picked as an arbitrary max token repeat limit, modify as needed
 			if tokenRepeat > 30 {
-				slog.Debug("prediction aborted, token repeat limit reached")
+				slog.DebugContext(ctx, "prediction aborted, token repeat limit reached")
 				return ctx.Err()
 			}
 
-			if c.Content != "" {
+			if c.Content != "" || len(c.Logprobs) > 0 {
+				if validator != nil {
+					if _, err := validator.Write([]byte(c.Content)); err != nil {
+						return err
+					}
+				}
+
 				fn(CompletionResponse{
-					Content: c.Content,
+					Content:  c.Content,
+					Logprobs: c.Logprobs,
 				})
 			}
 
@@ -827,15 +980,27 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 				doneReason := "stop"
 				if c.StoppedLimit {
 					doneReason = "length"
+				} else if c.StoppedDegenerate {
+					doneReason = "degenerate"
 				}
 
+				span.SetAttributes(
+					tracing.String("done_reason", doneReason),
+					tracing.Int("prompt_eval_count", c.Timings.PromptN),
+					tracing.Int("prompt_cache_count", c.Timings.PromptCachedN),
+					tracing.Int("eval_count", c.Timings.PredictedN),
+				)
+
 				fn(CompletionResponse{
 					Done:               true,
 					DoneReason:         doneReason,
 					PromptEvalCount:    c.Timings.PromptN,
 					PromptEvalDuration: parseDurationMs(c.Timings.PromptMS),
+					PromptCacheCount:   c.Timings.PromptCachedN,
 					EvalCount:          c.Timings.PredictedN,
 					EvalDuration:       parseDurationMs(c.Timings.PredictedMS),
+					Tokens:             c.Tokens,
+					Degenerate:         c.Degenerate,
 				})
 				return nil
 			}
@@ -861,19 +1026,22 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 }
 
 type EmbeddingRequest struct {
-	Content string `json:"content"`
+	Content string      `json:"content"`
+	Images  []ImageData `json:"image_data,omitempty"`
 }
 
 type EmbeddingResponse struct {
 	Embedding []float32 `json:"embedding"`
 }
 
-func (s *llmServer) Embedding(ctx context.Context, input string) ([]float32, error) {
+// Embedding embeds input, in which images are referenced by [img-N] tags
+// as in a completion prompt.
+func (s *llmServer) Embedding(ctx context.Context, input string, images []ImageData) ([]float32, error) {
 	if err := s.sem.Acquire(ctx, 1); err != nil {
 		if errors.Is(err, context.Canceled) {
-			slog.Info("aborting embedding request due to client closing the connection")
+			slog.InfoContext(ctx, "aborting embedding request due to client closing the connection")
 		} else {
-			slog.Error("Failed to acquire semaphore", "error", err)
+			slog.ErrorContext(ctx, "Failed to acquire semaphore", "error", err)
 		}
 		return nil, err
 	}
@@ -887,7 +1055,7 @@ func (s *llmServer) Embedding(ctx context.Context, input string) ([]float32, err
 		return nil, fmt.Errorf("unexpected server status: %s", status.ToString())
 	}
 
-	data, err := json.Marshal(EmbeddingRequest{Content: input})
+	data, err := json.Marshal(EmbeddingRequest{Content: input, Images: images})
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling embed data: %w", err)
 	}
@@ -897,6 +1065,7 @@ func (s *llmServer) Embedding(ctx context.Context, input string) ([]float32, err
 		return nil, fmt.Errorf("error creating embed request: %w", err)
 	}
 	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(logutil.RequestIDHeader, logutil.RequestID(ctx))
 
 	resp, err := http.DefaultClient.Do(r)
 	if err != nil {
@@ -910,7 +1079,7 @@ func (s *llmServer) Embedding(ctx context.Context, input string) ([]float32, err
 	}
 
 	if resp.StatusCode >= 400 {
-		log.Printf("llm embedding error: %s", body)
+		slog.ErrorContext(ctx, "llm embedding error", "error", string(body))
 		return nil, fmt.Errorf("%s", body)
 	}
 
@@ -930,9 +1099,40 @@ type TokenizeResponse struct {
 	Tokens []int `json:"tokens"`
 }
 
+// loadTokenizer loads the external tokenizer of the model along with the
+// vocabulary it relies on. s.modelLock must be held.
+func (s *llmServer) loadTokenizer() (tokenizer.Tokenizer, error) {
+	if s.tokenizer != nil {
+		return s.tokenizer, nil
+	}
+
+	if s.model == nil {
+		m, err := llama.LoadModelFromFile(s.modelPath, llama.ModelParams{VocabOnly: true})
+		if err != nil {
+			return nil, err
+		}
+		s.model = m
+	}
+
+	t, err := tokenizer.Open(s.tokenizerPath, s.model)
+	if err != nil {
+		return nil, err
+	}
+
+	s.tokenizer = t
+	return t, nil
+}
+
 func (s *llmServer) Tokenize(ctx context.Context, content string) ([]int, error) {
 	s.modelLock.Lock()
 	defer s.modelLock.Unlock()
+	if s.tokenizerPath != "" {
+		t, err := s.loadTokenizer()
+		if err != nil {
+			return nil, err
+		}
+		return t.Encode(content, false)
+	}
 	if s.model != nil {
 		return s.model.Tokenize(content, false, true)
 	}
@@ -979,7 +1179,7 @@ func (s *llmServer) Tokenize(ctx context.Context, content string) ([]int, error)
 	}
 
 	if resp.StatusCode >= 400 {
-		log.Printf("llm encode error: %s", body)
+		slog.ErrorContext(ctx, "llm encode error", "error", string(body))
 		return nil, fmt.Errorf("%s", body)
 	}
 
@@ -1002,6 +1202,13 @@ type DetokenizeResponse struct {
 func (s *llmServer) Detokenize(ctx context.Context, tokens []int) (string, error) {
 	s.modelLock.Lock()
 	defer s.modelLock.Unlock()
+	if s.tokenizerPath != "" {
+		t, err := s.loadTokenizer()
+		if err != nil {
+			return "", err
+		}
+		return t.Decode(tokens)
+	}
 	if s.model != nil {
 		var resp string
 		for _, token := range tokens {
@@ -1055,7 +1262,7 @@ func (s *llmServer) Detokenize(ctx context.Context, tokens []int) (string, error
 	}
 
 	if resp.StatusCode >= 400 {
-		log.Printf("llm decode error: %s", body)
+		slog.ErrorContext(ctx, "llm decode error", "error", string(body))
 		return "", fmt.Errorf("%s", body)
 	}
 
@@ -1100,6 +1307,16 @@ func (s *llmServer) EstimatedTotal() uint64 {
 	return s.estimate.TotalSize
 }
 
+func (s *llmServer) EstimatedLayers() (offloaded, total int) {
+	return s.estimate.Layers, int(s.totalLayers)
+}
+
+func (s *llmServer) LoadProgress() LoadProgress {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+	return LoadProgress{Stage: s.loadStage, Progress: s.loadProgress}
+}
+
 func (s *llmServer) EstimatedVRAMByGPU(gpuID string) uint64 {
 	for i, gpu := range s.gpus {
 		if gpu.ID == gpuID {
@@ -2,8 +2,8 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
-	"fmt"
 	"strings"
 	"testing"
 
@@ -21,21 +21,20 @@ func TestLLMServerCompletionFormat(t *testing.T) {
 		sem: semaphore.NewWeighted(1), // required to prevent nil panic
 	}
 
-	checkInvalid := func(format string) {
+	checkInvalid := func(format, want string) {
 		t.Helper()
 		err := s.Completion(ctx, CompletionRequest{
 			Options: new(api.Options),
 			Format:  []byte(format),
 		}, nil)
 
-		want := fmt.Sprintf("invalid format: %q; expected \"json\" or a valid JSON Schema", format)
 		if err == nil || !strings.Contains(err.Error(), want) {
 			t.Fatalf("err = %v; want %q", err, want)
 		}
 	}
 
-	checkInvalid("X")   // invalid format
-	checkInvalid(`"X"`) // invalid JSON Schema
+	checkInvalid("X", `invalid format: "X"; expected "json", a JSON Schema object or a GBNF grammar`)
+	checkInvalid(`"X"`, "invalid format: invalid grammar")
 
 	cancel() // prevent further processing if request makes it past the format check
 
@@ -55,6 +54,9 @@ func TestLLMServerCompletionFormat(t *testing.T) {
 		// JSON
 		`"json"`,
 		`{"type":"object"}`,
+
+		// GBNF
+		`"root ::= \"yes\" | \"no\""`,
 	}
 	for _, valid := range valids {
 		err := s.Completion(ctx, CompletionRequest{
@@ -70,3 +72,38 @@ func TestLLMServerCompletionFormat(t *testing.T) {
 	}, nil)
 	checkValid(err)
 }
+
+func TestFormatGrammar(t *testing.T) {
+	cases := []struct {
+		name    string
+		grammar string
+		err     string
+	}{
+		{"valid", "# answer\nroot ::= answer\nanswer ::= \"yes\" | \"no\"\n", ""},
+		{"recursive", "root ::= \"(\" root \")\" | \"x\"", ""},
+		{"syntax", "root = \"yes\"", "expecting ::="},
+		{"undefined rule", "root ::= answer", "undefined rule 'answer'"},
+		{"no root", "answer ::= \"yes\"", "does not contain a 'root' rule"},
+		{"unsatisfiable", "root ::= \"a\" root", "cannot match any output"},
+		{"left recursive", "root ::= root \"a\" | \"a\"", "left recursive"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := json.Marshal(tt.grammar)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			g, err := FormatGrammar(format)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err == "" && g != tt.grammar:
+				t.Errorf("expected the grammar to be used as is, got %q", g)
+			case tt.err != "" && (!errors.Is(err, ErrInvalidFormat) || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
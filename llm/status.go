@@ -2,16 +2,16 @@ package llm
 
 import (
 	"bytes"
-	"os"
+	"io"
 )
 
 // StatusWriter is a writer that captures error messages from the llama runner process
 type StatusWriter struct {
 	LastErrMsg string
-	out        *os.File
+	out        io.Writer
 }
 
-func NewStatusWriter(out *os.File) *StatusWriter {
+func NewStatusWriter(out io.Writer) *StatusWriter {
 	return &StatusWriter{
 		out: out,
 	}
@@ -0,0 +1,167 @@
+// Package logutil configures the structured logging of the server and the
+// runners.
+//
+// Logs are text by default, or JSON lines if OLLAMA_LOG_FORMAT is json. The
+// lines logged with the context of a request, such as with
+// [slog.InfoContext], have its request ID. The level can be changed while
+// running with [Level].
+package logutil
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/envconfig"
+)
+
+// RequestIDHeader is the header request IDs are sent and returned with.
+const RequestIDHeader = "X-Request-Id"
+
+// Level is the level logs are written at.
+var Level = new(slog.LevelVar)
+
+// JSON reports whether logs are written as JSON lines.
+func JSON() bool {
+	return strings.EqualFold(envconfig.LogFormat(), "json")
+}
+
+// NewLogger returns a logger writing to w at level, in the format of
+// OLLAMA_LOG_FORMAT.
+func NewLogger(w io.Writer, level slog.Level) *slog.Logger {
+	Level.Set(level)
+
+	opts := &slog.HandlerOptions{
+		Level:     Level,
+		AddSource: true,
+		ReplaceAttr: func(_ []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.SourceKey {
+				source, ok := attr.Value.Any().(*slog.Source)
+				if !ok || source.File == "" {
+					return slog.Attr{}
+				}
+
+				source.File = filepath.Base(source.File)
+			}
+
+			return attr
+		},
+	}
+
+	if JSON() {
+		return slog.New(handler{slog.NewJSONHandler(w, opts)})
+	}
+
+	logger := slog.New(handler{slog.NewTextHandler(w, opts)})
+	if f := envconfig.LogFormat(); f != "" && !strings.EqualFold(f, "text") {
+		logger.Warn("unknown log format, using text", "format", f)
+	}
+
+	return logger
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context with the request ID id, which the lines
+// logged with it have.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID of ctx, or "" if it has none.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// handler adds the request ID of the context of records to them.
+type handler struct {
+	slog.Handler
+}
+
+func (h handler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return handler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h handler) WithGroup(name string) slog.Handler {
+	return handler{h.Handler.WithGroup(name)}
+}
+
+// lineWriter logs the lines written to it as records of logger, except for
+// those that are already JSON records, which are written to w as they are.
+type lineWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	logger *slog.Logger
+	buf    []byte
+}
+
+// NewLineWriter returns a writer for the output of another process, such as
+// a runner, that keeps the logs JSON lines: lines that aren't JSON, such as
+// those of llama.cpp, are logged with logger.
+func NewLineWriter(w io.Writer, logger *slog.Logger) io.Writer {
+	return &lineWriter{w: w, logger: logger}
+}
+
+func (lw *lineWriter) Write(b []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.buf = append(lw.buf, b...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		if err := lw.writeLine(lw.buf[:i+1]); err != nil {
+			return 0, err
+		}
+
+		lw.buf = lw.buf[i+1:]
+	}
+
+	return len(b), nil
+}
+
+func (lw *lineWriter) writeLine(line []byte) error {
+	if bytes.HasPrefix(line, []byte("{")) {
+		_, err := lw.w.Write(line)
+		return err
+	}
+
+	msg := string(bytes.TrimSpace(line))
+	if msg == "" {
+		return nil
+	}
+
+	ctx := context.Background()
+	if !lw.logger.Handler().Enabled(ctx, slog.LevelInfo) {
+		return nil
+	}
+
+	// records without a program counter have no source
+	r := slog.NewRecord(time.Now(), slog.LevelInfo, msg, 0)
+	return lw.logger.Handler().Handle(ctx, r)
+}
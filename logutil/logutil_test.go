@@ -0,0 +1,97 @@
+package logutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	t.Setenv("OLLAMA_LOG_FORMAT", "json")
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, slog.LevelInfo)
+
+	ctx := WithRequestID(context.Background(), "abc")
+	logger.InfoContext(ctx, "hello", "n", 1)
+	logger.With("runner", 1234).InfoContext(ctx, "with attrs")
+	logger.Info("without request")
+	logger.DebugContext(ctx, "hidden")
+
+	Level.Set(slog.LevelDebug)
+	logger.DebugContext(ctx, "shown")
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+
+		records = append(records, record)
+	}
+
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d: %s", len(records), buf.String())
+	}
+
+	for i, expected := range []string{"abc", "abc", "", "abc"} {
+		if got, _ := records[i]["request_id"].(string); got != expected {
+			t.Errorf("%s: expected request id %q, got %q", records[i]["msg"], expected, got)
+		}
+	}
+
+	if records[1]["runner"] != float64(1234) {
+		t.Errorf("expected runner attribute, got %v", records[1])
+	}
+
+	if records[3]["msg"] != "shown" {
+		t.Errorf("expected debug record after the level changed, got %v", records[3])
+	}
+}
+
+func TestText(t *testing.T) {
+	t.Setenv("OLLAMA_LOG_FORMAT", "")
+
+	var buf bytes.Buffer
+	NewLogger(&buf, slog.LevelInfo).InfoContext(WithRequestID(context.Background(), "abc"), "hello")
+
+	if got := buf.String(); !strings.Contains(got, "msg=hello") || !strings.Contains(got, "request_id=abc") || !strings.Contains(got, "source=logutil_test.go:") {
+		t.Errorf("unexpected text record %q", got)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	t.Setenv("OLLAMA_LOG_FORMAT", "json")
+
+	var buf bytes.Buffer
+	w := NewLineWriter(&buf, NewLogger(&buf, slog.LevelInfo).With("runner", 1234))
+
+	// writes may split lines
+	for _, s := range []string{`{"msg":"from runner"}` + "\n" + "llama_model_load: ", "loading\n\n", "partial"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+
+	if lines[0] != `{"msg":"from runner"}` {
+		t.Errorf("expected JSON lines to be written as they are, got %s", lines[0])
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatal(err)
+	}
+
+	if record["msg"] != "llama_model_load: loading" || record["runner"] != float64(1234) || record["source"] != nil {
+		t.Errorf("unexpected record %v", record)
+	}
+}
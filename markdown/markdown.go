@@ -0,0 +1,272 @@
+// Package markdown implements a small, dependency-free renderer for the
+// subset of markdown typically produced by language models. Output is
+// always sanitized: raw HTML in the input is escaped and link targets are
+// restricted to a safe set of schemes.
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatPlain    = "plain"
+)
+
+// Highlighter renders a fenced code block to HTML. lang is the info string
+// of the fence and may be empty. Implementations are responsible for
+// escaping code.
+type Highlighter func(lang, code string) string
+
+// DefaultHighlighter escapes the code and wraps it in a pre/code pair,
+// tagging the language so client-side highlighters can pick it up.
+func DefaultHighlighter(lang, code string) string {
+	if lang == "" {
+		return "<pre><code>" + html.EscapeString(code) + "</code></pre>\n"
+	}
+
+	return fmt.Sprintf("<pre><code class=\"language-%s\">%s</code></pre>\n", html.EscapeString(lang), html.EscapeString(code))
+}
+
+// Render converts src to the named format. An empty format or
+// [FormatMarkdown] returns src unchanged.
+func Render(format, src string, hl Highlighter) (string, error) {
+	switch format {
+	case "", FormatMarkdown:
+		return src, nil
+	case FormatHTML:
+		return ToHTML(src, hl), nil
+	case FormatPlain:
+		return ToPlain(src), nil
+	default:
+		return "", fmt.Errorf("unsupported render format %q", format)
+	}
+}
+
+type blockKind int
+
+const (
+	blockParagraph blockKind = iota
+	blockHeading
+	blockCode
+	blockQuote
+	blockUnordered
+	blockOrdered
+	blockRule
+)
+
+type block struct {
+	kind  blockKind
+	level int
+	lang  string
+	lines []string
+}
+
+var (
+	headingRe   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	unorderedRe = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedRe   = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	ruleRe      = regexp.MustCompile(`^\s*(-\s*){3,}$|^\s*(\*\s*){3,}$|^\s*(_\s*){3,}$`)
+)
+
+func parse(src string) []block {
+	var blocks []block
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			continue
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			fence := trimmed[:3]
+			b := block{kind: blockCode, lang: strings.TrimSpace(trimmed[3:])}
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+					break
+				}
+				b.lines = append(b.lines, lines[i])
+			}
+			blocks = append(blocks, b)
+		case headingRe.MatchString(trimmed):
+			m := headingRe.FindStringSubmatch(trimmed)
+			blocks = append(blocks, block{kind: blockHeading, level: len(m[1]), lines: []string{m[2]}})
+		case ruleRe.MatchString(trimmed):
+			blocks = append(blocks, block{kind: blockRule})
+		case strings.HasPrefix(trimmed, ">"):
+			b := block{kind: blockQuote}
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				b.lines = append(b.lines, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")))
+			}
+			i--
+			blocks = append(blocks, b)
+		case unorderedRe.MatchString(line), orderedRe.MatchString(line):
+			re, kind := unorderedRe, blockUnordered
+			if orderedRe.MatchString(line) {
+				re, kind = orderedRe, blockOrdered
+			}
+
+			b := block{kind: kind}
+			for ; i < len(lines) && re.MatchString(lines[i]); i++ {
+				b.lines = append(b.lines, re.FindStringSubmatch(lines[i])[1])
+			}
+			i--
+			blocks = append(blocks, b)
+		default:
+			b := block{kind: blockParagraph}
+			for ; i < len(lines); i++ {
+				t := strings.TrimSpace(lines[i])
+				if t == "" || startsBlock(lines[i]) {
+					break
+				}
+				b.lines = append(b.lines, t)
+			}
+			i--
+			blocks = append(blocks, b)
+		}
+	}
+
+	return blocks
+}
+
+func startsBlock(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, "```") ||
+		strings.HasPrefix(trimmed, "~~~") ||
+		strings.HasPrefix(trimmed, ">") ||
+		headingRe.MatchString(trimmed) ||
+		ruleRe.MatchString(trimmed) ||
+		unorderedRe.MatchString(line) ||
+		orderedRe.MatchString(line)
+}
+
+// ToHTML renders src as sanitized HTML. If hl is nil, [DefaultHighlighter]
+// is used for fenced code blocks.
+func ToHTML(src string, hl Highlighter) string {
+	if hl == nil {
+		hl = DefaultHighlighter
+	}
+
+	var sb strings.Builder
+	for _, b := range parse(src) {
+		switch b.kind {
+		case blockHeading:
+			fmt.Fprintf(&sb, "<h%d>%s</h%d>\n", b.level, inlineHTML(b.lines[0]), b.level)
+		case blockCode:
+			code := strings.Join(b.lines, "\n")
+			if len(b.lines) > 0 {
+				code += "\n"
+			}
+			sb.WriteString(hl(b.lang, code))
+		case blockRule:
+			sb.WriteString("<hr>\n")
+		case blockQuote:
+			fmt.Fprintf(&sb, "<blockquote><p>%s</p></blockquote>\n", inlineHTML(strings.Join(b.lines, " ")))
+		case blockUnordered, blockOrdered:
+			tag := "ul"
+			if b.kind == blockOrdered {
+				tag = "ol"
+			}
+
+			sb.WriteString("<" + tag + ">\n")
+			for _, item := range b.lines {
+				fmt.Fprintf(&sb, "<li>%s</li>\n", inlineHTML(item))
+			}
+			sb.WriteString("</" + tag + ">\n")
+		default:
+			fmt.Fprintf(&sb, "<p>%s</p>\n", inlineHTML(strings.Join(b.lines, " ")))
+		}
+	}
+
+	return sb.String()
+}
+
+// ToPlain renders src as plain text, dropping markdown syntax while
+// preserving the text and code content.
+func ToPlain(src string) string {
+	var parts []string
+	for _, b := range parse(src) {
+		switch b.kind {
+		case blockCode:
+			parts = append(parts, strings.Join(b.lines, "\n"))
+		case blockRule:
+			continue
+		case blockUnordered:
+			items := make([]string, len(b.lines))
+			for i, item := range b.lines {
+				items[i] = "- " + inlinePlain(item)
+			}
+			parts = append(parts, strings.Join(items, "\n"))
+		case blockOrdered:
+			items := make([]string, len(b.lines))
+			for i, item := range b.lines {
+				items[i] = fmt.Sprintf("%d. %s", i+1, inlinePlain(item))
+			}
+			parts = append(parts, strings.Join(items, "\n"))
+		default:
+			parts = append(parts, inlinePlain(strings.Join(b.lines, " ")))
+		}
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+var (
+	codeSpanRe = regexp.MustCompile("`([^`]+)`")
+	linkRe     = regexp.MustCompile(`\[([^\]]*)\]\(([^)\s]*)\)`)
+	boldRe     = regexp.MustCompile(`(\*\*|__)(.+?)(\*\*|__)`)
+	italicRe   = regexp.MustCompile(`(^|[^\w*])[*_]([^*_\s][^*_]*?)[*_]`)
+)
+
+// safeURL reports whether u may be used as a link target.
+func safeURL(u string) bool {
+	lower := strings.ToLower(u)
+	for _, scheme := range []string{"http://", "https://", "mailto:"} {
+		if strings.HasPrefix(lower, scheme) {
+			return true
+		}
+	}
+
+	// relative links and fragments
+	return !strings.Contains(lower, ":")
+}
+
+func inlineHTML(s string) string {
+	// stash code spans so their contents are not interpreted
+	var spans []string
+	s = codeSpanRe.ReplaceAllStringFunc(s, func(m string) string {
+		spans = append(spans, "<code>"+html.EscapeString(codeSpanRe.FindStringSubmatch(m)[1])+"</code>")
+		return fmt.Sprintf("\x00%d\x00", len(spans)-1)
+	})
+
+	s = html.EscapeString(s)
+	s = linkRe.ReplaceAllStringFunc(s, func(m string) string {
+		parts := linkRe.FindStringSubmatch(m)
+		if !safeURL(html.UnescapeString(parts[2])) {
+			return parts[1]
+		}
+		return fmt.Sprintf("<a href=\"%s\">%s</a>", parts[2], parts[1])
+	})
+	s = boldRe.ReplaceAllString(s, "<strong>$2</strong>")
+	s = italicRe.ReplaceAllString(s, "$1<em>$2</em>")
+
+	for i, span := range spans {
+		s = strings.Replace(s, fmt.Sprintf("\x00%d\x00", i), span, 1)
+	}
+
+	return s
+}
+
+func inlinePlain(s string) string {
+	s = codeSpanRe.ReplaceAllString(s, "$1")
+	s = linkRe.ReplaceAllString(s, "$1")
+	s = boldRe.ReplaceAllString(s, "$2")
+	s = italicRe.ReplaceAllString(s, "$1$2")
+	return s
+}
@@ -0,0 +1,62 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToHTML(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"paragraph", "hello **world**", "<p>hello <strong>world</strong></p>\n"},
+		{"heading", "## Title", "<h2>Title</h2>\n"},
+		{"escape", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"code span", "use `<b>` tags", "<p>use <code>&lt;b&gt;</code> tags</p>\n"},
+		{"link", "[docs](https://ollama.com)", "<p><a href=\"https://ollama.com\">docs</a></p>\n"},
+		{"unsafe link", "[x](javascript:alert)", "<p>x</p>\n"},
+		{"list", "- one\n- two", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n"},
+		{"ordered", "1. one\n2. two", "<ol>\n<li>one</li>\n<li>two</li>\n</ol>\n"},
+		{"fence", "```go\nfmt.Println(\"<hi>\")\n```", "<pre><code class=\"language-go\">fmt.Println(&#34;&lt;hi&gt;&#34;)\n</code></pre>\n"},
+		{"quote", "> quoted\n> text", "<blockquote><p>quoted text</p></blockquote>\n"},
+		{"rule", "---", "<hr>\n"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToHTML(tt.input, nil); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToHTMLHighlighter(t *testing.T) {
+	hl := func(lang, code string) string {
+		return "[" + lang + ":" + strings.TrimSpace(code) + "]"
+	}
+
+	if got := ToHTML("```py\nprint(1)\n```", hl); got != "[py:print(1)]" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestToPlain(t *testing.T) {
+	input := "# Title\n\nSome *emphasis* and `code`.\n\n- a\n- [b](https://example.com)\n\n```\nx := 1\n```"
+	want := "Title\n\nSome emphasis and code.\n\n- a\n- b\n\nx := 1"
+	if got := ToPlain(input); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	if got, err := Render("", "**x**", nil); err != nil || got != "**x**" {
+		t.Errorf("got %q, %v", got, err)
+	}
+
+	if _, err := Render("rtf", "x", nil); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+}
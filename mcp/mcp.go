@@ -0,0 +1,385 @@
+// Package mcp implements a client for the [Model Context Protocol] over stdio.
+//
+// Only the subset of the protocol needed to expose a server's tools and
+// resources to a model is supported.
+//
+// [Model Context Protocol]: https://modelcontextprotocol.io
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/version"
+)
+
+const protocolVersion = "2024-11-05"
+
+// ErrClosed is returned for calls made after the connection to the server
+// is closed.
+var ErrClosed = errors.New("mcp: connection closed")
+
+// closeTimeout is how long [Client.Close] waits for a server started with
+// [Start] to exit once its stdin is closed before killing it.
+var closeTimeout = 5 * time.Second
+
+// Error is a JSON-RPC error returned by a server.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("mcp: %s (code %d)", e.Message, e.Code)
+}
+
+type request struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      *int64 `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type response struct {
+	ID     *int64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// Tool is a tool offered by a server.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+}
+
+// Resource is a resource offered by a server.
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// Content is a single item of tool output or resource contents.
+type Content struct {
+	Type     string `json:"type,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// Client is a connection to a single MCP server.
+type Client struct {
+	cmd *exec.Cmd
+
+	// wmu serializes writes to w
+	wmu sync.Mutex
+	w   io.WriteCloser
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan response
+	err     error
+
+	// done is closed once r is read to the end
+	done chan struct{}
+}
+
+// NewClient creates a client speaking the protocol over r and w. The caller
+// must call [Client.Initialize] before using the client.
+func NewClient(r io.Reader, w io.WriteCloser) *Client {
+	c := &Client{w: w, pending: make(map[int64]chan response), done: make(chan struct{})}
+	go c.read(r)
+	return c
+}
+
+// Start launches a server as a subprocess and initializes a connection to
+// it over the subprocess's stdin and stdout. ctx bounds the handshake; the
+// server runs until [Client.Close] is called.
+func Start(ctx context.Context, command string, args []string, env map[string]string) (*Client, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	c := NewClient(stdout, stdin)
+	c.cmd = cmd
+
+	if err := c.Initialize(ctx); err != nil {
+		// the server may be stuck, so don't wait for it to exit
+		cmd.Process.Kill() //nolint:errcheck
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Client) read(r io.Reader) {
+	defer close(c.done)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var resp response
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil || resp.ID == nil {
+			// ignore notifications and requests from the server
+			continue
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[*resp.ID]
+		delete(c.pending, *resp.ID)
+		c.mu.Unlock()
+
+		if ok {
+			ch <- resp
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = ErrClosed
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+}
+
+func (c *Client) write(req request) error {
+	bts, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err = c.w.Write(append(bts, '\n'))
+	return err
+}
+
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+
+	c.nextID++
+	id := c.nextID
+	ch := make(chan response, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	if err := c.write(request{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return ctx.Err()
+	case resp, ok := <-ch:
+		if !ok {
+			return ErrClosed
+		}
+
+		if resp.Error != nil {
+			return resp.Error
+		}
+
+		if result != nil {
+			return json.Unmarshal(resp.Result, result)
+		}
+
+		return nil
+	}
+}
+
+func (c *Client) notify(method string) error {
+	return c.write(request{JSONRPC: "2.0", Method: method})
+}
+
+// Initialize performs the protocol handshake.
+func (c *Client) Initialize(ctx context.Context) error {
+	params := map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "ollama", "version": version.Version},
+	}
+
+	if err := c.call(ctx, "initialize", params, nil); err != nil {
+		return err
+	}
+
+	return c.notify("notifications/initialized")
+}
+
+// ListTools returns all tools offered by the server.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	var cursor string
+	for {
+		var result struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+
+		if err := c.call(ctx, "tools/list", cursorParams(cursor), &result); err != nil {
+			return nil, err
+		}
+
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool calls a tool and returns its text output. A tool that reports an
+// error has its output returned as the error.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (string, error) {
+	var result struct {
+		Content []Content `json:"content"`
+		IsError bool      `json:"isError"`
+	}
+
+	if err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": args}, &result); err != nil {
+		return "", err
+	}
+
+	text := contentText(result.Content)
+	if result.IsError {
+		return "", errors.New(text)
+	}
+
+	return text, nil
+}
+
+// ListResources returns all resources offered by the server.
+func (c *Client) ListResources(ctx context.Context) ([]Resource, error) {
+	var resources []Resource
+	var cursor string
+	for {
+		var result struct {
+			Resources  []Resource `json:"resources"`
+			NextCursor string     `json:"nextCursor"`
+		}
+
+		if err := c.call(ctx, "resources/list", cursorParams(cursor), &result); err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, result.Resources...)
+		if result.NextCursor == "" {
+			return resources, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// ReadResource returns the text contents of a resource.
+func (c *Client) ReadResource(ctx context.Context, uri string) (string, error) {
+	var result struct {
+		Contents []Content `json:"contents"`
+	}
+
+	if err := c.call(ctx, "resources/read", map[string]any{"uri": uri}, &result); err != nil {
+		return "", err
+	}
+
+	return contentText(result.Contents), nil
+}
+
+// Close closes the connection and stops the server if it was started with
+// [Start]. Servers are expected to exit once their stdin is closed, and are
+// killed if they haven't after closeTimeout.
+func (c *Client) Close() error {
+	c.wmu.Lock()
+	err := c.w.Close()
+	c.wmu.Unlock()
+	if c.cmd == nil {
+		return err
+	}
+
+	// Wait closes stdout, so the reader must be done with it first
+	exited := make(chan error, 1)
+	go func() {
+		<-c.done
+		exited <- c.cmd.Wait()
+	}()
+
+	var werr error
+	select {
+	case werr = <-exited:
+	case <-time.After(closeTimeout):
+		c.cmd.Process.Kill() //nolint:errcheck
+		werr = <-exited
+	}
+
+	var exitErr *exec.ExitError
+	if werr != nil && !errors.As(werr, &exitErr) && err == nil {
+		err = werr
+	}
+
+	return err
+}
+
+func cursorParams(cursor string) any {
+	if cursor == "" {
+		return nil
+	}
+
+	return map[string]any{"cursor": cursor}
+}
+
+// contentText joins the text items of contents. Non-text items are
+// summarized since they cannot be passed to a model as text.
+func contentText(contents []Content) string {
+	var parts []string
+	for _, c := range contents {
+		switch {
+		case c.Text != "":
+			parts = append(parts, c.Text)
+		case c.Blob != "":
+			parts = append(parts, fmt.Sprintf("[binary %s content]", c.MimeType))
+		case c.Type != "" && c.Type != "text":
+			parts = append(parts, fmt.Sprintf("[%s content]", c.Type))
+		}
+	}
+
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,190 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// fakeServer answers requests read from r with the result returned by fn.
+func fakeServer(t *testing.T, r io.Reader, w io.Writer, fn func(method string, params json.RawMessage) (any, *Error)) {
+	t.Helper()
+
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			var req struct {
+				ID     *int64          `json:"id"`
+				Method string          `json:"method"`
+				Params json.RawMessage `json:"params"`
+			}
+
+			if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+				t.Error(err)
+				return
+			}
+
+			if req.ID == nil {
+				continue
+			}
+
+			result, rpcErr := fn(req.Method, req.Params)
+			bts, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": *req.ID, "result": result, "error": rpcErr})
+			w.Write(append(bts, '\n'))
+		}
+	}()
+}
+
+func newTestClient(t *testing.T, fn func(method string, params json.RawMessage) (any, *Error)) *Client {
+	t.Helper()
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	fakeServer(t, serverR, serverW, fn)
+
+	c := NewClient(clientR, clientW)
+	t.Cleanup(func() {
+		c.Close()
+		serverW.Close()
+	})
+
+	if err := c.Initialize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestClient(t *testing.T) {
+	c := newTestClient(t, func(method string, params json.RawMessage) (any, *Error) {
+		switch method {
+		case "initialize":
+			return map[string]any{"protocolVersion": protocolVersion}, nil
+		case "tools/list":
+			var p struct {
+				Cursor string `json:"cursor"`
+			}
+			json.Unmarshal(params, &p)
+			if p.Cursor == "" {
+				return map[string]any{"tools": []Tool{{Name: "a"}}, "nextCursor": "next"}, nil
+			}
+			return map[string]any{"tools": []Tool{{Name: "b"}}}, nil
+		case "tools/call":
+			var p struct {
+				Name      string         `json:"name"`
+				Arguments map[string]any `json:"arguments"`
+			}
+			json.Unmarshal(params, &p)
+			if p.Name == "fail" {
+				return map[string]any{"content": []Content{{Type: "text", Text: "boom"}}, "isError": true}, nil
+			}
+			return map[string]any{"content": []Content{{Type: "text", Text: p.Name + ":" + p.Arguments["x"].(string)}}}, nil
+		case "resources/read":
+			return map[string]any{"contents": []Content{{URI: "file:///a", Text: "hello"}}}, nil
+		default:
+			return nil, &Error{Code: -32601, Message: "method not found"}
+		}
+	})
+
+	ctx := context.Background()
+	tools, err := c.ListTools(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tools) != 2 || tools[0].Name != "a" || tools[1].Name != "b" {
+		t.Errorf("unexpected tools %v", tools)
+	}
+
+	out, err := c.CallTool(ctx, "echo", map[string]any{"x": "y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != "echo:y" {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	if _, err := c.CallTool(ctx, "fail", nil); err == nil || err.Error() != "boom" {
+		t.Errorf("expected tool error, got %v", err)
+	}
+
+	text, err := c.ReadResource(ctx, "file:///a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if text != "hello" {
+		t.Errorf("unexpected resource %q", text)
+	}
+
+	var rpcErr *Error
+	if _, err := c.ListResources(ctx); !errors.As(err, &rpcErr) || rpcErr.Code != -32601 {
+		t.Errorf("expected method not found, got %v", err)
+	}
+}
+
+// stuckServer answers the handshake with result, or the error if result is
+// empty, then ignores its stdin closing
+const stuckServer = `#!/bin/sh
+read -r line
+if [ -n "$1" ]; then
+  printf '{"jsonrpc":"2.0","id":1,"result":%s}\n' "$1"
+else
+  printf '{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"stuck"}}\n'
+fi
+exec sleep 60
+`
+
+func TestStartStuck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the server is a shell script")
+	}
+
+	script := filepath.Join(t.TempDir(), "server")
+	if err := os.WriteFile(script, []byte(stuckServer), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := closeTimeout
+	closeTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { closeTimeout = timeout })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("close", func(t *testing.T) {
+		c, err := Start(ctx, script, []string{"{}"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("expected the server to be killed, took %s", d)
+		}
+	})
+
+	t.Run("initialize", func(t *testing.T) {
+		start := time.Now()
+		var rpcErr *Error
+		if _, err := Start(ctx, script, nil, nil); !errors.As(err, &rpcErr) {
+			t.Fatalf("expected the handshake to fail, got %v", err)
+		}
+
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("expected the server to be killed, took %s", d)
+		}
+	})
+}
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/types/model"
@@ -38,21 +39,39 @@ type Message struct {
 }
 
 type Choice struct {
-	Index        int     `json:"index"`
-	Message      Message `json:"message"`
-	FinishReason *string `json:"finish_reason"`
+	Index        int             `json:"index"`
+	Message      Message         `json:"message"`
+	Logprobs     *ChoiceLogprobs `json:"logprobs,omitempty"`
+	FinishReason *string         `json:"finish_reason"`
 }
 
 type ChunkChoice struct {
-	Index        int     `json:"index"`
-	Delta        Message `json:"delta"`
-	FinishReason *string `json:"finish_reason"`
+	Index        int             `json:"index"`
+	Delta        Message         `json:"delta"`
+	Logprobs     *ChoiceLogprobs `json:"logprobs,omitempty"`
+	FinishReason *string         `json:"finish_reason"`
 }
 
 type CompleteChunkChoice struct {
-	Text         string  `json:"text"`
-	Index        int     `json:"index"`
-	FinishReason *string `json:"finish_reason"`
+	Text         string              `json:"text"`
+	Index        int                 `json:"index"`
+	Logprobs     *CompletionLogprobs `json:"logprobs,omitempty"`
+	FinishReason *string             `json:"finish_reason"`
+}
+
+// ChoiceLogprobs are the log probabilities of the tokens of a chat
+// completion choice.
+type ChoiceLogprobs struct {
+	Content []api.Logprob `json:"content"`
+}
+
+// CompletionLogprobs are the log probabilities of the tokens of a legacy
+// completion choice.
+type CompletionLogprobs struct {
+	Tokens        []string             `json:"tokens"`
+	TokenLogprobs []float64            `json:"token_logprobs"`
+	TopLogprobs   []map[string]float64 `json:"top_logprobs"`
+	TextOffset    []int                `json:"text_offset"`
 }
 
 type Usage struct {
@@ -93,16 +112,31 @@ type ChatCompletionRequest struct {
 	TopP             *float64        `json:"top_p"`
 	ResponseFormat   *ResponseFormat `json:"response_format"`
 	Tools            []api.Tool      `json:"tools"`
+	ToolChoice       any             `json:"tool_choice"`
+	Logprobs         *bool           `json:"logprobs"`
+	TopLogprobs      int             `json:"top_logprobs"`
+}
+
+// Extension holds the Ollama specific fields of a response: the id of the
+// request and the server side timings of the generation.
+type Extension struct {
+	RequestID          string        `json:"request_id"`
+	TotalDuration      time.Duration `json:"total_duration,omitempty"`
+	LoadDuration       time.Duration `json:"load_duration,omitempty"`
+	QueueDuration      time.Duration `json:"queue_duration,omitempty"`
+	PromptEvalDuration time.Duration `json:"prompt_eval_duration,omitempty"`
+	EvalDuration       time.Duration `json:"eval_duration,omitempty"`
 }
 
 type ChatCompletion struct {
-	Id                string   `json:"id"`
-	Object            string   `json:"object"`
-	Created           int64    `json:"created"`
-	Model             string   `json:"model"`
-	SystemFingerprint string   `json:"system_fingerprint"`
-	Choices           []Choice `json:"choices"`
-	Usage             Usage    `json:"usage,omitempty"`
+	Id                string     `json:"id"`
+	Object            string     `json:"object"`
+	Created           int64      `json:"created"`
+	Model             string     `json:"model"`
+	SystemFingerprint string     `json:"system_fingerprint"`
+	Choices           []Choice   `json:"choices"`
+	Usage             Usage      `json:"usage,omitempty"`
+	Ollama            *Extension `json:"x_ollama,omitempty"`
 }
 
 type ChatCompletionChunk struct {
@@ -113,6 +147,7 @@ type ChatCompletionChunk struct {
 	SystemFingerprint string        `json:"system_fingerprint"`
 	Choices           []ChunkChoice `json:"choices"`
 	Usage             *Usage        `json:"usage,omitempty"`
+	Ollama            *Extension    `json:"x_ollama,omitempty"`
 }
 
 // TODO (https://github.com/ollama/ollama/issues/5259): support []string, []int and [][]int
@@ -129,6 +164,7 @@ type CompletionRequest struct {
 	Temperature      *float32       `json:"temperature"`
 	TopP             float32        `json:"top_p"`
 	Suffix           string         `json:"suffix"`
+	Logprobs         *int           `json:"logprobs"`
 }
 
 type Completion struct {
@@ -139,6 +175,7 @@ type Completion struct {
 	SystemFingerprint string                `json:"system_fingerprint"`
 	Choices           []CompleteChunkChoice `json:"choices"`
 	Usage             Usage                 `json:"usage,omitempty"`
+	Ollama            *Extension            `json:"x_ollama,omitempty"`
 }
 
 type CompletionChunk struct {
@@ -149,6 +186,7 @@ type CompletionChunk struct {
 	Model             string                `json:"model"`
 	SystemFingerprint string                `json:"system_fingerprint"`
 	Usage             *Usage                `json:"usage,omitempty"`
+	Ollama            *Extension            `json:"x_ollama,omitempty"`
 }
 
 type ToolCall struct {
@@ -166,6 +204,10 @@ type Model struct {
 	Object  string `json:"object"`
 	Created int64  `json:"created"`
 	OwnedBy string `json:"owned_by"`
+
+	// Embedding describes the embeddings of an embedding model. It is only
+	// set when retrieving a single model.
+	Embedding *api.EmbeddingInfo `json:"embedding,omitempty"`
 }
 
 type Embedding struct {
@@ -213,6 +255,47 @@ func toUsage(r api.ChatResponse) Usage {
 	}
 }
 
+func toExtension(requestID string, m api.Metrics) *Extension {
+	return &Extension{
+		RequestID:          requestID,
+		TotalDuration:      m.TotalDuration,
+		LoadDuration:       m.LoadDuration,
+		QueueDuration:      m.QueueDuration,
+		PromptEvalDuration: m.PromptEvalDuration,
+		EvalDuration:       m.EvalDuration,
+	}
+}
+
+// serverTiming formats the timings of m as a Server-Timing header, in
+// milliseconds.
+func serverTiming(m api.Metrics) string {
+	var timings []string
+	for _, t := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"total", m.TotalDuration},
+		{"load", m.LoadDuration},
+		{"queue", m.QueueDuration},
+		{"prompt_eval", m.PromptEvalDuration},
+		{"eval", m.EvalDuration},
+	} {
+		timings = append(timings, fmt.Sprintf("%s;dur=%.3f", t.name, float64(t.d)/float64(time.Millisecond)))
+	}
+
+	return strings.Join(timings, ", ")
+}
+
+// requestID returns the id of the request in its X-Request-Id header, so
+// clients can correlate it with their own traces, or a new id.
+func requestID(c *gin.Context) string {
+	if id := c.GetHeader("X-Request-Id"); id != "" && len(id) <= 128 {
+		return id
+	}
+
+	return uuid.NewString()
+}
+
 func toolCallId() string {
 	const letterBytes = "abcdefghijklmnopqrstuvwxyz0123456789"
 	b := make([]byte, 8)
@@ -250,8 +333,9 @@ func toChatCompletion(id string, r api.ChatResponse) ChatCompletion {
 		Model:             r.Model,
 		SystemFingerprint: "fp_ollama",
 		Choices: []Choice{{
-			Index:   0,
-			Message: Message{Role: r.Message.Role, Content: r.Message.Content, ToolCalls: toolCalls},
+			Index:    0,
+			Message:  Message{Role: r.Message.Role, Content: r.Message.Content, ToolCalls: toolCalls},
+			Logprobs: toChoiceLogprobs(r.Logprobs),
 			FinishReason: func(reason string) *string {
 				if len(toolCalls) > 0 {
 					reason = "tool_calls"
@@ -275,8 +359,9 @@ func toChunk(id string, r api.ChatResponse) ChatCompletionChunk {
 		Model:             r.Model,
 		SystemFingerprint: "fp_ollama",
 		Choices: []ChunkChoice{{
-			Index: 0,
-			Delta: Message{Role: "assistant", Content: r.Message.Content, ToolCalls: toolCalls},
+			Index:    0,
+			Delta:    Message{Role: "assistant", Content: r.Message.Content, ToolCalls: toolCalls},
+			Logprobs: toChoiceLogprobs(r.Logprobs),
 			FinishReason: func(reason string) *string {
 				if len(reason) > 0 {
 					return &reason
@@ -287,6 +372,37 @@ func toChunk(id string, r api.ChatResponse) ChatCompletionChunk {
 	}
 }
 
+func toChoiceLogprobs(logprobs []api.Logprob) *ChoiceLogprobs {
+	if len(logprobs) == 0 {
+		return nil
+	}
+
+	return &ChoiceLogprobs{Content: logprobs}
+}
+
+func toCompletionLogprobs(logprobs []api.Logprob) *CompletionLogprobs {
+	if len(logprobs) == 0 {
+		return nil
+	}
+
+	var l CompletionLogprobs
+	var offset int
+	for _, lp := range logprobs {
+		l.Tokens = append(l.Tokens, lp.Token)
+		l.TokenLogprobs = append(l.TokenLogprobs, lp.Logprob)
+		l.TextOffset = append(l.TextOffset, offset)
+		offset += len(lp.Token)
+
+		top := make(map[string]float64, len(lp.TopLogprobs))
+		for _, t := range lp.TopLogprobs {
+			top[t.Token] = t.Logprob
+		}
+		l.TopLogprobs = append(l.TopLogprobs, top)
+	}
+
+	return &l
+}
+
 func toUsageGenerate(r api.GenerateResponse) Usage {
 	return Usage{
 		PromptTokens:     r.PromptEvalCount,
@@ -303,8 +419,9 @@ func toCompletion(id string, r api.GenerateResponse) Completion {
 		Model:             r.Model,
 		SystemFingerprint: "fp_ollama",
 		Choices: []CompleteChunkChoice{{
-			Text:  r.Response,
-			Index: 0,
+			Text:     r.Response,
+			Index:    0,
+			Logprobs: toCompletionLogprobs(r.Logprobs),
 			FinishReason: func(reason string) *string {
 				if len(reason) > 0 {
 					return &reason
@@ -324,8 +441,9 @@ func toCompleteChunk(id string, r api.GenerateResponse) CompletionChunk {
 		Model:             r.Model,
 		SystemFingerprint: "fp_ollama",
 		Choices: []CompleteChunkChoice{{
-			Text:  r.Response,
-			Index: 0,
+			Text:     r.Response,
+			Index:    0,
+			Logprobs: toCompletionLogprobs(r.Logprobs),
 			FinishReason: func(reason string) *string {
 				if len(reason) > 0 {
 					return &reason
@@ -380,10 +498,11 @@ func toEmbeddingList(model string, r api.EmbedResponse) EmbeddingList {
 
 func toModel(r api.ShowResponse, m string) Model {
 	return Model{
-		Id:      m,
-		Object:  "model",
-		Created: r.ModifiedAt.Unix(),
-		OwnedBy: model.ParseName(m).Namespace,
+		Id:        m,
+		Object:    "model",
+		Created:   r.ModifiedAt.Unix(),
+		OwnedBy:   model.ParseName(m).Namespace,
+		Embedding: r.Embedding,
 	}
 }
 
@@ -516,16 +635,55 @@ func fromChatRequest(r ChatCompletionRequest) (*api.ChatRequest, error) {
 		}
 	}
 
+	tools, err := chooseTools(r.Tools, r.ToolChoice)
+	if err != nil {
+		return nil, err
+	}
+
 	return &api.ChatRequest{
-		Model:    r.Model,
-		Messages: messages,
-		Format:   format,
-		Options:  options,
-		Stream:   &r.Stream,
-		Tools:    r.Tools,
+		Model:       r.Model,
+		Messages:    messages,
+		Format:      format,
+		Options:     options,
+		Stream:      &r.Stream,
+		Tools:       tools,
+		Logprobs:    r.Logprobs != nil && *r.Logprobs,
+		TopLogprobs: r.TopLogprobs,
 	}, nil
 }
 
+// chooseTools returns the tools offered to the model for tool_choice: none
+// for "none", only the named function for {"type": "function", "function":
+// {"name": ...}}, and all of them for "auto" and "required". Models cannot
+// be forced to call a tool, so "required" is treated as "auto".
+func chooseTools(tools []api.Tool, choice any) ([]api.Tool, error) {
+	switch choice := choice.(type) {
+	case nil:
+		return tools, nil
+	case string:
+		switch choice {
+		case "none":
+			return nil, nil
+		case "auto", "required":
+			return tools, nil
+		}
+	case map[string]any:
+		if fn, ok := choice["function"].(map[string]any); ok {
+			if name, ok := fn["name"].(string); ok {
+				for _, tool := range tools {
+					if tool.Function.Name == name {
+						return []api.Tool{tool}, nil
+					}
+				}
+
+				return nil, fmt.Errorf("tool_choice function %q is not one of the tools", name)
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("invalid tool_choice: %v", choice)
+}
+
 func fromCompleteRequest(r CompletionRequest) (api.GenerateRequest, error) {
 	options := make(map[string]any)
 
@@ -568,12 +726,23 @@ func fromCompleteRequest(r CompletionRequest) (api.GenerateRequest, error) {
 		options["top_p"] = 1.0
 	}
 
+	// the legacy logprobs field is the number of alternatives to return,
+	// with the log probabilities returned if it is set at all
+	var logprobs bool
+	var topLogprobs int
+	if r.Logprobs != nil {
+		logprobs = true
+		topLogprobs = *r.Logprobs
+	}
+
 	return api.GenerateRequest{
-		Model:   r.Model,
-		Prompt:  r.Prompt,
-		Options: options,
-		Stream:  &r.Stream,
-		Suffix:  r.Suffix,
+		Model:       r.Model,
+		Prompt:      r.Prompt,
+		Options:     options,
+		Stream:      &r.Stream,
+		Suffix:      r.Suffix,
+		Logprobs:    logprobs,
+		TopLogprobs: topLogprobs,
 	}, nil
 }
 
@@ -585,13 +754,18 @@ type ChatWriter struct {
 	stream        bool
 	streamOptions *StreamOptions
 	id            string
+	requestID     string
 	BaseWriter
+
+	// toolCalls is set once a chunk with tool calls has been streamed
+	toolCalls bool
 }
 
 type CompleteWriter struct {
 	stream        bool
 	streamOptions *StreamOptions
 	id            string
+	requestID     string
 	BaseWriter
 }
 
@@ -632,9 +806,31 @@ func (w *ChatWriter) writeResponse(data []byte) (int, error) {
 		return 0, err
 	}
 
+	// model load progress has no equivalent in the openai api
+	if chatResponse.Load != nil {
+		return len(data), nil
+	}
+
 	// chat chunk
 	if w.stream {
 		c := toChunk(w.id, chatResponse)
+
+		// tool calls are streamed as they are parsed, before the final chunk
+		if len(chatResponse.Message.ToolCalls) > 0 {
+			w.toolCalls = true
+		}
+
+		if chatResponse.Done && w.toolCalls {
+			reason := "tool_calls"
+			c.Choices[0].FinishReason = &reason
+		}
+
+		// headers have been sent with the first chunk, so the timings are
+		// only in the final one
+		if chatResponse.Done {
+			c.Ollama = toExtension(w.requestID, chatResponse.Metrics)
+		}
+
 		d, err := json.Marshal(c)
 		if err != nil {
 			return 0, err
@@ -670,8 +866,12 @@ func (w *ChatWriter) writeResponse(data []byte) (int, error) {
 	}
 
 	// chat completion
+	c := toChatCompletion(w.id, chatResponse)
+	c.Ollama = toExtension(w.requestID, chatResponse.Metrics)
+
 	w.ResponseWriter.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w.ResponseWriter).Encode(toChatCompletion(w.id, chatResponse))
+	w.ResponseWriter.Header().Set("Server-Timing", serverTiming(chatResponse.Metrics))
+	err = json.NewEncoder(w.ResponseWriter).Encode(c)
 	if err != nil {
 		return 0, err
 	}
@@ -695,12 +895,21 @@ func (w *CompleteWriter) writeResponse(data []byte) (int, error) {
 		return 0, err
 	}
 
+	// model load progress has no equivalent in the openai api
+	if generateResponse.Load != nil {
+		return len(data), nil
+	}
+
 	// completion chunk
 	if w.stream {
 		c := toCompleteChunk(w.id, generateResponse)
 		if w.streamOptions != nil && w.streamOptions.IncludeUsage {
 			c.Usage = &Usage{}
 		}
+
+		if generateResponse.Done {
+			c.Ollama = toExtension(w.requestID, generateResponse.Metrics)
+		}
 		d, err := json.Marshal(c)
 		if err != nil {
 			return 0, err
@@ -736,8 +945,12 @@ func (w *CompleteWriter) writeResponse(data []byte) (int, error) {
 	}
 
 	// completion
+	c := toCompletion(w.id, generateResponse)
+	c.Ollama = toExtension(w.requestID, generateResponse.Metrics)
+
 	w.ResponseWriter.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w.ResponseWriter).Encode(toCompletion(w.id, generateResponse))
+	w.ResponseWriter.Header().Set("Server-Timing", serverTiming(generateResponse.Metrics))
+	err = json.NewEncoder(w.ResponseWriter).Encode(c)
 	if err != nil {
 		return 0, err
 	}
@@ -891,9 +1104,12 @@ func CompletionsMiddleware() gin.HandlerFunc {
 			BaseWriter:    BaseWriter{ResponseWriter: c.Writer},
 			stream:        req.Stream,
 			id:            fmt.Sprintf("cmpl-%d", rand.Intn(999)),
+			requestID:     requestID(c),
 			streamOptions: req.StreamOptions,
 		}
 
+		w.Header().Set("X-Request-Id", w.requestID)
+
 		c.Writer = w
 		c.Next()
 	}
@@ -974,9 +1190,12 @@ func ChatMiddleware() gin.HandlerFunc {
 			BaseWriter:    BaseWriter{ResponseWriter: c.Writer},
 			stream:        req.Stream,
 			id:            fmt.Sprintf("chatcmpl-%d", rand.Intn(999)),
+			requestID:     requestID(c),
 			streamOptions: req.StreamOptions,
 		}
 
+		w.Header().Set("X-Request-Id", w.requestID)
+
 		c.Writer = w
 
 		c.Next()
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -112,6 +113,33 @@ func TestChatMiddleware(t *testing.T) {
 				Stream: &True,
 			},
 		},
+		{
+			name: "chat handler with logprobs",
+			body: `{
+				"model": "test-model",
+				"messages": [
+					{"role": "user", "content": "Hello"}
+				],
+				"logprobs": true,
+				"top_logprobs": 3
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "Hello",
+					},
+				},
+				Options: map[string]any{
+					"temperature": 1.0,
+					"top_p":       1.0,
+				},
+				Stream:      &False,
+				Logprobs:    true,
+				TopLogprobs: 3,
+			},
+		},
 		{
 			name: "chat handler with streaming usage",
 			body: `{
@@ -315,6 +343,82 @@ func TestChatMiddleware(t *testing.T) {
 				Stream: &True,
 			},
 		},
+		{
+			name: "chat handler with tool_choice none",
+			body: `{
+				"model": "test-model",
+				"messages": [
+					{"role": "user", "content": "Hello"}
+				],
+				"tools": [{"type": "function", "function": {"name": "get_weather"}}],
+				"tool_choice": "none"
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "Hello",
+					},
+				},
+				Options: map[string]any{
+					"temperature": 1.0,
+					"top_p":       1.0,
+				},
+				Stream: &False,
+			},
+		},
+		{
+			name: "chat handler with tool_choice function",
+			body: `{
+				"model": "test-model",
+				"messages": [
+					{"role": "user", "content": "Hello"}
+				],
+				"tools": [
+					{"type": "function", "function": {"name": "get_weather"}},
+					{"type": "function", "function": {"name": "get_time"}}
+				],
+				"tool_choice": {"type": "function", "function": {"name": "get_time"}}
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "Hello",
+					},
+				},
+				Tools: []api.Tool{
+					{
+						Type:     "function",
+						Function: api.ToolFunction{Name: "get_time"},
+					},
+				},
+				Options: map[string]any{
+					"temperature": 1.0,
+					"top_p":       1.0,
+				},
+				Stream: &False,
+			},
+		},
+		{
+			name: "chat handler with unknown tool_choice function",
+			body: `{
+				"model": "test-model",
+				"messages": [
+					{"role": "user", "content": "Hello"}
+				],
+				"tools": [{"type": "function", "function": {"name": "get_weather"}}],
+				"tool_choice": {"type": "function", "function": {"name": "get_time"}}
+			}`,
+			err: ErrorResponse{
+				Error: Error{
+					Message: "tool_choice function \"get_time\" is not one of the tools",
+					Type:    "invalid_request_error",
+				},
+			},
+		},
 		{
 			name: "chat handler error forwarding",
 			body: `{
@@ -368,6 +472,64 @@ func TestChatMiddleware(t *testing.T) {
 	}
 }
 
+func TestChatWriterStreamingToolCalls(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ChatMiddleware())
+	router.Handle(http.MethodPost, "/api/chat", func(c *gin.Context) {
+		for _, resp := range []api.ChatResponse{
+			{Model: "test-model", Message: api.Message{Role: "assistant", ToolCalls: []api.ToolCall{
+				{Function: api.ToolCallFunction{Name: "get_weather", Arguments: api.ToolCallFunctionArguments{"location": "Paris"}}},
+			}}},
+			{Model: "test-model", Message: api.Message{Role: "assistant"}, Done: true, DoneReason: "stop"},
+		} {
+			b, err := json.Marshal(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Writer.Write(b)
+		}
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(`{
+		"model": "test-model",
+		"messages": [{"role": "user", "content": "What's the weather like in Paris?"}],
+		"stream": true,
+		"tools": [{"type": "function", "function": {"name": "get_weather"}}]
+	}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	var chunks []ChatCompletionChunk
+	for _, line := range strings.Split(resp.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d: %s", len(chunks), resp.Body.String())
+	}
+
+	toolCalls := chunks[0].Choices[0].Delta.ToolCalls
+	if len(toolCalls) != 1 || toolCalls[0].Function.Name != "get_weather" || toolCalls[0].Function.Arguments != `{"location":"Paris"}` {
+		t.Errorf("unexpected tool calls %+v", toolCalls)
+	}
+
+	if reason := chunks[1].Choices[0].FinishReason; reason == nil || *reason != "tool_calls" {
+		t.Errorf("expected finish reason tool_calls, got %v", reason)
+	}
+}
+
 func TestCompletionsMiddleware(t *testing.T) {
 	type testCase struct {
 		name string
@@ -402,6 +564,27 @@ func TestCompletionsMiddleware(t *testing.T) {
 				Stream: &False,
 			},
 		},
+		{
+			name: "completions handler with logprobs",
+			body: `{
+				"model": "test-model",
+				"prompt": "Hello",
+				"logprobs": 2
+			}`,
+			req: api.GenerateRequest{
+				Model:  "test-model",
+				Prompt: "Hello",
+				Options: map[string]any{
+					"frequency_penalty": 0.0,
+					"presence_penalty":  0.0,
+					"temperature":       1.0,
+					"top_p":             1.0,
+				},
+				Stream:      &False,
+				Logprobs:    true,
+				TopLogprobs: 2,
+			},
+		},
 		{
 			name: "completions handler stream",
 			body: `{
@@ -684,6 +867,22 @@ func TestRetrieveMiddleware(t *testing.T) {
 				"owned_by":"library"}
 			`,
 		},
+		{
+			name: "retrieve handler embedding model",
+			endpoint: func(c *gin.Context) {
+				c.JSON(http.StatusOK, api.ShowResponse{
+					ModifiedAt: time.Unix(int64(1686935002), 0).UTC(),
+					Embedding:  &api.EmbeddingInfo{Dimension: 768, MaxSequenceLength: 2048, PoolingType: "mean", Normalized: true},
+				})
+			},
+			resp: `{
+				"id":"test-model",
+				"object":"model",
+				"created":1686935002,
+				"owned_by":"library",
+				"embedding":{"dimension":768,"max_sequence_length":2048,"pooling_type":"mean","normalized":true}}
+			`,
+		},
 		{
 			name: "retrieve handler error forwarding",
 			endpoint: func(c *gin.Context) {
@@ -727,3 +926,106 @@ func TestRetrieveMiddleware(t *testing.T) {
 		}
 	}
 }
+
+func TestChatWriterRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ChatMiddleware())
+	router.Handle(http.MethodPost, "/api/chat", func(c *gin.Context) {
+		b, err := json.Marshal(api.ChatResponse{
+			Model:      "test-model",
+			Message:    api.Message{Role: "assistant", Content: "Hello"},
+			Done:       true,
+			DoneReason: "stop",
+			Metrics: api.Metrics{
+				TotalDuration: 1500 * time.Millisecond,
+				LoadDuration:  500 * time.Millisecond,
+				EvalDuration:  time.Second,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Writer.Write(b)
+	})
+
+	chat := func(id string, stream bool) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "stream": %t}`, stream)
+		req, _ := http.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if id != "" {
+			req.Header.Set("X-Request-Id", id)
+		}
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("client id", func(t *testing.T) {
+		resp := chat("trace-123", false)
+		if got := resp.Header().Get("X-Request-Id"); got != "trace-123" {
+			t.Errorf("expected request id trace-123, got %q", got)
+		}
+
+		if got, want := resp.Header().Get("Server-Timing"), "total;dur=1500.000, load;dur=500.000, queue;dur=0.000, prompt_eval;dur=0.000, eval;dur=1000.000"; got != want {
+			t.Errorf("expected Server-Timing %q, got %q", want, got)
+		}
+
+		var completion ChatCompletion
+		if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+			t.Fatal(err)
+		}
+
+		want := &Extension{RequestID: "trace-123", TotalDuration: 1500 * time.Millisecond, LoadDuration: 500 * time.Millisecond, EvalDuration: time.Second}
+		if diff := cmp.Diff(want, completion.Ollama); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("generated id streaming", func(t *testing.T) {
+		resp := chat("", true)
+		id := resp.Header().Get("X-Request-Id")
+		if id == "" {
+			t.Fatal("expected a request id")
+		}
+
+		data, _, _ := strings.Cut(strings.TrimPrefix(resp.Body.String(), "data: "), "\n")
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatal(err)
+		}
+
+		if chunk.Ollama == nil || chunk.Ollama.RequestID != id || chunk.Ollama.TotalDuration != 1500*time.Millisecond {
+			t.Errorf("unexpected extension %+v", chunk.Ollama)
+		}
+	})
+}
+
+func TestCompletionLogprobs(t *testing.T) {
+	logprobs := []api.Logprob{
+		{
+			TokenLogprob: api.TokenLogprob{Token: "Hello", Logprob: -0.5},
+			TopLogprobs:  []api.TokenLogprob{{Token: "Hello", Logprob: -0.5}, {Token: "Hi", Logprob: -1.5}},
+		},
+		{
+			TokenLogprob: api.TokenLogprob{Token: " world", Logprob: -0.25},
+			TopLogprobs:  []api.TokenLogprob{{Token: " world", Logprob: -0.25}},
+		},
+	}
+
+	want := &CompletionLogprobs{
+		Tokens:        []string{"Hello", " world"},
+		TokenLogprobs: []float64{-0.5, -0.25},
+		TopLogprobs:   []map[string]float64{{"Hello": -0.5, "Hi": -1.5}, {" world": -0.25}},
+		TextOffset:    []int{0, 5},
+	}
+
+	if diff := cmp.Diff(want, toCompletionLogprobs(logprobs)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if got := toCompletionLogprobs(nil); got != nil {
+		t.Errorf("expected no logprobs, got %+v", got)
+	}
+}
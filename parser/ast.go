@@ -0,0 +1,448 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Pos is a position in a Modelfile. Line and Column start at 1, and Column
+// counts runes rather than bytes.
+type Pos struct {
+	Line   int
+	Column int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Node is a node of a parsed Modelfile, either a [*Directive] or a
+// [*Comment].
+type Node interface {
+	// Pos is the position of the first character of the node.
+	Pos() Pos
+	// EndLine is the last line of the node.
+	EndLine() int
+}
+
+// Comment is a comment on a line of its own, or following a quoted value.
+type Comment struct {
+	Position Pos
+	// Text is the comment without the leading "#".
+	Text string
+}
+
+func (c *Comment) Pos() Pos     { return c.Position }
+func (c *Comment) EndLine() int { return c.Position.Line }
+
+// Quote is the way a [Value] is written.
+type Quote int
+
+const (
+	// QuoteNone is a value written as is, up to the end of the line.
+	QuoteNone Quote = iota
+	// QuoteDouble is a value between double quotes.
+	QuoteDouble
+	// QuoteTriple is a value between triple double quotes.
+	QuoteTriple
+	// QuoteHeredoc is a value written on the lines following <<DELIM, up
+	// to a line with only DELIM.
+	QuoteHeredoc
+)
+
+// Value is the value of a directive.
+type Value struct {
+	Position Pos
+	Text     string
+	Quote    Quote
+	// Delimiter is the delimiter of a heredoc value, without quotes.
+	Delimiter string
+	// EndLine is the line of the closing quote or delimiter, or of the
+	// value itself if it is not quoted. It is 0 for a value that was not
+	// parsed.
+	EndLine int
+}
+
+// Directive is a command of a Modelfile, such as "FROM llama3.2" or
+// "PARAMETER temperature 0.7".
+type Directive struct {
+	Position Pos
+	// Keyword is the command as written, such as "FROM" or "parameter".
+	Keyword string
+	// Args are the words between the keyword and the value: the parameter
+	// name of PARAMETER, the role of MESSAGE, or the profile and parameter
+	// names of PROFILE.
+	Args  []string
+	Value Value
+	// Comment follows the value on its last line, if any.
+	Comment *Comment
+}
+
+func (d *Directive) Pos() Pos     { return d.Position }
+func (d *Directive) EndLine() int { return d.Value.EndLine }
+
+// Command returns the command of the directive, as returned by [ParseFile].
+func (d *Directive) Command() Command {
+	switch keyword := strings.ToLower(d.Keyword); keyword {
+	case "from":
+		return Command{Name: "model", Args: d.Value.Text}
+	case "parameter":
+		return Command{Name: d.Args[0], Args: d.Value.Text}
+	case "message":
+		return Command{Name: keyword, Args: d.Args[0] + ": " + d.Value.Text}
+	case "profile":
+		return Command{Name: keyword, Args: d.Args[0] + " " + d.Args[1] + " " + d.Value.Text}
+	default:
+		return Command{Name: keyword, Args: d.Value.Text}
+	}
+}
+
+// File is the syntax tree of a Modelfile.
+type File struct {
+	Nodes []Node
+}
+
+// Commands returns the commands of the directives of f, in order.
+func (f *File) Commands() []Command {
+	var cmds []Command
+	for _, n := range f.Nodes {
+		if d, ok := n.(*Directive); ok {
+			cmds = append(cmds, d.Command())
+		}
+	}
+
+	return cmds
+}
+
+// ParserErrors is the list of errors found parsing a Modelfile, in order of
+// their position.
+type ParserErrors []*ParserError
+
+func (e ParserErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+func (e ParserErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// Parse parses r into the syntax tree of a Modelfile, keeping comments and
+// the positions of directives. Unlike [ParseFile], it does not require a
+// FROM. Parsing continues past errors so that all of them are reported at
+// once as [ParserErrors], along with the nodes that could be parsed.
+func Parse(r io.Reader) (*File, error) {
+	tr := unicode.BOMOverride(unicode.UTF8.NewDecoder())
+	b, err := io.ReadAll(bufio.NewReader(transform.NewReader(r, tr)))
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{lines: strings.Split(normalize(string(b)), "\n")}
+	for p.line < len(p.lines) {
+		p.parseLine()
+	}
+
+	if len(p.errs) > 0 {
+		return &p.file, p.errs
+	}
+
+	return &p.file, nil
+}
+
+// normalize converts line endings to "\n" and removes characters that are
+// neither printable nor whitespace.
+func normalize(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\r':
+			return '\n'
+		case r == '\n', r == '\t', strconv.IsPrint(r):
+			return r
+		default:
+			return -1
+		}
+	}, s)
+}
+
+type parser struct {
+	lines []string
+	// line is the index of the line being parsed
+	line int
+	file File
+	errs ParserErrors
+}
+
+func (p *parser) pos(offset int) Pos {
+	return Pos{Line: p.line + 1, Column: utf8.RuneCountInString(p.lines[p.line][:offset]) + 1}
+}
+
+func (p *parser) errorf(offset int, err error, format string, args ...any) {
+	pos := p.pos(offset)
+	p.errs = append(p.errs, &ParserError{
+		LineNumber: pos.Line,
+		Column:     pos.Column,
+		Msg:        fmt.Sprintf(format, args...),
+		Err:        err,
+	})
+}
+
+// parseLine parses the node starting on the current line and advances past
+// its last line.
+func (p *parser) parseLine() {
+	line := p.lines[p.line]
+	i := skipSpace(line, 0)
+
+	switch {
+	case i == len(line):
+		p.line++
+		return
+	case line[i] == '#':
+		p.file.Nodes = append(p.file.Nodes, &Comment{Position: p.pos(i), Text: line[i+1:]})
+		p.line++
+		return
+	}
+
+	d := Directive{Position: p.pos(i)}
+
+	j := i
+	for j < len(line) && isAlpha(rune(line[j])) {
+		j++
+	}
+
+	d.Keyword = line[i:j]
+	if j == i || j < len(line) && !isSpace(rune(line[j])) || !isValidCommand(d.Keyword) {
+		p.errorf(i, errInvalidCommand, "%s", errInvalidCommand)
+		p.line++
+		return
+	}
+
+	var args []string
+	switch strings.ToLower(d.Keyword) {
+	case "parameter":
+		args = []string{"parameter name"}
+	case "message":
+		args = []string{"message role"}
+	case "profile":
+		args = []string{"profile name", "parameter name"}
+	}
+
+	for _, arg := range args {
+		i = skipSpace(line, j)
+		j = i
+		for j < len(line) && !isSpace(rune(line[j])) {
+			j++
+		}
+
+		word := line[i:j]
+		switch {
+		case word == "":
+			p.errorf(i, io.ErrUnexpectedEOF, "missing %s", arg)
+			p.line++
+			return
+		case arg == "message role" && !isValidMessageRole(word):
+			p.errorf(i, errInvalidMessageRole, "%s", errInvalidMessageRole)
+			p.line++
+			return
+		case arg == "parameter name" && !isValidName(word, "_"),
+			arg == "profile name" && !isValidName(word, "_-"):
+			p.errorf(i, nil, "invalid %s %q", arg, word)
+			p.line++
+			return
+		}
+
+		d.Args = append(d.Args, word)
+	}
+
+	// a value may be empty, as in "SYSTEM ", but must be separated from
+	// the command
+	i = skipSpace(line, j)
+	if j == len(line) {
+		p.errorf(i, io.ErrUnexpectedEOF, "missing value")
+		p.line++
+		return
+	}
+
+	d.Value.Position = p.pos(i)
+	rest := line[i:]
+
+	var ok bool
+	switch {
+	case strings.HasPrefix(rest, `"""`):
+		d.Value.Quote = QuoteTriple
+		ok = p.parseQuoted(&d, i+3, `"""`)
+	case strings.HasPrefix(rest, `"`):
+		d.Value.Quote = QuoteDouble
+		ok = p.parseQuoted(&d, i+1, `"`)
+	default:
+		if delim, comment, isHeredoc := heredocHeader(rest); isHeredoc {
+			d.Value.Quote = QuoteHeredoc
+			d.Value.Delimiter = delim
+			if comment >= 0 {
+				d.Comment = &Comment{Position: p.pos(i + comment), Text: rest[comment+1:]}
+			}
+			ok = p.parseHeredoc(&d)
+		} else {
+			d.Value.Text = strings.TrimRight(rest, " \t")
+			d.Value.EndLine = p.line + 1
+			p.line++
+			ok = true
+		}
+	}
+
+	if ok {
+		p.file.Nodes = append(p.file.Nodes, &d)
+	}
+}
+
+// parseQuoted parses a value between quotes starting at offset of the
+// current line, which may continue on the following lines.
+func (p *parser) parseQuoted(d *Directive, offset int, quote string) bool {
+	var sb strings.Builder
+	start := offset
+	for p.line < len(p.lines) {
+		line := p.lines[p.line]
+		if end, comment, ok := closeQuote(line[start:], quote); ok {
+			sb.WriteString(line[start : start+end])
+			if comment >= 0 {
+				d.Comment = &Comment{Position: p.pos(start + comment), Text: line[start+comment+1:]}
+			}
+
+			d.Value.Text = sb.String()
+			d.Value.EndLine = p.line + 1
+			p.line++
+			return true
+		}
+
+		sb.WriteString(line[start:])
+		sb.WriteByte('\n')
+		p.line, start = p.line+1, 0
+	}
+
+	p.line = d.Value.Position.Line - 1
+	p.errorf(offset-len(quote), io.ErrUnexpectedEOF, "unterminated quoted value")
+	p.line = len(p.lines)
+	return false
+}
+
+// closeQuote finds the closing quote of a quoted value in s, a line or the
+// part of it following the opening quote. The closing quote is the last one
+// of the line, or the first one followed by a comment. It returns the offset
+// of the quote and of the comment's "#", or -1 if there is no comment.
+func closeQuote(s, quote string) (end, comment int, ok bool) {
+	if t := strings.TrimRight(s, " \t"); strings.HasSuffix(t, quote) {
+		return len(t) - len(quote), -1, true
+	}
+
+	for i := 0; i+len(quote) <= len(s); i++ {
+		if !strings.HasPrefix(s[i:], quote) {
+			continue
+		}
+
+		j := skipSpace(s, i+len(quote))
+		if j < len(s) && s[j] == '#' {
+			return i, j, true
+		}
+	}
+
+	return 0, -1, false
+}
+
+// heredocHeader reports whether s starts a heredoc value, <<DELIM, <<"DELIM"
+// or <<'DELIM', followed by nothing but an optional comment. It returns the
+// delimiter and the offset of the comment's "#", or -1 if there is none.
+func heredocHeader(s string) (delim string, comment int, ok bool) {
+	rest, ok := strings.CutPrefix(s, "<<")
+	if !ok {
+		return "", -1, false
+	}
+
+	var quote byte
+	if len(rest) > 0 && (rest[0] == '"' || rest[0] == '\'') {
+		quote, rest = rest[0], rest[1:]
+	}
+
+	i := 0
+	for i < len(rest) && (isAlpha(rune(rest[i])) || rest[i] == '_' || i > 0 && isNumber(rune(rest[i]))) {
+		i++
+	}
+
+	delim, rest = rest[:i], rest[i:]
+	if delim == "" {
+		return "", -1, false
+	}
+
+	if quote != 0 {
+		if len(rest) == 0 || rest[0] != quote {
+			return "", -1, false
+		}
+		rest = rest[1:]
+	}
+
+	offset := len(s) - len(rest)
+	switch j := skipSpace(rest, 0); {
+	case j == len(rest):
+		return delim, -1, true
+	case rest[j] == '#':
+		return delim, offset + j, true
+	default:
+		return "", -1, false
+	}
+}
+
+// parseHeredoc parses the lines of a heredoc value following the current
+// line, up to the line with only its delimiter.
+func (p *parser) parseHeredoc(d *Directive) bool {
+	var lines []string
+	for i := p.line + 1; i < len(p.lines); i++ {
+		if strings.TrimSpace(p.lines[i]) == d.Value.Delimiter {
+			d.Value.Text = strings.Join(lines, "\n")
+			d.Value.EndLine = i + 1
+			p.line = i + 1
+			return true
+		}
+
+		lines = append(lines, p.lines[i])
+	}
+
+	p.errorf(skipSpace(p.lines[p.line], 0), io.ErrUnexpectedEOF, "heredoc is missing its closing %s", d.Value.Delimiter)
+	p.line = len(p.lines)
+	return false
+}
+
+func skipSpace(s string, i int) int {
+	for i < len(s) && isSpace(rune(s[i])) {
+		i++
+	}
+
+	return i
+}
+
+// isValidName reports whether s has only letters, digits and the characters
+// of extra.
+func isValidName(s, extra string) bool {
+	for _, r := range s {
+		if !isAlpha(r) && !isNumber(r) && !strings.ContainsRune(extra, r) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatModelfile prints f as a canonical Modelfile: commands are uppercase
+// and separated from their arguments by single spaces, comments are kept,
+// and runs of blank lines between nodes are collapsed into one. Values are
+// written as is where possible, in triple quotes if they span lines or have
+// surrounding whitespace, and as heredocs if they contain triple quotes.
+func FormatModelfile(f *File) string {
+	var sb strings.Builder
+	var last int
+	for _, n := range f.Nodes {
+		if last > 0 && n.Pos().Line > last+1 {
+			sb.WriteByte('\n')
+		}
+		last = n.EndLine()
+
+		switch n := n.(type) {
+		case *Comment:
+			fmt.Fprintf(&sb, "#%s\n", n.Text)
+		case *Directive:
+			sb.WriteString(strings.ToUpper(n.Keyword))
+			for _, arg := range n.Args {
+				sb.WriteByte(' ')
+				sb.WriteString(arg)
+			}
+
+			sb.WriteByte(' ')
+			writeValue(&sb, n.Value.Text, n.Comment)
+		}
+	}
+
+	return sb.String()
+}
+
+// writeValue writes s as a value that parses back to s, followed by comment
+// if it is not nil.
+func writeValue(sb *strings.Builder, s string, comment *Comment) {
+	var trailer string
+	if comment != nil {
+		trailer = " #" + comment.Text
+	}
+
+	switch {
+	case s == "":
+		fmt.Fprintf(sb, `""%s`+"\n", trailer)
+	case isBare(s) && comment == nil:
+		fmt.Fprintf(sb, "%s\n", s)
+	case !strings.Contains(s, `"""`):
+		fmt.Fprintf(sb, `"""%s"""%s`+"\n", s, trailer)
+	default:
+		delim := heredocDelimiter(s)
+		fmt.Fprintf(sb, "<<%s%s\n%s\n%s\n", delim, trailer, s, delim)
+	}
+}
+
+// isBare reports whether s can be written without quotes.
+func isBare(s string) bool {
+	return !strings.ContainsRune(s, '\n') &&
+		strings.Trim(s, " \t") == s &&
+		!strings.HasPrefix(s, `"`) &&
+		!strings.HasPrefix(s, "<<")
+}
+
+// heredocDelimiter returns a heredoc delimiter that is not a line of s.
+func heredocDelimiter(s string) string {
+	lines := strings.Split(s, "\n")
+	for i := 0; ; i++ {
+		delim := "EOF"
+		if i > 0 {
+			delim = fmt.Sprintf("EOF%d", i)
+		}
+
+		if !containsLine(lines, delim) {
+			return delim
+		}
+	}
+}
+
+func containsLine(lines []string, delim string) bool {
+	for _, line := range lines {
+		if strings.TrimSpace(line) == delim {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,7 +1,6 @@
 package parser
 
 import (
-	"bufio"
 	"bytes"
 	"crypto/sha256"
 	"errors"
@@ -12,12 +11,8 @@ import (
 	"os/user"
 	"path/filepath"
 	"slices"
-	"strconv"
 	"strings"
 
-	"golang.org/x/text/encoding/unicode"
-	"golang.org/x/text/transform"
-
 	"github.com/ollama/ollama/api"
 )
 
@@ -45,6 +40,8 @@ func (f Modelfile) CreateRequest(relativeDir string) (*api.CreateRequest, error)
 	var messages []api.Message
 	var licenses []string
 	params := make(map[string]any)
+	profiles := make(map[string]map[string]any)
+	routes := make(map[string]string)
 
 	for _, c := range f.Commands {
 		switch c.Name {
@@ -75,6 +72,20 @@ func (f Modelfile) CreateRequest(relativeDir string) (*api.CreateRequest, error)
 			}
 
 			req.Adapters = digestMap
+		case "tokenizer":
+			path, err := expandPath(c.Args, relativeDir)
+			if err != nil {
+				return nil, err
+			}
+
+			digest, err := digestForFile(path)
+			if err != nil {
+				return nil, err
+			}
+
+			req.Tokenizer = map[string]string{path: digest}
+		case "quantize":
+			req.Quantize = c.Args
 		case "template":
 			req.Template = c.Args
 		case "system":
@@ -84,6 +95,37 @@ func (f Modelfile) CreateRequest(relativeDir string) (*api.CreateRequest, error)
 		case "message":
 			role, msg, _ := strings.Cut(c.Args, ": ")
 			messages = append(messages, api.Message{Role: role, Content: msg})
+		case "router":
+			req.Router = &api.Router{Classifier: c.Args}
+		case "route":
+			label, target, ok := strings.Cut(c.Args, " ")
+			if !ok {
+				return nil, fmt.Errorf("route %q must be a label followed by a model", c.Args)
+			}
+
+			routes[label] = strings.TrimSpace(target)
+		case "profile":
+			profile, rest, _ := strings.Cut(c.Args, " ")
+			name, value, _ := strings.Cut(rest, " ")
+
+			ps, err := api.FormatParams(map[string][]string{name: {value}})
+			if err != nil {
+				return nil, err
+			}
+
+			if profiles[profile] == nil {
+				profiles[profile] = make(map[string]any)
+			}
+
+			for k, v := range ps {
+				if ks, ok := profiles[profile][k].([]string); ok {
+					profiles[profile][k] = append(ks, v.([]string)...)
+				} else if vs, ok := v.([]string); ok {
+					profiles[profile][k] = vs
+				} else {
+					profiles[profile][k] = v
+				}
+			}
 		default:
 			if slices.Contains(deprecatedParameters, c.Name) {
 				fmt.Printf("warning: parameter %s is deprecated\n", c.Name)
@@ -110,12 +152,22 @@ func (f Modelfile) CreateRequest(relativeDir string) (*api.CreateRequest, error)
 	if len(params) > 0 {
 		req.Parameters = params
 	}
+	if len(profiles) > 0 {
+		req.Profiles = profiles
+	}
 	if len(messages) > 0 {
 		req.Messages = messages
 	}
 	if len(licenses) > 0 {
 		req.License = licenses
 	}
+	if len(routes) > 0 {
+		if req.Router == nil {
+			return nil, errors.New("ROUTE requires a ROUTER")
+		}
+
+		req.Router.Routes = routes
+	}
 
 	return req, nil
 }
@@ -270,11 +322,21 @@ func (c Command) String() string {
 	switch c.Name {
 	case "model":
 		fmt.Fprintf(&sb, "FROM %s", c.Args)
-	case "license", "template", "system", "adapter":
+	case "license", "template", "system", "adapter", "tokenizer":
 		fmt.Fprintf(&sb, "%s %s", strings.ToUpper(c.Name), quote(c.Args))
 	case "message":
 		role, message, _ := strings.Cut(c.Args, ": ")
 		fmt.Fprintf(&sb, "MESSAGE %s %s", role, quote(message))
+	case "quantize":
+		fmt.Fprintf(&sb, "QUANTIZE %s", c.Args)
+	case "router":
+		fmt.Fprintf(&sb, "ROUTER %s", c.Args)
+	case "route":
+		fmt.Fprintf(&sb, "ROUTE %s", c.Args)
+	case "profile":
+		profile, rest, _ := strings.Cut(c.Args, " ")
+		name, value, _ := strings.Cut(rest, " ")
+		fmt.Fprintf(&sb, "PROFILE %s %s %s", profile, name, quote(value))
 	default:
 		fmt.Fprintf(&sb, "PARAMETER %s %s", c.Name, quote(c.Args))
 	}
@@ -282,159 +344,49 @@ func (c Command) String() string {
 	return sb.String()
 }
 
-type state int
-
-const (
-	stateNil state = iota
-	stateName
-	stateValue
-	stateParameter
-	stateMessage
-	stateComment
-)
-
 var (
 	errMissingFrom        = errors.New("no FROM line")
 	errInvalidMessageRole = errors.New("message role must be one of \"system\", \"user\", or \"assistant\"")
-	errInvalidCommand     = errors.New("command must be one of \"from\", \"license\", \"template\", \"system\", \"adapter\", \"parameter\", or \"message\"")
+	errInvalidCommand     = errors.New("command must be one of \"from\", \"license\", \"template\", \"system\", \"adapter\", \"tokenizer\", \"parameter\", \"profile\", \"message\", \"router\", or \"route\"")
 )
 
 type ParserError struct {
 	LineNumber int
+	Column     int
 	Msg        string
+
+	// Err is the cause of the error, if any, such as [io.ErrUnexpectedEOF]
+	// for a command that is cut short.
+	Err error
 }
 
 func (e *ParserError) Error() string {
-	if e.LineNumber > 0 {
+	switch {
+	case e.LineNumber > 0 && e.Column > 0:
+		return fmt.Sprintf("(line %d, column %d): %s", e.LineNumber, e.Column, e.Msg)
+	case e.LineNumber > 0:
 		return fmt.Sprintf("(line %d): %s", e.LineNumber, e.Msg)
 	}
 	return e.Msg
 }
 
-func ParseFile(r io.Reader) (*Modelfile, error) {
-	var cmd Command
-	var curr state
-	var currLine int = 1
-	var b bytes.Buffer
-	var role string
-
-	var f Modelfile
-
-	tr := unicode.BOMOverride(unicode.UTF8.NewDecoder())
-	br := bufio.NewReader(transform.NewReader(r, tr))
-
-	for {
-		r, _, err := br.ReadRune()
-		if errors.Is(err, io.EOF) {
-			break
-		} else if err != nil {
-			return nil, err
-		}
-
-		if isNewline(r) {
-			currLine++
-		}
-
-		next, r, err := parseRuneForState(r, curr)
-		if errors.Is(err, io.ErrUnexpectedEOF) {
-			return nil, fmt.Errorf("%w: %s", err, b.String())
-		} else if err != nil {
-			return nil, &ParserError{
-				LineNumber: currLine,
-				Msg:        err.Error(),
-			}
-		}
-
-		// process the state transition, some transitions need to be intercepted and redirected
-		if next != curr {
-			switch curr {
-			case stateName:
-				if !isValidCommand(b.String()) {
-					return nil, &ParserError{
-						LineNumber: currLine,
-						Msg:        errInvalidCommand.Error(),
-					}
-				}
-
-				// next state sometimes depends on the current buffer value
-				switch s := strings.ToLower(b.String()); s {
-				case "from":
-					cmd.Name = "model"
-				case "parameter":
-					// transition to stateParameter which sets command name
-					next = stateParameter
-				case "message":
-					// transition to stateMessage which validates the message role
-					next = stateMessage
-					fallthrough
-				default:
-					cmd.Name = s
-				}
-			case stateParameter:
-				cmd.Name = b.String()
-			case stateMessage:
-				if !isValidMessageRole(b.String()) {
-					return nil, &ParserError{
-						LineNumber: currLine,
-						Msg:        errInvalidMessageRole.Error(),
-					}
-				}
-
-				role = b.String()
-			case stateComment, stateNil:
-				// pass
-			case stateValue:
-				s, ok := unquote(strings.TrimSpace(b.String()))
-				if !ok || isSpace(r) {
-					if _, err := b.WriteRune(r); err != nil {
-						return nil, err
-					}
-
-					continue
-				}
-
-				if role != "" {
-					s = role + ": " + s
-					role = ""
-				}
-
-				cmd.Args = s
-				f.Commands = append(f.Commands, cmd)
-			}
-
-			b.Reset()
-			curr = next
-		}
-
-		if strconv.IsPrint(r) {
-			if _, err := b.WriteRune(r); err != nil {
-				return nil, err
-			}
-		}
-	}
-
-	// flush the buffer
-	switch curr {
-	case stateComment, stateNil:
-		// pass; nothing to flush
-	case stateValue:
-		s, ok := unquote(strings.TrimSpace(b.String()))
-		if !ok {
-			return nil, io.ErrUnexpectedEOF
-		}
-
-		if role != "" {
-			s = role + ": " + s
-		}
+func (e *ParserError) Unwrap() error {
+	return e.Err
+}
 
-		cmd.Args = s
-		f.Commands = append(f.Commands, cmd)
-	default:
-		return nil, io.ErrUnexpectedEOF
+// ParseFile parses a Modelfile into its commands. Errors are reported as
+// [ParserErrors]. See [Parse] for the syntax tree with positions and
+// comments.
+func ParseFile(r io.Reader) (*Modelfile, error) {
+	file, err := Parse(r)
+	if err != nil {
+		return nil, err
 	}
 
+	f := Modelfile{Commands: file.Commands()}
 	for _, cmd := range f.Commands {
-		if cmd.Name == "model" {
+		// a router dispatches to other models and has none of its own
+		if cmd.Name == "model" || cmd.Name == "router" {
 			return &f, nil
 		}
 	}
@@ -442,65 +394,6 @@ func ParseFile(r io.Reader) (*Modelfile, error) {
 	return nil, errMissingFrom
 }
 
-func parseRuneForState(r rune, cs state) (state, rune, error) {
-	switch cs {
-	case stateNil:
-		switch {
-		case r == '#':
-			return stateComment, 0, nil
-		case isSpace(r), isNewline(r):
-			return stateNil, 0, nil
-		default:
-			return stateName, r, nil
-		}
-	case stateName:
-		switch {
-		case isAlpha(r):
-			return stateName, r, nil
-		case isSpace(r):
-			return stateValue, 0, nil
-		default:
-			return stateNil, 0, errInvalidCommand
-		}
-	case stateValue:
-		switch {
-		case isNewline(r):
-			return stateNil, r, nil
-		case isSpace(r):
-			return stateNil, r, nil
-		default:
-			return stateValue, r, nil
-		}
-	case stateParameter:
-		switch {
-		case isAlpha(r), isNumber(r), r == '_':
-			return stateParameter, r, nil
-		case isSpace(r):
-			return stateValue, 0, nil
-		default:
-			return stateNil, 0, io.ErrUnexpectedEOF
-		}
-	case stateMessage:
-		switch {
-		case isAlpha(r):
-			return stateMessage, r, nil
-		case isSpace(r):
-			return stateValue, 0, nil
-		default:
-			return stateNil, 0, io.ErrUnexpectedEOF
-		}
-	case stateComment:
-		switch {
-		case isNewline(r):
-			return stateNil, 0, nil
-		default:
-			return stateComment, 0, nil
-		}
-	default:
-		return stateNil, 0, errors.New("")
-	}
-}
-
 func quote(s string) string {
 	if strings.Contains(s, "\n") || strings.HasPrefix(s, " ") || strings.HasSuffix(s, " ") {
 		if strings.Contains(s, "\"") {
@@ -513,27 +406,6 @@ func quote(s string) string {
 	return s
 }
 
-func unquote(s string) (string, bool) {
-	// TODO: single quotes
-	if len(s) >= 3 && s[:3] == `"""` {
-		if len(s) >= 6 && s[len(s)-3:] == `"""` {
-			return s[3 : len(s)-3], true
-		}
-
-		return "", false
-	}
-
-	if len(s) >= 1 && s[0] == '"' {
-		if len(s) >= 2 && s[len(s)-1] == '"' {
-			return s[1 : len(s)-1], true
-		}
-
-		return "", false
-	}
-
-	return s, true
-}
-
 func isAlpha(r rune) bool {
 	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
 }
@@ -556,7 +428,7 @@ func isValidMessageRole(role string) bool {
 
 func isValidCommand(cmd string) bool {
 	switch strings.ToLower(cmd) {
-	case "from", "license", "template", "system", "adapter", "parameter", "message":
+	case "from", "license", "template", "system", "adapter", "tokenizer", "quantize", "parameter", "profile", "message", "router", "route":
 		return true
 	default:
 		return false
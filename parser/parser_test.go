@@ -182,6 +182,83 @@ PARAMETER param1
 	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
 }
 
+func TestParseFileProfiles(t *testing.T) {
+	input := `
+FROM foo
+PARAMETER temperature 0.8
+PROFILE precise temperature 0.1
+profile deterministic-v2 stop "<|end|>"
+PROFILE precise seed 42`
+
+	modelfile, err := ParseFile(strings.NewReader(input))
+	require.NoError(t, err)
+
+	expected := []Command{
+		{Name: "model", Args: "foo"},
+		{Name: "temperature", Args: "0.8"},
+		{Name: "profile", Args: "precise temperature 0.1"},
+		{Name: "profile", Args: "deterministic-v2 stop <|end|>"},
+		{Name: "profile", Args: "precise seed 42"},
+	}
+
+	assert.Equal(t, expected, modelfile.Commands)
+	assert.Contains(t, modelfile.String(), `PROFILE deterministic-v2 stop <|end|>`)
+
+	_, err = ParseFile(strings.NewReader("FROM foo\nPROFILE precise\n"))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestParseFileQuantize(t *testing.T) {
+	modelfile, err := ParseFile(strings.NewReader("FROM foo\nQUANTIZE q4_K_M\n"))
+	require.NoError(t, err)
+
+	expected := []Command{
+		{Name: "model", Args: "foo"},
+		{Name: "quantize", Args: "q4_K_M"},
+	}
+
+	assert.Equal(t, expected, modelfile.Commands)
+	assert.Contains(t, modelfile.String(), "QUANTIZE q4_K_M")
+
+	req, err := modelfile.CreateRequest("")
+	require.NoError(t, err)
+	assert.Equal(t, "q4_K_M", req.Quantize)
+}
+
+func TestParseFileRouter(t *testing.T) {
+	input := `
+ROUTER intent-classifier
+ROUTE code codellama:7b
+route chat llama3.2
+SYSTEM You are a helpful assistant.`
+
+	modelfile, err := ParseFile(strings.NewReader(input))
+	require.NoError(t, err)
+
+	expected := []Command{
+		{Name: "router", Args: "intent-classifier"},
+		{Name: "route", Args: "code codellama:7b"},
+		{Name: "route", Args: "chat llama3.2"},
+		{Name: "system", Args: "You are a helpful assistant."},
+	}
+
+	assert.Equal(t, expected, modelfile.Commands)
+	assert.Contains(t, modelfile.String(), "ROUTE code codellama:7b")
+
+	req, err := modelfile.CreateRequest("")
+	require.NoError(t, err)
+	assert.Equal(t, &api.Router{
+		Classifier: "intent-classifier",
+		Routes:     map[string]string{"code": "codellama:7b", "chat": "llama3.2"},
+	}, req.Router)
+
+	modelfile, err = ParseFile(strings.NewReader("FROM foo\nROUTE code codellama\n"))
+	require.NoError(t, err)
+
+	_, err = modelfile.CreateRequest("")
+	require.Error(t, err)
+}
+
 func TestParseFileBadCommand(t *testing.T) {
 	input := `
 FROM foo
@@ -734,6 +811,24 @@ MESSAGE assistant Hi! How are you?
 				},
 			},
 		},
+		{
+			`FROM test
+PARAMETER temperature 0.8
+PROFILE precise temperature 0.1
+PROFILE precise top_k 10
+PROFILE creative temperature 1.2
+PROFILE creative stop "<|end|>"
+PROFILE creative stop "<|eot|>"
+`,
+			&api.CreateRequest{
+				From:       "test",
+				Parameters: map[string]any{"temperature": float32(0.8)},
+				Profiles: map[string]map[string]any{
+					"precise":  {"temperature": float32(0.1), "top_k": int64(10)},
+					"creative": {"temperature": float32(1.2), "stop": []string{"<|end|>", "<|eot|>"}},
+				},
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -803,6 +898,13 @@ func TestCreateRequestFiles(t *testing.T) {
 			fmt.Sprintf("FROM %s", name),
 			&api.CreateRequest{Files: map[string]string{name: digest}},
 		},
+		{
+			fmt.Sprintf("FROM %s\nTOKENIZER %s", name, name),
+			&api.CreateRequest{
+				Files:     map[string]string{name: digest},
+				Tokenizer: map[string]string{name: digest},
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -826,3 +928,206 @@ func TestCreateRequestFiles(t *testing.T) {
 		}
 	}
 }
+
+func TestParse(t *testing.T) {
+	input := `# a comment
+FROM llama3.2
+
+PARAMETER temperature 0.7
+  # an indented comment
+SYSTEM """
+You are a helpful assistant.
+""" # a trailing comment
+MESSAGE user 你好👋
+`
+
+	file, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, file.Nodes, 6)
+
+	assert.Equal(t, &Comment{Position: Pos{1, 1}, Text: " a comment"}, file.Nodes[0])
+	assert.Equal(t, Pos{2, 1}, file.Nodes[1].Pos())
+
+	parameter := file.Nodes[2].(*Directive)
+	assert.Equal(t, "PARAMETER", parameter.Keyword)
+	assert.Equal(t, []string{"temperature"}, parameter.Args)
+	assert.Equal(t, Value{Position: Pos{4, 23}, Text: "0.7", EndLine: 4}, parameter.Value)
+
+	assert.Equal(t, &Comment{Position: Pos{5, 3}, Text: " an indented comment"}, file.Nodes[3])
+
+	system := file.Nodes[4].(*Directive)
+	assert.Equal(t, Pos{6, 1}, system.Pos())
+	assert.Equal(t, 8, system.EndLine())
+	assert.Equal(t, QuoteTriple, system.Value.Quote)
+	assert.Equal(t, "\nYou are a helpful assistant.\n", system.Value.Text)
+	assert.Equal(t, &Comment{Position: Pos{8, 5}, Text: " a trailing comment"}, system.Comment)
+
+	message := file.Nodes[5].(*Directive)
+	assert.Equal(t, Pos{9, 14}, message.Value.Position)
+	assert.Equal(t, Command{Name: "message", Args: "user: 你好👋"}, message.Command())
+}
+
+func TestParseHeredoc(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected []Command
+		err      error
+	}{
+		{
+			"FROM foo\nTEMPLATE <<EOF\n{{ if .System }}\"\"\"{{ .System }}\"\"\"{{ end }}\n{{ .Prompt }}\nEOF\n",
+			[]Command{
+				{Name: "model", Args: "foo"},
+				{Name: "template", Args: "{{ if .System }}\"\"\"{{ .System }}\"\"\"{{ end }}\n{{ .Prompt }}"},
+			},
+			nil,
+		},
+		{
+			"FROM foo\nSYSTEM <<\"END\" # quoted\n  indented\n\nEOF\n  END\nPARAMETER stop <<EOF\n<|eot_id|>\nEOF",
+			[]Command{
+				{Name: "model", Args: "foo"},
+				{Name: "system", Args: "  indented\n\nEOF"},
+				{Name: "stop", Args: "<|eot_id|>"},
+			},
+			nil,
+		},
+		{
+			"FROM foo\nSYSTEM <<EOF\nEOF",
+			[]Command{
+				{Name: "model", Args: "foo"},
+				{Name: "system", Args: ""},
+			},
+			nil,
+		},
+		{
+			// not a heredoc
+			"FROM foo\nSYSTEM <<EOF >>\n",
+			[]Command{
+				{Name: "model", Args: "foo"},
+				{Name: "system", Args: "<<EOF >>"},
+			},
+			nil,
+		},
+		{
+			"FROM foo\nSYSTEM <<EOF\nnever closed\n",
+			nil,
+			io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run("", func(t *testing.T) {
+			modelfile, err := ParseFile(strings.NewReader(c.input))
+			require.ErrorIs(t, err, c.err)
+			if modelfile != nil {
+				assert.Equal(t, c.expected, modelfile.Commands)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	input := `FROM foo
+BADCOMMAND param1 value1
+PARAMETER temperature
+MESSAGE badguy I'm a bad guy!
+PARAMETER top_k 10
+PROFILE p@ecise temperature 0.1
+SYSTEM """
+never closed
+`
+
+	file, err := Parse(strings.NewReader(input))
+
+	var errs ParserErrors
+	require.ErrorAs(t, err, &errs)
+	assert.Equal(t, ParserErrors{
+		{LineNumber: 2, Column: 1, Msg: errInvalidCommand.Error(), Err: errInvalidCommand},
+		{LineNumber: 3, Column: 22, Msg: "missing value", Err: io.ErrUnexpectedEOF},
+		{LineNumber: 4, Column: 9, Msg: errInvalidMessageRole.Error(), Err: errInvalidMessageRole},
+		{LineNumber: 6, Column: 9, Msg: `invalid profile name "p@ecise"`},
+		{LineNumber: 7, Column: 8, Msg: "unterminated quoted value", Err: io.ErrUnexpectedEOF},
+	}, errs)
+
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Contains(t, err.Error(), "(line 4, column 9): message role must be one of")
+
+	// the nodes without errors are kept
+	assert.Equal(t, []Command{
+		{Name: "model", Args: "foo"},
+		{Name: "top_k", Args: "10"},
+	}, file.Commands())
+}
+
+func TestFormatModelfile(t *testing.T) {
+	input := `# Modelfile for a helpful assistant
+from   llama3.2
+parameter temperature    0.7
+
+
+Parameter stop "<|eot_id|>"
+system "  padded  " # keep the padding
+TEMPLATE """{{ .Prompt }}
+"""
+LICENSE <<EOF
+MIT
+EOF
+MESSAGE user    <<END
+triple quotes are written as
+"""
+END
+`
+
+	expected := `# Modelfile for a helpful assistant
+FROM llama3.2
+PARAMETER temperature 0.7
+
+PARAMETER stop <|eot_id|>
+SYSTEM """  padded  """ # keep the padding
+TEMPLATE """{{ .Prompt }}
+"""
+LICENSE MIT
+MESSAGE user <<EOF
+triple quotes are written as
+"""
+EOF
+`
+
+	file, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+
+	actual := FormatModelfile(file)
+	assert.Equal(t, expected, actual)
+
+	// formatting is idempotent
+	file, err = Parse(strings.NewReader(actual))
+	require.NoError(t, err)
+	assert.Equal(t, expected, FormatModelfile(file))
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add("FROM foo\nPARAMETER stop \"<|eot_id|>\"\n")
+	f.Add("FROM foo\nSYSTEM \"\"\"\nmultiline\n\"\"\" # comment\n")
+	f.Add("FROM foo\nTEMPLATE <<EOF\n\"\"\"\nEOF\n")
+	f.Add("# comment\nMESSAGE user \"hi\" # there\nPROFILE p top_k 1")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		file, err := Parse(strings.NewReader(s))
+		if err != nil {
+			return
+		}
+
+		formatted := FormatModelfile(file)
+		file2, err := Parse(strings.NewReader(formatted))
+		if err != nil {
+			t.Fatalf("formatted Modelfile does not parse: %v\n%s", err, formatted)
+		}
+
+		if diff := cmp.Diff(file.Commands(), file2.Commands()); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s\n%s", diff, formatted)
+		}
+
+		if formatted2 := FormatModelfile(file2); formatted2 != formatted {
+			t.Errorf("formatting is not idempotent:\n%s\n%s", formatted, formatted2)
+		}
+	})
+}
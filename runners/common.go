@@ -53,6 +53,42 @@ func GetCPUCapability() CPUCapability {
 	return CPUCapabilityNone
 }
 
+// CPUFeatures returns the vector extensions of the CPU that inference uses,
+// such as "avx2" or "avx512f" on x86 and "dotprod" or "sve" on ARM.
+func CPUFeatures() []string {
+	features := []string{}
+	for _, f := range []struct {
+		name string
+		ok   bool
+	}{
+		{"sse3", cpu.X86.HasSSE3},
+		{"ssse3", cpu.X86.HasSSSE3},
+		{"avx", cpu.X86.HasAVX},
+		{"avx2", cpu.X86.HasAVX2},
+		{"fma", cpu.X86.HasFMA},
+		{"avx512f", cpu.X86.HasAVX512F},
+		{"avx512bw", cpu.X86.HasAVX512BW},
+		{"avx512vl", cpu.X86.HasAVX512VL},
+		{"avx512vbmi", cpu.X86.HasAVX512VBMI},
+		{"avx512vnni", cpu.X86.HasAVX512VNNI},
+		{"avx512bf16", cpu.X86.HasAVX512BF16},
+		{"amx_int8", cpu.X86.HasAMXInt8},
+		{"amx_bf16", cpu.X86.HasAMXBF16},
+		{"neon", cpu.ARM64.HasASIMD},
+		{"fp16", cpu.ARM64.HasFPHP},
+		{"dotprod", cpu.ARM64.HasASIMDDP},
+		{"i8mm", cpu.ARM64.HasI8MM},
+		{"sve", cpu.ARM64.HasSVE},
+		{"sve2", cpu.ARM64.HasSVE2},
+	} {
+		if f.ok {
+			features = append(features, f.name)
+		}
+	}
+
+	return features
+}
+
 // Return the location where runners were located
 // empty string indicates only builtin is present
 func Locate() string {
@@ -0,0 +1,180 @@
+// Package sampletrace reads and writes sampler trace files.
+//
+// A trace records, for each token of a response, the candidates the sampler
+// considered after each of its stages: the raw logits, each sampler in the
+// chain such as penalties, top-k and temperature, and finally the token
+// chosen. Traces make it possible to tell which stage is responsible for
+// repetitive or degenerate output.
+//
+// A trace file is gzip compressed JSON lines: a [Header] followed by a
+// [Token] for each sampled token.
+package sampletrace
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Version is the version of the trace format written by this package.
+const Version = 1
+
+// Ext is the file extension of trace files.
+const Ext = ".trace"
+
+// Header describes the request a trace was captured for.
+type Header struct {
+	Version   int       `json:"version"`
+	Model     string    `json:"model"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// PromptTokens is the number of tokens in the prompt
+	PromptTokens int `json:"prompt_tokens"`
+
+	// Options are the sampling options of the request
+	Options map[string]any `json:"options,omitempty"`
+}
+
+// Token is a sampled token and the stages of sampling that chose it.
+type Token struct {
+	Token  int     `json:"token"`
+	Piece  string  `json:"piece"`
+	Stages []Stage `json:"stages"`
+}
+
+// Stage is the state of the candidates after a stage of sampling.
+type Stage struct {
+	Name string `json:"name"`
+
+	// Candidates is the number of tokens that could still be sampled
+	Candidates int `json:"candidates"`
+
+	// Top are the most likely candidates, most likely first
+	Top []Candidate `json:"top"`
+}
+
+// Candidate is a token and its probability over the remaining candidates.
+type Candidate struct {
+	Token int     `json:"token"`
+	Piece string  `json:"piece"`
+	Logit float32 `json:"logit"`
+	Prob  float32 `json:"prob"`
+}
+
+// Decisive returns the index of the stage after which the sampled token
+// became the most likely candidate and stayed so, or -1 if it never was and
+// the token was drawn at random from the final distribution.
+func (t Token) Decisive() int {
+	decisive := -1
+	for i, s := range t.Stages {
+		top := len(s.Top) > 0 && s.Top[0].Token == t.Token
+		switch {
+		case top && decisive < 0:
+			decisive = i
+		case !top:
+			decisive = -1
+		}
+	}
+
+	return decisive
+}
+
+// A Writer writes a trace file.
+type Writer struct {
+	f  *os.File
+	zw *gzip.Writer
+	bw *bufio.Writer
+	e  *json.Encoder
+}
+
+// Create creates the trace file at path and writes its header.
+func Create(path string, h Header) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	zw := gzip.NewWriter(f)
+	bw := bufio.NewWriter(zw)
+	w := &Writer{f: f, zw: zw, bw: bw, e: json.NewEncoder(bw)}
+
+	h.Version = Version
+	if h.CreatedAt.IsZero() {
+		h.CreatedAt = time.Now().UTC()
+	}
+
+	if err := w.e.Encode(h); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Write appends t to the trace.
+func (w *Writer) Write(t Token) error {
+	return w.e.Encode(t)
+}
+
+// Close flushes the trace and closes the file.
+func (w *Writer) Close() error {
+	return errors.Join(w.bw.Flush(), w.zw.Close(), w.f.Close())
+}
+
+// Trace is the contents of a trace file.
+type Trace struct {
+	Header
+	Tokens []Token
+}
+
+// Read reads a trace from r.
+func Read(r io.Reader) (*Trace, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a trace file: %w", err)
+	}
+	defer zr.Close()
+
+	d := json.NewDecoder(zr)
+
+	var t Trace
+	if err := d.Decode(&t.Header); err != nil {
+		return nil, fmt.Errorf("invalid trace header: %w", err)
+	}
+
+	if t.Version != Version {
+		return nil, fmt.Errorf("unsupported trace version %d", t.Version)
+	}
+
+	for {
+		var tok Token
+		if err := d.Decode(&tok); errors.Is(err, io.EOF) {
+			break
+		} else if errors.Is(err, io.ErrUnexpectedEOF) {
+			// a trace still being written or cut short; keep what was read
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		t.Tokens = append(t.Tokens, tok)
+	}
+
+	return &t, nil
+}
+
+// Open reads the trace file at path.
+func Open(path string) (*Trace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(f)
+}
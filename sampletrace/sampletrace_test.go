@@ -0,0 +1,105 @@
+package sampletrace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test"+Ext)
+
+	w, err := Create(path, Header{Model: "test", PromptTokens: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := []Token{
+		{
+			Token: 2,
+			Piece: "b",
+			Stages: []Stage{
+				{Name: "logits", Candidates: 3, Top: []Candidate{{1, "a", 2, 0.6}, {2, "b", 1, 0.3}}},
+				{Name: "dist", Candidates: 3, Top: []Candidate{{1, "a", 2, 0.6}, {2, "b", 1, 0.3}}},
+			},
+		},
+		{
+			Token: 1,
+			Piece: "a",
+			Stages: []Stage{
+				{Name: "logits", Candidates: 3, Top: []Candidate{{1, "a", 2, 0.6}}},
+			},
+		},
+	}
+
+	for _, tok := range tokens {
+		if err := w.Write(tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tr.Version != Version || tr.Model != "test" || tr.PromptTokens != 3 || tr.CreatedAt.IsZero() {
+		t.Errorf("unexpected header %+v", tr.Header)
+	}
+
+	if diff := cmp.Diff(tokens, tr.Tokens); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test"+Ext)
+	if err := os.WriteFile(path, []byte("not a trace"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(path); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecisive(t *testing.T) {
+	top := func(tokens ...int) []Candidate {
+		var c []Candidate
+		for _, t := range tokens {
+			c = append(c, Candidate{Token: t})
+		}
+		return c
+	}
+
+	cases := []struct {
+		name   string
+		stages [][]Candidate
+		want   int
+	}{
+		{"model", [][]Candidate{top(1, 2), top(1), top(1)}, 0},
+		{"later stage", [][]Candidate{top(2, 1), top(2, 1), top(1, 2)}, 2},
+		{"lost and regained", [][]Candidate{top(1, 2), top(2, 1), top(1)}, 2},
+		{"random", [][]Candidate{top(2, 1), top(2, 1)}, -1},
+		{"empty", nil, -1},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tok := Token{Token: 1}
+			for _, s := range tt.stages {
+				tok.Stages = append(tok.Stages, Stage{Top: s})
+			}
+
+			if got := tok.Decisive(); got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
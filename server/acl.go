@@ -0,0 +1,470 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/types/model"
+)
+
+const (
+	aclRun    = "run"
+	aclPull   = "pull"
+	aclDelete = "delete"
+)
+
+var (
+	errACLUnauthorized = errors.New("a valid API key is required")
+	errACLForbidden    = errors.New("not allowed")
+	errACLRateLimited  = errors.New("rate limit exceeded")
+	errACLDisabled     = errors.New("access control is disabled: set OLLAMA_ACL to the path of an access control file")
+)
+
+// aclUser is an entry in the access control file: the API keys of a user or
+// team, the patterns of the models they may run, pull and delete, and how
+// much each of their keys may be used.
+type aclUser struct {
+	Name string `json:"name"`
+
+	// Keys are the API keys of the user, sent as bearer tokens. A user
+	// without keys applies to requests that send none.
+	Keys []string `json:"keys,omitempty"`
+
+	Run    []string `json:"run,omitempty"`
+	Pull   []string `json:"pull,omitempty"`
+	Delete []string `json:"delete,omitempty"`
+
+	// Admin lets the user change the configuration of the server, such as
+	// its log level and API keys.
+	Admin bool `json:"admin,omitempty"`
+
+	// RequestsPerMinute and TokensPerMinute limit the requests and the
+	// prompt and generated tokens of each key. 0 is unlimited.
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	TokensPerMinute   int `json:"tokens_per_minute,omitempty"`
+}
+
+// aclConfig is the content of the access control file.
+type aclConfig struct {
+	Users []*aclUser `json:"users"`
+}
+
+// accessList restricts the models each API key can run, pull and delete,
+// and rate limits each key. A nil accessList allows everything.
+type accessList struct {
+	// path is the access control file, which changes to the keys are saved
+	// to
+	path string
+
+	mu     sync.Mutex
+	config aclConfig
+	users  map[string]*aclUser
+	limits map[string]*rateLimit
+}
+
+// loadACL reads the access control file at path. It returns nil if path is
+// empty.
+func loadACL(path string) (*accessList, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var config aclConfig
+	if err := json.NewDecoder(f).Decode(&config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	acl := accessList{path: path}
+	if err := acl.set(config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &acl, nil
+}
+
+// set replaces the users of the access list with those of config. The lock
+// must be held, or acl not yet shared.
+func (acl *accessList) set(config aclConfig) error {
+	users := make(map[string]*aclUser)
+	for _, u := range config.Users {
+		keys := u.Keys
+		if len(keys) == 0 {
+			keys = []string{""}
+		}
+
+		for _, key := range keys {
+			if _, ok := users[key]; ok {
+				return fmt.Errorf("user %q: key is used more than once", u.Name)
+			}
+
+			users[key] = u
+		}
+	}
+
+	// forget the rate limits of deleted keys
+	for key := range acl.limits {
+		if _, ok := users[key]; !ok {
+			delete(acl.limits, key)
+		}
+	}
+
+	acl.config = config
+	acl.users = users
+	return nil
+}
+
+// save writes the users of the access list to its file.
+func (acl *accessList) save() error {
+	bts, err := json.MarshalIndent(acl.config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(acl.path), filepath.Base(acl.path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(append(bts, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), acl.path)
+}
+
+// update changes the users of the access list with fn and saves them.
+func (acl *accessList) update(fn func(users []*aclUser) []*aclUser) error {
+	if acl == nil {
+		return errACLDisabled
+	}
+
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+
+	previous := acl.config
+	config := acl.config
+	config.Users = fn(append([]*aclUser(nil), config.Users...))
+	if err := acl.set(config); err != nil {
+		return err
+	}
+
+	if err := acl.save(); err != nil {
+		acl.set(previous) //nolint:errcheck
+		return err
+	}
+
+	return nil
+}
+
+// newKey returns a new random API key.
+func newKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return "ollama-" + hex.EncodeToString(b), nil
+}
+
+type (
+	aclUserKey   struct{}
+	aclLimitKey  struct{}
+	aclSystemKey struct{}
+)
+
+// systemContext marks ctx as that of the server itself, such as when it
+// preloads models or evaluates prefixes again, rather than of a request.
+// The access list allows everything to it.
+func systemContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, aclSystemKey{}, true)
+}
+
+func isSystem(ctx context.Context) bool {
+	system, _ := ctx.Value(aclSystemKey{}).(bool)
+	return system
+}
+
+// publicPaths can be requested without a key, so that load balancers can
+// check the server
+var publicPaths = []string{"/", "/api/version", "/api/health"}
+
+// middleware identifies the user of a request from its API key and applies
+// the rate limits of the key. Requests with an unknown key, or without a key
+// if no user applies to those, are denied on every route but publicPaths.
+func (acl *accessList) middleware(c *gin.Context) {
+	if acl == nil {
+		c.Next()
+		return
+	}
+
+	key, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+
+	acl.mu.Lock()
+	u, ok := acl.users[key]
+	var limit *rateLimit
+	if ok {
+		limit = acl.limit(key, u)
+	}
+	acl.mu.Unlock()
+
+	if !ok {
+		if !slices.Contains(publicPaths, c.Request.URL.Path) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errACLUnauthorized.Error()})
+			return
+		}
+
+		c.Next()
+		return
+	}
+
+	if wait := limit.allow(time.Now()); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": errACLRateLimited.Error()})
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), aclUserKey{}, u)
+	ctx = context.WithValue(ctx, aclLimitKey{}, limit)
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+}
+
+// limit returns the rate limit of key, which belongs to u, or nil if u has
+// none. The lock must be held.
+func (acl *accessList) limit(key string, u *aclUser) *rateLimit {
+	if u.RequestsPerMinute <= 0 && u.TokensPerMinute <= 0 {
+		return nil
+	}
+
+	l, ok := acl.limits[key]
+	if !ok || l.requests.perMinute != float64(u.RequestsPerMinute) || l.tokens.perMinute != float64(u.TokensPerMinute) {
+		if acl.limits == nil {
+			acl.limits = make(map[string]*rateLimit)
+		}
+
+		l = newRateLimit(u.RequestsPerMinute, u.TokensPerMinute, time.Now())
+		acl.limits[key] = l
+	}
+
+	return l
+}
+
+// consume counts tokens prompted or generated by the request of ctx against
+// the rate limit of its key.
+func (acl *accessList) consume(ctx context.Context, tokens int) {
+	if l, ok := ctx.Value(aclLimitKey{}).(*rateLimit); ok {
+		l.consume(time.Now(), tokens)
+	}
+}
+
+// bucket is a token bucket refilled with perMinute tokens a minute, up to
+// perMinute, so keys may burst a minute's worth.
+type bucket struct {
+	perMinute float64
+	level     float64
+	last      time.Time
+}
+
+func (b *bucket) fill(now time.Time) {
+	b.level = min(b.perMinute, b.level+now.Sub(b.last).Minutes()*b.perMinute)
+	b.last = now
+}
+
+// wait returns how long until the bucket has a token.
+func (b *bucket) wait() time.Duration {
+	if b.level >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.level) / b.perMinute * float64(time.Minute))
+}
+
+// rateLimit limits the requests and tokens a minute of an API key.
+type rateLimit struct {
+	mu       sync.Mutex
+	requests bucket
+	tokens   bucket
+}
+
+func newRateLimit(requests, tokens int, now time.Time) *rateLimit {
+	return &rateLimit{
+		requests: bucket{perMinute: float64(requests), level: float64(requests), last: now},
+		tokens:   bucket{perMinute: float64(tokens), level: float64(tokens), last: now},
+	}
+}
+
+// allow takes a request from the limit, returning how long to wait if
+// there is none left. Tokens are only counted once responses are done, so
+// requests are allowed while any are left.
+func (l *rateLimit) allow(now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var wait time.Duration
+	if l.requests.perMinute > 0 {
+		l.requests.fill(now)
+		wait = l.requests.wait()
+	}
+
+	if l.tokens.perMinute > 0 {
+		l.tokens.fill(now)
+		wait = max(wait, l.tokens.wait())
+	}
+
+	if wait == 0 {
+		l.requests.level--
+	}
+
+	return wait
+}
+
+func (l *rateLimit) consume(now time.Time, tokens int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.tokens.perMinute > 0 {
+		l.tokens.fill(now)
+		l.tokens.level -= float64(tokens)
+	}
+}
+
+// check returns an error unless the user of ctx may perform action on the
+// model called name.
+func (acl *accessList) check(ctx context.Context, action string, name model.Name) error {
+	if acl == nil || isSystem(ctx) {
+		return nil
+	}
+
+	u, ok := ctx.Value(aclUserKey{}).(*aclUser)
+	if !ok {
+		return errACLUnauthorized
+	}
+
+	var patterns []string
+	switch action {
+	case aclRun:
+		patterns = u.Run
+	case aclPull:
+		patterns = u.Pull
+	case aclDelete:
+		patterns = u.Delete
+	}
+
+	for _, p := range patterns {
+		// a pattern without a tag matches all tags of the model
+		if strings.LastIndex(p, ":") <= strings.LastIndex(p, "/") {
+			p += ":*"
+		}
+
+		if name.Match(model.ParseName(p)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w to %s %s", errACLForbidden, action, name.DisplayShortest())
+}
+
+// checkSource returns an error unless the user of ctx may read the model
+// called name to copy, create from or push it: it must be allowed to run or
+// pull the model, or to pull it if it isn't here yet, as reading it then
+// pulls it.
+func (acl *accessList) checkSource(ctx context.Context, name model.Name) error {
+	if acl == nil {
+		return nil
+	}
+
+	if _, err := ParseNamedManifest(name); err == nil {
+		if err := acl.check(ctx, aclRun, name); !errors.Is(err, errACLForbidden) {
+			return err
+		}
+	}
+
+	return acl.check(ctx, aclPull, name)
+}
+
+// checkReplace returns an error unless the user of ctx may replace the
+// model called name with a copy, create or update. Replacing a model deletes
+// it, so this is only allowed to users who may delete it, if it exists.
+func (acl *accessList) checkReplace(ctx context.Context, name model.Name) error {
+	if acl == nil {
+		return nil
+	}
+
+	if _, err := ParseNamedManifest(name); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return acl.check(ctx, aclDelete, name)
+}
+
+// userName returns the name of the user of ctx, or "" if access control is
+// disabled.
+func userName(ctx context.Context) string {
+	if u, ok := ctx.Value(aclUserKey{}).(*aclUser); ok {
+		return u.Name
+	}
+
+	return ""
+}
+
+// checkAdmin returns an error unless the user of ctx is an admin.
+func (acl *accessList) checkAdmin(ctx context.Context) error {
+	if acl == nil || isSystem(ctx) {
+		return nil
+	}
+
+	u, ok := ctx.Value(aclUserKey{}).(*aclUser)
+	if !ok {
+		return errACLUnauthorized
+	}
+
+	if !u.Admin {
+		return fmt.Errorf("%w to administer the server", errACLForbidden)
+	}
+
+	return nil
+}
+
+// aclStatus returns the HTTP status of an error returned by
+// [accessList.check], or 0 for other errors.
+func aclStatus(err error) int {
+	switch {
+	case errors.Is(err, errACLUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, errACLForbidden):
+		return http.StatusForbidden
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,352 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestAccessList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	path := filepath.Join(t.TempDir(), "acl.json")
+	if err := os.WriteFile(path, []byte(`{"users": [
+		{"name": "team-a", "keys": ["key-a"], "run": ["llama3.2", "team-a/*"], "pull": ["*/*/*:*"]},
+		{"name": "admin", "keys": ["key-admin"], "run": ["*/*/*:*"], "pull": ["*/*/*:*"], "delete": ["*/*/*:*"]},
+		{"name": "anonymous", "run": ["smollm:135m"]}
+	]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	acl, err := loadACL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// user returns the context of a request sent with key
+	user := func(key string) context.Context {
+		r := httptest.NewRequest(http.MethodPost, "/api/generate", nil)
+		if key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+
+		var ctx context.Context
+		_, router := gin.CreateTestContext(httptest.NewRecorder())
+		router.Use(acl.middleware)
+		router.POST("/api/generate", func(c *gin.Context) { ctx = c.Request.Context() })
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		return ctx
+	}
+
+	cases := []struct {
+		key    string
+		action string
+		name   string
+		err    error
+	}{
+		{"key-a", aclRun, "llama3.2", nil},
+		{"key-a", aclRun, "llama3.2:1b", nil},
+		{"key-a", aclRun, "team-a/assistant:v2", nil},
+		{"key-a", aclRun, "mistral", errACLForbidden},
+		{"key-a", aclPull, "mistral", nil},
+		{"key-a", aclDelete, "llama3.2", errACLForbidden},
+		{"key-admin", aclDelete, "llama3.2", nil},
+		{"", aclRun, "smollm:135m", nil},
+		{"", aclRun, "smollm:360m", errACLForbidden},
+		{"", aclPull, "smollm:135m", errACLForbidden},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.key+" "+tt.action+" "+tt.name, func(t *testing.T) {
+			if err := acl.check(user(tt.key), tt.action, model.ParseName(tt.name)); !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	// the server itself is allowed everything, without a key
+	if err := acl.check(systemContext(context.Background()), aclDelete, model.ParseName("llama3.2")); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	if err := acl.checkAdmin(systemContext(context.Background())); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	if err := acl.check(context.Background(), aclRun, model.ParseName("llama3.2")); !errors.Is(err, errACLUnauthorized) {
+		t.Errorf("expected %v, got %v", errACLUnauthorized, err)
+	}
+
+	// no access list allows everything
+	var none *accessList
+	if err := none.check(context.Background(), aclDelete, model.ParseName("llama3.2")); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestAccessListHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	s := Server{acl: &accessList{users: map[string]*aclUser{
+		"":       {Name: "anonymous", Run: []string{"allowed"}},
+		"key":    {Name: "admin", Pull: []string{"*/*/*:*"}, Delete: []string{"*/*/*:*"}},
+		"runner": {Name: "runner", Run: []string{"test"}},
+	}}}
+	router := s.GenerateRoutes()
+
+	_, digest := createBinFile(t, nil, nil)
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "test",
+		Files:  map[string]string{"test.gguf": digest},
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	s.transfers = newTransferStore()
+	_, _, done := s.transfers.start(context.Background(), "pull", "test")
+	defer done()
+	transfer := "/api/transfers/" + s.transfers.list()[0].ID
+
+	cases := []struct {
+		method, path, key, body string
+		status                  int
+	}{
+		{http.MethodDelete, "/api/delete", "", `{"model": "test"}`, http.StatusForbidden},
+		{http.MethodDelete, "/api/delete", "unknown", `{"model": "test"}`, http.StatusUnauthorized},
+		{http.MethodDelete, "/api/delete", "key", `{"model": "missing"}`, http.StatusNotFound},
+		{http.MethodPost, "/api/pull", "", `{"model": "test"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/generate", "", `{"model": "test", "prompt": "hi"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/copy", "", `{"source": "test", "destination": "allowed"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/create", "", `{"model": "allowed", "from": "test"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/push", "", `{"model": "test"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/copy", "runner", `{"source": "allowed", "destination": "test2"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/copy", "runner", `{"source": "test", "destination": "test"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/create", "runner", `{"model": "test", "from": "test"}`, http.StatusForbidden},
+		{http.MethodPatch, "/api/model", "runner", `{"model": "test", "num_ctx": 4096}`, http.StatusForbidden},
+		{http.MethodPost, "/api/copy", "runner", `{"source": "test", "destination": "test2"}`, http.StatusOK},
+		{http.MethodPost, "/api/alias", "", `{"alias": "prod", "target": "test"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/alias", "runner", `{"alias": "prod", "target": "test"}`, http.StatusOK},
+		{http.MethodPost, "/api/alias", "runner", `{"alias": "prod", "target": "test2"}`, http.StatusForbidden},
+		{http.MethodDelete, "/api/alias", "runner", `{"alias": "prod"}`, http.StatusForbidden},
+		{http.MethodDelete, "/api/alias", "key", `{"alias": "prod"}`, http.StatusOK},
+		{http.MethodPost, "/api/unload", "", `{"model": "test"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/defrag", "runner", "", http.StatusForbidden},
+		{http.MethodDelete, transfer, "runner", "", http.StatusForbidden},
+		{http.MethodDelete, transfer, "key", "", http.StatusOK},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.path+" "+tt.key, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.key != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	now := time.Now()
+
+	requests := newRateLimit(2, 0, now)
+	for i, expected := range []time.Duration{0, 0, 30 * time.Second} {
+		if wait := requests.allow(now); wait != expected {
+			t.Errorf("request %d: expected to wait %s, got %s", i, expected, wait)
+		}
+	}
+
+	// half a minute refills a request
+	if wait := requests.allow(now.Add(30 * time.Second)); wait != 0 {
+		t.Errorf("expected no wait after refilling, got %s", wait)
+	}
+
+	tokens := newRateLimit(0, 100, now)
+	if wait := tokens.allow(now); wait != 0 {
+		t.Errorf("expected no wait, got %s", wait)
+	}
+
+	// responses may overspend the tokens left
+	tokens.consume(now, 150)
+	if wait := tokens.allow(now); wait != 30*time.Second+600*time.Millisecond {
+		t.Errorf("expected to wait 30.6s, got %s", wait)
+	}
+
+	var none *rateLimit
+	if wait := none.allow(now); wait != 0 {
+		t.Errorf("expected no limit, got %s", wait)
+	}
+}
+
+func TestAccessListLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	acl := &accessList{}
+	if err := acl.set(aclConfig{Users: []*aclUser{
+		{Name: "limited", Keys: []string{"key-limited"}, RequestsPerMinute: 1},
+		{Name: "unlimited", Keys: []string{"key-unlimited"}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, router := gin.CreateTestContext(httptest.NewRecorder())
+	router.Use(acl.middleware)
+	for _, path := range []string{"/", "/api/tags"} {
+		router.GET(path, func(c *gin.Context) { c.Status(http.StatusOK) })
+	}
+
+	cases := []struct {
+		path, key string
+		status    int
+	}{
+		{"/", "", http.StatusOK},
+		{"/api/tags", "", http.StatusUnauthorized},
+		{"/api/tags", "unknown", http.StatusUnauthorized},
+		{"/api/tags", "key-limited", http.StatusOK},
+		{"/api/tags", "key-limited", http.StatusTooManyRequests},
+		{"/api/tags", "key-unlimited", http.StatusOK},
+		{"/api/tags", "key-unlimited", http.StatusOK},
+	}
+
+	for _, tt := range cases {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.key != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.key)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.path, tt.key, tt.status, w.Code)
+		}
+
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "60" {
+			t.Errorf("expected to retry after 60s, got %q", w.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestKeysHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	path := filepath.Join(t.TempDir(), "acl.json")
+	if err := os.WriteFile(path, []byte(`{"users": [{"name": "admin", "keys": ["key-admin"], "admin": true}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	acl, err := loadACL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Server{acl: acl}
+	router := s.GenerateRoutes()
+
+	do := func(method, key string, body any, resp any) int {
+		t.Helper()
+
+		bts, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(method, "/api/admin/keys", bytes.NewReader(bts))
+		r.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if resp != nil && w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return w.Code
+	}
+
+	var created api.CreateKeyResponse
+	if status := do(http.MethodPost, "key-admin", api.APIKeyUser{Name: "team-a", Run: []string{"llama3.2"}, TokensPerMinute: 1000}, &created); status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	if created.Name != "team-a" || !strings.HasPrefix(created.Key, "ollama-") {
+		t.Fatalf("unexpected key %+v", created)
+	}
+
+	// only admins manage keys
+	if status := do(http.MethodPost, created.Key, api.APIKeyUser{Name: "team-b"}, nil); status != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", status)
+	}
+
+	if status := do(http.MethodGet, "unknown", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", status)
+	}
+
+	var list api.ListKeysResponse
+	if status := do(http.MethodGet, "key-admin", nil, &list); status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	if diff := cmp.Diff(list.Users, []api.APIKeyUser{
+		{Name: "admin", Keys: []string{"...dmin"}, Admin: true},
+		{Name: "team-a", Keys: []string{"..." + created.Key[len(created.Key)-4:]}, Run: []string{"llama3.2"}, TokensPerMinute: 1000},
+	}); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	// keys are saved to the access control file
+	reloaded, err := loadACL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u := reloaded.users[created.Key]; u == nil || u.Name != "team-a" || u.TokensPerMinute != 1000 {
+		t.Errorf("expected the key to be saved, got %+v", u)
+	}
+
+	if status := do(http.MethodDelete, "key-admin", api.DeleteKeyRequest{Key: created.Key}, nil); status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	if status := do(http.MethodDelete, "key-admin", api.DeleteKeyRequest{Key: created.Key}, nil); status != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", status)
+	}
+
+	reloaded, err = loadACL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reloaded.config.Users) != 1 || reloaded.users[created.Key] != nil {
+		t.Errorf("expected the key to be deleted, got %+v", reloaded.config.Users)
+	}
+
+	// keys can't be managed without an access control file
+	s = Server{}
+	router = s.GenerateRoutes()
+	if status := do(http.MethodPost, "", api.APIKeyUser{Name: "team-a"}, nil); status != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", status)
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ollama/ollama/types/model"
+)
+
+var errBadAdapter = errors.New("invalid adapter")
+
+// resolveAdapter returns the path of the LoRA adapter a request asks to
+// apply to m: the adapter of the model called name, which must have been
+// created from the same base model as m, or an adapter file given by its
+// absolute path.
+func resolveAdapter(m *Model, name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+
+	if filepath.IsAbs(name) {
+		if _, err := os.Stat(name); err != nil {
+			return "", fmt.Errorf("%w: %w", errBadAdapter, err)
+		}
+
+		return name, nil
+	}
+
+	if !model.ParseName(name).IsValid() {
+		return "", fmt.Errorf("%w: %q is neither a model name nor an absolute path", errBadAdapter, name)
+	}
+
+	am, err := GetModel(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: model %q not found", errBadAdapter, name)
+	} else if err != nil {
+		return "", err
+	}
+
+	switch {
+	case len(am.AdapterPaths) != 1:
+		return "", fmt.Errorf("%w: model %q must have exactly one adapter", errBadAdapter, name)
+	case am.ModelPath != m.ModelPath:
+		return "", fmt.Errorf("%w: model %q was not created from the same base model", errBadAdapter, name)
+	}
+
+	return am.AdapterPaths[0], nil
+}
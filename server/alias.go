@@ -0,0 +1,248 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+// aliasMu serializes changes to the alias table.
+var aliasMu sync.Mutex
+
+// aliasesPath returns the path of the alias table, kept in the models
+// directory next to the manifests it refers to. It maps the names of aliases
+// to the names of their targets.
+func aliasesPath() string {
+	return filepath.Join(envconfig.Models(), "aliases.json")
+}
+
+func readAliases() (map[string]model.Name, error) {
+	aliases := make(map[string]model.Name)
+	b, err := os.ReadFile(aliasesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return aliases, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &aliases); err != nil {
+		return nil, fmt.Errorf("%s: %w", aliasesPath(), err)
+	}
+
+	return aliases, nil
+}
+
+func writeAliases(aliases map[string]model.Name) error {
+	b, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(aliasesPath()), 0o755); err != nil {
+		return err
+	}
+
+	// readers resolving names race changes to the table, so replace it at
+	// once rather than truncate it
+	return replaceFile(filepath.Dir(aliasesPath()), aliasesPath(), b)
+}
+
+// findAlias returns the key of the alias n in aliases. Like model names,
+// aliases are case insensitive.
+func findAlias(aliases map[string]model.Name, n model.Name) (string, bool) {
+	for k := range aliases {
+		if model.ParseName(k).EqualFold(n) {
+			return k, true
+		}
+	}
+
+	return "", false
+}
+
+// resolveName is like getExistingName but also resolves aliases. A model
+// takes precedence over an alias of the same name.
+func resolveName(n model.Name) (model.Name, error) {
+	n, err := getExistingName(n)
+	if err != nil {
+		return n, err
+	}
+
+	if _, err := ParseNamedManifest(n); !errors.Is(err, os.ErrNotExist) {
+		return n, nil
+	}
+
+	aliases, err := readAliases()
+	if err != nil {
+		return n, err
+	}
+
+	if k, ok := findAlias(aliases, n); ok {
+		return getExistingName(aliases[k])
+	}
+
+	return n, nil
+}
+
+func (s *Server) CreateAliasHandler(c *gin.Context) {
+	var req api.AliasRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alias := model.ParseName(req.Alias)
+	if !alias.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("alias %q is invalid", req.Alias)})
+		return
+	} else if alias.HasDigest() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("alias %q is invalid: %v", req.Alias, errNameDigest)})
+		return
+	}
+
+	target := model.ParseName(req.Target)
+	if !target.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("target %q is invalid", req.Target)})
+		return
+	}
+
+	// aliases point at models rather than other aliases so they resolve in
+	// one step and cannot form cycles
+	target, err := getExistingName(target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := ParseNamedManifest(target); errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Target)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// an alias lets others run its target, so only users who may run it
+	// can point one at it
+	if err := s.acl.check(c.Request.Context(), aclRun, target); err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if existing, err := getExistingName(alias); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if _, err := ParseNamedManifest(existing); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("alias '%s' is the name of a model", req.Alias)})
+		return
+	}
+
+	aliasMu.Lock()
+	defer aliasMu.Unlock()
+
+	aliases, err := readAliases()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if k, ok := findAlias(aliases, alias); ok {
+		// pointing an alias elsewhere replaces it, as deleting it would
+		if err := s.acl.check(c.Request.Context(), aclDelete, alias); err != nil {
+			c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		delete(aliases, k)
+	}
+
+	aliases[alias.String()] = target
+	if err := writeAliases(aliases); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.Alias{Alias: alias.DisplayShortest(), Target: target.DisplayShortest()})
+}
+
+func (s *Server) DeleteAliasHandler(c *gin.Context) {
+	var req api.AliasRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alias := model.ParseName(req.Alias)
+	if !alias.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("alias %q is invalid", req.Alias)})
+		return
+	}
+
+	if err := s.acl.check(c.Request.Context(), aclDelete, alias); err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	aliasMu.Lock()
+	defer aliasMu.Unlock()
+
+	aliases, err := readAliases()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	k, ok := findAlias(aliases, alias)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("alias '%s' not found", req.Alias)})
+		return
+	}
+
+	delete(aliases, k)
+	if err := writeAliases(aliases); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func (s *Server) ListAliasesHandler(c *gin.Context) {
+	aliases, err := readAliases()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := api.ListAliasesResponse{Aliases: []api.Alias{}}
+	for k, target := range aliases {
+		resp.Aliases = append(resp.Aliases, api.Alias{
+			Alias:  model.ParseName(k).DisplayShortest(),
+			Target: target.DisplayShortest(),
+		})
+	}
+
+	slices.SortFunc(resp.Aliases, func(a, b api.Alias) int {
+		return strings.Compare(a.Alias, b.Alias)
+	})
+
+	c.JSON(http.StatusOK, resp)
+}
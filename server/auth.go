@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -93,3 +94,97 @@ func getAuthorizationToken(ctx context.Context, challenge registryChallenge) (st
 
 	return token.Token, nil
 }
+
+// authenticate answers the challenge in the WWW-Authenticate header of a 401
+// response from the registry of requestURL by setting what regOpts sends with
+// the next request. Registries that ask for basic auth get the username and
+// password of the request or the credentials stored for the registry. Those
+// that ask for a bearer token get one from the realm of the challenge, which
+// is sent the same credentials if there are any and a request signed with
+// the Ollama key otherwise.
+func authenticate(ctx context.Context, requestURL *url.URL, header string, regOpts *registryOptions) error {
+	creds := auth.Credentials{Username: regOpts.Username, Secret: regOpts.Password}
+	if creds.Username == "" {
+		var err error
+		creds, err = auth.LookupCredentials(ctx, requestURL.Host)
+		if err != nil && !errors.Is(err, auth.ErrNoCredentials) {
+			return err
+		}
+	}
+
+	scheme, _, _ := strings.Cut(header, " ")
+	switch {
+	case strings.EqualFold(scheme, "basic"):
+		if creds.Username == "" {
+			return errUnauthorized
+		}
+
+		regOpts.Username, regOpts.Password = creds.Username, creds.Secret
+		return nil
+	case strings.EqualFold(scheme, "bearer"):
+		challenge := parseRegistryChallenge(header)
+
+		var token string
+		var err error
+		if creds.Username != "" {
+			token, err = getRegistryToken(ctx, challenge, creds)
+		} else {
+			token, err = getAuthorizationToken(ctx, challenge)
+		}
+		if err != nil {
+			return err
+		}
+
+		regOpts.Token = token
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported authentication scheme %q", errUnauthorized, scheme)
+	}
+}
+
+// getRegistryToken gets a token for the scope of challenge from its realm
+// with the basic auth of creds, as registries such as Harbor and Artifactory
+// expect.
+func getRegistryToken(ctx context.Context, challenge registryChallenge, creds auth.Credentials) (string, error) {
+	realmURL, err := url.Parse(challenge.Realm)
+	if err != nil {
+		return "", err
+	}
+
+	values := realmURL.Query()
+	if challenge.Service != "" {
+		values.Add("service", challenge.Service)
+	}
+	for _, s := range strings.Fields(challenge.Scope) {
+		values.Add("scope", s)
+	}
+	realmURL.RawQuery = values.Encode()
+
+	response, err := makeRequest(ctx, http.MethodGet, realmURL, nil, nil, &registryOptions{Username: creds.Username, Password: creds.Secret})
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden {
+		return "", errUnauthorized
+	} else if response.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(response.Body)
+		return "", fmt.Errorf("%d: %s", response.StatusCode, body)
+	}
+
+	// registries return the token as either token or access_token
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	if token.Token != "" {
+		return token.Token, nil
+	}
+
+	return token.AccessToken, nil
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/auth"
+	"github.com/ollama/ollama/llm"
+)
+
+// newAuthRegistry returns a registry that accepts pushes from clients that
+// authenticate with the scheme, either basic or bearer with a token issued
+// for basic auth, and records the manifests pushed to it.
+func newAuthRegistry(t *testing.T, scheme string) (*httptest.Server, map[string]string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	manifests := make(map[string]string)
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("scope") != "repository:team/test:pull,push" {
+				http.Error(w, "bad scope "+r.URL.Query().Get("scope"), http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"token"}`)
+			return
+		}
+
+		switch scheme {
+		case "basic":
+			if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "secret" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		case "bearer":
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:team/test:pull,push"`, srv.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		io.Copy(io.Discard, r.Body)
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/blobs/uploads/"):
+			// a location relative to the request, as distribution returns
+			w.Header().Set("Location", "/v2/team/test/blobs/uploads/1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPatch:
+			w.Header().Set("Location", r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/blobs/uploads/"):
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/"):
+			manifests[r.URL.Path] = r.Header.Get("Content-Type")
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, manifests
+}
+
+func TestPushAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", t.TempDir())
+	// keep credentials in the file rather than a keychain helper
+	t.Setenv("PATH", t.TempDir())
+
+	var s Server
+	_, digest := createBinFile(t, llm.KV{"general.architecture": "llama"}, nil)
+
+	for _, scheme := range []string{"basic", "bearer"} {
+		t.Run(scheme, func(t *testing.T) {
+			srv, manifests := newAuthRegistry(t, scheme)
+			u, err := url.Parse(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			name := u.Host + "/team/test:latest"
+			w := createRequest(t, s.CreateHandler, api.CreateRequest{
+				Model:  name,
+				Files:  map[string]string{"test.gguf": digest},
+				Stream: &stream,
+			})
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", w.Code)
+			}
+
+			push := func() error {
+				return PushModel(context.Background(), name, &registryOptions{Insecure: true}, func(api.ProgressResponse) {})
+			}
+
+			// without credentials, a bearer token is requested with the
+			// Ollama key, which the realm rejects
+			if err := push(); err == nil {
+				t.Fatal("expected push without credentials to fail")
+			} else if scheme == "basic" && !errors.Is(err, errUnauthorized) {
+				t.Fatalf("expected %v, got %v", errUnauthorized, err)
+			}
+
+			if err := auth.StoreCredentials(context.Background(), u.Host, auth.Credentials{Username: "alice", Secret: "secret"}); err != nil {
+				t.Fatal(err)
+			}
+			defer auth.EraseCredentials(context.Background(), u.Host)
+
+			if err := push(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := manifests["/v2/team/test/manifests/latest"]; !ok {
+				t.Errorf("expected manifest to be pushed, got %v", manifests)
+			}
+		})
+	}
+}
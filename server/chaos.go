@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chaosHeader lists the failures to inject into a request when the server
+// runs with OLLAMA_CHAOS, such as "load_delay=5s, slow=200ms, crash=10".
+const chaosHeader = "X-Ollama-Chaos"
+
+// chaos are the failures injected into a request, so that clients can test
+// how they handle them without a misbehaving model or GPU.
+type chaos struct {
+	// loadDelay is added to scheduling the request, as if the model were
+	// being loaded
+	loadDelay time.Duration
+
+	// oom fails to load the model as if it didn't fit in memory
+	oom bool
+
+	// busy rejects the request as if too many were queued
+	busy bool
+
+	// crash ends the response as if the runner crashed after crashAfter
+	// chunks
+	crash      bool
+	crashAfter int
+
+	// slow delays each chunk of the response
+	slow time.Duration
+}
+
+type chaosKey struct{}
+
+func parseChaos(s string) (*chaos, error) {
+	var ch chaos
+	for _, part := range strings.Split(s, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		var err error
+		switch key {
+		case "":
+		case "load_delay":
+			ch.loadDelay, err = time.ParseDuration(value)
+		case "slow":
+			ch.slow, err = time.ParseDuration(value)
+		case "oom":
+			ch.oom = true
+		case "busy":
+			ch.busy = true
+		case "crash":
+			ch.crash = true
+			if value != "" {
+				ch.crashAfter, err = strconv.Atoi(value)
+			}
+		default:
+			return nil, fmt.Errorf("unknown failure %q, expected load_delay, oom, busy, crash or slow", key)
+		}
+
+		if err != nil || ch.loadDelay < 0 || ch.slow < 0 || ch.crashAfter < 0 {
+			return nil, fmt.Errorf("invalid %s %q", key, value)
+		}
+	}
+
+	return &ch, nil
+}
+
+// chaosMiddleware reads the failures to inject into a request from its
+// X-Ollama-Chaos header.
+func chaosMiddleware(c *gin.Context) {
+	s := c.GetHeader(chaosHeader)
+	if s == "" {
+		c.Next()
+		return
+	}
+
+	ch, err := parseChaos(s)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.WarnContext(c.Request.Context(), "injecting failures", "chaos", s)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), chaosKey{}, ch))
+	c.Next()
+}
+
+// injectLoad delays and fails scheduling a runner as requested by the
+// failures of ctx, if any.
+func injectLoad(ctx context.Context) error {
+	ch, _ := ctx.Value(chaosKey{}).(*chaos)
+	if ch == nil {
+		return nil
+	}
+
+	if ch.loadDelay > 0 {
+		select {
+		case <-time.After(ch.loadDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	switch {
+	case ch.busy:
+		return ErrMaxQueue
+	case ch.oom:
+		return errors.New("model requires more system memory (12.0 GiB) than is available (4.0 GiB)")
+	default:
+		return nil
+	}
+}
+
+// injectStream slows or crashes the chunks of the response on ch as
+// requested by the failures of the request of c, returning the channel of
+// the chunks the client gets.
+func injectStream(c *gin.Context, ch chan any) chan any {
+	f, _ := c.Request.Context().Value(chaosKey{}).(*chaos)
+	if f == nil || !f.crash && f.slow == 0 {
+		return ch
+	}
+
+	out := make(chan any)
+	go func() {
+		defer close(out)
+		// let the generation finish rather than block on ch
+		defer func() {
+			go func() {
+				for range ch {
+				}
+			}()
+		}()
+
+		done := c.Request.Context().Done()
+		send := func(v any) bool {
+			select {
+			case out <- v:
+				return true
+			case <-done:
+				return false
+			}
+		}
+
+		var n int
+		for v := range ch {
+			if f.crash && n >= f.crashAfter {
+				send(gin.H{"error": "an error was encountered while running the model: unexpected EOF"})
+				return
+			}
+
+			if f.slow > 0 {
+				select {
+				case <-time.After(f.slow):
+				case <-done:
+					return
+				}
+			}
+
+			if !send(v) {
+				return
+			}
+			n++
+		}
+	}()
+
+	return out
+}
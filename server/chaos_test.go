@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestParseChaos(t *testing.T) {
+	cases := []struct {
+		header string
+		expect *chaos
+	}{
+		{"oom", &chaos{oom: true}},
+		{"busy", &chaos{busy: true}},
+		{"load_delay=2s, slow=100ms", &chaos{loadDelay: 2 * time.Second, slow: 100 * time.Millisecond}},
+		{"crash", &chaos{crash: true}},
+		{"crash=5,", &chaos{crash: true, crashAfter: 5}},
+		{"crash=-1", nil},
+		{"slow", nil},
+		{"load_delay=soon", nil},
+		{"explode", nil},
+	}
+
+	for _, tt := range cases {
+		got, err := parseChaos(tt.header)
+		if tt.expect == nil {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.header)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %v", tt.header, err)
+		} else if diff := cmp.Diff(got, tt.expect, cmp.AllowUnexported(chaos{})); diff != "" {
+			t.Errorf("%q: mismatch (-got +want):\n%s", tt.header, diff)
+		}
+	}
+}
+
+func TestInjectLoad(t *testing.T) {
+	if err := injectLoad(context.Background()); err != nil {
+		t.Errorf("expected no error without failures, got %v", err)
+	}
+
+	ctx := context.WithValue(context.Background(), chaosKey{}, &chaos{busy: true})
+	if err := injectLoad(ctx); !errors.Is(err, ErrMaxQueue) {
+		t.Errorf("expected ErrMaxQueue, got %v", err)
+	}
+
+	ctx = context.WithValue(context.Background(), chaosKey{}, &chaos{oom: true})
+	if err := injectLoad(ctx); err == nil {
+		t.Error("expected an out of memory error")
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), chaosKey{}, &chaos{loadDelay: time.Hour}))
+	cancel()
+	if err := injectLoad(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the delay to be canceled, got %v", err)
+	}
+}
+
+func TestInjectStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	collect := func(f *chaos, n int) []any {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/generate", nil)
+		if f != nil {
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), chaosKey{}, f))
+		}
+
+		ch := make(chan any)
+		go func() {
+			defer close(ch)
+			for range n {
+				ch <- api.GenerateResponse{Response: "a"}
+			}
+		}()
+
+		var got []any
+		for v := range injectStream(c, ch) {
+			got = append(got, v)
+		}
+
+		return got
+	}
+
+	if got := collect(nil, 3); len(got) != 3 {
+		t.Errorf("expected 3 chunks, got %d", len(got))
+	}
+
+	got := collect(&chaos{crash: true, crashAfter: 2}, 5)
+	if diff := cmp.Diff(got, []any{
+		api.GenerateResponse{Response: "a"},
+		api.GenerateResponse{Response: "a"},
+		gin.H{"error": "an error was encountered while running the model: unexpected EOF"},
+	}); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	// a response shorter than crash_after finishes
+	if got := collect(&chaos{crash: true, crashAfter: 10}, 3); len(got) != 3 {
+		t.Errorf("expected 3 chunks, got %d", len(got))
+	}
+
+	start := time.Now()
+	if got := collect(&chaos{slow: 20 * time.Millisecond}, 3); len(got) != 3 {
+		t.Errorf("expected 3 chunks, got %d", len(got))
+	}
+
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("expected the chunks to be slowed, took %s", elapsed)
+	}
+}
+
+func TestInjectStreamRecoverable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	s := Server{recovered: newRecoverStore()}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/generate", nil)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), chaosKey{}, &chaos{crash: true, crashAfter: 1}))
+
+	rec := &api.Recover{ID: "chaos"}
+	_, cancel := s.recoverContext(c, rec)
+
+	// the handlers chain the channels like this, with the producer sending
+	// on its own channel
+	ch := make(chan any)
+	produced := make(chan struct{})
+	go func() {
+		defer close(produced)
+		defer close(ch)
+		for _, word := range []string{"Why", " is", " the", " sky", " blue"} {
+			ch <- api.GenerateResponse{Model: "test", Response: word}
+		}
+
+		ch <- api.GenerateResponse{Model: "test", Done: true, DoneReason: "stop"}
+	}()
+
+	var got []any
+	for v := range injectStream(c, s.recoverable(c, rec, cancel, ch)) {
+		got = append(got, v)
+	}
+
+	if diff := cmp.Diff(got, []any{
+		api.GenerateResponse{Model: "test", Response: "Why"},
+		gin.H{"error": "an error was encountered while running the model: unexpected EOF"},
+	}); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	select {
+	case <-produced:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the producer to finish after the crash")
+	}
+
+	r, ok := s.recovered.get("chaos")
+	if !ok {
+		t.Fatal("expected the response to be kept")
+	}
+	<-r.done
+
+	if r.err != nil || r.resp.Generate == nil || r.resp.Generate.Response != "Why is the sky blue" {
+		t.Errorf("expected the whole response to be kept, got %+v, %v", r.resp.Generate, r.err)
+	}
+}
+
+func TestChaosMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(chaosMiddleware)
+	r.GET("/", func(c *gin.Context) {
+		f, _ := c.Request.Context().Value(chaosKey{}).(*chaos)
+		c.JSON(http.StatusOK, gin.H{"oom": f != nil && f.oom})
+	})
+
+	for header, expect := range map[string]int{"": http.StatusOK, "oom": http.StatusOK, "explode": http.StatusBadRequest} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(chaosHeader, header)
+		r.ServeHTTP(w, req)
+
+		if w.Code != expect {
+			t.Errorf("%q: expected status %d, got %d", header, expect, w.Code)
+		}
+
+		if header == "oom" && !strings.Contains(w.Body.String(), `"oom":true`) {
+			t.Errorf("expected the failures in the context, got %s", w.Body.String())
+		}
+	}
+}
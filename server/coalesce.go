@@ -0,0 +1,169 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+// coalesceHeader is the header of the interval and tokens a streamed
+// response is coalesced with.
+const coalesceHeader = "X-Ollama-Coalesce"
+
+const (
+	defaultCoalesceInterval = 100 * time.Millisecond
+
+	// maxCoalesceInterval and maxCoalesceTokens bound how long tokens are
+	// held back, so that clients still see progress
+	maxCoalesceInterval = time.Second
+	maxCoalesceTokens   = 1024
+)
+
+// coalesceParams returns the interval and tokens of opts as the server uses
+// them, or false if tokens aren't coalesced.
+func coalesceParams(opts *api.Coalesce) (time.Duration, int, bool) {
+	if opts == nil || opts.Interval.Duration <= 0 && opts.Tokens <= 0 {
+		return 0, 0, false
+	}
+
+	interval := opts.Interval.Duration
+	if interval <= 0 {
+		interval = defaultCoalesceInterval
+	}
+
+	tokens := max(opts.Tokens, 0)
+	if tokens == 0 || tokens > maxCoalesceTokens {
+		tokens = maxCoalesceTokens
+	}
+
+	return min(interval, maxCoalesceInterval), tokens, true
+}
+
+// coalescible reports whether v is a chunk with a token that can be held
+// back to be combined with the next ones.
+func coalescible(v any) bool {
+	switch r := v.(type) {
+	case api.GenerateResponse:
+		return !r.Done && r.Load == nil
+	case api.ChatResponse:
+		return !r.Done && r.Load == nil && len(r.Message.ToolCalls) == 0
+	default:
+		return false
+	}
+}
+
+// mergeChunks appends the tokens of chunk b to the held chunk a. The result
+// has the rest of b, such as whether it is done.
+func mergeChunks(a, b any) (any, bool) {
+	switch a := a.(type) {
+	case api.GenerateResponse:
+		b, ok := b.(api.GenerateResponse)
+		if !ok || b.Load != nil {
+			return nil, false
+		}
+
+		b.Response = a.Response + b.Response
+		b.Logprobs = append(a.Logprobs, b.Logprobs...)
+		return b, true
+	case api.ChatResponse:
+		b, ok := b.(api.ChatResponse)
+		if !ok || b.Load != nil || b.Message.Role != a.Message.Role {
+			return nil, false
+		}
+
+		b.Message.Content = a.Message.Content + b.Message.Content
+		b.Logprobs = append(a.Logprobs, b.Logprobs...)
+		return b, true
+	default:
+		return nil, false
+	}
+}
+
+// coalesce combines the generate or chat chunks on ch as configured by
+// opts, returning the channel of the combined chunks. Chunks other than
+// tokens, such as the progress of loading the model, errors and the final
+// chunk, are written right away along with the tokens held back.
+func coalesce(c *gin.Context, opts *api.Coalesce, ch chan any) chan any {
+	interval, tokens, ok := coalesceParams(opts)
+	if !ok {
+		return ch
+	}
+
+	c.Header(coalesceHeader, fmt.Sprintf("interval=%s, tokens=%d", interval, tokens))
+
+	out := make(chan any)
+	go func() {
+		defer close(out)
+
+		done := c.Request.Context().Done()
+		send := func(v any) bool {
+			select {
+			case out <- v:
+				return true
+			case <-done:
+				// let the generation finish rather than block on ch
+				go func() {
+					for range ch {
+					}
+				}()
+				return false
+			}
+		}
+
+		var held any
+		var n int
+		var timeout <-chan time.Time
+		for {
+			select {
+			case v, ok := <-ch:
+				if !ok {
+					if held != nil {
+						send(held)
+					}
+					return
+				}
+
+				if held != nil {
+					if merged, ok := mergeChunks(held, v); ok {
+						held, v = merged, nil
+						n++
+					} else {
+						if !send(held) {
+							return
+						}
+						held = nil
+					}
+				}
+
+				if v != nil {
+					if !coalescible(v) {
+						if !send(v) {
+							return
+						}
+						continue
+					}
+
+					held, n = v, 1
+					timeout = time.After(interval)
+				}
+
+				if n >= tokens || !coalescible(held) {
+					if !send(held) {
+						return
+					}
+					held, timeout = nil, nil
+				}
+			case <-timeout:
+				if !send(held) {
+					return
+				}
+				held, timeout = nil, nil
+			}
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestCoalesceParams(t *testing.T) {
+	cases := []struct {
+		opts     *api.Coalesce
+		interval time.Duration
+		tokens   int
+		ok       bool
+	}{
+		{nil, 0, 0, false},
+		{&api.Coalesce{}, 0, 0, false},
+		{&api.Coalesce{Tokens: 16}, 100 * time.Millisecond, 16, true},
+		{&api.Coalesce{Interval: api.Duration{Duration: 50 * time.Millisecond}}, 50 * time.Millisecond, 1024, true},
+		{&api.Coalesce{Interval: api.Duration{Duration: time.Minute}, Tokens: 1 << 20}, time.Second, 1024, true},
+	}
+
+	for _, tt := range cases {
+		interval, tokens, ok := coalesceParams(tt.opts)
+		if interval != tt.interval || tokens != tt.tokens || ok != tt.ok {
+			t.Errorf("%+v: expected %s, %d, %v, got %s, %d, %v", tt.opts, tt.interval, tt.tokens, tt.ok, interval, tokens, ok)
+		}
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	token := func(s string) api.ChatResponse {
+		return api.ChatResponse{Message: api.Message{Role: "assistant", Content: s}}
+	}
+
+	collect := func(opts *api.Coalesce, values ...any) ([]any, http.Header) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/chat", nil)
+
+		ch := make(chan any)
+		go func() {
+			defer close(ch)
+			for _, v := range values {
+				ch <- v
+			}
+		}()
+
+		var got []any
+		for v := range coalesce(c, opts, ch) {
+			got = append(got, v)
+		}
+
+		return got, w.Header()
+	}
+
+	t.Run("tokens", func(t *testing.T) {
+		load := api.ChatResponse{Load: &api.LoadEvent{Stage: "ready"}}
+		done := api.ChatResponse{Message: api.Message{Role: "assistant", Content: "!"}, Done: true, DoneReason: "stop"}
+
+		got, header := collect(&api.Coalesce{Interval: api.Duration{Duration: time.Minute}, Tokens: 2},
+			load, token("a"), token("b"), token("c"), done)
+
+		if diff := cmp.Diff(got, []any{
+			load,
+			token("ab"),
+			api.ChatResponse{Message: api.Message{Role: "assistant", Content: "c!"}, Done: true, DoneReason: "stop"},
+		}); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+
+		if got := header.Get(coalesceHeader); got != "interval=1s, tokens=2" {
+			t.Errorf("unexpected header %q", got)
+		}
+	})
+
+	t.Run("logprobs", func(t *testing.T) {
+		a := api.GenerateResponse{Response: "a", Logprobs: []api.Logprob{{TokenLogprob: api.TokenLogprob{Token: "a"}}}}
+		b := api.GenerateResponse{Response: "b", Logprobs: []api.Logprob{{TokenLogprob: api.TokenLogprob{Token: "b"}}}}
+
+		got, _ := collect(&api.Coalesce{Tokens: 2}, a, b)
+		if diff := cmp.Diff(got, []any{
+			api.GenerateResponse{Response: "ab", Logprobs: []api.Logprob{{TokenLogprob: api.TokenLogprob{Token: "a"}}, {TokenLogprob: api.TokenLogprob{Token: "b"}}}},
+		}); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		got, _ := collect(&api.Coalesce{Tokens: 8}, token("a"), gin.H{"error": "failed"})
+		if diff := cmp.Diff(got, []any{token("a"), gin.H{"error": "failed"}}); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/chat", nil)
+
+		ch := make(chan any)
+		out := coalesce(c, &api.Coalesce{Interval: api.Duration{Duration: 10 * time.Millisecond}}, ch)
+
+		// a held token is written once the interval passes, even if no
+		// more tokens are generated
+		ch <- token("a")
+		select {
+		case v := <-out:
+			if diff := cmp.Diff(v, any(token("a"))); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the held token to be written")
+		}
+
+		close(ch)
+		if _, ok := <-out; ok {
+			t.Error("expected the channel to be closed")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		got, header := collect(nil, token("a"), token("b"))
+		if diff := cmp.Diff(got, []any{token("a"), token("b")}); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+
+		if header.Get(coalesceHeader) != "" {
+			t.Error("expected no header")
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/llm"
+)
+
+// contextPolicies are the shares of the memory left after loading the
+// weights of a model that OLLAMA_CONTEXT_POLICY lets its KV cache take when
+// num_ctx is not set.
+var contextPolicies = map[string]float64{
+	"conservative": 0.25,
+	"balanced":     0.5,
+	"max":          0.9,
+}
+
+// defaultContextLengths caches the default num_ctx of each model by path,
+// policy and parallelism so it does not change once the model is loaded and
+// the free memory drops, which would make the scheduler reload it. It is
+// computed from the free memory when first needed, and forgotten when the
+// model is unloaded so the next load fits the memory free then.
+var defaultContextLengths sync.Map
+
+type contextLengthKey struct {
+	path, policy string
+	numParallel  int
+}
+
+// forgetContextLengths removes the default num_ctx cached for the model at
+// path.
+func forgetContextLengths(path string) {
+	defaultContextLengths.Range(func(k, _ any) bool {
+		if k.(contextLengthKey).path == path {
+			defaultContextLengths.Delete(k)
+		}
+		return true
+	})
+}
+
+// defaultContextLength returns the num_ctx of m for requests that do not set
+// it under the policy of OLLAMA_CONTEXT_POLICY, or 0 if no policy is set.
+// The scheduler gives each of the numParallel requests it loads the model
+// for a KV cache of num_ctx, so they share the memory of the policy.
+func defaultContextLength(m *Model, numParallel int) (int, error) {
+	policy := envconfig.ContextPolicy()
+	if policy == "" {
+		return 0, nil
+	}
+
+	share, ok := contextPolicies[policy]
+	if !ok {
+		return 0, fmt.Errorf("unknown context policy %q", policy)
+	}
+
+	key := contextLengthKey{path: m.ModelPath, policy: policy, numParallel: numParallel}
+	if n, ok := defaultContextLengths.Load(key); ok {
+		return n.(int), nil
+	}
+
+	fi, err := os.Stat(m.ModelPath)
+	if err != nil {
+		return 0, err
+	}
+
+	ggml, err := llm.LoadModel(m.ModelPath, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	var free uint64
+	for _, gpu := range discover.GetGPUInfo() {
+		free += gpu.FreeMemory
+	}
+
+	n := fitContextLength(ggml, free, uint64(fi.Size()), share, numParallel)
+	slog.Debug("default context length", "model", m.ShortName, "policy", policy, "free", free, "num_parallel", numParallel, "num_ctx", n)
+	defaultContextLengths.Store(key, n)
+	return n, nil
+}
+
+// fitContextLength returns the context length whose KV cache, for each of
+// numParallel requests, fits in share of the free memory left after weights,
+// in multiples of 2048 and between 2048 and the context length the model was
+// trained with.
+func fitContextLength(ggml *llm.GGML, free, weights uint64, share float64, numParallel int) int {
+	const step = 2048
+
+	trained := int(ggml.KV().ContextLength())
+	if trained == 0 {
+		trained = step
+	}
+
+	perToken, _, _ := ggml.GraphSize(1, 1, "")
+	if perToken == 0 || free <= weights {
+		return min(step, trained)
+	}
+
+	n := int(float64(free-weights)*share/float64(perToken)/float64(max(numParallel, 1))) / step * step
+	return min(max(n, step), trained)
+}
+
+// loadParallel returns the most parallel requests the scheduler loads m
+// with for opts, by which it multiplies num_ctx.
+func loadParallel(m *Model, opts api.Options) int {
+	if checkMllamaModelFamily(m) {
+		return 1
+	}
+
+	if opts.NumParallel > 0 {
+		return opts.NumParallel
+	}
+
+	// embedding models are loaded with parallel=1 unless the model sets
+	// num_parallel
+	if m.CheckCapabilities(CapabilityCompletion) != nil {
+		return 1
+	}
+
+	if n := int(envconfig.NumParallel()); n > 0 {
+		return n
+	}
+
+	return defaultParallel
+}
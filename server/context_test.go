@@ -0,0 +1,85 @@
+package server
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func TestFitContextLength(t *testing.T) {
+	p, _ := createBinFile(t, llm.KV{
+		"general.architecture":          "llama",
+		"llama.block_count":             uint32(32),
+		"llama.context_length":          uint32(131072),
+		"llama.embedding_length":        uint32(4096),
+		"llama.attention.head_count":    uint32(32),
+		"llama.attention.head_count_kv": uint32(8),
+		"tokenizer.ggml.tokens":         []string{""},
+	}, nil)
+
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ggml, _, err := llm.DecodeGGML(f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 32 layers * (128 + 128) * 8 heads * 2 bytes
+	const perToken = 128 << 10
+
+	cases := []struct {
+		name          string
+		free, weights uint64
+		share         float64
+		numParallel   int
+		want          int
+	}{
+		{"no memory left", 4 << 30, 5 << 30, 0.5, 1, 2048},
+		{"conservative", 9 << 30, 5 << 30, 0.25, 1, 8192},
+		{"balanced", 9 << 30, 5 << 30, 0.5, 1, 16384},
+		{"shared by parallel requests", 9 << 30, 5 << 30, 0.5, 4, 4096},
+		{"rounded down", 5<<30 + 3000*perToken, 5 << 30, 1, 1, 2048},
+		{"capped at trained length", 80 << 30, 5 << 30, 0.9, 1, 131072},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fitContextLength(ggml, tt.free, tt.weights, tt.share, tt.numParallel); got != tt.want {
+				t.Errorf("fitContextLength = %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultContextLengthPolicy(t *testing.T) {
+	t.Setenv("OLLAMA_CONTEXT_POLICY", "")
+	if n, err := defaultContextLength(&Model{}, 1); err != nil || n != 0 {
+		t.Errorf("defaultContextLength = %d, %v; want 0, nil", n, err)
+	}
+
+	t.Setenv("OLLAMA_CONTEXT_POLICY", "greedy")
+	if _, err := defaultContextLength(&Model{}, 1); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestForgetContextLengths(t *testing.T) {
+	a := contextLengthKey{path: "a", policy: "balanced", numParallel: 1}
+	b := contextLengthKey{path: "b", policy: "balanced", numParallel: 1}
+	defaultContextLengths.Store(a, 4096)
+	defaultContextLengths.Store(b, 8192)
+	t.Cleanup(func() { defaultContextLengths.Delete(b) })
+
+	forgetContextLengths("a")
+	if _, ok := defaultContextLengths.Load(a); ok {
+		t.Error("expected the context length of an unloaded model to be forgotten")
+	}
+	if _, ok := defaultContextLengths.Load(b); !ok {
+		t.Error("expected the context lengths of other models to be kept")
+	}
+}
@@ -0,0 +1,444 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/template"
+	"github.com/ollama/ollama/types/model"
+)
+
+var (
+	errConversationNotFound = errors.New("conversation not found")
+	errMessageNotFound      = errors.New("message not found")
+)
+
+// conversation is a node in a tree of chat histories. A forked conversation
+// holds a reference to its parent and the number of parent messages it
+// inherits, so history is shared rather than copied. Since conversations are
+// append-only, the inherited prefix never changes.
+type conversation struct {
+	id        string
+	parent    *conversation
+	inherited int
+	messages  []api.ConversationMessage
+	createdAt time.Time
+
+	// seed and variant determine the sampling seed of each turn, see
+	// turnSeed
+	seed    int
+	variant int
+
+	title   string
+	summary string
+	// summarized is the number of history messages covered by summary
+	summarized  int
+	summarizing bool
+}
+
+// history returns the full history of the conversation, including messages
+// inherited from ancestors.
+func (c *conversation) history() []api.ConversationMessage {
+	var msgs []api.ConversationMessage
+	if c.parent != nil {
+		msgs = append(msgs, c.parent.history()[:c.inherited]...)
+	}
+
+	return append(msgs, c.messages...)
+}
+
+func (c *conversation) info() api.Conversation {
+	conv := api.Conversation{
+		ID:        c.id,
+		CreatedAt: c.createdAt,
+		Title:     c.title,
+		Summary:   c.summary,
+		Seed:      c.seed,
+		Variant:   c.variant,
+		Messages:  c.history(),
+	}
+
+	if c.parent != nil {
+		conv.Parent = c.parent.id
+		if c.inherited > 0 {
+			conv.ParentMessage = conv.Messages[c.inherited-1].ID
+		}
+	}
+
+	return conv
+}
+
+type conversationStore struct {
+	mu            sync.Mutex
+	conversations map[string]*conversation
+}
+
+func newConversationStore() *conversationStore {
+	return &conversationStore{conversations: make(map[string]*conversation)}
+}
+
+func newConversationMessages(msgs []api.Message) []api.ConversationMessage {
+	cms := make([]api.ConversationMessage, len(msgs))
+	for i, msg := range msgs {
+		cms[i] = api.ConversationMessage{ID: uuid.NewString(), Message: msg}
+	}
+
+	return cms
+}
+
+// create creates a conversation with msgs. A nil seed chooses a random one.
+func (s *conversationStore) create(msgs []api.Message, seed *int) api.Conversation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := &conversation{
+		id:        uuid.NewString(),
+		messages:  newConversationMessages(msgs),
+		createdAt: time.Now().UTC(),
+	}
+
+	if seed != nil {
+		c.seed = *seed
+	} else {
+		c.seed = rand.IntN(math.MaxInt32)
+	}
+
+	s.conversations[c.id] = c
+	return c.info()
+}
+
+func (s *conversationStore) get(id string) (api.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.conversations[id]
+	if !ok {
+		return api.Conversation{}, errConversationNotFound
+	}
+
+	return c.info(), nil
+}
+
+func (s *conversationStore) append(id string, msgs ...api.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.conversations[id]
+	if !ok {
+		return errConversationNotFound
+	}
+
+	c.messages = append(c.messages, newConversationMessages(msgs)...)
+	return nil
+}
+
+// fork creates a new conversation sharing the history of id up to and
+// including messageID. An empty messageID forks the whole history. The fork
+// keeps the seed of its parent and, if regenerate is set, advances to the
+// next variant so that replies sampled from it differ from the parent's.
+func (s *conversationStore) fork(id, messageID string, msgs []api.Message, regenerate bool) (api.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parent, ok := s.conversations[id]
+	if !ok {
+		return api.Conversation{}, errConversationNotFound
+	}
+
+	history := parent.history()
+	inherited := len(history)
+	if messageID != "" {
+		inherited = -1
+		for i, msg := range history {
+			if msg.ID == messageID {
+				inherited = i + 1
+				break
+			}
+		}
+
+		if inherited < 0 {
+			return api.Conversation{}, errMessageNotFound
+		}
+	}
+
+	c := &conversation{
+		id:        uuid.NewString(),
+		parent:    parent,
+		inherited: inherited,
+		messages:  newConversationMessages(msgs),
+		createdAt: time.Now().UTC(),
+		seed:      parent.seed,
+		variant:   parent.variant,
+	}
+
+	if regenerate {
+		c.variant++
+	}
+
+	s.conversations[c.id] = c
+	return c.info(), nil
+}
+
+// turnSeed derives the sampling seed of the reply following n messages of a
+// conversation. The same seed, variant and position always yield the same
+// sampling seed, so a turn regenerated from a fork reproduces the original.
+func turnSeed(conv api.Conversation, n int) int {
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, [3]int64{int64(conv.Seed), int64(conv.Variant), int64(n)})
+	return int(h.Sum64() % math.MaxInt32)
+}
+
+// beginSummary marks a conversation as being summarized and returns the
+// previous summary along with the messages it does not yet cover. It returns
+// ok false if a summary is already in progress.
+func (s *conversationStore) beginSummary(id string) (summary string, msgs []api.Message, n int, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, exists := s.conversations[id]
+	if !exists {
+		return "", nil, 0, false, errConversationNotFound
+	}
+
+	if c.summarizing {
+		return "", nil, 0, false, nil
+	}
+
+	history := c.history()
+	for _, msg := range history[min(c.summarized, len(history)):] {
+		msgs = append(msgs, msg.Message)
+	}
+
+	c.summarizing = true
+	return c.summary, msgs, len(history), true, nil
+}
+
+// endSummary stores a generated title and summary covering the first n
+// messages of the conversation. An empty title keeps the existing one.
+func (s *conversationStore) endSummary(id, title, summary string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.conversations[id]
+	if !ok {
+		return
+	}
+
+	c.summarizing = false
+	if summary == "" {
+		return
+	}
+
+	if title != "" {
+		c.title = title
+	}
+	c.summary = summary
+	c.summarized = n
+}
+
+// delete removes a conversation. Forks of the conversation keep their
+// inherited history.
+func (s *conversationStore) delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.conversations[id]; !ok {
+		return errConversationNotFound
+	}
+
+	delete(s.conversations, id)
+	return nil
+}
+
+const summarizeSystemPrompt = `You write titles and summaries of conversations between a user and an assistant. Reply in exactly this format:
+
+Title: <a title of at most six words>
+Summary: <a summary of the conversation in at most three sentences>`
+
+// parseSummary extracts the title and summary from a model response in the
+// format requested by summarizeSystemPrompt.
+func parseSummary(s string) (title, summary string) {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if v, ok := strings.CutPrefix(line, "Title:"); ok {
+			title = strings.Trim(strings.TrimSpace(v), `"*`)
+		} else if v, ok := strings.CutPrefix(line, "Summary:"); ok {
+			summary = strings.TrimSpace(v)
+		} else if summary != "" && line != "" {
+			summary += " " + line
+		}
+	}
+
+	return title, summary
+}
+
+// summarizeConversation generates a title and rolling summary for a
+// conversation. Only messages not covered by the previous summary are sent to
+// the model, along with the previous summary itself.
+func (s *Server) summarizeConversation(ctx context.Context, id, name string) error {
+	previous, msgs, n, ok, err := s.conversations.beginSummary(id)
+	if err != nil || !ok {
+		return err
+	}
+
+	var title, summary string
+	defer func() { s.conversations.endSummary(id, title, summary, n) }()
+
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r, m, opts, err := s.scheduleRunner(ctx, name, []Capability{CapabilityCompletion}, "", nil, nil)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	if previous != "" {
+		fmt.Fprintf(&sb, "Summary of the conversation so far: %s\n\n", previous)
+	}
+
+	for _, msg := range msgs {
+		fmt.Fprintf(&sb, "%s: %s\n", msg.Role, msg.Content)
+	}
+
+	prompt, _, err := chatPrompt(ctx, m, r.Tokenize, opts, []api.Message{
+		{Role: "system", Content: summarizeSystemPrompt},
+		{Role: "user", Content: sb.String()},
+	}, nil, template.NewMetadata(m.ShortName, nil))
+	if err != nil {
+		return err
+	}
+
+	var content strings.Builder
+	if err := r.Completion(ctx, llm.CompletionRequest{
+		Prompt:  prompt,
+		Options: opts,
+	}, func(cr llm.CompletionResponse) {
+		content.WriteString(cr.Content)
+	}); err != nil {
+		return err
+	}
+
+	title, summary = parseSummary(content.String())
+	return nil
+}
+
+func (s *Server) CreateConversationHandler(c *gin.Context) {
+	var req api.ConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, s.conversations.create(req.Messages, req.Seed))
+}
+
+func (s *Server) GetConversationHandler(c *gin.Context) {
+	conv, err := s.conversations.get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("conversation '%s' not found", c.Param("id"))})
+		return
+	}
+
+	c.JSON(http.StatusOK, conv)
+}
+
+func (s *Server) DeleteConversationHandler(c *gin.Context) {
+	if err := s.conversations.delete(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("conversation '%s' not found", c.Param("id"))})
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func (s *Server) SummarizeConversationHandler(c *gin.Context) {
+	var req api.SummarizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Model = cmp.Or(req.Model, envconfig.SummaryModel())
+	if req.Model == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required, or set OLLAMA_SUMMARY_MODEL"})
+		return
+	}
+
+	name := model.ParseName(req.Model)
+	if !name.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+
+	name, err := resolveName(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+
+	if err := s.acl.check(c.Request.Context(), aclRun, name); err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	conv, err := s.conversations.get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("conversation '%s' not found", id)})
+		return
+	}
+
+	// summaries are generated in the background so clients are not blocked
+	// on them; the result is visible on the conversation once complete. The
+	// caller was allowed to run the model above.
+	go func() {
+		if err := s.summarizeConversation(systemContext(context.Background()), id, name.String()); err != nil {
+			slog.Warn("failed to summarize conversation", "conversation", id, "error", err)
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, conv)
+}
+
+func (s *Server) ForkConversationHandler(c *gin.Context) {
+	var req api.ForkRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conv, err := s.conversations.fork(c.Param("id"), req.MessageID, req.Messages, req.Regenerate)
+	switch {
+	case errors.Is(err, errConversationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("conversation '%s' not found", c.Param("id"))})
+	case errors.Is(err, errMessageNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("message '%s' not found in conversation", req.MessageID)})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, conv)
+	}
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func contents(conv api.Conversation) []string {
+	var s []string
+	for _, msg := range conv.Messages {
+		s = append(s, msg.Message.Content)
+	}
+	return s
+}
+
+func TestConversationFork(t *testing.T) {
+	s := newConversationStore()
+
+	root := s.create([]api.Message{
+		{Role: "user", Content: "a"},
+		{Role: "assistant", Content: "b"},
+		{Role: "user", Content: "c"},
+	}, nil)
+
+	fork, err := s.fork(root.ID, root.Messages[1].ID, []api.Message{{Role: "user", Content: "d"}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fork.Parent != root.ID || fork.ParentMessage != root.Messages[1].ID {
+		t.Errorf("unexpected parent %q %q", fork.Parent, fork.ParentMessage)
+	}
+
+	if diff := cmp.Diff(contents(fork), []string{"a", "b", "d"}); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	// the fork shares message ids with its parent
+	if fork.Messages[0].ID != root.Messages[0].ID {
+		t.Errorf("expected shared message id")
+	}
+
+	// appending to the parent must not affect the fork
+	if err := s.append(root.ID, api.Message{Role: "assistant", Content: "e"}); err != nil {
+		t.Fatal(err)
+	}
+
+	fork, err = s.get(fork.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(contents(fork), []string{"a", "b", "d"}); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	// forks survive deletion of their parent
+	if err := s.delete(root.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	nested, err := s.fork(fork.ID, "", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(contents(nested), []string{"a", "b", "d"}); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	if _, err := s.fork(fork.ID, "missing", nil, false); err != errMessageNotFound {
+		t.Errorf("expected errMessageNotFound, got %v", err)
+	}
+
+	if _, err := s.get(root.ID); err != errConversationNotFound {
+		t.Errorf("expected errConversationNotFound, got %v", err)
+	}
+}
+
+func TestForkConversationHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	s := Server{conversations: newConversationStore()}
+	root := s.conversations.create([]api.Message{{Role: "user", Content: "a"}}, nil)
+
+	t.Run("not found", func(t *testing.T) {
+		w := createRequest(t, s.ForkConversationHandler, api.ForkRequest{})
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("fork", func(t *testing.T) {
+		w := createRequest(t, func(c *gin.Context) {
+			c.Params = gin.Params{{Key: "id", Value: root.ID}}
+			s.ForkConversationHandler(c)
+		}, api.ForkRequest{MessageID: root.Messages[0].ID, Messages: []api.Message{{Role: "assistant", Content: "b"}}})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		var conv api.Conversation
+		if err := json.NewDecoder(w.Body).Decode(&conv); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(contents(conv), []string{"a", "b"}); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+}
+
+func TestConversationSeed(t *testing.T) {
+	s := newConversationStore()
+
+	seed := 42
+	root := s.create([]api.Message{{Role: "user", Content: "a"}}, &seed)
+	if root.Seed != seed {
+		t.Errorf("expected seed %d, got %d", seed, root.Seed)
+	}
+
+	// a fork regenerating the same turn samples with the same seed
+	same, err := s.fork(root.ID, "", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if turnSeed(same, 1) != turnSeed(root, 1) {
+		t.Errorf("expected the same seed for the same turn")
+	}
+
+	// regenerating differently advances the variant deterministically
+	other, err := s.fork(root.ID, "", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other.Seed != seed || other.Variant != 1 {
+		t.Errorf("expected seed %d variant 1, got seed %d variant %d", seed, other.Seed, other.Variant)
+	}
+
+	if turnSeed(other, 1) == turnSeed(root, 1) {
+		t.Errorf("expected a different seed for a regenerated turn")
+	}
+
+	again, err := s.fork(root.ID, "", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if turnSeed(again, 1) != turnSeed(other, 1) {
+		t.Errorf("expected regenerating differently to be reproducible")
+	}
+
+	// turns of the same conversation are sampled differently
+	if turnSeed(root, 1) == turnSeed(root, 3) {
+		t.Errorf("expected different seeds for different turns")
+	}
+
+	for _, conv := range []api.Conversation{root, other} {
+		for n := range 8 {
+			if seed := turnSeed(conv, n); seed < 0 {
+				t.Errorf("expected a non-negative seed, got %d", seed)
+			}
+		}
+	}
+}
+
+func TestParseSummary(t *testing.T) {
+	cases := []struct {
+		input   string
+		title   string
+		summary string
+	}{
+		{"Title: Sky Color\nSummary: The user asked why the sky is blue.", "Sky Color", "The user asked why the sky is blue."},
+		{"Title: \"**Rayleigh**\"\n\nSummary: First line.\nSecond line.", "Rayleigh", "First line. Second line."},
+		{"no format at all", "", ""},
+	}
+
+	for _, tt := range cases {
+		title, summary := parseSummary(tt.input)
+		if title != tt.title || summary != tt.summary {
+			t.Errorf("parseSummary(%q) = %q, %q; want %q, %q", tt.input, title, summary, tt.title, tt.summary)
+		}
+	}
+}
+
+func TestConversationRollingSummary(t *testing.T) {
+	s := newConversationStore()
+	conv := s.create([]api.Message{{Role: "user", Content: "a"}, {Role: "assistant", Content: "b"}}, nil)
+
+	previous, msgs, n, ok, err := s.beginSummary(conv.ID)
+	if err != nil || !ok {
+		t.Fatalf("expected summary to begin, got %v %v", ok, err)
+	}
+
+	if previous != "" || len(msgs) != 2 || n != 2 {
+		t.Errorf("unexpected summary input %q %v %d", previous, msgs, n)
+	}
+
+	// concurrent summaries are skipped
+	if _, _, _, ok, _ := s.beginSummary(conv.ID); ok {
+		t.Error("expected concurrent summary to be skipped")
+	}
+
+	s.endSummary(conv.ID, "Title", "Summary", n)
+	if err := s.append(conv.ID, api.Message{Role: "user", Content: "c"}); err != nil {
+		t.Fatal(err)
+	}
+
+	previous, msgs, n, ok, err = s.beginSummary(conv.ID)
+	if err != nil || !ok {
+		t.Fatalf("expected summary to begin, got %v %v", ok, err)
+	}
+
+	if previous != "Summary" || len(msgs) != 1 || msgs[0].Content != "c" || n != 3 {
+		t.Errorf("unexpected summary input %q %v %d", previous, msgs, n)
+	}
+
+	// an empty summary keeps the previous title and summary
+	s.endSummary(conv.ID, "", "", n)
+	conv, err = s.get(conv.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conv.Title != "Title" || conv.Summary != "Summary" {
+		t.Errorf("unexpected title and summary %q %q", conv.Title, conv.Summary)
+	}
+}
@@ -34,6 +34,7 @@ var (
 	errOnlyGGUFSupported       = errors.New("supplied file was not in GGUF format")
 	errUnknownType             = errors.New("unknown type")
 	errNeitherFromOrFiles      = errors.New("neither 'from' or 'files' was specified")
+	errOnlyOneTokenizer        = errors.New("only one tokenizer is supported")
 )
 
 func (s *Server) CreateHandler(c *gin.Context) {
@@ -46,21 +47,34 @@ func (s *Server) CreateHandler(c *gin.Context) {
 		return
 	}
 
-	name := model.ParseName(cmp.Or(r.Model, r.Name))
-	if !name.IsValid() {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errtypes.InvalidModelNameErrMsg})
+	name, err := model.ParseNameStrict(cmp.Or(r.Model, r.Name))
+	if err == nil && name.HasDigest() {
+		err = errNameDigest
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %v", errtypes.InvalidModelNameErrMsg, err)})
 		return
 	}
 
-	name, err := getExistingName(name)
+	name, err = getExistingName(name)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	ch := make(chan any)
-	go func() {
-		defer close(ch)
+	if err := s.acl.checkReplace(c.Request.Context(), name); err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if from := model.ParseName(r.From); r.From != "" && from.IsValid() {
+		if err := s.acl.checkSource(c.Request.Context(), from); err != nil {
+			c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ch, ok := s.startOperation(c, r, func(ctx context.Context, ch chan<- any) {
 		fn := func(resp api.ProgressResponse) {
 			ch <- resp
 		}
@@ -68,7 +82,13 @@ func (s *Server) CreateHandler(c *gin.Context) {
 		oldManifest, _ := ParseNamedManifest(name)
 
 		var baseLayers []*layerGGML
-		if r.From != "" {
+		if r.Router != nil {
+			slog.Debug("create router model")
+			if err := validateRouter(r.Router); err != nil {
+				ch <- gin.H{"error": err.Error(), "status": http.StatusBadRequest}
+				return
+			}
+		} else if r.From != "" {
 			slog.Debug("create model from model name")
 			fromName := model.ParseName(r.From)
 			if !fromName.IsValid() {
@@ -76,7 +96,7 @@ func (s *Server) CreateHandler(c *gin.Context) {
 				return
 			}
 
-			ctx, cancel := context.WithCancel(c.Request.Context())
+			ctx, cancel := context.WithCancel(ctx)
 			defer cancel()
 
 			baseLayers, err = parseFromModel(ctx, fromName, fn)
@@ -120,7 +140,7 @@ func (s *Server) CreateHandler(c *gin.Context) {
 		}
 
 		if err := createModel(r, name, baseLayers, fn); err != nil {
-			if errors.Is(err, errBadTemplate) {
+			if errors.Is(err, errBadTemplate) || errors.Is(err, errOnlyOneTokenizer) {
 				ch <- gin.H{"error": err.Error(), "status": http.StatusBadRequest}
 				return
 			}
@@ -135,7 +155,10 @@ func (s *Server) CreateHandler(c *gin.Context) {
 		}
 
 		ch <- api.ProgressResponse{Status: "success"}
-	}()
+	})
+	if !ok {
+		return
+	}
 
 	if r.Stream != nil && !*r.Stream {
 		waitForStream(c, ch)
@@ -345,16 +368,33 @@ func createModel(r api.CreateRequest, name model.Name, baseLayers []*layerGGML,
 		}
 	}
 
+	if len(r.Tokenizer) > 0 {
+		layers, err = setTokenizer(layers, r.Tokenizer)
+		if err != nil {
+			return err
+		}
+	}
+
 	layers, err = setParameters(layers, r.Parameters)
 	if err != nil {
 		return err
 	}
 
+	layers, err = setProfiles(layers, r.Profiles)
+	if err != nil {
+		return err
+	}
+
 	layers, err = setMessages(layers, r.Messages)
 	if err != nil {
 		return err
 	}
 
+	layers, err = setRouter(layers, r.Router)
+	if err != nil {
+		return err
+	}
+
 	configLayer, err := createConfigLayer(layers, config)
 	if err != nil {
 		return err
@@ -545,6 +585,25 @@ func setLicense(layers []Layer, l string) ([]Layer, error) {
 	return layers, nil
 }
 
+// setTokenizer replaces the tokenizer of the model with the uploaded
+// tokenizer definition in files.
+func setTokenizer(layers []Layer, files map[string]string) ([]Layer, error) {
+	if len(files) != 1 {
+		return nil, errOnlyOneTokenizer
+	}
+
+	for name, digest := range files {
+		layer, err := NewLayerFromLayer(digest, "application/vnd.ollama.image.tokenizer", name)
+		if err != nil {
+			return nil, err
+		}
+
+		layers = append(removeLayer(layers, layer.MediaType), layer)
+	}
+
+	return layers, nil
+}
+
 func setParameters(layers []Layer, p map[string]any) ([]Layer, error) {
 	if p == nil {
 		p = make(map[string]any)
@@ -596,6 +655,75 @@ func setParameters(layers []Layer, p map[string]any) ([]Layer, error) {
 	return layers, nil
 }
 
+// setProfiles adds the parameter profiles in p to those of the base model. A
+// profile in p replaces a base profile of the same name.
+func setProfiles(layers []Layer, p map[string]map[string]any) ([]Layer, error) {
+	if len(p) == 0 {
+		return layers, nil
+	}
+
+	for _, layer := range layers {
+		if layer.MediaType != "application/vnd.ollama.image.profiles" {
+			continue
+		}
+
+		digestPath, err := GetBlobsPath(layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		fn, err := os.Open(digestPath)
+		if err != nil {
+			return nil, err
+		}
+		defer fn.Close()
+
+		var existing map[string]map[string]any
+		if err := json.NewDecoder(fn).Decode(&existing); err != nil {
+			return nil, err
+		}
+
+		for k, v := range existing {
+			if _, exists := p[k]; exists {
+				continue
+			}
+			p[k] = v
+		}
+	}
+
+	layers = removeLayer(layers, "application/vnd.ollama.image.profiles")
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(p); err != nil {
+		return nil, err
+	}
+	layer, err := NewLayer(&b, "application/vnd.ollama.image.profiles")
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, layer)
+	return layers, nil
+}
+
+func setRouter(layers []Layer, rt *api.Router) ([]Layer, error) {
+	if rt == nil {
+		return layers, nil
+	}
+
+	layers = removeLayer(layers, "application/vnd.ollama.image.router")
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(rt); err != nil {
+		return nil, err
+	}
+	layer, err := NewLayer(&b, "application/vnd.ollama.image.router")
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, layer)
+	return layers, nil
+}
+
 func setMessages(layers []Layer, m []api.Message) ([]Layer, error) {
 	// this leaves the old messages intact if no new messages were specified
 	// which may not be the correct behaviour
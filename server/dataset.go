@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+// datasetRecord is a chat exchange mirrored to the dataset of a model. Its
+// messages are in the format chat fine-tuning datasets use, one exchange per
+// line, with the rest of the fields kept as metadata.
+type datasetRecord struct {
+	Messages  []api.Message `json:"messages"`
+	Model     string        `json:"model"`
+	CreatedAt time.Time     `json:"created_at"`
+	Consent   api.Consent   `json:"consent"`
+}
+
+// datasetMu serializes appends so concurrent exchanges are not interleaved.
+var datasetMu sync.Mutex
+
+// datasetPath returns the path of the dataset of the model n, under
+// OLLAMA_DATASETS.
+func datasetPath(n model.Name) string {
+	return filepath.Join(envconfig.Datasets(), n.Filepath()+".jsonl")
+}
+
+// appendDataset appends an exchange with the model n to its dataset. Images
+// are dropped as they would make up most of the file.
+func appendDataset(n model.Name, msgs []api.Message, consent api.Consent) error {
+	rec := datasetRecord{
+		Model:     n.DisplayShortest(),
+		CreatedAt: time.Now().UTC(),
+		Consent:   consent,
+	}
+
+	for _, msg := range msgs {
+		msg.Images = nil
+		rec.Messages = append(rec.Messages, msg)
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	datasetMu.Lock()
+	defer datasetMu.Unlock()
+
+	path := datasetPath(n)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/format"
+)
+
+// defragEntry is a runner unloaded by defrag to be loaded again.
+type defragEntry struct {
+	model     *Model
+	opts      api.Options
+	keepAlive time.Duration
+	vram      uint64
+	unloaded  chan struct{}
+}
+
+// defrag unloads the idle runners with memory on GPUs and loads them again,
+// largest first, so that the free memory left between allocations by many
+// loads and unloads of different sizes is compacted into one region.
+// Runners that are serving requests or still loading are left as is.
+func (s *Scheduler) defrag(ctx context.Context) ([]api.DefragModel, error) {
+	s.defragMu.Lock()
+	defer s.defragMu.Unlock()
+
+	models := []api.DefragModel{}
+	var entries []defragEntry
+
+	s.loadedMu.Lock()
+	for _, runner := range s.loaded {
+		runner.refMu.Lock()
+		switch {
+		case runner.llama == nil, runner.unloaded == nil, len(runner.gpus) == 0, runner.gpus[0].Library == "cpu":
+			// nothing to compact
+		case runner.loading, runner.refCount > 0:
+			models = append(models, api.DefragModel{Model: runner.model.ShortName, Status: "busy", SizeVRAM: int64(runner.estimatedVRAM)})
+		case runner.sessionDuration > 0 && time.Until(runner.expiresAt) <= 0:
+			// about to expire anyway
+		default:
+			opts := *runner.Options
+			opts.NumCtx /= max(runner.numParallel, 1)
+
+			keepAlive := runner.sessionDuration
+			if keepAlive > 0 {
+				keepAlive = time.Until(runner.expiresAt)
+			}
+
+			entries = append(entries, defragEntry{
+				model:     runner.model,
+				opts:      opts,
+				keepAlive: keepAlive,
+				vram:      runner.estimatedVRAM,
+				unloaded:  runner.unloaded,
+			})
+
+			slog.Debug("unloading runner to defragment VRAM", "modelPath", runner.modelPath)
+			if runner.expireTimer != nil {
+				runner.expireTimer.Stop()
+				runner.expireTimer = nil
+			}
+			runner.sessionDuration = 0
+			s.expiredCh <- runner
+		}
+		runner.refMu.Unlock()
+	}
+	s.loadedMu.Unlock()
+
+	for _, e := range entries {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-e.unloaded:
+		}
+	}
+
+	slices.SortStableFunc(entries, func(a, b defragEntry) int {
+		return cmp.Compare(b.vram, a.vram)
+	})
+
+	for _, e := range entries {
+		m := api.DefragModel{Model: e.model.ShortName}
+
+		reqCtx, cancel := context.WithCancel(ctx)
+		successCh, errCh := s.GetRunner(reqCtx, e.model, e.opts, &api.Duration{Duration: e.keepAlive})
+		select {
+		case <-ctx.Done():
+			cancel()
+			return nil, ctx.Err()
+		case runner := <-successCh:
+			m.Status = "reloaded"
+			m.SizeVRAM = int64(runner.estimatedVRAM)
+		case err := <-errCh:
+			m.Status = "failed"
+			m.Error = err.Error()
+		}
+
+		// release the runner so it expires after its keep alive
+		cancel()
+		models = append(models, m)
+	}
+
+	return models, nil
+}
+
+// fragmented reports whether load failures of a runner needing required
+// bytes on gpus could be due to fragmented VRAM: other runners share the
+// GPUs and there is enough free memory in total.
+func (s *Scheduler) fragmented(gpus discover.GpuInfoList, required uint64) bool {
+	same := func(a, b discover.GpuInfo) bool {
+		return a.Library == b.Library && a.ID == b.ID
+	}
+
+	var shared bool
+	s.loadedMu.Lock()
+	for _, runner := range s.loaded {
+		runner.refMu.Lock()
+		for _, g := range runner.gpus {
+			if slices.ContainsFunc(gpus, func(o discover.GpuInfo) bool { return same(g, o) }) {
+				shared = true
+			}
+		}
+		runner.refMu.Unlock()
+	}
+	s.loadedMu.Unlock()
+
+	if !shared {
+		return false
+	}
+
+	var free uint64
+	for _, g := range s.getGpuFn() {
+		if slices.ContainsFunc(gpus, func(o discover.GpuInfo) bool { return same(g, o) }) {
+			free += g.FreeMemory
+		}
+	}
+
+	slog.Debug("checking for fragmented VRAM", "free", format.HumanBytes2(free), "required", format.HumanBytes2(required))
+	return free >= required
+}
+
+// retryAfterDefrag retries the load of req, which failed with err on gpus,
+// after compacting VRAM if the failure may be due to fragmentation.
+// Otherwise err is returned to the requester.
+func (s *Scheduler) retryAfterDefrag(req *LlmRequest, unloaded chan struct{}, gpus discover.GpuInfoList, required uint64, err error) {
+	// the failed runner must be gone before free memory is measured
+	select {
+	case <-req.ctx.Done():
+		req.errCh <- err
+		return
+	case <-unloaded:
+	}
+
+	if !s.fragmented(gpus, required) {
+		req.errCh <- err
+		return
+	}
+
+	slog.Info("model failed to allocate memory despite enough free VRAM, compacting loaded models", "model", req.model.ModelPath)
+	if _, err := s.defrag(req.ctx); err != nil {
+		req.errCh <- err
+		return
+	}
+
+	s.pendingReqCh <- req
+}
+
+// isAllocationError reports whether err is a failure to allocate device
+// memory while loading a runner.
+func isAllocationError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"out of memory", "failed to allocate", "cudamalloc failed", "outofdevicememory"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
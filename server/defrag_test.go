@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/llm"
+)
+
+// loadScenarios loads the models of requests in order and releases them, so
+// that they are idle and expire after their session duration.
+func loadScenarios(t *testing.T, ctx context.Context, s *Scheduler, requests ...*reqBundle) {
+	t.Helper()
+
+	for _, r := range requests {
+		s.pendingReqCh <- r.req
+		select {
+		case resp := <-r.req.successCh:
+			require.Equal(t, r.srv, resp.llama)
+		case err := <-r.req.errCh:
+			t.Fatal(err)
+		case <-ctx.Done():
+			t.Fatal("timeout")
+		}
+	}
+
+	for _, r := range requests {
+		r.ctxDone()
+	}
+
+	// wait for the finished events to be processed
+	require.Eventually(t, func() bool {
+		s.loadedMu.Lock()
+		defer s.loadedMu.Unlock()
+		for _, runner := range s.loaded {
+			runner.refMu.Lock()
+			rc := runner.refCount
+			runner.refMu.Unlock()
+			if rc > 0 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond)
+}
+
+func TestDefrag(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+
+	s := InitScheduler(ctx)
+	s.getGpuFn = getGpuFn
+	s.getCpuFn = getCpuFn
+
+	keepAlive := &api.Duration{Duration: time.Minute}
+	a := newScenarioRequest(t, ctx, "ollama-model-defrag-a", 1*format.GigaByte, keepAlive)
+	b := newScenarioRequest(t, ctx, "ollama-model-defrag-b", 4*format.GigaByte, keepAlive)
+
+	var mu sync.Mutex
+	var loads []string
+	scenarios := map[string]*reqBundle{a.req.model.ModelPath: a, b.req.model.ModelPath: b}
+	s.newServerFn = func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, tokenizer string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		loads = append(loads, scenarios[model].req.model.Name)
+		return scenarios[model].srv, nil
+	}
+
+	s.Run(ctx)
+	loadScenarios(t, ctx, s, a, b)
+
+	models, err := s.defrag(ctx)
+	require.NoError(t, err)
+
+	// the largest model is loaded again first
+	require.Equal(t, []api.DefragModel{
+		{Model: b.req.model.ShortName, Status: "reloaded", SizeVRAM: int64(4 * format.GigaByte)},
+		{Model: a.req.model.ShortName, Status: "reloaded", SizeVRAM: int64(1 * format.GigaByte)},
+	}, models)
+
+	mu.Lock()
+	require.Equal(t, []string{"ollama-model-defrag-a", "ollama-model-defrag-b", "ollama-model-defrag-b", "ollama-model-defrag-a"}, loads)
+	mu.Unlock()
+
+	s.loadedMu.Lock()
+	require.Len(t, s.loaded, 2)
+	for _, runner := range s.loaded {
+		runner.refMu.Lock()
+		// the remaining keep alive is kept
+		require.InDelta(t, time.Minute, runner.sessionDuration, float64(5*time.Second))
+		runner.refMu.Unlock()
+	}
+	s.loadedMu.Unlock()
+}
+
+func TestDefragBusy(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+
+	s := InitScheduler(ctx)
+	s.getGpuFn = getGpuFn
+	s.getCpuFn = getCpuFn
+
+	a := newScenarioRequest(t, ctx, "ollama-model-defrag-busy", 1*format.GigaByte, &api.Duration{Duration: time.Minute})
+	s.newServerFn = a.newServer
+	s.Run(ctx)
+
+	s.pendingReqCh <- a.req
+	select {
+	case <-a.req.successCh:
+	case err := <-a.req.errCh:
+		t.Fatal(err)
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+
+	// the request has not finished so the runner is in use
+	models, err := s.defrag(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []api.DefragModel{{Model: a.req.model.ShortName, Status: "busy", SizeVRAM: int64(1 * format.GigaByte)}}, models)
+	require.False(t, a.srv.closeCalled)
+}
+
+func TestLoadRetryAfterDefrag(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+
+	s := InitScheduler(ctx)
+	s.getGpuFn = getGpuFn
+	s.getCpuFn = getCpuFn
+
+	a := newScenarioRequest(t, ctx, "ollama-model-defrag-loaded", 1*format.GigaByte, &api.Duration{Duration: time.Minute})
+	b := newScenarioRequest(t, ctx, "ollama-model-defrag-failed", 2*format.GigaByte, nil)
+	failed := &mockLlm{
+		waitResp:           errors.New("llama runner process has terminated: cudaMalloc failed: out of memory"),
+		estimatedVRAM:      2 * format.GigaByte,
+		estimatedVRAMByGPU: map[string]uint64{"": 2 * format.GigaByte},
+	}
+
+	var attempts int
+	s.newServerFn = func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, tokenizer string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+		switch model {
+		case a.req.model.ModelPath:
+			return a.srv, nil
+		default:
+			attempts++
+			if attempts == 1 {
+				return failed, nil
+			}
+			return b.srv, nil
+		}
+	}
+
+	s.Run(ctx)
+	loadScenarios(t, ctx, s, a)
+
+	s.pendingReqCh <- b.req
+	select {
+	case resp := <-b.req.successCh:
+		require.Equal(t, b.srv, resp.llama)
+	case err := <-b.req.errCh:
+		t.Fatal(err)
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+
+	require.Equal(t, 2, attempts)
+	require.True(t, a.srv.closeCalled, "expected the loaded model to be unloaded to compact VRAM")
+
+	s.loadedMu.Lock()
+	require.Len(t, s.loaded, 2)
+	s.loadedMu.Unlock()
+}
+
+func TestIsAllocationError(t *testing.T) {
+	cases := []struct {
+		err  string
+		want bool
+	}{
+		{"llama runner process has terminated: cudaMalloc failed: out of memory", true},
+		{"llama runner process no longer running: 1 error:failed to allocate CUDA0 buffer", true},
+		{"llama runner process has terminated: error loading model: unknown model architecture", false},
+		{"timed out waiting for llama runner to start", false},
+	}
+
+	for _, tt := range cases {
+		if got := isAllocationError(errors.New(tt.err)); got != tt.want {
+			t.Errorf("isAllocationError(%q) = %v; want %v", tt.err, got, tt.want)
+		}
+	}
+}
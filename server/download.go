@@ -2,9 +2,12 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log/slog"
 	"math"
@@ -23,6 +26,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 )
 
@@ -31,6 +35,7 @@ const maxRetries = 6
 var (
 	errMaxRetriesExceeded = errors.New("max retries exceeded")
 	errPartStalled        = errors.New("part stalled")
+	errInsufficientSpace  = errors.New("insufficient disk space")
 )
 
 var blobDownloadManager sync.Map
@@ -57,6 +62,14 @@ type blobDownloadPart struct {
 	Size      int64
 	Completed atomic.Int64
 
+	// Checksum is the sha256 of the completed bytes of the part as of the
+	// last time it was written, to verify them when the download resumes
+	Checksum string
+
+	// hash is the sha256 of the completed bytes of the part, or nil if it
+	// must be recomputed from the file before downloading more of it
+	hash hash.Hash
+
 	lastUpdatedMu sync.Mutex
 	lastUpdated   time.Time
 
@@ -68,14 +81,21 @@ type jsonBlobDownloadPart struct {
 	Offset    int64
 	Size      int64
 	Completed int64
+	Checksum  string `json:",omitempty"`
 }
 
 func (p *blobDownloadPart) MarshalJSON() ([]byte, error) {
+	checksum := p.Checksum
+	if p.hash != nil {
+		checksum = hex.EncodeToString(p.hash.Sum(nil))
+	}
+
 	return json.Marshal(jsonBlobDownloadPart{
 		N:         p.N,
 		Offset:    p.Offset,
 		Size:      p.Size,
 		Completed: p.Completed.Load(),
+		Checksum:  checksum,
 	})
 }
 
@@ -85,20 +105,27 @@ func (p *blobDownloadPart) UnmarshalJSON(b []byte) error {
 		return err
 	}
 	*p = blobDownloadPart{
-		N:      j.N,
-		Offset: j.Offset,
-		Size:   j.Size,
+		N:        j.N,
+		Offset:   j.Offset,
+		Size:     j.Size,
+		Checksum: j.Checksum,
 	}
 	p.Completed.Store(j.Completed)
 	return nil
 }
 
 const (
-	numDownloadParts          = 16
 	minDownloadPartSize int64 = 100 * format.MegaByte
 	maxDownloadPartSize int64 = 1000 * format.MegaByte
 )
 
+// numDownloadParts returns the number of parts of a blob to download at the
+// same time, which is also the number of parts a blob is split into unless
+// that would make them smaller or larger than the part size limits.
+func numDownloadParts() int {
+	return max(int(envconfig.MaxDownloadParts()), 1)
+}
+
 func (p *blobDownloadPart) Name() string {
 	return strings.Join([]string{
 		p.blobDownload.Name, "partial", strconv.Itoa(p.N),
@@ -150,7 +177,7 @@ func (b *blobDownload) Prepare(ctx context.Context, requestURL *url.URL, opts *r
 
 		b.Total, _ = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
 
-		size := b.Total / numDownloadParts
+		size := b.Total / int64(numDownloadParts())
 		switch {
 		case size < minDownloadPartSize:
 			size = minDownloadPartSize
@@ -216,15 +243,21 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 		return err
 	}
 	defer file.Close()
-	setSparse(file)
 
-	_ = file.Truncate(b.Total)
+	if err := b.allocate(file); err != nil {
+		return err
+	}
+
+	if err := b.verifyParts(file); err != nil {
+		return err
+	}
 
 	directURL, err := func() (*url.URL, error) {
 		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 		defer cancel()
 
 		backoff := newBackoff(10 * time.Second)
+		probe := true
 		for {
 			// shallow clone opts to be used in the closure
 			// without affecting the outer opts.
@@ -247,8 +280,20 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 				return http.ErrUseLastResponse
 			}
 
-			resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, nil, nil, newOpts)
-			if err != nil {
+			// request a single byte so registries that serve blobs directly
+			// rather than redirecting don't send the whole blob
+			headers := make(http.Header)
+			if probe {
+				headers.Set("Range", "bytes=0-0")
+			}
+
+			resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, headers, nil, newOpts)
+			if err != nil && probe && strings.HasPrefix(err.Error(), fmt.Sprintf("%d:", http.StatusRequestedRangeNotSatisfiable)) {
+				// the blob is empty or the registry rejects the range,
+				// ask again without one
+				probe = false
+				continue
+			} else if err != nil {
 				slog.Warn("failed to get direct URL; backing off and retrying", "err", err)
 				if err := backoff(ctx); err != nil {
 					return nil, err
@@ -256,10 +301,14 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 				continue
 			}
 			defer resp.Body.Close()
-			if resp.StatusCode != http.StatusTemporaryRedirect && resp.StatusCode != http.StatusOK {
+			switch resp.StatusCode {
+			case http.StatusTemporaryRedirect:
+				return resp.Location()
+			case http.StatusOK, http.StatusPartialContent:
+				return resp.Request.URL, nil
+			default:
 				return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
 			}
-			return resp.Location()
 		}
 	}()
 	if err != nil {
@@ -267,7 +316,7 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 	}
 
 	g, inner := errgroup.WithContext(ctx)
-	g.SetLimit(numDownloadParts)
+	g.SetLimit(numDownloadParts())
 	for i := range b.Parts {
 		part := b.Parts[i]
 		if part.Completed.Load() == part.Size {
@@ -277,6 +326,12 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 		g.Go(func() error {
 			var err error
 			for try := 0; try < maxRetries; try++ {
+				if part.hash == nil {
+					if _, err := part.rehash(file); err != nil {
+						return err
+					}
+				}
+
 				w := io.NewOffsetWriter(file, part.StartsAt())
 				err = b.downloadChunk(inner, directURL, w, part)
 				switch {
@@ -322,6 +377,63 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 	return nil
 }
 
+// allocate reserves disk space for the whole blob before downloading so a
+// full disk or exceeded quota is reported up front rather than partway
+// through. Filesystems that don't support preallocation fall back to a
+// sparse file. Space a resumed download already holds, as what was
+// preallocated for it before, is not needed again.
+func (b *blobDownload) allocate(file *os.File) error {
+	need := b.Total - max(b.Completed.Load(), allocatedSize(file))
+	if avail, _, err := diskSpace(filepath.Dir(b.Name)); err == nil && need > 0 && uint64(need) > avail {
+		return fmt.Errorf("%w: %s requires %s but only %s is available, free at least %s and try again",
+			errInsufficientSpace, b.Digest[7:19], format.HumanBytes(need), format.HumanBytes(int64(avail)), format.HumanBytes(need-int64(avail)))
+	}
+
+	if err := preallocate(file, b.Total); errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) {
+		return fmt.Errorf("%w: %s requires %s: %w", errInsufficientSpace, b.Digest[7:19], format.HumanBytes(need), err)
+	} else if err != nil {
+		slog.Debug("preallocation not supported, using sparse file", "digest", b.Digest, "error", err)
+		setSparse(file)
+	}
+
+	_ = file.Truncate(b.Total)
+	return nil
+}
+
+// verifyParts checks the completed bytes of each part in file against the
+// checksum recorded for them, so a download that resumes after a crash does
+// not keep bytes that never reached the disk. A part that does not match is
+// downloaded again from its start.
+func (b *blobDownload) verifyParts(file io.ReaderAt) error {
+	for _, part := range b.Parts {
+		checksum, err := part.rehash(file)
+		if err != nil {
+			return err
+		}
+
+		if part.Checksum != "" && checksum != part.Checksum {
+			slog.Warn(fmt.Sprintf("%s part %d is corrupt; downloading it again", b.Digest[7:19], part.N))
+			b.Completed.Add(-part.Completed.Load())
+			part.Completed.Store(0)
+			part.hash = sha256.New()
+		}
+	}
+
+	return nil
+}
+
+// rehash recomputes the hash of the completed bytes of p from file and
+// returns it.
+func (p *blobDownloadPart) rehash(file io.ReaderAt) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(file, p.Offset, p.Completed.Load())); err != nil {
+		return "", err
+	}
+
+	p.hash = h
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 func (b *blobDownload) downloadChunk(ctx context.Context, requestURL *url.URL, w io.Writer, part *blobDownloadPart) error {
 	g, ctx := errgroup.WithContext(ctx)
 	g.Go(func() error {
@@ -336,10 +448,11 @@ func (b *blobDownload) downloadChunk(ctx context.Context, requestURL *url.URL, w
 		}
 		defer resp.Body.Close()
 
-		n, err := io.CopyN(w, io.TeeReader(resp.Body, part), part.Size-part.Completed.Load())
+		n, err := io.CopyN(io.MultiWriter(w, part.hash), io.TeeReader(resp.Body, part), part.Size-part.Completed.Load())
 		if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, io.ErrUnexpectedEOF) {
-			// rollback progress
+			// rollback progress, which the hash has already consumed
 			b.Completed.Add(-n)
+			part.hash = nil
 			return err
 		}
 
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBlobDownloadAllocate(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("0", 64)
+
+	t.Run("allocates", func(t *testing.T) {
+		b := &blobDownload{Name: filepath.Join(t.TempDir(), "blob"), Digest: digest, Total: 1 << 20}
+
+		file, err := os.Create(b.Name + "-partial")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		if err := b.allocate(file); err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := file.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fi.Size() != b.Total {
+			t.Errorf("expected size %d, got %d", b.Total, fi.Size())
+		}
+
+		// a resumed download counts what was preallocated as already held
+		if n := allocatedSize(file); n != 0 && n < b.Total {
+			t.Errorf("expected at least %d allocated, got %d", b.Total, n)
+		}
+	})
+
+	t.Run("insufficient space", func(t *testing.T) {
+		b := &blobDownload{Name: filepath.Join(t.TempDir(), "blob"), Digest: digest, Total: 1 << 62}
+
+		file, err := os.Create(b.Name + "-partial")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		if _, _, err := diskSpace(filepath.Dir(b.Name)); errors.Is(err, errors.ErrUnsupported) {
+			t.Skip("free space is not available on this platform")
+		}
+
+		if err := b.allocate(file); !errors.Is(err, errInsufficientSpace) {
+			t.Errorf("expected insufficient space error, got %v", err)
+		}
+	})
+}
+
+func TestBlobDownloadVerifyParts(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("0", 64)
+	b := &blobDownload{Name: filepath.Join(t.TempDir(), "blob"), Digest: digest, Total: 20}
+
+	for _, offset := range []int64{0, 10} {
+		if err := b.newPart(offset, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, err := os.Create(b.Name + "-partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString("0123456789abcde"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first part is complete and the second part is half done
+	b.Parts[0].Completed.Store(10)
+	b.Parts[1].Completed.Store(5)
+	b.Completed.Store(15)
+	if err := b.verifyParts(file); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, part := range b.Parts {
+		if err := b.writePart(part.Name(), part); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// resume with the second part corrupted on disk
+	if _, err := file.WriteAt([]byte("ABCDE"), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := &blobDownload{Name: b.Name, Digest: digest}
+	for _, part := range b.Parts {
+		part, err := resumed.readPart(part.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part.Checksum == "" {
+			t.Fatalf("part %d has no checksum", part.N)
+		}
+		resumed.Completed.Add(part.Completed.Load())
+		resumed.Parts = append(resumed.Parts, part)
+	}
+
+	if err := resumed.verifyParts(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := resumed.Parts[0].Completed.Load(); n != 10 {
+		t.Errorf("part 0 completed = %d; want 10", n)
+	}
+	if n := resumed.Parts[1].Completed.Load(); n != 0 {
+		t.Errorf("part 1 completed = %d; want 0", n)
+	}
+	if n := resumed.Completed.Load(); n != 10 {
+		t.Errorf("completed = %d; want 10", n)
+	}
+}
+
+func TestNumDownloadParts(t *testing.T) {
+	cases := map[string]int{"": 16, "4": 4, "0": 1, "x": 16}
+	for v, want := range cases {
+		t.Setenv("OLLAMA_MAX_DOWNLOAD_PARTS", v)
+		if got := numDownloadParts(); got != want {
+			t.Errorf("OLLAMA_MAX_DOWNLOAD_PARTS=%q: got %d; want %d", v, got, want)
+		}
+	}
+}
+
+func TestBlobDownloadRangeNotSatisfiable(t *testing.T) {
+	var ranged int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			ranged++
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL + "/v2/library/test/blobs/sha256:" + strings.Repeat("0", 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &blobDownload{Name: filepath.Join(t.TempDir(), "blob"), Digest: "sha256:" + strings.Repeat("0", 64)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := b.run(ctx, u, &registryOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ranged != 1 {
+		t.Errorf("expected 1 range request, got %d", ranged)
+	}
+
+	if _, err := os.Stat(b.Name); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+)
+
+// eventBus fans out server events to subscribers. Events are dropped for
+// subscribers that fall behind rather than blocking the publisher.
+type eventBus struct {
+	mu   sync.Mutex
+	subs map[chan api.Event]struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[chan api.Event]struct{})}
+}
+
+// subscribe returns a channel of events published from now on and a
+// function to stop receiving them.
+func (b *eventBus) subscribe() (chan api.Event, func()) {
+	ch := make(chan api.Event, 64)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
+
+func (b *eventBus) publish(e api.Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+type loadProgressKey struct{}
+
+// withLoadProgress returns a context for scheduling a runner that calls fn
+// with the progress of the model load, if the request triggers one.
+func withLoadProgress(ctx context.Context, fn func(api.LoadEvent)) context.Context {
+	return context.WithValue(ctx, loadProgressKey{}, fn)
+}
+
+func loadProgressFunc(ctx context.Context) func(api.LoadEvent) {
+	fn, _ := ctx.Value(loadProgressKey{}).(func(api.LoadEvent))
+	return fn
+}
+
+// watchLoad reports the progress of llama loading until stop is closed.
+func watchLoad(llama llm.LlamaServer, report func(api.LoadEvent), stop chan struct{}) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	var last llm.LoadProgress
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if p := llama.LoadProgress(); p.Stage != "" && p != last {
+			last = p
+			report(api.LoadEvent{Stage: p.Stage, Progress: p.Progress})
+		}
+	}
+}
+
+// scheduleRunnerWithProgress is like scheduleRunner, but if the request
+// triggers a model load, fn is called from the calling goroutine with the
+// progress of the load. A nil fn is not called.
+func (s *Server) scheduleRunnerWithProgress(ctx context.Context, name string, caps []Capability, profile string, requestOpts map[string]any, keepAlive *api.Duration, fn func(api.LoadEvent)) (llm.LlamaServer, *Model, *api.Options, error) {
+	if fn == nil {
+		return s.scheduleRunner(ctx, name, caps, profile, requestOpts, keepAlive)
+	}
+
+	events := make(chan api.LoadEvent, 16)
+	ctx = withLoadProgress(ctx, func(e api.LoadEvent) {
+		select {
+		case events <- e:
+		default:
+		}
+	})
+
+	type result struct {
+		r    llm.LlamaServer
+		m    *Model
+		opts *api.Options
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		r, m, opts, err := s.scheduleRunner(ctx, name, caps, profile, requestOpts, keepAlive)
+		done <- result{r, m, opts, err}
+	}()
+
+	for {
+		select {
+		case e := <-events:
+			fn(e)
+		case res := <-done:
+			for {
+				select {
+				case e := <-events:
+					fn(e)
+				default:
+					return res.r, res.m, res.opts, res.err
+				}
+			}
+		}
+	}
+}
+
+// writeStreamed writes v as a single object of a streaming response.
+func writeStreamed(c *gin.Context, v any) {
+	bts, err := json.Marshal(v)
+	if err != nil {
+		slog.Info(fmt.Sprintf("writeStreamed: json.Marshal failed with %s", err))
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	if _, err := c.Writer.Write(append(bts, '\n')); err != nil {
+		slog.Info(fmt.Sprintf("writeStreamed: w.Write failed with %s", err))
+		return
+	}
+	c.Writer.Flush()
+}
+
+// eventForModel returns true if the event is about the model name.
+func eventForModel(e api.Event, name string) bool {
+	switch {
+	case e.Load != nil:
+		return e.Load.Model == name
+	case e.Scrub != nil:
+		return slices.Contains(e.Scrub.Models, name)
+	case e.Schedule != nil:
+		return e.Schedule.Model == name
+	default:
+		return false
+	}
+}
+
+// respond writes v as the response with status, or as the next object of
+// the streaming response if it was already started, such as by streaming the
+// progress of loading the model. The status can't be changed once the
+// response is started, so errors are then sent as {"error": ...} objects as
+// they are later in the stream.
+func respond(c *gin.Context, status int, v any) {
+	if c.Writer.Written() {
+		writeStreamed(c, v)
+		return
+	}
+
+	c.JSON(status, v)
+}
+
+// EventsHandler streams server events until the client disconnects. The
+// model query parameter limits the events to those of a single model.
+func (s *Server) EventsHandler(c *gin.Context) {
+	if s.sched == nil || s.sched.events == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "events are not available"})
+		return
+	}
+
+	var name string
+	if model := c.Query("model"); model != "" {
+		m, err := GetModel(model)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", model)})
+			return
+		}
+		name = m.ShortName
+	}
+
+	events, unsubscribe := s.sched.events.subscribe()
+	defer unsubscribe()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case e := <-events:
+			if name != "" && !eventForModel(e, name) {
+				continue
+			}
+
+			writeStreamed(c, e)
+		}
+	}
+}
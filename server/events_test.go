@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestRespond(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	respond(c, http.StatusBadRequest, gin.H{"error": "bad request"})
+	if w.Code != http.StatusBadRequest || w.Body.String() != `{"error":"bad request"}` {
+		t.Errorf("expected a 400 error response, got %d %s", w.Code, w.Body)
+	}
+
+	// once loading the model was streamed, errors are objects of the stream
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	writeStreamed(c, api.GenerateResponse{Model: "test", Load: &api.LoadEvent{Stage: "loading weights"}})
+	respond(c, http.StatusInternalServerError, gin.H{"error": "template error"})
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+
+	if got, want := w.Body.String(), "\n"+`{"error":"template error"}`+"\n"; len(got) < len(want) || got[len(got)-len(want):] != want {
+		t.Errorf("expected the error as the last object of the stream, got %q", got)
+	}
+}
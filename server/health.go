@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
+)
+
+const (
+	healthHealthy   = "healthy"
+	healthDegraded  = "degraded"
+	healthUnhealthy = "unhealthy"
+)
+
+// healthHeader is the header responses report the health of the server in,
+// so load balancers can send less traffic to degraded servers.
+const healthHeader = "X-Ollama-Health"
+
+const (
+	// diskNearlyFull is the fraction of the models disk below which free
+	// space degrades the server
+	diskNearlyFull = 0.1
+
+	// diskFull is the free space of the models disk below which models
+	// can't be pulled or created
+	diskFull = 1 * format.GibiByte
+)
+
+// healthInterval is how often the health reported in responses is checked
+var healthInterval = 10 * time.Second
+
+// healthSeverity orders the health statuses from best to worst.
+var healthSeverity = map[string]int{healthHealthy: 0, healthDegraded: 1, healthUnhealthy: 2}
+
+// checkHealth returns the health of a server with the GPUs of info and
+// avail of total bytes free on the disk of its models.
+func checkHealth(info discover.SystemInfo, avail, total uint64) api.HealthResponse {
+	var causes []api.HealthCause
+
+	for _, id := range info.LostGPUs {
+		status := healthDegraded
+		if len(info.LostGPUs) == len(info.GPUs) {
+			// models only run on the CPU
+			status = healthUnhealthy
+		}
+
+		causes = append(causes, api.HealthCause{
+			Kind:    "gpu_lost",
+			Status:  status,
+			Message: fmt.Sprintf("GPU %s stopped responding", id),
+		})
+	}
+
+	if total > 0 {
+		free := fmt.Sprintf("%s of %s free on the models disk", format.HumanBytes2(avail), format.HumanBytes2(total))
+		switch {
+		case avail < diskFull:
+			causes = append(causes, api.HealthCause{Kind: "disk_full", Status: healthUnhealthy, Message: free})
+		case float64(avail) < diskNearlyFull*float64(total):
+			causes = append(causes, api.HealthCause{Kind: "disk_nearly_full", Status: healthDegraded, Message: free})
+		}
+	}
+
+	resp := api.HealthResponse{Status: healthHealthy, Causes: causes}
+	for _, c := range causes {
+		if healthSeverity[c.Status] > healthSeverity[resp.Status] {
+			resp.Status = c.Status
+		}
+	}
+
+	return resp
+}
+
+// currentHealth checks the health of the server now.
+func currentHealth() api.HealthResponse {
+	avail, total, err := diskSpace(envconfig.Models())
+	if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		slog.Debug("failed to read free space of the models disk", "error", err)
+	}
+
+	return checkHealth(discover.GetSystemInfo(), avail, total)
+}
+
+// healthMonitor keeps the health of the server up to date for the header of
+// each response, which is too often to check it.
+type healthMonitor struct {
+	mu     sync.Mutex
+	status string
+}
+
+func newHealthMonitor() *healthMonitor {
+	return &healthMonitor{status: healthHealthy}
+}
+
+// set records resp as the health of the server, logging changes.
+func (h *healthMonitor) set(resp api.HealthResponse) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if resp.Status != h.status {
+		slog.Warn("health changed", "status", resp.Status, "previous", h.status, "causes", resp.Causes)
+		h.status = resp.Status
+	}
+}
+
+// run checks the health every interval until ctx is done.
+func (h *healthMonitor) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.set(currentHealth())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// middleware reports the last health checked in the header of responses.
+func (h *healthMonitor) middleware(c *gin.Context) {
+	h.mu.Lock()
+	status := h.status
+	h.mu.Unlock()
+
+	c.Header(healthHeader, status)
+	c.Next()
+}
+
+// HealthHandler reports the health of the server. Unhealthy servers respond
+// with 503 Service Unavailable.
+func (s *Server) HealthHandler(c *gin.Context) {
+	resp := currentHealth()
+	s.health.set(resp)
+	c.Header(healthHeader, resp.Status)
+
+	if resp.Status == healthUnhealthy {
+		var msgs []string
+		for _, cause := range resp.Causes {
+			msgs = append(msgs, cause.Message)
+		}
+
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": resp.Status, "causes": resp.Causes, "error": strings.Join(msgs, "; ")})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/format"
+)
+
+func TestCheckHealth(t *testing.T) {
+	gpus := []discover.GpuInfo{{ID: "GPU-0"}, {ID: "GPU-1"}}
+
+	cases := []struct {
+		name         string
+		info         discover.SystemInfo
+		avail, total uint64
+		expected     api.HealthResponse
+	}{
+		{
+			name:     "healthy",
+			info:     discover.SystemInfo{GPUs: gpus},
+			avail:    500 * format.GibiByte,
+			total:    1000 * format.GibiByte,
+			expected: api.HealthResponse{Status: "healthy"},
+		},
+		{
+			name:  "one gpu lost",
+			info:  discover.SystemInfo{GPUs: gpus, LostGPUs: []string{"GPU-1"}},
+			avail: 500 * format.GibiByte,
+			total: 1000 * format.GibiByte,
+			expected: api.HealthResponse{Status: "degraded", Causes: []api.HealthCause{
+				{Kind: "gpu_lost", Status: "degraded", Message: "GPU GPU-1 stopped responding"},
+			}},
+		},
+		{
+			name:  "all gpus lost",
+			info:  discover.SystemInfo{GPUs: gpus[:1], LostGPUs: []string{"GPU-0"}},
+			avail: 500 * format.GibiByte,
+			total: 1000 * format.GibiByte,
+			expected: api.HealthResponse{Status: "unhealthy", Causes: []api.HealthCause{
+				{Kind: "gpu_lost", Status: "unhealthy", Message: "GPU GPU-0 stopped responding"},
+			}},
+		},
+		{
+			name:  "disk nearly full",
+			info:  discover.SystemInfo{GPUs: gpus},
+			avail: 50 * format.GibiByte,
+			total: 1000 * format.GibiByte,
+			expected: api.HealthResponse{Status: "degraded", Causes: []api.HealthCause{
+				{Kind: "disk_nearly_full", Status: "degraded", Message: "50.0 GiB of 1000.0 GiB free on the models disk"},
+			}},
+		},
+		{
+			name:  "disk full and gpu lost",
+			info:  discover.SystemInfo{GPUs: gpus, LostGPUs: []string{"GPU-0"}},
+			avail: 512 * format.MebiByte,
+			total: 1000 * format.GibiByte,
+			expected: api.HealthResponse{Status: "unhealthy", Causes: []api.HealthCause{
+				{Kind: "gpu_lost", Status: "degraded", Message: "GPU GPU-0 stopped responding"},
+				{Kind: "disk_full", Status: "unhealthy", Message: "512.0 MiB of 1000.0 GiB free on the models disk"},
+			}},
+		},
+		{
+			name:     "disk space unknown",
+			info:     discover.SystemInfo{},
+			expected: api.HealthResponse{Status: "healthy"},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(checkHealth(tt.info, tt.avail, tt.total), tt.expected); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHealthHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := newHealthMonitor()
+	_, router := gin.CreateTestContext(httptest.NewRecorder())
+	router.Use(h.middleware)
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, status := range []string{"healthy", "degraded", "healthy"} {
+		h.set(api.HealthResponse{Status: status})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := w.Header().Get(healthHeader); got != status {
+			t.Errorf("expected %s, got %s", status, got)
+		}
+	}
+
+	// a server without a monitor reports nothing
+	var none *healthMonitor
+	none.set(api.HealthResponse{Status: "unhealthy"})
+}
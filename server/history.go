@@ -0,0 +1,274 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+// maxHistory is the number of requests kept in the history file. The file is
+// allowed to grow to twice this before older entries are dropped, so it is
+// not rewritten on every request.
+const maxHistory = 1000
+
+var errHistoryNotFound = errors.New("history entry not found")
+
+// historyStore records the generate and chat requests served in a file of
+// JSON lines, oldest first. A nil historyStore records nothing.
+type historyStore struct {
+	mu      sync.Mutex
+	path    string
+	capture bool
+
+	// entries is the number of entries in the file, or -1 until it is read
+	entries int
+}
+
+// newHistoryStore returns the history configured by OLLAMA_HISTORY_FILE and
+// OLLAMA_HISTORY_CAPTURE, or nil if OLLAMA_NOHISTORY is set.
+func newHistoryStore() *historyStore {
+	if envconfig.NoHistory() {
+		return nil
+	}
+
+	return &historyStore{path: envconfig.HistoryFile(), capture: envconfig.HistoryCapture(), entries: -1}
+}
+
+// promptHash returns the hash recorded in place of a prompt.
+func promptHash(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+// record appends e to the history, dropping the exchange unless the history
+// captures exchanges. Failures are logged rather than failing the request.
+func (h *historyStore) record(e api.HistoryEntry) {
+	if h == nil {
+		return
+	}
+
+	e.ID = fmt.Sprintf("%012x", rand.Uint64()>>16)
+	e.CreatedAt = time.Now().UTC()
+	e.Captured = h.capture
+	if !h.capture {
+		e.Prompt, e.Response, e.Messages = "", "", nil
+	}
+
+	// images would make up most of the file
+	e.Messages = slices.Clone(e.Messages)
+	for i := range e.Messages {
+		e.Messages[i].Images = nil
+	}
+
+	if err := h.append(e); err != nil {
+		slog.Warn("failed to record request history", "error", err)
+	}
+}
+
+func (h *historyStore) append(e api.HistoryEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.entries < 0 {
+		entries, err := h.read()
+		if err != nil {
+			return err
+		}
+		h.entries = len(entries)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	h.entries++
+	if h.entries > 2*maxHistory {
+		return h.trim()
+	}
+
+	return nil
+}
+
+// trim rewrites the history with its most recent maxHistory entries. It must
+// be called with h.mu held.
+func (h *historyStore) trim() error {
+	entries, err := h.read()
+	if err != nil {
+		return err
+	}
+
+	entries = entries[max(len(entries)-maxHistory, 0):]
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, b.Bytes(), 0o600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, h.path); err != nil {
+		return err
+	}
+
+	h.entries = len(entries)
+	return nil
+}
+
+// read returns the entries in the history file, oldest first. Lines that
+// don't parse, such as one cut short by a crash, are skipped.
+func (h *historyStore) read() ([]api.HistoryEntry, error) {
+	f, err := os.Open(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []api.HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var e api.HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, scanner.Err()
+}
+
+// list returns the entries in the history, newest first, without their
+// exchanges.
+func (h *historyStore) list() ([]api.HistoryEntry, error) {
+	if h == nil {
+		return []api.HistoryEntry{}, nil
+	}
+
+	h.mu.Lock()
+	entries, err := h.read()
+	h.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(entries)
+	for i := range entries {
+		entries[i].Prompt, entries[i].Response, entries[i].Messages = "", "", nil
+	}
+
+	if entries == nil {
+		entries = []api.HistoryEntry{}
+	}
+
+	return entries, nil
+}
+
+// get returns the entry with the given id, including its exchange.
+func (h *historyStore) get(id string) (*api.HistoryEntry, error) {
+	if h == nil {
+		return nil, errHistoryNotFound
+	}
+
+	h.mu.Lock()
+	entries, err := h.read()
+	h.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if e.ID == id {
+			return &e, nil
+		}
+	}
+
+	return nil, errHistoryNotFound
+}
+
+// visible reports whether the user of ctx may see the history entry e. With
+// access control enabled, users only see their own requests and admins see
+// everyone's.
+func (s *Server) visible(ctx context.Context, e api.HistoryEntry) bool {
+	if s.acl.checkAdmin(ctx) == nil {
+		return true
+	}
+
+	u, ok := ctx.Value(aclUserKey{}).(*aclUser)
+	return ok && e.User == u.Name
+}
+
+func (s *Server) ListHistoryHandler(c *gin.Context) {
+	entries, err := s.history.list()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries = slices.DeleteFunc(entries, func(e api.HistoryEntry) bool {
+		return !s.visible(c.Request.Context(), e)
+	})
+
+	c.JSON(http.StatusOK, api.ListHistoryResponse{Entries: entries})
+}
+
+func (s *Server) ShowHistoryHandler(c *gin.Context) {
+	e, err := s.history.get(c.Param("id"))
+	if err == nil && !s.visible(c.Request.Context(), *e) {
+		err = errHistoryNotFound
+	}
+
+	if errors.Is(err, errHistoryNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("history entry '%s' not found", c.Param("id"))})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, e)
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_HISTORY_FILE", filepath.Join(t.TempDir(), "history.jsonl"))
+
+	t.Run("capture", func(t *testing.T) {
+		t.Setenv("OLLAMA_HISTORY_CAPTURE", "1")
+		h := newHistoryStore()
+
+		h.record(api.HistoryEntry{Endpoint: "generate", Model: "test", PromptHash: promptHash("hi"), Prompt: "hi", Response: "hello"})
+		h.record(api.HistoryEntry{Endpoint: "chat", Model: "test", Messages: []api.Message{{Role: "user", Content: "hi", Images: []api.ImageData{[]byte("image")}}}})
+
+		entries, err := h.list()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 2 || entries[0].Endpoint != "chat" || entries[1].Endpoint != "generate" {
+			t.Fatalf("expected the chat entry then the generate entry, got %+v", entries)
+		}
+
+		if entries[1].Prompt != "" || entries[0].Messages != nil {
+			t.Errorf("expected the list to leave out exchanges, got %+v", entries)
+		}
+
+		e, err := h.get(entries[1].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !e.Captured || e.Prompt != "hi" || e.Response != "hello" {
+			t.Errorf("expected the captured exchange, got %+v", e)
+		}
+
+		e, err = h.get(entries[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff([]api.Message{{Role: "user", Content: "hi"}}, e.Messages); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("no capture", func(t *testing.T) {
+		h := newHistoryStore()
+		h.record(api.HistoryEntry{Endpoint: "generate", Model: "test", Prompt: "secret", Response: "secret"})
+
+		entries, err := h.list()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e, err := h.get(entries[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Captured || e.Prompt != "" || e.Response != "" {
+			t.Errorf("expected the exchange to be dropped, got %+v", e)
+		}
+	})
+
+	t.Run("trim", func(t *testing.T) {
+		t.Setenv("OLLAMA_HISTORY_FILE", filepath.Join(t.TempDir(), "history.jsonl"))
+		h := newHistoryStore()
+		for range 2*maxHistory + 1 {
+			h.record(api.HistoryEntry{Endpoint: "generate"})
+		}
+
+		entries, err := h.list()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != maxHistory {
+			t.Errorf("expected %d entries, got %d", maxHistory, len(entries))
+		}
+	})
+
+	t.Run("handlers", func(t *testing.T) {
+		s := Server{history: newHistoryStore()}
+		router := s.GenerateRoutes()
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		var resp api.ListHistoryResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(resp.Entries) == 0 {
+			t.Fatal("expected entries")
+		}
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history/"+resp.Entries[0].ID, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", w.Code)
+		}
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history/missing", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("access control", func(t *testing.T) {
+		t.Setenv("OLLAMA_HISTORY_FILE", filepath.Join(t.TempDir(), "history.jsonl"))
+		s := Server{history: newHistoryStore(), acl: &accessList{users: map[string]*aclUser{
+			"key-a":     {Name: "team-a"},
+			"key-b":     {Name: "team-b"},
+			"key-admin": {Name: "admin", Admin: true},
+		}}}
+		router := s.GenerateRoutes()
+
+		s.history.record(api.HistoryEntry{Endpoint: "generate", Model: "test", User: "team-a"})
+		s.history.record(api.HistoryEntry{Endpoint: "generate", Model: "test", User: "team-b"})
+
+		list := func(key string) []api.HistoryEntry {
+			r := httptest.NewRequest(http.MethodGet, "/api/history", nil)
+			r.Header.Set("Authorization", "Bearer "+key)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", w.Code)
+			}
+
+			var resp api.ListHistoryResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			return resp.Entries
+		}
+
+		entries := list("key-a")
+		if len(entries) != 1 || entries[0].User != "team-a" {
+			t.Errorf("expected the entry of team-a, got %+v", entries)
+		}
+
+		if entries := list("key-admin"); len(entries) != 2 {
+			t.Errorf("expected all entries, got %+v", entries)
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/api/history/"+entries[0].ID, nil)
+		r.Header.Set("Authorization", "Bearer key-b")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv("OLLAMA_NOHISTORY", "1")
+		if h := newHistoryStore(); h != nil {
+			t.Errorf("expected no history, got %+v", h)
+		}
+	})
+}
@@ -0,0 +1,519 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+// huggingFaceURL is the Hugging Face Hub, which can be replaced for testing.
+var huggingFaceURL = "https://huggingface.co"
+
+var errNoHuggingFaceToken = errors.New("no Hugging Face token found, set HF_TOKEN or run 'huggingface-cli login'")
+
+// isHuggingFace reports whether models pushed to host are pushed to a
+// Hugging Face repository rather than a registry.
+func isHuggingFace(host string) bool {
+	return host == "hf.co" || host == "huggingface.co"
+}
+
+// huggingFaceToken returns the token the Hugging Face tools use: HF_TOKEN, or
+// the token saved by 'huggingface-cli login'.
+func huggingFaceToken() (string, error) {
+	if s := envconfig.Var("HF_TOKEN"); s != "" {
+		return s, nil
+	}
+
+	path := envconfig.Var("HF_TOKEN_PATH")
+	if path == "" {
+		home := envconfig.Var("HF_HOME")
+		if home == "" {
+			dir, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			home = filepath.Join(dir, ".cache", "huggingface")
+		}
+		path = filepath.Join(home, "token")
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errNoHuggingFaceToken
+	} else if err != nil {
+		return "", err
+	}
+
+	if token := strings.TrimSpace(string(b)); token != "" {
+		return token, nil
+	}
+
+	return "", errNoHuggingFaceToken
+}
+
+var modelCardTemplate = template.Must(template.New("").Parse(`---
+tags:
+- gguf
+- ollama
+---
+
+# {{ .Repository }}
+
+{{- if .Family }}
+
+A {{ .Family }} model pushed from [Ollama](https://ollama.com).
+{{- else }}
+
+A model pushed from [Ollama](https://ollama.com).
+{{- end }}
+
+## Run with Ollama
+
+` + "```shell" + `
+ollama run hf.co/{{ .Namespace }}/{{ .Repository }}{{ with .Quantization }}:{{ . }}{{ end }}
+` + "```" + `
+{{- with .System }}
+
+## System prompt
+
+` + "```" + `
+{{ . }}
+` + "```" + `
+{{- end }}
+`))
+
+// quantization returns the file type of the model of config, if known.
+func (config ConfigV2) quantization() string {
+	if config.FileType == "unknown" {
+		return ""
+	}
+
+	return config.FileType
+}
+
+// huggingFaceFile returns the name of the GGUF file of a model in a Hugging
+// Face repository. Naming it after the quantization lets the Hub serve it to
+// 'ollama pull hf.co/<namespace>/<repository>:<quantization>'.
+func huggingFaceFile(mp ModelPath, config ConfigV2) string {
+	if q := config.quantization(); q != "" {
+		return mp.Repository + "-" + q + ".gguf"
+	}
+
+	return mp.Repository + ".gguf"
+}
+
+// pushHuggingFace uploads the weights of a model to the Hugging Face
+// repository <namespace>/<repository>, creating it as a private repository if
+// it does not exist, and adds a model card if the repository has none.
+// Adapters and projectors are not uploaded.
+func pushHuggingFace(ctx context.Context, mp ModelPath, manifest *Manifest, fn func(api.ProgressResponse)) error {
+	token, err := huggingFaceToken()
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(manifest.Layers, func(l Layer) bool { return l.MediaType == "application/vnd.ollama.image.model" })
+	if i < 0 {
+		return errors.New("model has no weights to push")
+	}
+	weights := manifest.Layers[i]
+
+	var config ConfigV2
+	if p, err := GetBlobsPath(manifest.Config.Digest); err == nil {
+		if b, err := os.ReadFile(p); err == nil {
+			_ = json.Unmarshal(b, &config)
+		}
+	}
+
+	regOpts := &registryOptions{Token: token}
+	repo := mp.Namespace + "/" + mp.Repository
+
+	fn(api.ProgressResponse{Status: "creating repository " + repo})
+	files, err := createHuggingFaceRepo(ctx, mp, regOpts)
+	if err != nil {
+		return err
+	}
+
+	if err := uploadHuggingFaceLFS(ctx, repo, weights, regOpts, fn); err != nil {
+		return err
+	}
+
+	type operation struct {
+		Key   string `json:"key"`
+		Value any    `json:"value"`
+	}
+
+	file := huggingFaceFile(mp, config)
+	ops := []operation{
+		{"header", map[string]string{"summary": "Push " + file + " from Ollama"}},
+		{"lfsFile", map[string]any{"path": file, "algo": "sha256", "oid": weights.Digest[7:], "size": weights.Size}},
+	}
+
+	if !slices.Contains(files, "README.md") {
+		var system string
+		if i := slices.IndexFunc(manifest.Layers, func(l Layer) bool { return l.MediaType == "application/vnd.ollama.image.system" }); i >= 0 {
+			if p, err := GetBlobsPath(manifest.Layers[i].Digest); err == nil {
+				if b, err := os.ReadFile(p); err == nil {
+					system = string(b)
+				}
+			}
+		}
+
+		var card bytes.Buffer
+		if err := modelCardTemplate.Execute(&card, map[string]any{
+			"Namespace":    mp.Namespace,
+			"Repository":   mp.Repository,
+			"Family":       config.ModelFamily,
+			"Quantization": config.quantization(),
+			"System":       system,
+		}); err != nil {
+			return err
+		}
+
+		ops = append(ops, operation{"file", map[string]string{
+			"path":     "README.md",
+			"content":  base64.StdEncoding.EncodeToString(card.Bytes()),
+			"encoding": "base64",
+		}})
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, op := range ops {
+		if err := enc.Encode(op); err != nil {
+			return err
+		}
+	}
+
+	fn(api.ProgressResponse{Status: "committing " + file})
+	headers := make(http.Header)
+	headers.Set("Content-Type", "application/x-ndjson")
+	resp, err := huggingFaceRequest(ctx, http.MethodPost, huggingFaceAPI("api", "models", mp.Namespace, mp.Repository, "commit", "main"), headers, &body, regOpts)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	fn(api.ProgressResponse{Status: "success"})
+	return nil
+}
+
+// createHuggingFaceRepo creates the repository of mp unless it exists and
+// returns the files in it.
+func createHuggingFaceRepo(ctx context.Context, mp ModelPath, regOpts *registryOptions) ([]string, error) {
+	resp, err := huggingFaceRequest(ctx, http.MethodGet, huggingFaceAPI("api", "whoami-v2"), nil, nil, regOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var whoami struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&whoami); err != nil {
+		return nil, err
+	}
+
+	create := map[string]any{"type": "model", "name": mp.Repository, "private": true}
+	if !strings.EqualFold(mp.Namespace, whoami.Name) {
+		create["organization"] = mp.Namespace
+	}
+
+	b, err := json.Marshal(create)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Type", "application/json")
+	resp, err = huggingFaceRequest(ctx, http.MethodPost, huggingFaceAPI("api", "repos", "create"), headers, bytes.NewReader(b), regOpts)
+	var statusErr api.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict {
+		// the repository exists
+	} else if err != nil {
+		return nil, err
+	} else {
+		resp.Body.Close()
+	}
+
+	resp, err = huggingFaceRequest(ctx, http.MethodGet, huggingFaceAPI("api", "models", mp.Namespace, mp.Repository), nil, nil, regOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var info struct {
+		Siblings []struct {
+			Name string `json:"rfilename"`
+		} `json:"siblings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, s := range info.Siblings {
+		files = append(files, s.Name)
+	}
+
+	return files, nil
+}
+
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+// uploadHuggingFaceLFS uploads the blob of layer to the Git LFS storage of
+// repo, in parts if the Hub asks for a multipart transfer as it does for
+// large files.
+func uploadHuggingFaceLFS(ctx context.Context, repo string, layer Layer, regOpts *registryOptions, fn func(api.ProgressResponse)) error {
+	oid := layer.Digest[7:]
+	b, err := json.Marshal(map[string]any{
+		"operation": "upload",
+		"transfers": []string{"basic", "multipart"},
+		"hash_algo": "sha256",
+		"objects":   []map[string]any{{"oid": oid, "size": layer.Size}},
+	})
+	if err != nil {
+		return err
+	}
+
+	headers := make(http.Header)
+	headers.Set("Accept", "application/vnd.git-lfs+json")
+	headers.Set("Content-Type", "application/vnd.git-lfs+json")
+	resp, err := huggingFaceRequest(ctx, http.MethodPost, huggingFaceAPI(repo+".git", "info", "lfs", "objects", "batch"), headers, bytes.NewReader(b), regOpts)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var batch struct {
+		Objects []struct {
+			Actions struct {
+				Upload *lfsAction `json:"upload"`
+				Verify *lfsAction `json:"verify"`
+			} `json:"actions"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"objects"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return err
+	}
+
+	if len(batch.Objects) != 1 {
+		return fmt.Errorf("unexpected lfs batch response with %d objects", len(batch.Objects))
+	}
+
+	object := batch.Objects[0]
+	if object.Error != nil {
+		return fmt.Errorf("lfs upload: %s", object.Error.Message)
+	}
+
+	progress := func(completed int64) {
+		fn(api.ProgressResponse{
+			Status:    fmt.Sprintf("pushing %s", layer.Digest[7:19]),
+			Digest:    layer.Digest,
+			Total:     layer.Size,
+			Completed: completed,
+		})
+	}
+
+	// no upload action means the Hub has the blob
+	if object.Actions.Upload == nil {
+		progress(layer.Size)
+		return nil
+	}
+
+	p, err := GetBlobsPath(layer.Digest)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	upload := object.Actions.Upload
+	if _, ok := upload.Header["chunk_size"]; ok {
+		err = uploadLFSParts(ctx, f, oid, layer.Size, upload, progress)
+	} else {
+		headers := make(http.Header)
+		for k, v := range upload.Header {
+			headers.Set(k, v)
+		}
+		headers.Set("Content-Length", strconv.FormatInt(layer.Size, 10))
+
+		var resp *http.Response
+		resp, err = huggingFaceRequest(ctx, http.MethodPut, upload.Href, headers, &progressReader{Reader: f, fn: progress}, &registryOptions{})
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	progress(layer.Size)
+
+	if verify := object.Actions.Verify; verify != nil {
+		b, err := json.Marshal(map[string]any{"oid": oid, "size": layer.Size})
+		if err != nil {
+			return err
+		}
+
+		headers := make(http.Header)
+		headers.Set("Content-Type", "application/vnd.git-lfs+json")
+		for k, v := range verify.Header {
+			headers.Set(k, v)
+		}
+
+		resp, err := huggingFaceRequest(ctx, http.MethodPost, verify.Href, headers, bytes.NewReader(b), regOpts)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+
+	return nil
+}
+
+// uploadLFSParts uploads f to the part URLs of a multipart upload action,
+// which are its numbered headers, and completes the upload.
+func uploadLFSParts(ctx context.Context, f io.ReaderAt, oid string, size int64, upload *lfsAction, progress func(int64)) error {
+	chunkSize, err := strconv.ParseInt(upload.Header["chunk_size"], 10, 64)
+	if err != nil || chunkSize <= 0 {
+		return fmt.Errorf("invalid lfs chunk size %q", upload.Header["chunk_size"])
+	}
+
+	var parts []int
+	for k := range upload.Header {
+		if n, err := strconv.Atoi(k); err == nil {
+			parts = append(parts, n)
+		}
+	}
+	slices.Sort(parts)
+
+	type completedPart struct {
+		PartNumber int    `json:"partNumber"`
+		ETag       string `json:"etag"`
+	}
+
+	var completed []completedPart
+	for i, n := range parts {
+		offset := int64(i) * chunkSize
+		if offset >= size {
+			break
+		}
+		length := min(chunkSize, size-offset)
+
+		headers := make(http.Header)
+		headers.Set("Content-Length", strconv.FormatInt(length, 10))
+		resp, err := huggingFaceRequest(ctx, http.MethodPut, upload.Header[strconv.Itoa(n)], headers, io.NewSectionReader(f, offset, length), &registryOptions{})
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		completed = append(completed, completedPart{PartNumber: n, ETag: resp.Header.Get("ETag")})
+		progress(offset + length)
+	}
+
+	b, err := json.Marshal(map[string]any{"oid": oid, "parts": completed})
+	if err != nil {
+		return err
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Type", "application/vnd.git-lfs+json")
+	resp, err := huggingFaceRequest(ctx, http.MethodPost, upload.Href, headers, bytes.NewReader(b), &registryOptions{})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// huggingFaceAPI returns the URL of path on the Hub.
+func huggingFaceAPI(path ...string) string {
+	u, err := url.JoinPath(huggingFaceURL, path...)
+	if err != nil {
+		panic(err)
+	}
+
+	return u
+}
+
+// huggingFaceRequest makes a request to the Hub or its storage, returning an
+// api.StatusError for responses that are not successful.
+func huggingFaceRequest(ctx context.Context, method, rawURL string, headers http.Header, body io.Reader, regOpts *registryOptions) (*http.Response, error) {
+	requestURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := makeRequest(ctx, method, requestURL, headers, body, regOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(b, &e)
+
+		return nil, api.StatusError{
+			StatusCode:   resp.StatusCode,
+			Status:       resp.Status,
+			ErrorMessage: cmp.Or(e.Error, strings.TrimSpace(string(b))),
+		}
+	}
+
+	return resp, nil
+}
+
+// progressReader reports how much of Reader has been read at most every
+// 100ms.
+type progressReader struct {
+	io.Reader
+	fn func(int64)
+
+	n    int64
+	last time.Time
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	if time.Since(r.last) > 100*time.Millisecond {
+		r.fn(r.n)
+		r.last = time.Now()
+	}
+
+	return n, err
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+)
+
+func TestPushHuggingFace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("HF_TOKEN", "secret")
+
+	var mu sync.Mutex
+	var uploaded []byte
+	var commit []map[string]any
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/whoami-v2", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"name": "user"})
+	})
+	mux.HandleFunc("POST /api/repos/create", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["name"] != "repo" || req["organization"] != nil || req["private"] != true {
+			http.Error(w, fmt.Sprintf("unexpected create request %v", req), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "You already created this model repo"})
+	})
+	mux.HandleFunc("GET /api/models/user/repo", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"siblings": []map[string]string{{"rfilename": ".gitattributes"}}})
+	})
+
+	var srv *httptest.Server
+	mux.HandleFunc("POST /user/repo.git/info/lfs/objects/batch", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Objects []struct {
+				Size int64 `json:"size"`
+			} `json:"objects"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		// split the blob in two parts
+		chunkSize := (req.Objects[0].Size + 1) / 2
+		json.NewEncoder(w).Encode(map[string]any{
+			"objects": []map[string]any{{
+				"actions": map[string]any{
+					"upload": map[string]any{
+						"href":   srv.URL + "/upload/complete",
+						"header": map[string]string{"chunk_size": strconv.FormatInt(chunkSize, 10), "1": srv.URL + "/upload/1", "2": srv.URL + "/upload/2"},
+					},
+					"verify": map[string]any{"href": srv.URL + "/verify"},
+				},
+			}},
+		})
+	})
+	mux.HandleFunc("PUT /upload/{n}", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		uploaded = append(uploaded, b...)
+		mu.Unlock()
+		w.Header().Set("ETag", "etag-"+r.PathValue("n"))
+	})
+	mux.HandleFunc("POST /upload/complete", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Parts []struct {
+				PartNumber int    `json:"partNumber"`
+				ETag       string `json:"etag"`
+			} `json:"parts"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Parts) != 2 || req.Parts[1].PartNumber != 2 || req.Parts[1].ETag != "etag-2" {
+			http.Error(w, fmt.Sprintf("unexpected parts %v", req.Parts), http.StatusBadRequest)
+		}
+	})
+	mux.HandleFunc("POST /verify", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("POST /api/models/user/repo/commit/main", func(w http.ResponseWriter, r *http.Request) {
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			var op map[string]any
+			json.Unmarshal(sc.Bytes(), &op)
+			commit = append(commit, op)
+		}
+	})
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/upload/") != (r.Header.Get("Authorization") == "") {
+			http.Error(w, "unexpected authorization", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	huggingFaceURL = srv.URL
+	defer func() { huggingFaceURL = "https://huggingface.co" }()
+
+	var s Server
+	_, digest := createBinFile(t, llm.KV{"general.architecture": "llama", "general.file_type": uint32(1)}, nil)
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "hf.co/user/repo",
+		Files:  map[string]string{"test.gguf": digest},
+		System: "You are a helpful assistant.",
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	if err := PushModel(context.Background(), "hf.co/user/repo", &registryOptions{}, func(api.ProgressResponse) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weights, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(uploaded, weights) {
+		t.Errorf("uploaded %d bytes; want the %d bytes of the weights", len(uploaded), len(weights))
+	}
+
+	if len(commit) != 3 {
+		t.Fatalf("expected 3 commit operations, got %v", commit)
+	}
+
+	lfs := commit[1]["value"].(map[string]any)
+	if lfs["path"] != "repo-F16.gguf" || lfs["oid"] != digest[7:] {
+		t.Errorf("unexpected lfs file %v", lfs)
+	}
+
+	readme := commit[2]["value"].(map[string]any)
+	card, err := base64.StdEncoding.DecodeString(readme["content"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"A llama model", "ollama run hf.co/user/repo:F16", "You are a helpful assistant."} {
+		if !bytes.Contains(card, []byte(want)) {
+			t.Errorf("expected model card to contain %q, got:\n%s", want, card)
+		}
+	}
+}
+
+func TestHuggingFaceToken(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HF_TOKEN", "")
+	t.Setenv("HF_TOKEN_PATH", "")
+	t.Setenv("HF_HOME", home)
+
+	if _, err := huggingFaceToken(); !errors.Is(err, errNoHuggingFaceToken) {
+		t.Errorf("expected %v, got %v", errNoHuggingFaceToken, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(home, "token"), []byte("saved\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if token, err := huggingFaceToken(); err != nil || token != "saved" {
+		t.Errorf("expected saved token, got %q, %v", token, err)
+	}
+
+	t.Setenv("HF_TOKEN", "env")
+	if token, err := huggingFaceToken(); err != nil || token != "env" {
+		t.Errorf("expected token from HF_TOKEN, got %q, %v", token, err)
+	}
+}
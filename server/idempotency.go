@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// operationTTL is how long the result of a completed operation is kept for
+// requests retried with the same Idempotency-Key.
+const operationTTL = 24 * time.Hour
+
+// operationBacklog is the most responses of a running operation kept for
+// requests following it. Followers that fall behind skip to the oldest kept
+// response, which is fine for progress that supersedes what came before.
+const operationBacklog = 64
+
+// operationGrace is how long an operation keeps running once no request
+// follows it, so a client retrying after a timeout can still attach to it.
+var operationGrace = 30 * time.Second
+
+// operation is a mutating request started with an Idempotency-Key. It runs
+// independently of the request that started it so that a client retrying
+// after a timeout attaches to it rather than starting it again.
+type operation struct {
+	fingerprint string
+
+	mu sync.Mutex
+	// values holds the responses of the operation starting at index base.
+	// Once the operation is done only the final response is kept.
+	values  []any
+	base    int
+	done    bool
+	changed chan struct{}
+	expires time.Time
+
+	// followers is the number of requests following the operation, which
+	// is canceled operationGrace after the last of them goes away
+	followers int
+	cancel    context.CancelFunc
+	orphaned  *time.Timer
+}
+
+// run sends the responses of fn to the operation until fn returns.
+func (op *operation) run(ctx context.Context, fn func(context.Context, chan<- any)) {
+	src := make(chan any)
+	go func() {
+		defer close(src)
+		fn(ctx, src)
+	}()
+
+	for v := range src {
+		op.mu.Lock()
+		op.values = append(op.values, v)
+		if n := len(op.values); n > operationBacklog {
+			op.values = op.values[n-operationBacklog:]
+			op.base += n - operationBacklog
+		}
+		close(op.changed)
+		op.changed = make(chan struct{})
+		op.mu.Unlock()
+	}
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if n := len(op.values); n > 1 {
+		op.values = op.values[n-1:]
+		op.base += n - 1
+	}
+	op.done = true
+	op.expires = time.Now().Add(operationTTL)
+	if op.orphaned != nil {
+		op.orphaned.Stop()
+	}
+	close(op.changed)
+}
+
+// attach counts a request following the operation until ctx is done.
+func (op *operation) attach(ctx context.Context) {
+	op.mu.Lock()
+	op.followers++
+	if op.orphaned != nil {
+		op.orphaned.Stop()
+		op.orphaned = nil
+	}
+	op.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		op.mu.Lock()
+		defer op.mu.Unlock()
+		op.followers--
+		if op.followers > 0 || op.done || op.cancel == nil {
+			return
+		}
+
+		op.orphaned = time.AfterFunc(operationGrace, func() {
+			op.mu.Lock()
+			defer op.mu.Unlock()
+			if op.followers == 0 && !op.done {
+				op.cancel()
+			}
+		})
+	})
+}
+
+// failed reports whether a done operation ended with an error.
+func (op *operation) failed() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if len(op.values) == 0 {
+		return false
+	}
+
+	h, ok := op.values[len(op.values)-1].(gin.H)
+	return ok && h["error"] != nil
+}
+
+// follow returns a channel of the responses of the operation starting at
+// index next. The channel is closed when the operation is done or ctx is
+// canceled.
+func (op *operation) follow(ctx context.Context, next int) chan any {
+	ch := make(chan any)
+	go func() {
+		defer close(ch)
+		for {
+			op.mu.Lock()
+			next = max(next, op.base)
+			var v any
+			ok := next < op.base+len(op.values)
+			if ok {
+				v = op.values[next-op.base]
+			}
+			done, changed := op.done, op.changed
+			op.mu.Unlock()
+
+			if ok {
+				select {
+				case ch <- v:
+					next++
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if done {
+				return
+			}
+
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// operationStore tracks operations by their Idempotency-Key.
+type operationStore struct {
+	mu  sync.Mutex
+	ops map[string]*operation
+}
+
+func newOperationStore() *operationStore {
+	return &operationStore{ops: make(map[string]*operation)}
+}
+
+// startOperation runs fn in the background and returns a channel of its
+// responses, closed once fn returns. Requests with an Idempotency-Key header
+// matching an in-flight or recently completed operation for the same
+// request receive the latest responses of that operation instead of running
+// fn again. Operations that fail are forgotten so that they can be retried,
+// and operations no request follows for operationGrace are canceled.
+//
+// If the key was used for a different request, startOperation aborts the
+// request and returns false.
+func (s *Server) startOperation(c *gin.Context, req any, fn func(context.Context, chan<- any)) (chan any, bool) {
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" || s.operations == nil {
+		ch := make(chan any)
+		go func() {
+			defer close(ch)
+			fn(c.Request.Context(), ch)
+		}()
+		return ch, true
+	}
+
+	bts, err := json.Marshal(req)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	sha256sum := sha256.Sum256(append([]byte(c.Request.Method+" "+c.FullPath()+"\n"), bts...))
+	fingerprint := hex.EncodeToString(sha256sum[:])
+
+	st := s.operations
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	now := time.Now()
+	for k, op := range st.ops {
+		op.mu.Lock()
+		expired := op.done && now.After(op.expires)
+		op.mu.Unlock()
+		if expired {
+			delete(st.ops, k)
+		}
+	}
+
+	if op, ok := st.ops[key]; ok {
+		if op.fingerprint != fingerprint {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			return nil, false
+		}
+
+		// attach to the latest response of the existing operation
+		op.mu.Lock()
+		next := op.base + max(len(op.values)-1, 0)
+		op.mu.Unlock()
+
+		c.Header("Idempotent-Replayed", "true")
+		op.attach(c.Request.Context())
+		return op.follow(c.Request.Context(), next), true
+	}
+
+	// the operation outlives the request so that retries can attach to it
+	ctx, cancel := context.WithCancel(context.WithoutCancel(c.Request.Context()))
+	op := &operation{fingerprint: fingerprint, changed: make(chan struct{}), cancel: cancel}
+	st.ops[key] = op
+	op.attach(c.Request.Context())
+
+	go func() {
+		defer cancel()
+		op.run(ctx, fn)
+		if op.failed() {
+			st.mu.Lock()
+			if st.ops[key] == op {
+				delete(st.ops, key)
+			}
+			st.mu.Unlock()
+		}
+	}()
+
+	return op.follow(c.Request.Context(), 0), true
+}
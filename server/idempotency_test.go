@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestStartOperation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := Server{operations: newOperationStore()}
+
+	newContext := func(key string) (*gin.Context, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/pull", nil)
+		c.Request.Header.Set("Idempotency-Key", key)
+		return c, w
+	}
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+	pull := func(ctx context.Context, ch chan<- any) {
+		calls.Add(1)
+		ch <- api.ProgressResponse{Status: "pulling manifest"}
+		close(started)
+		<-release
+		ch <- api.ProgressResponse{Status: "success"}
+	}
+
+	req := api.PullRequest{Model: "test"}
+	c, _ := newContext("abc")
+	first, ok := s.startOperation(c, req, pull)
+	if !ok {
+		t.Fatal("expected operation to start")
+	}
+
+	<-started
+	if got := (<-first).(api.ProgressResponse); got.Status != "pulling manifest" {
+		t.Errorf("unexpected response %v", got)
+	}
+
+	t.Run("in flight", func(t *testing.T) {
+		c, _ := newContext("abc")
+		ch, ok := s.startOperation(c, req, pull)
+		if !ok {
+			t.Fatal("expected to attach to operation")
+		}
+
+		if got := (<-ch).(api.ProgressResponse); got.Status != "pulling manifest" {
+			t.Errorf("unexpected response %v", got)
+		}
+
+		close(release)
+		if got := (<-ch).(api.ProgressResponse); got.Status != "success" {
+			t.Errorf("unexpected response %v", got)
+		}
+
+		if _, ok := <-ch; ok {
+			t.Error("expected channel to be closed")
+		}
+
+		if got := (<-first).(api.ProgressResponse); got.Status != "success" {
+			t.Errorf("unexpected response %v", got)
+		}
+	})
+
+	t.Run("completed", func(t *testing.T) {
+		c, _ := newContext("abc")
+		ch, ok := s.startOperation(c, req, pull)
+		if !ok {
+			t.Fatal("expected to attach to operation")
+		}
+
+		var responses []any
+		for resp := range ch {
+			responses = append(responses, resp)
+		}
+
+		if len(responses) != 1 || responses[0].(api.ProgressResponse).Status != "success" {
+			t.Errorf("unexpected responses %v", responses)
+		}
+
+		if calls.Load() != 1 {
+			t.Errorf("expected 1 call, got %d", calls.Load())
+		}
+	})
+
+	t.Run("different request", func(t *testing.T) {
+		c, w := newContext("abc")
+		if _, ok := s.startOperation(c, api.PullRequest{Model: "other"}, pull); ok {
+			t.Fatal("expected operation to be rejected")
+		}
+
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected status 422, got %d", w.Code)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		var calls atomic.Int32
+		fail := func(ctx context.Context, ch chan<- any) {
+			calls.Add(1)
+			ch <- gin.H{"error": "boom"}
+		}
+
+		for range 2 {
+			c, _ := newContext("def")
+			ch, ok := s.startOperation(c, req, fail)
+			if !ok {
+				t.Fatal("expected operation to start")
+			}
+
+			for range ch {
+			}
+
+			// failed operations are forgotten asynchronously
+			deadline := time.Now().Add(time.Second)
+			for time.Now().Before(deadline) {
+				s.operations.mu.Lock()
+				_, ok := s.operations.ops["def"]
+				s.operations.mu.Unlock()
+				if !ok {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		if calls.Load() != 2 {
+			t.Errorf("expected failed operation to run again, got %d calls", calls.Load())
+		}
+	})
+}
+
+func TestStartOperationAbandoned(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := Server{operations: newOperationStore()}
+
+	grace := operationGrace
+	operationGrace = 10 * time.Millisecond
+	t.Cleanup(func() { operationGrace = grace })
+
+	canceled := make(chan struct{})
+	pull := func(ctx context.Context, ch chan<- any) {
+		<-ctx.Done()
+		close(canceled)
+		ch <- gin.H{"error": ctx.Err().Error()}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequestWithContext(ctx, http.MethodPost, "/api/pull", nil)
+	c.Request.Header.Set("Idempotency-Key", "abc")
+	if _, ok := s.startOperation(c, api.PullRequest{Model: "test"}, pull); !ok {
+		t.Fatal("expected operation to start")
+	}
+
+	// the operation keeps running while the request follows it
+	select {
+	case <-canceled:
+		t.Fatal("expected the operation to keep running")
+	case <-time.After(5 * operationGrace):
+	}
+
+	cancel()
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the operation to be canceled once no request follows it")
+	}
+}
+
+func TestOperationBacklog(t *testing.T) {
+	op := &operation{changed: make(chan struct{})}
+	op.run(context.Background(), func(ctx context.Context, ch chan<- any) {
+		for i := range 2 * operationBacklog {
+			ch <- i
+
+			op.mu.Lock()
+			n := len(op.values)
+			op.mu.Unlock()
+			if n > operationBacklog {
+				t.Errorf("expected at most %d responses kept, got %d", operationBacklog, n)
+			}
+		}
+	})
+
+	var got []any
+	for v := range op.follow(context.Background(), 0) {
+		got = append(got, v)
+	}
+
+	if len(got) != 1 || got[0] != 2*operationBacklog-1 {
+		t.Errorf("expected only the last response, got %v", got)
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idleTimer calls a function once the server has gone a period without
+// requests, so that a socket activated server exits when it is no longer
+// used and the next connection starts it again.
+type idleTimer struct {
+	d time.Duration
+
+	mu       sync.Mutex
+	inflight int
+	timer    *time.Timer
+}
+
+func newIdleTimer(d time.Duration, fn func()) *idleTimer {
+	return &idleTimer{d: d, timer: time.AfterFunc(d, fn)}
+}
+
+// middleware stops the timer while a request is in flight. Streamed
+// responses count as in flight until the last chunk is written.
+func (t *idleTimer) middleware(c *gin.Context) {
+	t.mu.Lock()
+	t.inflight++
+	t.timer.Stop()
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		t.inflight--
+		if t.inflight == 0 {
+			t.timer.Reset(t.d)
+		}
+	}()
+
+	c.Next()
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdleTimer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	idle := make(chan struct{}, 1)
+	timer := newIdleTimer(50*time.Millisecond, func() {
+		select {
+		case idle <- struct{}{}:
+		default:
+		}
+	})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	r := gin.New()
+	r.Use(timer.middleware)
+	r.GET("/", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+
+	<-started
+
+	// the timer may have fired before the request; it does not fire again
+	// while the request is in flight
+	select {
+	case <-idle:
+	default:
+	}
+
+	select {
+	case <-idle:
+		t.Fatal("timer fired during a request")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(release)
+	<-done
+
+	select {
+	case <-idle:
+	case <-time.After(time.Second):
+		t.Fatal("timer did not fire after the request")
+	}
+}
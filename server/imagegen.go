@@ -0,0 +1,351 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/types/model"
+)
+
+// diffusionTensorPrefix starts the names of the tensors of the denoising
+// model in the GGUF files of stable-diffusion.cpp
+const diffusionTensorPrefix = "model.diffusion_model."
+
+const (
+	defaultImageSize  = "512x512"
+	defaultImageSteps = 20
+	maxImageSide      = 2048
+)
+
+var (
+	errImageSize          = fmt.Errorf("size must be WIDTHxHEIGHT in multiples of 64 up to %d", maxImageSide)
+	errNoDiffusionRunner  = errors.New("image generation requires stable-diffusion.cpp: install its sd executable in the PATH or set OLLAMA_DIFFUSION_RUNNER to it")
+	diffusionStepProgress = regexp.MustCompile(`\|\s*(\d+)/(\d+)\s*-`)
+)
+
+// imageGeneration lets one image be generated at a time. Images are
+// generated outside the scheduler so their memory isn't accounted for next
+// to the models it loads.
+var imageGeneration = make(chan struct{}, 1)
+
+// isDiffusion reports whether ggml is a diffusion model.
+func isDiffusion(ggml *llm.GGML) bool {
+	for _, t := range ggml.Tensors().Items {
+		if strings.HasPrefix(t.Name, diffusionTensorPrefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseImageSize parses a size of the form WIDTHxHEIGHT.
+func parseImageSize(s string) (width, height int, err error) {
+	w, h, ok := strings.Cut(cmp.Or(s, defaultImageSize), "x")
+	if !ok {
+		return 0, 0, errImageSize
+	}
+
+	width, err = strconv.Atoi(w)
+	if err != nil {
+		return 0, 0, errImageSize
+	}
+
+	height, err = strconv.Atoi(h)
+	if err != nil {
+		return 0, 0, errImageSize
+	}
+
+	for _, n := range []int{width, height} {
+		if n <= 0 || n > maxImageSide || n%64 != 0 {
+			return 0, 0, errImageSize
+		}
+	}
+
+	return width, height, nil
+}
+
+// diffusionRunner returns the path of the stable-diffusion.cpp executable.
+func diffusionRunner() (string, error) {
+	if p := envconfig.DiffusionRunner(); p != "" {
+		return p, nil
+	}
+
+	p, err := exec.LookPath("sd")
+	if err != nil {
+		return "", errNoDiffusionRunner
+	}
+
+	return p, nil
+}
+
+// scanProgressLines splits output into lines, which progress bars end with
+// a carriage return rather than a newline.
+func scanProgressLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+type imageParams struct {
+	prompt, negativePrompt string
+	width, height, steps   int
+	seed                   int64
+	preview                bool
+}
+
+// generateImage runs the stable-diffusion.cpp executable runner on the model
+// at modelPath and returns the PNG image. fn is called as each sampling step
+// completes, with a preview of the image if requested.
+func generateImage(ctx context.Context, runner, modelPath string, p imageParams, fn func(completed, total int, preview []byte)) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "ollama-image")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "image.png")
+	preview := filepath.Join(dir, "preview.png")
+
+	args := []string{
+		"--model", modelPath,
+		"--prompt", p.prompt,
+		"--width", strconv.Itoa(p.width),
+		"--height", strconv.Itoa(p.height),
+		"--steps", strconv.Itoa(p.steps),
+		"--seed", strconv.FormatInt(p.seed, 10),
+		"--output", output,
+	}
+
+	if p.negativePrompt != "" {
+		args = append(args, "--negative-prompt", p.negativePrompt)
+	}
+
+	if p.preview {
+		args = append(args, "--preview", "proj", "--preview-path", preview)
+	}
+
+	pr, pw := io.Pipe()
+	cmd := exec.CommandContext(ctx, runner, args...)
+	cmd.Stdout, cmd.Stderr = pw, pw
+
+	slog.DebugContext(ctx, "generating image", "runner", runner, "args", args)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		pw.CloseWithError(cmd.Wait())
+	}()
+
+	var last string
+	var completed int
+	var previewed []byte
+	scanner := bufio.NewScanner(pr)
+	scanner.Split(scanProgressLines)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		m := diffusionStepProgress.FindStringSubmatch(line)
+		if m == nil {
+			last = line
+			continue
+		}
+
+		n, _ := strconv.Atoi(m[1])
+		total, _ := strconv.Atoi(m[2])
+
+		// loading the model and decoding the image report their progress too
+		if total != p.steps || n <= completed {
+			continue
+		}
+
+		completed = n
+
+		// the runner may already be rewriting the preview for the next
+		// step, so keep the last one read whole
+		if p.preview {
+			if bts, err := os.ReadFile(preview); err == nil && len(bts) > 0 {
+				previewed = bts
+			}
+		}
+
+		fn(completed, total, previewed)
+	}
+
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if last != "" {
+			return nil, fmt.Errorf("%w: %s", err, last)
+		}
+
+		return nil, err
+	}
+
+	return os.ReadFile(output)
+}
+
+// ImageGenerateHandler generates an image with a diffusion model. It is
+// experimental: images are generated by stable-diffusion.cpp rather than a
+// runner of the scheduler, one at a time.
+func (s *Server) ImageGenerateHandler(c *gin.Context) {
+	checkpointStart := time.Now()
+	var req api.ImageGenerateRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	width, height, err := parseImageSize(req.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Steps < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "steps must be positive"})
+		return
+	}
+
+	name, err := resolveName(model.ParseName(req.Model))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+
+	if err := s.acl.check(c.Request.Context(), aclRun, name); err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	m, err := GetModel(name.String())
+	if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	if err := m.CheckCapabilities(CapabilityImage); err != nil {
+		handleScheduleError(c, req.Model, fmt.Errorf("%s %w", req.Model, err))
+		return
+	}
+
+	runner, err := diffusionRunner()
+	if err != nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+		return
+	}
+
+	p := imageParams{
+		prompt:         req.Prompt,
+		negativePrompt: req.NegativePrompt,
+		width:          width,
+		height:         height,
+		steps:          cmp.Or(req.Steps, defaultImageSteps),
+		seed:           rand.Int64N(1 << 31),
+		preview:        req.Preview,
+	}
+
+	if req.Seed != nil {
+		p.seed = *req.Seed
+	}
+
+	ch := make(chan any)
+	go func() {
+		defer close(ch)
+
+		ctx := c.Request.Context()
+		select {
+		case imageGeneration <- struct{}{}:
+			defer func() { <-imageGeneration }()
+		case <-ctx.Done():
+			ch <- gin.H{"error": ctx.Err().Error()}
+			return
+		}
+
+		image, err := generateImage(ctx, runner, m.ModelPath, p, func(completed, total int, preview []byte) {
+			ch <- api.ImageGenerateResponse{
+				Model:     req.Model,
+				CreatedAt: time.Now().UTC(),
+				Completed: completed,
+				Total:     total,
+				Preview:   preview,
+			}
+		})
+		if err != nil {
+			ch <- gin.H{"error": err.Error()}
+			return
+		}
+
+		ch <- api.ImageGenerateResponse{
+			Model:         req.Model,
+			CreatedAt:     time.Now().UTC(),
+			Completed:     p.steps,
+			Total:         p.steps,
+			Image:         image,
+			Seed:          p.seed,
+			Done:          true,
+			TotalDuration: time.Since(checkpointStart),
+		}
+	}()
+
+	if req.Stream != nil && !*req.Stream {
+		var r api.ImageGenerateResponse
+		for rr := range ch {
+			switch t := rr.(type) {
+			case api.ImageGenerateResponse:
+				r = t
+			case gin.H:
+				msg, ok := t["error"].(string)
+				if !ok {
+					msg = "unexpected error format in response"
+				}
+
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "unexpected response"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, r)
+		return
+	}
+
+	streamResponse(c, ch)
+}
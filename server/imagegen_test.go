@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+)
+
+// fakeDiffusionRunner prints progress like stable-diffusion.cpp, writing a
+// preview per step and the image
+const fakeDiffusionRunner = `#!/bin/sh
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --prompt) prompt="$2"; shift ;;
+    --output) output="$2"; shift ;;
+    --preview-path) preview="$2"; shift ;;
+  esac
+  shift
+done
+
+if [ "$prompt" = "fail" ]; then
+  echo "[ERROR] failed to load model"
+  exit 1
+fi
+
+printf '  |==================================================| 10/10 - 100.00it/s\n'
+for i in 1 2 3 4; do
+  [ -n "$preview" ] && printf "preview $i" > "$preview.tmp" && mv "$preview.tmp" "$preview"
+  printf "\r  |============>                                     | $i/4 - 1.00s/it"
+done
+printf '\n'
+printf 'image' > "$output"
+`
+
+func TestParseImageSize(t *testing.T) {
+	cases := []struct {
+		size          string
+		width, height int
+		err           error
+	}{
+		{"", 512, 512, nil},
+		{"1024x768", 1024, 768, nil},
+		{"512", 0, 0, errImageSize},
+		{"500x500", 0, 0, errImageSize},
+		{"4096x512", 0, 0, errImageSize},
+		{"-64x64", 0, 0, errImageSize},
+	}
+
+	for _, tt := range cases {
+		width, height, err := parseImageSize(tt.size)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%q: expected error %v, got %v", tt.size, tt.err, err)
+		}
+
+		if width != tt.width || height != tt.height {
+			t.Errorf("%q: expected %dx%d, got %dx%d", tt.size, tt.width, tt.height, width, height)
+		}
+	}
+}
+
+func TestImageGenerate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake runner is a shell script")
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	var s Server
+
+	runner := filepath.Join(t.TempDir(), "sd")
+	if err := os.WriteFile(runner, []byte(fakeDiffusionRunner), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OLLAMA_DIFFUSION_RUNNER", runner)
+
+	_, digest := createBinFile(t, llm.KV{}, []llm.Tensor{
+		{Name: "model.diffusion_model.out.2.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+	})
+
+	stream := false
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "diffusion",
+		Files:  map[string]string{"diffusion.gguf": digest},
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		w := createRequest(t, s.ImageGenerateHandler, api.ImageGenerateRequest{
+			Model:   "diffusion",
+			Prompt:  "a llama",
+			Steps:   4,
+			Preview: true,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var got []api.ImageGenerateResponse
+		dec := json.NewDecoder(w.Body)
+		for dec.More() {
+			var r api.ImageGenerateResponse
+			if err := dec.Decode(&r); err != nil {
+				t.Fatal(err)
+			}
+
+			got = append(got, r)
+		}
+
+		if len(got) != 5 {
+			t.Fatalf("expected 5 responses, got %d", len(got))
+		}
+
+		for i, r := range got[:4] {
+			if r.Completed != i+1 || r.Total != 4 || !strings.HasPrefix(string(r.Preview), "preview ") || r.Done {
+				t.Errorf("unexpected progress %d: %+v", i, r)
+			}
+		}
+
+		if last := got[4]; !last.Done || string(last.Image) != "image" {
+			t.Errorf("unexpected final response %+v", last)
+		}
+	})
+
+	t.Run("no stream", func(t *testing.T) {
+		seed := int64(42)
+		w := createRequest(t, s.ImageGenerateHandler, api.ImageGenerateRequest{
+			Model:  "diffusion",
+			Prompt: "a llama",
+			Seed:   &seed,
+			Stream: &stream,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var r api.ImageGenerateResponse
+		if err := json.NewDecoder(w.Body).Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff([]any{r.Done, string(r.Image), r.Seed, r.Preview}, []any{true, "image", int64(42), api.ImageData(nil)}); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("runner error", func(t *testing.T) {
+		w := createRequest(t, s.ImageGenerateHandler, api.ImageGenerateRequest{
+			Model:  "diffusion",
+			Prompt: "fail",
+			Stream: &stream,
+		})
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("expected status 500, got %d", w.Code)
+		}
+
+		if !strings.Contains(w.Body.String(), "failed to load model") {
+			t.Errorf("unexpected error %s", w.Body.String())
+		}
+	})
+
+	t.Run("bad size", func(t *testing.T) {
+		w := createRequest(t, s.ImageGenerateHandler, api.ImageGenerateRequest{
+			Model: "diffusion",
+			Size:  "100x100",
+		})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("not a diffusion model", func(t *testing.T) {
+		_, digest := createBinFile(t, llm.KV{"general.architecture": "llama"}, []llm.Tensor{
+			{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		})
+
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:  "text",
+			Files:  map[string]string{"text.gguf": digest},
+			Stream: &stream,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		w = createRequest(t, s.ImageGenerateHandler, api.ImageGenerateRequest{Model: "text"})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(w.Body.String(), `{"error":"text does not support image generation"}`); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("no runner", func(t *testing.T) {
+		t.Setenv("OLLAMA_DIFFUSION_RUNNER", "")
+		t.Setenv("PATH", "")
+
+		w := createRequest(t, s.ImageGenerateHandler, api.ImageGenerateRequest{Model: "diffusion"})
+		if w.Code != http.StatusNotImplemented {
+			t.Fatalf("expected status 501, got %d", w.Code)
+		}
+	})
+}
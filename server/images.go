@@ -11,6 +11,7 @@ import (
 	"io"
 	"log"
 	"log/slog"
+	"maps"
 	"net"
 	"net/http"
 	"net/url"
@@ -31,18 +32,24 @@ import (
 )
 
 var (
-	errCapabilities         = errors.New("does not support")
-	errCapabilityCompletion = errors.New("completion")
-	errCapabilityTools      = errors.New("tools")
-	errCapabilityInsert     = errors.New("insert")
+	errCapabilities             = errors.New("does not support")
+	errCapabilityCompletion     = errors.New("completion")
+	errCapabilityTools          = errors.New("tools")
+	errCapabilityInsert         = errors.New("insert")
+	errCapabilityClassification = errors.New("classification")
+	errCapabilityVision         = errors.New("vision")
+	errCapabilityImage          = errors.New("image generation")
 )
 
 type Capability string
 
 const (
-	CapabilityCompletion = Capability("completion")
-	CapabilityTools      = Capability("tools")
-	CapabilityInsert     = Capability("insert")
+	CapabilityCompletion     = Capability("completion")
+	CapabilityTools          = Capability("tools")
+	CapabilityInsert         = Capability("insert")
+	CapabilityClassification = Capability("classification")
+	CapabilityVision         = Capability("vision")
+	CapabilityImage          = Capability("image")
 )
 
 type registryOptions struct {
@@ -62,11 +69,14 @@ type Model struct {
 	ParentModel    string
 	AdapterPaths   []string
 	ProjectorPaths []string
+	TokenizerPath  string
 	System         string
 	License        []string
 	Digest         string
 	Options        map[string]interface{}
+	Profiles       map[string]map[string]any
 	Messages       []api.Message
+	Router         *api.Router
 
 	Template *template.Template
 }
@@ -104,6 +114,45 @@ func (m *Model) CheckCapabilities(caps ...Capability) error {
 			if !slices.Contains(vars, "suffix") {
 				errs = append(errs, errCapabilityInsert)
 			}
+		case CapabilityClassification:
+			f, err := os.Open(m.ModelPath)
+			if err != nil {
+				slog.Error("couldn't open model file", "error", err)
+				continue
+			}
+			defer f.Close()
+
+			ggml, _, err := llm.DecodeGGML(f, 0)
+			if err != nil {
+				slog.Error("couldn't decode ggml", "error", err)
+				continue
+			}
+
+			if !ggml.KV().HasClassifier() {
+				errs = append(errs, errCapabilityClassification)
+			}
+		case CapabilityVision:
+			// images are embedded by a projector
+			if len(m.ProjectorPaths) == 0 {
+				errs = append(errs, errCapabilityVision)
+			}
+		case CapabilityImage:
+			f, err := os.Open(m.ModelPath)
+			if err != nil {
+				slog.Error("couldn't open model file", "error", err)
+				continue
+			}
+			defer f.Close()
+
+			ggml, _, err := llm.DecodeGGML(f, 0)
+			if err != nil {
+				slog.Error("couldn't decode ggml", "error", err)
+				continue
+			}
+
+			if !isDiffusion(ggml) {
+				errs = append(errs, errCapabilityImage)
+			}
 		default:
 			slog.Error("unknown capability", "capability", cap)
 			return fmt.Errorf("unknown capability: %s", cap)
@@ -120,10 +169,24 @@ func (m *Model) CheckCapabilities(caps ...Capability) error {
 func (m *Model) String() string {
 	var modelfile parser.Modelfile
 
-	modelfile.Commands = append(modelfile.Commands, parser.Command{
-		Name: "model",
-		Args: m.ModelPath,
-	})
+	if m.Router != nil {
+		modelfile.Commands = append(modelfile.Commands, parser.Command{
+			Name: "router",
+			Args: m.Router.Classifier,
+		})
+
+		for _, label := range slices.Sorted(maps.Keys(m.Router.Routes)) {
+			modelfile.Commands = append(modelfile.Commands, parser.Command{
+				Name: "route",
+				Args: label + " " + m.Router.Routes[label],
+			})
+		}
+	} else {
+		modelfile.Commands = append(modelfile.Commands, parser.Command{
+			Name: "model",
+			Args: m.ModelPath,
+		})
+	}
 
 	for _, adapter := range m.AdapterPaths {
 		modelfile.Commands = append(modelfile.Commands, parser.Command{
@@ -139,6 +202,13 @@ func (m *Model) String() string {
 		})
 	}
 
+	if m.TokenizerPath != "" {
+		modelfile.Commands = append(modelfile.Commands, parser.Command{
+			Name: "tokenizer",
+			Args: m.TokenizerPath,
+		})
+	}
+
 	if m.Template != nil {
 		modelfile.Commands = append(modelfile.Commands, parser.Command{
 			Name: "template",
@@ -170,6 +240,25 @@ func (m *Model) String() string {
 		}
 	}
 
+	for profile, params := range m.Profiles {
+		for k, v := range params {
+			switch v := v.(type) {
+			case []any:
+				for _, s := range v {
+					modelfile.Commands = append(modelfile.Commands, parser.Command{
+						Name: "profile",
+						Args: fmt.Sprintf("%s %s %v", profile, k, s),
+					})
+				}
+			default:
+				modelfile.Commands = append(modelfile.Commands, parser.Command{
+					Name: "profile",
+					Args: fmt.Sprintf("%s %s %v", profile, k, v),
+				})
+			}
+		}
+	}
+
 	for _, license := range m.License {
 		modelfile.Commands = append(modelfile.Commands, parser.Command{
 			Name: "license",
@@ -194,6 +283,10 @@ type ConfigV2 struct {
 	ModelType     string   `json:"model_type"`
 	FileType      string   `json:"file_type"`
 
+	// KeepAlive is how long the model stays loaded after a request that
+	// doesn't set keep_alive, overriding OLLAMA_KEEP_ALIVE.
+	KeepAlive *api.Duration `json:"keep_alive,omitempty"`
+
 	// required by spec
 	Architecture string `json:"architecture"`
 	OS           string `json:"os"`
@@ -276,6 +369,8 @@ func GetModel(name string) (*Model, error) {
 			model.AdapterPaths = append(model.AdapterPaths, filename)
 		case "application/vnd.ollama.image.projector":
 			model.ProjectorPaths = append(model.ProjectorPaths, filename)
+		case "application/vnd.ollama.image.tokenizer":
+			model.TokenizerPath = filename
 		case "application/vnd.ollama.image.prompt",
 			"application/vnd.ollama.image.template":
 			bts, err := os.ReadFile(filename)
@@ -305,6 +400,26 @@ func GetModel(name string) (*Model, error) {
 			if err = json.NewDecoder(params).Decode(&model.Options); err != nil {
 				return nil, err
 			}
+		case "application/vnd.ollama.image.profiles":
+			profiles, err := os.Open(filename)
+			if err != nil {
+				return nil, err
+			}
+			defer profiles.Close()
+
+			if err = json.NewDecoder(profiles).Decode(&model.Profiles); err != nil {
+				return nil, err
+			}
+		case "application/vnd.ollama.image.router":
+			router, err := os.Open(filename)
+			if err != nil {
+				return nil, err
+			}
+			defer router.Close()
+
+			if err = json.NewDecoder(router).Decode(&model.Router); err != nil {
+				return nil, err
+			}
 		case "application/vnd.ollama.image.messages":
 			msgs, err := os.Open(filename)
 			if err != nil {
@@ -335,6 +450,12 @@ func CopyModel(src, dst model.Name) error {
 		return model.Unqualified(src)
 	}
 
+	if src.HasDigest() {
+		if _, err := ParseNamedManifest(src); err != nil {
+			return err
+		}
+	}
+
 	if src.Filepath() == dst.Filepath() {
 		return nil
 	}
@@ -344,26 +465,12 @@ func CopyModel(src, dst model.Name) error {
 		return err
 	}
 
-	dstpath := filepath.Join(manifests, dst.Filepath())
-	if err := os.MkdirAll(filepath.Dir(dstpath), 0o755); err != nil {
-		return err
-	}
-
-	srcpath := filepath.Join(manifests, src.Filepath())
-	srcfile, err := os.Open(srcpath)
+	b, err := os.ReadFile(filepath.Join(manifests, src.Filepath()))
 	if err != nil {
 		return err
 	}
-	defer srcfile.Close()
 
-	dstfile, err := os.Create(dstpath)
-	if err != nil {
-		return err
-	}
-	defer dstfile.Close()
-
-	_, err = io.Copy(dstfile, srcfile)
-	return err
+	return writeManifestFile(filepath.Join(manifests, dst.Filepath()), b)
 }
 
 func deleteUnusedLayers(deleteMap map[string]struct{}) error {
@@ -488,6 +595,10 @@ func PushModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 		return err
 	}
 
+	if isHuggingFace(mp.Registry) {
+		return pushHuggingFace(ctx, mp, manifest, fn)
+	}
+
 	var layers []Layer
 	layers = append(layers, manifest.Layers...)
 	if manifest.Config.Digest != "" {
@@ -607,11 +718,7 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 	if err != nil {
 		return err
 	}
-	if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
-		return err
-	}
-
-	err = os.WriteFile(fp, manifestJSON, 0o644)
+	err = writeManifestFile(fp, manifestJSON)
 	if err != nil {
 		slog.Info(fmt.Sprintf("couldn't write to %s", fp))
 		return err
@@ -633,18 +740,38 @@ func pullModelManifest(ctx context.Context, mp ModelPath, regOpts *registryOptio
 	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "manifests", mp.Tag)
 
 	headers := make(http.Header)
-	headers.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+	headers.Set("Accept", strings.Join([]string{manifestMediaType, manifestListMediaType, imageIndexMediaType}, ", "))
 	resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, headers, nil, regOpts)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	bts, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
 	var m Manifest
-	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+	if err := json.Unmarshal(bts, &m); err != nil {
 		return nil, err
 	}
 
+	// a tag with a manifest list resolves to the manifest for this host
+	if m.MediaType == manifestListMediaType || m.MediaType == imageIndexMediaType {
+		var l ManifestList
+		if err := json.Unmarshal(bts, &l); err != nil {
+			return nil, err
+		}
+
+		d, err := l.resolve(hostPlatform())
+		if err != nil {
+			return nil, err
+		}
+
+		return pullPlatformManifest(ctx, mp, d, regOpts)
+	}
+
 	return &m, err
 }
 
@@ -677,12 +804,9 @@ func makeRequestWithRetry(ctx context.Context, method string, requestURL *url.UR
 			resp.Body.Close()
 
 			// Handle authentication error with one retry
-			challenge := parseRegistryChallenge(resp.Header.Get("www-authenticate"))
-			token, err := getAuthorizationToken(ctx, challenge)
-			if err != nil {
+			if err := authenticate(ctx, requestURL, resp.Header.Get("www-authenticate"), regOpts); err != nil {
 				return nil, err
 			}
-			regOpts.Token = token
 			if body != nil {
 				_, err = body.Seek(0, io.SeekStart)
 				if err != nil {
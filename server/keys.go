@@ -0,0 +1,188 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+// keySuffix is how many of the last characters of keys are listed
+const keySuffix = 4
+
+// adminStatus returns the HTTP status of an error returned by
+// [accessList.checkAdmin] or [accessList.update].
+func adminStatus(err error) int {
+	if status := aclStatus(err); status != 0 {
+		return status
+	}
+
+	if errors.Is(err, errACLDisabled) {
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
+
+// ListKeysHandler lists the users of the API keys.
+func (s *Server) ListKeysHandler(c *gin.Context) {
+	if s.acl == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errACLDisabled.Error()})
+		return
+	}
+
+	if err := s.acl.checkAdmin(c.Request.Context()); err != nil {
+		c.AbortWithStatusJSON(adminStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	s.acl.mu.Lock()
+	users := s.acl.config.Users
+	s.acl.mu.Unlock()
+
+	resp := api.ListKeysResponse{Users: []api.APIKeyUser{}}
+	for _, u := range users {
+		var keys []string
+		for _, key := range u.Keys {
+			keys = append(keys, "..."+key[max(0, len(key)-keySuffix):])
+		}
+
+		resp.Users = append(resp.Users, api.APIKeyUser{
+			Name:              u.Name,
+			Keys:              keys,
+			Run:               u.Run,
+			Pull:              u.Pull,
+			Delete:            u.Delete,
+			Admin:             u.Admin,
+			RequestsPerMinute: u.RequestsPerMinute,
+			TokensPerMinute:   u.TokensPerMinute,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateKeyHandler creates a key for a user, creating the user or replacing
+// what they may do.
+func (s *Server) CreateKeyHandler(c *gin.Context) {
+	if err := s.acl.checkAdmin(c.Request.Context()); err != nil {
+		c.AbortWithStatusJSON(adminStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	var req api.APIKeyUser
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	if req.RequestsPerMinute < 0 || req.TokensPerMinute < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "rate limits must not be negative"})
+		return
+	}
+
+	key, err := newKey()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.acl.update(func(users []*aclUser) []*aclUser {
+		u := &aclUser{
+			Name:              req.Name,
+			Keys:              []string{key},
+			Run:               req.Run,
+			Pull:              req.Pull,
+			Delete:            req.Delete,
+			Admin:             req.Admin,
+			RequestsPerMinute: req.RequestsPerMinute,
+			TokensPerMinute:   req.TokensPerMinute,
+		}
+
+		i := slices.IndexFunc(users, func(u *aclUser) bool { return u.Name == req.Name })
+		if i < 0 {
+			return append(users, u)
+		}
+
+		// users are shared with requests in flight, so they are replaced
+		// rather than changed
+		u.Keys = append(slices.Clone(users[i].Keys), key)
+		users[i] = u
+		return users
+	}); err != nil {
+		c.AbortWithStatusJSON(adminStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "created API key", "user", req.Name)
+	c.JSON(http.StatusOK, api.CreateKeyResponse{Name: req.Name, Key: key})
+}
+
+// DeleteKeyHandler deletes a key, or a user with all their keys.
+func (s *Server) DeleteKeyHandler(c *gin.Context) {
+	if err := s.acl.checkAdmin(c.Request.Context()); err != nil {
+		c.AbortWithStatusJSON(adminStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	var req api.DeleteKeyRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if (req.Name == "") == (req.Key == "") {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "either name or key is required"})
+		return
+	}
+
+	var found bool
+	if err := s.acl.update(func(users []*aclUser) []*aclUser {
+		var kept []*aclUser
+		for _, u := range users {
+			switch i := slices.Index(u.Keys, req.Key); {
+			case req.Name != "" && u.Name == req.Name:
+				found = true
+			case req.Key != "" && i >= 0:
+				found = true
+				// a user without keys would apply to requests without one
+				if len(u.Keys) > 1 {
+					updated := *u
+					updated.Keys = slices.Delete(slices.Clone(u.Keys), i, i+1)
+					kept = append(kept, &updated)
+				}
+			default:
+				kept = append(kept, u)
+			}
+		}
+
+		return kept
+	}); err != nil {
+		c.AbortWithStatusJSON(adminStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "deleted API key", "user", req.Name)
+	c.JSON(http.StatusOK, nil)
+}
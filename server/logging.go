@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/logutil"
+)
+
+// requestLogger gives each request an ID, the one in its X-Request-Id
+// header or else a new one, which the lines logged with its context have,
+// and logs the request once it is done.
+func requestLogger(c *gin.Context) {
+	start := time.Now()
+
+	id := c.GetHeader(logutil.RequestIDHeader)
+	if id == "" || len(id) > 128 {
+		id = uuid.NewString()
+		// handlers that return the ID, such as those of recoverable
+		// responses, find it in the header
+		c.Request.Header.Set(logutil.RequestIDHeader, id)
+	}
+
+	c.Header(logutil.RequestIDHeader, id)
+	c.Request = c.Request.WithContext(logutil.WithRequestID(c.Request.Context(), id))
+	c.Next()
+
+	slog.LogAttrs(c.Request.Context(), slog.LevelInfo, "request",
+		slog.String("method", c.Request.Method),
+		slog.String("path", c.Request.URL.Path),
+		slog.Int("status", c.Writer.Status()),
+		slog.Duration("latency", time.Since(start)),
+		slog.String("client", c.ClientIP()),
+	)
+}
+
+// LogLevelHandler returns the level the server logs at.
+func (s *Server) LogLevelHandler(c *gin.Context) {
+	if err := s.acl.checkAdmin(c.Request.Context()); err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.LogLevel{Level: strings.ToLower(logutil.Level.Level().String())})
+}
+
+// SetLogLevelHandler changes the level the server logs at until it
+// restarts.
+func (s *Server) SetLogLevelHandler(c *gin.Context) {
+	if err := s.acl.checkAdmin(c.Request.Context()); err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	var req api.LogLevel
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "level must be debug, info, warn or error"})
+		return
+	}
+
+	logutil.Level.Set(level)
+	slog.InfoContext(c.Request.Context(), "log level changed", "level", level)
+	c.JSON(http.StatusOK, api.LogLevel{Level: strings.ToLower(level.String())})
+}
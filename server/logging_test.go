@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/logutil"
+)
+
+func TestRequestLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_LOG_FORMAT", "json")
+
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	defer logutil.Level.Set(logutil.Level.Level())
+	slog.SetDefault(logutil.NewLogger(&buf, slog.LevelInfo))
+
+	_, router := gin.CreateTestContext(httptest.NewRecorder())
+	router.Use(requestLogger)
+	router.POST("/api/generate", func(c *gin.Context) {
+		slog.InfoContext(c.Request.Context(), "generating", "header", c.GetHeader(logutil.RequestIDHeader))
+		c.Status(http.StatusOK)
+	})
+
+	t.Run("given", func(t *testing.T) {
+		buf.Reset()
+
+		r := httptest.NewRequest(http.MethodPost, "/api/generate", nil)
+		r.Header.Set(logutil.RequestIDHeader, "trace-123")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if got := w.Header().Get(logutil.RequestIDHeader); got != "trace-123" {
+			t.Errorf("expected request id trace-123, got %q", got)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("expected 2 lines, got %q", buf.String())
+		}
+
+		for _, line := range lines {
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatal(err)
+			}
+
+			if record["request_id"] != "trace-123" {
+				t.Errorf("expected request id trace-123 in %s", line)
+			}
+		}
+
+		var request map[string]any
+		if err := json.Unmarshal([]byte(lines[1]), &request); err != nil {
+			t.Fatal(err)
+		}
+
+		if request["msg"] != "request" || request["path"] != "/api/generate" || request["status"] != float64(http.StatusOK) {
+			t.Errorf("unexpected request line %s", lines[1])
+		}
+	})
+
+	t.Run("generated", func(t *testing.T) {
+		buf.Reset()
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/generate", nil))
+
+		id := w.Header().Get(logutil.RequestIDHeader)
+		if id == "" {
+			t.Fatal("expected a request id")
+		}
+
+		var record map[string]any
+		if err := json.Unmarshal([]byte(strings.Split(buf.String(), "\n")[0]), &record); err != nil {
+			t.Fatal(err)
+		}
+
+		// handlers see the generated id in the header too
+		if record["request_id"] != id || record["header"] != id {
+			t.Errorf("expected request id %s, got %v", id, record)
+		}
+	})
+}
+
+func TestLogLevel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer logutil.Level.Set(logutil.Level.Level())
+	logutil.Level.Set(slog.LevelInfo)
+
+	var s Server
+
+	w := createRequest(t, s.LogLevelHandler, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp api.LogLevel
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Level != "info" {
+		t.Errorf("expected level info, got %s", resp.Level)
+	}
+
+	w = createRequest(t, s.SetLogLevelHandler, api.LogLevel{Level: "DEBUG"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Level != "debug" || logutil.Level.Level() != slog.LevelDebug {
+		t.Errorf("expected level debug, got %s (%s)", resp.Level, logutil.Level.Level())
+	}
+
+	w = createRequest(t, s.SetLogLevelHandler, api.LogLevel{Level: "verbose"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+
+	if logutil.Level.Level() != slog.LevelDebug {
+		t.Errorf("expected level to stay debug, got %s", logutil.Level.Level())
+	}
+
+	t.Run("access list", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "acl.json")
+		if err := os.WriteFile(path, []byte(`{"users": [
+			{"name": "team-a", "keys": ["key-a"], "run": ["*/*/*:*"]},
+			{"name": "admin", "keys": ["key-admin"], "admin": true}
+		]}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		acl, err := loadACL(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := Server{acl: acl}
+		_, router := gin.CreateTestContext(httptest.NewRecorder())
+		router.Use(acl.middleware)
+		router.POST("/api/admin/log-level", s.SetLogLevelHandler)
+
+		for key, expected := range map[string]int{
+			"":          http.StatusUnauthorized,
+			"key-a":     http.StatusForbidden,
+			"key-admin": http.StatusOK,
+		} {
+			r := httptest.NewRequest(http.MethodPost, "/api/admin/log-level", strings.NewReader(`{"level": "warn"}`))
+			if key != "" {
+				r.Header.Set("Authorization", "Bearer "+key)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != expected {
+				t.Errorf("%q: expected status %d, got %d", key, expected, w.Code)
+			}
+		}
+
+		if logutil.Level.Level() != slog.LevelWarn {
+			t.Errorf("expected level warn, got %s", logutil.Level.Level())
+		}
+	})
+}
@@ -1,15 +1,18 @@
 package server
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/ollama/ollama/types/model"
 )
@@ -93,6 +96,12 @@ func ParseNamedManifest(n model.Name) (*Manifest, error) {
 	m.fi = fi
 	m.digest = hex.EncodeToString(sha256sum.Sum(nil))
 
+	// a name with a digest only names the model if its tag still has that
+	// manifest, otherwise the model it names isn't here
+	if d := n.Digest(); d != "" && !strings.EqualFold(d, "sha256:"+m.digest) && !strings.EqualFold(d, "sha256-"+m.digest) {
+		return nil, &fs.PathError{Op: "open", Path: n.String(), Err: fs.ErrNotExist}
+	}
+
 	return &m, nil
 }
 
@@ -102,25 +111,63 @@ func WriteManifest(name model.Name, config Layer, layers []Layer) error {
 		return err
 	}
 
-	p := filepath.Join(manifests, name.Filepath())
+	m := Manifest{
+		SchemaVersion: 2,
+		MediaType:     "application/vnd.docker.distribution.manifest.v2+json",
+		Config:        config,
+		Layers:        layers,
+	}
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(m); err != nil {
+		return err
+	}
+
+	return writeManifestFile(filepath.Join(manifests, name.Filepath()), b.Bytes())
+}
+
+// writeManifestFile writes the manifest at p by renaming a file over it, so
+// that requests racing a create, pull or copy see either the previous
+// manifest or the whole new one, and never an empty or partial one.
+func writeManifestFile(p string, b []byte) error {
+	manifests, err := GetManifestPath()
+	if err != nil {
+		return err
+	}
+
 	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
 		return err
 	}
 
-	f, err := os.Create(p)
+	// the temporary file is kept out of the model directories so that
+	// listing manifests never finds it
+	return replaceFile(manifests, p, b)
+}
+
+// replaceFile atomically replaces the file at p with b, writing it to a
+// temporary file in dir first. dir must be on the same file system as p.
+func replaceFile(dir, p string, b []byte) error {
+	f, err := os.CreateTemp(dir, ".tmp-*")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	defer os.Remove(f.Name())
 
-	m := Manifest{
-		SchemaVersion: 2,
-		MediaType:     "application/vnd.docker.distribution.manifest.v2+json",
-		Config:        config,
-		Layers:        layers,
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
 	}
 
-	return json.NewEncoder(f).Encode(m)
+	return os.Rename(f.Name(), p)
 }
 
 func Manifests(continueOnError bool) (map[model.Name]*Manifest, error) {
@@ -138,7 +185,10 @@ func Manifests(continueOnError bool) (map[model.Name]*Manifest, error) {
 	ms := make(map[model.Name]*Manifest)
 	for _, match := range matches {
 		fi, err := os.Stat(match)
-		if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// deleted since it was listed
+			continue
+		} else if err != nil {
 			return nil, err
 		}
 
@@ -148,3 +148,57 @@ func TestManifests(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteManifestConcurrentReads(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	name := model.ParseName("test")
+	if err := WriteManifest(name, Layer{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 200 {
+			if err := WriteManifest(name, Layer{Size: int64(i)}, nil); err != nil {
+				t.Error(err)
+				return
+			}
+
+			if err := CopyModel(name, model.ParseName("copy")); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			manifests, err := GetManifestPath()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tmp, _ := filepath.Glob(filepath.Join(manifests, ".tmp-*")); len(tmp) > 0 {
+				t.Errorf("expected no temporary files, got %v", tmp)
+			}
+			return
+		default:
+		}
+
+		if _, err := ParseNamedManifest(name); err != nil {
+			t.Fatalf("expected a whole manifest, got %v", err)
+		}
+
+		ms, err := Manifests(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := ms[name]; !ok {
+			t.Fatalf("expected %s to be listed", name)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/runners"
+	"github.com/ollama/ollama/types/model"
+)
+
+// A manifest list lets one tag resolve to different manifests depending on
+// the host pulling it, such as a quantization optimized for ARM CPUs and
+// another for x86 CPUs with a GPU. Both the Docker manifest list and the OCI
+// image index media types are accepted.
+const (
+	manifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+	imageIndexMediaType   = "application/vnd.oci.image.index.v1+json"
+)
+
+var errNoPlatformManifest = errors.New("no manifest for this platform")
+
+type ManifestList struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType"`
+	Manifests     []ManifestDescriptor `json:"manifests"`
+}
+
+type ManifestDescriptor struct {
+	MediaType string   `json:"mediaType"`
+	Digest    string   `json:"digest"`
+	Size      int64    `json:"size"`
+	Platform  Platform `json:"platform"`
+
+	// Build is the build of the weights of the manifest, such as
+	// "Q4_K_M-cuda-avx2", whose runtime and flags the host must have
+	// like the features of Platform
+	Build string `json:"build,omitempty"`
+}
+
+// Platform is what a manifest of a manifest list requires of the host.
+// Empty fields match any host.
+type Platform struct {
+	Architecture string `json:"architecture,omitempty"`
+	OS           string `json:"os,omitempty"`
+
+	// Features are the CPU features, such as avx2 or i8mm, and GPU
+	// libraries, such as cuda or metal, the host must have
+	Features []string `json:"features,omitempty"`
+}
+
+// hostPlatform returns the platform of this host. Its CPU features are named
+// as the runners name them, such as avx512f.
+func hostPlatform() Platform {
+	p := Platform{Architecture: runtime.GOARCH, OS: runtime.GOOS, Features: runners.CPUFeatures()}
+
+	for _, gpu := range discover.GetGPUInfo() {
+		if gpu.Library != "cpu" && !slices.Contains(p.Features, gpu.Library) {
+			p.Features = append(p.Features, gpu.Library)
+		}
+	}
+
+	return p
+}
+
+// matches reports whether a host with platform host can use manifests
+// requiring p.
+func (p Platform) matches(host Platform) bool {
+	if p.Architecture != "" && p.Architecture != host.Architecture {
+		return false
+	}
+
+	if p.OS != "" && p.OS != host.OS {
+		return false
+	}
+
+	for _, f := range p.Features {
+		if !slices.Contains(host.Features, f) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// buildPlatform returns what build b requires of the host: its CPU flags, and
+// its runtime unless it is "cpu", which every host has.
+func buildPlatform(b model.Build) Platform {
+	p := Platform{Features: b.Flags()}
+	if r := b.Runtime(); r != "" && r != "cpu" {
+		p.Features = append(p.Features, r)
+	}
+
+	return p
+}
+
+func (p Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if len(p.Features) > 0 {
+		s += " (" + strings.Join(p.Features, ", ") + ")"
+	}
+
+	return s
+}
+
+// resolve returns the first manifest of l that host can use, so lists
+// should order manifests from the most to the least demanding.
+func (l *ManifestList) resolve(host Platform) (ManifestDescriptor, error) {
+	for _, m := range l.Manifests {
+		if !m.Platform.matches(host) {
+			continue
+		}
+
+		if m.Build != "" {
+			b, err := model.ParseBuild(m.Build)
+			if err != nil {
+				slog.Warn("skipping manifest with invalid build", "digest", m.Digest, "error", err)
+				continue
+			}
+
+			if !buildPlatform(b).matches(host) {
+				continue
+			}
+		}
+
+		return m, nil
+	}
+
+	return ManifestDescriptor{}, fmt.Errorf("%w: %s", errNoPlatformManifest, host)
+}
+
+// pullPlatformManifest pulls the manifest d of the manifest list of mp and
+// checks it has the digest the list expects.
+func pullPlatformManifest(ctx context.Context, mp ModelPath, d ManifestDescriptor, regOpts *registryOptions) (*Manifest, error) {
+	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "manifests", d.Digest)
+
+	headers := make(http.Header)
+	headers.Set("Accept", manifestMediaType)
+	resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, headers, nil, regOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bts, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if digest := fmt.Sprintf("sha256:%x", sha256.Sum256(bts)); digest != d.Digest {
+		return nil, fmt.Errorf("%w: manifest has digest %s, expected %s", errDigestMismatch, digest, d.Digest)
+	}
+
+	var m Manifest
+	if err := json.NewDecoder(bytes.NewReader(bts)).Decode(&m); err != nil {
+		return nil, err
+	}
+
+	slog.Info("resolved manifest list", "model", mp.GetShortTagname(), "digest", d.Digest, "platform", d.Platform)
+	return &m, nil
+}
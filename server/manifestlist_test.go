@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlatformMatches(t *testing.T) {
+	host := Platform{Architecture: "arm64", OS: "linux", Features: []string{"neon", "i8mm"}}
+
+	cases := []struct {
+		platform Platform
+		expect   bool
+	}{
+		{Platform{}, true},
+		{Platform{Architecture: "arm64"}, true},
+		{Platform{Architecture: "arm64", OS: "linux", Features: []string{"i8mm"}}, true},
+		{Platform{Architecture: "amd64"}, false},
+		{Platform{OS: "darwin"}, false},
+		{Platform{Features: []string{"i8mm", "cuda"}}, false},
+	}
+
+	for _, tt := range cases {
+		if got := tt.platform.matches(host); got != tt.expect {
+			t.Errorf("%s: expected %v, got %v", tt.platform, tt.expect, got)
+		}
+	}
+}
+
+func TestManifestListResolve(t *testing.T) {
+	l := ManifestList{
+		Manifests: []ManifestDescriptor{
+			{Digest: "sha256:invalid", Build: "Q4_0--avx2"},
+			{Digest: "sha256:avx512f", Build: "Q4_K_M-cuda-avx512f", Platform: Platform{Architecture: "amd64"}},
+			{Digest: "sha256:cuda", Platform: Platform{Architecture: "amd64", Features: []string{"cuda"}}},
+			{Digest: "sha256:i8mm", Platform: Platform{Architecture: "arm64", Features: []string{"i8mm"}}},
+			{Digest: "sha256:arm64", Platform: Platform{Architecture: "arm64"}},
+			{Digest: "sha256:amd64", Platform: Platform{Architecture: "amd64"}},
+		},
+	}
+
+	cases := []struct {
+		host   Platform
+		expect string
+	}{
+		{Platform{Architecture: "amd64", OS: "linux", Features: []string{"avx2", "avx512f", "cuda"}}, "sha256:avx512f"},
+		{Platform{Architecture: "amd64", OS: "linux", Features: []string{"avx2", "cuda"}}, "sha256:cuda"},
+		{Platform{Architecture: "amd64", OS: "linux", Features: []string{"avx2"}}, "sha256:amd64"},
+		{Platform{Architecture: "arm64", OS: "linux", Features: []string{"neon", "i8mm"}}, "sha256:i8mm"},
+		{Platform{Architecture: "arm64", OS: "darwin", Features: []string{"neon", "metal"}}, "sha256:arm64"},
+	}
+
+	for _, tt := range cases {
+		d, err := l.resolve(tt.host)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if d.Digest != tt.expect {
+			t.Errorf("%s: expected %s, got %s", tt.host, tt.expect, d.Digest)
+		}
+	}
+
+	if _, err := l.resolve(Platform{Architecture: "riscv64", OS: "linux"}); !errors.Is(err, errNoPlatformManifest) {
+		t.Errorf("expected %v, got %v", errNoPlatformManifest, err)
+	}
+}
+
+func TestPullManifestList(t *testing.T) {
+	manifest := func(digest string) []byte {
+		bts, err := json.Marshal(Manifest{
+			SchemaVersion: 2,
+			MediaType:     manifestMediaType,
+			Layers:        []Layer{{MediaType: "application/vnd.ollama.image.model", Digest: digest, Size: 1}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return bts
+	}
+
+	other, host := manifest("sha256:other"), manifest("sha256:host")
+	otherDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(other))
+	hostDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(host))
+
+	list, err := json.Marshal(ManifestList{
+		SchemaVersion: 2,
+		MediaType:     manifestListMediaType,
+		Manifests: []ManifestDescriptor{
+			{MediaType: manifestMediaType, Digest: otherDigest, Size: int64(len(other)), Platform: Platform{Architecture: "other"}},
+			{MediaType: manifestMediaType, Digest: hostDigest, Size: int64(len(host)), Platform: Platform{Architecture: runtime.GOARCH, OS: runtime.GOOS}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/library/test/manifests/latest":
+			w.Write(list)
+		case "/v2/library/test/manifests/bad":
+			// a list whose manifest doesn't have the digest it lists
+			bad, _ := json.Marshal(ManifestList{
+				MediaType: imageIndexMediaType,
+				Manifests: []ManifestDescriptor{{Digest: otherDigest}},
+			})
+			w.Write(bad)
+		case "/v2/library/test/manifests/" + otherDigest:
+			w.Write(host)
+		case "/v2/library/test/manifests/" + hostDigest:
+			w.Write(host)
+		case "/v2/library/test/manifests/single":
+			w.Write(other)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mp := ModelPath{ProtocolScheme: "http", Registry: u.Host, Namespace: "library", Repository: "test"}
+
+	t.Run("list", func(t *testing.T) {
+		mp.Tag = "latest"
+		m, err := pullModelManifest(context.Background(), mp, &registryOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(m.Layers[0].Digest, "sha256:host"); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("single", func(t *testing.T) {
+		mp.Tag = "single"
+		m, err := pullModelManifest(context.Background(), mp, &registryOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(m.Layers[0].Digest, "sha256:other"); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		mp.Tag = "bad"
+		if _, err := pullModelManifest(context.Background(), mp, &registryOptions{}); !errors.Is(err, errDigestMismatch) {
+			t.Errorf("expected %v, got %v", errDigestMismatch, err)
+		}
+	})
+}
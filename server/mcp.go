@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/mcp"
+)
+
+// mcpTool exposes a tool of an MCP server to models.
+type mcpTool struct {
+	tool   api.Tool
+	name   string
+	client *mcp.Client
+}
+
+func (t *mcpTool) Tool() api.Tool { return t.tool }
+
+func (t *mcpTool) Execute(ctx context.Context, args api.ToolCallFunctionArguments) (string, error) {
+	return t.client.CallTool(ctx, t.name, args)
+}
+
+// mcpResourceTool lets models read the resources of an MCP server.
+type mcpResourceTool struct {
+	tool   api.Tool
+	client *mcp.Client
+}
+
+func (t *mcpResourceTool) Tool() api.Tool { return t.tool }
+
+func (t *mcpResourceTool) Execute(ctx context.Context, args api.ToolCallFunctionArguments) (string, error) {
+	uri, _ := args["uri"].(string)
+	return t.client.ReadResource(ctx, uri)
+}
+
+type mcpServerConfig struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+// loadMCPServers starts the MCP servers in the configuration file at path
+// and registers their tools and resources. Servers that fail to start are
+// skipped. The returned clients should be closed on shutdown.
+func loadMCPServers(ctx context.Context, path string, r *toolRegistry) ([]*mcp.Client, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Servers map[string]mcpServerConfig `json:"mcpServers"`
+	}
+
+	if err := json.Unmarshal(bts, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var clients []*mcp.Client
+	for name, sc := range config.Servers {
+		client, err := startMCPServer(ctx, name, sc, r)
+		if err != nil {
+			slog.Warn("failed to start mcp server", "name", name, "error", err)
+			continue
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients, nil
+}
+
+func startMCPServer(ctx context.Context, name string, sc mcpServerConfig, r *toolRegistry) (*mcp.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	client, err := mcp.Start(ctx, sc.Command, sc.Args, sc.Env)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := registerMCPTools(ctx, name, client, r); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// registerMCPTools registers the tools and resources of an MCP server. Tool
+// names that clash with an existing tool are prefixed with the server name.
+func registerMCPTools(ctx context.Context, server string, client *mcp.Client, r *toolRegistry) error {
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tools {
+		var fn api.ToolFunction
+		if len(t.InputSchema) > 0 {
+			if err := json.Unmarshal(t.InputSchema, &fn.Parameters); err != nil {
+				slog.Warn("invalid mcp tool schema", "server", server, "tool", t.Name, "error", err)
+				continue
+			}
+		}
+
+		fn.Name = t.Name
+		fn.Description = t.Description
+		if _, ok := r.get(fn.Name); ok {
+			fn.Name = server + "_" + t.Name
+		}
+
+		if err := r.register(&mcpTool{tool: api.Tool{Type: "function", Function: fn}, name: t.Name, client: client}); err != nil {
+			slog.Warn("failed to register mcp tool", "server", server, "tool", t.Name, "error", err)
+		}
+	}
+
+	// resources are optional so servers that do not support them are not an error
+	resources, err := client.ListResources(ctx)
+	if err != nil || len(resources) == 0 {
+		return nil
+	}
+
+	var fn api.ToolFunction
+	fn.Name = server + "_read_resource"
+	fn.Parameters.Type = "object"
+	fn.Parameters.Required = []string{"uri"}
+	fn.Parameters.Properties = map[string]struct {
+		Type        string   `json:"type"`
+		Description string   `json:"description"`
+		Enum        []string `json:"enum,omitempty"`
+	}{"uri": {Type: "string", Description: "URI of the resource to read"}}
+
+	var descriptions []string
+	uri := fn.Parameters.Properties["uri"]
+	for _, res := range resources {
+		uri.Enum = append(uri.Enum, res.URI)
+		descriptions = append(descriptions, fmt.Sprintf("%s (%s)", res.URI, strings.TrimSpace(res.Name+" "+res.Description)))
+	}
+	fn.Parameters.Properties["uri"] = uri
+	fn.Description = fmt.Sprintf("Read a resource from %s. Available resources: %s", server, strings.Join(descriptions, "; "))
+
+	if err := r.register(&mcpResourceTool{tool: api.Tool{Type: "function", Function: fn}, client: client}); err != nil {
+		slog.Warn("failed to register mcp resources", "server", server, "error", err)
+	}
+
+	return nil
+}
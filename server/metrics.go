@@ -0,0 +1,274 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+// durationBuckets are the upper bounds in seconds of the buckets of
+// duration histograms
+var durationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// histogram counts observations in durationBuckets, as Prometheus
+// histograms do.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(durationBuckets))
+	}
+
+	for i, b := range durationBuckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += v
+	h.count++
+}
+
+type requestKey struct {
+	endpoint string
+	status   int
+}
+
+// metricsStore keeps the counters and histograms of requests exposed on
+// /metrics in the Prometheus text format. Gauges, such as the models
+// loaded, are read from the scheduler when scraped.
+type metricsStore struct {
+	mu sync.Mutex
+
+	requests map[requestKey]uint64
+
+	// by model
+	evalTokens   map[string]uint64
+	promptTokens map[string]uint64
+	promptEval   map[string]*histogram
+	queueWait    map[string]*histogram
+}
+
+func newMetricsStore() *metricsStore {
+	return &metricsStore{
+		requests:     make(map[requestKey]uint64),
+		evalTokens:   make(map[string]uint64),
+		promptTokens: make(map[string]uint64),
+		promptEval:   make(map[string]*histogram),
+		queueWait:    make(map[string]*histogram),
+	}
+}
+
+// middleware counts requests by route and status code. Streamed responses
+// are counted once the last chunk is written, and those whose client
+// disconnected first as canceled with status 499.
+func (m *metricsStore) middleware(c *gin.Context) {
+	c.Next()
+
+	// requests for unknown paths would make a series each
+	endpoint := c.FullPath()
+	if endpoint == "" {
+		return
+	}
+
+	status := c.Writer.Status()
+	if errors.Is(c.Request.Context().Err(), context.Canceled) {
+		status = 499
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{endpoint, status}]++
+}
+
+// observe records the metrics of a completed generate or chat request.
+func (m *metricsStore) observe(model string, metrics api.Metrics) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.evalTokens[model] += uint64(metrics.EvalCount)
+	m.promptTokens[model] += uint64(metrics.PromptEvalCount)
+
+	if m.promptEval[model] == nil {
+		m.promptEval[model] = &histogram{}
+	}
+	m.promptEval[model].observe(metrics.PromptEvalDuration.Seconds())
+
+	if m.queueWait[model] == nil {
+		m.queueWait[model] = &histogram{}
+	}
+	m.queueWait[model].observe(metrics.QueueDuration.Seconds())
+}
+
+// errorType names the kind of error of a response with status.
+func errorType(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return "invalid_request"
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "unauthorized"
+	case http.StatusNotFound:
+		return "not_found"
+	case 499:
+		return "canceled"
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return "overloaded"
+	}
+
+	if status >= http.StatusInternalServerError {
+		return "internal"
+	}
+
+	return "client"
+}
+
+// labels formats Prometheus labels from pairs of names and values.
+func labels(pairs ...string) string {
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		sb.WriteString(pairs[i])
+		sb.WriteString(`="`)
+		sb.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1]))
+		sb.WriteString(`"`)
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeCounters(w io.Writer, name, help string, values map[string]uint64) {
+	writeHeader(w, name, "counter", help)
+	for _, model := range slices.Sorted(maps.Keys(values)) {
+		fmt.Fprintf(w, "%s%s %d\n", name, labels("model", model), values[model])
+	}
+}
+
+func writeHistograms(w io.Writer, name, help string, values map[string]*histogram) {
+	writeHeader(w, name, "histogram", help)
+	for _, model := range slices.Sorted(maps.Keys(values)) {
+		h := values[model]
+		for i, b := range durationBuckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels("model", model, "le", strconv.FormatFloat(b, 'g', -1, 64)), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels("model", model, "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum%s %g\n", name, labels("model", model), h.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", name, labels("model", model), h.count)
+	}
+}
+
+func (m *metricsStore) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := slices.SortedFunc(maps.Keys(m.requests), func(a, b requestKey) int {
+		return cmp.Or(cmp.Compare(a.endpoint, b.endpoint), cmp.Compare(a.status, b.status))
+	})
+
+	writeHeader(w, "ollama_requests_total", "counter", "Requests handled, by endpoint and status code.")
+	for _, k := range keys {
+		fmt.Fprintf(w, "ollama_requests_total%s %d\n", labels("endpoint", k.endpoint, "status", strconv.Itoa(k.status)), m.requests[k])
+	}
+
+	failed := make(map[[2]string]uint64)
+	for _, k := range keys {
+		if k.status >= http.StatusBadRequest {
+			failed[[2]string{k.endpoint, errorType(k.status)}] += m.requests[k]
+		}
+	}
+
+	writeHeader(w, "ollama_request_errors_total", "counter", "Requests that failed, by endpoint and type of error.")
+	for _, k := range slices.SortedFunc(maps.Keys(failed), func(a, b [2]string) int {
+		return cmp.Or(cmp.Compare(a[0], b[0]), cmp.Compare(a[1], b[1]))
+	}) {
+		fmt.Fprintf(w, "ollama_request_errors_total%s %d\n", labels("endpoint", k[0], "type", k[1]), failed[k])
+	}
+
+	writeCounters(w, "ollama_generated_tokens_total", "Tokens generated, by model.", m.evalTokens)
+	writeCounters(w, "ollama_prompt_tokens_total", "Prompt tokens evaluated, by model.", m.promptTokens)
+	writeHistograms(w, "ollama_prompt_eval_duration_seconds", "Time spent evaluating prompts, by model.", m.promptEval)
+	writeHistograms(w, "ollama_queue_wait_duration_seconds", "Time requests waited for the scheduler, by model.", m.queueWait)
+}
+
+// writeGauges writes the state of the loaded models.
+func (s *Scheduler) writeGauges(w io.Writer) {
+	type gpu struct{ id, library string }
+	used := make(map[gpu]uint64)
+	total := make(map[gpu]uint64)
+
+	var loaded int
+	if s != nil {
+		s.loadedMu.Lock()
+		loaded = len(s.loaded)
+		for _, runner := range s.loaded {
+			for _, g := range runner.gpus {
+				if g.Library == "cpu" {
+					continue
+				}
+
+				k := gpu{g.ID, g.Library}
+				total[k] = g.TotalMemory
+				if runner.llama != nil {
+					used[k] += runner.llama.EstimatedVRAMByGPU(g.ID)
+				}
+			}
+		}
+		s.loadedMu.Unlock()
+	}
+
+	writeHeader(w, "ollama_loaded_models", "gauge", "Models loaded into memory.")
+	fmt.Fprintf(w, "ollama_loaded_models %d\n", loaded)
+
+	gpus := slices.SortedFunc(maps.Keys(total), func(a, b gpu) int {
+		return cmp.Or(cmp.Compare(a.library, b.library), cmp.Compare(a.id, b.id))
+	})
+
+	writeHeader(w, "ollama_gpu_vram_used_bytes", "gauge", "VRAM used by loaded models, by GPU.")
+	for _, g := range gpus {
+		fmt.Fprintf(w, "ollama_gpu_vram_used_bytes%s %d\n", labels("gpu", g.id, "library", g.library), used[g])
+	}
+
+	writeHeader(w, "ollama_gpu_vram_total_bytes", "gauge", "Total VRAM of GPUs models are loaded on, by GPU.")
+	for _, g := range gpus {
+		fmt.Fprintf(w, "ollama_gpu_vram_total_bytes%s %d\n", labels("gpu", g.id, "library", g.library), total[g])
+	}
+}
+
+// MetricsHandler exposes metrics in the Prometheus text format.
+func (s *Server) MetricsHandler(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	if s.metrics != nil {
+		s.metrics.write(c.Writer)
+	}
+
+	s.sched.writeGauges(c.Writer)
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	gpu := discover.GpuInfo{ID: "0", Library: "cuda"}
+	gpu.TotalMemory = 24 << 30
+
+	s := Server{
+		metrics: newMetricsStore(),
+		sched: &Scheduler{
+			loaded: map[string]*runnerRef{
+				"a": {
+					llama: &mockLlm{estimatedVRAMByGPU: map[string]uint64{"0": 3 << 30}},
+					gpus:  discover.GpuInfoList{gpu},
+				},
+				"b": {
+					llama: &mockLlm{},
+					gpus:  discover.GpuInfoList{{ID: "0", Library: "cpu"}},
+				},
+			},
+		},
+	}
+
+	r := gin.New()
+	r.Use(s.metrics.middleware)
+	r.GET("/api/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/api/bad", func(c *gin.Context) { c.Status(http.StatusBadRequest) })
+	r.GET("/api/busy", func(c *gin.Context) { c.Status(http.StatusServiceUnavailable) })
+	r.GET("/metrics", s.MetricsHandler)
+
+	for _, path := range []string{"/api/ok", "/api/ok", "/api/bad", "/api/busy", "/api/unknown"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// the client disconnected before the response was done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(ctx, http.MethodGet, "/api/ok", nil))
+
+	s.metrics.observe("llama3.2:latest", api.Metrics{
+		PromptEvalCount:    26,
+		PromptEvalDuration: 300 * time.Millisecond,
+		EvalCount:          10,
+		QueueDuration:      2 * time.Second,
+	})
+	s.metrics.observe("llama3.2:latest", api.Metrics{EvalCount: 5})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	body := w.Body.String()
+	for _, line := range []string{
+		`# TYPE ollama_requests_total counter`,
+		`ollama_requests_total{endpoint="/api/ok",status="200"} 2`,
+		`ollama_requests_total{endpoint="/api/bad",status="400"} 1`,
+		`ollama_requests_total{endpoint="/api/ok",status="499"} 1`,
+		`ollama_request_errors_total{endpoint="/api/ok",type="canceled"} 1`,
+		`ollama_request_errors_total{endpoint="/api/bad",type="invalid_request"} 1`,
+		`ollama_request_errors_total{endpoint="/api/busy",type="overloaded"} 1`,
+		`ollama_generated_tokens_total{model="llama3.2:latest"} 15`,
+		`ollama_prompt_tokens_total{model="llama3.2:latest"} 26`,
+		`# TYPE ollama_prompt_eval_duration_seconds histogram`,
+		`ollama_prompt_eval_duration_seconds_bucket{model="llama3.2:latest",le="0.25"} 1`,
+		`ollama_prompt_eval_duration_seconds_bucket{model="llama3.2:latest",le="0.5"} 2`,
+		`ollama_prompt_eval_duration_seconds_bucket{model="llama3.2:latest",le="+Inf"} 2`,
+		`ollama_prompt_eval_duration_seconds_count{model="llama3.2:latest"} 2`,
+		`ollama_queue_wait_duration_seconds_bucket{model="llama3.2:latest",le="1"} 1`,
+		`ollama_queue_wait_duration_seconds_bucket{model="llama3.2:latest",le="2.5"} 2`,
+		`ollama_queue_wait_duration_seconds_sum{model="llama3.2:latest"} 2`,
+		`ollama_loaded_models 2`,
+		`ollama_gpu_vram_used_bytes{gpu="0",library="cuda"} 3221225472`,
+		`ollama_gpu_vram_total_bytes{gpu="0",library="cuda"} 25769803776`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %q in:\n%s", line, body)
+		}
+	}
+
+	if strings.Contains(body, "/api/unknown") || strings.Contains(body, `library="cpu"`) {
+		t.Errorf("unexpected series in:\n%s", body)
+	}
+}
+
+func TestMetricsLabels(t *testing.T) {
+	if got := labels("model", `a"b\c`+"\n"); got != `{model="a\"b\\c\n"}` {
+		t.Errorf("unexpected labels %s", got)
+	}
+}
@@ -30,7 +30,8 @@ type layerGGML struct {
 func parseFromModel(ctx context.Context, name model.Name, fn func(api.ProgressResponse)) (layers []*layerGGML, err error) {
 	m, err := ParseNamedManifest(name)
 	switch {
-	case errors.Is(err, os.ErrNotExist):
+	// a digest is only checked against the local model, never pulled
+	case errors.Is(err, os.ErrNotExist) && !name.HasDigest():
 		if err := PullModel(ctx, name.String(), &registryOptions{}, fn); err != nil {
 			return nil, err
 		}
@@ -129,13 +130,21 @@ func detectContentType(r io.Reader) (string, error) {
 	return "unknown", nil
 }
 
-func parseObjects(s string) []map[string]any {
+// parseObjects returns the JSON objects in s. If partial is set, the
+// objects of an array that isn't finished, such as tool calls still being
+// generated, are parsed on their own.
+func parseObjects(s string, partial bool) []map[string]any {
 	var objs []map[string]any
 	for offset := 0; offset < len(s); {
 		var obj map[string]any
 		decoder := json.NewDecoder(strings.NewReader(s[offset:]))
 		if err := decoder.Decode(&obj); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
-			break
+			rest := strings.TrimLeft(s[offset:], " \t\r\n")
+			if !partial || !strings.HasPrefix(rest, "[") {
+				break
+			}
+
+			offset = len(s) - len(rest) + 1
 		} else if syntax := &(json.SyntaxError{}); errors.As(err, &syntax) {
 			// skip over any syntax errors
 			offset += int(syntax.Offset)
@@ -156,6 +165,17 @@ func parseObjects(s string) []map[string]any {
 // parseToolCalls attempts to parse a JSON string into a slice of ToolCalls.
 // mxyng: this only really works if the input contains tool calls in some JSON format
 func (m *Model) parseToolCalls(s string) ([]api.ToolCall, bool) {
+	return m.toolCalls(s, false)
+}
+
+// parseStreamedToolCalls is like parseToolCalls for a response still being
+// generated: it also returns the tool calls that are complete in an array
+// that isn't, so that each can be streamed as soon as it is.
+func (m *Model) parseStreamedToolCalls(s string) ([]api.ToolCall, bool) {
+	return m.toolCalls(s, true)
+}
+
+func (m *Model) toolCalls(s string, partial bool) ([]api.ToolCall, bool) {
 	// create a subtree from the node that ranges over .ToolCalls
 	tmpl := m.Template.Subtree(func(n parse.Node) bool {
 		if t, ok := n.(*parse.RangeNode); ok {
@@ -185,7 +205,7 @@ func (m *Model) parseToolCalls(s string) ([]api.ToolCall, bool) {
 		return nil, false
 	}
 
-	templateObjects := parseObjects(b.String())
+	templateObjects := parseObjects(b.String(), false)
 	if len(templateObjects) == 0 {
 		return nil, false
 	}
@@ -205,7 +225,7 @@ func (m *Model) parseToolCalls(s string) ([]api.ToolCall, bool) {
 		return nil, false
 	}
 
-	responseObjects := parseObjects(s)
+	responseObjects := parseObjects(s, partial)
 	if len(responseObjects) == 0 {
 		return nil, false
 	}
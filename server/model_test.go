@@ -136,6 +136,35 @@ The temperature in San Francisco, CA is 70°F and in Toronto, Canada is 20°C.`,
 	}
 }
 
+func TestParseStreamedToolCalls(t *testing.T) {
+	tmpl, err := template.Parse(readFile(t, filepath.Join("testdata", "tools"), "mistral.gotmpl").String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Model{Template: tmpl}
+
+	// the third call is still being generated
+	output := `[TOOL_CALLS]  [{"name": "get_current_weather", "arguments": {"format":"fahrenheit","location":"San Francisco, CA"}},{"name": "get_current_weather", "arguments": {"format":"celsius","location":"Toronto, Canada"}},{"name": "get_current_weather", "arguments": {"format":"celsius","location":"To`
+
+	calls, ok := m.parseStreamedToolCalls(output)
+	if !ok || len(calls) != 2 {
+		t.Fatalf("expected the 2 complete calls, got %v", calls)
+	}
+
+	if diff := cmp.Diff([]string{"San Francisco, CA", "Toronto, Canada"}, []string{
+		calls[0].Function.Arguments["location"].(string),
+		calls[1].Function.Arguments["location"].(string),
+	}); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// once done, an unfinished array isn't tool calls
+	if _, ok := m.parseToolCalls(output); ok {
+		t.Error("expected no tool calls from an unfinished array")
+	}
+}
+
 func TestParseObjects(t *testing.T) {
 	tests := []struct {
 		input string
@@ -169,7 +198,7 @@ func TestParseObjects(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.input, func(t *testing.T) {
-			got := parseObjects(tc.input)
+			got := parseObjects(tc.input, false)
 
 			if diff := cmp.Diff(got, tc.want); diff != "" {
 				t.Errorf("mismatch (-got +want):\n%s", diff)
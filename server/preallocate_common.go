@@ -0,0 +1,20 @@
+//go:build !linux && !darwin && !windows
+
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+func preallocate(*os.File, int64) error {
+	return errors.ErrUnsupported
+}
+
+func allocatedSize(*os.File) int64 {
+	return 0
+}
+
+func diskSpace(string) (uint64, uint64, error) {
+	return 0, 0, errors.ErrUnsupported
+}
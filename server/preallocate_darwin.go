@@ -0,0 +1,56 @@
+package server
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func preallocate(file *os.File, size int64) error {
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// F_PREALLOCATE allocates relative to the physical end of the file so
+	// only request what a resumed download has not already allocated
+	length := size
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		length -= st.Blocks * 512
+	}
+
+	if length <= 0 {
+		return nil
+	}
+
+	fstore := unix.Fstore_t{
+		Flags:   unix.F_ALLOCATEALL,
+		Posmode: unix.F_PEOFPOSMODE,
+		Length:  length,
+	}
+
+	return unix.FcntlFstore(file.Fd(), unix.F_PREALLOCATE, &fstore)
+}
+
+// allocatedSize returns the disk space allocated to file, which can be more
+// than it holds if it was preallocated.
+func allocatedSize(file *os.File) int64 {
+	var stat unix.Stat_t
+	if err := unix.Fstat(int(file.Fd()), &stat); err != nil {
+		return 0
+	}
+
+	return stat.Blocks * 512
+}
+
+// diskSpace returns the space available to the user and the total space of
+// the file system of path.
+func diskSpace(path string) (avail, total uint64, err error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+
+	return stat.Bavail * uint64(stat.Bsize), stat.Blocks * uint64(stat.Bsize), nil
+}
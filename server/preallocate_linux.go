@@ -0,0 +1,33 @@
+package server
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func preallocate(file *os.File, size int64) error {
+	return unix.Fallocate(int(file.Fd()), 0, 0, size)
+}
+
+// allocatedSize returns the disk space allocated to file, which can be more
+// than it holds if it was preallocated.
+func allocatedSize(file *os.File) int64 {
+	var stat unix.Stat_t
+	if err := unix.Fstat(int(file.Fd()), &stat); err != nil {
+		return 0
+	}
+
+	return stat.Blocks * 512
+}
+
+// diskSpace returns the space available to the user and the total space of
+// the file system of path.
+func diskSpace(path string) (avail, total uint64, err error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+
+	return stat.Bavail * uint64(stat.Bsize), stat.Blocks * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func preallocate(file *os.File, size int64) error {
+	info := struct{ AllocationSize int64 }{size}
+	err := windows.SetFileInformationByHandle(
+		windows.Handle(file.Fd()), windows.FileAllocationInfo,
+		(*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)),
+	)
+	if errors.Is(err, windows.ERROR_DISK_FULL) {
+		return syscall.ENOSPC
+	}
+
+	return err
+}
+
+// allocatedSize returns the disk space allocated to file, which can be more
+// than it holds if it was preallocated.
+func allocatedSize(file *os.File) int64 {
+	var info struct {
+		AllocationSize int64
+		EndOfFile      int64
+		NumberOfLinks  uint32
+		DeletePending  bool
+		Directory      bool
+	}
+
+	if err := windows.GetFileInformationByHandleEx(
+		windows.Handle(file.Fd()), windows.FileStandardInfo,
+		(*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)),
+	); err != nil {
+		return 0
+	}
+
+	return info.AllocationSize
+}
+
+// diskSpace returns the space available to the user and the total space of
+// the volume of path.
+func diskSpace(path string) (avail, total uint64, err error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := windows.GetDiskFreeSpaceEx(p, &avail, &total, nil); err != nil {
+		return 0, 0, err
+	}
+
+	return avail, total, nil
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/template"
+	"github.com/ollama/ollama/types/model"
+)
+
+var errPrefixNotFound = errors.New("prefix not found")
+
+// pinnedPrefix is a system prompt registered for a model. Requests that
+// reference it share an identical prompt prefix, so the runner's prompt cache
+// can reuse the evaluated KV state instead of processing the prefix again.
+type pinnedPrefix struct {
+	model  model.Name
+	system string
+}
+
+type prefixStore struct {
+	mu       sync.Mutex
+	prefixes map[string]pinnedPrefix
+}
+
+func newPrefixStore() *prefixStore {
+	return &prefixStore{prefixes: make(map[string]pinnedPrefix)}
+}
+
+// prefixID derives a stable id for a prefix so registering the same system
+// prompt for the same model is idempotent.
+func prefixID(n model.Name, system string) string {
+	sha256sum := sha256.Sum256([]byte(n.String() + "\x00" + system))
+	return hex.EncodeToString(sha256sum[:8])
+}
+
+func (s *prefixStore) add(n model.Name, system string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := prefixID(n, system)
+	s.prefixes[id] = pinnedPrefix{model: n, system: system}
+	return id
+}
+
+// get returns the system prompt of a prefix, checking it was registered for
+// model n.
+func (s *prefixStore) get(id string, n model.Name) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.prefixes[id]
+	if !ok {
+		return "", errPrefixNotFound
+	}
+
+	if !p.model.EqualFold(n) {
+		return "", fmt.Errorf("prefix '%s' is registered for model '%s'", id, p.model.DisplayShortest())
+	}
+
+	return p.system, nil
+}
+
+// systems returns the system prompts of the prefixes registered for model n.
+func (s *prefixStore) systems(n model.Name) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var systems []string
+	for _, p := range s.prefixes {
+		if p.model.EqualFold(n) {
+			systems = append(systems, p.system)
+		}
+	}
+
+	return systems
+}
+
+// resolvePrefix writes an error response and returns false if the prefix id
+// cannot be used with model n.
+func (s *Server) resolvePrefix(c *gin.Context, id string, n model.Name) (string, bool) {
+	system, err := s.prefixes.get(id, n)
+	if errors.Is(err, errPrefixNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("prefix '%s' not found", id)})
+		return "", false
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+
+	return system, true
+}
+
+func (s *Server) PrefixHandler(c *gin.Context) {
+	var req api.PrefixRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.System == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "system is required"})
+		return
+	}
+
+	name := model.ParseName(req.Model)
+	if !name.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	name, err := resolveName(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+
+	if err := s.warmPrefix(c.Request.Context(), name, req.System, req.KeepAlive); err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.PrefixResponse{
+		ID:    s.prefixes.add(name, req.System),
+		Model: req.Model,
+	})
+}
+
+// warmPrefix evaluates the system prompt of a prefix so it is already in the
+// prompt cache when the first request referencing it arrives.
+func (s *Server) warmPrefix(ctx context.Context, name model.Name, system string, keepAlive *api.Duration) error {
+	// the runner is held until ctx is done
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r, m, opts, err := s.scheduleRunner(ctx, name.String(), []Capability{CapabilityCompletion}, "", nil, keepAlive)
+	if err != nil {
+		return err
+	}
+
+	prompt, _, err := chatPrompt(ctx, m, r.Tokenize, opts, []api.Message{{Role: "system", Content: system}}, nil, template.Metadata{})
+	if err != nil {
+		return err
+	}
+
+	warm := *opts
+	warm.NumPredict = 1
+	return r.Completion(ctx, llm.CompletionRequest{
+		Prompt:  prompt,
+		Options: &warm,
+	}, func(llm.CompletionResponse) {})
+}
+
+// rewarmPrefixes evaluates the prefixes registered for a model again each
+// time it is loaded, as a new runner starts with an empty prompt cache.
+func (s *Server) rewarmPrefixes(ctx context.Context) {
+	events, stop := s.sched.events.subscribe()
+	defer stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			if e.Load == nil || e.Load.Stage != "ready" {
+				continue
+			}
+
+			go s.rewarmModel(systemContext(ctx), model.ParseName(e.Load.Model))
+		}
+	}
+}
+
+// rewarmModel evaluates the prefixes of the model called name again one at
+// a time, so they don't take all of its slots. It stops once the model is to
+// be unloaded, so that it isn't loaded again only for its prefixes.
+func (s *Server) rewarmModel(ctx context.Context, name model.Name) {
+	m, err := GetModel(name.String())
+	if err != nil {
+		slog.Warn("failed to evaluate prefixes", "model", name.DisplayShortest(), "error", err)
+		return
+	}
+
+	for _, system := range s.prefixes.systems(name) {
+		if s.sched.expiring(m) {
+			return
+		}
+
+		if err := s.warmPrefix(ctx, name, system, nil); err != nil {
+			slog.Warn("failed to evaluate prefix", "model", name.DisplayShortest(), "error", err)
+		}
+	}
+}
@@ -8,8 +8,10 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/llm"
 	"github.com/ollama/ollama/model/mllama"
 	"github.com/ollama/ollama/template"
@@ -21,8 +23,8 @@ var errTooManyImages = errors.New("vision model only supports a single image per
 
 // chatPrompt accepts a list of messages and returns the prompt and images that should be used for the next chat turn.
 // chatPrompt truncates any messages that exceed the context window of the model, making sure to always include 1) the
-// latest message and 2) system messages
-func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message, tools []api.Tool) (prompt string, images []llm.ImageData, _ error) {
+// latest message and 2) system messages. meta is available to the template.
+func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message, tools []api.Tool, meta template.Metadata) (prompt string, images []llm.ImageData, _ error) {
 	var system []api.Message
 
 	isMllama := checkMllamaModelFamily(m)
@@ -57,7 +59,7 @@ func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.
 		}
 
 		var b bytes.Buffer
-		if err := m.Template.Execute(&b, template.Values{Messages: append(system, msgs[i:]...), Tools: tools}); err != nil {
+		if err := m.Template.Execute(&b, template.Values{Messages: append(system, msgs[i:]...), Tools: tools, Metadata: meta}); err != nil {
 			return "", nil, err
 		}
 
@@ -135,7 +137,7 @@ func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.
 
 	// truncate any messages that do not fit into the context window
 	var b bytes.Buffer
-	if err := m.Template.Execute(&b, template.Values{Messages: append(system, msgs[currMsgIdx:]...), Tools: tools}); err != nil {
+	if err := m.Template.Execute(&b, template.Values{Messages: append(system, msgs[currMsgIdx:]...), Tools: tools, Metadata: meta}); err != nil {
 		return "", nil, err
 	}
 
@@ -150,3 +152,45 @@ func checkMllamaModelFamily(m *Model) bool {
 	}
 	return false
 }
+
+// cachePrefix returns the beginning of prompt rendered from the system
+// messages msgs starts with and tools, which runners save the KV cache of
+// when prompt caching is enabled so that other prompts with the same system
+// prompt don't process it again.
+func cachePrefix(tmpl *template.Template, msgs []api.Message, tools []api.Tool, meta template.Metadata, prompt string) string {
+	if envconfig.PromptCache() == "" {
+		return ""
+	}
+
+	var system []api.Message
+	for _, msg := range msgs {
+		if msg.Role != "system" {
+			break
+		}
+
+		system = append(system, msg)
+	}
+
+	if len(system) == 0 && len(tools) == 0 {
+		return ""
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, template.Values{Messages: system, Tools: tools, Metadata: meta}); err != nil {
+		return ""
+	}
+
+	// the template renders the system prompt the same way up to where the
+	// prompt goes on with the other messages
+	rendered := b.String()
+	var n int
+	for n < len(rendered) && n < len(prompt) && rendered[n] == prompt[n] {
+		n++
+	}
+
+	for n > 0 && n < len(prompt) && !utf8.RuneStart(prompt[n]) {
+		n--
+	}
+
+	return prompt[:n]
+}
@@ -318,7 +318,7 @@ func TestChatPrompt(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			model := tt.model
 			opts := api.Options{Runner: api.Runner{NumCtx: tt.limit}}
-			prompt, images, err := chatPrompt(context.TODO(), &model, mockRunner{}.Tokenize, &opts, tt.msgs, nil)
+			prompt, images, err := chatPrompt(context.TODO(), &model, mockRunner{}.Tokenize, &opts, tt.msgs, nil, template.Metadata{})
 			if tt.error == nil && err != nil {
 				t.Fatal(err)
 			} else if tt.error != nil && err != tt.error {
@@ -351,3 +351,68 @@ func TestChatPrompt(t *testing.T) {
 		})
 	}
 }
+
+func TestCachePrefix(t *testing.T) {
+	tmpl, err := template.Parse(`
+{{- range .Messages }}<|{{ .Role }}|>{{ .Content }}<|end|>{{ end }}<|assistant|>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	render := func(msgs []api.Message) string {
+		t.Helper()
+
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, template.Values{Messages: msgs}); err != nil {
+			t.Fatal(err)
+		}
+
+		return b.String()
+	}
+
+	system := api.Message{Role: "system", Content: "You are a helpful assistant."}
+	user := api.Message{Role: "user", Content: "Why is the sky blue?"}
+
+	cases := []struct {
+		name   string
+		msgs   []api.Message
+		expect string
+	}{
+		{
+			name:   "system",
+			msgs:   []api.Message{system, user},
+			expect: "<|system|>You are a helpful assistant.<|end|><|",
+		},
+		{
+			name:   "systems",
+			msgs:   []api.Message{system, {Role: "system", Content: "Be brief."}, user},
+			expect: "<|system|>You are a helpful assistant.\n\nBe brief.<|end|><|",
+		},
+		{
+			name: "no system",
+			msgs: []api.Message{user},
+		},
+		{
+			name: "system later",
+			msgs: []api.Message{user, system},
+		},
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv("OLLAMA_PROMPT_CACHE", "")
+
+		msgs := []api.Message{system, user}
+		if prefix := cachePrefix(tmpl, msgs, nil, template.Metadata{}, render(msgs)); prefix != "" {
+			t.Errorf("expected no prefix, got %q", prefix)
+		}
+	})
+
+	t.Setenv("OLLAMA_PROMPT_CACHE", t.TempDir())
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(cachePrefix(tmpl, tt.msgs, nil, template.Metadata{}, render(tt.msgs)), tt.expect); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ollama/ollama/api"
+)
+
+// recoverTTL is how long a recovered response is kept if the request
+// doesn't say.
+const recoverTTL = 10 * time.Minute
+
+// recovered is a response being finished after its client disconnected.
+type recovered struct {
+	done chan struct{}
+	resp api.RecoveredResponse
+	err  error
+}
+
+// recoverStore keeps the responses of generate and chat requests whose
+// client disconnected before they were done, by id. A nil recoverStore keeps
+// nothing.
+type recoverStore struct {
+	mu        sync.Mutex
+	responses map[string]*recovered
+}
+
+func newRecoverStore() *recoverStore {
+	return &recoverStore{responses: make(map[string]*recovered)}
+}
+
+// start adds a response being finished under id, replacing any kept
+// before, and forgets responses that have expired.
+func (st *recoverStore) start(id string) *recovered {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	now := time.Now()
+	for k, r := range st.responses {
+		select {
+		case <-r.done:
+			if now.After(r.resp.ExpiresAt) {
+				delete(st.responses, k)
+			}
+		default:
+		}
+	}
+
+	r := &recovered{done: make(chan struct{}), resp: api.RecoveredResponse{ID: id}}
+	st.responses[id] = r
+	return r
+}
+
+func (st *recoverStore) get(id string) (*recovered, bool) {
+	if st == nil {
+		return nil, false
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	r, ok := st.responses[id]
+	if !ok {
+		return nil, false
+	}
+
+	select {
+	case <-r.done:
+		if time.Now().After(r.resp.ExpiresAt) {
+			delete(st.responses, id)
+			return nil, false
+		}
+	default:
+	}
+
+	return r, true
+}
+
+// checkRecover validates the recover field of a request.
+func checkRecover(rec *api.Recover) error {
+	switch {
+	case rec == nil:
+		return nil
+	case len(rec.ID) > 128:
+		return errors.New("recover id must be at most 128 characters")
+	case rec.Budget < 0:
+		return errors.New("recover budget must not be negative")
+	}
+
+	return nil
+}
+
+// recoverContext returns the context to generate the response of a request
+// in. If the response is to be recovered, it isn't canceled when the client
+// disconnects but with the returned function.
+func (s *Server) recoverContext(c *gin.Context, rec *api.Recover) (context.Context, context.CancelFunc) {
+	if rec == nil || s.recovered == nil {
+		return c.Request.Context(), func() {}
+	}
+
+	return context.WithCancel(context.WithoutCancel(c.Request.Context()))
+}
+
+// recoverable forwards the responses on ch to the returned channel while the
+// client is connected, and keeps the whole response under the id of rec once
+// it is done. If the client disconnects first, the rest of the response is
+// generated up to the budget of rec. cancel stops the generation.
+func (s *Server) recoverable(c *gin.Context, rec *api.Recover, cancel context.CancelFunc, ch chan any) chan any {
+	if rec == nil || s.recovered == nil {
+		return ch
+	}
+
+	id := cmp.Or(rec.ID, c.GetHeader("X-Request-Id"))
+	if id == "" || len(id) > 128 {
+		id = uuid.NewString()
+	}
+	c.Header("X-Request-Id", id)
+
+	r := s.recovered.start(id)
+	out := make(chan any)
+	go func() {
+		defer cancel()
+
+		disconnected := c.Request.Context().Done()
+
+		var values []any
+		for v := range ch {
+			values = append(values, v)
+
+			select {
+			case <-disconnected:
+			default:
+				select {
+				case out <- v:
+					continue
+				case <-disconnected:
+				}
+			}
+
+			close(out)
+			slog.Info("client disconnected, finishing response", "id", id, "budget", rec.Budget)
+			s.finishRecovered(r, rec, cancel, ch, values)
+			return
+		}
+
+		close(out)
+		s.keepRecovered(r, rec, values, false)
+	}()
+
+	return out
+}
+
+// finishRecovered reads the rest of the responses on ch after values, up to
+// the budget of rec, and keeps the whole response.
+func (s *Server) finishRecovered(r *recovered, rec *api.Recover, cancel context.CancelFunc, ch chan any, values []any) {
+	var generated int
+	var truncated bool
+	for v := range ch {
+		// after canceling only the error from stopping is left
+		if truncated {
+			continue
+		}
+
+		values = append(values, v)
+		generated++
+		if rec.Budget > 0 && generated >= rec.Budget {
+			truncated = true
+			cancel()
+		}
+	}
+
+	s.keepRecovered(r, rec, values, truncated)
+}
+
+func (s *Server) keepRecovered(r *recovered, rec *api.Recover, values []any, truncated bool) {
+	ttl := recoverTTL
+	if rec.TTL != nil && rec.TTL.Duration > 0 {
+		ttl = rec.TTL.Duration
+	}
+
+	id := r.resp.ID
+	r.resp, r.err = mergeRecovered(values, truncated)
+	r.resp.ID = id
+	r.resp.ExpiresAt = time.Now().Add(ttl)
+	close(r.done)
+}
+
+// mergeRecovered merges the streamed responses of a generate or chat request
+// into a single response. If the response was truncated by the budget, it is
+// done with the reason "length".
+func mergeRecovered(values []any, truncated bool) (api.RecoveredResponse, error) {
+	var resp api.RecoveredResponse
+	var sb strings.Builder
+	var logprobs []api.Logprob
+	var toolCalls []api.ToolCall
+	for _, v := range values {
+		switch v := v.(type) {
+		case api.GenerateResponse:
+			sb.WriteString(v.Response)
+			logprobs = append(logprobs, v.Logprobs...)
+			resp.Generate = &v
+		case api.ChatResponse:
+			sb.WriteString(v.Message.Content)
+			logprobs = append(logprobs, v.Logprobs...)
+			toolCalls = append(toolCalls, v.Message.ToolCalls...)
+			resp.Chat = &v
+		case gin.H:
+			if msg, ok := v["error"].(string); ok {
+				return resp, errors.New(msg)
+			}
+
+			return resp, fmt.Errorf("unexpected response %v", v)
+		}
+	}
+
+	switch {
+	case resp.Generate != nil:
+		resp.Generate.Response = sb.String()
+		resp.Generate.Logprobs = logprobs
+		if truncated {
+			resp.Generate.Done, resp.Generate.DoneReason = true, "length"
+		}
+	case resp.Chat != nil:
+		resp.Chat.Message.Content = sb.String()
+		resp.Chat.Message.ToolCalls = toolCalls
+		resp.Chat.Logprobs = logprobs
+		if truncated {
+			resp.Chat.Done, resp.Chat.DoneReason = true, "length"
+		}
+	default:
+		return resp, errors.New("no response was generated")
+	}
+
+	return resp, nil
+}
+
+// RecoveredHandler returns a response kept after its client disconnected,
+// waiting for it to be done.
+func (s *Server) RecoveredHandler(c *gin.Context) {
+	r, ok := s.recovered.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("recovered response '%s' not found", c.Param("id"))})
+		return
+	}
+
+	select {
+	case <-r.done:
+	case <-c.Request.Context().Done():
+		return
+	}
+
+	if r.err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": r.err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, r.resp)
+}
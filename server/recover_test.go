@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestRecover(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	s := Server{recovered: newRecoverStore()}
+
+	// generate streams words until ctx is canceled, disconnecting the client
+	// once it has read the first one
+	generate := func(t *testing.T, rec *api.Recover) {
+		t.Helper()
+
+		ctx, disconnect := context.WithCancel(context.Background())
+		defer disconnect()
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/generate", nil).WithContext(ctx)
+
+		genCtx, cancel := s.recoverContext(c, rec)
+		ch := make(chan any)
+		go func() {
+			defer close(ch)
+			for _, word := range []string{"Why", " is", " the", " sky", " blue"} {
+				if genCtx.Err() != nil {
+					ch <- gin.H{"error": genCtx.Err().Error()}
+					return
+				}
+
+				ch <- api.GenerateResponse{Model: "test", Response: word}
+			}
+
+			ch <- api.GenerateResponse{Model: "test", Done: true, DoneReason: "stop", Metrics: api.Metrics{EvalCount: 5}}
+		}()
+
+		out := s.recoverable(c, rec, cancel, ch)
+		if v := <-out; v.(api.GenerateResponse).Response != "Why" {
+			t.Fatalf("unexpected first response %v", v)
+		}
+		disconnect()
+
+		if got := w.Header().Get("X-Request-Id"); got != rec.ID {
+			t.Errorf("expected request id %q, got %q", rec.ID, got)
+		}
+	}
+
+	recovered := func(t *testing.T, id string) (int, api.RecoveredResponse) {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/recover/"+id, nil)
+		c.Params = gin.Params{{Key: "id", Value: id}}
+		s.RecoveredHandler(c)
+
+		var resp api.RecoveredResponse
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return w.Code, resp
+	}
+
+	t.Run("finished", func(t *testing.T) {
+		generate(t, &api.Recover{ID: "finished"})
+
+		code, resp := recovered(t, "finished")
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+
+		want := &api.GenerateResponse{Model: "test", Response: "Why is the sky blue", Done: true, DoneReason: "stop", Metrics: api.Metrics{EvalCount: 5}}
+		if diff := cmp.Diff(want, resp.Generate); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+
+		if resp.ID != "finished" || resp.ExpiresAt.IsZero() {
+			t.Errorf("unexpected response %+v", resp)
+		}
+	})
+
+	t.Run("budget", func(t *testing.T) {
+		generate(t, &api.Recover{ID: "budget", Budget: 2})
+
+		code, resp := recovered(t, "budget")
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+
+		// " is" was generated before the disconnect was noticed
+		want := &api.GenerateResponse{Model: "test", Response: "Why is the sky", Done: true, DoneReason: "length"}
+		if diff := cmp.Diff(want, resp.Generate); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		if code, _ := recovered(t, "unknown"); code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", code)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if err := checkRecover(&api.Recover{Budget: -1}); err == nil {
+			t.Error("expected negative budget to be invalid")
+		}
+	})
+}
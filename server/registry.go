@@ -0,0 +1,367 @@
+package server
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ollama/ollama/types/model"
+)
+
+// The registry routes implement the subset of the OCI distribution API used
+// by ollama to pull and push models, backed by the local model store. They
+// are only served when OLLAMA_REGISTRY is set.
+//
+// Repositories map to models of the default registry so models pushed to the
+// server can be run on it by their short name, and models it has pulled can
+// be pulled from it in turn.
+
+const manifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+
+func (s *Server) registryRoutes(r *gin.Engine) {
+	r.GET("/v2/", s.RegistryVersionHandler)
+	r.GET("/v2/_catalog", s.RegistryCatalogHandler)
+	r.GET("/v2/:namespace/:model/tags/list", s.RegistryTagsHandler)
+	r.HEAD("/v2/:namespace/:model/manifests/:tag", s.RegistryGetManifestHandler)
+	r.GET("/v2/:namespace/:model/manifests/:tag", s.RegistryGetManifestHandler)
+	r.PUT("/v2/:namespace/:model/manifests/:tag", s.RegistryPutManifestHandler)
+	r.HEAD("/v2/:namespace/:model/blobs/:digest", s.RegistryBlobHandler)
+	r.GET("/v2/:namespace/:model/blobs/:digest", s.RegistryBlobHandler)
+	r.POST("/v2/:namespace/:model/blobs/uploads/", s.RegistryStartUploadHandler)
+	r.PATCH("/v2/:namespace/:model/blobs/uploads/:id", s.RegistryUploadHandler)
+	r.PUT("/v2/:namespace/:model/blobs/uploads/:id", s.RegistryUploadHandler)
+}
+
+// registryError writes an error in the format defined by the distribution spec.
+func registryError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"errors": []gin.H{{"code": code, "message": message}}})
+}
+
+// registryName returns the name of the repository and tag of the request on
+// the default host, or the zero Name if they are not valid.
+func registryName(c *gin.Context) model.Name {
+	n, err := model.DefaultName().WithNamespace(c.Param("namespace"))
+	if err == nil {
+		n, err = n.WithModel(c.Param("model"))
+	}
+	if err == nil {
+		n, err = n.WithTag(cmp.Or(c.Param("tag"), "latest"))
+	}
+	if err != nil {
+		return model.Name{}
+	}
+
+	return n
+}
+
+// registryURL returns an absolute URL on this server since clients don't
+// resolve upload locations relative to the request.
+func registryURL(c *gin.Context, elem ...string) string {
+	u := url.URL{Scheme: "http", Host: c.Request.Host}
+	if c.Request.TLS != nil {
+		u.Scheme = "https"
+	}
+
+	return u.JoinPath(elem...).String()
+}
+
+func (s *Server) RegistryVersionHandler(c *gin.Context) {
+	c.Header("Docker-Distribution-API-Version", "registry/2.0")
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func (s *Server) RegistryCatalogHandler(c *gin.Context) {
+	ms, err := Manifests(true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	repositories := []string{}
+	for n := range ms {
+		if !strings.EqualFold(n.Host, DefaultRegistry) {
+			continue
+		}
+
+		repositories = append(repositories, n.Namespace+"/"+n.Model)
+	}
+
+	slices.Sort(repositories)
+	c.JSON(http.StatusOK, gin.H{"repositories": slices.Compact(repositories)})
+}
+
+func (s *Server) RegistryTagsHandler(c *gin.Context) {
+	ms, err := Manifests(true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	repository := registryName(c)
+
+	tags := []string{}
+	for n := range ms {
+		if strings.EqualFold(n.Host, repository.Host) && strings.EqualFold(n.Namespace, repository.Namespace) && strings.EqualFold(n.Model, repository.Model) {
+			tags = append(tags, n.Tag)
+		}
+	}
+
+	if len(tags) == 0 {
+		registryError(c, http.StatusNotFound, "NAME_UNKNOWN", fmt.Sprintf("repository %s/%s not found", repository.Namespace, repository.Model))
+		return
+	}
+
+	slices.Sort(tags)
+	c.JSON(http.StatusOK, gin.H{"name": repository.Namespace + "/" + repository.Model, "tags": tags})
+}
+
+func (s *Server) RegistryGetManifestHandler(c *gin.Context) {
+	n := registryName(c)
+	if !n.IsFullyQualified() {
+		registryError(c, http.StatusBadRequest, "NAME_INVALID", "invalid repository name")
+		return
+	}
+
+	m, err := ParseNamedManifest(n)
+	if errors.Is(err, os.ErrNotExist) {
+		registryError(c, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest %s not found", n.DisplayShortest()))
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	bts, err := os.ReadFile(m.filepath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Docker-Content-Digest", "sha256:"+m.digest)
+	c.Header("Content-Length", strconv.Itoa(len(bts)))
+	if c.Request.Method == http.MethodHead {
+		c.Header("Content-Type", manifestMediaType)
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Data(http.StatusOK, manifestMediaType, bts)
+}
+
+func (s *Server) RegistryPutManifestHandler(c *gin.Context) {
+	n := registryName(c)
+	if !n.IsFullyQualified() {
+		registryError(c, http.StatusBadRequest, "NAME_INVALID", "invalid repository name")
+		return
+	}
+
+	var m Manifest
+	if err := json.NewDecoder(c.Request.Body).Decode(&m); err != nil {
+		registryError(c, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+		return
+	}
+
+	// a manifest may only reference blobs that have been uploaded
+	for _, layer := range append(m.Layers, m.Config) {
+		p, err := GetBlobsPath(layer.Digest)
+		if err != nil {
+			registryError(c, http.StatusBadRequest, "DIGEST_INVALID", err.Error())
+			return
+		}
+
+		if fi, err := os.Stat(p); err != nil || fi.Size() != layer.Size {
+			registryError(c, http.StatusBadRequest, "BLOB_UNKNOWN", fmt.Sprintf("blob %s not found", layer.Digest))
+			return
+		}
+	}
+
+	if err := WriteManifest(n, m.Config, m.Layers); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Location", registryURL(c, "v2", c.Param("namespace"), c.Param("model"), "manifests", n.Tag))
+	c.Status(http.StatusCreated)
+}
+
+func (s *Server) RegistryBlobHandler(c *gin.Context) {
+	p, err := GetBlobsPath(c.Param("digest"))
+	if err != nil {
+		registryError(c, http.StatusBadRequest, "DIGEST_INVALID", err.Error())
+		return
+	}
+
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		registryError(c, http.StatusNotFound, "BLOB_UNKNOWN", fmt.Sprintf("blob %s not found", c.Param("digest")))
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Docker-Content-Digest", c.Param("digest"))
+	c.Header("Content-Type", "application/octet-stream")
+	http.ServeContent(c.Writer, c.Request, "", fi.ModTime(), f)
+}
+
+func uploadPath(id string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", err
+	}
+
+	blobs, err := GetBlobsPath("")
+	if err != nil {
+		return "", err
+	}
+
+	// uploads are kept with the blobs so they are moved into place without
+	// copying, and are pruned like partial downloads if abandoned
+	return filepath.Join(blobs, "upload-"+id), nil
+}
+
+func (s *Server) RegistryStartUploadHandler(c *gin.Context) {
+	// blobs are shared between all repositories so a blob that exists
+	// can always be mounted
+	if digest := c.Query("mount"); digest != "" {
+		if p, err := GetBlobsPath(digest); err == nil {
+			if _, err := os.Stat(p); err == nil {
+				c.Header("Location", registryURL(c, "v2", c.Param("namespace"), c.Param("model"), "blobs", digest))
+				c.Header("Docker-Content-Digest", digest)
+				c.Status(http.StatusCreated)
+				return
+			}
+		}
+	}
+
+	id := uuid.NewString()
+	p, err := uploadPath(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	f, err := os.Create(p)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	f.Close()
+
+	c.Header("Location", registryURL(c, "v2", c.Param("namespace"), c.Param("model"), "blobs", "uploads", id))
+	c.Header("Docker-Upload-UUID", id)
+	c.Header("Range", "0-0")
+	c.Status(http.StatusAccepted)
+}
+
+// RegistryUploadHandler writes a chunk of an upload for PATCH requests, and
+// writes the final chunk, if any, and commits the blob for PUT requests.
+func (s *Server) RegistryUploadHandler(c *gin.Context) {
+	p, err := uploadPath(c.Param("id"))
+	if err != nil {
+		registryError(c, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "upload not found")
+		return
+	}
+
+	f, err := os.OpenFile(p, os.O_RDWR, 0o644)
+	if errors.Is(err, os.ErrNotExist) {
+		registryError(c, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "upload not found")
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// chunks may be sent out of order so write at the offset given in the
+	// Content-Range header if there is one
+	if r := c.GetHeader("Content-Range"); r != "" {
+		start, _, _ := strings.Cut(strings.TrimPrefix(r, "bytes="), "-")
+		offset, err = strconv.ParseInt(start, 10, 64)
+		if err != nil || offset < 0 {
+			registryError(c, http.StatusRequestedRangeNotSatisfiable, "BLOB_UPLOAD_INVALID", "invalid content range")
+			return
+		}
+	}
+
+	if _, err := io.Copy(io.NewOffsetWriter(f, offset), c.Request.Body); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Request.Method == http.MethodPatch {
+		fi, err := f.Stat()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Location", registryURL(c, "v2", c.Param("namespace"), c.Param("model"), "blobs", "uploads", c.Param("id")))
+		c.Header("Docker-Upload-UUID", c.Param("id"))
+		c.Header("Range", fmt.Sprintf("0-%d", max(fi.Size()-1, 0)))
+		c.Status(http.StatusAccepted)
+		return
+	}
+
+	digest := c.Query("digest")
+	blob, err := GetBlobsPath(digest)
+	if err != nil || digest == "" {
+		registryError(c, http.StatusBadRequest, "DIGEST_INVALID", "invalid digest")
+		return
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	sha256sum := sha256.New()
+	if _, err := io.Copy(sha256sum, f); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// explicitly close the file so it can be renamed or removed
+	f.Close()
+
+	if fmt.Sprintf("sha256:%x", sha256sum.Sum(nil)) != digest {
+		os.Remove(p)
+		registryError(c, http.StatusBadRequest, "DIGEST_INVALID", "digest does not match uploaded content")
+		return
+	}
+
+	if err := os.Rename(p, blob); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Location", registryURL(c, "v2", c.Param("namespace"), c.Param("model"), "blobs", digest))
+	c.Header("Docker-Content-Digest", digest)
+	c.Status(http.StatusCreated)
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+func registryUpload(t *testing.T, base string, data []byte) Layer {
+	t.Helper()
+
+	resp, err := http.Post(base+"/v2/library/test/blobs/uploads/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d", resp.StatusCode)
+	}
+
+	// upload in two chunks, the second one first
+	location := resp.Header.Get("Location")
+	half := len(data) / 2
+	for _, chunk := range []struct{ start, end int }{{half, len(data)}, {0, half}} {
+		req, err := http.NewRequest(http.MethodPatch, location, bytes.NewReader(data[chunk.start:chunk.end]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", chunk.start, chunk.end-1))
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("expected status 202, got %d", resp.StatusCode)
+		}
+	}
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	req, err := http.NewRequest(http.MethodPut, location+"?digest="+url.QueryEscape(digest), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.StatusCode)
+	}
+
+	return Layer{MediaType: "application/vnd.ollama.image.model", Digest: digest, Size: int64(len(data))}
+}
+
+func TestRegistry(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_REGISTRY", "1")
+
+	var s Server
+	ts := httptest.NewServer(s.GenerateRoutes())
+	defer ts.Close()
+
+	layer := registryUpload(t, ts.URL, []byte("hello, registry"))
+	config := registryUpload(t, ts.URL, []byte(`{"model_format":"gguf"}`))
+	config.MediaType = "application/vnd.docker.container.image.v1+json"
+
+	t.Run("blob", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v2/library/test/blobs/"+layer.Digest, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Range", "bytes=7-")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		bts, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusPartialContent || string(bts) != "registry" {
+			t.Errorf("unexpected response %d %q", resp.StatusCode, bts)
+		}
+	})
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/v2/library/test/blobs/uploads/", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		req, err := http.NewRequest(http.MethodPut, resp.Header.Get("Location")+"?digest="+url.QueryEscape(layer.Digest), strings.NewReader("tampered"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", resp.StatusCode)
+		}
+	})
+
+	putManifest := func(layers []Layer) *http.Response {
+		t.Helper()
+
+		bts, err := json.Marshal(Manifest{SchemaVersion: 2, MediaType: manifestMediaType, Config: config, Layers: layers})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/v2/library/test/manifests/latest", bytes.NewReader(bts))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	t.Run("manifest with missing blob", func(t *testing.T) {
+		missing := Layer{MediaType: "application/vnd.ollama.image.model", Digest: "sha256:" + strings.Repeat("a", 64), Size: 1}
+		if resp := putManifest([]Layer{missing}); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", resp.StatusCode)
+		}
+	})
+
+	if resp := putManifest([]Layer{layer}); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.StatusCode)
+	}
+
+	t.Run("catalog", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/v2/_catalog")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var catalog struct {
+			Repositories []string `json:"repositories"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&catalog); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(catalog.Repositories) != 1 || catalog.Repositories[0] != "library/test" {
+			t.Errorf("unexpected repositories %v", catalog.Repositories)
+		}
+
+		resp, err = http.Get(ts.URL + "/v2/library/test/tags/list")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var tags struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(tags.Tags) != 1 || tags.Tags[0] != "latest" {
+			t.Errorf("unexpected tags %v", tags.Tags)
+		}
+	})
+
+	t.Run("pull", func(t *testing.T) {
+		u, err := url.Parse(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name := u.Host + "/library/test:latest"
+		if err := PullModel(context.Background(), name, &registryOptions{Insecure: true}, func(api.ProgressResponse) {}); err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := ParseNamedManifest(model.ParseName(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m.Layers) != 1 || m.Layers[0].Digest != layer.Digest {
+			t.Errorf("unexpected layers %v", m.Layers)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/types/model"
+)
+
+var (
+	errRouterNoClassifier = errors.New("router requires a classifier")
+	errRouterNoRoutes     = errors.New("router requires at least one route")
+	errNoRoute            = errors.New("no route matches the classification of the prompt")
+)
+
+// readRouter returns the router configuration of the model n, or nil if it
+// is not a router model.
+func readRouter(n model.Name) (*api.Router, error) {
+	m, err := ParseNamedManifest(n)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, layer := range m.Layers {
+		if layer.MediaType != "application/vnd.ollama.image.router" {
+			continue
+		}
+
+		f, err := layer.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		var rt api.Router
+		if err := json.NewDecoder(f).Decode(&rt); err != nil {
+			return nil, err
+		}
+
+		return &rt, nil
+	}
+
+	return nil, nil
+}
+
+// validateRouter checks that the classifier and the models of the routes of
+// rt exist, and that the routes are labels of the classifier if it names
+// them.
+func validateRouter(rt *api.Router) error {
+	if rt.Classifier == "" {
+		return errRouterNoClassifier
+	} else if len(rt.Routes) == 0 {
+		return errRouterNoRoutes
+	}
+
+	name, err := resolveName(model.ParseName(rt.Classifier))
+	if err != nil {
+		return err
+	}
+
+	classifier, err := GetModel(name.String())
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("classifier %q not found", rt.Classifier)
+	} else if err != nil {
+		return err
+	}
+
+	if err := classifier.CheckCapabilities(CapabilityClassification); err != nil {
+		return fmt.Errorf("classifier %q: %w", rt.Classifier, err)
+	}
+
+	ggml, err := llm.LoadModel(classifier.ModelPath, maxClassifierLabels)
+	if err != nil {
+		return err
+	}
+
+	labels := ggml.KV().ClassifierLabels()
+	for label, target := range rt.Routes {
+		if len(labels) > 0 && !slices.Contains(labels, label) {
+			return fmt.Errorf("route %q is not a label of classifier %q", label, rt.Classifier)
+		}
+
+		n, err := resolveName(model.ParseName(target))
+		if err != nil {
+			return err
+		}
+
+		if nested, err := readRouter(n); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("model %q of route %q not found", target, label)
+		} else if err != nil {
+			return err
+		} else if nested != nil {
+			return fmt.Errorf("model %q of route %q is a router", target, label)
+		}
+	}
+
+	return nil
+}
+
+// route classifies prompt with the classifier of rt and returns the model
+// of the most probable label that has a route.
+func (s *Server) route(ctx context.Context, rt *api.Router, prompt string) (model.Name, error) {
+	name, err := resolveName(model.ParseName(rt.Classifier))
+	if err != nil {
+		return model.Name{}, err
+	}
+
+	r, m, opts, err := s.scheduleRunner(ctx, name.String(), []Capability{CapabilityClassification}, "", nil, nil)
+	if err != nil {
+		return model.Name{}, err
+	}
+
+	ggml, err := llm.LoadModel(m.ModelPath, maxClassifierLabels)
+	if err != nil {
+		return model.Name{}, err
+	}
+
+	input := []string{prompt}
+	if _, err := truncateInputs(ctx, r, input, min(opts.NumCtx, int(ggml.KV().ContextLength())), true); err != nil {
+		return model.Name{}, err
+	}
+
+	logits, err := r.Embedding(ctx, input[0], nil)
+	if err != nil {
+		return model.Name{}, fmt.Errorf("failed to classify prompt: %w", err)
+	}
+
+	for _, p := range classify(logits, ggml.KV().ClassifierLabels()) {
+		if target, ok := rt.Routes[p.Label]; ok {
+			return resolveName(model.ParseName(target))
+		}
+	}
+
+	return model.Name{}, errNoRoute
+}
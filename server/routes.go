@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"cmp"
 	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -17,9 +18,9 @@ import (
 	"net/netip"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -30,21 +31,39 @@ import (
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/discover"
 	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/gemini"
+	"github.com/ollama/ollama/language"
 	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/logutil"
+	"github.com/ollama/ollama/markdown"
 	"github.com/ollama/ollama/model/mllama"
 	"github.com/ollama/ollama/openai"
 	"github.com/ollama/ollama/runners"
 	"github.com/ollama/ollama/template"
+	"github.com/ollama/ollama/tracing"
 	"github.com/ollama/ollama/types/errtypes"
 	"github.com/ollama/ollama/types/model"
 	"github.com/ollama/ollama/version"
+	"github.com/ollama/ollama/x/gguf"
 )
 
 var mode string = gin.DebugMode
 
 type Server struct {
-	addr  net.Addr
-	sched *Scheduler
+	addr          net.Addr
+	sched         *Scheduler
+	conversations *conversationStore
+	history       *historyStore
+	recovered     *recoverStore
+	prefixes      *prefixStore
+	tools         *toolRegistry
+	operations    *operationStore
+	transfers     *transferStore
+	idle          *idleTimer
+	acl           *accessList
+	metrics       *metricsStore
+	health        *healthMonitor
 }
 
 func init() {
@@ -60,18 +79,56 @@ func init() {
 }
 
 var (
-	errRequired    = errors.New("is required")
-	errBadTemplate = errors.New("template error")
+	errRequired            = errors.New("is required")
+	errBadTemplate         = errors.New("template error")
+	errUnknownProfile      = errors.New("unknown profile")
+	errUnsupportedLanguage = errors.New("unsupported language")
+	errUnknownWatchdog     = errors.New("unknown watchdog")
 )
 
-func modelOptions(model *Model, requestOpts map[string]interface{}) (api.Options, error) {
+// modelOptions layers the model's parameters, the parameters of the selected
+// profile, if any, and the request options, in increasing order of precedence.
+func modelOptions(model *Model, profile string, requestOpts map[string]interface{}) (api.Options, error) {
 	opts := api.DefaultOptions()
-	if err := opts.FromMap(model.Options); err != nil {
-		return api.Options{}, err
+	layers := []map[string]any{model.Options}
+	if profile != "" {
+		p, ok := model.Profiles[profile]
+		if !ok {
+			return api.Options{}, fmt.Errorf("%w '%s'", errUnknownProfile, profile)
+		}
+
+		layers = append(layers, p)
 	}
+	layers = append(layers, requestOpts)
 
-	if err := opts.FromMap(requestOpts); err != nil {
-		return api.Options{}, err
+	numCtxSet := false
+	for _, m := range layers {
+		if err := opts.FromMap(m); err != nil {
+			return api.Options{}, err
+		}
+
+		_, ok := m["num_ctx"]
+		numCtxSet = numCtxSet || ok
+	}
+
+	// num_ctx set by the model, profile or request takes precedence
+	if !numCtxSet {
+		numCtx, err := defaultContextLength(model, loadParallel(model, opts))
+		if err != nil {
+			return api.Options{}, err
+		} else if numCtx > 0 {
+			opts.NumCtx = numCtx
+		}
+	}
+
+	if opts.Language != "" && !language.Supported(opts.Language) {
+		return api.Options{}, fmt.Errorf("%w '%s'", errUnsupportedLanguage, opts.Language)
+	}
+
+	switch opts.Watchdog {
+	case "", "off", "warn", "stop":
+	default:
+		return api.Options{}, fmt.Errorf("%w '%s'; expected \"warn\" or \"stop\"", errUnknownWatchdog, opts.Watchdog)
 	}
 
 	return opts, nil
@@ -79,11 +136,15 @@ func modelOptions(model *Model, requestOpts map[string]interface{}) (api.Options
 
 // scheduleRunner schedules a runner after validating inputs such as capabilities and model options.
 // It returns the allocated runner, model instance, and consolidated options if successful and error otherwise.
-func (s *Server) scheduleRunner(ctx context.Context, name string, caps []Capability, requestOpts map[string]any, keepAlive *api.Duration) (llm.LlamaServer, *Model, *api.Options, error) {
+func (s *Server) scheduleRunner(ctx context.Context, name string, caps []Capability, profile string, requestOpts map[string]any, keepAlive *api.Duration) (llm.LlamaServer, *Model, *api.Options, error) {
 	if name == "" {
 		return nil, nil, nil, fmt.Errorf("model %w", errRequired)
 	}
 
+	if err := s.acl.check(ctx, aclRun, model.ParseName(name)); err != nil {
+		return nil, nil, nil, err
+	}
+
 	model, err := GetModel(name)
 	if err != nil {
 		return nil, nil, nil, err
@@ -93,16 +154,26 @@ func (s *Server) scheduleRunner(ctx context.Context, name string, caps []Capabil
 		return nil, nil, nil, fmt.Errorf("%s %w", name, err)
 	}
 
-	opts, err := modelOptions(model, requestOpts)
+	opts, err := modelOptions(model, profile, requestOpts)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	runnerCh, errCh := s.sched.GetRunner(ctx, model, opts, keepAlive)
+	// waiting for a runner is queueing unless it has a load span
+	ctx, span := tracing.Start(ctx, "schedule", tracing.String("model", name))
+	defer span.End()
+
+	if err := injectLoad(ctx); err != nil {
+		span.SetError(err)
+		return nil, nil, nil, err
+	}
+
+	runnerCh, errCh := s.sched.GetRunner(ctx, model, opts, cmp.Or(keepAlive, model.Config.KeepAlive))
 	var runner *runnerRef
 	select {
 	case runner = <-runnerCh:
 	case err = <-errCh:
+		span.SetError(err)
 		return nil, nil, nil, err
 	}
 
@@ -120,6 +191,23 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		return
 	}
 
+	// reject formats the runner can't constrain output to before loading
+	// the model
+	if _, err := llm.FormatGrammar(req.Format); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := checkLogprobs(req.Logprobs, req.TopLogprobs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := checkRecover(req.Recover); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	name := model.ParseName(req.Model)
 	if !name.IsValid() {
 		// Ideally this is "invalid model name" but we're keeping with
@@ -130,7 +218,7 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 
 	// We cannot currently consolidate this into GetModel because all we'll
 	// induce infinite recursion given the current code structure.
-	name, err := getExistingName(name)
+	name, err := resolveName(name)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
 		return
@@ -150,7 +238,7 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 	}
 
 	// expire the runner
-	if req.Prompt == "" && req.KeepAlive != nil && int(req.KeepAlive.Seconds()) == 0 {
+	if req.Prompt == "" && len(req.Tokens) == 0 && req.KeepAlive != nil && int(req.KeepAlive.Seconds()) == 0 {
 		s.sched.expireRunner(model)
 
 		c.JSON(http.StatusOK, api.GenerateResponse{
@@ -168,25 +256,92 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		return
 	}
 
+	if len(req.Tokens) > 0 && (req.Prompt != "" || req.Suffix != "" || req.Template != "" || req.System != "" || req.Prefix != "" || len(req.Context) > 0 || len(req.Images) > 0) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "tokens cannot be combined with prompt, suffix, template, system, prefix, context, or images"})
+		return
+	}
+
+	if req.Prefix != "" && req.System == "" {
+		system, ok := s.resolvePrefix(c, req.Prefix, name)
+		if !ok {
+			return
+		}
+		req.System = system
+	}
+
+	var routedTo string
+	if model.Router != nil {
+		if len(req.Tokens) > 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "tokens are not supported by router models"})
+			return
+		}
+
+		if req.Prompt == "" {
+			c.JSON(http.StatusOK, api.GenerateResponse{
+				Model:      req.Model,
+				CreatedAt:  time.Now().UTC(),
+				Done:       true,
+				DoneReason: "load",
+			})
+			return
+		}
+
+		name, err = s.route(c.Request.Context(), model.Router, req.Prompt)
+		if err != nil {
+			handleScheduleError(c, req.Model, err)
+			return
+		}
+
+		if model, err = GetModel(name.String()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		routedTo = name.DisplayShortest()
+	}
+
+	stream := req.Stream == nil || *req.Stream
+	render, err := renderFormat(c, req.Render, stream)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	caps := []Capability{CapabilityCompletion}
 	if req.Suffix != "" {
 		caps = append(caps, CapabilityInsert)
 	}
+	if len(req.Images) > 0 {
+		caps = append(caps, CapabilityVision)
+	}
+
+	var loadStreamed bool
+	var progressFn func(api.LoadEvent)
+	if req.Stream == nil || *req.Stream {
+		progressFn = func(e api.LoadEvent) {
+			loadStreamed = true
+			writeStreamed(c, api.GenerateResponse{Model: req.Model, CreatedAt: time.Now().UTC(), Load: &e})
+		}
+	}
 
-	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), caps, req.Options, req.KeepAlive)
+	r, m, opts, err := s.scheduleRunnerWithProgress(c.Request.Context(), name.String(), caps, req.Profile, req.Options, req.KeepAlive, progressFn)
 	if errors.Is(err, errCapabilityCompletion) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support generate", req.Model)})
 		return
+	} else if err != nil && loadStreamed {
+		writeStreamed(c, gin.H{"error": err.Error()})
+		return
 	} else if err != nil {
 		handleScheduleError(c, req.Model, err)
 		return
 	}
 
 	checkpointLoaded := time.Now()
+	queueDuration := checkpointLoaded.Sub(checkpointStart) - s.sched.loadDuration(m, checkpointStart, checkpointLoaded)
 
 	// load the model
-	if req.Prompt == "" {
-		c.JSON(http.StatusOK, api.GenerateResponse{
+	if req.Prompt == "" && len(req.Tokens) == 0 {
+		respond(c, http.StatusOK, api.GenerateResponse{
 			Model:      req.Model,
 			CreatedAt:  time.Now().UTC(),
 			Done:       true,
@@ -195,9 +350,15 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		return
 	}
 
+	adapter, err := resolveAdapter(m, req.Adapter)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	isMllama := checkMllamaModelFamily(model)
 	if isMllama && len(req.Images) > 1 {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "this model only supports one image: more than one image sent"})
+		respond(c, http.StatusBadRequest, gin.H{"error": "this model only supports one image: more than one image sent"})
 		return
 	}
 
@@ -206,20 +367,20 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		if isMllama {
 			data, opts, err := mllama.Preprocess(bytes.NewReader(req.Images[i]))
 			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "error processing image"})
+				respond(c, http.StatusInternalServerError, gin.H{"error": "error processing image"})
 				return
 			}
 
 			ar, ok := opts["aspectRatioIndex"].(int)
 			if !ok {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "error processing image"})
+				respond(c, http.StatusInternalServerError, gin.H{"error": "error processing image"})
 				return
 			}
 
 			buf := new(bytes.Buffer)
 			err = binary.Write(buf, binary.LittleEndian, data)
 			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "error processing image"})
+				respond(c, http.StatusInternalServerError, gin.H{"error": "error processing image"})
 				return
 			}
 
@@ -230,17 +391,18 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 	}
 
 	prompt := req.Prompt
-	if !req.Raw {
+	var prefix string
+	if !req.Raw && len(req.Tokens) == 0 {
 		tmpl := m.Template
 		if req.Template != "" {
 			tmpl, err = template.Parse(req.Template)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
 		}
 
-		var values template.Values
+		values := template.Values{Metadata: template.NewMetadata(m.ShortName, req.Variables)}
 		if req.Suffix != "" {
 			values.Prompt = prompt
 			values.Suffix = req.Suffix
@@ -249,7 +411,7 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 			if req.System != "" {
 				msgs = append(msgs, api.Message{Role: "system", Content: req.System})
 			} else if m.System != "" {
-				msgs = append(msgs, api.Message{Role: "system", Content: m.System})
+				msgs = append(msgs, api.Message{Role: "system", Content: template.Expand(m.System, values.Metadata)})
 			}
 
 			if req.Context == nil {
@@ -269,35 +431,47 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 
 		var b bytes.Buffer
 		if req.Context != nil {
-			slog.Warn("the context field is deprecated and will be removed in a future version of Ollama")
+			slog.WarnContext(c.Request.Context(), "the context field is deprecated and will be removed in a future version of Ollama")
 			s, err := r.Detokenize(c.Request.Context(), req.Context)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
 			b.WriteString(s)
 		}
 
 		if err := tmpl.Execute(&b, values); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
 		prompt = b.String()
+		if req.Context == nil {
+			prefix = cachePrefix(tmpl, values.Messages, nil, values.Metadata, prompt)
+		}
 	}
 
-	slog.Debug("generate request", "images", len(images), "prompt", prompt)
+	slog.DebugContext(c.Request.Context(), "generate request", "images", len(images), "prompt", prompt, "tokens", len(req.Tokens))
 
+	ctx, cancel := s.recoverContext(c, req.Recover)
 	ch := make(chan any)
 	go func() {
 		// TODO (jmorganca): avoid building the response twice both here and below
 		var sb strings.Builder
 		defer close(ch)
-		if err := r.Completion(c.Request.Context(), llm.CompletionRequest{
-			Prompt:  prompt,
-			Images:  images,
-			Format:  req.Format,
-			Options: opts,
+		if err := r.Completion(ctx, llm.CompletionRequest{
+			Prompt:       prompt,
+			Images:       images,
+			Format:       req.Format,
+			Options:      opts,
+			Checkpoint:   req.Checkpoint,
+			Session:      req.SessionID,
+			CachePrefix:  prefix,
+			Tokens:       req.Tokens,
+			ReturnTokens: req.ReturnTokens,
+			Adapter:      adapter,
+			Logprobs:     req.Logprobs,
+			TopLogprobs:  req.TopLogprobs,
 		}, func(cr llm.CompletionResponse) {
 			res := api.GenerateResponse{
 				Model:      req.Model,
@@ -305,9 +479,14 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 				Response:   cr.Content,
 				Done:       cr.Done,
 				DoneReason: cr.DoneReason,
+				RoutedTo:   routedTo,
+				Tokens:     cr.Tokens,
+				Logprobs:   cr.Logprobs,
+				Degenerate: cr.Degenerate,
 				Metrics: api.Metrics{
 					PromptEvalCount:    cr.PromptEvalCount,
 					PromptEvalDuration: cr.PromptEvalDuration,
+					PromptCacheCount:   cr.PromptCacheCount,
 					EvalCount:          cr.EvalCount,
 					EvalDuration:       cr.EvalDuration,
 				},
@@ -320,9 +499,29 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 			if cr.Done {
 				res.TotalDuration = time.Since(checkpointStart)
 				res.LoadDuration = checkpointLoaded.Sub(checkpointStart)
+				res.QueueDuration = queueDuration
 
-				if !req.Raw {
-					tokens, err := r.Tokenize(c.Request.Context(), prompt+sb.String())
+				if opts.Language != "" || opts.DetectLanguage {
+					res.Language = language.Detect(sb.String())
+				}
+
+				s.metrics.observe(m.ShortName, res.Metrics)
+				s.acl.consume(c.Request.Context(), res.PromptEvalCount+res.EvalCount)
+				s.history.record(api.HistoryEntry{
+					Endpoint:        "generate",
+					Model:           req.Model,
+					User:            userName(c.Request.Context()),
+					PromptHash:      promptHash(prompt),
+					DoneReason:      cr.DoneReason,
+					TotalDuration:   res.TotalDuration,
+					PromptEvalCount: cr.PromptEvalCount,
+					EvalCount:       cr.EvalCount,
+					Prompt:          prompt,
+					Response:        sb.String(),
+				})
+
+				if !req.Raw && len(req.Tokens) == 0 {
+					tokens, err := r.Tokenize(ctx, prompt+sb.String())
 					if err != nil {
 						ch <- gin.H{"error": err.Error()}
 						return
@@ -333,19 +532,27 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 
 			ch <- res
 		}); err != nil {
-			ch <- gin.H{"error": err.Error()}
+			ch <- completionError(err)
 		}
 	}()
 
+	out := injectStream(c, s.recoverable(c, req.Recover, cancel, ch))
 	if req.Stream != nil && !*req.Stream {
 		var r api.GenerateResponse
 		var sb strings.Builder
-		for rr := range ch {
+		var logprobs []api.Logprob
+		for rr := range out {
 			switch t := rr.(type) {
 			case api.GenerateResponse:
 				sb.WriteString(t.Response)
+				logprobs = append(logprobs, t.Logprobs...)
 				r = t
 			case gin.H:
+				if _, ok := t["format_error"]; ok {
+					c.JSON(http.StatusUnprocessableEntity, t)
+					return
+				}
+
 				msg, ok := t["error"].(string)
 				if !ok {
 					msg = "unexpected error format in response"
@@ -359,12 +566,67 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 			}
 		}
 
-		r.Response = sb.String()
-		c.JSON(http.StatusOK, r)
+		r.Response, err = markdown.Render(render, sb.String(), nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		r.Logprobs = logprobs
+
+		switch c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML, gin.MIMEPlain) {
+		case gin.MIMEHTML:
+			c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(r.Response))
+		case gin.MIMEPlain:
+			c.String(http.StatusOK, r.Response)
+		default:
+			c.JSON(http.StatusOK, r)
+		}
 		return
 	}
 
-	streamResponse(c, ch)
+	streamResponse(c, coalesce(c, req.Coalesce, out))
+}
+
+// maxTopLogprobs is the largest number of alternatives that can be returned
+// with the log probability of a token.
+const maxTopLogprobs = 20
+
+// checkLogprobs validates the logprobs and top_logprobs fields of a request.
+func checkLogprobs(logprobs bool, topLogprobs int) error {
+	switch {
+	case topLogprobs < 0 || topLogprobs > maxTopLogprobs:
+		return fmt.Errorf("top_logprobs must be between 0 and %d", maxTopLogprobs)
+	case topLogprobs > 0 && !logprobs:
+		return errors.New("top_logprobs requires logprobs")
+	}
+
+	return nil
+}
+
+// renderFormat resolves the output format for a generate request from the
+// render field, falling back to the Accept header for non-streaming requests.
+func renderFormat(c *gin.Context, render string, stream bool) (string, error) {
+	switch render {
+	case "", markdown.FormatMarkdown:
+	case markdown.FormatHTML, markdown.FormatPlain:
+		if stream {
+			return "", errors.New("render is not supported for streaming responses")
+		}
+		return render, nil
+	default:
+		return "", fmt.Errorf("invalid render format %q", render)
+	}
+
+	if !stream {
+		switch c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML, gin.MIMEPlain) {
+		case gin.MIMEHTML:
+			return markdown.FormatHTML, nil
+		case gin.MIMEPlain:
+			return markdown.FormatPlain, nil
+		}
+	}
+
+	return render, nil
 }
 
 func (s *Server) EmbedHandler(c *gin.Context) {
@@ -386,35 +648,28 @@ func (s *Server) EmbedHandler(c *gin.Context) {
 		truncate = false
 	}
 
-	var input []string
+	inputs, err := embedInputs(req.Input)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	switch i := req.Input.(type) {
-	case string:
-		if len(i) > 0 {
-			input = append(input, i)
-		}
-	case []any:
-		for _, v := range i {
-			if _, ok := v.(string); !ok {
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input type"})
-				return
-			}
-			input = append(input, v.(string))
-		}
-	default:
-		if req.Input != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid input type"})
-			return
+	caps := []Capability{}
+	input := make([]string, len(inputs))
+	for i, in := range inputs {
+		input[i] = in.Text
+		if len(in.Images) > 0 && !slices.Contains(caps, CapabilityVision) {
+			caps = append(caps, CapabilityVision)
 		}
 	}
 
-	name, err := getExistingName(model.ParseName(req.Model))
+	name, err := resolveName(model.ParseName(req.Model))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
 		return
 	}
 
-	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), []Capability{}, req.Options, req.KeepAlive)
+	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), caps, req.Profile, req.Options, req.KeepAlive)
 	if err != nil {
 		handleScheduleError(c, req.Model, err)
 		return
@@ -427,67 +682,325 @@ func (s *Server) EmbedHandler(c *gin.Context) {
 		return
 	}
 
-	kvData, err := getKVData(m.ModelPath, false)
+	f, err := gguf.Open(m.ModelPath)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	var count int
+	counts, err := truncateInputs(c.Request.Context(), r, input, min(opts.NumCtx, int(f.ContextLength())), truncate)
+	if errors.Is(err, errInputTooLong) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// a batch size limits how many inputs are sent to the runner at once,
+	// otherwise they're all queued on it together
+	var g errgroup.Group
+	if req.BatchSize > 0 {
+		g.SetLimit(req.BatchSize)
+	}
+
+	embeddings := make([][]float32, len(input))
+	for i, text := range input {
+		g.Go(func() error {
+			prompt, images := embedPrompt(text, inputs[i].Images)
+			embedding, err := r.Embedding(c.Request.Context(), prompt, images)
+			if err != nil {
+				return err
+			}
+			embeddings[i] = normalize(embedding)
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		slog.ErrorContext(c.Request.Context(), "embedding generation failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Errorf("failed to generate embeddings: %v", err)})
+		return
+	}
+
+	resp := api.EmbedResponse{
+		Model:            req.Model,
+		Embeddings:       embeddings,
+		TotalDuration:    time.Since(checkpointStart),
+		LoadDuration:     checkpointLoaded.Sub(checkpointStart),
+		PromptEvalCount:  sum(counts),
+		PromptEvalCounts: counts,
+	}
+	s.acl.consume(c.Request.Context(), resp.PromptEvalCount)
+	c.JSON(http.StatusOK, resp)
+}
+
+var errInputTooLong = errors.New("input length exceeds maximum context length")
+
+func sum(counts []int) int {
+	var n int
+	for _, count := range counts {
+		n += count
+	}
+
+	return n
+}
+
+// inputStrings returns the inputs of an embed or classify request, which
+// may be a string or a list of strings.
+func inputStrings(v any) ([]string, error) {
+	var input []string
+
+	switch i := v.(type) {
+	case string:
+		if len(i) > 0 {
+			input = append(input, i)
+		}
+	case []any:
+		for _, v := range i {
+			if _, ok := v.(string); !ok {
+				return nil, errors.New("invalid input type")
+			}
+			input = append(input, v.(string))
+		}
+	default:
+		if v != nil {
+			return nil, errors.New("invalid input type")
+		}
+	}
+
+	return input, nil
+}
+
+// embedInputs returns the inputs of an embed request, which may be a string,
+// an object with text and images, or a list of either.
+func embedInputs(v any) ([]api.EmbedInput, error) {
+	var inputs []api.EmbedInput
+
+	switch i := v.(type) {
+	case string:
+		if len(i) > 0 {
+			inputs = append(inputs, api.EmbedInput{Text: i})
+		}
+	case map[string]any:
+		input, err := embedInput(i)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input)
+	case []any:
+		for _, v := range i {
+			switch v := v.(type) {
+			case string:
+				inputs = append(inputs, api.EmbedInput{Text: v})
+			case map[string]any:
+				input, err := embedInput(v)
+				if err != nil {
+					return nil, err
+				}
+				inputs = append(inputs, input)
+			default:
+				return nil, errors.New("invalid input type")
+			}
+		}
+	default:
+		if v != nil {
+			return nil, errors.New("invalid input type")
+		}
+	}
+
+	return inputs, nil
+}
+
+func embedInput(m map[string]any) (api.EmbedInput, error) {
+	var input api.EmbedInput
+	bts, err := json.Marshal(m)
+	if err != nil {
+		return input, err
+	}
+
+	if err := json.Unmarshal(bts, &input); err != nil {
+		return input, fmt.Errorf("invalid input: %w", err)
+	}
+
+	if input.Text == "" && len(input.Images) == 0 {
+		return input, errors.New("invalid input: text or images are required")
+	}
+
+	return input, nil
+}
+
+// embedPrompt returns the prompt embedding text along with images, which
+// are referenced by [img-N] tags ahead of the text as in a chat prompt.
+func embedPrompt(text string, images []api.ImageData) (string, []llm.ImageData) {
+	var sb strings.Builder
+	var imgs []llm.ImageData
+	for i, img := range images {
+		fmt.Fprintf(&sb, "[img-%d]", i)
+		imgs = append(imgs, llm.ImageData{ID: i, Data: img})
+	}
+
+	sb.WriteString(text)
+	return sb.String(), imgs
+}
+
+// truncateInputs truncates each input in place to ctxLen tokens, or returns
+// errInputTooLong if truncate is false. It returns the number of tokens of
+// each input.
+func truncateInputs(ctx context.Context, r llm.LlamaServer, input []string, ctxLen int, truncate bool) ([]int, error) {
+	counts := make([]int, len(input))
 	for i, s := range input {
-		tokens, err := r.Tokenize(c.Request.Context(), s)
+		tokens, err := r.Tokenize(ctx, s)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return nil, err
 		}
 
-		ctxLen := min(opts.NumCtx, int(kvData.ContextLength()))
 		if len(tokens) > ctxLen {
 			if !truncate {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "input length exceeds maximum context length"})
-				return
+				return nil, errInputTooLong
 			}
 
 			tokens = tokens[:ctxLen]
-			s, err = r.Detokenize(c.Request.Context(), tokens)
+			s, err = r.Detokenize(ctx, tokens)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
+				return nil, err
 			}
 		}
 
-		count += len(tokens)
+		counts[i] = len(tokens)
 
 		input[i] = s
 	}
 
+	return counts, nil
+}
+
+// maxClassifierLabels limits the size of the arrays decoded when reading the
+// labels of a classification head so the vocabulary is skipped.
+const maxClassifierLabels = 4096
+
+func (s *Server) ClassifyHandler(c *gin.Context) {
+	checkpointStart := time.Now()
+	var req api.ClassifyRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	truncate := req.Truncate == nil || *req.Truncate
+
+	input, err := inputStrings(req.Input)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name, err := resolveName(model.ParseName(req.Model))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+
+	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), []Capability{CapabilityClassification}, req.Profile, req.Options, req.KeepAlive)
+	if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	checkpointLoaded := time.Now()
+
+	if len(input) == 0 {
+		c.JSON(http.StatusOK, api.ClassifyResponse{Model: req.Model, Classifications: [][]api.LabelProbability{}})
+		return
+	}
+
+	ggml, err := llm.LoadModel(m.ModelPath, maxClassifierLabels)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	counts, err := truncateInputs(c.Request.Context(), r, input, min(opts.NumCtx, int(ggml.KV().ContextLength())), truncate)
+	if errors.Is(err, errInputTooLong) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	labels := ggml.KV().ClassifierLabels()
+
 	var g errgroup.Group
-	embeddings := make([][]float32, len(input))
+	classifications := make([][]api.LabelProbability, len(input))
 	for i, text := range input {
 		g.Go(func() error {
-			embedding, err := r.Embedding(c.Request.Context(), text)
+			logits, err := r.Embedding(c.Request.Context(), text, nil)
 			if err != nil {
 				return err
 			}
-			embeddings[i] = normalize(embedding)
+			classifications[i] = classify(logits, labels)
 			return nil
 		})
 	}
 
 	if err := g.Wait(); err != nil {
-		slog.Error("embedding generation failed", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Errorf("failed to generate embeddings: %v", err)})
+		slog.ErrorContext(c.Request.Context(), "classification failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to classify input: %v", err)})
 		return
 	}
 
-	resp := api.EmbedResponse{
+	s.acl.consume(c.Request.Context(), sum(counts))
+	c.JSON(http.StatusOK, api.ClassifyResponse{
 		Model:           req.Model,
-		Embeddings:      embeddings,
+		Classifications: classifications,
 		TotalDuration:   time.Since(checkpointStart),
 		LoadDuration:    checkpointLoaded.Sub(checkpointStart),
-		PromptEvalCount: count,
+		PromptEvalCount: sum(counts),
+	})
+}
+
+// classify converts the logits of a classification head to label
+// probabilities, most probable first. A single logit is a binary score and
+// uses a sigmoid; otherwise the logits are normalized with softmax. Labels
+// missing from the model are named like Hugging Face does: LABEL_0, LABEL_1...
+func classify(logits []float32, labels []string) []api.LabelProbability {
+	probs := make([]api.LabelProbability, len(logits))
+	if len(logits) == 1 {
+		probs[0].Probability = float32(1 / (1 + math.Exp(-float64(logits[0]))))
+	} else if len(logits) > 1 {
+		maxLogit := slices.Max(logits)
+
+		exps := make([]float64, len(logits))
+		var sum float64
+		for i, l := range logits {
+			exps[i] = math.Exp(float64(l - maxLogit))
+			sum += exps[i]
+		}
+
+		for i, e := range exps {
+			probs[i].Probability = float32(e / sum)
+		}
 	}
-	c.JSON(http.StatusOK, resp)
+
+	for i := range probs {
+		if i < len(labels) && labels[i] != "" {
+			probs[i].Label = labels[i]
+		} else {
+			probs[i].Label = fmt.Sprintf("LABEL_%d", i)
+		}
+	}
+
+	slices.SortStableFunc(probs, func(a, b api.LabelProbability) int {
+		return cmp.Compare(b.Probability, a.Probability)
+	})
+
+	return probs
 }
 
 func normalize(vec []float32) []float32 {
@@ -523,7 +1036,13 @@ func (s *Server) EmbeddingsHandler(c *gin.Context) {
 		return
 	}
 
-	r, _, _, err := s.scheduleRunner(c.Request.Context(), name.String(), []Capability{}, req.Options, req.KeepAlive)
+	name, err := resolveName(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+
+	r, _, _, err := s.scheduleRunner(c.Request.Context(), name.String(), []Capability{}, "", req.Options, req.KeepAlive)
 	if err != nil {
 		handleScheduleError(c, req.Model, err)
 		return
@@ -535,9 +1054,9 @@ func (s *Server) EmbeddingsHandler(c *gin.Context) {
 		return
 	}
 
-	embedding, err := r.Embedding(c.Request.Context(), req.Prompt)
+	embedding, err := r.Embedding(c.Request.Context(), req.Prompt, nil)
 	if err != nil {
-		slog.Info(fmt.Sprintf("embedding generation failed: %v", err))
+		slog.InfoContext(c.Request.Context(), fmt.Sprintf("embedding generation failed: %v", err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Errorf("failed to generate embedding: %v", err)})
 		return
 	}
@@ -565,9 +1084,12 @@ func (s *Server) PullHandler(c *gin.Context) {
 		return
 	}
 
-	name := model.ParseName(cmp.Or(req.Model, req.Name))
-	if !name.IsValid() {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errtypes.InvalidModelNameErrMsg})
+	name, err := model.ParseNameStrict(cmp.Or(req.Model, req.Name))
+	if err == nil && name.HasDigest() {
+		err = errNameDigest
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %v", errtypes.InvalidModelNameErrMsg, err)})
 		return
 	}
 
@@ -577,24 +1099,33 @@ func (s *Server) PullHandler(c *gin.Context) {
 		return
 	}
 
-	ch := make(chan any)
-	go func() {
-		defer close(ch)
-		fn := func(r api.ProgressResponse) {
-			ch <- r
-		}
+	if err := s.acl.check(c.Request.Context(), aclPull, name); err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 
+	ch, ok := s.startOperation(c, req, func(ctx context.Context, ch chan<- any) {
 		regOpts := &registryOptions{
 			Insecure: req.Insecure,
+			Username: req.Username,
+			Password: req.Password,
 		}
 
-		ctx, cancel := context.WithCancel(c.Request.Context())
-		defer cancel()
+		ctx, progress, done := s.transfers.start(ctx, "pull", name.DisplayShortest())
+		defer done()
+
+		fn := func(r api.ProgressResponse) {
+			progress(r)
+			ch <- r
+		}
 
 		if err := PullModel(ctx, name.DisplayShortest(), regOpts, fn); err != nil {
-			ch <- gin.H{"error": err.Error()}
+			ch <- transferError(ctx, "pull", err)
 		}
-	}()
+	})
+	if !ok {
+		return
+	}
 
 	if req.Stream != nil && !*req.Stream {
 		waitForStream(c, ch)
@@ -626,30 +1157,44 @@ func (s *Server) PushHandler(c *gin.Context) {
 		return
 	}
 
-	ch := make(chan any)
-	go func() {
-		defer close(ch)
-		fn := func(r api.ProgressResponse) {
-			ch <- r
-		}
+	if model.ParseName(mname).HasDigest() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %v", errtypes.InvalidModelNameErrMsg, errNameDigest)})
+		return
+	}
+
+	if err := s.acl.checkSource(c.Request.Context(), model.ParseName(mname)); err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 
+	ch, ok := s.startOperation(c, req, func(ctx context.Context, ch chan<- any) {
 		regOpts := &registryOptions{
 			Insecure: req.Insecure,
+			Username: req.Username,
+			Password: req.Password,
 		}
 
-		ctx, cancel := context.WithCancel(c.Request.Context())
-		defer cancel()
-
 		name, err := getExistingName(model.ParseName(mname))
 		if err != nil {
 			ch <- gin.H{"error": err.Error()}
 			return
 		}
 
+		ctx, progress, done := s.transfers.start(ctx, "push", name.DisplayShortest())
+		defer done()
+
+		fn := func(r api.ProgressResponse) {
+			progress(r)
+			ch <- r
+		}
+
 		if err := PushModel(ctx, name.DisplayShortest(), regOpts, fn); err != nil {
-			ch <- gin.H{"error": err.Error()}
+			ch <- transferError(ctx, "push", err)
 		}
-	}()
+	})
+	if !ok {
+		return
+	}
 
 	if req.Stream != nil && !*req.Stream {
 		waitForStream(c, ch)
@@ -659,6 +1204,10 @@ func (s *Server) PushHandler(c *gin.Context) {
 	streamResponse(c, ch)
 }
 
+// errNameDigest is returned for names with a digest where a model is
+// written or transferred by its tag, which a digest can't select.
+var errNameDigest = errors.New("digests can only be used to refer to existing models")
+
 // getExistingName searches the models directory for the longest prefix match of
 // the input name and returns the input name with all existing parts replaced
 // with each part found. If no parts are found, the input name is returned as
@@ -703,31 +1252,52 @@ func (s *Server) DeleteHandler(c *gin.Context) {
 		return
 	}
 
-	n, err := getExistingName(n)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", cmp.Or(r.Model, r.Name))})
+	if err := s.acl.check(c.Request.Context(), aclDelete, n); err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	m, err := ParseNamedManifest(n)
-	if err != nil {
-		switch {
-		case os.IsNotExist(err):
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", cmp.Or(r.Model, r.Name))})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	ch, ok := s.startOperation(c, r, func(_ context.Context, ch chan<- any) {
+		n, err := getExistingName(n)
+		if err != nil {
+			ch <- gin.H{"error": fmt.Sprintf("model '%s' not found", cmp.Or(r.Model, r.Name)), "status": http.StatusNotFound}
+			return
 		}
-		return
-	}
 
-	if err := m.Remove(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		m, err := ParseNamedManifest(n)
+		if err != nil {
+			switch {
+			case os.IsNotExist(err):
+				ch <- gin.H{"error": fmt.Sprintf("model '%s' not found", cmp.Or(r.Model, r.Name)), "status": http.StatusNotFound}
+			default:
+				ch <- gin.H{"error": err.Error()}
+			}
+			return
+		}
+
+		if err := m.Remove(); err != nil {
+			ch <- gin.H{"error": err.Error()}
+			return
+		}
+
+		if err := m.RemoveLayers(); err != nil {
+			ch <- gin.H{"error": err.Error()}
+			return
+		}
+	})
+	if !ok {
 		return
 	}
 
-	if err := m.RemoveLayers(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	for resp := range ch {
+		if h, ok := resp.(gin.H); ok {
+			status, ok := h["status"].(int)
+			if !ok {
+				status = http.StatusInternalServerError
+			}
+			c.JSON(status, gin.H{"error": h["error"]})
+			return
+		}
 	}
 }
 
@@ -773,7 +1343,7 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 	if !name.IsValid() {
 		return nil, errModelPathInvalid
 	}
-	name, err := getExistingName(name)
+	name, err := resolveName(name)
 	if err != nil {
 		return nil, err
 	}
@@ -812,7 +1382,17 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 		Template:   m.Template.String(),
 		Details:    modelDetails,
 		Messages:   msgs,
+		Profiles:   m.Profiles,
+		Router:     m.Router,
 		ModifiedAt: manifest.fi.ModTime(),
+		Name: &api.ModelName{
+			Host:      name.Host,
+			Namespace: name.Namespace,
+			Model:     name.Model,
+			Tag:       name.Tag,
+		},
+		Digest: manifest.digest,
+		Size:   manifest.Size(),
 	}
 
 	var params []string
@@ -842,6 +1422,11 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 	fmt.Fprint(&sb, m.String())
 	resp.Modelfile = sb.String()
 
+	if m.Router != nil {
+		// a router has no weights of its own
+		return resp, nil
+	}
+
 	kvData, err := getKVData(m.ModelPath, req.Verbose)
 	if err != nil {
 		return nil, err
@@ -850,6 +1435,42 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 	delete(kvData, "tokenizer.chat_template")
 	resp.ModelInfo = kvData
 
+	// models created before their config recorded these take them from
+	// the model file
+	if resp.Details.Family == "" {
+		resp.Details.Family, _ = kvData["general.architecture"].(string)
+	}
+
+	if resp.Details.ParameterSize == "" {
+		resp.Details.ParameterSize = format.HumanNumber(llm.KV(kvData).ParameterCount())
+	}
+
+	if resp.Details.QuantizationLevel == "" {
+		if ft := llm.KV(kvData).FileType(); ft.String() != "unknown" {
+			resp.Details.QuantizationLevel = ft.String()
+		}
+	}
+
+	resp.EffectiveConfig, err = effectiveConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// classifiers pool with "rank" and score inputs rather than embed them
+	if kv := llm.KV(kvData); kv.PoolingType() != "" && !kv.HasClassifier() {
+		maxLen := int(kv.ContextLength())
+		if resp.EffectiveConfig != nil && resp.EffectiveConfig.NumCtx > 0 {
+			maxLen = min(maxLen, resp.EffectiveConfig.NumCtx)
+		}
+
+		resp.Embedding = &api.EmbeddingInfo{
+			Dimension:         int(kv.EmbeddingLength()),
+			MaxSequenceLength: maxLen,
+			PoolingType:       kv.PoolingType(),
+			Normalized:        true,
+		}
+	}
+
 	if len(m.ProjectorPaths) > 0 {
 		projectorData, err := getKVData(m.ProjectorPaths[0], req.Verbose)
 		if err != nil {
@@ -861,26 +1482,38 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 	return resp, nil
 }
 
-func getKVData(digest string, verbose bool) (llm.KV, error) {
-	maxArraySize := 0
-	if verbose {
-		maxArraySize = -1
-	}
-	kvData, err := llm.LoadModel(digest, maxArraySize)
-	if err != nil {
+// getKVData returns the metadata of the model file at path, with arrays of
+// more than a few elements left empty unless verbose.
+func getKVData(path string, verbose bool) (map[string]any, error) {
+	f, err := gguf.Open(path)
+	if errors.Is(err, gguf.ErrUnsupported) {
+		// formats older than GGUF v2 are read with the decoder that can load them
+		ggml, err := llm.LoadModel(path, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		return ggml.KV(), nil
+	} else if err != nil {
 		return nil, err
 	}
 
-	kv := kvData.KV()
-
-	if !verbose {
-		for k := range kv {
-			if t, ok := kv[k].([]any); len(t) > 5 && ok {
-				kv[k] = []any{}
+	kv := make(map[string]any, len(f.KV)+1)
+	for _, e := range f.KV {
+		a, ok := e.Value.(*gguf.Array)
+		switch {
+		case !ok:
+			kv[e.Key] = e.Value
+		case a.Len > 5 && !verbose:
+			kv[e.Key] = []any{}
+		default:
+			if kv[e.Key], err = a.Values(); err != nil {
+				return nil, err
 			}
 		}
 	}
 
+	kv["general.parameter_count"] = f.Parameters()
 	return kv, nil
 }
 
@@ -891,6 +1524,10 @@ func (s *Server) ListHandler(c *gin.Context) {
 		return
 	}
 
+	// q searches the names, details and system prompts of the models
+	terms := searchTerms(c.Query("q"))
+	scores := make(map[string]int)
+
 	models := []api.ListModelResponse{}
 	for n, m := range ms {
 		var cf ConfigV2
@@ -898,19 +1535,19 @@ func (s *Server) ListHandler(c *gin.Context) {
 		if m.Config.Digest != "" {
 			f, err := m.Config.Open()
 			if err != nil {
-				slog.Warn("bad manifest filepath", "name", n, "error", err)
+				slog.WarnContext(c.Request.Context(), "bad manifest filepath", "name", n, "error", err)
 				continue
 			}
 			defer f.Close()
 
 			if err := json.NewDecoder(f).Decode(&cf); err != nil {
-				slog.Warn("bad manifest config", "name", n, "error", err)
+				slog.WarnContext(c.Request.Context(), "bad manifest config", "name", n, "error", err)
 				continue
 			}
 		}
 
 		// tag should never be masked
-		models = append(models, api.ListModelResponse{
+		resp := api.ListModelResponse{
 			Model:      n.DisplayShortest(),
 			Name:       n.DisplayShortest(),
 			Size:       m.Size(),
@@ -923,12 +1560,31 @@ func (s *Server) ListHandler(c *gin.Context) {
 				ParameterSize:     cf.ModelType,
 				QuantizationLevel: cf.FileType,
 			},
-		})
+		}
+
+		if len(terms) > 0 {
+			system, err := m.system()
+			if err != nil {
+				slog.WarnContext(c.Request.Context(), "bad system prompt", "name", n, "error", err)
+			}
+
+			score := searchScore(terms, resp.Name, resp.Details, system)
+			if score == 0 {
+				continue
+			}
+
+			scores[resp.Name] = score
+		}
+
+		models = append(models, resp)
 	}
 
 	slices.SortStableFunc(models, func(i, j api.ListModelResponse) int {
-		// most recently modified first
-		return cmp.Compare(j.ModifiedAt.Unix(), i.ModifiedAt.Unix())
+		// best matches first, then most recently modified first
+		return cmp.Or(
+			cmp.Compare(scores[j.Name], scores[i.Name]),
+			cmp.Compare(j.ModifiedAt.Unix(), i.ModifiedAt.Unix()),
+		)
 	})
 
 	c.JSON(http.StatusOK, api.ListResponse{Models: models})
@@ -949,7 +1605,7 @@ func (s *Server) CopyHandler(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("source %q is invalid", r.Source)})
 		return
 	}
-	src, err := getExistingName(src)
+	src, err := resolveName(src)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -960,12 +1616,26 @@ func (s *Server) CopyHandler(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("destination %q is invalid", r.Destination)})
 		return
 	}
+	if dst.HasDigest() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("destination %q is invalid: %v", r.Destination, errNameDigest)})
+		return
+	}
 	dst, err = getExistingName(dst)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if err := s.acl.checkSource(c.Request.Context(), src); err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.acl.checkReplace(c.Request.Context(), dst); err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
 	if err := CopyModel(src, dst); errors.Is(err, os.ErrNotExist) {
 		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found", r.Source)})
 	} else if err != nil {
@@ -997,7 +1667,7 @@ func (s *Server) CreateBlobHandler(c *gin.Context) {
 		}
 
 		if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
-			slog.Info("evicting intermediate blob which no longer exists", "digest", ib)
+			slog.InfoContext(c.Request.Context(), "evicting intermediate blob which no longer exists", "digest", ib)
 			delete(intermediateBlobs, c.Param("digest"))
 		} else if err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -1090,7 +1760,9 @@ func allowedHost(host string) bool {
 
 func allowedHostsMiddleware(addr net.Addr) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if addr == nil {
+		// browsers can't connect to Unix domain sockets, so requests on them
+		// aren't from pages whose DNS was rebound
+		if addr == nil || addr.Network() == "unix" {
 			c.Next()
 			return
 		}
@@ -1126,36 +1798,128 @@ func allowedHostsMiddleware(addr net.Addr) gin.HandlerFunc {
 	}
 }
 
+// tracingMiddleware traces requests, continuing the trace of clients that
+// send a traceparent header.
+func tracingMiddleware(c *gin.Context) {
+	name := c.Request.Method
+	if route := c.FullPath(); route != "" {
+		name += " " + route
+	}
+
+	ctx, span := tracing.StartServer(c.Request, name,
+		tracing.String("http.request.method", c.Request.Method),
+		tracing.String("http.route", c.FullPath()),
+	)
+	defer span.End()
+
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+
+	status := c.Writer.Status()
+	span.SetAttributes(tracing.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetError(errors.New(http.StatusText(status)))
+	}
+}
+
 func (s *Server) GenerateRoutes() http.Handler {
 	config := cors.DefaultConfig()
 	config.AllowWildcard = true
 	config.AllowBrowserExtensions = true
-	config.AllowHeaders = []string{"Authorization", "Content-Type", "User-Agent", "Accept", "X-Requested-With"}
+	config.AllowHeaders = []string{"Authorization", "Content-Type", "User-Agent", "Accept", "X-Requested-With", "X-Request-Id"}
+	config.ExposeHeaders = []string{"X-Request-Id", "Server-Timing", healthHeader, coalesceHeader}
 	openAIProperties := []string{"lang", "package-version", "os", "arch", "retry-count", "runtime", "runtime-version", "async", "helper-method", "poll-helper", "custom-poll-interval"}
 	for _, prop := range openAIProperties {
 		config.AllowHeaders = append(config.AllowHeaders, "x-stainless-"+prop)
 	}
 	config.AllowOrigins = envconfig.Origins()
+	if envconfig.Chaos() {
+		config.AllowHeaders = append(config.AllowHeaders, chaosHeader)
+	}
 
-	r := gin.Default()
+	r := gin.New()
 	r.Use(
+		gin.Recovery(),
+		requestLogger,
 		cors.New(config),
 		allowedHostsMiddleware(s.addr),
 	)
 
+	if s.idle != nil {
+		r.Use(s.idle.middleware)
+	}
+
+	if s.metrics != nil {
+		r.Use(s.metrics.middleware)
+	}
+
+	if s.health != nil {
+		r.Use(s.health.middleware)
+	}
+
+	if tracing.Enabled() {
+		r.Use(tracingMiddleware)
+	}
+
+	if s.acl != nil {
+		r.Use(s.acl.middleware)
+	}
+
+	if envconfig.Chaos() {
+		slog.Warn("chaos mode is enabled, requests may inject failures with the " + chaosHeader + " header")
+		r.Use(chaosMiddleware)
+	}
+
 	r.POST("/api/pull", s.PullHandler)
 	r.POST("/api/generate", s.GenerateHandler)
 	r.POST("/api/chat", s.ChatHandler)
 	r.POST("/api/embed", s.EmbedHandler)
+	r.POST("/api/classify", s.ClassifyHandler)
+	r.POST("/api/images/generate", s.ImageGenerateHandler)
 	r.POST("/api/embeddings", s.EmbeddingsHandler)
+	r.POST("/api/tokenize", s.TokenizeHandler)
+	r.POST("/api/detokenize", s.DetokenizeHandler)
 	r.POST("/api/create", s.CreateHandler)
 	r.POST("/api/push", s.PushHandler)
 	r.POST("/api/copy", s.CopyHandler)
 	r.DELETE("/api/delete", s.DeleteHandler)
 	r.POST("/api/show", s.ShowHandler)
+	r.PATCH("/api/model", s.UpdateModelHandler)
 	r.POST("/api/blobs/:digest", s.CreateBlobHandler)
 	r.HEAD("/api/blobs/:digest", s.HeadBlobHandler)
 	r.GET("/api/ps", s.PsHandler)
+	r.GET("/metrics", s.MetricsHandler)
+	r.GET("/api/health", s.HealthHandler)
+	r.GET("/api/gpus/discovery", s.GPUDiscoveryHandler)
+	r.GET("/api/system", s.SystemHandler)
+	r.POST("/api/unload", s.UnloadHandler)
+	r.GET("/api/transfers", s.ListTransfersHandler)
+	r.DELETE("/api/transfers/:id", s.CancelTransferHandler)
+	r.POST("/api/defrag", s.DefragHandler)
+	r.GET("/api/events", s.EventsHandler)
+	r.POST("/api/prefixes", s.PrefixHandler)
+	r.GET("/api/alias", s.ListAliasesHandler)
+	r.POST("/api/alias", s.CreateAliasHandler)
+	r.DELETE("/api/alias", s.DeleteAliasHandler)
+	r.GET("/api/history", s.ListHistoryHandler)
+	r.GET("/api/history/:id", s.ShowHistoryHandler)
+	r.GET("/api/recover/:id", s.RecoveredHandler)
+	r.GET("/api/sessions", s.ListSessionsHandler)
+	r.DELETE("/api/sessions/:id", s.DeleteSessionHandler)
+	r.POST("/api/conversations", s.CreateConversationHandler)
+	r.GET("/api/conversations/:id", s.GetConversationHandler)
+	r.DELETE("/api/conversations/:id", s.DeleteConversationHandler)
+	r.POST("/api/conversations/:id/fork", s.ForkConversationHandler)
+	r.POST("/api/conversations/:id/summarize", s.SummarizeConversationHandler)
+	r.GET("/api/admin/log-level", s.LogLevelHandler)
+	r.GET("/api/admin/keys", s.ListKeysHandler)
+	r.POST("/api/admin/keys", s.CreateKeyHandler)
+	r.DELETE("/api/admin/keys", s.DeleteKeyHandler)
+	r.POST("/api/admin/log-level", s.SetLogLevelHandler)
+
+	if envconfig.Registry() {
+		s.registryRoutes(r)
+	}
 
 	// Compatibility endpoints
 	r.POST("/v1/chat/completions", openai.ChatMiddleware(), s.ChatHandler)
@@ -1164,6 +1928,9 @@ func (s *Server) GenerateRoutes() http.Handler {
 	r.GET("/v1/models", openai.ListMiddleware(), s.ListHandler)
 	r.GET("/v1/models/:model", openai.RetrieveMiddleware(), s.ShowHandler)
 
+	// Compatibility endpoints for the Gemini API
+	r.POST("/v1beta/models/*model", gemini.GenerateContentMiddleware(), s.ChatHandler)
+
 	for _, method := range []string{http.MethodGet, http.MethodHead} {
 		r.Handle(method, "/", func(c *gin.Context) {
 			c.String(http.StatusOK, "Ollama is running")
@@ -1178,27 +1945,41 @@ func (s *Server) GenerateRoutes() http.Handler {
 	return r
 }
 
+// preload loads the model name so the first request to it does not wait for
+// the model to load.
+func (s *Server) preload(ctx context.Context, name string) {
+	// the runner is held until ctx is done, and only then is kept alive
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	n, err := resolveName(model.ParseName(name))
+	if err != nil {
+		slog.Warn("failed to preload model", "model", name, "error", err)
+		return
+	}
+
+	if _, _, _, err := s.scheduleRunner(systemContext(ctx), n.String(), []Capability{}, "", nil, nil); err != nil {
+		slog.Warn("failed to preload model", "model", name, "error", err)
+		return
+	}
+
+	slog.Info("preloaded model", "model", name)
+}
+
 func Serve(ln net.Listener) error {
 	level := slog.LevelInfo
 	if envconfig.Debug() {
 		level = slog.LevelDebug
 	}
 
-	slog.Info("server config", "env", envconfig.Values())
-	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-		Level:     level,
-		AddSource: true,
-		ReplaceAttr: func(_ []string, attr slog.Attr) slog.Attr {
-			if attr.Key == slog.SourceKey {
-				source := attr.Value.Any().(*slog.Source)
-				source.File = filepath.Base(source.File)
-			}
-
-			return attr
-		},
-	})
+	slog.SetDefault(logutil.NewLogger(os.Stderr, level))
+	if logutil.JSON() {
+		gin.DebugPrintFunc = func(format string, values ...any) {
+			slog.Debug(strings.TrimSpace(fmt.Sprintf(format, values...)))
+		}
+	}
 
-	slog.SetDefault(slog.New(handler))
+	slog.Info("server config", "env", envconfig.Values())
 
 	blobsDir, err := GetBlobsPath("")
 	if err != nil {
@@ -1228,10 +2009,52 @@ func Serve(ln net.Listener) error {
 		}
 	}
 
+	tools, err := loadTools(envconfig.Tools())
+	if err != nil {
+		return err
+	}
+
+	mcpClients, err := loadMCPServers(context.Background(), envconfig.MCPServers(), tools)
+	if err != nil {
+		return err
+	}
+
+	acl, err := loadACL(envconfig.ACL())
+	if err != nil {
+		return err
+	}
+
+	schedules, err := loadSchedules(envconfig.Schedules())
+	if err != nil {
+		return err
+	}
+
+	if envconfig.TLSCert() != "" || envconfig.TLSKey() != "" || envconfig.TLSClientCA() != "" {
+		config, err := newTLSConfig(envconfig.TLSCert(), envconfig.TLSKey(), envconfig.TLSClientCA())
+		if err != nil {
+			return err
+		}
+
+		ln = tls.NewListener(ln, config)
+		slog.Info("serving TLS", "cert", envconfig.TLSCert(), "client_certificates", envconfig.TLSClientCA() != "")
+	}
+
+	tracing.Init("ollama")
+
 	ctx, done := context.WithCancel(context.Background())
 	schedCtx, schedDone := context.WithCancel(ctx)
 	sched := InitScheduler(schedCtx)
-	s := &Server{addr: ln.Addr(), sched: sched}
+	s := &Server{addr: ln.Addr(), sched: sched, conversations: newConversationStore(), history: newHistoryStore(), recovered: newRecoverStore(), prefixes: newPrefixStore(), tools: tools, operations: newOperationStore(), transfers: newTransferStore(), acl: acl, metrics: newMetricsStore(), health: newHealthMonitor()}
+
+	// stop the server on ctrl+c or, if enabled, once it has been idle
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	if d := envconfig.IdleTimeout(); d > 0 {
+		s.idle = newIdleTimer(d, func() {
+			slog.Info("stopping idle server", "idle_timeout", d)
+			stopOnce.Do(func() { close(stop) })
+		})
+	}
 
 	http.Handle("/", s.GenerateRoutes())
 
@@ -1252,10 +2075,23 @@ func Serve(ln net.Listener) error {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
-		<-signals
+		select {
+		case <-signals:
+		case <-stop:
+		}
+
 		srvr.Close()
 		schedDone()
 		sched.unloadAllRunners()
+		for _, c := range mcpClients {
+			c.Close()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := tracing.Shutdown(ctx); err != nil {
+			slog.Warn("failed to shut down tracing", "error", err)
+		}
+		cancel()
 		done()
 	}()
 
@@ -1269,11 +2105,27 @@ func Serve(ln net.Listener) error {
 
 	s.sched.Run(schedCtx)
 
+	if name := envconfig.PreloadModel(); name != "" {
+		go s.preload(schedCtx, name)
+	}
+
+	if d := envconfig.ScrubInterval(); d > 0 {
+		go s.scrub(schedCtx, d)
+	}
+
+	go s.rewarmPrefixes(schedCtx)
+
+	if len(schedules) > 0 {
+		go s.runSchedules(schedCtx, schedules)
+	}
+
 	// At startup we retrieve GPU information so we can get log messages before loading a model
 	// This will log warnings to the log in case we have problems with detected GPUs
 	gpus := discover.GetGPUInfo()
 	gpus.LogDetails()
 
+	go s.health.run(schedCtx, healthInterval)
+
 	err = srvr.Serve(ln)
 	// If server is closed from the signal handler, wait for the ctx to be done
 	// otherwise error out quickly
@@ -1313,7 +2165,17 @@ func waitForStream(c *gin.Context, ch chan interface{}) {
 	c.JSON(http.StatusInternalServerError, gin.H{"error": "unexpected end of progress response"})
 }
 
+// streamResponse writes the values on ch as they come until it is closed or
+// the client disconnects. The rest of ch is then drained so that whatever
+// sends on it sees the request canceled rather than blocking forever.
 func streamResponse(c *gin.Context, ch chan any) {
+	defer func() {
+		go func() {
+			for range ch {
+			}
+		}()
+	}()
+
 	c.Header("Content-Type", "application/x-ndjson")
 	c.Stream(func(w io.Writer) bool {
 		val, ok := <-ch
@@ -1323,14 +2185,14 @@ func streamResponse(c *gin.Context, ch chan any) {
 
 		bts, err := json.Marshal(val)
 		if err != nil {
-			slog.Info(fmt.Sprintf("streamResponse: json.Marshal failed with %s", err))
+			slog.InfoContext(c.Request.Context(), fmt.Sprintf("streamResponse: json.Marshal failed with %s", err))
 			return false
 		}
 
 		// Delineate chunks with new-line delimiter
 		bts = append(bts, '\n')
 		if _, err := w.Write(bts); err != nil {
-			slog.Info(fmt.Sprintf("streamResponse: w.Write failed with %s", err))
+			slog.InfoContext(c.Request.Context(), fmt.Sprintf("streamResponse: w.Write failed with %s", err))
 			return false
 		}
 
@@ -1338,6 +2200,12 @@ func streamResponse(c *gin.Context, ch chan any) {
 	})
 }
 
+// GPUDiscoveryHandler reports the GPUs found, those left unused and the
+// issues that explain why, so falling back to the CPU is never silent.
+func (s *Server) GPUDiscoveryHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, discover.GetSystemInfo())
+}
+
 func (s *Server) PsHandler(c *gin.Context) {
 	models := []api.ProcessModelResponse{}
 
@@ -1352,13 +2220,16 @@ func (s *Server) PsHandler(c *gin.Context) {
 		}
 
 		mr := api.ProcessModelResponse{
-			Model:     model.ShortName,
-			Name:      model.ShortName,
-			Size:      int64(v.estimatedTotal),
-			SizeVRAM:  int64(v.estimatedVRAM),
-			Digest:    model.Digest,
-			Details:   modelDetails,
-			ExpiresAt: v.expiresAt,
+			Model:       model.ShortName,
+			Name:        model.ShortName,
+			Size:        int64(v.estimatedTotal),
+			SizeVRAM:    int64(v.estimatedVRAM),
+			Digest:      model.Digest,
+			Details:     modelDetails,
+			ExpiresAt:   v.expiresAt,
+			GPULayers:   v.gpuLayers,
+			Layers:      v.totalLayers,
+			NumParallel: v.numParallel,
 		}
 		// The scheduler waits to set expiresAt, so if a model is loading it's
 		// possible that it will be set to the unix epoch. For those cases, just
@@ -1379,6 +2250,69 @@ func (s *Server) PsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, api.ProcessResponse{Models: models})
 }
 
+func (s *Server) DefragHandler(c *gin.Context) {
+	if err := s.acl.checkAdmin(c.Request.Context()); err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	models, err := s.sched.defrag(c.Request.Context())
+	if err != nil {
+		handleScheduleError(c, "", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.DefragResponse{Models: models})
+}
+
+func (s *Server) UnloadHandler(c *gin.Context) {
+	var req api.UnloadRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name, err := resolveName(model.ParseName(req.Model))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+
+	if err := s.acl.check(c.Request.Context(), aclRun, name); err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	m, err := GetModel(name.String())
+	if err != nil {
+		switch {
+		case os.IsNotExist(err):
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		case err.Error() == errtypes.InvalidModelNameErrMsg:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	unloaded, err := s.sched.unloadModel(c.Request.Context(), m)
+	if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	status := "unloaded"
+	if !unloaded {
+		status = "not loaded"
+	}
+
+	c.JSON(http.StatusOK, api.UnloadResponse{Model: req.Model, Status: status})
+}
+
 func (s *Server) ChatHandler(c *gin.Context) {
 	checkpointStart := time.Now()
 
@@ -1391,9 +2325,32 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		return
 	}
 
+	// reject formats the runner can't constrain output to before loading
+	// the model
+	if _, err := llm.FormatGrammar(req.Format); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := checkLogprobs(req.Logprobs, req.TopLogprobs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := checkRecover(req.Recover); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// expire the runner
 	if len(req.Messages) == 0 && req.KeepAlive != nil && int(req.KeepAlive.Seconds()) == 0 {
-		model, err := GetModel(req.Model)
+		name, err := resolveName(model.ParseName(req.Model))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		model, err := GetModel(name.String())
 		if err != nil {
 			switch {
 			case os.IsNotExist(err):
@@ -1417,35 +2374,109 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		return
 	}
 
+	if req.ExecuteTools {
+		if req.Stream == nil || *req.Stream {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "execute_tools is not supported for streaming responses"})
+			return
+		}
+
+		if req.Recover != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "recover is not supported with execute_tools"})
+			return
+		}
+
+		tools := s.tools.list()
+		if len(tools) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "no tools are configured on the server"})
+			return
+		}
+
+		req.Tools = append(req.Tools, tools...)
+	}
+
 	caps := []Capability{CapabilityCompletion}
 	if len(req.Tools) > 0 {
 		caps = append(caps, CapabilityTools)
 	}
+	if slices.ContainsFunc(req.Messages, func(m api.Message) bool { return len(m.Images) > 0 }) {
+		caps = append(caps, CapabilityVision)
+	}
 
 	name := model.ParseName(req.Model)
 	if !name.IsValid() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
 		return
 	}
-	name, err := getExistingName(name)
+	name, err := resolveName(name)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
 		return
 	}
 
-	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), caps, req.Options, req.KeepAlive)
+	var system string
+	if req.Prefix != "" {
+		var ok bool
+		if system, ok = s.resolvePrefix(c, req.Prefix, name); !ok {
+			return
+		}
+	}
+
+	var routedTo string
+	if router, err := readRouter(name); err == nil && router != nil {
+		if len(req.Messages) == 0 {
+			c.JSON(http.StatusOK, api.ChatResponse{
+				Model:      req.Model,
+				CreatedAt:  time.Now().UTC(),
+				Message:    api.Message{Role: "assistant"},
+				Done:       true,
+				DoneReason: "load",
+			})
+			return
+		}
+
+		var prompt string
+		for _, msg := range slices.Backward(req.Messages) {
+			if msg.Role == "user" {
+				prompt = msg.Content
+				break
+			}
+		}
+
+		name, err = s.route(c.Request.Context(), router, prompt)
+		if err != nil {
+			handleScheduleError(c, req.Model, err)
+			return
+		}
+
+		routedTo = name.DisplayShortest()
+	}
+
+	var loadStreamed bool
+	var progressFn func(api.LoadEvent)
+	if req.Stream == nil || *req.Stream {
+		progressFn = func(e api.LoadEvent) {
+			loadStreamed = true
+			writeStreamed(c, api.ChatResponse{Model: req.Model, CreatedAt: time.Now().UTC(), Message: api.Message{Role: "assistant"}, Load: &e})
+		}
+	}
+
+	r, m, opts, err := s.scheduleRunnerWithProgress(c.Request.Context(), name.String(), caps, req.Profile, req.Options, req.KeepAlive, progressFn)
 	if errors.Is(err, errCapabilityCompletion) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support chat", req.Model)})
 		return
+	} else if err != nil && loadStreamed {
+		writeStreamed(c, gin.H{"error": err.Error()})
+		return
 	} else if err != nil {
 		handleScheduleError(c, req.Model, err)
 		return
 	}
 
 	checkpointLoaded := time.Now()
+	queueDuration := checkpointLoaded.Sub(checkpointStart) - s.sched.loadDuration(m, checkpointStart, checkpointLoaded)
 
 	if len(req.Messages) == 0 {
-		c.JSON(http.StatusOK, api.ChatResponse{
+		respond(c, http.StatusOK, api.ChatResponse{
 			Model:      req.Model,
 			CreatedAt:  time.Now().UTC(),
 			Message:    api.Message{Role: "assistant"},
@@ -1455,30 +2486,71 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		return
 	}
 
-	msgs := append(m.Messages, req.Messages...)
-	if req.Messages[0].Role != "system" && m.System != "" {
-		msgs = append([]api.Message{{Role: "system", Content: m.System}}, msgs...)
+	// the tool loop reads the adapter from the request
+	req.Adapter, err = resolveAdapter(m, req.Adapter)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var history []api.Message
+	if req.Conversation != "" {
+		conv, err := s.conversations.get(req.Conversation)
+		if err != nil {
+			respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("conversation '%s' not found", req.Conversation)})
+			return
+		}
+
+		for _, msg := range conv.Messages {
+			history = append(history, msg.Message)
+		}
+
+		// sample with the conversation's seed for this turn unless the
+		// request asks for a specific one
+		if _, ok := req.Options["seed"]; !ok {
+			opts.Seed = turnSeed(conv, len(conv.Messages)+len(req.Messages))
+		}
+	}
+
+	meta := template.NewMetadata(m.ShortName, req.Variables)
+	system = cmp.Or(system, template.Expand(m.System, meta))
+	msgs := append(append(m.Messages, history...), req.Messages...)
+	if msgs[len(m.Messages)].Role != "system" && system != "" {
+		msgs = append([]api.Message{{Role: "system", Content: system}}, msgs...)
+	}
+
+	if req.ExecuteTools {
+		s.chatToolLoop(c, req, r, m, opts, msgs, meta, checkpointStart, checkpointLoaded)
+		return
 	}
 
-	prompt, images, err := chatPrompt(c.Request.Context(), m, r.Tokenize, opts, msgs, req.Tools)
+	prompt, images, err := chatPrompt(c.Request.Context(), m, r.Tokenize, opts, msgs, req.Tools, meta)
 	if err != nil {
-		slog.Error("chat prompt error", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.ErrorContext(c.Request.Context(), "chat prompt error", "error", err)
+		respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	slog.Debug("chat request", "images", len(images), "prompt", prompt)
+	slog.DebugContext(c.Request.Context(), "chat request", "images", len(images), "prompt", prompt)
 
+	ctx, cancel := s.recoverContext(c, req.Recover)
 	ch := make(chan any)
 	go func() {
 		defer close(ch)
-		var sb strings.Builder
-		var toolCallIndex int = 0
-		if err := r.Completion(c.Request.Context(), llm.CompletionRequest{
-			Prompt:  prompt,
-			Images:  images,
-			Format:  req.Format,
-			Options: opts,
+		var sb, content strings.Builder
+		var logprobs []api.Logprob
+		var toolCalls []api.ToolCall
+		if err := r.Completion(ctx, llm.CompletionRequest{
+			Prompt:      prompt,
+			Images:      images,
+			Format:      req.Format,
+			Options:     opts,
+			Checkpoint:  req.Checkpoint,
+			Session:     req.SessionID,
+			CachePrefix: cachePrefix(m.Template, msgs, req.Tools, meta, prompt),
+			Adapter:     req.Adapter,
+			Logprobs:    req.Logprobs,
+			TopLogprobs: req.TopLogprobs,
 		}, func(r llm.CompletionResponse) {
 			res := api.ChatResponse{
 				Model:      req.Model,
@@ -1486,17 +2558,61 @@ func (s *Server) ChatHandler(c *gin.Context) {
 				Message:    api.Message{Role: "assistant", Content: r.Content},
 				Done:       r.Done,
 				DoneReason: r.DoneReason,
+				RoutedTo:   routedTo,
+				Logprobs:   r.Logprobs,
+				Degenerate: r.Degenerate,
 				Metrics: api.Metrics{
 					PromptEvalCount:    r.PromptEvalCount,
 					PromptEvalDuration: r.PromptEvalDuration,
+					PromptCacheCount:   r.PromptCacheCount,
 					EvalCount:          r.EvalCount,
 					EvalDuration:       r.EvalDuration,
 				},
 			}
 
+			content.WriteString(r.Content)
 			if r.Done {
 				res.TotalDuration = time.Since(checkpointStart)
 				res.LoadDuration = checkpointLoaded.Sub(checkpointStart)
+				res.QueueDuration = queueDuration
+
+				if opts.Language != "" || opts.DetectLanguage {
+					res.Language = language.Detect(content.String())
+				}
+
+				reply := api.Message{Role: "assistant", Content: content.String()}
+				if toolCalls, ok := m.parseToolCalls(reply.Content); ok && len(req.Tools) > 0 {
+					reply.Content = ""
+					reply.ToolCalls = toolCalls
+				}
+
+				if req.Conversation != "" {
+					if err := s.conversations.append(req.Conversation, append(req.Messages, reply)...); err != nil {
+						slog.WarnContext(c.Request.Context(), "failed to update conversation", "conversation", req.Conversation, "error", err)
+					}
+				}
+
+				// only exchanges that finished on their own are mirrored,
+				// not those cut off by num_predict or the context length
+				if opts.Mirror && req.Consent != nil && r.DoneReason == "stop" {
+					if err := appendDataset(name, append(slices.Clone(msgs), reply), *req.Consent); err != nil {
+						slog.WarnContext(c.Request.Context(), "failed to mirror chat exchange", "model", name.DisplayShortest(), "error", err)
+					}
+				}
+
+				s.metrics.observe(m.ShortName, res.Metrics)
+				s.acl.consume(c.Request.Context(), res.PromptEvalCount+res.EvalCount)
+				s.history.record(api.HistoryEntry{
+					Endpoint:        "chat",
+					Model:           req.Model,
+					User:            userName(c.Request.Context()),
+					PromptHash:      promptHash(prompt),
+					DoneReason:      r.DoneReason,
+					TotalDuration:   res.TotalDuration,
+					PromptEvalCount: r.PromptEvalCount,
+					EvalCount:       r.EvalCount,
+					Messages:        append(slices.Clone(msgs), reply),
+				})
 			}
 
 			// TODO: tool call checking and filtering should be moved outside of this callback once streaming
@@ -1508,42 +2624,58 @@ func (s *Server) ChatHandler(c *gin.Context) {
 			}
 
 			// Streaming tool calls:
-			// If tools are recognized, use a flag to track the sending of a tool downstream
-			// This ensures that content is cleared from the message on the last chunk sent
+			// Each tool call is sent on its own as soon as it is complete, in
+			// the order the model generated them, so that clients can start
+			// running it while the rest are generated. The final response
+			// lists them all.
 			sb.WriteString(r.Content)
-			if toolCalls, ok := m.parseToolCalls(sb.String()); ok {
-				res.Message.ToolCalls = toolCalls
-				for i := range toolCalls {
-					toolCalls[i].Function.Index = toolCallIndex
-					toolCallIndex++
+			logprobs = append(logprobs, r.Logprobs...)
+			if calls, ok := m.parseStreamedToolCalls(sb.String()); ok {
+				for _, call := range calls[min(len(toolCalls), len(calls)):] {
+					call.Function.Index = len(toolCalls)
+					toolCalls = append(toolCalls, call)
+					ch <- api.ChatResponse{
+						Model:     req.Model,
+						CreatedAt: res.CreatedAt,
+						Message:   api.Message{Role: "assistant", ToolCalls: []api.ToolCall{call}},
+						RoutedTo:  routedTo,
+					}
 				}
-				res.Message.Content = ""
-				sb.Reset()
-				ch <- res
-				return
 			}
 
 			if r.Done {
 				// Send any remaining content if no tool calls were detected
-				if toolCallIndex == 0 {
+				res.Message.Content = ""
+				res.Logprobs = nil
+				if len(toolCalls) == 0 {
 					res.Message.Content = sb.String()
+					res.Logprobs = logprobs
 				}
+				res.ToolCalls = toolCalls
 				ch <- res
 			}
 		}); err != nil {
-			ch <- gin.H{"error": err.Error()}
+			ch <- completionError(err)
 		}
 	}()
 
+	out := injectStream(c, s.recoverable(c, req.Recover, cancel, ch))
 	if req.Stream != nil && !*req.Stream {
 		var resp api.ChatResponse
 		var sb strings.Builder
-		for rr := range ch {
+		var logprobs []api.Logprob
+		for rr := range out {
 			switch t := rr.(type) {
 			case api.ChatResponse:
 				sb.WriteString(t.Message.Content)
+				logprobs = append(logprobs, t.Logprobs...)
 				resp = t
 			case gin.H:
+				if _, ok := t["format_error"]; ok {
+					c.JSON(http.StatusUnprocessableEntity, t)
+					return
+				}
+
 				msg, ok := t["error"].(string)
 				if !ok {
 					msg = "unexpected error format in response"
@@ -1558,11 +2690,13 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		}
 
 		resp.Message.Content = sb.String()
+		resp.Logprobs = logprobs
 
 		if len(req.Tools) > 0 {
 			if toolCalls, ok := m.parseToolCalls(sb.String()); ok {
 				resp.Message.ToolCalls = toolCalls
 				resp.Message.Content = ""
+				resp.Logprobs = nil
 			}
 		}
 
@@ -1570,17 +2704,37 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		return
 	}
 
-	streamResponse(c, ch)
+	streamResponse(c, coalesce(c, req.Coalesce, out))
+}
+
+// completionError is the response for an error from a completion. Output
+// that can no longer become valid JSON is reported with where and why.
+func completionError(err error) gin.H {
+	var formatErr *llm.FormatError
+	if errors.As(err, &formatErr) {
+		return gin.H{"error": err.Error(), "format_error": gin.H{"offset": formatErr.Offset, "reason": formatErr.Reason}}
+	}
+
+	return gin.H{"error": err.Error()}
 }
 
 func handleScheduleError(c *gin.Context, name string, err error) {
+	var shedErr *ShedError
 	switch {
-	case errors.Is(err, errCapabilities), errors.Is(err, errRequired):
+	case errors.Is(err, errCapabilities), errors.Is(err, errRequired), errors.Is(err, errUnknownProfile), errors.Is(err, errUnsupportedLanguage), errors.Is(err, errUnknownWatchdog), errors.Is(err, errNoRoute), errors.Is(err, errGPUSplit):
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case aclStatus(err) != 0:
+		c.JSON(aclStatus(err), gin.H{"error": err.Error()})
 	case errors.Is(err, context.Canceled):
 		c.JSON(499, gin.H{"error": "request canceled"})
 	case errors.Is(err, ErrMaxQueue):
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case errors.As(err, &shedErr):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "shed": api.Shed{
+			PredictedWait: shedErr.PredictedWait,
+			FirstTokenSLO: shedErr.SLO,
+			Alternatives:  shedErr.Alternatives,
+		}})
 	case errors.Is(err, os.ErrNotExist):
 		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found, try pulling it first", name)})
 	default:
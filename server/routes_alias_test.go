@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestAlias(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	var s Server
+
+	_, digest := createBinFile(t, nil, nil)
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:    "example.com/team/llama3:70b",
+		Files:    map[string]string{"test.gguf": digest},
+		Template: "{{ .Prompt }}",
+		Stream:   &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	t.Run("missing target", func(t *testing.T) {
+		w := createRequest(t, s.CreateAliasHandler, api.AliasRequest{Alias: "prod-chat", Target: "missing"})
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("alias of a model", func(t *testing.T) {
+		w := createRequest(t, s.CreateAliasHandler, api.AliasRequest{Alias: "Example.com/team/llama3:70B", Target: "example.com/team/llama3:70b"})
+		if w.Code != http.StatusConflict {
+			t.Errorf("expected status 409, got %d", w.Code)
+		}
+	})
+
+	w = createRequest(t, s.CreateAliasHandler, api.AliasRequest{Alias: "prod-chat", Target: "example.com/team/llama3:70b"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	for _, name := range []string{"prod-chat", "PROD-CHAT:latest"} {
+		w := createRequest(t, s.ShowHandler, api.ShowRequest{Model: name})
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", name, w.Code, w.Body)
+		}
+
+		var resp api.ShowResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Template != "{{ .Prompt }}" {
+			t.Errorf("%s: expected the template of the target, got %q", name, resp.Template)
+		}
+	}
+
+	w = createRequest(t, s.ListAliasesHandler, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var list api.ListAliasesResponse
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]api.Alias{{Alias: "prod-chat:latest", Target: "example.com/team/llama3:70b"}}, list.Aliases); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	w = createRequest(t, s.DeleteAliasHandler, api.AliasRequest{Alias: "prod-chat"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	w = createRequest(t, s.ShowHandler, api.ShowRequest{Model: "prod-chat"})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 after deleting the alias, got %d", w.Code)
+	}
+
+	w = createRequest(t, s.DeleteAliasHandler, api.AliasRequest{Alias: "prod-chat"})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/llm"
+)
+
+type mockClassifier struct {
+	mockRunner
+
+	logits []float32
+}
+
+func (m *mockClassifier) Embedding(context.Context, string, []llm.ImageData) ([]float32, error) {
+	return m.logits, nil
+}
+
+func TestClassify(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mock := mockClassifier{logits: []float32{0, float32(math.Log(3))}}
+
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:  make(chan *LlmRequest, 1),
+			finishedReqCh: make(chan *LlmRequest, 1),
+			expiredCh:     make(chan *runnerRef, 1),
+			unloadedCh:    make(chan any, 1),
+			loaded:        make(map[string]*runnerRef),
+			newServerFn:   newMockServer(&mock.mockRunner),
+			getGpuFn:      discover.GetGPUInfo,
+			getCpuFn:      discover.GetCPUInfo,
+			reschedDelay:  250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, ggml *llm.GGML, gpus discover.GpuInfoList, numParallel int) {
+				req.successCh <- &runnerRef{
+					llama: &mock,
+				}
+			},
+		},
+	}
+
+	go s.sched.Run(context.TODO())
+
+	_, digest := createBinFile(t, llm.KV{
+		"general.architecture":              "bert",
+		"bert.context_length":               uint32(512),
+		"bert.pooling_type":                 uint32(4),
+		"bert.classifier.output_labels":     []string{"negative", "positive"},
+		"tokenizer.ggml.tokens":             []string{""},
+		"tokenizer.ggml.scores":             []float32{0},
+		"tokenizer.ggml.token_type":         []int32{0},
+		"tokenizer.ggml.token_type_count":   uint32(2),
+		"bert.attention.layer_norm_epsilon": float32(1e-12),
+	}, []llm.Tensor{})
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "classifier",
+		Files:  map[string]string{"classifier.gguf": digest},
+		Stream: &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	t.Run("labels", func(t *testing.T) {
+		w := createRequest(t, s.ClassifyHandler, api.ClassifyRequest{
+			Model: "classifier",
+			Input: []string{"great movie", "loved it"},
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.ClassifyResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []api.LabelProbability{
+			{Label: "positive", Probability: 0.75},
+			{Label: "negative", Probability: 0.25},
+		}
+
+		if len(resp.Classifications) != 2 {
+			t.Fatalf("expected 2 classifications, got %d", len(resp.Classifications))
+		}
+
+		for _, got := range resp.Classifications {
+			if diff := cmp.Diff(want, got, cmpopts.EquateApprox(0, 1e-6)); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		}
+
+		if resp.PromptEvalCount != 4 {
+			t.Errorf("expected prompt eval count 4, got %d", resp.PromptEvalCount)
+		}
+	})
+
+	t.Run("no input", func(t *testing.T) {
+		w := createRequest(t, s.ClassifyHandler, api.ClassifyRequest{Model: "classifier"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(w.Body.String(), `{"model":"classifier","classifications":[]}`); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("missing capability", func(t *testing.T) {
+		_, digest := createBinFile(t, llm.KV{
+			"general.architecture": "bert",
+			"bert.pooling_type":    uint32(1),
+		}, []llm.Tensor{})
+
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:  "embedder",
+			Files:  map[string]string{"embedder.gguf": digest},
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		w = createRequest(t, s.ClassifyHandler, api.ClassifyRequest{
+			Model: "embedder",
+			Input: "hello",
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(w.Body.String(), `{"error":"registry.ollama.ai/library/embedder:latest does not support classification"}`); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+}
+
+func TestClassifyLogits(t *testing.T) {
+	cases := []struct {
+		name   string
+		logits []float32
+		labels []string
+		want   []api.LabelProbability
+	}{
+		{
+			name:   "binary",
+			logits: []float32{0},
+			want:   []api.LabelProbability{{Label: "LABEL_0", Probability: 0.5}},
+		},
+		{
+			name:   "missing labels",
+			logits: []float32{0, 0, float32(math.Log(2))},
+			labels: []string{"a"},
+			want: []api.LabelProbability{
+				{Label: "LABEL_2", Probability: 0.5},
+				{Label: "a", Probability: 0.25},
+				{Label: "LABEL_1", Probability: 0.25},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, classify(tt.logits, tt.labels), cmpopts.EquateApprox(0, 1e-6)); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
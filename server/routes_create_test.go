@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"slices"
@@ -84,6 +85,7 @@ func createRequest(t *testing.T, fn func(*gin.Context), body any) *httptest.Resp
 	}
 
 	c.Request = &http.Request{
+		URL:  &url.URL{},
 		Body: io.NopCloser(&b),
 	}
 
@@ -710,3 +712,28 @@ func TestCreateDetectTemplate(t *testing.T) {
 		})
 	})
 }
+
+func TestCreateInvalidName(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+
+	var s Server
+
+	_, digest := createBinFile(t, nil, nil)
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Name:   "my.team/test",
+		Files:  map[string]string{"test.gguf": digest},
+		Stream: &stream,
+	})
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status code 400, actual %d", w.Code)
+	}
+
+	if want := `{"error":"invalid model name: invalid character '.' in namespace at position 2"}`; w.Body.String() != want {
+		t.Errorf("expected %s, got %s", want, w.Body.String())
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -110,3 +111,57 @@ func TestDeleteDuplicateLayers(t *testing.T) {
 
 	checkFileExists(t, filepath.Join(p, "manifests", "*", "*", "*", "*"), []string{})
 }
+
+func TestDeleteDigest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+
+	var s Server
+
+	_, digest := createBinFile(t, nil, nil)
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Name:  "test",
+		Files: map[string]string{"test.gguf": digest},
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	m, err := ParseNamedManifest(model.ParseName("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := "sha256:" + strings.Repeat("0", 64)
+	w = createRequest(t, s.DeleteHandler, api.DeleteRequest{Name: "test@" + other})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status code 404, actual %d", w.Code)
+	}
+
+	checkFileExists(t, filepath.Join(p, "manifests", "*", "*", "*", "*"), []string{
+		filepath.Join(p, "manifests", "registry.ollama.ai", "library", "test", "latest"),
+	})
+
+	for _, r := range []struct {
+		handler gin.HandlerFunc
+		req     any
+	}{
+		{s.CreateHandler, api.CreateRequest{Name: "test2@" + other, From: "test"}},
+		{s.CopyHandler, api.CopyRequest{Source: "test", Destination: "test2@" + other}},
+		{s.PullHandler, api.PullRequest{Name: "test@" + other}},
+	} {
+		if w := createRequest(t, r.handler, r.req); w.Code != http.StatusBadRequest {
+			t.Errorf("%T: expected status code 400, actual %d", r.req, w.Code)
+		}
+	}
+
+	w = createRequest(t, s.DeleteHandler, api.DeleteRequest{Name: "test@sha256:" + m.digest})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	checkFileExists(t, filepath.Join(p, "manifests", "*", "*", "*", "*"), []string{})
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/llm"
+)
+
+type mockEmbedder struct {
+	mockRunner
+
+	mu       sync.Mutex
+	inflight int
+	peak     int
+}
+
+// Embedding records the most inputs embedded at the same time.
+func (m *mockEmbedder) Embedding(context.Context, string, []llm.ImageData) ([]float32, error) {
+	m.mu.Lock()
+	m.inflight++
+	m.peak = max(m.peak, m.inflight)
+	m.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	m.mu.Lock()
+	m.inflight--
+	m.mu.Unlock()
+
+	return []float32{1, 0}, nil
+}
+
+func TestEmbed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var mock mockEmbedder
+
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:  make(chan *LlmRequest, 1),
+			finishedReqCh: make(chan *LlmRequest, 1),
+			expiredCh:     make(chan *runnerRef, 1),
+			unloadedCh:    make(chan any, 1),
+			loaded:        make(map[string]*runnerRef),
+			newServerFn:   newMockServer(&mock.mockRunner),
+			getGpuFn:      discover.GetGPUInfo,
+			getCpuFn:      discover.GetCPUInfo,
+			reschedDelay:  250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, ggml *llm.GGML, gpus discover.GpuInfoList, numParallel int) {
+				req.successCh <- &runnerRef{
+					llama: &mock,
+				}
+			},
+		},
+	}
+
+	go s.sched.Run(context.TODO())
+
+	_, digest := createBinFile(t, llm.KV{
+		"general.architecture":              "bert",
+		"bert.context_length":               uint32(512),
+		"bert.pooling_type":                 uint32(1),
+		"tokenizer.ggml.tokens":             []string{""},
+		"tokenizer.ggml.scores":             []float32{0},
+		"tokenizer.ggml.token_type":         []int32{0},
+		"tokenizer.ggml.token_type_count":   uint32(2),
+		"bert.attention.layer_norm_epsilon": float32(1e-12),
+	}, []llm.Tensor{})
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "embedder",
+		Files:  map[string]string{"embedder.gguf": digest},
+		Stream: &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	input := []string{"one", "one two", "one two three", "one", "one two", "one two three", "one", "one two"}
+
+	w = createRequest(t, s.EmbedHandler, api.EmbedRequest{
+		Model:     "embedder",
+		Input:     input,
+		BatchSize: 3,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp api.EmbedResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Embeddings) != len(input) {
+		t.Fatalf("expected %d embeddings, got %d", len(input), len(resp.Embeddings))
+	}
+
+	var counts []int
+	for _, s := range input {
+		counts = append(counts, len(strings.Fields(s)))
+	}
+
+	if diff := cmp.Diff(counts, resp.PromptEvalCounts); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if resp.PromptEvalCount != 15 {
+		t.Errorf("expected prompt eval count 15, got %d", resp.PromptEvalCount)
+	}
+
+	if mock.peak > 3 {
+		t.Errorf("expected at most 3 inputs at a time, got %d", mock.peak)
+	}
+
+	// images need a model with a projector
+	w = createRequest(t, s.EmbedHandler, api.EmbedRequest{
+		Model: "embedder",
+		Input: []any{"one", api.EmbedInput{Text: "one", Images: []api.ImageData{[]byte("image")}}},
+	})
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestEmbedInputs(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  []api.EmbedInput
+		err   bool
+	}{
+		{"empty", `""`, nil, false},
+		{"string", `"one"`, []api.EmbedInput{{Text: "one"}}, false},
+		{"strings", `["one", "two"]`, []api.EmbedInput{{Text: "one"}, {Text: "two"}}, false},
+		{"image", `{"images": ["aW1hZ2U="]}`, []api.EmbedInput{{Images: []api.ImageData{[]byte("image")}}}, false},
+		{"mixed", `["one", {"text": "two", "images": ["aW1hZ2U="]}]`, []api.EmbedInput{{Text: "one"}, {Text: "two", Images: []api.ImageData{[]byte("image")}}}, false},
+		{"empty object", `[{}]`, nil, true},
+		{"invalid image", `{"images": ["not base64"]}`, nil, true},
+		{"number", `[1]`, nil, true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var v any
+			if err := json.Unmarshal([]byte(tt.input), &v); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := embedInputs(v)
+			if tt.err {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEmbedPrompt(t *testing.T) {
+	prompt, images := embedPrompt("a cat", []api.ImageData{[]byte("one"), []byte("two")})
+	if prompt != "[img-0][img-1]a cat" {
+		t.Errorf("unexpected prompt %q", prompt)
+	}
+
+	want := []llm.ImageData{{ID: 0, Data: []byte("one")}, {ID: 1, Data: []byte("two")}}
+	if diff := cmp.Diff(want, images); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestShowEmbedding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	var s Server
+
+	create := func(name string, kv llm.KV) {
+		t.Helper()
+
+		_, digest := createBinFile(t, kv, nil)
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:  name,
+			Files:  map[string]string{name + ".gguf": digest},
+			Stream: &stream,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+	}
+
+	show := func(name string) api.ShowResponse {
+		t.Helper()
+
+		w := createRequest(t, s.ShowHandler, api.ShowRequest{Model: name})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		var resp api.ShowResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		return resp
+	}
+
+	create("embedder", llm.KV{
+		"general.architecture":  "bert",
+		"bert.context_length":   uint32(512),
+		"bert.embedding_length": uint32(768),
+		"bert.pooling_type":     uint32(2),
+	})
+
+	create("long-embedder", llm.KV{
+		"general.architecture":        "nomic-bert",
+		"nomic-bert.context_length":   uint32(8192),
+		"nomic-bert.embedding_length": uint32(768),
+		"nomic-bert.pooling_type":     uint32(1),
+	})
+
+	create("classifier", llm.KV{
+		"general.architecture":  "bert",
+		"bert.context_length":   uint32(512),
+		"bert.embedding_length": uint32(768),
+		"bert.pooling_type":     uint32(4),
+	})
+
+	create("generator", llm.KV{
+		"general.architecture": "llama",
+		"llama.context_length": uint32(8192),
+	})
+
+	if diff := cmp.Diff(&api.EmbeddingInfo{Dimension: 768, MaxSequenceLength: 512, PoolingType: "cls", Normalized: true}, show("embedder").Embedding); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// inputs are truncated to the context window the model runs with
+	if diff := cmp.Diff(&api.EmbeddingInfo{Dimension: 768, MaxSequenceLength: 2048, PoolingType: "mean", Normalized: true}, show("long-embedder").Embedding); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, name := range []string{"classifier", "generator"} {
+		if e := show(name).Embedding; e != nil {
+			t.Errorf("expected %s to have no embedding info, got %+v", name, e)
+		}
+	}
+}
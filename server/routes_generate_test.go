@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"testing"
@@ -17,6 +19,7 @@ import (
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/discover"
 	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/types/model"
 )
 
 type mockRunner struct {
@@ -37,6 +40,10 @@ func (m *mockRunner) Completion(ctx context.Context, r llm.CompletionRequest, fn
 	return nil
 }
 
+func (mockRunner) Ping(context.Context) error {
+	return nil
+}
+
 func (mockRunner) Tokenize(_ context.Context, s string) (tokens []int, err error) {
 	for range strings.Fields(s) {
 		tokens = append(tokens, len(tokens))
@@ -45,8 +52,8 @@ func (mockRunner) Tokenize(_ context.Context, s string) (tokens []int, err error
 	return
 }
 
-func newMockServer(mock *mockRunner) func(discover.GpuInfoList, string, *llm.GGML, []string, []string, api.Options, int) (llm.LlamaServer, error) {
-	return func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, projectors, system []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+func newMockServer(mock *mockRunner) func(discover.GpuInfoList, string, *llm.GGML, []string, []string, string, api.Options, int) (llm.LlamaServer, error) {
+	return func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, projectors, system []string, tokenizer string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
 		return mock, nil
 	}
 }
@@ -181,6 +188,23 @@ func TestGenerateChat(t *testing.T) {
 		}
 	})
 
+	t.Run("missing capabilities images", func(t *testing.T) {
+		w := createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model: "test",
+			Messages: []api.Message{
+				{Role: "user", Content: "What is in this image?", Images: []api.ImageData{[]byte("image")}},
+			},
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(w.Body.String(), `{"error":"registry.ollama.ai/library/test:latest does not support vision"}`); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
 	t.Run("load model", func(t *testing.T) {
 		w := createRequest(t, s.ChatHandler, api.ChatRequest{
 			Model: "test",
@@ -281,6 +305,252 @@ func TestGenerateChat(t *testing.T) {
 		checkChatResponse(t, w.Body, "test", "Hi!")
 	})
 
+	t.Run("messages with prefix", func(t *testing.T) {
+		s.prefixes = newPrefixStore()
+		w := createRequest(t, s.PrefixHandler, api.PrefixRequest{
+			Model:  "test",
+			System: "You are a pinned assistant.",
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(mock.CompletionRequest.Prompt, "system: You are a pinned assistant.\n"); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+
+		var resp api.PrefixResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		w = createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model: "test",
+			Messages: []api.Message{
+				{Role: "user", Content: "Hello!"},
+			},
+			Prefix: resp.ID,
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(mock.CompletionRequest.Prompt, "system: You are a pinned assistant.\nuser: Hello!\n"); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+
+		w = createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model: "test",
+			Messages: []api.Message{
+				{Role: "user", Content: "Hello!"},
+			},
+			Prefix: "unknown",
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("prefix evaluated again on load", func(t *testing.T) {
+		s.sched.events = newEventBus()
+		t.Cleanup(func() { s.sched.events = nil })
+
+		// evaluating a prefix again is done by the server, not a user
+		s.acl = &accessList{}
+		t.Cleanup(func() { s.acl = nil })
+
+		prompts := make(chan string, 1)
+		mock.CompletionFn = func(_ context.Context, r llm.CompletionRequest, fn func(llm.CompletionResponse)) error {
+			prompts <- r.Prompt
+			fn(mock.CompletionResponse)
+			return nil
+		}
+		t.Cleanup(func() { mock.CompletionFn = nil })
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go s.rewarmPrefixes(ctx)
+
+		// wait for the subscription before publishing
+		for {
+			s.sched.events.mu.Lock()
+			n := len(s.sched.events.subs)
+			s.sched.events.mu.Unlock()
+			if n > 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		m, err := GetModel("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opts, err := modelOptions(m, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// prefixes are only evaluated again on runners that are kept loaded
+		runner := &runnerRef{llama: &mock, model: m, modelPath: m.ModelPath, Options: &opts, numParallel: 1, sessionDuration: time.Minute}
+		s.sched.loadedMu.Lock()
+		s.sched.loaded[m.ModelPath] = runner
+		s.sched.loadedMu.Unlock()
+		t.Cleanup(func() {
+			s.sched.loadedMu.Lock()
+			delete(s.sched.loaded, m.ModelPath)
+			s.sched.loadedMu.Unlock()
+
+			runner.refMu.Lock()
+			if runner.expireTimer != nil {
+				runner.expireTimer.Stop()
+			}
+			runner.refMu.Unlock()
+		})
+
+		s.sched.events.publish(api.Event{Type: "load", Load: &api.LoadEvent{Model: "test:latest", Stage: "ready"}})
+
+		select {
+		case prompt := <-prompts:
+			if diff := cmp.Diff(prompt, "system: You are a pinned assistant.\n"); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the prefix to be evaluated again")
+		}
+
+		// wait for the runner to be released, then unload it
+		for {
+			runner.refMu.Lock()
+			idle := runner.refCount == 0 && runner.expireTimer != nil
+			if idle {
+				runner.sessionDuration = 0
+			}
+			runner.refMu.Unlock()
+			if idle {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		s.sched.events.publish(api.Event{Type: "load", Load: &api.LoadEvent{Model: "test:latest", Stage: "ready"}})
+
+		select {
+		case prompt := <-prompts:
+			t.Errorf("expected no evaluation of an unloaded model, got %q", prompt)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("messages with conversation", func(t *testing.T) {
+		s.conversations = newConversationStore()
+		conv := s.conversations.create([]api.Message{
+			{Role: "user", Content: "Hello!"},
+			{Role: "assistant", Content: "Hi!"},
+		}, nil)
+
+		w := createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model: "test",
+			Messages: []api.Message{
+				{Role: "user", Content: "How are you?"},
+			},
+			Conversation: conv.ID,
+			Stream:       &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(mock.CompletionRequest.Prompt, "user: Hello!\nassistant: Hi!\nuser: How are you?\n"); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+
+		if want := turnSeed(conv, 3); mock.CompletionRequest.Options.Seed != want {
+			t.Errorf("expected seed %d, got %d", want, mock.CompletionRequest.Options.Seed)
+		}
+
+		conv, err := s.conversations.get(conv.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(conv.Messages) != 4 || conv.Messages[3].Message.Content != "Hi!" {
+			t.Errorf("expected conversation to be updated, got %v", conv.Messages)
+		}
+	})
+
+	t.Run("messages with mirror", func(t *testing.T) {
+		t.Setenv("OLLAMA_DATASETS", t.TempDir())
+
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:      "test-mirror",
+			From:       "test",
+			Parameters: map[string]any{"mirror": true},
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		consent := &api.Consent{User: "alice", GrantedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+		for _, consent := range []*api.Consent{consent, nil} {
+			w := createRequest(t, s.ChatHandler, api.ChatRequest{
+				Model:    "test-mirror",
+				Messages: []api.Message{{Role: "user", Content: "Hello!"}},
+				Consent:  consent,
+				Stream:   &stream,
+			})
+			if w.Code != http.StatusOK {
+				t.Errorf("expected status 200, got %d", w.Code)
+			}
+		}
+
+		// exchanges with models that do not mirror are not kept
+		w = createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model:    "test",
+			Messages: []api.Message{{Role: "user", Content: "Hello!"}},
+			Consent:  consent,
+			Stream:   &stream,
+		})
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", w.Code)
+		}
+
+		if _, err := os.Stat(datasetPath(model.ParseName("test"))); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected no dataset for test, got %v", err)
+		}
+
+		b, err := os.ReadFile(datasetPath(model.ParseName("test-mirror")))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		if len(lines) != 1 {
+			t.Fatalf("expected 1 record, got %d", len(lines))
+		}
+
+		var rec datasetRecord
+		if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []api.Message{{Role: "user", Content: "Hello!"}, {Role: "assistant", Content: "Hi!"}}
+		if diff := cmp.Diff(rec.Messages, want); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+		if rec.Model != "test-mirror:latest" || rec.Consent != *consent {
+			t.Errorf("unexpected record %+v", rec)
+		}
+	})
+
 	w = createRequest(t, s.CreateHandler, api.CreateRequest{
 		Model:  "test-system",
 		From:   "test",
@@ -457,6 +727,133 @@ func TestGenerateChat(t *testing.T) {
 		}
 	})
 
+	t.Run("messages with profile", func(t *testing.T) {
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:      "test-profiles",
+			From:       "test",
+			Parameters: map[string]any{"temperature": 0.8, "top_k": 20},
+			Profiles: map[string]map[string]any{
+				"precise": {"temperature": 0.1, "seed": 42},
+			},
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		w = createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model: "test-profiles",
+			Messages: []api.Message{
+				{Role: "user", Content: "Hello!"},
+			},
+			Profile: "precise",
+			Options: map[string]any{"seed": 7},
+			Stream:  &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		opts := mock.CompletionRequest.Options
+		if opts.Temperature != 0.1 || opts.TopK != 20 || opts.Seed != 7 {
+			t.Errorf("unexpected options temperature=%v top_k=%v seed=%v", opts.Temperature, opts.TopK, opts.Seed)
+		}
+
+		w = createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model: "test-profiles",
+			Messages: []api.Message{
+				{Role: "user", Content: "Hello!"},
+			},
+			Profile: "creative",
+			Stream:  &stream,
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(w.Body.String(), `{"error":"unknown profile 'creative'"}`); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("invalid json output", func(t *testing.T) {
+		mock.CompletionFn = func(ctx context.Context, r llm.CompletionRequest, fn func(llm.CompletionResponse)) error {
+			fn(llm.CompletionResponse{Content: `{"a":`})
+			return &llm.FormatError{Offset: 5, Reason: "expected a value, got '}'"}
+		}
+		defer func() { mock.CompletionFn = nil }()
+
+		w := createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model:    "test",
+			Messages: []api.Message{{Role: "user", Content: "Hello!"}},
+			Format:   json.RawMessage(`"json"`),
+			Stream:   &stream,
+		})
+
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("expected status 422, got %d: %s", w.Code, w.Body.String())
+		}
+
+		want := `{"error":"output is not valid JSON at offset 5: expected a value, got '}'","format_error":{"offset":5,"reason":"expected a value, got '}'"}}`
+		if diff := cmp.Diff(w.Body.String(), want); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("messages with executed tools", func(t *testing.T) {
+		weather := &fakeTool{tool: mustTool(t, weatherTool)}
+		s.tools = newToolRegistry()
+		if err := s.tools.register(weather); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { s.tools = nil }()
+
+		var prompts []string
+		mock.CompletionFn = func(ctx context.Context, r llm.CompletionRequest, fn func(llm.CompletionResponse)) error {
+			prompts = append(prompts, r.Prompt)
+			content := `{"name":"get_weather","arguments":{"location":"Seattle, WA"}}`
+			if len(prompts) > 1 {
+				content = "It is sunny in Seattle."
+			}
+
+			fn(llm.CompletionResponse{Content: content, Done: true, DoneReason: "stop", EvalCount: 1})
+			return nil
+		}
+		defer func() { mock.CompletionFn = nil }()
+
+		w := createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model: "test-system",
+			Messages: []api.Message{
+				{Role: "user", Content: "What's the weather in Seattle?"},
+			},
+			ExecuteTools: true,
+			Stream:       &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.ChatResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Message.Content != "It is sunny in Seattle." || resp.EvalCount != 2 {
+			t.Errorf("unexpected response %+v", resp)
+		}
+
+		if len(weather.calls) != 1 || weather.calls[0]["location"] != "Seattle, WA" {
+			t.Errorf("unexpected tool calls %v", weather.calls)
+		}
+
+		if len(prompts) != 2 || !strings.Contains(prompts[1], "tool: sunny") {
+			t.Errorf("expected tool result in prompt, got %q", prompts)
+		}
+	})
+
 	t.Run("messages with tools (streaming)", func(t *testing.T) {
 		tools := []api.Tool{
 			{
@@ -585,6 +982,81 @@ func TestGenerateChat(t *testing.T) {
 			t.Errorf("final tool call mismatch (-got +want):\n%s", diff)
 		}
 	})
+
+	t.Run("messages with parallel tools (streaming)", func(t *testing.T) {
+		streaming := true
+		mock.CompletionFn = func(ctx context.Context, r llm.CompletionRequest, fn func(r llm.CompletionResponse)) error {
+			for _, content := range []string{
+				`[{"name":"get_weather","arguments":{"location":"Seattle, WA"}}`,
+				`, {"name":"get_weather","arguments":{"location":"Port`,
+				`land, OR"}}]`,
+			} {
+				fn(llm.CompletionResponse{Content: content})
+			}
+
+			fn(llm.CompletionResponse{Done: true, DoneReason: "stop"})
+			return nil
+		}
+
+		w := createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model: "test-system",
+			Messages: []api.Message{
+				{Role: "user", Content: "What's the weather in Seattle and Portland?"},
+			},
+			Tools:  []api.Tool{{Type: "function", Function: api.ToolFunction{Name: "get_weather"}}},
+			Stream: &streaming,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		var resps []api.ChatResponse
+		decoder := json.NewDecoder(w.Body)
+		for {
+			var resp api.ChatResponse
+			if err := decoder.Decode(&resp); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			resps = append(resps, resp)
+		}
+
+		call := func(index int, location string) api.ToolCall {
+			return api.ToolCall{Function: api.ToolCallFunction{
+				Index:     index,
+				Name:      "get_weather",
+				Arguments: api.ToolCallFunctionArguments{"location": location},
+			}}
+		}
+
+		// each tool call is streamed on its own as soon as it's complete,
+		// then all of them with the final response
+		if len(resps) != 3 {
+			t.Fatalf("expected 3 responses, got %d", len(resps))
+		}
+
+		for i, want := range []api.ToolCall{call(0, "Seattle, WA"), call(1, "Portland, OR")} {
+			if resps[i].Done {
+				t.Errorf("expected response %d not to be done", i)
+			}
+
+			if diff := cmp.Diff(resps[i].Message.ToolCalls, []api.ToolCall{want}); diff != "" {
+				t.Errorf("tool call %d mismatch (-got +want):\n%s", i, diff)
+			}
+		}
+
+		final := resps[2]
+		if !final.Done || final.Message.Content != "" || len(final.Message.ToolCalls) > 0 {
+			t.Errorf("unexpected final response %+v", final)
+		}
+
+		if diff := cmp.Diff(final.ToolCalls, []api.ToolCall{call(0, "Seattle, WA"), call(1, "Portland, OR")}); diff != "" {
+			t.Errorf("final tool calls mismatch (-got +want):\n%s", diff)
+		}
+	})
 }
 
 func TestGenerate(t *testing.T) {
@@ -730,6 +1202,22 @@ func TestGenerate(t *testing.T) {
 		}
 	})
 
+	t.Run("missing capabilities images", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:  "test",
+			Prompt: "What is in this image?",
+			Images: []api.ImageData{[]byte("image")},
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(w.Body.String(), `{"error":"registry.ollama.ai/library/test:latest does not support vision"}`); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
 	t.Run("load model", func(t *testing.T) {
 		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
 			Model: "test",
@@ -899,6 +1387,33 @@ func TestGenerate(t *testing.T) {
 		checkGenerateResponse(t, w.Body, "test-system", "Abra kadabra!")
 	})
 
+	w = createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "test-variables",
+		From:   "test",
+		System: "You are {{ .Model }}, talking to {{ .Variables.user }}.",
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	t.Run("prompt with variables", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:     "test-variables",
+			Prompt:    "Hello!",
+			Variables: map[string]string{"user": "Alice"},
+			Stream:    &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(mock.CompletionRequest.Prompt, "System: You are test-variables:latest, talking to Alice. User: Hello! "); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
 	w = createRequest(t, s.CreateHandler, api.CreateRequest{
 		Model: "test-suffix",
 		Template: `{{- if .Suffix }}<PRE> {{ .Prompt }} <SUF>{{ .Suffix }} <MID>
@@ -958,4 +1473,335 @@ func TestGenerate(t *testing.T) {
 			t.Errorf("mismatch (-got +want):\n%s", diff)
 		}
 	})
+
+	t.Run("tokens", func(t *testing.T) {
+		mock.CompletionResponse.Tokens = []int{7, 8}
+		t.Cleanup(func() { mock.CompletionResponse.Tokens = nil })
+
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:        "test-system",
+			Tokens:       []int{1, 2, 3},
+			ReturnTokens: true,
+			Stream:       &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		if mock.CompletionRequest.Prompt != "" || !mock.CompletionRequest.ReturnTokens {
+			t.Errorf("unexpected completion request %+v", mock.CompletionRequest)
+		}
+
+		if diff := cmp.Diff(mock.CompletionRequest.Tokens, []int{1, 2, 3}); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+
+		var resp api.GenerateResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(resp.Tokens, []int{7, 8}); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+
+		if resp.Context != nil {
+			t.Errorf("expected no context, got %v", resp.Context)
+		}
+	})
+
+	t.Run("tokens with prompt", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:  "test-system",
+			Prompt: "Help me write tests.",
+			Tokens: []int{1, 2, 3},
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("logprobs", func(t *testing.T) {
+		logprobs := []api.Logprob{{
+			TokenLogprob: api.TokenLogprob{Token: "Hi", Logprob: -0.1},
+			TopLogprobs:  []api.TokenLogprob{{Token: "Hi", Logprob: -0.1}, {Token: "Hey", Logprob: -2.5}},
+		}}
+		mock.CompletionResponse.Logprobs = logprobs
+		t.Cleanup(func() { mock.CompletionResponse.Logprobs = nil })
+
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:       "test",
+			Prompt:      "Hello!",
+			Logprobs:    true,
+			TopLogprobs: 2,
+			Stream:      &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		if !mock.CompletionRequest.Logprobs || mock.CompletionRequest.TopLogprobs != 2 {
+			t.Errorf("unexpected completion request %+v", mock.CompletionRequest)
+		}
+
+		var resp api.GenerateResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(resp.Logprobs, logprobs); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("top logprobs without logprobs", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:       "test",
+			Prompt:      "Hello!",
+			TopLogprobs: 2,
+			Stream:      &stream,
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("grammar", func(t *testing.T) {
+		format := json.RawMessage(`"root ::= \"yes\" | \"no\""`)
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:  "test",
+			Prompt: "Hello!",
+			Format: format,
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		if diff := cmp.Diff(format, mock.CompletionRequest.Format); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("invalid grammar", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:  "test",
+			Prompt: "Hello!",
+			Format: json.RawMessage(`"root ::= \"a\" root"`),
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(w.Body.String(), `{"error":"invalid format: invalid grammar: grammar cannot match any output"}`); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("adapter", func(t *testing.T) {
+		_, digest := createBinFile(t, llm.KV{"general.type": "adapter"}, nil)
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:    "test-adapter",
+			From:     "test",
+			Adapters: map[string]string{"adapter.gguf": digest},
+			Stream:   &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		w = createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:   "test",
+			Prompt:  "Hello!",
+			Adapter: "test-adapter",
+			Stream:  &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		if !strings.HasSuffix(mock.CompletionRequest.Adapter, strings.Replace(digest, ":", "-", 1)) {
+			t.Errorf("expected the adapter blob, got %q", mock.CompletionRequest.Adapter)
+		}
+
+		for _, adapter := range []string{"missing", "test", "/does/not/exist"} {
+			w = createRequest(t, s.GenerateHandler, api.GenerateRequest{
+				Model:   "test",
+				Prompt:  "Hello!",
+				Adapter: adapter,
+				Stream:  &stream,
+			})
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status 400, got %d", adapter, w.Code)
+			}
+		}
+	})
+
+	mock.CompletionResponse.Content = "**Hi!**"
+	t.Run("render html", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:  "test",
+			Prompt: "Hello!",
+			Render: "html",
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", w.Code)
+		}
+
+		checkGenerateResponse(t, w.Body, "test", "<p><strong>Hi!</strong></p>\n")
+	})
+
+	t.Run("render plain", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:  "test",
+			Prompt: "Hello!",
+			Render: "plain",
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", w.Code)
+		}
+
+		checkGenerateResponse(t, w.Body, "test", "Hi!")
+	})
+
+	t.Run("render streaming", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:  "test",
+			Prompt: "Hello!",
+			Render: "html",
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(w.Body.String(), `{"error":"render is not supported for streaming responses"}`); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("render invalid", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:  "test",
+			Prompt: "Hello!",
+			Render: "rtf",
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+
+	mock.CompletionResponse.Content = "Le ciel est bleu à cause de la lumière."
+	t.Run("detect language", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:   "test",
+			Prompt:  "Pourquoi le ciel est-il bleu ?",
+			Options: map[string]any{"language": "fr"},
+			Stream:  &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(mock.CompletionRequest.Options.Language, "fr"); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+
+		var resp api.GenerateResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Language != "fr" {
+			t.Errorf("expected language fr, got %q", resp.Language)
+		}
+	})
+
+	t.Run("unsupported language", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:   "test",
+			Prompt:  "Hello!",
+			Options: map[string]any{"language": "klingon"},
+			Stream:  &stream,
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(w.Body.String(), `{"error":"unsupported language 'klingon'"}`); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	mock.CompletionResponse = llm.CompletionResponse{
+		Content:    "la la la",
+		Done:       true,
+		DoneReason: "degenerate",
+		Degenerate: &api.Degeneration{Kind: "repetition", At: 131, Window: 128, Repeated: " la", Entropy: 0.02},
+	}
+	t.Run("watchdog", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:   "test",
+			Prompt:  "Sing!",
+			Options: map[string]any{"watchdog": "stop"},
+			Stream:  &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(mock.CompletionRequest.Options.Watchdog, "stop"); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+
+		var resp api.GenerateResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.DoneReason != "degenerate" {
+			t.Errorf("expected done reason degenerate, got %q", resp.DoneReason)
+		}
+
+		if diff := cmp.Diff(resp.Degenerate, mock.CompletionResponse.Degenerate); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("unknown watchdog", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:   "test",
+			Prompt:  "Sing!",
+			Options: map[string]any{"watchdog": "bark"},
+			Stream:  &stream,
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(w.Body.String(), `{"error":"unknown watchdog 'bark'; expected \"warn\" or \"stop\""}`); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
 }
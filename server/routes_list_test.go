@@ -3,6 +3,8 @@ package server
 import (
 	"encoding/json"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"slices"
 	"testing"
 
@@ -63,4 +65,52 @@ func TestList(t *testing.T) {
 	if !slices.Equal(actualNames, expectNames) {
 		t.Fatalf("expected slices to be equal %v", actualNames)
 	}
+
+	createRequest(t, s.CreateHandler, api.CreateRequest{
+		Name:   "translator",
+		From:   "zephyr:7b-beta-q5_K_M",
+		System: "You translate English to French.",
+	})
+
+	cases := []struct {
+		query  string
+		expect []string
+	}{
+		{"code", []string{"boreas:2b-code-v1.5-q6_K", "myhost/mynamespace/lips:code"}},
+		{"7b q5", []string{"zephyr:7b-beta-q5_K_M"}},
+		{"french", []string{"translator:latest"}},
+		{"zephir", []string{"zephyr:7b-beta-q5_K_M"}},
+		{"gemma", nil},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/tags?"+url.Values{"q": {tt.query}}.Encode(), nil)
+
+			s.ListHandler(c)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code 200, actual %d", w.Code)
+			}
+
+			var resp api.ListResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, m := range resp.Models {
+				names = append(names, m.Name)
+			}
+
+			// models that match as well are listed by when they were
+			// modified, which is the same for all of them here
+			slices.Sort(names)
+
+			if !slices.Equal(names, tt.expect) {
+				t.Errorf("expected %v, got %v", tt.expect, names)
+			}
+		})
+	}
 }
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/llm"
+)
+
+func TestRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mock := mockClassifier{
+		mockRunner: mockRunner{
+			CompletionResponse: llm.CompletionResponse{
+				Content:    "func main() {}",
+				Done:       true,
+				DoneReason: "stop",
+			},
+		},
+		logits: []float32{0, float32(math.Log(3))},
+	}
+
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:  make(chan *LlmRequest, 1),
+			finishedReqCh: make(chan *LlmRequest, 1),
+			expiredCh:     make(chan *runnerRef, 1),
+			unloadedCh:    make(chan any, 1),
+			loaded:        make(map[string]*runnerRef),
+			newServerFn:   newMockServer(&mock.mockRunner),
+			getGpuFn:      discover.GetGPUInfo,
+			getCpuFn:      discover.GetCPUInfo,
+			reschedDelay:  250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, ggml *llm.GGML, gpus discover.GpuInfoList, numParallel int) {
+				req.successCh <- &runnerRef{
+					llama: &mock,
+				}
+			},
+		},
+	}
+
+	go s.sched.Run(context.TODO())
+
+	_, digest := createBinFile(t, llm.KV{
+		"general.architecture":              "bert",
+		"bert.context_length":               uint32(512),
+		"bert.pooling_type":                 uint32(4),
+		"bert.classifier.output_labels":     []string{"chat", "code"},
+		"tokenizer.ggml.tokens":             []string{""},
+		"tokenizer.ggml.scores":             []float32{0},
+		"tokenizer.ggml.token_type":         []int32{0},
+		"tokenizer.ggml.token_type_count":   uint32(2),
+		"bert.attention.layer_norm_epsilon": float32(1e-12),
+	}, []llm.Tensor{})
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "intent",
+		Files:  map[string]string{"intent.gguf": digest},
+		Stream: &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	_, digest = createBinFile(t, llm.KV{
+		"general.architecture":          "llama",
+		"llama.block_count":             uint32(1),
+		"llama.context_length":          uint32(8192),
+		"llama.embedding_length":        uint32(4096),
+		"llama.attention.head_count":    uint32(32),
+		"llama.attention.head_count_kv": uint32(8),
+		"tokenizer.ggml.tokens":         []string{""},
+		"tokenizer.ggml.scores":         []float32{0},
+		"tokenizer.ggml.token_type":     []int32{0},
+	}, []llm.Tensor{
+		{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.attn_norm.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.ffn_down.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.ffn_gate.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.ffn_up.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.ffn_norm.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.attn_k.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.attn_output.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.attn_q.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.attn_v.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "output.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+	})
+
+	for _, name := range []string{"codellama", "llama3"} {
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:    name,
+			Files:    map[string]string{"file.gguf": digest},
+			Template: `{{ .System }} {{ .Prompt }}`,
+			System:   name,
+			Stream:   &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+	}
+
+	w = createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model: "assistant",
+		Router: &api.Router{
+			Classifier: "intent",
+			Routes:     map[string]string{"code": "codellama", "chat": "llama3"},
+		},
+		Stream: &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	t.Run("generate", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:  "assistant",
+			Prompt: "write a hello world program in go",
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.GenerateResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.RoutedTo != "codellama:latest" {
+			t.Errorf("expected routed to codellama:latest, got %q", resp.RoutedTo)
+		}
+
+		if resp.Model != "assistant" {
+			t.Errorf("expected model assistant, got %q", resp.Model)
+		}
+
+		if diff := cmp.Diff(mock.CompletionRequest.Prompt, "codellama write a hello world program in go"); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("chat", func(t *testing.T) {
+		mock.logits = []float32{float32(math.Log(3)), 0}
+
+		w := createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model: "assistant",
+			Messages: []api.Message{
+				{Role: "user", Content: "how are you?"},
+			},
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.ChatResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.RoutedTo != "llama3:latest" {
+			t.Errorf("expected routed to llama3:latest, got %q", resp.RoutedTo)
+		}
+	})
+
+	t.Run("show", func(t *testing.T) {
+		w := createRequest(t, s.ShowHandler, api.ShowRequest{Model: "assistant"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.ShowResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Router == nil || resp.Router.Classifier != "intent" {
+			t.Errorf("expected router with classifier intent, got %+v", resp.Router)
+		}
+
+		for _, want := range []string{"ROUTER intent", "ROUTE chat llama3", "ROUTE code codellama"} {
+			if !strings.Contains(resp.Modelfile, want) {
+				t.Errorf("expected modelfile to contain %q, got:\n%s", want, resp.Modelfile)
+			}
+		}
+	})
+
+	cases := []struct {
+		name   string
+		router api.Router
+		want   string
+	}{
+		{
+			name:   "no routes",
+			router: api.Router{Classifier: "intent"},
+			want:   `{"error":"router requires at least one route"}`,
+		},
+		{
+			name:   "missing classifier",
+			router: api.Router{Classifier: "missing", Routes: map[string]string{"code": "codellama"}},
+			want:   `{"error":"classifier \"missing\" not found"}`,
+		},
+		{
+			name:   "classifier without classification",
+			router: api.Router{Classifier: "llama3", Routes: map[string]string{"code": "codellama"}},
+			want:   `{"error":"classifier \"llama3\": does not support classification"}`,
+		},
+		{
+			name:   "unknown label",
+			router: api.Router{Classifier: "intent", Routes: map[string]string{"math": "codellama"}},
+			want:   `{"error":"route \"math\" is not a label of classifier \"intent\""}`,
+		},
+		{
+			name:   "missing model",
+			router: api.Router{Classifier: "intent", Routes: map[string]string{"code": "missing"}},
+			want:   `{"error":"model \"missing\" of route \"code\" not found"}`,
+		},
+		{
+			name:   "nested router",
+			router: api.Router{Classifier: "intent", Routes: map[string]string{"code": "assistant"}},
+			want:   `{"error":"model \"assistant\" of route \"code\" is a router"}`,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := createRequest(t, s.CreateHandler, api.CreateRequest{
+				Model:  "invalid",
+				Router: &tt.router,
+				Stream: &stream,
+			})
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d", w.Code)
+			}
+
+			if diff := cmp.Diff(w.Body.String(), tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
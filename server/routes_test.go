@@ -18,8 +18,12 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 	"unicode"
 
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/llm"
 	"github.com/ollama/ollama/openai"
@@ -654,7 +658,12 @@ func TestShow(t *testing.T) {
 
 	var s Server
 
-	_, digest1 := createBinFile(t, llm.KV{"general.architecture": "test"}, nil)
+	_, digest1 := createBinFile(t, llm.KV{
+		"general.architecture":  "test",
+		"test.context_length":   uint32(4096),
+		"tokenizer.ggml.tokens": []string{"a", "b", "c", "d", "e", "f"},
+		"tokenizer.ggml.merges": []string{"a b"},
+	}, nil)
 	_, digest2 := createBinFile(t, llm.KV{"general.type": "projector", "general.architecture": "clip"}, nil)
 
 	createRequest(t, s.CreateHandler, api.CreateRequest{
@@ -679,9 +688,44 @@ func TestShow(t *testing.T) {
 		t.Fatal("Expected model architecture to be 'test', but got", resp.ModelInfo["general.architecture"])
 	}
 
+	if resp.ModelInfo["test.context_length"] != float64(4096) {
+		t.Errorf("expected context length 4096, got %v", resp.ModelInfo["test.context_length"])
+	}
+
+	// long arrays are left out unless verbose
+	if diff := cmp.Diff([]any{}, resp.ModelInfo["tokenizer.ggml.tokens"]); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]any{"a b"}, resp.ModelInfo["tokenizer.ggml.merges"]); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
 	if resp.ProjectorInfo["general.architecture"] != "clip" {
 		t.Fatal("Expected projector architecture to be 'clip', but got", resp.ProjectorInfo["general.architecture"])
 	}
+
+	if resp.EffectiveConfig == nil || resp.EffectiveConfig.NumCtx != 2048 {
+		t.Fatalf("Expected effective num_ctx 2048, got %+v", resp.EffectiveConfig)
+	}
+
+	expectName := api.ModelName{Host: "registry.ollama.ai", Namespace: "library", Model: "show-model", Tag: "latest"}
+	if resp.Name == nil || *resp.Name != expectName {
+		t.Errorf("expected name %+v, got %+v", expectName, resp.Name)
+	}
+
+	manifest, err := ParseNamedManifest(model.ParseName("show-model"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Digest != manifest.digest {
+		t.Errorf("expected digest %s, got %s", manifest.digest, resp.Digest)
+	}
+
+	if resp.Size != manifest.Size() || resp.Size == 0 {
+		t.Errorf("expected size %d, got %d", manifest.Size(), resp.Size)
+	}
 }
 
 func TestNormalize(t *testing.T) {
@@ -718,3 +762,44 @@ func TestNormalize(t *testing.T) {
 		})
 	}
 }
+
+// disconnectedRecorder is a response recorder whose client has gone.
+type disconnectedRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (disconnectedRecorder) CloseNotify() <-chan bool {
+	ch := make(chan bool, 1)
+	ch <- true
+	return ch
+}
+
+func TestStreamResponseDisconnected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := disconnectedRecorder{httptest.NewRecorder()}
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/generate", nil)
+
+	ch := make(chan any)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(ch)
+		for range 10 {
+			ch <- api.GenerateResponse{Response: "a"}
+		}
+	}()
+
+	streamResponse(c, ch)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the rest of the response to be drained")
+	}
+
+	if w.Body.Len() > 0 {
+		t.Errorf("expected nothing to be written, got %q", w.Body.String())
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/llm"
+)
+
+type mockTokenizer struct {
+	mockRunner
+}
+
+func (mockTokenizer) Detokenize(_ context.Context, tokens []int) (string, error) {
+	words := make([]string, len(tokens))
+	for i, t := range tokens {
+		words[i] = fmt.Sprintf("t%d", t)
+	}
+
+	return strings.Join(words, " "), nil
+}
+
+func TestTokenize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var mock mockTokenizer
+
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:  make(chan *LlmRequest, 1),
+			finishedReqCh: make(chan *LlmRequest, 1),
+			expiredCh:     make(chan *runnerRef, 1),
+			unloadedCh:    make(chan any, 1),
+			loaded:        make(map[string]*runnerRef),
+			newServerFn:   newMockServer(&mock.mockRunner),
+			getGpuFn:      discover.GetGPUInfo,
+			getCpuFn:      discover.GetCPUInfo,
+			reschedDelay:  250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, ggml *llm.GGML, gpus discover.GpuInfoList, numParallel int) {
+				req.successCh <- &runnerRef{
+					llama: &mock,
+				}
+			},
+		},
+	}
+
+	go s.sched.Run(context.TODO())
+
+	_, digest := createBinFile(t, llm.KV{
+		"general.architecture":              "bert",
+		"bert.context_length":               uint32(512),
+		"bert.pooling_type":                 uint32(1),
+		"tokenizer.ggml.tokens":             []string{""},
+		"tokenizer.ggml.scores":             []float32{0},
+		"tokenizer.ggml.token_type":         []int32{0},
+		"tokenizer.ggml.token_type_count":   uint32(2),
+		"bert.attention.layer_norm_epsilon": float32(1e-12),
+	}, []llm.Tensor{})
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:    "test",
+		Files:    map[string]string{"test.gguf": digest},
+		Template: `{{ range .Messages }}{{ .Role }}: {{ .Content }} {{ end }}`,
+		System:   "You are a helpful assistant.",
+		Stream:   &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	tokenize := func(t *testing.T, req api.TokenizeRequest) api.TokenizeResponse {
+		t.Helper()
+
+		w := createRequest(t, s.TokenizeHandler, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.TokenizeResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		return resp
+	}
+
+	t.Run("prompt", func(t *testing.T) {
+		got := tokenize(t, api.TokenizeRequest{Model: "test", Prompt: "Why is the sky blue?"})
+		want := api.TokenizeResponse{Model: "test", Tokens: []int{0, 1, 2, 3, 4}, Count: 5, ContextLength: 2048}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("template", func(t *testing.T) {
+		got := tokenize(t, api.TokenizeRequest{Model: "test", Prompt: "Why is the sky blue?", Template: true})
+		if want := "system: You are a helpful assistant. user: Why is the sky blue? "; got.Prompt != want {
+			t.Errorf("expected prompt %q, got %q", want, got.Prompt)
+		}
+
+		if got.Count != 12 {
+			t.Errorf("expected 12 tokens, got %d", got.Count)
+		}
+	})
+
+	t.Run("messages", func(t *testing.T) {
+		got := tokenize(t, api.TokenizeRequest{Model: "test", Messages: []api.Message{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "Hello!"},
+		}})
+		if want := "system: Be brief. user: Hello! "; got.Prompt != want {
+			t.Errorf("expected prompt %q, got %q", want, got.Prompt)
+		}
+
+		if got.Count != 5 {
+			t.Errorf("expected 5 tokens, got %d", got.Count)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		got := tokenize(t, api.TokenizeRequest{Model: "test"})
+		if got.Tokens == nil || got.Count != 0 {
+			t.Errorf("expected no tokens, got %+v", got)
+		}
+	})
+
+	t.Run("prompt and messages", func(t *testing.T) {
+		w := createRequest(t, s.TokenizeHandler, api.TokenizeRequest{Model: "test", Prompt: "Hello", Messages: []api.Message{{Role: "user", Content: "Hello"}}})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("missing model", func(t *testing.T) {
+		w := createRequest(t, s.TokenizeHandler, api.TokenizeRequest{Model: "missing", Prompt: "Hello"})
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("detokenize", func(t *testing.T) {
+		w := createRequest(t, s.DetokenizeHandler, api.DetokenizeRequest{Model: "test", Tokens: []int{1, 2, 3}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.DetokenizeResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(api.DetokenizeResponse{Model: "test", Text: "t1 t2 t3"}, resp); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
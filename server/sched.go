@@ -19,6 +19,7 @@ import (
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/tracing"
 )
 
 type LlmRequest struct {
@@ -30,6 +31,15 @@ type LlmRequest struct {
 	successCh       chan *runnerRef
 	errCh           chan error
 	schedAttempts   uint
+
+	// defragged is set once a failed load of the request has been retried
+	// after compacting VRAM
+	defragged bool
+
+	// started is when the request was given a loaded runner, and queued is
+	// set if it had to wait for a slot in it
+	started time.Time
+	queued  bool
 }
 
 type Scheduler struct {
@@ -42,10 +52,16 @@ type Scheduler struct {
 	loadedMu sync.Mutex
 
 	loadFn       func(req *LlmRequest, ggml *llm.GGML, gpus discover.GpuInfoList, numParallel int)
-	newServerFn  func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error)
+	newServerFn  func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, tokenizer string, opts api.Options, numParallel int) (llm.LlamaServer, error)
 	getGpuFn     func() discover.GpuInfoList
 	getCpuFn     func() discover.GpuInfoList
 	reschedDelay time.Duration
+
+	// events receives the progress of model loads
+	events *eventBus
+
+	// defragMu serializes compactions of VRAM
+	defragMu sync.Mutex
 }
 
 // Default automatic value for number of models we allow per GPU
@@ -60,6 +76,35 @@ var defaultParallel = 4
 
 var ErrMaxQueue = errors.New("server busy, please try again.  maximum pending requests exceeded")
 
+var errGPUSplit = errors.New("invalid gpu split")
+
+// checkGPUSplit validates the options that place a model on the GPUs
+// detected, gpus, against how many there are.
+func checkGPUSplit(opts api.Options, gpus discover.GpuInfoList) error {
+	var n int
+	for _, g := range gpus {
+		if g.Library != "cpu" {
+			n++
+		}
+	}
+
+	if opts.MainGPU > 0 && opts.MainGPU >= n {
+		return fmt.Errorf("%w: main_gpu is %d but %d GPUs were detected", errGPUSplit, opts.MainGPU, n)
+	}
+
+	if _, _, err := llm.SplitLayers(opts, n); err != nil {
+		return fmt.Errorf("%w: %w", errGPUSplit, err)
+	}
+
+	return nil
+}
+
+// hasGPUSplit reports whether opts split the model across GPUs, which are
+// then all used in the order they were detected.
+func hasGPUSplit(opts api.Options) bool {
+	return opts.TensorSplit != "" || opts.GPULayers != ""
+}
+
 func InitScheduler(ctx context.Context) *Scheduler {
 	maxQueue := envconfig.MaxQueue()
 	sched := &Scheduler{
@@ -72,6 +117,7 @@ func InitScheduler(ctx context.Context) *Scheduler {
 		getGpuFn:      discover.GetGPUInfo,
 		getCpuFn:      discover.GetCPUInfo,
 		reschedDelay:  250 * time.Millisecond,
+		events:        newEventBus(),
 	}
 	sched.loadFn = sched.load
 	return sched
@@ -92,6 +138,11 @@ func (s *Scheduler) GetRunner(c context.Context, model *Model, opts api.Options,
 		errCh:           make(chan error, 1),
 	}
 
+	if err := s.shed(model, time.Duration(opts.FirstTokenSLO)*time.Millisecond); err != nil {
+		req.errCh <- err
+		return req.successCh, req.errCh
+	}
+
 	select {
 	case s.pendingReqCh <- req:
 	default:
@@ -126,10 +177,13 @@ func (s *Scheduler) processPending(ctx context.Context) {
 			}
 
 			if pending.ctx.Err() != nil {
-				slog.Debug("pending request cancelled or timed out, skipping scheduling")
+				slog.DebugContext(pending.ctx, "pending request cancelled or timed out, skipping scheduling")
 				continue
 			}
 			numParallel := int(envconfig.NumParallel())
+			if pending.opts.NumParallel > 0 {
+				numParallel = pending.opts.NumParallel
+			}
 			// TODO (jmorganca): mllama doesn't support parallel yet
 			// see https://github.com/ollama/ollama/issues/4165
 			if checkMllamaModelFamily(pending.model) && numParallel != 1 {
@@ -162,6 +216,10 @@ func (s *Scheduler) processPending(ctx context.Context) {
 						gpus = s.getCpuFn()
 					} else {
 						gpus = s.getGpuFn()
+						if err := checkGPUSplit(pending.opts, gpus); err != nil {
+							pending.errCh <- err
+							break
+						}
 					}
 
 					if envconfig.MaxRunners() <= 0 {
@@ -193,8 +251,9 @@ func (s *Scheduler) processPending(ctx context.Context) {
 						break
 					}
 
-					// Embedding models should always be loaded with parallel=1
-					if pending.model.CheckCapabilities(CapabilityCompletion) != nil {
+					// Embedding models are loaded with parallel=1 unless the
+					// model sets num_parallel
+					if pending.model.CheckCapabilities(CapabilityCompletion) != nil && pending.opts.NumParallel <= 0 {
 						numParallel = 1
 					}
 
@@ -221,7 +280,7 @@ func (s *Scheduler) processPending(ctx context.Context) {
 						// else we need to expire a runner
 					} else if loadedCount == 0 {
 						// No models loaded. Load the model but prefer the best fit.
-						slog.Debug("loading first model", "model", pending.model.ModelPath)
+						slog.DebugContext(pending.ctx, "loading first model", "model", pending.model.ModelPath)
 						g := pickBestFullFitByLibrary(pending, ggml, gpus, &numParallel)
 						if g != nil {
 							gpus = g
@@ -263,7 +322,7 @@ func (s *Scheduler) processPending(ctx context.Context) {
 							go func() {
 								// Process in a go routine to avoid deadlocking
 								// the scheduler if our queue is full
-								slog.Debug("delaying scheduling while other models finish loading", "attempts", pending.schedAttempts, "model", pending.model.ModelPath)
+								slog.DebugContext(pending.ctx, "delaying scheduling while other models finish loading", "attempts", pending.schedAttempts, "model", pending.model.ModelPath)
 								time.Sleep(s.reschedDelay)
 								s.pendingReqCh <- pending
 							}()
@@ -327,6 +386,9 @@ func (s *Scheduler) processCompleted(ctx context.Context) {
 			}
 			runner.refMu.Lock()
 			runner.refCount--
+			if !finished.started.IsZero() && !finished.queued {
+				runner.observe(time.Since(finished.started))
+			}
 			if runner.refCount <= 0 {
 				if runner.sessionDuration <= 0 {
 					slog.Debug("runner with zero duration has gone idle, expiring to unload", "modelPath", runner.modelPath)
@@ -376,12 +438,21 @@ func (s *Scheduler) processCompleted(ctx context.Context) {
 			finished := runner.waitForVRAMRecovery()
 			runner.unload()
 			delete(s.loaded, runner.modelPath)
+			forgetContextLengths(runner.modelPath)
 			s.loadedMu.Unlock()
 			slog.Debug("runner released", "modelPath", runner.modelPath)
 			runner.refMu.Unlock()
 
 			<-finished
 			slog.Debug("sending an unloaded event", "modelPath", runner.modelPath)
+			if runner.unloaded != nil {
+				// a runner can be expired more than once
+				select {
+				case <-runner.unloaded:
+				default:
+					close(runner.unloaded)
+				}
+			}
 			s.unloadedCh <- struct{}{}
 		}
 	}
@@ -394,6 +465,8 @@ func (pending *LlmRequest) useLoadedRunner(runner *runnerRef, finished chan *Llm
 	runner.refMu.Lock()
 	defer runner.refMu.Unlock()
 	runner.refCount++
+	pending.started = time.Now()
+	pending.queued = int(runner.refCount) > runner.numParallel
 	if runner.expireTimer != nil {
 		runner.expireTimer.Stop()
 		runner.expireTimer = nil
@@ -413,19 +486,30 @@ func (s *Scheduler) load(req *LlmRequest, ggml *llm.GGML, gpus discover.GpuInfoL
 	if numParallel < 1 {
 		numParallel = 1
 	}
+	loadStart := time.Now()
 	sessionDuration := envconfig.KeepAlive()
 	if req.sessionDuration != nil {
 		sessionDuration = req.sessionDuration.Duration
 	}
-	llama, err := s.newServerFn(gpus, req.model.ModelPath, ggml, req.model.AdapterPaths, req.model.ProjectorPaths, req.opts, numParallel)
+
+	_, span := tracing.Start(req.ctx, "load",
+		tracing.String("model", req.model.ShortName),
+		tracing.Int("gpus", len(gpus)),
+		tracing.Int("num_parallel", numParallel),
+	)
+
+	llama, err := s.newServerFn(gpus, req.model.ModelPath, ggml, req.model.AdapterPaths, req.model.ProjectorPaths, req.model.TokenizerPath, req.opts, numParallel)
 	if err != nil {
+		span.SetError(err)
+		span.End()
+
 		// some older models are not compatible with newer versions of llama.cpp
 		// show a generalized compatibility error until there is a better way to
 		// check for model compatibility
 		if errors.Is(err, llm.ErrUnsupportedFormat) || strings.Contains(err.Error(), "failed to load model") {
 			err = fmt.Errorf("%v: this model may be incompatible with your version of Ollama. If you previously pulled this model, try updating it by running `ollama pull %s`", err, req.model.ShortName)
 		}
-		slog.Info("NewLlamaServer failed", "model", req.model.ModelPath, "error", err)
+		slog.InfoContext(req.ctx, "NewLlamaServer failed", "model", req.model.ModelPath, "error", err)
 		req.errCh <- err
 		return
 	}
@@ -440,7 +524,10 @@ func (s *Scheduler) load(req *LlmRequest, ggml *llm.GGML, gpus discover.GpuInfoL
 		estimatedTotal:  llama.EstimatedTotal(),
 		loading:         true,
 		refCount:        1,
+		loadStart:       loadStart,
+		unloaded:        make(chan struct{}),
 	}
+	runner.gpuLayers, runner.totalLayers = llama.EstimatedLayers()
 	runner.numParallel = numParallel
 	runner.refMu.Lock()
 
@@ -449,27 +536,94 @@ func (s *Scheduler) load(req *LlmRequest, ggml *llm.GGML, gpus discover.GpuInfoL
 	slog.Info("loaded runners", "count", len(s.loaded))
 	s.loadedMu.Unlock()
 
+	progress := loadProgressFunc(req.ctx)
+	report := func(e api.LoadEvent) {
+		e.Model = req.model.ShortName
+		e.GPULayers, e.Layers = runner.gpuLayers, runner.totalLayers
+		s.events.publish(api.Event{Type: "load", Time: time.Now().UTC(), Load: &e})
+		if progress != nil {
+			progress(e)
+		}
+	}
+
+	report(api.LoadEvent{Stage: "starting"})
+
 	go func() {
 		defer runner.refMu.Unlock()
-		if err = llama.WaitUntilRunning(req.ctx); err != nil {
-			slog.Error("error loading llama server", "error", err)
+
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			watchLoad(llama, report, stop)
+		}()
+
+		err = llama.WaitUntilRunning(req.ctx)
+		close(stop)
+		wg.Wait()
+
+		span.SetAttributes(tracing.Int("gpu_layers", runner.gpuLayers), tracing.Int("layers", runner.totalLayers))
+		span.SetError(err)
+		span.End()
+
+		if err != nil {
+			slog.ErrorContext(req.ctx, "error loading llama server", "error", err)
 			runner.refCount--
-			req.errCh <- err
-			slog.Debug("triggering expiration for failed load", "model", runner.modelPath)
+			if isAllocationError(err) && !req.defragged {
+				req.defragged = true
+				go s.retryAfterDefrag(req, runner.unloaded, runner.gpus, runner.estimatedVRAM, err)
+			} else {
+				report(api.LoadEvent{Stage: "failed", Error: err.Error()})
+				req.errCh <- err
+			}
+			slog.DebugContext(req.ctx, "triggering expiration for failed load", "model", runner.modelPath)
 			s.expiredCh <- runner
 			return
 		}
-		slog.Debug("finished setting up runner", "model", req.model.ModelPath)
+		slog.DebugContext(req.ctx, "finished setting up runner", "model", req.model.ModelPath)
+		report(api.LoadEvent{Stage: "ready", Progress: 1})
 		runner.loading = false
+		runner.loadEnd = time.Now()
 		go func() {
 			<-req.ctx.Done()
-			slog.Debug("context for request finished")
+			slog.DebugContext(req.ctx, "context for request finished")
 			s.finishedReqCh <- req
 		}()
 		req.successCh <- runner
 	}()
 }
 
+// loadDuration returns how much of the time between start and end was spent
+// loading the runner for model m. The rest of a request's wait for a runner
+// is spent queued.
+func (s *Scheduler) loadDuration(m *Model, start, end time.Time) time.Duration {
+	s.loadedMu.Lock()
+	runner := s.loaded[m.ModelPath]
+	s.loadedMu.Unlock()
+
+	if runner == nil {
+		return 0
+	}
+
+	runner.refMu.Lock()
+	defer runner.refMu.Unlock()
+
+	if runner.loadEnd.IsZero() {
+		return 0
+	}
+
+	if runner.loadStart.After(start) {
+		start = runner.loadStart
+	}
+
+	if runner.loadEnd.Before(end) {
+		end = runner.loadEnd
+	}
+
+	return max(end.Sub(start), 0)
+}
+
 func (s *Scheduler) updateFreeSpace(allGpus discover.GpuInfoList) {
 	type predKey struct {
 		Library string
@@ -545,15 +699,29 @@ type runnerRef struct {
 	gpus           discover.GpuInfoList // Recorded at time of provisioning
 	estimatedVRAM  uint64
 	estimatedTotal uint64
+	gpuLayers      int
+	totalLayers    int
+
+	// loadStart and loadEnd bound the time spent loading the runner
+	loadStart time.Time
+	loadEnd   time.Time
 
 	sessionDuration time.Duration
 	expireTimer     *time.Timer
 	expiresAt       time.Time
 
+	// unloaded is closed once the runner has been unloaded and its VRAM
+	// has been released
+	unloaded chan struct{}
+
 	model       *Model
 	modelPath   string
 	numParallel int
 	*api.Options
+
+	// requestDuration is a moving average of how long requests that didn't
+	// wait for a slot took, used to predict how long new requests wait
+	requestDuration time.Duration
 }
 
 // The refMu must already be held when calling unload
@@ -572,7 +740,7 @@ func (runner *runnerRef) unload() {
 }
 
 func (runner *runnerRef) needsReload(ctx context.Context, req *LlmRequest) bool {
-	slog.Debug("evaluating already loaded", "model", req.model.ModelPath)
+	slog.DebugContext(req.ctx, "evaluating already loaded", "model", req.model.ModelPath)
 	runner.refMu.Lock()
 	defer runner.refMu.Unlock()
 
@@ -703,15 +871,17 @@ func pickBestFullFitByLibrary(req *LlmRequest, ggml *llm.GGML, gpus discover.Gpu
 		// TODO - potentially sort by performance capability, existing models loaded, etc.
 		// TODO - Eliminate any GPUs that already have envconfig.MaxRunners loaded on them
 		// Note: at present, this will favor more VRAM over faster GPU speed in mixed setups
-		sort.Sort(sort.Reverse(discover.ByFreeMemory(sgl)))
+		if !hasGPUSplit(req.opts) {
+			sort.Sort(sort.Reverse(discover.ByFreeMemory(sgl)))
+		}
 
 		// First attempt to fit the model into a single GPU
 		for _, p := range numParallelToTry {
 			req.opts.NumCtx = req.origNumCtx * p
-			if !envconfig.SchedSpread() {
+			if !envconfig.SchedSpread() && !hasGPUSplit(req.opts) {
 				for _, g := range sgl {
 					if ok, estimatedVRAM = llm.PredictServerFit([]discover.GpuInfo{g}, ggml, req.model.AdapterPaths, req.model.ProjectorPaths, req.opts); ok {
-						slog.Info("new model will fit in available VRAM in single GPU, loading", "model", req.model.ModelPath, "gpu", g.ID, "parallel", p, "available", g.FreeMemory, "required", format.HumanBytes2(estimatedVRAM))
+						slog.InfoContext(req.ctx, "new model will fit in available VRAM in single GPU, loading", "model", req.model.ModelPath, "gpu", g.ID, "parallel", p, "available", g.FreeMemory, "required", format.HumanBytes2(estimatedVRAM))
 						*numParallel = p
 						return []discover.GpuInfo{g}
 					}
@@ -727,7 +897,7 @@ func pickBestFullFitByLibrary(req *LlmRequest, ggml *llm.GGML, gpus discover.Gpu
 		for _, p := range numParallelToTry {
 			req.opts.NumCtx = req.origNumCtx * p
 			if ok, estimatedVRAM = llm.PredictServerFit(sgl, ggml, req.model.AdapterPaths, req.model.ProjectorPaths, req.opts); ok {
-				slog.Info("new model will fit in available VRAM, loading", "model", req.model.ModelPath, "library", sgl[0].Library, "parallel", p, "required", format.HumanBytes2(estimatedVRAM))
+				slog.InfoContext(req.ctx, "new model will fit in available VRAM, loading", "model", req.model.ModelPath, "library", sgl[0].Library, "parallel", p, "required", format.HumanBytes2(estimatedVRAM))
 				*numParallel = p
 				return sgl
 			}
@@ -820,6 +990,53 @@ func (s *Scheduler) expireRunner(model *Model) {
 	}
 }
 
+// busy returns true if any models are loaded.
+func (s *Scheduler) busy() bool {
+	s.loadedMu.Lock()
+	defer s.loadedMu.Unlock()
+	return len(s.loaded) > 0
+}
+
+// expiring reports whether model has no runner, or one that is unloaded as
+// soon as it is idle, because the model was unloaded or loaded with a keep
+// alive of 0.
+func (s *Scheduler) expiring(model *Model) bool {
+	s.loadedMu.Lock()
+	runner, ok := s.loaded[model.ModelPath]
+	s.loadedMu.Unlock()
+	if !ok {
+		return true
+	}
+
+	runner.refMu.Lock()
+	defer runner.refMu.Unlock()
+	return runner.sessionDuration <= 0
+}
+
+// unloadModel expires the runner of model and waits until it has been
+// unloaded and its VRAM released. Requests the runner is serving finish
+// first. It returns false if the model isn't loaded.
+func (s *Scheduler) unloadModel(ctx context.Context, model *Model) (bool, error) {
+	s.loadedMu.Lock()
+	runner, ok := s.loaded[model.ModelPath]
+	s.loadedMu.Unlock()
+	if !ok {
+		return false, nil
+	}
+
+	s.expireRunner(model)
+	if runner.unloaded == nil {
+		return true, nil
+	}
+
+	select {
+	case <-runner.unloaded:
+		return true, nil
+	case <-ctx.Done():
+		return true, ctx.Err()
+	}
+}
+
 // If other runners are loaded, make sure the pending request will fit in system memory
 // If not, pick a runner to unload, else return nil and the request can be loaded
 func (s *Scheduler) maybeFindCPURunnerToUnload(req *LlmRequest, ggml *llm.GGML, gpus discover.GpuInfoList) *runnerRef {
@@ -47,7 +47,7 @@ func TestLoad(t *testing.T) {
 		sessionDuration: &api.Duration{Duration: 2 * time.Second},
 	}
 	// Fail to load model first
-	s.newServerFn = func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+	s.newServerFn = func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, tokenizer string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
 		return nil, errors.New("something failed to load model blah")
 	}
 	gpus := discover.GpuInfoList{}
@@ -61,7 +61,7 @@ func TestLoad(t *testing.T) {
 	require.Contains(t, err.Error(), "this model may be incompatible")
 
 	server := &mockLlm{estimatedVRAM: 10, estimatedVRAMByGPU: map[string]uint64{}}
-	s.newServerFn = func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+	s.newServerFn = func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, tokenizer string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
 		return server, nil
 	}
 	s.load(req, ggml, gpus, 0)
@@ -102,7 +102,7 @@ type reqBundle struct {
 	ggml    *llm.GGML
 }
 
-func (scenario *reqBundle) newServer(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+func (scenario *reqBundle) newServer(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, tokenizer string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
 	return scenario.srv, nil
 }
 
@@ -208,6 +208,31 @@ func TestRequestsSameModelSameRequest(t *testing.T) {
 	}
 }
 
+func TestRequestsModelNumParallel(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer done()
+	t.Setenv("OLLAMA_NUM_PARALLEL", "2")
+
+	s := InitScheduler(ctx)
+	s.getGpuFn = getGpuFn
+	s.getCpuFn = getCpuFn
+	a := newScenarioRequest(t, ctx, "ollama-model-1", 10, nil)
+	a.req.opts.NumParallel = 3
+
+	s.newServerFn = a.newServer
+	s.pendingReqCh <- a.req
+	s.Run(ctx)
+	select {
+	case resp := <-a.req.successCh:
+		require.Equal(t, 3, resp.numParallel)
+		require.Equal(t, a.req.origNumCtx*3, resp.Options.NumCtx)
+	case err := <-a.req.errCh:
+		t.Fatal(err.Error())
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+}
+
 func TestRequestsSimpleReloadSameModel(t *testing.T) {
 	ctx, done := context.WithTimeout(context.Background(), 500*time.Millisecond)
 	defer done()
@@ -406,6 +431,98 @@ func TestGetRunner(t *testing.T) {
 	b.ctxDone()
 }
 
+func TestLoadDuration(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer done()
+
+	s := InitScheduler(ctx)
+	m := &Model{ModelPath: "foo"}
+
+	start := time.Now()
+	s.loaded[m.ModelPath] = &runnerRef{
+		loadStart: start.Add(-time.Second),
+		loadEnd:   start.Add(3 * time.Second),
+	}
+
+	// only the part of the load after the request arrived counts
+	require.Equal(t, 3*time.Second, s.loadDuration(m, start, start.Add(5*time.Second)))
+
+	// requests arriving after the load only queue
+	require.Equal(t, time.Duration(0), s.loadDuration(m, start.Add(4*time.Second), start.Add(5*time.Second)))
+	require.Equal(t, time.Duration(0), s.loadDuration(&Model{ModelPath: "bar"}, start, start.Add(time.Second)))
+}
+
+func TestShed(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer done()
+
+	s := InitScheduler(ctx)
+	m := &Model{ModelPath: "foo", ShortName: "foo:latest"}
+
+	busy := &runnerRef{model: m, modelPath: m.ModelPath, numParallel: 2, refCount: 3}
+	busy.observe(2 * time.Second)
+	s.loaded[m.ModelPath] = busy
+
+	idle := &Model{ModelPath: "bar", ShortName: "bar:latest"}
+	s.loaded[idle.ModelPath] = &runnerRef{model: idle, modelPath: idle.ModelPath, numParallel: 1}
+
+	slow := &Model{ModelPath: "baz", ShortName: "baz:latest"}
+	s.loaded[slow.ModelPath] = &runnerRef{model: slow, modelPath: slow.ModelPath, numParallel: 1, refCount: 4, requestDuration: time.Minute}
+
+	// two requests are ahead of a new one, spread over two slots
+	require.Equal(t, 2*time.Second, busy.predictedWait())
+
+	require.NoError(t, s.shed(m, 0))
+	require.NoError(t, s.shed(m, 3*time.Second))
+	require.NoError(t, s.shed(&Model{ModelPath: "unloaded"}, time.Millisecond))
+
+	var shedErr *ShedError
+	require.ErrorAs(t, s.shed(m, time.Second), &shedErr)
+	require.Equal(t, 2*time.Second, shedErr.PredictedWait)
+	require.Equal(t, []string{"bar:latest"}, shedErr.Alternatives)
+
+	_, errCh := s.GetRunner(ctx, m, api.Options{FirstTokenSLO: 1000}, nil)
+	require.ErrorAs(t, <-errCh, &shedErr)
+}
+
+func TestLoadEvents(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer done()
+	s := InitScheduler(ctx)
+	s.newServerFn = func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, tokenizer string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+		return &mockLlm{estimatedVRAMByGPU: map[string]uint64{}}, nil
+	}
+
+	events, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+
+	var stages []string
+	req := &LlmRequest{
+		ctx: withLoadProgress(ctx, func(e api.LoadEvent) {
+			stages = append(stages, e.Stage)
+		}),
+		model:     &Model{ModelPath: "foo", ShortName: "foo:latest"},
+		opts:      api.DefaultOptions(),
+		successCh: make(chan *runnerRef, 1),
+		errCh:     make(chan error, 1),
+	}
+
+	s.load(req, nil, discover.GpuInfoList{}, 1)
+	select {
+	case err := <-req.errCh:
+		t.Fatal(err)
+	case <-req.successCh:
+	}
+
+	require.Equal(t, []string{"starting", "ready"}, stages)
+	for _, stage := range stages {
+		e := <-events
+		require.Equal(t, "load", e.Type)
+		require.Equal(t, "foo:latest", e.Load.Model)
+		require.Equal(t, stage, e.Load.Stage)
+	}
+}
+
 func TestExpireRunner(t *testing.T) {
 	ctx, done := context.WithTimeout(context.Background(), 20*time.Millisecond)
 	defer done()
@@ -422,7 +539,7 @@ func TestExpireRunner(t *testing.T) {
 	var ggml *llm.GGML
 	gpus := discover.GpuInfoList{}
 	server := &mockLlm{estimatedVRAM: 10, estimatedVRAMByGPU: map[string]uint64{}}
-	s.newServerFn = func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+	s.newServerFn = func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, tokenizer string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
 		return server, nil
 	}
 	s.load(req, ggml, gpus, 0)
@@ -452,6 +569,43 @@ func TestExpireRunner(t *testing.T) {
 	s.loadedMu.Unlock()
 }
 
+func TestUnloadModel(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer done()
+
+	s := InitScheduler(ctx)
+	s.getGpuFn = getGpuFn
+	s.getCpuFn = getCpuFn
+	a := newScenarioRequest(t, ctx, "ollama-model-1", 10, &api.Duration{Duration: time.Minute})
+	s.newServerFn = a.newServer
+	s.Run(ctx)
+
+	unloaded, err := s.unloadModel(ctx, a.req.model)
+	require.NoError(t, err)
+	require.False(t, unloaded)
+
+	s.pendingReqCh <- a.req
+	select {
+	case <-a.req.successCh:
+	case err := <-a.req.errCh:
+		t.Fatal(err.Error())
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+
+	// the model is unloaded once the request it's serving finishes, well
+	// before its keep alive
+	time.AfterFunc(10*time.Millisecond, a.ctxDone)
+	unloaded, err = s.unloadModel(ctx, a.req.model)
+	require.NoError(t, err)
+	require.True(t, unloaded)
+	require.True(t, a.srv.closeCalled)
+
+	s.loadedMu.Lock()
+	require.Empty(t, s.loaded)
+	s.loadedMu.Unlock()
+}
+
 // TODO - add one scenario that triggers the bogus finished event with positive ref count
 func TestPrematureExpired(t *testing.T) {
 	ctx, done := context.WithTimeout(context.Background(), 500*time.Millisecond)
@@ -729,9 +883,9 @@ func TestHomogeneousGPUs(t *testing.T) {
 	}
 	s.getCpuFn = getCpuFn
 	a := newScenarioRequest(t, ctx, "ollama-model-1", 10, &api.Duration{Duration: 5 * time.Millisecond})
-	s.newServerFn = func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+	s.newServerFn = func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, tokenizer string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
 		require.Len(t, gpus, 1)
-		return a.newServer(gpus, model, ggml, adapters, projectors, opts, numParallel)
+		return a.newServer(gpus, model, ggml, adapters, projectors, tokenizer, opts, numParallel)
 	}
 	slog.Info("a")
 	s.pendingReqCh <- a.req
@@ -749,6 +903,79 @@ func TestHomogeneousGPUs(t *testing.T) {
 	}
 }
 
+func TestGPUSplit(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer done()
+	s := InitScheduler(ctx)
+
+	s.getGpuFn = func() discover.GpuInfoList {
+		// the model fits on either GPU alone
+		gpus := []discover.GpuInfo{
+			{ID: "0", Library: "cuda"},
+			{ID: "1", Library: "cuda"},
+		}
+		gpus[0].TotalMemory = 8 * format.GibiByte
+		gpus[0].FreeMemory = 8 * format.GibiByte
+		gpus[1].TotalMemory = 24 * format.GibiByte
+		gpus[1].FreeMemory = 24 * format.GibiByte
+		return gpus
+	}
+	s.getCpuFn = getCpuFn
+
+	invalid := newScenarioRequest(t, ctx, "ollama-model-1", 10, &api.Duration{Duration: 5 * time.Millisecond})
+	invalid.req.opts.TensorSplit = "1,1,1"
+
+	a := newScenarioRequest(t, ctx, "ollama-model-2", 10, &api.Duration{Duration: 5 * time.Millisecond})
+	a.req.opts.TensorSplit = "1,3"
+	s.newServerFn = func(gpus discover.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, tokenizer string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+		// every GPU is used in the order they were detected
+		require.Len(t, gpus, 2)
+		require.Equal(t, "0", gpus[0].ID)
+		return a.newServer(gpus, model, ggml, adapters, projectors, tokenizer, opts, numParallel)
+	}
+
+	s.pendingReqCh <- invalid.req
+	s.pendingReqCh <- a.req
+	s.Run(ctx)
+
+	select {
+	case err := <-invalid.req.errCh:
+		require.ErrorIs(t, err, errGPUSplit)
+		require.ErrorContains(t, err, "tensor_split has 3 values but 2 GPUs were detected")
+	case <-invalid.req.successCh:
+		t.Fatal("expected an invalid split to fail")
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+
+	select {
+	case resp := <-a.req.successCh:
+		require.Equal(t, resp.llama, a.srv)
+	case err := <-a.req.errCh:
+		t.Fatal(err.Error())
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+}
+
+func TestCheckGPUSplit(t *testing.T) {
+	gpus := discover.GpuInfoList{{ID: "0", Library: "cuda"}, {ID: "1", Library: "cuda"}}
+
+	opts := api.DefaultOptions()
+	opts.MainGPU = 1
+	require.NoError(t, checkGPUSplit(opts, gpus))
+
+	opts.MainGPU = 2
+	require.ErrorIs(t, checkGPUSplit(opts, gpus), errGPUSplit)
+
+	opts = api.DefaultOptions()
+	opts.GPULayers = "30,10"
+	require.NoError(t, checkGPUSplit(opts, gpus))
+
+	// there are no GPUs to split the model across
+	require.ErrorIs(t, checkGPUSplit(opts, discover.GpuInfoList{{Library: "cpu"}}), errGPUSplit)
+}
+
 type mockLlm struct {
 	pingResp           error
 	waitResp           error
@@ -772,7 +999,7 @@ func (s *mockLlm) Completion(ctx context.Context, req llm.CompletionRequest, fn
 	return s.completionResp
 }
 
-func (s *mockLlm) Embedding(ctx context.Context, input string) ([]float32, error) {
+func (s *mockLlm) Embedding(ctx context.Context, input string, images []llm.ImageData) ([]float32, error) {
 	return s.embeddingResp, s.embeddingRespErr
 }
 
@@ -791,3 +1018,5 @@ func (s *mockLlm) Close() error {
 func (s *mockLlm) EstimatedVRAM() uint64                  { return s.estimatedVRAM }
 func (s *mockLlm) EstimatedTotal() uint64                 { return s.estimatedTotal }
 func (s *mockLlm) EstimatedVRAMByGPU(gpuid string) uint64 { return s.estimatedVRAMByGPU[gpuid] }
+func (s *mockLlm) EstimatedLayers() (int, int)            { return 0, 0 }
+func (s *mockLlm) LoadProgress() llm.LoadProgress         { return llm.LoadProgress{} }
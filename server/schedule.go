@@ -0,0 +1,284 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// cronField is the set of values of a field of a cron expression, as a bit
+// per value.
+type cronField uint64
+
+// cronSpec is a parsed cron expression of five fields: minute, hour, day of
+// the month, month and day of the week.
+type cronSpec struct {
+	minute, hour, dom, month, dow cronField
+
+	// domAny and dowAny are set if the day fields are "*". Like cron, a
+	// time matches if either day field matches when both are restricted.
+	domAny, dowAny bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// parseCron parses a cron expression such as "0 9 * * 1-5". Fields are a
+// "*", a value, a range "a-b" or a comma separated list of them, each
+// optionally followed by a step "/n". Days of the week are 0 to 7, with
+// both 0 and 7 for Sunday.
+func parseCron(s string) (*cronSpec, error) {
+	if macro, ok := cronMacros[strings.TrimSpace(s)]; ok {
+		s = macro
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields", s)
+	}
+
+	var c cronSpec
+	var err error
+	for i, f := range []struct {
+		field    *cronField
+		min, max int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	} {
+		if *f.field, err = parseCronField(fields[i], f.min, f.max); err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", s, err)
+		}
+	}
+
+	// Sunday is both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+	return &c, nil
+}
+
+func parseCronField(s string, lo, hi int) (cronField, error) {
+	var f cronField
+	for _, part := range strings.Split(s, ",") {
+		expr, stepStr, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = n
+		}
+
+		start, end := lo, hi
+		if expr != "*" {
+			a, b, isRange := strings.Cut(expr, "-")
+
+			var err error
+			if start, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("invalid value %q", a)
+			}
+
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("invalid value %q", b)
+				}
+			} else if hasStep {
+				end = hi
+			}
+
+			if start < lo || end > hi || start > end {
+				return 0, fmt.Errorf("%q is out of range %d-%d", expr, lo, hi)
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			f |= 1 << v
+		}
+	}
+
+	return f, nil
+}
+
+func (f cronField) has(v int) bool {
+	return f&(1<<v) != 0
+}
+
+// matches returns true if the minute of t matches the expression.
+func (c *cronSpec) matches(t time.Time) bool {
+	if !c.minute.has(t.Minute()) || !c.hour.has(t.Hour()) || !c.month.has(int(t.Month())) {
+		return false
+	}
+
+	dom, dow := c.dom.has(t.Day()), c.dow.has(int(t.Weekday()))
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// modelSchedule is an entry in the schedules file: when to load and unload
+// a model.
+type modelSchedule struct {
+	Model string `json:"model"`
+
+	// Load and Unload are cron expressions of when the model is loaded and
+	// unloaded, evaluated in the local time of the server.
+	Load   string `json:"load"`
+	Unload string `json:"unload"`
+
+	// KeepAlive is how long the model stays loaded after a scheduled load.
+	// It defaults to until it is unloaded if Unload is set, or else to
+	// OLLAMA_KEEP_ALIVE.
+	KeepAlive *api.Duration `json:"keep_alive,omitempty"`
+
+	load, unload *cronSpec
+}
+
+// loadSchedules reads the schedules file at path. It returns nil if path is
+// empty.
+func loadSchedules(path string) ([]*modelSchedule, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var config struct {
+		Schedules []*modelSchedule `json:"schedules"`
+	}
+
+	if err := json.NewDecoder(f).Decode(&config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, sc := range config.Schedules {
+		if !model.ParseName(sc.Model).IsValid() {
+			return nil, fmt.Errorf("%s: invalid model name %q", path, sc.Model)
+		}
+
+		if sc.Load == "" && sc.Unload == "" {
+			return nil, fmt.Errorf("%s: model %q: load or unload is required", path, sc.Model)
+		}
+
+		if sc.Load != "" {
+			if sc.load, err = parseCron(sc.Load); err != nil {
+				return nil, fmt.Errorf("%s: model %q: %w", path, sc.Model, err)
+			}
+		}
+
+		if sc.Unload != "" {
+			if sc.unload, err = parseCron(sc.Unload); err != nil {
+				return nil, fmt.Errorf("%s: model %q: %w", path, sc.Model, err)
+			}
+		}
+
+		if sc.KeepAlive == nil && sc.unload != nil {
+			sc.KeepAlive = &api.Duration{Duration: -1}
+		}
+	}
+
+	return config.Schedules, nil
+}
+
+// runSchedules loads and unloads models as their schedules say until ctx is
+// done. It checks the schedules at the start of every minute.
+func (s *Server) runSchedules(ctx context.Context, schedules []*modelSchedule) {
+	for {
+		next := time.Now().Truncate(time.Minute).Add(time.Minute)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		for _, sc := range schedules {
+			// unloading first lets a schedule reload a model to reset it
+			if sc.unload != nil && sc.unload.matches(next) {
+				go s.runSchedule(ctx, sc, "unload")
+			} else if sc.load != nil && sc.load.matches(next) {
+				go s.runSchedule(ctx, sc, "load")
+			}
+		}
+	}
+}
+
+// runSchedule performs a scheduled action, "load" or "unload", and
+// publishes a schedule event with its outcome.
+func (s *Server) runSchedule(ctx context.Context, sc *modelSchedule, action string) {
+	slog.Info("running model schedule", "model", sc.Model, "action", action)
+
+	e := api.ScheduleEvent{Model: sc.Model, Action: action, Stage: "completed"}
+	if err := s.scheduled(ctx, sc, action, &e); err != nil {
+		slog.Warn("model schedule failed", "model", sc.Model, "action", action, "error", err)
+		e.Stage, e.Error = "failed", err.Error()
+	}
+
+	if s.sched != nil {
+		s.sched.events.publish(api.Event{Type: "schedule", Time: time.Now().UTC(), Schedule: &e})
+	}
+}
+
+func (s *Server) scheduled(ctx context.Context, sc *modelSchedule, action string, e *api.ScheduleEvent) error {
+	n, err := resolveName(model.ParseName(sc.Model))
+	if err != nil {
+		return err
+	}
+
+	m, err := GetModel(n.String())
+	if err != nil {
+		return err
+	}
+
+	// events name models as load events do
+	e.Model = m.ShortName
+
+	if action == "unload" {
+		_, err = s.sched.unloadModel(ctx, m)
+		return err
+	}
+
+	// the runner is held until ctx is done, and only then is kept alive
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	_, _, _, err = s.scheduleRunner(systemContext(ctx), n.String(), []Capability{}, "", nil, sc.KeepAlive)
+	return err
+}
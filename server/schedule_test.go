@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestCron(t *testing.T) {
+	// 2025-03-03 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, time.March, day, hour, minute, 0, 0, time.Local)
+	}
+
+	cases := []struct {
+		expr    string
+		matches []time.Time
+		misses  []time.Time
+	}{
+		{"0 9 * * 1-5", []time.Time{at(3, 9, 0), at(7, 9, 0)}, []time.Time{at(3, 9, 1), at(8, 9, 0), at(9, 9, 0)}},
+		{"*/15 * * * *", []time.Time{at(3, 0, 0), at(3, 13, 45)}, []time.Time{at(3, 13, 46)}},
+		{"30 22 * * 0,6", []time.Time{at(8, 22, 30), at(9, 22, 30)}, []time.Time{at(3, 22, 30)}},
+		{"0 0 * * 7", []time.Time{at(9, 0, 0)}, []time.Time{at(8, 0, 0)}},
+		{"0 12 1 * 1", []time.Time{at(1, 12, 0), at(3, 12, 0)}, []time.Time{at(4, 12, 0)}},
+		{"0 8-18/2 * 3 *", []time.Time{at(4, 8, 0), at(4, 18, 0)}, []time.Time{at(4, 9, 0), at(4, 20, 0)}},
+		{"@daily", []time.Time{at(5, 0, 0)}, []time.Time{at(5, 1, 0)}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, m := range tt.matches {
+				if !c.matches(m) {
+					t.Errorf("expected %s to match", m)
+				}
+			}
+
+			for _, m := range tt.misses {
+				if c.matches(m) {
+					t.Errorf("expected %s not to match", m)
+				}
+			}
+		})
+	}
+
+	for _, expr := range []string{"", "0 9 * *", "60 * * * *", "0 24 * * *", "0 0 0 * *", "0 0 * 13 *", "0 0 * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("expected %q to be invalid", expr)
+		}
+	}
+}
+
+func TestLoadSchedules(t *testing.T) {
+	write := func(s string) string {
+		path := filepath.Join(t.TempDir(), "schedules.json")
+		if err := os.WriteFile(path, []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	schedules, err := loadSchedules(write(`{"schedules": [
+		{"model": "qwen2.5-coder:32b", "load": "0 9 * * 1-5", "unload": "0 19 * * 1-5"},
+		{"model": "llama3.2", "load": "@hourly", "keep_alive": "10m"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(schedules) != 2 {
+		t.Fatalf("expected 2 schedules, got %d", len(schedules))
+	}
+
+	// models with an unload schedule stay loaded until then
+	if d := schedules[0].KeepAlive; d == nil || d.Duration >= 0 {
+		t.Errorf("expected to keep the model loaded, got %v", d)
+	}
+
+	if d := schedules[1].KeepAlive; d == nil || d.Duration != 10*time.Minute {
+		t.Errorf("expected keep alive of 10m, got %v", d)
+	}
+
+	for _, s := range []string{
+		`{"schedules": [{"model": "llama3.2"}]}`,
+		`{"schedules": [{"model": "llama3.2", "load": "at nine"}]}`,
+		`{"schedules": [{"model": "", "load": "@daily"}]}`,
+	} {
+		if _, err := loadSchedules(write(s)); err == nil {
+			t.Errorf("expected %s to be invalid", s)
+		}
+	}
+
+	if schedules, err := loadSchedules(""); err != nil || schedules != nil {
+		t.Errorf("expected no schedules, got %v, %v", schedules, err)
+	}
+}
+
+func TestRunSchedule(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := Server{sched: InitScheduler(ctx)}
+
+	_, digest := createBinFile(t, nil, nil)
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "test",
+		Files:  map[string]string{"test.gguf": digest},
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	events, unsubscribe := s.sched.events.subscribe()
+	defer unsubscribe()
+
+	// unloading a model that isn't loaded does nothing
+	s.runSchedule(ctx, &modelSchedule{Model: "test"}, "unload")
+	s.runSchedule(ctx, &modelSchedule{Model: "missing"}, "load")
+
+	var got []api.ScheduleEvent
+	for len(events) > 0 {
+		e := <-events
+		if e.Type != "schedule" {
+			t.Errorf("expected schedule event, got %q", e.Type)
+		}
+		got = append(got, *e.Schedule)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 events, got %v", got)
+	}
+
+	if diff := cmp.Diff(api.ScheduleEvent{Model: "test:latest", Action: "unload", Stage: "completed"}, got[0]); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if got[1].Model != "missing" || got[1].Stage != "failed" || got[1].Error == "" {
+		t.Errorf("expected failed load, got %+v", got[1])
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// scrubRate is the most bytes per second read when scrubbing, so that it
+// doesn't compete with other use of the disk
+var scrubRate int64 = 64 << 20
+
+// scrubBusyWait is how often a paused scrub checks if the server is idle
+var scrubBusyWait = 5 * time.Second
+
+// scrub re-verifies the digests of all blobs every interval until ctx is
+// done, to catch blobs corrupted on disk before a model fails to load.
+func (s *Server) scrub(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.scrubBlobs(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Warn("failed to scrub blobs", "error", err)
+		}
+	}
+}
+
+// scrubBlobs verifies each blob, publishing a scrub event for each corrupt
+// one and a final one with the totals.
+func (s *Server) scrubBlobs(ctx context.Context) error {
+	dir, err := GetBlobsPath("")
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var verified, corrupt int
+	for _, entry := range entries {
+		// skip partial downloads, which are named after the blob with a suffix
+		sum, ok := strings.CutPrefix(entry.Name(), "sha256-")
+		if !ok || entry.IsDir() || len(sum) != 2*sha256.Size {
+			continue
+		}
+
+		if _, err := hex.DecodeString(sum); err != nil {
+			continue
+		}
+
+		digest := "sha256:" + sum
+		err := s.scrubBlob(ctx, filepath.Join(dir, entry.Name()), digest)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// removed since the directory was read
+			continue
+		case errors.Is(err, errDigestMismatch):
+			corrupt++
+			models := blobModels(digest)
+			slog.Error("corrupt blob", "digest", digest, "models", models, "error", err)
+			s.sched.events.publish(api.Event{Type: "scrub", Time: time.Now().UTC(), Scrub: &api.ScrubEvent{Stage: "corrupt", Digest: digest, Models: models}})
+		case err != nil:
+			return err
+		}
+
+		verified++
+	}
+
+	slog.Info("scrubbed blobs", "verified", verified, "corrupt", corrupt)
+	s.sched.events.publish(api.Event{Type: "scrub", Time: time.Now().UTC(), Scrub: &api.ScrubEvent{Stage: "completed", Verified: verified, Corrupt: corrupt}})
+	return nil
+}
+
+// scrubBlob reads the blob at path at no more than scrubRate, pausing while
+// the scheduler has models loaded, and returns errDigestMismatch if its
+// content doesn't match digest.
+func (s *Server) scrubBlob(ctx context.Context, path, digest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	buf := make([]byte, 1<<20)
+	for {
+		for s.sched.busy() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(scrubBusyWait):
+			}
+		}
+
+		start := time.Now()
+		n, err := f.Read(buf)
+		h.Write(buf[:n])
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if d := time.Duration(int64(n)*int64(time.Second)/scrubRate) - time.Since(start); d > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(d):
+			}
+		}
+	}
+
+	if got := fmt.Sprintf("sha256:%x", h.Sum(nil)); got != digest {
+		return fmt.Errorf("%w: want %s, got %s", errDigestMismatch, digest, got)
+	}
+
+	return nil
+}
+
+// blobModels returns the names of the models that use the blob digest.
+func blobModels(digest string) []string {
+	ms, err := Manifests(true)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for n, m := range ms {
+		if m.Config.Digest == digest || slices.ContainsFunc(m.Layers, func(l Layer) bool { return l.Digest == digest }) {
+			names = append(names, n.DisplayShortest())
+		}
+	}
+
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestScrubBlobs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := Server{sched: InitScheduler(ctx)}
+
+	_, digest := createBinFile(t, nil, nil)
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "test",
+		Files:  map[string]string{"test.gguf": digest},
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	events, unsubscribe := s.sched.events.subscribe()
+	defer unsubscribe()
+
+	scrub := func() []api.ScrubEvent {
+		if err := s.scrubBlobs(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		var scrubs []api.ScrubEvent
+		for len(events) > 0 {
+			scrubs = append(scrubs, *(<-events).Scrub)
+		}
+
+		return scrubs
+	}
+
+	// the model's blob and config are checked but not partial downloads
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(p+"-partial", []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]api.ScrubEvent{{Stage: "completed", Verified: 2}}, scrub()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	f, err := os.OpenFile(p, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.WriteAt([]byte{0xff}, 8); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	want := []api.ScrubEvent{
+		{Stage: "corrupt", Digest: digest, Models: []string{"test:latest"}},
+		{Stage: "completed", Verified: 2, Corrupt: 1},
+	}
+
+	if diff := cmp.Diff(want, scrub()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
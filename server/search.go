@@ -0,0 +1,108 @@
+package server
+
+import (
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/agnivade/levenshtein"
+
+	"github.com/ollama/ollama/api"
+)
+
+// searchTerms splits a query for local models, such as "code 7b q4", into
+// its lowercase terms.
+func searchTerms(q string) []string {
+	return strings.Fields(strings.ToLower(q))
+}
+
+// searchWords splits s into the words terms are fuzzily matched against.
+// Dots are kept so that parameter sizes such as "7.6b" stay one word.
+func searchWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r != '.' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchScore returns how well term matches s: 3 if a word of s starts with
+// it, 2 if s contains it, 1 if a word of s contains its characters in order
+// or is a typo away from it, or 0 if it doesn't match.
+func matchScore(term, s string) int {
+	s = strings.ToLower(s)
+	if i := strings.Index(s, term); i == 0 || i > 0 && !unicode.IsLetter(rune(s[i-1])) && !unicode.IsDigit(rune(s[i-1])) {
+		return 3
+	} else if i > 0 {
+		return 2
+	}
+
+	for _, word := range searchWords(s) {
+		if isSubsequence(term, word) || len(term) >= 4 && levenshtein.ComputeDistance(term, word) <= 1 {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func isSubsequence(sub, s string) bool {
+	for _, r := range s {
+		if len(sub) == 0 {
+			break
+		}
+
+		if strings.HasPrefix(sub, string(r)) {
+			sub = sub[len(string(r)):]
+		}
+	}
+
+	return len(sub) == 0
+}
+
+// searchScore returns how well a model matches every term, or 0 if any term
+// doesn't match it. Matches of its name count the most and those of its
+// system prompt, which only match exactly, the least.
+func searchScore(terms []string, name string, details api.ModelDetails, system string) int {
+	var total int
+	for _, term := range terms {
+		score := 3 * matchScore(term, name)
+		for _, s := range append([]string{details.Family, details.ParameterSize, details.QuantizationLevel, details.Format}, details.Families...) {
+			score = max(score, 2*matchScore(term, s))
+		}
+
+		if score == 0 && strings.Contains(strings.ToLower(system), term) {
+			score = 1
+		}
+
+		if score == 0 {
+			return 0
+		}
+
+		total += score
+	}
+
+	return total
+}
+
+// system returns the system prompt of the model of m, if any.
+func (m *Manifest) system() (string, error) {
+	for _, layer := range m.Layers {
+		if layer.MediaType != "application/vnd.ollama.image.system" {
+			continue
+		}
+
+		f, err := layer.Open()
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+
+		bts, err := io.ReadAll(f)
+		if err != nil {
+			return "", err
+		}
+
+		return string(bts), nil
+	}
+
+	return "", nil
+}
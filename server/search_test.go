@@ -0,0 +1,54 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestMatchScore(t *testing.T) {
+	cases := []struct {
+		term, s string
+		expect  int
+	}{
+		{"q4", "Q4_K_M", 3},
+		{"code", "qwen2.5-coder:7b", 3},
+		{"coder", "deepseek-coder", 3},
+		{"wen", "qwen2.5", 2},
+		{"7b", "7.6B", 1},
+		{"lama", "llama", 2},
+		{"llma", "llama3.2:latest", 1},
+		{"q4", "qwen2.5-coder:14b", 0},
+		{"mistral", "llama3.2", 0},
+	}
+
+	for _, tt := range cases {
+		if got := matchScore(tt.term, tt.s); got != tt.expect {
+			t.Errorf("%q in %q: expected %d, got %d", tt.term, tt.s, tt.expect, got)
+		}
+	}
+}
+
+func TestSearchScore(t *testing.T) {
+	details := api.ModelDetails{Family: "qwen2", ParameterSize: "7.6B", QuantizationLevel: "Q4_K_M"}
+
+	cases := []struct {
+		query  string
+		system string
+		expect int
+	}{
+		{"code 7b q4", "", 3*3 + 3*3 + 2*3},
+		{"7b", "", 3 * 3},
+		{"7.6b", "", 2 * 3},
+		{"qwen2", "", 3 * 3},
+		{"python", "You write Python.", 1},
+		{"code python", "", 0},
+		{"", "", 0},
+	}
+
+	for _, tt := range cases {
+		if got := searchScore(searchTerms(tt.query), "qwen2.5-coder:7b", details, tt.system); got != tt.expect {
+			t.Errorf("%q: expected %d, got %d", tt.query, tt.expect, got)
+		}
+	}
+}
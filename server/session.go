@@ -0,0 +1,139 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+// sessionMetadata is the metadata runners save with the KV cache of a
+// session.
+type sessionMetadata struct {
+	ID     string `json:"id"`
+	Model  string `json:"model"`
+	Tokens []int  `json:"tokens"`
+}
+
+// sessionPath returns the path of the files of a session without their
+// extension, named as runners name them.
+func sessionPath(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(envconfig.Sessions(), hex.EncodeToString(sum[:]))
+}
+
+// sessionModels maps the file names of model blobs, which runners record as
+// the model of a session, to the name of a model using them.
+func sessionModels() map[string]string {
+	names := make(map[string]string)
+
+	ms, err := Manifests(true)
+	if err != nil {
+		slog.Warn("failed to list models for sessions", "error", err)
+		return names
+	}
+
+	for n, m := range ms {
+		for _, layer := range m.Layers {
+			if layer.MediaType != "application/vnd.ollama.image.model" {
+				continue
+			}
+
+			blob := strings.ReplaceAll(layer.Digest, ":", "-")
+			if name, ok := names[blob]; !ok || n.DisplayShortest() < name {
+				names[blob] = n.DisplayShortest()
+			}
+		}
+	}
+
+	return names
+}
+
+// ListSessionsHandler lists the sessions whose KV cache is kept, most
+// recently used first.
+func (s *Server) ListSessionsHandler(c *gin.Context) {
+	entries, err := os.ReadDir(envconfig.Sessions())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	models := sessionModels()
+	sessions := []api.Session{}
+	for _, entry := range entries {
+		path, ok := strings.CutSuffix(filepath.Join(envconfig.Sessions(), entry.Name()), ".json")
+		if !ok {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		bts, err := os.ReadFile(path + ".json")
+		if err != nil {
+			continue
+		}
+
+		var m sessionMetadata
+		if err := json.Unmarshal(bts, &m); err != nil {
+			slog.Warn("invalid session", "path", path, "error", err)
+			continue
+		}
+
+		sess := api.Session{
+			ID:     m.ID,
+			Model:  m.Model,
+			Tokens: len(m.Tokens),
+			UsedAt: info.ModTime().UTC(),
+		}
+
+		if name, ok := models[m.Model]; ok {
+			sess.Model = name
+		}
+
+		if fi, err := os.Stat(path + ".kv"); err == nil {
+			sess.Size = fi.Size()
+		}
+
+		sessions = append(sessions, sess)
+	}
+
+	slices.SortFunc(sessions, func(a, b api.Session) int {
+		return b.UsedAt.Compare(a.UsedAt)
+	})
+
+	c.JSON(http.StatusOK, api.ListSessionsResponse{Sessions: sessions})
+}
+
+// DeleteSessionHandler removes the KV cache kept for a session.
+func (s *Server) DeleteSessionHandler(c *gin.Context) {
+	path := sessionPath(c.Param("id"))
+	if err := os.Remove(path + ".json"); errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("session '%s' not found", c.Param("id"))})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := os.Remove(path + ".kv"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+func TestSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_SESSIONS", t.TempDir())
+
+	var s Server
+
+	_, digest := createBinFile(t, nil, nil)
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "test",
+		Files:  map[string]string{"test.gguf": digest},
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	save := func(id, model string, tokens []int, used time.Time) {
+		t.Helper()
+
+		bts, err := json.Marshal(sessionMetadata{ID: id, Model: model, Tokens: tokens})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := sessionPath(id)
+		if err := os.MkdirAll(envconfig.Sessions(), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path+".kv", make([]byte, 64), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path+".json", bts, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(path+".json", used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func() []api.Session {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+		s.ListSessionsHandler(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		var resp api.ListSessionsResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		return resp.Sessions
+	}
+
+	remove := func(id string) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodDelete, "/api/sessions/"+id, nil)
+		c.Params = gin.Params{{Key: "id", Value: id}}
+		s.DeleteSessionHandler(c)
+		return w.Code
+	}
+
+	if sessions := list(); len(sessions) != 0 {
+		t.Fatalf("expected no sessions, got %v", sessions)
+	}
+
+	now := time.Now()
+	save("older", "sha256-0000", []int{1, 2}, now.Add(-time.Hour))
+	save("newer", "sha256-"+digest[len("sha256:"):], []int{1, 2, 3}, now)
+
+	want := []api.Session{
+		{ID: "newer", Model: "test:latest", Tokens: 3, Size: 64},
+		{ID: "older", Model: "sha256-0000", Tokens: 2, Size: 64},
+	}
+	if diff := cmp.Diff(want, list(), cmpopts.IgnoreFields(api.Session{}, "UsedAt")); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if code := remove("older"); code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", code)
+	}
+
+	if code := remove("older"); code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", code)
+	}
+
+	if sessions := list(); len(sessions) != 1 || sessions[0].ID != "newer" {
+		t.Errorf("expected only the newer session, got %v", sessions)
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ShedError is returned for a request that is shed because the predicted
+// wait for its first token is longer than the model's first_token_slo.
+type ShedError struct {
+	Model         string
+	PredictedWait time.Duration
+	SLO           time.Duration
+
+	// Alternatives are loaded models predicted to respond within the SLO
+	Alternatives []string
+}
+
+func (e *ShedError) Error() string {
+	return fmt.Sprintf("server busy, %s is predicted to wait %s for a first token, longer than its first_token_slo of %s", e.Model, e.PredictedWait.Round(time.Millisecond), e.SLO)
+}
+
+// observe adds the duration of a request that didn't wait for a slot to the
+// moving average of request durations. The refMu must already be held.
+func (runner *runnerRef) observe(d time.Duration) {
+	if runner.requestDuration == 0 {
+		runner.requestDuration = d
+		return
+	}
+
+	runner.requestDuration = (3*runner.requestDuration + d) / 4
+}
+
+// predictedWait estimates how long a new request waits for a slot in the
+// runner: none while a slot is free, otherwise the time for the requests
+// ahead of it to finish, spread over the slots. The refMu must already be
+// held.
+func (runner *runnerRef) predictedWait() time.Duration {
+	ahead := int(runner.refCount) - runner.numParallel + 1
+	if ahead <= 0 {
+		return 0
+	}
+
+	return runner.requestDuration * time.Duration(ahead) / time.Duration(max(runner.numParallel, 1))
+}
+
+// shed returns a [ShedError] if a request for m is predicted to wait longer
+// than slo for its runner. Models that aren't loaded are never shed since
+// there is nothing to predict their wait from.
+func (s *Scheduler) shed(m *Model, slo time.Duration) error {
+	if slo <= 0 {
+		return nil
+	}
+
+	s.loadedMu.Lock()
+	runners := make([]*runnerRef, 0, len(s.loaded))
+	for _, runner := range s.loaded {
+		runners = append(runners, runner)
+	}
+	s.loadedMu.Unlock()
+
+	type alternative struct {
+		name string
+		wait time.Duration
+	}
+
+	var wait time.Duration
+	var alternatives []alternative
+	for _, runner := range runners {
+		// the refMu is held while a runner loads, and a loading runner has
+		// no wait to predict yet
+		if !runner.refMu.TryLock() {
+			continue
+		}
+
+		if runner.model == nil {
+			runner.refMu.Unlock()
+			continue
+		}
+
+		if runner.modelPath == m.ModelPath {
+			wait = runner.predictedWait()
+		} else if w := runner.predictedWait(); w <= slo {
+			alternatives = append(alternatives, alternative{runner.model.ShortName, w})
+		}
+		runner.refMu.Unlock()
+	}
+
+	if wait <= slo {
+		return nil
+	}
+
+	slices.SortFunc(alternatives, func(a, b alternative) int {
+		return cmp.Or(cmp.Compare(a.wait, b.wait), cmp.Compare(a.name, b.name))
+	})
+
+	err := &ShedError{Model: m.ShortName, PredictedWait: wait, SLO: slo}
+	for _, a := range alternatives {
+		err.Alternatives = append(err.Alternatives, a.name)
+	}
+
+	return err
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/runners"
+)
+
+// SystemHandler reports the CPU features and GPUs the server found and the
+// runner builds it loads models with, so that finding out why a model runs
+// on the CPU doesn't take reading the server logs.
+func (s *Server) SystemHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, systemResponse(discover.GetSystemInfo()))
+}
+
+func systemResponse(info discover.SystemInfo) api.SystemResponse {
+	resp := api.SystemResponse{
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+		CPU: api.SystemCPU{
+			Features:    runners.CPUFeatures(),
+			TotalMemory: info.System.TotalMemory,
+			FreeMemory:  info.System.FreeMemory,
+		},
+		GPUs:    []api.SystemGPU{},
+		Runners: slices.Sorted(maps.Keys(runners.GetAvailableServers())),
+	}
+
+	for _, cpu := range info.System.CPUs {
+		if resp.CPU.Name == "" {
+			resp.CPU.Name = strings.TrimSpace(cpu.ModelName)
+		}
+
+		resp.CPU.Cores += cpu.CoreCount
+		resp.CPU.Threads += cpu.ThreadCount
+	}
+
+	var gpus discover.GpuInfoList
+	for _, gpu := range info.GPUs {
+		if gpu.Library != "cpu" {
+			gpus = append(gpus, gpu)
+		}
+	}
+
+	resp.Runner = runnerFor(gpus)
+	for _, group := range gpus.ByLibrary() {
+		runner := runnerFor(group)
+		for _, gpu := range group {
+			g := systemGPU(gpu)
+			g.Runner = runner
+			if slices.Contains(info.LostGPUs, gpu.ID) {
+				g.Unsupported = "stopped responding"
+			}
+
+			resp.Metal = resp.Metal || gpu.Library == "metal"
+			resp.GPUs = append(resp.GPUs, g)
+		}
+	}
+
+	for _, gpu := range info.UnsupportedGPUs {
+		g := systemGPU(gpu.GpuInfo)
+		g.Unsupported = gpu.Reason
+		resp.GPUs = append(resp.GPUs, g)
+	}
+
+	for _, issue := range info.Issues {
+		resp.Issues = append(resp.Issues, issue.Error())
+	}
+
+	return resp
+}
+
+func systemGPU(gpu discover.GpuInfo) api.SystemGPU {
+	g := api.SystemGPU{
+		ID:          gpu.ID,
+		Library:     gpu.Library,
+		Name:        gpu.Name,
+		Compute:     gpu.Compute,
+		TotalMemory: gpu.TotalMemory,
+		FreeMemory:  gpu.FreeMemory,
+	}
+
+	if gpu.DriverMajor > 0 {
+		g.Driver = fmt.Sprintf("%d.%d", gpu.DriverMajor, gpu.DriverMinor)
+	}
+
+	return g
+}
+
+// runnerFor returns the runner build models on gpus are loaded with, or the
+// CPU runner if gpus is empty, the same way the server picks it when it
+// starts a runner.
+func runnerFor(gpus discover.GpuInfoList) string {
+	runner := runners.ServerForCpu()
+	if len(gpus) > 0 {
+		runner = runners.ServersForGpu(gpus[0].RunnerName())[0]
+	}
+
+	if lib := envconfig.LLMLibrary(); lib != "" {
+		if _, ok := runners.GetAvailableServers()[lib]; ok {
+			runner = lib
+		}
+	}
+
+	return runner
+}
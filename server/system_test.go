@@ -0,0 +1,91 @@
+package server
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+)
+
+func TestSystemResponse(t *testing.T) {
+	cuda := discover.GpuInfo{Library: "cuda", Variant: "v12", ID: "GPU-1", Name: "NVIDIA GeForce RTX 4090", Compute: "8.9", DriverMajor: 12, DriverMinor: 4}
+	cuda.TotalMemory, cuda.FreeMemory = 24<<30, 20<<30
+
+	rocm := discover.GpuInfo{Library: "rocm", ID: "0", Name: "AMD Radeon RX 7900 XTX", Compute: "gfx1100"}
+	rocm.TotalMemory, rocm.FreeMemory = 24<<30, 23<<30
+
+	old := discover.GpuInfo{Library: "cuda", ID: "GPU-2", Name: "NVIDIA GeForce GTX 680", Compute: "3.0"}
+
+	var info discover.SystemInfo
+	info.System.TotalMemory, info.System.FreeMemory = 64<<30, 32<<30
+	info.System.CPUs = []discover.CPU{
+		{ModelName: "AMD Ryzen 9 7950X ", CoreCount: 16, ThreadCount: 32},
+		{ModelName: "AMD Ryzen 9 7950X ", CoreCount: 16, ThreadCount: 32},
+	}
+	info.GPUs = []discover.GpuInfo{cuda, rocm}
+	info.UnsupportedGPUs = []discover.UnsupportedGPUInfo{{GpuInfo: old, Reason: "compute capability 3.0 is too old"}}
+	info.Issues = []discover.Issue{{Message: "GPU-2 is too old", Remediation: "upgrade the GPU"}}
+	info.LostGPUs = []string{"0"}
+
+	resp := systemResponse(info)
+	if resp.OS != runtime.GOOS || resp.Arch != runtime.GOARCH {
+		t.Errorf("unexpected platform %s/%s", resp.OS, resp.Arch)
+	}
+
+	if resp.Runner == "" || resp.CPU.Features == nil {
+		t.Errorf("expected a runner and CPU features, got %q, %v", resp.Runner, resp.CPU.Features)
+	}
+
+	if diff := cmp.Diff(api.SystemCPU{Name: "AMD Ryzen 9 7950X", Cores: 32, Threads: 64, TotalMemory: 64 << 30, FreeMemory: 32 << 30}, resp.CPU, cmp.FilterPath(func(p cmp.Path) bool { return p.String() == "Features" }, cmp.Ignore())); diff != "" {
+		t.Errorf("unexpected CPU (-want +got):\n%s", diff)
+	}
+
+	want := []api.SystemGPU{
+		{ID: "GPU-1", Library: "cuda", Name: "NVIDIA GeForce RTX 4090", Compute: "8.9", Driver: "12.4", TotalMemory: 24 << 30, FreeMemory: 20 << 30},
+		{ID: "0", Library: "rocm", Name: "AMD Radeon RX 7900 XTX", Compute: "gfx1100", TotalMemory: 24 << 30, FreeMemory: 23 << 30, Unsupported: "stopped responding"},
+		{ID: "GPU-2", Library: "cuda", Name: "NVIDIA GeForce GTX 680", Compute: "3.0", Unsupported: "compute capability 3.0 is too old"},
+	}
+	if diff := cmp.Diff(want, resp.GPUs, cmp.FilterPath(func(p cmp.Path) bool { return p.Last().String() == ".Runner" }, cmp.Ignore())); diff != "" {
+		t.Errorf("unexpected GPUs (-want +got):\n%s", diff)
+	}
+
+	for _, gpu := range resp.GPUs[:2] {
+		if gpu.Runner == "" {
+			t.Errorf("expected a runner for %s", gpu.ID)
+		}
+	}
+
+	if resp.Metal {
+		t.Error("expected no Metal without a metal GPU")
+	}
+
+	if diff := cmp.Diff([]string{"GPU-2 is too old: upgrade the GPU"}, resp.Issues); diff != "" {
+		t.Errorf("unexpected issues (-want +got):\n%s", diff)
+	}
+
+	t.Run("cpu", func(t *testing.T) {
+		var info discover.SystemInfo
+		info.GPUs = []discover.GpuInfo{{Library: "cpu", ID: "0"}}
+
+		resp := systemResponse(info)
+		if len(resp.GPUs) != 0 {
+			t.Errorf("expected no GPUs, got %v", resp.GPUs)
+		}
+
+		if resp.Runner == "" {
+			t.Error("expected the CPU runner")
+		}
+	})
+
+	t.Run("metal", func(t *testing.T) {
+		var info discover.SystemInfo
+		info.GPUs = []discover.GpuInfo{{Library: "metal", ID: "0"}}
+
+		if resp := systemResponse(info); !resp.Metal {
+			t.Error("expected Metal")
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often the certificate files are checked for
+// changes, at most
+var certCheckInterval = 10 * time.Second
+
+// certReloader loads the certificate of the server and the CAs of client
+// certificates again once their files change, so rotated certificates are
+// used without restarting the server.
+type certReloader struct {
+	certFile, keyFile, caFile string
+
+	mu       sync.Mutex
+	checked  time.Time
+	modTimes []time.Time
+	config   *tls.Config
+}
+
+// newTLSConfig returns the TLS configuration of a server with the
+// certificate and key in certFile and keyFile. If caFile is set, clients
+// must send a certificate signed by one of its CAs.
+func newTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both OLLAMA_TLS_CERT and OLLAMA_TLS_KEY must be set to serve TLS")
+	}
+
+	r := &certReloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.get(), nil
+		},
+	}, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+
+	return files
+}
+
+// load reads the certificate files. The lock must be held, or r not yet
+// shared.
+func (r *certReloader) load() error {
+	var modTimes []time.Time
+	for _, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+
+		modTimes = append(modTimes, fi.ModTime())
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if r.caFile != "" {
+		bts, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bts) {
+			return fmt.Errorf("%s: no certificates found", r.caFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.config = config
+	r.modTimes = modTimes
+	r.checked = time.Now()
+	return nil
+}
+
+// get returns the configuration for a connection, loading the certificate
+// files again if they changed. If they can't be loaded, such as while they
+// are being replaced, the previous ones are used.
+func (r *certReloader) get() *tls.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) < certCheckInterval {
+		return r.config
+	}
+
+	r.checked = time.Now()
+	for i, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err != nil || !fi.ModTime().Equal(r.modTimes[i]) {
+			if err := r.load(); err != nil {
+				slog.Warn("failed to reload TLS certificate", "error", err)
+				return r.config
+			}
+
+			slog.Info("reloaded TLS certificate", "cert", r.certFile)
+			break
+		}
+	}
+
+	return r.config
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCert returns a certificate called name signed by parent, or self
+// signed if parent is nil.
+func newTestCert(t *testing.T, name string, parent *testCert) testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testCert{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// write writes the certificate and key to files in dir named after name.
+func (c testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, c.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func (c testCert) tls(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	dir := t.TempDir()
+	certFile, keyFile := c.write(t, dir, "client")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+// serveTLS serves OK over TLS with config and returns the address.
+func serveTLS(t *testing.T, config *tls.Config) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go srv.Serve(tls.NewListener(ln, config)) //nolint:errcheck
+	t.Cleanup(func() { srv.Close() })
+
+	return ln.Addr().String()
+}
+
+// dialTLS connects to addr trusting ca, with the client certificate cert if
+// it isn't nil, and returns the certificate of the server.
+func dialTLS(addr string, ca testCert, cert *tls.Certificate) (*x509.Certificate, error) {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	config := &tls.Config{RootCAs: pool}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{*cert}
+	}
+
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// client certificates are verified after the handshake completes on
+	// the client, so wait for the server to reject them
+	conn.SetReadDeadline(time.Now().Add(time.Second)) //nolint:errcheck
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		return nil, err
+	}
+
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	certFile, keyFile := newTestCert(t, "server", &ca).write(t, dir, "server")
+
+	if _, err := newTLSConfig(certFile, "", ""); err == nil {
+		t.Error("expected an error without a key")
+	}
+
+	config, err := newTLSConfig(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := serveTLS(t, config)
+	cert, err := dialTLS(addr, ca, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.Subject.CommonName != "server" {
+		t.Errorf("unexpected certificate %s", cert.Subject)
+	}
+
+	t.Run("reload", func(t *testing.T) {
+		defer func(d time.Duration) { certCheckInterval = d }(certCheckInterval)
+		certCheckInterval = 0
+
+		rotated := newTestCert(t, "rotated", &ca)
+		rotated.write(t, dir, "server")
+
+		// file systems may keep modification times in seconds
+		future := time.Now().Add(time.Minute)
+		for _, f := range []string{certFile, keyFile} {
+			if err := os.Chtimes(f, future, future); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		cert, err := dialTLS(addr, ca, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cert.Subject.CommonName != "rotated" {
+			t.Errorf("expected the rotated certificate, got %s", cert.Subject)
+		}
+
+		// a broken certificate leaves the previous one in use
+		if err := os.WriteFile(certFile, []byte("invalid"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(certFile, future.Add(time.Minute), future.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+
+		if cert, err := dialTLS(addr, ca, nil); err != nil || cert.Subject.CommonName != "rotated" {
+			t.Errorf("expected the previous certificate, got %v, %v", cert, err)
+		}
+	})
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	certFile, keyFile := newTestCert(t, "server", &ca).write(t, dir, "server")
+
+	clientCA := newTestCert(t, "client ca", nil)
+	caFile := filepath.Join(dir, "client-ca.crt")
+	if err := os.WriteFile(caFile, clientCA.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := newTLSConfig(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := serveTLS(t, config)
+
+	if _, err := dialTLS(addr, ca, nil); err == nil {
+		t.Error("expected an error without a client certificate")
+	}
+
+	untrusted := newTestCert(t, "untrusted", &ca).tls(t)
+	if _, err := dialTLS(addr, ca, &untrusted); err == nil {
+		t.Error("expected an error with an untrusted client certificate")
+	}
+
+	client := newTestCert(t, "client", &clientCA).tls(t)
+	if _, err := dialTLS(addr, ca, &client); err != nil {
+		t.Errorf("expected the client certificate to be accepted, got %v", err)
+	}
+
+	if err := os.WriteFile(caFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newTLSConfig(certFile, keyFile, caFile); err == nil {
+		t.Error("expected an error without client CAs")
+	}
+}
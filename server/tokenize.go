@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/template"
+	"github.com/ollama/ollama/types/model"
+)
+
+// TokenizeHandler turns text into the tokens of a model. With a template,
+// the text is rendered as generate or chat would render it, without
+// truncating it to the context window, so the count is what the request
+// would take up.
+func (s *Server) TokenizeHandler(c *gin.Context) {
+	var req api.TokenizeRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Prompt != "" && len(req.Messages) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "prompt cannot be combined with messages"})
+		return
+	}
+
+	name, err := resolveName(model.ParseName(req.Model))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+
+	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), []Capability{}, req.Profile, req.Options, req.KeepAlive)
+	if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	prompt := req.Prompt
+	templated := req.Template || len(req.Messages) > 0
+	if templated {
+		if prompt, err = renderPrompt(m, &req); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tokens := []int{}
+	if prompt != "" {
+		if tokens, err = r.Tokenize(c.Request.Context(), prompt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	resp := api.TokenizeResponse{
+		Model:         req.Model,
+		Tokens:        tokens,
+		Count:         len(tokens),
+		ContextLength: opts.NumCtx,
+	}
+
+	if templated {
+		resp.Prompt = prompt
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// renderPrompt renders the prompt or messages of req with the template of m.
+// Images are left out, so they aren't counted.
+func renderPrompt(m *Model, req *api.TokenizeRequest) (string, error) {
+	var msgs []api.Message
+	if len(req.Messages) > 0 {
+		msgs = append(m.Messages, req.Messages...)
+		if req.Messages[0].Role != "system" && m.System != "" {
+			msgs = append([]api.Message{{Role: "system", Content: m.System}}, msgs...)
+		}
+	} else {
+		if m.System != "" {
+			msgs = append(msgs, api.Message{Role: "system", Content: m.System})
+		}
+
+		msgs = append(msgs, m.Messages...)
+		msgs = append(msgs, api.Message{Role: "user", Content: req.Prompt})
+	}
+
+	var b bytes.Buffer
+	if err := m.Template.Execute(&b, template.Values{Messages: msgs, Tools: req.Tools}); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// DetokenizeHandler turns the tokens of a model back into text.
+func (s *Server) DetokenizeHandler(c *gin.Context) {
+	var req api.DetokenizeRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name, err := resolveName(model.ParseName(req.Model))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+
+	r, _, _, err := s.scheduleRunner(c.Request.Context(), name.String(), []Capability{}, req.Profile, req.Options, req.KeepAlive)
+	if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	var text string
+	if len(req.Tokens) > 0 {
+		if text, err = r.Detokenize(c.Request.Context(), req.Tokens); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, api.DetokenizeResponse{Model: req.Model, Text: text})
+}
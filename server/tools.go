@@ -0,0 +1,405 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/template"
+)
+
+const (
+	// maxToolIterations bounds the number of model → tool round trips in a
+	// single chat request
+	maxToolIterations = 8
+
+	toolTimeout       = 30 * time.Second
+	maxToolOutputSize = 1 * format.MebiByte
+)
+
+// toolExecutor runs calls to a single tool on behalf of the model.
+type toolExecutor interface {
+	Tool() api.Tool
+	Execute(ctx context.Context, args api.ToolCallFunctionArguments) (string, error)
+}
+
+type toolRegistry struct {
+	mu    sync.Mutex
+	tools map[string]toolExecutor
+}
+
+func newToolRegistry() *toolRegistry {
+	return &toolRegistry{tools: make(map[string]toolExecutor)}
+}
+
+func (r *toolRegistry) register(t toolExecutor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := t.Tool().Function.Name
+	if name == "" {
+		return errors.New("tool name is required")
+	}
+
+	if _, ok := r.tools[name]; ok {
+		return fmt.Errorf("tool %q is already registered", name)
+	}
+
+	r.tools[name] = t
+	return nil
+}
+
+func (r *toolRegistry) get(name string) (toolExecutor, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// list returns the definitions of all registered tools sorted by name.
+func (r *toolRegistry) list() api.Tools {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var tools api.Tools
+	for _, t := range r.tools {
+		tools = append(tools, t.Tool())
+	}
+
+	slices.SortFunc(tools, func(a, b api.Tool) int {
+		return strings.Compare(a.Function.Name, b.Function.Name)
+	})
+
+	return tools
+}
+
+// execute validates and runs a tool call, returning the content of the tool
+// message to send back to the model. Failures are reported to the model
+// rather than failing the request so it has a chance to recover.
+func (r *toolRegistry) execute(ctx context.Context, call api.ToolCall) string {
+	t, ok := r.get(call.Function.Name)
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %q", call.Function.Name)
+	}
+
+	if err := validateToolArguments(t.Tool().Function, call.Function.Arguments); err != nil {
+		return "error: " + err.Error()
+	}
+
+	args := call.Function.Arguments
+	if args == nil {
+		args = api.ToolCallFunctionArguments{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, toolTimeout)
+	defer cancel()
+
+	out, err := t.Execute(ctx, args)
+	if err != nil {
+		slog.WarnContext(ctx, "tool call failed", "tool", call.Function.Name, "error", err)
+		return "error: " + err.Error()
+	}
+
+	return out
+}
+
+// validateToolArguments checks arguments against the tool's parameter
+// schema: required properties must be present, and properties must match
+// their declared type and enum.
+func validateToolArguments(fn api.ToolFunction, args api.ToolCallFunctionArguments) error {
+	for _, name := range fn.Parameters.Required {
+		if _, ok := args[name]; !ok {
+			return fmt.Errorf("missing required argument %q", name)
+		}
+	}
+
+	for name, v := range args {
+		prop, ok := fn.Parameters.Properties[name]
+		if !ok {
+			return fmt.Errorf("unknown argument %q", name)
+		}
+
+		var valid bool
+		switch v := v.(type) {
+		case string:
+			valid = prop.Type == "string" && (len(prop.Enum) == 0 || slices.Contains(prop.Enum, v))
+		case float64:
+			valid = prop.Type == "number" || prop.Type == "integer" && v == float64(int64(v))
+		case bool:
+			valid = prop.Type == "boolean"
+		case []any:
+			valid = prop.Type == "array"
+		case map[string]any:
+			valid = prop.Type == "object"
+		case nil:
+			valid = prop.Type == "null"
+		}
+
+		if prop.Type != "" && !valid {
+			return fmt.Errorf("argument %q must be of type %s", name, prop.Type)
+		}
+	}
+
+	return nil
+}
+
+// toolConfig is an entry in the tools configuration file. Exactly one of URL
+// or Command must be set.
+type toolConfig struct {
+	api.Tool
+
+	// URL is an HTTP endpoint that receives the call arguments as a JSON
+	// object in a POST request and responds with the result.
+	URL string `json:"url,omitempty"`
+
+	// Command is a local command that receives the call arguments as a JSON
+	// object on stdin and writes the result to stdout.
+	Command []string `json:"command,omitempty"`
+}
+
+// loadTools reads tool definitions from the configuration file at path.
+// Only tools listed in this file can be executed by the server.
+func loadTools(path string) (*toolRegistry, error) {
+	r := newToolRegistry()
+	if path == "" {
+		return r, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var config struct {
+		Tools []toolConfig `json:"tools"`
+	}
+
+	if err := json.NewDecoder(f).Decode(&config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, tc := range config.Tools {
+		tc.Tool.Type = "function"
+
+		var t toolExecutor
+		switch {
+		case tc.URL != "" && len(tc.Command) == 0:
+			t = &httpTool{tool: tc.Tool, url: tc.URL}
+		case len(tc.Command) > 0 && tc.URL == "":
+			t = &commandTool{tool: tc.Tool, command: tc.Command}
+		default:
+			return nil, fmt.Errorf("tool %q: exactly one of url or command is required", tc.Function.Name)
+		}
+
+		if err := r.register(t); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+type httpTool struct {
+	tool api.Tool
+	url  string
+}
+
+func (t *httpTool) Tool() api.Tool { return t.tool }
+
+func (t *httpTool) Execute(ctx context.Context, args api.ToolCallFunctionArguments) (string, error) {
+	bts, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(bts))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxToolOutputSize))
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return string(body), nil
+}
+
+type commandTool struct {
+	tool    api.Tool
+	command []string
+}
+
+func (t *commandTool) Tool() api.Tool { return t.tool }
+
+func (t *commandTool) Execute(ctx context.Context, args api.ToolCallFunctionArguments) (string, error) {
+	bts, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.command[0], t.command[1:]...)
+	cmd.Stdin = bytes.NewReader(bts)
+	cmd.Stdout = &limitedWriter{w: &stdout, n: maxToolOutputSize}
+	cmd.Stderr = &limitedWriter{w: &stderr, n: maxToolOutputSize}
+
+	if err := cmd.Run(); err != nil {
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			return "", fmt.Errorf("%w: %s", err, s)
+		}
+		return "", err
+	}
+
+	return stdout.String(), nil
+}
+
+// limitedWriter discards writes after n bytes.
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+
+	if _, err := l.w.Write(p); err != nil {
+		return 0, err
+	}
+
+	l.n -= int64(len(p))
+	return n, nil
+}
+
+// chatToolLoop runs a non-streaming chat request, executing calls to
+// registered tools on the server and feeding their results back to the model
+// until it replies without calling a tool. Calls to tools the server does not
+// know about are returned to the client as usual.
+func (s *Server) chatToolLoop(c *gin.Context, req api.ChatRequest, r llm.LlamaServer, m *Model, opts *api.Options, msgs []api.Message, meta template.Metadata, checkpointStart, checkpointLoaded time.Time) {
+	ctx := c.Request.Context()
+
+	var metrics api.Metrics
+	var added []api.Message
+	for range maxToolIterations {
+		prompt, images, err := chatPrompt(ctx, m, r.Tokenize, opts, msgs, req.Tools, meta)
+		if err != nil {
+			respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var sb strings.Builder
+		var logprobs []api.Logprob
+		var last llm.CompletionResponse
+		if err := r.Completion(ctx, llm.CompletionRequest{
+			Prompt:      prompt,
+			Images:      images,
+			Format:      req.Format,
+			Options:     opts,
+			Adapter:     req.Adapter,
+			Session:     req.SessionID,
+			CachePrefix: cachePrefix(m.Template, msgs, req.Tools, meta, prompt),
+			Logprobs:    req.Logprobs,
+			TopLogprobs: req.TopLogprobs,
+		}, func(cr llm.CompletionResponse) {
+			sb.WriteString(cr.Content)
+			logprobs = append(logprobs, cr.Logprobs...)
+			last = cr
+		}); err != nil {
+			respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		metrics.PromptEvalCount += last.PromptEvalCount
+		metrics.PromptEvalDuration += last.PromptEvalDuration
+		metrics.PromptCacheCount += last.PromptCacheCount
+		metrics.EvalCount += last.EvalCount
+		metrics.EvalDuration += last.EvalDuration
+
+		reply := api.Message{Role: "assistant", Content: sb.String()}
+		toolCalls, ok := m.parseToolCalls(reply.Content)
+		if ok {
+			reply.Content = ""
+			reply.ToolCalls = toolCalls
+			logprobs = nil
+		}
+		added = append(added, reply)
+
+		if !ok || slices.ContainsFunc(toolCalls, func(tc api.ToolCall) bool {
+			_, ok := s.tools.get(tc.Function.Name)
+			return !ok
+		}) {
+			if req.Conversation != "" {
+				if err := s.conversations.append(req.Conversation, append(req.Messages, added...)...); err != nil {
+					slog.WarnContext(c.Request.Context(), "failed to update conversation", "conversation", req.Conversation, "error", err)
+				}
+			}
+
+			metrics.TotalDuration = time.Since(checkpointStart)
+			metrics.LoadDuration = checkpointLoaded.Sub(checkpointStart)
+			metrics.QueueDuration = metrics.LoadDuration - s.sched.loadDuration(m, checkpointStart, checkpointLoaded)
+			s.metrics.observe(m.ShortName, metrics)
+			s.acl.consume(c.Request.Context(), metrics.PromptEvalCount+metrics.EvalCount)
+			respond(c, http.StatusOK, api.ChatResponse{
+				Model:      req.Model,
+				CreatedAt:  time.Now().UTC(),
+				Message:    reply,
+				Done:       true,
+				DoneReason: last.DoneReason,
+				Logprobs:   logprobs,
+				Degenerate: last.Degenerate,
+				Metrics:    metrics,
+			})
+			return
+		}
+
+		msgs = append(msgs, reply)
+		for _, tc := range toolCalls {
+			slog.DebugContext(c.Request.Context(), "executing tool", "tool", tc.Function.Name)
+			msg := api.Message{Role: "tool", Content: s.tools.execute(ctx, tc)}
+			msgs = append(msgs, msg)
+			added = append(added, msg)
+		}
+	}
+
+	respond(c, http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("model did not finish after %d tool calls", maxToolIterations)})
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+)
+
+type fakeTool struct {
+	tool  api.Tool
+	calls []api.ToolCallFunctionArguments
+}
+
+func (t *fakeTool) Tool() api.Tool { return t.tool }
+
+func (t *fakeTool) Execute(_ context.Context, args api.ToolCallFunctionArguments) (string, error) {
+	t.calls = append(t.calls, args)
+	return "sunny", nil
+}
+
+func mustTool(t *testing.T, s string) api.Tool {
+	t.Helper()
+
+	var tool api.Tool
+	if err := json.Unmarshal([]byte(s), &tool); err != nil {
+		t.Fatal(err)
+	}
+	return tool
+}
+
+const weatherTool = `{
+	"type": "function",
+	"function": {
+		"name": "get_weather",
+		"description": "Get the current weather",
+		"parameters": {
+			"type": "object",
+			"required": ["location"],
+			"properties": {
+				"location": {"type": "string"},
+				"unit": {"type": "string", "enum": ["celsius", "fahrenheit"]},
+				"days": {"type": "integer"}
+			}
+		}
+	}
+}`
+
+func TestValidateToolArguments(t *testing.T) {
+	fn := mustTool(t, weatherTool).Function
+
+	cases := []struct {
+		args api.ToolCallFunctionArguments
+		ok   bool
+	}{
+		{api.ToolCallFunctionArguments{"location": "Seattle"}, true},
+		{api.ToolCallFunctionArguments{"location": "Seattle", "unit": "celsius", "days": float64(3)}, true},
+		{api.ToolCallFunctionArguments{}, false},
+		{api.ToolCallFunctionArguments{"location": 1.0}, false},
+		{api.ToolCallFunctionArguments{"location": "Seattle", "unit": "kelvin"}, false},
+		{api.ToolCallFunctionArguments{"location": "Seattle", "days": 1.5}, false},
+		{api.ToolCallFunctionArguments{"location": "Seattle", "extra": true}, false},
+	}
+
+	for _, tt := range cases {
+		if err := validateToolArguments(fn, tt.args); (err == nil) != tt.ok {
+			t.Errorf("validateToolArguments(%v) = %v, want ok %v", tt.args, err, tt.ok)
+		}
+	}
+}
+
+func TestLoadTools(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bts, _ := io.ReadAll(r.Body)
+		w.Write(bts)
+	}))
+	defer srv.Close()
+
+	p := filepath.Join(t.TempDir(), "tools.json")
+	config := `{"tools": [{"function": {"name": "echo"}, "url": "` + srv.URL + `"}]}`
+	if err := os.WriteFile(p, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := loadTools(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tools := r.list()
+	if len(tools) != 1 || tools[0].Function.Name != "echo" || tools[0].Type != "function" {
+		t.Fatalf("unexpected tools %v", tools)
+	}
+
+	out := r.execute(context.Background(), api.ToolCall{Function: api.ToolCallFunction{Name: "echo"}})
+	if out != "{}" {
+		t.Errorf("expected {}, got %q", out)
+	}
+
+	if out := r.execute(context.Background(), api.ToolCall{Function: api.ToolCallFunction{Name: "missing"}}); out != `error: unknown tool "missing"` {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	if err := os.WriteFile(p, []byte(`{"tools": [{"function": {"name": "bad"}}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadTools(p); err == nil {
+		t.Error("expected error for tool without url or command")
+	}
+}
+
+func TestCommandTool(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires cat")
+	}
+
+	tool := &commandTool{tool: api.Tool{Function: api.ToolFunction{Name: "cat"}}, command: []string{"cat"}}
+	out, err := tool.Execute(context.Background(), api.ToolCallFunctionArguments{"a": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != `{"a":"b"}` {
+		t.Errorf("unexpected output %q", out)
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+var errTransferCanceled = errors.New("canceled")
+
+// transfer is an in-flight pull or push.
+type transfer struct {
+	api.Transfer
+	cancel context.CancelCauseFunc
+
+	// layers holds the progress of each layer by digest
+	layers map[string]api.ProgressResponse
+}
+
+// transferStore tracks in-flight pulls and pushes so that they can be
+// listed and canceled.
+type transferStore struct {
+	mu        sync.Mutex
+	transfers map[string]*transfer
+}
+
+func newTransferStore() *transferStore {
+	return &transferStore{transfers: make(map[string]*transfer)}
+}
+
+// start records a transfer of kind "pull" or "push" of the named model and
+// returns a context canceled when the transfer is, a function to report its
+// progress, and a function to call once it's done.
+func (st *transferStore) start(ctx context.Context, kind, name string) (context.Context, func(api.ProgressResponse), func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	if st == nil {
+		return ctx, func(api.ProgressResponse) {}, func() { cancel(nil) }
+	}
+
+	t := &transfer{
+		Transfer: api.Transfer{
+			ID:        uuid.NewString(),
+			Type:      kind,
+			Model:     name,
+			StartedAt: time.Now().UTC(),
+		},
+		cancel: cancel,
+		layers: make(map[string]api.ProgressResponse),
+	}
+
+	st.mu.Lock()
+	st.transfers[t.ID] = t
+	st.mu.Unlock()
+
+	progress := func(r api.ProgressResponse) {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		t.Status = r.Status
+		if r.Digest != "" {
+			t.layers[r.Digest] = r
+		}
+	}
+
+	return ctx, progress, func() {
+		st.mu.Lock()
+		delete(st.transfers, t.ID)
+		st.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// list returns the in-flight transfers, oldest first.
+func (st *transferStore) list() []api.Transfer {
+	transfers := []api.Transfer{}
+	if st == nil {
+		return transfers
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, t := range st.transfers {
+		tt := t.Transfer
+		for _, layer := range t.layers {
+			tt.Completed += layer.Completed
+			tt.Total += layer.Total
+		}
+		transfers = append(transfers, tt)
+	}
+
+	slices.SortFunc(transfers, func(a, b api.Transfer) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+
+	return transfers
+}
+
+// get returns the transfer id, or false if there's no such transfer.
+func (st *transferStore) get(id string) (api.Transfer, bool) {
+	if st == nil {
+		return api.Transfer{}, false
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	t, ok := st.transfers[id]
+	if !ok {
+		return api.Transfer{}, false
+	}
+
+	return t.Transfer, true
+}
+
+// cancel cancels the transfer id, returning false if there's no such
+// transfer.
+func (st *transferStore) cancel(id string) bool {
+	if st == nil {
+		return false
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	t, ok := st.transfers[id]
+	if ok {
+		t.cancel(errTransferCanceled)
+	}
+
+	return ok
+}
+
+// transferError returns the response for the error a transfer ended with,
+// which is reported as such if the transfer was canceled.
+func transferError(ctx context.Context, kind string, err error) gin.H {
+	if errors.Is(context.Cause(ctx), errTransferCanceled) {
+		return gin.H{"error": kind + " canceled"}
+	}
+
+	return gin.H{"error": err.Error()}
+}
+
+func (s *Server) ListTransfersHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, api.ListTransfersResponse{Transfers: s.transfers.list()})
+}
+
+func (s *Server) CancelTransferHandler(c *gin.Context) {
+	t, ok := s.transfers.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "transfer not found"})
+		return
+	}
+
+	// canceling a transfer needs the access starting it did
+	var err error
+	switch t.Type {
+	case "pull":
+		err = s.acl.check(c.Request.Context(), aclPull, model.ParseName(t.Model))
+	default:
+		err = s.acl.checkSource(c.Request.Context(), model.ParseName(t.Model))
+	}
+
+	if err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if !s.transfers.cancel(t.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "transfer not found"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
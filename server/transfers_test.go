@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestTransfers(t *testing.T) {
+	st := newTransferStore()
+
+	pullCtx, progress, donePull := st.start(context.Background(), "pull", "llama3.1:70b")
+	defer donePull()
+
+	progress(api.ProgressResponse{Status: "pulling manifest"})
+	progress(api.ProgressResponse{Status: "pulling aaa", Digest: "sha256:aaa", Total: 100, Completed: 10})
+	progress(api.ProgressResponse{Status: "pulling bbb", Digest: "sha256:bbb", Total: 50, Completed: 5})
+	progress(api.ProgressResponse{Status: "pulling aaa", Digest: "sha256:aaa", Total: 100, Completed: 40})
+
+	_, _, donePush := st.start(context.Background(), "push", "me/test:latest")
+
+	want := []api.Transfer{
+		{Type: "pull", Model: "llama3.1:70b", Status: "pulling aaa", Completed: 45, Total: 150},
+		{Type: "push", Model: "me/test:latest"},
+	}
+
+	transfers := st.list()
+	if diff := cmp.Diff(want, transfers, cmpopts.IgnoreFields(api.Transfer{}, "ID", "StartedAt")); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	donePush()
+	if got := st.list(); len(got) != 1 {
+		t.Fatalf("expected 1 transfer once the push is done, got %d", len(got))
+	}
+
+	if st.cancel("missing") {
+		t.Error("expected cancel of an unknown transfer to fail")
+	}
+
+	if !st.cancel(transfers[0].ID) {
+		t.Fatal("expected cancel to succeed")
+	}
+
+	<-pullCtx.Done()
+	if got := transferError(pullCtx, "pull", pullCtx.Err()); got["error"] != "pull canceled" {
+		t.Errorf("expected pull canceled, got %v", got["error"])
+	}
+
+	// other errors are passed through
+	ctx, _, done := st.start(context.Background(), "pull", "test")
+	defer done()
+
+	if got := transferError(ctx, "pull", errors.New("file does not exist")); got["error"] != "file does not exist" {
+		t.Errorf("expected file does not exist, got %v", got["error"])
+	}
+}
+
+func TestTransfersNil(t *testing.T) {
+	var st *transferStore
+
+	ctx, progress, done := st.start(context.Background(), "pull", "test")
+	progress(api.ProgressResponse{Status: "pulling manifest"})
+
+	if got := st.list(); len(got) != 0 {
+		t.Errorf("expected no transfers, got %v", got)
+	}
+
+	done()
+	if ctx.Err() == nil {
+		t.Error("expected context to be canceled once done")
+	}
+}
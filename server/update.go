@@ -0,0 +1,170 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+// effectiveConfig returns the configuration m runs with when a request
+// doesn't override it.
+func effectiveConfig(m *Model) (*api.EffectiveConfig, error) {
+	opts, err := modelOptions(m, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	keepAlive := api.Duration{Duration: envconfig.KeepAlive()}
+	if m.Config.KeepAlive != nil {
+		keepAlive = *m.Config.KeepAlive
+	}
+
+	numParallel := opts.NumParallel
+	if numParallel <= 0 {
+		numParallel = int(envconfig.NumParallel())
+	}
+
+	return &api.EffectiveConfig{
+		NumCtx:        opts.NumCtx,
+		ContextPolicy: envconfig.ContextPolicy(),
+		KeepAlive:     keepAlive,
+		NumParallel:   numParallel,
+	}, nil
+}
+
+// UpdateModelHandler changes the keep alive, context length and parallelism
+// of a model in place by rewriting its config and parameters, so they can be
+// tuned without creating the model again. A loaded model picks up the
+// changes with its next request.
+func (s *Server) UpdateModelHandler(c *gin.Context) {
+	var req api.UpdateModelRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch {
+	case req.NumCtx != nil && *req.NumCtx <= 0:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "num_ctx must be positive"})
+		return
+	case req.NumParallel != nil && *req.NumParallel < 0:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "num_parallel must not be negative"})
+		return
+	}
+
+	name := model.ParseName(req.Model)
+	if !name.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errModelPathInvalid.Error()})
+		return
+	}
+
+	if name.HasDigest() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errNameDigest.Error()})
+		return
+	}
+
+	name, err := resolveName(name)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.acl.checkReplace(c.Request.Context(), name); err != nil {
+		c.AbortWithStatusJSON(aclStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	m, err := GetModel(name.String())
+	if os.IsNotExist(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if m.Router != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a router has no settings of its own"})
+		return
+	}
+
+	if err := updateModel(name, req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if m, err = GetModel(name.String()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	config, err := effectiveConfig(m)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, config)
+}
+
+// updateModel writes a new manifest for name with the settings of req,
+// replacing its config and parameters layers.
+func updateModel(name model.Name, req api.UpdateModelRequest) error {
+	manifest, err := ParseNamedManifest(name)
+	if err != nil {
+		return err
+	}
+
+	m, err := GetModel(name.String())
+	if err != nil {
+		return err
+	}
+
+	config := m.Config
+	if req.KeepAlive != nil {
+		config.KeepAlive = req.KeepAlive
+	}
+
+	params := make(map[string]any)
+	if req.NumCtx != nil {
+		params["num_ctx"] = *req.NumCtx
+	}
+
+	if req.NumParallel != nil {
+		params["num_parallel"] = *req.NumParallel
+	}
+
+	// setParameters removes the old parameters from the slice it's given,
+	// which must still be in the manifest to be removed once it's replaced
+	layers, err := setParameters(slices.Clone(manifest.Layers), params)
+	if err != nil {
+		return err
+	}
+
+	configLayer, err := createConfigLayer(layers, config)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteManifest(name, *configLayer, layers); err != nil {
+		return err
+	}
+
+	if !envconfig.NoPrune() {
+		return manifest.RemoveLayers()
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestUpdateModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_KEEP_ALIVE", "")
+	t.Setenv("OLLAMA_NUM_PARALLEL", "")
+
+	var s Server
+
+	_, digest := createBinFile(t, nil, nil)
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:      "test",
+		Files:      map[string]string{"test.gguf": digest},
+		Parameters: map[string]any{"temperature": 0.5},
+		Stream:     &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	show := func() *api.EffectiveConfig {
+		t.Helper()
+		w := createRequest(t, s.ShowHandler, api.ShowRequest{Model: "test"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		var resp api.ShowResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		return resp.EffectiveConfig
+	}
+
+	if got := show(); got.KeepAlive.Duration != 5*time.Minute || got.NumCtx != 2048 || got.NumParallel != 0 {
+		t.Fatalf("unexpected defaults %+v", got)
+	}
+
+	numCtx, numParallel := 8192, 2
+	w = createRequest(t, s.UpdateModelHandler, api.UpdateModelRequest{
+		Model:       "test",
+		KeepAlive:   &api.Duration{Duration: time.Hour},
+		NumCtx:      &numCtx,
+		NumParallel: &numParallel,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	want := api.EffectiveConfig{KeepAlive: api.Duration{Duration: time.Hour}, NumCtx: 8192, NumParallel: 2}
+	if got := show(); *got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	// settings not in the request are unchanged, as are the other parameters
+	numCtx = 4096
+	w = createRequest(t, s.UpdateModelHandler, api.UpdateModelRequest{Model: "test", NumCtx: &numCtx})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	want.NumCtx = 4096
+	if got := show(); *got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	m, err := GetModel("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Options["temperature"] != 0.5 {
+		t.Errorf("expected temperature 0.5, got %v", m.Options["temperature"])
+	}
+
+	// the layers replaced are removed, leaving the model, config and params
+	blobs, err := filepath.Glob(filepath.Join(os.Getenv("OLLAMA_MODELS"), "blobs", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blobs) != 3 {
+		t.Errorf("expected 3 blobs, got %d", len(blobs))
+	}
+
+	w = createRequest(t, s.UpdateModelHandler, api.UpdateModelRequest{Model: "missing", NumCtx: &numCtx})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+
+	numCtx = 0
+	w = createRequest(t, s.UpdateModelHandler, api.UpdateModelRequest{Model: "test", NumCtx: &numCtx})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,155 @@
+package template
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// references are the renders of the chat templates the named templates are
+// converted from, by their Jinja implementation, for each conformance case
+//
+//go:embed testdata/*.gotmpl
+var referencesFS embed.FS
+
+// conformanceCases are the message sequences rendered by each template,
+// named by their roles as the references are
+var conformanceCases = map[string][]api.Message{
+	"user": {
+		{Role: "user", Content: "Hello, how are you?"},
+	},
+	"user-assistant-user": {
+		{Role: "user", Content: "Hello, how are you?"},
+		{Role: "assistant", Content: "I'm doing great. How can I help you today?"},
+		{Role: "user", Content: "I'd like to show off how chat templating works!"},
+	},
+	"system-user-assistant-user": {
+		{Role: "system", Content: "You are a helpful assistant."},
+		{Role: "user", Content: "Hello, how are you?"},
+		{Role: "assistant", Content: "I'm doing great. How can I help you today?"},
+		{Role: "user", Content: "I'd like to show off how chat templating works!"},
+	},
+}
+
+// Conformance is the result of comparing the render of a named template
+// against its reference for a message sequence.
+type Conformance struct {
+	Template string
+	Case     string
+
+	// Mismatch is the first difference from the reference, or nil if the
+	// render matches it
+	Mismatch *Mismatch
+}
+
+// Mismatch is a difference between a render and its reference.
+type Mismatch struct {
+	// Index is the index of the first token that differs
+	Index int
+
+	// Kind is "whitespace", "special" for control tokens such as BOS and
+	// EOS, or "text"
+	Kind string
+
+	Got, Want string
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s mismatch at token %d: got %q, want %q", m.Kind, m.Index, m.Got, m.Want)
+}
+
+// CheckConformance renders each named template for each conformance case
+// and compares it token by token against the reference render.
+func CheckConformance() ([]Conformance, error) {
+	matches, err := fs.Glob(templatesFS, "*.gotmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Conformance
+	for _, match := range matches {
+		bts, err := templatesFS.ReadFile(match)
+		if err != nil {
+			return nil, err
+		}
+
+		tmpl, err := Parse(string(bytes.ReplaceAll(bts, []byte("\r\n"), []byte("\n"))))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", match, err)
+		}
+
+		for _, name := range []string{"user", "user-assistant-user", "system-user-assistant-user"} {
+			want, err := referencesFS.ReadFile(path.Join("testdata", match, name))
+			if err != nil {
+				return nil, err
+			}
+
+			var b bytes.Buffer
+			if err := tmpl.Execute(&b, Values{Messages: conformanceCases[name]}); err != nil {
+				return nil, fmt.Errorf("%s: %w", match, err)
+			}
+
+			results = append(results, Conformance{
+				Template: strings.TrimSuffix(match, ".gotmpl"),
+				Case:     name,
+				Mismatch: compareRender(b.String(), string(want)),
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// renderToken splits a render into control tokens, runs of whitespace and
+// runs of other text, which is enough to tell where and how a render drifts
+// without the model's tokenizer
+var renderToken = regexp.MustCompile(`<\|[^<>|]*\|>|</?[a-zA-Z_]+>|<<\/?SYS>>|\[/?INST\]|\s+|[^\s<\[]+|[<\[]`)
+
+func isSpecial(token string) bool {
+	return len(token) > 2 && (strings.HasPrefix(token, "<") && strings.HasSuffix(token, ">") || strings.HasPrefix(token, "[") && strings.HasSuffix(token, "]"))
+}
+
+// compareRender returns the first difference between got and want, or nil if
+// they're the same. A single space ending got is ignored since the
+// references don't keep the space some templates end the generation prompt
+// with.
+func compareRender(got, want string) *Mismatch {
+	got = strings.TrimSuffix(got, " ")
+	want = strings.TrimSuffix(want, " ")
+
+	gotTokens := renderToken.FindAllString(got, -1)
+	wantTokens := renderToken.FindAllString(want, -1)
+
+	for i := range max(len(gotTokens), len(wantTokens)) {
+		var g, w string
+		if i < len(gotTokens) {
+			g = gotTokens[i]
+		}
+
+		if i < len(wantTokens) {
+			w = wantTokens[i]
+		}
+
+		if g == w {
+			continue
+		}
+
+		kind := "text"
+		switch {
+		case isSpecial(g) || isSpecial(w):
+			kind = "special"
+		case strings.TrimSpace(g) == "" || strings.TrimSpace(w) == "":
+			kind = "whitespace"
+		}
+
+		return &Mismatch{Index: i, Kind: kind, Got: g, Want: w}
+	}
+
+	return nil
+}
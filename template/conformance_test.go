@@ -0,0 +1,75 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckConformance(t *testing.T) {
+	results, err := CheckConformance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) == 0 {
+		t.Fatal("expected conformance results")
+	}
+
+	for _, r := range results {
+		if r.Mismatch != nil {
+			t.Errorf("%s %s: %s", r.Template, r.Case, r.Mismatch)
+		}
+	}
+}
+
+func TestCompareRender(t *testing.T) {
+	cases := []struct {
+		name      string
+		got, want string
+		expect    *Mismatch
+	}{
+		{
+			name: "same",
+			got:  "<s>[INST] Hello [/INST]",
+			want: "<s>[INST] Hello [/INST]",
+		},
+		{
+			name: "trailing space",
+			got:  "USER: Hello ASSISTANT: ",
+			want: "USER: Hello ASSISTANT:",
+		},
+		{
+			name:   "missing bos",
+			got:    "[INST] Hello [/INST]",
+			want:   "<s>[INST] Hello [/INST]",
+			expect: &Mismatch{Index: 0, Kind: "special", Got: "[INST]", Want: "<s>"},
+		},
+		{
+			name:   "missing eos",
+			got:    "<|user|>\nHello",
+			want:   "<|user|>\nHello</s>",
+			expect: &Mismatch{Index: 3, Kind: "special", Got: "", Want: "</s>"},
+		},
+		{
+			name:   "newlines",
+			got:    "<|im_start|>user\nHello<|im_end|>\n",
+			want:   "<|im_start|>user\n\nHello<|im_end|>\n",
+			expect: &Mismatch{Index: 2, Kind: "whitespace", Got: "\n", Want: "\n\n"},
+		},
+		{
+			name:   "text",
+			got:    "### Instruction: Hello",
+			want:   "### Input: Hello",
+			expect: &Mismatch{Index: 2, Kind: "text", Got: "Instruction:", Want: "Input:"},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.expect, compareRender(tt.got, tt.want)); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"sync"
 	"text/template"
 	"text/template/parse"
+	"time"
 
 	"github.com/agnivade/levenshtein"
 	"golang.org/x/exp/maps"
@@ -167,11 +168,65 @@ type Values struct {
 	api.Tools
 	Prompt string
 	Suffix string
+	Metadata
 
 	// forceLegacy is a flag used to test compatibility with legacy templates
 	forceLegacy bool
 }
 
+// Metadata is what templates may use about a request besides its messages,
+// as {{ .Now }}, {{ .Model }} and {{ .Variables }}.
+type Metadata struct {
+	// Now is when the request was received, to the minute so that prompts
+	// using it stay the same for a while and can be cached.
+	Now time.Time
+
+	// Model is the name of the model.
+	Model string
+
+	// Variables are the variables set by the request.
+	Variables map[string]string
+}
+
+// NewMetadata returns the metadata of a request for model received now.
+func NewMetadata(model string, variables map[string]string) Metadata {
+	return Metadata{
+		Now:       time.Now().Truncate(time.Minute).Round(0),
+		Model:     model,
+		Variables: variables,
+	}
+}
+
+// with adds the metadata to the data of a template.
+func (m Metadata) with(data map[string]any) map[string]any {
+	data["Now"] = m.Now
+	data["Model"] = m.Model
+	data["Variables"] = m.Variables
+	return data
+}
+
+// Expand renders s, such as the system prompt of a model saying "Today is
+// {{ .Now.Format "January 2, 2006" }}", with the metadata. s is returned as
+// is unless it is a template using only the metadata, so that prompts which
+// happen to contain "{{" keep working.
+func Expand(s string, m Metadata) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+
+	tmpl, err := template.New("").Option("missingkey=zero").Funcs(funcs).Parse(s)
+	if err != nil {
+		return s
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, m); err != nil {
+		return s
+	}
+
+	return b.String()
+}
+
 func (t *Template) Subtree(fn func(parse.Node) bool) *template.Template {
 	var walk func(parse.Node) parse.Node
 	walk = func(n parse.Node) parse.Node {
@@ -221,18 +276,18 @@ func (t *Template) Subtree(fn func(parse.Node) bool) *template.Template {
 func (t *Template) Execute(w io.Writer, v Values) error {
 	system, messages := collate(v.Messages)
 	if v.Prompt != "" && v.Suffix != "" {
-		return t.Template.Execute(w, map[string]any{
+		return t.Template.Execute(w, v.with(map[string]any{
 			"Prompt":   v.Prompt,
 			"Suffix":   v.Suffix,
 			"Response": "",
-		})
+		}))
 	} else if !v.forceLegacy && slices.Contains(t.Vars(), "messages") {
-		return t.Template.Execute(w, map[string]any{
+		return t.Template.Execute(w, v.with(map[string]any{
 			"System":   system,
 			"Messages": messages,
 			"Tools":    v.Tools,
 			"Response": "",
-		})
+		}))
 	}
 
 	system = ""
@@ -240,11 +295,11 @@ func (t *Template) Execute(w io.Writer, v Values) error {
 	var prompt, response string
 	for _, m := range messages {
 		execute := func() error {
-			if err := t.Template.Execute(&b, map[string]any{
+			if err := t.Template.Execute(&b, v.with(map[string]any{
 				"System":   system,
 				"Prompt":   prompt,
 				"Response": response,
-			}); err != nil {
+			})); err != nil {
 				return err
 			}
 
@@ -285,11 +340,11 @@ func (t *Template) Execute(w io.Writer, v Values) error {
 	})
 
 	tree := parse.Tree{Root: nodes.(*parse.ListNode)}
-	if err := template.Must(template.New("").AddParseTree("", &tree)).Execute(&b, map[string]any{
+	if err := template.Must(template.New("").Option("missingkey=zero").Funcs(funcs).AddParseTree("", &tree)).Execute(&b, v.with(map[string]any{
 		"System":   system,
 		"Prompt":   prompt,
 		"Response": response,
-	}); err != nil {
+	})); err != nil {
 		return err
 	}
 
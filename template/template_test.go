@@ -10,6 +10,7 @@ import (
 	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
@@ -376,3 +377,81 @@ func TestExecuteWithSuffix(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuteWithMetadata(t *testing.T) {
+	meta := Metadata{
+		Now:       time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC),
+		Model:     "llama3.2:latest",
+		Variables: map[string]string{"user": "Alice"},
+	}
+
+	cases := []struct {
+		name     string
+		template string
+		values   Values
+		expect   string
+	}{
+		{
+			"messages",
+			`{{ .Now.Format "2006-01-02" }} {{ .Model }} {{ range .Messages }}{{ $.Variables.user }}: {{ .Content }}{{ end }}`,
+			Values{Messages: []api.Message{{Role: "user", Content: "hello"}}, Metadata: meta},
+			"2024-03-01 llama3.2:latest Alice: hello",
+		},
+		{
+			"legacy",
+			`{{ .Variables.user }}: {{ .Prompt }} {{ .Variables.missing }}`,
+			Values{Messages: []api.Message{{Role: "user", Content: "hello"}}, Metadata: meta},
+			"Alice: hello ",
+		},
+		{
+			"without metadata",
+			`{{ .Model }}{{ .Variables.user }}{{ .Prompt }}`,
+			Values{Messages: []api.Message{{Role: "user", Content: "hello"}}},
+			"hello",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var b bytes.Buffer
+			if err := tmpl.Execute(&b, tt.values); err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(b.String(), tt.expect); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	meta := Metadata{
+		Now:       time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC),
+		Model:     "llama3.2:latest",
+		Variables: map[string]string{"user": "Alice"},
+	}
+
+	cases := []struct {
+		system string
+		expect string
+	}{
+		{"You are a helpful assistant.", "You are a helpful assistant."},
+		{`Today is {{ .Now.Format "January 2, 2006" }}.`, "Today is March 1, 2024."},
+		{"You are {{ .Model }}, talking to {{ .Variables.user }}{{ .Variables.missing }}.", "You are llama3.2:latest, talking to Alice."},
+		// prompts that aren't templates of the metadata are kept as they are
+		{"Reply with {{ a template.", "Reply with {{ a template."},
+		{"Reply with {{ .Name }}.", "Reply with {{ .Name }}."},
+	}
+
+	for _, tt := range cases {
+		if got := Expand(tt.system, meta); got != tt.expect {
+			t.Errorf("%q: expected %q, got %q", tt.system, tt.expect, got)
+		}
+	}
+}
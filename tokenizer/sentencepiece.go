@@ -0,0 +1,222 @@
+package tokenizer
+
+import (
+	"container/heap"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ollama/ollama/convert/sentencepiece"
+)
+
+// SentencePiece is a tokenizer for SentencePiece unigram and BPE models. It
+// encodes text the way llama.cpp does: by repeatedly merging the adjacent
+// pair of pieces with the highest score.
+type SentencePiece struct {
+	pieces []string
+	scores []float32
+	types  []sentencepiece.ModelProto_SentencePiece_Type
+	ids    map[string]int
+
+	specials []string
+	bytes    [256]int
+	unk      int
+
+	addBOS bool
+	bos    int
+
+	addDummyPrefix bool
+}
+
+func newSentencePiece(m *sentencepiece.ModelProto, vocab Vocabulary) *SentencePiece {
+	spm := &SentencePiece{
+		ids:            make(map[string]int),
+		unk:            int(m.GetTrainerSpec().GetUnkId()),
+		addBOS:         true,
+		bos:            int(m.GetTrainerSpec().GetBosId()),
+		addDummyPrefix: m.GetNormalizerSpec() == nil || m.GetNormalizerSpec().GetAddDummyPrefix(),
+	}
+
+	for i := range spm.bytes {
+		spm.bytes[i] = -1
+	}
+
+	for i, p := range m.GetPieces() {
+		spm.pieces = append(spm.pieces, p.GetPiece())
+		spm.scores = append(spm.scores, p.GetScore())
+		spm.types = append(spm.types, p.GetType())
+		spm.ids[p.GetPiece()] = i
+
+		switch p.GetType() {
+		case sentencepiece.ModelProto_SentencePiece_CONTROL,
+			sentencepiece.ModelProto_SentencePiece_USER_DEFINED:
+			spm.specials = append(spm.specials, p.GetPiece())
+		case sentencepiece.ModelProto_SentencePiece_BYTE:
+			if b, ok := parseByte(p.GetPiece()); ok {
+				spm.bytes[b] = i
+			}
+		}
+	}
+
+	sortSpecials(spm.specials)
+
+	if vocab != nil {
+		spm.addBOS = vocab.AddBOSToken()
+		spm.bos = vocab.TokenBOS()
+	}
+
+	return spm
+}
+
+// parseByte parses a byte piece such as <0x0A>.
+func parseByte(piece string) (byte, bool) {
+	if len(piece) != 6 || !strings.HasPrefix(piece, "<0x") || piece[5] != '>' {
+		return 0, false
+	}
+
+	b, err := strconv.ParseUint(piece[3:5], 16, 8)
+	return byte(b), err == nil
+}
+
+func (spm *SentencePiece) Encode(s string, addSpecial bool) ([]int, error) {
+	var ids []int
+	if addSpecial && spm.addBOS && spm.bos >= 0 {
+		ids = append(ids, spm.bos)
+	}
+
+	for i, f := range splitSpecial(s, spm.specials, spm.ids) {
+		if f.id >= 0 {
+			ids = append(ids, f.id)
+			continue
+		}
+
+		text := strings.ReplaceAll(f.text, " ", "▁")
+		if i == 0 && spm.addDummyPrefix {
+			text = "▁" + text
+		}
+
+		ids = append(ids, spm.encode(text)...)
+	}
+
+	return ids, nil
+}
+
+type spmSymbol struct {
+	text       string
+	prev, next int
+}
+
+type spmBigram struct {
+	left, right int
+	score       float32
+	size        int
+}
+
+type spmQueue []spmBigram
+
+func (q spmQueue) Len() int { return len(q) }
+
+func (q spmQueue) Less(i, j int) bool {
+	if q[i].score != q[j].score {
+		return q[i].score > q[j].score
+	}
+	return q[i].left < q[j].left
+}
+
+func (q spmQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *spmQueue) Push(x any)   { *q = append(*q, x.(spmBigram)) }
+
+func (q *spmQueue) Pop() any {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+// encode tokenizes normalized text without special tokens.
+func (spm *SentencePiece) encode(text string) []int {
+	var symbols []spmSymbol
+	for i, r := range []rune(text) {
+		symbols = append(symbols, spmSymbol{text: string(r), prev: i - 1, next: i + 1})
+	}
+
+	if len(symbols) == 0 {
+		return nil
+	}
+	symbols[len(symbols)-1].next = -1
+
+	var q spmQueue
+	tryAdd := func(left, right int) {
+		if left < 0 || right < 0 {
+			return
+		}
+
+		text := symbols[left].text + symbols[right].text
+		if id, ok := spm.ids[text]; ok && spm.types[id] != sentencepiece.ModelProto_SentencePiece_UNUSED {
+			heap.Push(&q, spmBigram{left: left, right: right, score: spm.scores[id], size: len(text)})
+		}
+	}
+
+	for i := 1; i < len(symbols); i++ {
+		tryAdd(i-1, i)
+	}
+
+	for q.Len() > 0 {
+		b := heap.Pop(&q).(spmBigram)
+		left, right := &symbols[b.left], &symbols[b.right]
+
+		// skip bigrams invalidated by earlier merges
+		if left.text == "" || right.text == "" || len(left.text)+len(right.text) != b.size {
+			continue
+		}
+
+		left.text += right.text
+		right.text = ""
+		left.next = right.next
+		if right.next >= 0 {
+			symbols[right.next].prev = b.left
+		}
+
+		tryAdd(left.prev, b.left)
+		tryAdd(b.left, left.next)
+	}
+
+	var ids []int
+	for i := 0; i >= 0; i = symbols[i].next {
+		if id, ok := spm.ids[symbols[i].text]; ok {
+			ids = append(ids, id)
+			continue
+		}
+
+		// fall back to byte pieces for text not in the vocabulary
+		for _, b := range []byte(symbols[i].text) {
+			if id := spm.bytes[b]; id >= 0 {
+				ids = append(ids, id)
+			} else if spm.unk >= 0 {
+				ids = append(ids, spm.unk)
+			}
+		}
+	}
+
+	return ids
+}
+
+func (spm *SentencePiece) Decode(ids []int) (string, error) {
+	var sb strings.Builder
+	for _, id := range ids {
+		if id < 0 || id >= len(spm.pieces) {
+			return "", fmt.Errorf("tokenizer: invalid token %d", id)
+		}
+
+		if spm.types[id] == sentencepiece.ModelProto_SentencePiece_BYTE {
+			if b, ok := parseByte(spm.pieces[id]); ok {
+				sb.WriteByte(b)
+				continue
+			}
+		}
+
+		sb.WriteString(strings.ReplaceAll(spm.pieces[id], "▁", " "))
+	}
+
+	return sb.String(), nil
+}
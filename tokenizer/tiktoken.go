@@ -0,0 +1,231 @@
+package tokenizer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Tiktoken is a byte-level BPE tokenizer defined by a tiktoken file, which
+// lists each token as base64 encoded bytes followed by its rank. The rank
+// of a token is its id. Text is split the way cl100k_base splits it before
+// merging.
+type Tiktoken struct {
+	ranks  map[string]int
+	tokens map[int]string
+
+	specials []string
+	special  map[string]int
+
+	addBOS bool
+	bos    int
+}
+
+func parseTiktoken(bts []byte, vocab Vocabulary) (*Tiktoken, error) {
+	t := &Tiktoken{
+		ranks:   make(map[string]int),
+		tokens:  make(map[int]string),
+		special: make(map[string]int),
+		bos:     -1,
+	}
+
+	if err := lines(bts, func(line []byte) error {
+		token, rank, _ := bytes.Cut(line, []byte(" "))
+		b, err := base64.StdEncoding.DecodeString(string(token))
+		if err != nil {
+			return fmt.Errorf("tokenizer: invalid token %q: %w", token, err)
+		}
+
+		n, err := strconv.Atoi(string(rank))
+		if err != nil {
+			return fmt.Errorf("tokenizer: invalid rank %q: %w", rank, err)
+		}
+
+		t.ranks[string(b)] = n
+		t.tokens[n] = string(b)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if vocab != nil {
+		// special tokens follow the ranked tokens in the model's vocabulary
+		for id := len(t.ranks); id < vocab.NumVocab(); id++ {
+			if piece := vocab.TokenToPiece(id); piece != "" {
+				t.special[piece] = id
+				t.tokens[id] = piece
+				t.specials = append(t.specials, piece)
+			}
+		}
+
+		t.addBOS = vocab.AddBOSToken()
+		t.bos = vocab.TokenBOS()
+	}
+
+	sortSpecials(t.specials)
+	return t, nil
+}
+
+func (t *Tiktoken) Encode(s string, addSpecial bool) ([]int, error) {
+	var ids []int
+	if addSpecial && t.addBOS && t.bos >= 0 {
+		ids = append(ids, t.bos)
+	}
+
+	for _, f := range splitSpecial(s, t.specials, t.special) {
+		if f.id >= 0 {
+			ids = append(ids, f.id)
+			continue
+		}
+
+		for _, piece := range splitWords(f.text) {
+			if id, ok := t.ranks[piece]; ok {
+				ids = append(ids, id)
+				continue
+			}
+
+			merged, err := t.merge(piece)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, merged...)
+		}
+	}
+
+	return ids, nil
+}
+
+// merge encodes piece by repeatedly merging the adjacent pair of parts
+// with the lowest rank, starting from single bytes.
+func (t *Tiktoken) merge(piece string) ([]int, error) {
+	parts := make([]string, len(piece))
+	for i := range piece {
+		parts[i] = piece[i : i+1]
+	}
+
+	for len(parts) > 1 {
+		best, rank := -1, 0
+		for i := range len(parts) - 1 {
+			if r, ok := t.ranks[parts[i]+parts[i+1]]; ok && (best < 0 || r < rank) {
+				best, rank = i, r
+			}
+		}
+
+		if best < 0 {
+			break
+		}
+
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+
+	ids := make([]int, len(parts))
+	for i, part := range parts {
+		id, ok := t.ranks[part]
+		if !ok {
+			return nil, fmt.Errorf("tokenizer: no token for %q", part)
+		}
+		ids[i] = id
+	}
+
+	return ids, nil
+}
+
+func (t *Tiktoken) Decode(ids []int) (string, error) {
+	var sb strings.Builder
+	for _, id := range ids {
+		token, ok := t.tokens[id]
+		if !ok {
+			return "", fmt.Errorf("tokenizer: invalid token %d", id)
+		}
+		sb.WriteString(token)
+	}
+
+	return sb.String(), nil
+}
+
+// splitWords splits s like the cl100k_base pattern:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// The lookahead is not supported by the regexp package so the pattern is
+// matched by hand.
+func splitWords(s string) []string {
+	rs := []rune(s)
+	isNewline := func(r rune) bool { return r == '\r' || r == '\n' }
+	isOther := func(r rune) bool { return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r) }
+	run := func(i int, fn func(rune) bool) int {
+		for i < len(rs) && fn(rs[i]) {
+			i++
+		}
+		return i
+	}
+
+	var words []string
+	for i := 0; i < len(rs); {
+		end := i + 1
+		switch r := rs[i]; {
+		case r == '\'' && contraction(rs[i+1:]) > 0:
+			end = i + 1 + contraction(rs[i+1:])
+		case unicode.IsLetter(r):
+			end = run(i, unicode.IsLetter)
+		case !isNewline(r) && !unicode.IsNumber(r) && i+1 < len(rs) && unicode.IsLetter(rs[i+1]):
+			end = run(i+1, unicode.IsLetter)
+		case unicode.IsNumber(r):
+			end = min(run(i, unicode.IsNumber), i+3)
+		case isOther(r) || r == ' ' && i+1 < len(rs) && isOther(rs[i+1]):
+			j := i
+			if r == ' ' {
+				j++
+			}
+			end = run(run(j, isOther), isNewline)
+		default:
+			// whitespace
+			ws := run(i, unicode.IsSpace)
+			last := -1
+			for j := i; j < ws; j++ {
+				if isNewline(rs[j]) {
+					last = j
+				}
+			}
+
+			switch {
+			case last >= 0:
+				end = last + 1
+			case ws < len(rs) && ws-i > 1:
+				// leave the last space to prefix the next word
+				end = ws - 1
+			default:
+				end = ws
+			}
+		}
+
+		words = append(words, string(rs[i:end]))
+		i = end
+	}
+
+	return words
+}
+
+// contraction returns the length of the contraction suffix at the start of
+// rs, or 0 if there is none.
+func contraction(rs []rune) int {
+	if len(rs) >= 2 {
+		switch strings.ToLower(string(rs[:2])) {
+		case "re", "ve", "ll":
+			return 2
+		}
+	}
+
+	if len(rs) >= 1 {
+		switch unicode.ToLower(rs[0]) {
+		case 's', 't', 'm', 'd':
+			return 1
+		}
+	}
+
+	return 0
+}
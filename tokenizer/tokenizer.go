@@ -0,0 +1,155 @@
+// Package tokenizer implements tokenizers loaded from external definitions.
+//
+// They are used in place of the tokenizer described by a model's GGUF
+// metadata when that metadata is incomplete, which can happen for models
+// converted by other tools.
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ollama/ollama/convert/sentencepiece"
+)
+
+// ErrUnknownFormat is returned for tokenizer definitions in an unsupported
+// format.
+var ErrUnknownFormat = errors.New("tokenizer: unknown format")
+
+// Tokenizer converts between text and token ids.
+type Tokenizer interface {
+	// Encode tokenizes s. Special tokens in s are recognized. If addSpecial
+	// is true, the tokens a model expects at the start of a sequence, such
+	// as BOS, are added.
+	Encode(s string, addSpecial bool) ([]int, error)
+
+	// Decode returns the text of ids. The text may end with an incomplete
+	// UTF-8 sequence if a character spans several tokens.
+	Decode(ids []int) (string, error)
+}
+
+// Vocabulary is the vocabulary of a loaded model, such as a *llama.Model.
+// It provides what a tokenizer definition may lack: the BOS token and, for
+// tiktoken files, the special tokens.
+type Vocabulary interface {
+	NumVocab() int
+	TokenToPiece(id int) string
+	AddBOSToken() bool
+	TokenBOS() int
+}
+
+// Open loads the tokenizer definition at path. SentencePiece models and
+// tiktoken BPE files are supported. vocab may be nil.
+func Open(path string, vocab Vocabulary) (Tokenizer, error) {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(bts, vocab)
+}
+
+// Parse is like [Open] but reads the tokenizer definition from bts.
+func Parse(bts []byte, vocab Vocabulary) (Tokenizer, error) {
+	if isTiktoken(bts) {
+		return parseTiktoken(bts, vocab)
+	}
+
+	var m sentencepiece.ModelProto
+	if err := proto.Unmarshal(bts, &m); err == nil && len(m.GetPieces()) > 0 {
+		return newSentencePiece(&m, vocab), nil
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+// isTiktoken reports whether bts starts with a line of a tiktoken file: a
+// base64 token and its rank.
+func isTiktoken(bts []byte) bool {
+	line, _, _ := bytes.Cut(bts, []byte("\n"))
+	token, rank, ok := bytes.Cut(bytes.TrimSpace(line), []byte(" "))
+	if !ok || len(token) == 0 || len(rank) == 0 {
+		return false
+	}
+
+	for _, b := range token {
+		if !(b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '+' || b == '/' || b == '=') {
+			return false
+		}
+	}
+
+	for _, b := range rank {
+		if b < '0' || b > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fragment is part of the text to encode: either a special token or text
+// to tokenize.
+type fragment struct {
+	text string
+	id   int
+}
+
+// splitSpecial splits s around occurrences of the special tokens in
+// specials, which must be sorted longest first.
+func splitSpecial(s string, specials []string, ids map[string]int) []fragment {
+	var fragments []fragment
+	for len(s) > 0 {
+		start, special := -1, ""
+		for _, sp := range specials {
+			if i := strings.Index(s, sp); i >= 0 && (start < 0 || i < start) {
+				start, special = i, sp
+			}
+		}
+
+		if start < 0 {
+			fragments = append(fragments, fragment{text: s, id: -1})
+			break
+		}
+
+		if start > 0 {
+			fragments = append(fragments, fragment{text: s[:start], id: -1})
+		}
+
+		fragments = append(fragments, fragment{id: ids[special]})
+		s = s[start+len(special):]
+	}
+
+	return fragments
+}
+
+// sortSpecials sorts special tokens longest first so that a token is
+// preferred over any of its prefixes.
+func sortSpecials(specials []string) {
+	slices.SortFunc(specials, func(a, b string) int {
+		if n := len(b) - len(a); n != 0 {
+			return n
+		}
+		return strings.Compare(a, b)
+	})
+}
+
+// lines calls fn for each non-empty line of bts.
+func lines(bts []byte, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(bytes.NewReader(bts))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return scanner.Err()
+}
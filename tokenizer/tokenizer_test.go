@@ -0,0 +1,187 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ollama/ollama/convert/sentencepiece"
+)
+
+func testSentencePiece(t *testing.T) Tokenizer {
+	t.Helper()
+
+	piece := func(s string, score float32, typ sentencepiece.ModelProto_SentencePiece_Type) *sentencepiece.ModelProto_SentencePiece {
+		return &sentencepiece.ModelProto_SentencePiece{Piece: &s, Score: &score, Type: &typ}
+	}
+
+	m := sentencepiece.ModelProto{
+		Pieces: []*sentencepiece.ModelProto_SentencePiece{
+			piece("<unk>", 0, sentencepiece.ModelProto_SentencePiece_UNKNOWN),
+			piece("<s>", 0, sentencepiece.ModelProto_SentencePiece_CONTROL),
+			piece("</s>", 0, sentencepiece.ModelProto_SentencePiece_CONTROL),
+			piece("<0xC3>", 0, sentencepiece.ModelProto_SentencePiece_BYTE),
+			piece("<0xA9>", 0, sentencepiece.ModelProto_SentencePiece_BYTE),
+			piece("▁", -1, sentencepiece.ModelProto_SentencePiece_NORMAL),
+			piece("h", -1, sentencepiece.ModelProto_SentencePiece_NORMAL),
+			piece("e", -1, sentencepiece.ModelProto_SentencePiece_NORMAL),
+			piece("l", -1, sentencepiece.ModelProto_SentencePiece_NORMAL),
+			piece("o", -1, sentencepiece.ModelProto_SentencePiece_NORMAL),
+			piece("ll", -2, sentencepiece.ModelProto_SentencePiece_NORMAL),
+			piece("he", -3, sentencepiece.ModelProto_SentencePiece_NORMAL),
+			piece("hell", -4, sentencepiece.ModelProto_SentencePiece_NORMAL),
+			piece("hello", -5, sentencepiece.ModelProto_SentencePiece_NORMAL),
+			piece("▁hello", -6, sentencepiece.ModelProto_SentencePiece_NORMAL),
+		},
+	}
+
+	bts, err := proto.Marshal(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := Parse(bts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := tok.(*SentencePiece); !ok {
+		t.Fatalf("expected sentencepiece tokenizer, got %T", tok)
+	}
+
+	return tok
+}
+
+func TestSentencePiece(t *testing.T) {
+	tok := testSentencePiece(t)
+
+	cases := []struct {
+		input      string
+		addSpecial bool
+		want       []int
+	}{
+		{"hello", false, []int{14}},
+		{"hello", true, []int{1, 14}},
+		{"hello hello", false, []int{14, 14}},
+		{"hell", false, []int{5, 12}},
+		{"<s>hello</s>", false, []int{1, 13, 2}},
+		{"é", false, []int{5, 3, 4}},
+		{"x", false, []int{5, 0}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.input, func(t *testing.T) {
+			ids, err := tok.Encode(tt.input, tt.addSpecial)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.want, ids); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	s, err := tok.Decode([]int{14, 5, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s != " hello é" {
+		t.Errorf("unexpected decoded text %q", s)
+	}
+}
+
+type testVocabulary []string
+
+func (v testVocabulary) NumVocab() int              { return len(v) }
+func (v testVocabulary) TokenToPiece(id int) string { return v[id] }
+func (v testVocabulary) AddBOSToken() bool          { return true }
+func (v testVocabulary) TokenBOS() int              { return slices.Index(v, "<|begin_of_text|>") }
+
+func TestTiktoken(t *testing.T) {
+	ranks := []string{"a", "b", "c", " ", "'", "s", "1", "ab", " ab", "abc", "'s", "12", "\n"}
+
+	var sb strings.Builder
+	for i, r := range ranks {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(r)), i)
+	}
+
+	vocab := testVocabulary(append(slices.Clone(ranks), "<|begin_of_text|>", "<|end_of_text|>"))
+	tok, err := Parse([]byte(sb.String()), vocab)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := tok.(*Tiktoken); !ok {
+		t.Fatalf("expected tiktoken tokenizer, got %T", tok)
+	}
+
+	cases := []struct {
+		input      string
+		addSpecial bool
+		want       []int
+	}{
+		{"abc", false, []int{9}},
+		{"abc", true, []int{13, 9}},
+		{"ab ab", false, []int{7, 8}},
+		{"abcab", false, []int{9, 7}},
+		{"a's", false, []int{0, 10}},
+		{"121", false, []int{11, 6}},
+		{"ab<|end_of_text|>", false, []int{7, 14}},
+		{"a\n\nb", false, []int{0, 12, 12, 1}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.input, func(t *testing.T) {
+			ids, err := tok.Encode(tt.input, tt.addSpecial)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.want, ids); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+
+			s, err := tok.Decode(ids)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := tt.input; tt.addSpecial {
+				want = "<|begin_of_text|>" + want
+				if s != want {
+					t.Errorf("expected %q, got %q", want, s)
+				}
+			} else if s != want {
+				t.Errorf("expected %q, got %q", want, s)
+			}
+		})
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	cases := map[string][]string{
+		"Hello world":      {"Hello", " world"},
+		"Hello  world":     {"Hello", " ", " world"},
+		"I'm here":         {"I", "'m", " here"},
+		"12345":            {"123", "45"},
+		"hi!!\n\nthere":    {"hi", "!!\n\n", "there"},
+		"a \n b":           {"a", " \n", " b"},
+		"trailing   ":      {"trailing", "   "},
+		"(x)":              {"(x", ")"},
+		"über 東京":          {"über", " 東京"},
+		"line\r\nnext 1.5": {"line", "\r\n", "next", " ", "1", ".", "5"},
+	}
+
+	for input, want := range cases {
+		if diff := cmp.Diff(want, splitWords(input)); diff != "" {
+			t.Errorf("%q mismatch (-want +got):\n%s", input, diff)
+		}
+	}
+}
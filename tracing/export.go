@@ -0,0 +1,259 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ollama/ollama/version"
+)
+
+// the defaults of the OpenTelemetry batch span processor
+const (
+	maxQueueSize  = 2048
+	maxBatchSize  = 512
+	scheduleDelay = 5 * time.Second
+	exportTimeout = 10 * time.Second
+)
+
+// exporter batches ended spans and exports them to an OTLP collector.
+type exporter struct {
+	url      string
+	headers  map[string]string
+	resource []attribute
+	sampler  sampler
+	client   *http.Client
+
+	spans    chan *Span
+	shutdown chan shutdownRequest
+}
+
+type shutdownRequest struct {
+	ctx context.Context //nolint:containedctx
+	err chan error
+}
+
+func newExporter(url string, headers, resource map[string]string, sampler sampler) *exporter {
+	e := &exporter{
+		url:     url,
+		headers: headers,
+		sampler: sampler,
+		client:  &http.Client{Timeout: exportTimeout},
+		spans:   make(chan *Span, maxQueueSize),
+		// buffered so Shutdown can return as soon as its context is done
+		shutdown: make(chan shutdownRequest, 1),
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(resource)) {
+		e.resource = append(e.resource, newAttribute(Attribute{k, resource[k]}))
+	}
+
+	go e.run()
+	return e
+}
+
+// export queues s for export, dropping it if the queue is full.
+func (e *exporter) export(s *Span) {
+	select {
+	case e.spans <- s:
+	default:
+		slog.Debug("dropped span, export queue is full", "name", s.name)
+	}
+}
+
+func (e *exporter) run() {
+	ticker := time.NewTicker(scheduleDelay)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case s := <-e.spans:
+			batch = append(batch, s)
+			if len(batch) >= maxBatchSize {
+				e.send(context.Background(), batch) //nolint:errcheck
+				batch = nil
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				e.send(context.Background(), batch) //nolint:errcheck
+				batch = nil
+			}
+		case req := <-e.shutdown:
+		drain:
+			for {
+				select {
+				case s := <-e.spans:
+					batch = append(batch, s)
+				default:
+					break drain
+				}
+			}
+
+			if len(batch) == 0 {
+				req.err <- nil
+			} else {
+				req.err <- e.send(req.ctx, batch)
+			}
+			return
+		}
+	}
+}
+
+// shutdownExport exports the queued spans and stops e.
+func (e *exporter) shutdownExport(ctx context.Context) error {
+	req := shutdownRequest{ctx: ctx, err: make(chan error, 1)}
+	e.shutdown <- req
+
+	select {
+	case err := <-req.err:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type attribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func newAttribute(a Attribute) attribute {
+	var v map[string]any
+	switch t := a.Value.(type) {
+	case string:
+		v = map[string]any{"stringValue": t}
+	case int:
+		// 64 bit integers are strings in OTLP JSON
+		v = map[string]any{"intValue": strconv.Itoa(t)}
+	case int64:
+		v = map[string]any{"intValue": strconv.FormatInt(t, 10)}
+	case float64:
+		v = map[string]any{"doubleValue": t}
+	case bool:
+		v = map[string]any{"boolValue": t}
+	default:
+		v = map[string]any{"stringValue": fmt.Sprint(t)}
+	}
+
+	return attribute{Key: a.Key, Value: v}
+}
+
+type status struct {
+	// Code is 2 for errors
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type span struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              Kind        `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []attribute `json:"attributes,omitempty"`
+	Status            status      `json:"status"`
+}
+
+func newSpan(s *Span) span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := span{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+
+	if s.parent != [8]byte{} {
+		out.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+
+	for _, a := range s.attributes {
+		out.Attributes = append(out.Attributes, newAttribute(a))
+	}
+
+	if s.err != nil {
+		out.Status = status{Code: 2, Message: s.err.Error()}
+	}
+
+	return out
+}
+
+// request is an OTLP ExportTraceServiceRequest.
+type request struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource struct {
+		Attributes []attribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type scopeSpans struct {
+	Scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+func (e *exporter) send(ctx context.Context, batch []*Span) error {
+	var ss scopeSpans
+	ss.Scope.Name = "github.com/ollama/ollama"
+	ss.Scope.Version = version.Version
+	for _, s := range batch {
+		ss.Spans = append(ss.Spans, newSpan(s))
+	}
+
+	var rs resourceSpans
+	rs.Resource.Attributes = e.resource
+	rs.ScopeSpans = []scopeSpans{ss}
+
+	bts, err := json.Marshal(request{ResourceSpans: []resourceSpans{rs}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(bts))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		slog.Warn("failed to export spans", "endpoint", e.url, "spans", len(batch), "error", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+		slog.Warn("failed to export spans", "endpoint", e.url, "spans", len(batch), "error", err)
+		return err
+	}
+
+	return nil
+}
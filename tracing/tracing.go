@@ -0,0 +1,450 @@
+// Package tracing records OpenTelemetry traces of requests through the
+// server, the scheduler and the runners, so the latency of a request can be
+// attributed to waiting in the queue, loading the model, evaluating the
+// prompt and generating tokens.
+//
+// Traces are exported with OTLP over HTTP, encoded as JSON, and configured
+// with the standard OTEL_* environment variables:
+//
+//   - OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT: the
+//     collector to export to. Tracing is disabled unless one of them is set
+//     or OTEL_TRACES_EXPORTER is otlp.
+//   - OTEL_EXPORTER_OTLP_HEADERS or OTEL_EXPORTER_OTLP_TRACES_HEADERS:
+//     headers sent to the collector, such as for authentication.
+//   - OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES: the resource traces are
+//     reported for.
+//   - OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG: which traces are
+//     recorded.
+//   - OTEL_TRACES_EXPORTER=none or OTEL_SDK_DISABLED=true disable tracing.
+//
+// Trace context is propagated between processes with the W3C traceparent
+// header.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/version"
+)
+
+// Kind is the kind of a span, as defined by OTLP.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Attribute is a key and value describing a span. Values are strings,
+// integers, floats or booleans.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attribute {
+	return Attribute{key, value}
+}
+
+func Int(key string, value int) Attribute {
+	return Attribute{key, value}
+}
+
+func Bool(key string, value bool) Attribute {
+	return Attribute{key, value}
+}
+
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+func (sc spanContext) valid() bool {
+	return sc.traceID != [16]byte{} && sc.spanID != [8]byte{}
+}
+
+// Span is an operation of a trace. The methods of a nil Span do nothing so
+// that code can be instrumented whether tracing is enabled or not.
+type Span struct {
+	spanContext
+	parent [8]byte
+
+	name  string
+	kind  Kind
+	start time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes []Attribute
+	err        error
+}
+
+// SetAttributes adds attributes to s.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, attrs...)
+}
+
+// SetError marks s as failed with err, if it isn't nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// End ends s and queues it for export. Spans are ended once.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if t := tracer(); t != nil && s.sampled {
+		t.export(s)
+	}
+}
+
+type spanKey struct{}
+
+// spanContextFrom returns the context of the current span of ctx, which may
+// be of another process.
+func spanContextFrom(ctx context.Context) spanContext {
+	if sc, ok := ctx.Value(spanKey{}).(spanContext); ok {
+		return sc
+	}
+
+	return spanContext{}
+}
+
+// Start starts a span named name as a child of the current span of ctx,
+// returning the span and a context with it as the current span. It returns
+// a nil span and ctx if tracing is disabled.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return start(ctx, name, KindInternal, time.Now(), attrs)
+}
+
+// StartServer starts a span for the request r handled by a server,
+// continuing the trace of the traceparent header of r, if any.
+func StartServer(r *http.Request, name string, attrs ...Attribute) (context.Context, *Span) {
+	ctx := r.Context()
+	if sc, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+		ctx = context.WithValue(ctx, spanKey{}, sc)
+	}
+
+	return start(ctx, name, KindServer, time.Now(), attrs)
+}
+
+// StartClient starts a span for a request to another process and sets the
+// traceparent header of h so the process can continue the trace.
+func StartClient(ctx context.Context, h http.Header, name string, attrs ...Attribute) (context.Context, *Span) {
+	ctx, span := start(ctx, name, KindClient, time.Now(), attrs)
+	if span != nil {
+		h.Set("traceparent", span.traceparent())
+	}
+
+	return ctx, span
+}
+
+// Record records a span named name from startTime to endTime, for operations
+// measured rather than instrumented as they happen.
+func Record(ctx context.Context, name string, startTime, endTime time.Time, attrs ...Attribute) {
+	_, span := start(ctx, name, KindInternal, startTime, attrs)
+	if span == nil {
+		return
+	}
+
+	span.mu.Lock()
+	span.end = endTime
+	span.mu.Unlock()
+
+	if t := tracer(); t != nil && span.sampled {
+		t.export(span)
+	}
+}
+
+func start(ctx context.Context, name string, kind Kind, at time.Time, attrs []Attribute) (context.Context, *Span) {
+	t := tracer()
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent := spanContextFrom(ctx)
+
+	s := &Span{
+		name:       name,
+		kind:       kind,
+		start:      at,
+		attributes: attrs,
+	}
+
+	rand.Read(s.spanID[:]) //nolint:errcheck
+	if parent.valid() {
+		s.traceID = parent.traceID
+		s.parent = parent.spanID
+		s.sampled = t.sampler.sample(s.traceID, &parent)
+	} else {
+		rand.Read(s.traceID[:]) //nolint:errcheck
+		s.sampled = t.sampler.sample(s.traceID, nil)
+	}
+
+	return context.WithValue(ctx, spanKey{}, s.spanContext), s
+}
+
+// traceparent formats the W3C traceparent header of s.
+func (sc spanContext) traceparent() string {
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+
+	return "00-" + hex.EncodeToString(sc.traceID[:]) + "-" + hex.EncodeToString(sc.spanID[:]) + "-" + flags
+}
+
+func parseTraceparent(s string) (spanContext, bool) {
+	var sc spanContext
+
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+
+	// later versions may append fields
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != 16 {
+		return sc, false
+	}
+
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != 8 {
+		return sc, false
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return sc, false
+	}
+
+	copy(sc.traceID[:], traceID)
+	copy(sc.spanID[:], spanID)
+	sc.sampled = flags[0]&1 == 1
+	return sc, sc.valid()
+}
+
+// sampler decides which traces are recorded, as OTEL_TRACES_SAMPLER does.
+type sampler struct {
+	// ratio of root spans sampled
+	ratio float64
+
+	// parentBased samples spans with a parent as their parent is
+	parentBased bool
+}
+
+func (s sampler) sample(traceID [16]byte, parent *spanContext) bool {
+	if parent != nil && s.parentBased {
+		return parent.sampled
+	}
+
+	switch {
+	case s.ratio >= 1:
+		return true
+	case s.ratio <= 0:
+		return false
+	}
+
+	// the lower 8 bytes of trace ids are random
+	return binary.BigEndian.Uint64(traceID[8:])>>1 < uint64(s.ratio*(1<<63))
+}
+
+func newSampler() sampler {
+	ratio := 1.0
+	if s := envconfig.Var("OTEL_TRACES_SAMPLER_ARG"); s != "" {
+		if f, err := strconv.ParseFloat(s, 64); err == nil && f >= 0 && f <= 1 {
+			ratio = f
+		}
+	}
+
+	switch name := envconfig.Var("OTEL_TRACES_SAMPLER"); name {
+	case "", "parentbased_always_on":
+		return sampler{ratio: 1, parentBased: true}
+	case "always_on":
+		return sampler{ratio: 1}
+	case "always_off":
+		return sampler{ratio: 0}
+	case "parentbased_always_off":
+		return sampler{ratio: 0, parentBased: true}
+	case "traceidratio":
+		return sampler{ratio: ratio}
+	case "parentbased_traceidratio":
+		return sampler{ratio: ratio, parentBased: true}
+	default:
+		slog.Warn("unsupported trace sampler, sampling all traces", "sampler", name)
+		return sampler{ratio: 1, parentBased: true}
+	}
+}
+
+// parseKeyValues parses the comma separated key=value pairs of variables
+// such as OTEL_EXPORTER_OTLP_HEADERS, whose values are URL encoded.
+func parseKeyValues(s string) map[string]string {
+	m := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+
+		if u, err := url.QueryUnescape(strings.TrimSpace(v)); err == nil {
+			v = u
+		}
+
+		if k = strings.TrimSpace(k); k != "" {
+			m[k] = strings.TrimSpace(v)
+		}
+	}
+
+	return m
+}
+
+// endpoint returns the URL spans are exported to, or "" if tracing is
+// disabled.
+func endpoint() string {
+	if disabled, _ := strconv.ParseBool(envconfig.Var("OTEL_SDK_DISABLED")); disabled {
+		return ""
+	}
+
+	exporter := envconfig.Var("OTEL_TRACES_EXPORTER")
+	switch exporter {
+	case "", "otlp":
+	case "none":
+		return ""
+	default:
+		slog.Warn("unsupported trace exporter, tracing disabled", "exporter", exporter)
+		return ""
+	}
+
+	protocol := envconfig.Var("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = envconfig.Var("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+
+	// spans are only exported as JSON, which a collector expecting grpc or
+	// protobuf would reject
+	if protocol != "" && protocol != "http/json" {
+		slog.Warn("only the http/json OTLP protocol is supported, tracing disabled", "protocol", protocol)
+		return ""
+	}
+
+	if s := envconfig.Var("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); s != "" {
+		return s
+	}
+
+	if s := envconfig.Var("OTEL_EXPORTER_OTLP_ENDPOINT"); s != "" {
+		return strings.TrimSuffix(s, "/") + "/v1/traces"
+	}
+
+	if exporter == "otlp" {
+		return "http://localhost:4318/v1/traces"
+	}
+
+	return ""
+}
+
+var (
+	mu      sync.Mutex
+	current *exporter
+)
+
+func tracer() *exporter {
+	mu.Lock()
+	defer mu.Unlock()
+	return current
+}
+
+// Init enables tracing if it is configured, reporting spans for the service
+// named serviceName unless OTEL_SERVICE_NAME names another.
+func Init(serviceName string) {
+	u := endpoint()
+	if u == "" {
+		return
+	}
+
+	headers := parseKeyValues(envconfig.Var("OTEL_EXPORTER_OTLP_HEADERS"))
+	for k, v := range parseKeyValues(envconfig.Var("OTEL_EXPORTER_OTLP_TRACES_HEADERS")) {
+		headers[k] = v
+	}
+
+	resource := parseKeyValues(envconfig.Var("OTEL_RESOURCE_ATTRIBUTES"))
+	if s := envconfig.Var("OTEL_SERVICE_NAME"); s != "" {
+		resource["service.name"] = s
+	} else if _, ok := resource["service.name"]; !ok {
+		resource["service.name"] = serviceName
+	}
+	resource["service.version"] = version.Version
+
+	e := newExporter(u, headers, resource, newSampler())
+
+	mu.Lock()
+	defer mu.Unlock()
+	if current != nil {
+		return
+	}
+	current = e
+
+	slog.Info("tracing enabled", "endpoint", u, "service", resource["service.name"])
+}
+
+// Enabled reports whether tracing is enabled.
+func Enabled() bool {
+	return tracer() != nil
+}
+
+// Shutdown exports the spans not yet exported and disables tracing.
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	e := current
+	current = nil
+	mu.Unlock()
+
+	if e == nil {
+		return nil
+	}
+
+	if err := e.shutdownExport(ctx); err != nil {
+		return fmt.Errorf("exporting spans: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTraceparent(t *testing.T) {
+	const header = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, ok := parseTraceparent(header)
+	if !ok {
+		t.Fatal("expected a valid traceparent")
+	}
+
+	if got := sc.traceparent(); got != header {
+		t.Errorf("expected %s, got %s", header, got)
+	}
+
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-not-hex-01",
+	} {
+		if _, ok := parseTraceparent(s); ok {
+			t.Errorf("%q: expected an invalid traceparent", s)
+		}
+	}
+
+	// later versions may append fields
+	if _, ok := parseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); !ok {
+		t.Error("expected a valid traceparent of a later version")
+	}
+}
+
+func TestSampler(t *testing.T) {
+	sampled := &spanContext{sampled: true}
+	unsampled := &spanContext{}
+
+	var low, high [16]byte
+	high[8] = 0xff
+
+	cases := []struct {
+		sampler  string
+		arg      string
+		traceID  [16]byte
+		parent   *spanContext
+		expected bool
+	}{
+		{"", "", low, nil, true},
+		{"", "", low, unsampled, false},
+		{"always_on", "", low, unsampled, true},
+		{"always_off", "", low, sampled, false},
+		{"parentbased_always_off", "", low, sampled, true},
+		{"traceidratio", "0.5", low, nil, true},
+		{"traceidratio", "0.5", high, nil, false},
+		{"parentbased_traceidratio", "0.5", high, sampled, true},
+	}
+
+	for _, tt := range cases {
+		t.Setenv("OTEL_TRACES_SAMPLER", tt.sampler)
+		t.Setenv("OTEL_TRACES_SAMPLER_ARG", tt.arg)
+
+		if got := newSampler().sample(tt.traceID, tt.parent); got != tt.expected {
+			t.Errorf("%s(%s): expected %v, got %v", tt.sampler, tt.arg, tt.expected, got)
+		}
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	cases := []struct {
+		env      map[string]string
+		expected string
+	}{
+		{map[string]string{}, ""},
+		{map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318/"}, "http://collector:4318/v1/traces"},
+		{map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://collector/traces", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://other"}, "http://collector/traces"},
+		{map[string]string{"OTEL_TRACES_EXPORTER": "otlp"}, "http://localhost:4318/v1/traces"},
+		{map[string]string{"OTEL_TRACES_EXPORTER": "none", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector"}, ""},
+		{map[string]string{"OTEL_SDK_DISABLED": "true", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector"}, ""},
+		{map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/json", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector"}, "http://collector/v1/traces"},
+		{map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "grpc", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector"}, ""},
+		{map[string]string{"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "http/protobuf", "OTEL_EXPORTER_OTLP_PROTOCOL": "http/json", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector"}, ""},
+	}
+
+	for _, tt := range cases {
+		for _, k := range []string{"OTEL_SDK_DISABLED", "OTEL_TRACES_EXPORTER", "OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_PROTOCOL", "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"} {
+			t.Setenv(k, tt.env[k])
+		}
+
+		if got := endpoint(); got != tt.expected {
+			t.Errorf("%v: expected %q, got %q", tt.env, tt.expected, got)
+		}
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	ctx, span := Start(context.Background(), "test")
+	if span != nil {
+		t.Fatal("expected no span when tracing is disabled")
+	}
+
+	// the methods of nil spans do nothing
+	span.SetAttributes(String("key", "value"))
+	span.SetError(errors.New("error"))
+	span.End()
+
+	if sc := spanContextFrom(ctx); sc.valid() {
+		t.Error("expected no span context")
+	}
+}
+
+func TestExport(t *testing.T) {
+	var got request
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		if r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer%20secret")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=test")
+
+	Init("test")
+	if !Enabled() {
+		t.Fatal("expected tracing to be enabled")
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/chat", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, server := StartServer(r, "POST /api/chat", String("http.route", "/api/chat"))
+
+	h := make(http.Header)
+	_, client := StartClient(ctx, h, "completion")
+	if h.Get("traceparent") != client.traceparent() {
+		t.Errorf("expected traceparent %s, got %s", client.traceparent(), h.Get("traceparent"))
+	}
+
+	client.SetError(errors.New("runner crashed"))
+	client.End()
+
+	start := time.Unix(1, 0)
+	Record(ctx, "generate", start, start.Add(time.Second), Int("tokens", 10))
+	server.End()
+
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if Enabled() {
+		t.Error("expected tracing to be disabled")
+	}
+
+	if auth := header.Get("Authorization"); auth != "Bearer secret" {
+		t.Errorf("unexpected authorization header %q", auth)
+	}
+
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected request %+v", got)
+	}
+
+	resource := make(map[string]any)
+	for _, a := range got.ResourceSpans[0].Resource.Attributes {
+		resource[a.Key] = a.Value["stringValue"]
+	}
+
+	if resource["service.name"] != "test" || resource["deployment.environment"] != "test" {
+		t.Errorf("unexpected resource %v", resource)
+	}
+
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+
+	type summary struct {
+		Name, TraceID, Parent string
+		Kind                  Kind
+		Status                status
+	}
+
+	var summaries []summary
+	for _, s := range spans {
+		summaries = append(summaries, summary{s.Name, s.TraceID, s.ParentSpanID, s.Kind, s.Status})
+	}
+
+	serverID := spans[2].SpanID
+	if diff := cmp.Diff(summaries, []summary{
+		{"completion", "4bf92f3577b34da6a3ce929d0e0e4736", serverID, KindClient, status{Code: 2, Message: "runner crashed"}},
+		{"generate", "4bf92f3577b34da6a3ce929d0e0e4736", serverID, KindInternal, status{}},
+		{"POST /api/chat", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", KindServer, status{}},
+	}); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	if generate := spans[1]; generate.StartTimeUnixNano != "1000000000" || generate.EndTimeUnixNano != "2000000000" {
+		t.Errorf("unexpected times %s-%s", generate.StartTimeUnixNano, generate.EndTimeUnixNano)
+	}
+
+	if diff := cmp.Diff(spans[1].Attributes, []attribute{{Key: "tokens", Value: map[string]any{"intValue": "10"}}}); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Build describes how the weights of a model were built, such as
+// "Q4_K_M-cuda-avx2": a quantization, optionally followed by the runtime the
+// build targets and the CPU features it requires, separated by "-".
+type Build struct {
+	quantization string
+	runtime      string
+	flags        []string
+}
+
+// ParseBuild parses s as a build string of the form:
+//
+//	{ quantization } [ "-" { runtime } { "-" { flag } }* ]
+//
+// Each component must be non-empty and consist of letters, digits and "_".
+func ParseBuild(s string) (Build, error) {
+	parts := strings.Split(s, "-")
+	for _, part := range parts {
+		if part == "" {
+			return Build{}, fmt.Errorf("invalid build %q: empty component", s)
+		}
+
+		for i := range len(part) {
+			if !isAlphanumericOrUnderscore(part[i]) {
+				return Build{}, fmt.Errorf("invalid build %q: invalid character %q", s, part[i])
+			}
+		}
+	}
+
+	b := Build{quantization: parts[0]}
+	if len(parts) > 1 {
+		b.runtime = parts[1]
+		b.flags = parts[2:]
+	}
+
+	return b, nil
+}
+
+// Quantization returns the quantization of the build, such as "Q4_K_M".
+func (b Build) Quantization() string {
+	return b.quantization
+}
+
+// Runtime returns the runtime the build targets, such as "cuda", or the
+// empty string if it runs anywhere.
+func (b Build) Runtime() string {
+	return b.runtime
+}
+
+// Flags returns a copy of the CPU features the build requires, such as
+// "avx2", or nil if it requires none.
+func (b Build) Flags() []string {
+	if len(b.flags) == 0 {
+		return nil
+	}
+
+	return slices.Clone(b.flags)
+}
+
+// String returns the build string, in the format accepted by [ParseBuild].
+func (b Build) String() string {
+	if b.runtime == "" {
+		return b.quantization
+	}
+
+	return strings.Join(append([]string{b.quantization, b.runtime}, b.flags...), "-")
+}
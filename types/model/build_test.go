@@ -0,0 +1,59 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBuild(t *testing.T) {
+	cases := []struct {
+		in      string
+		quant   string
+		runtime string
+		flags   []string
+		wantErr bool
+	}{
+		{in: "Q4_0", quant: "Q4_0"},
+		{in: "Q4_K_M-cuda", quant: "Q4_K_M", runtime: "cuda"},
+		{in: "Q4_K_M-cuda-avx2", quant: "Q4_K_M", runtime: "cuda", flags: []string{"avx2"}},
+		{in: "F16-cpu-avx2-f16c", quant: "F16", runtime: "cpu", flags: []string{"avx2", "f16c"}},
+		{in: "", wantErr: true},
+		{in: "Q4_0-", wantErr: true},
+		{in: "Q4_0--avx2", wantErr: true},
+		{in: "Q4_0-cuda+avx2", wantErr: true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.in, func(t *testing.T) {
+			b, err := ParseBuild(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseBuild(%q) = %v; want error", tt.in, b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if b.Quantization() != tt.quant {
+				t.Errorf("Quantization() = %q; want %q", b.Quantization(), tt.quant)
+			}
+			if b.Runtime() != tt.runtime {
+				t.Errorf("Runtime() = %q; want %q", b.Runtime(), tt.runtime)
+			}
+			if !reflect.DeepEqual(b.Flags(), tt.flags) {
+				t.Errorf("Flags() = %q; want %q", b.Flags(), tt.flags)
+			}
+			if flags := b.Flags(); len(flags) > 0 {
+				flags[0] = "changed"
+				if b.Flags()[0] == "changed" {
+					t.Error("Flags() returned the flags of the build")
+				}
+			}
+			if b.String() != tt.in {
+				t.Errorf("String() = %q; want %q", b.String(), tt.in)
+			}
+		})
+	}
+}
@@ -4,11 +4,14 @@ package model
 
 import (
 	"cmp"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"path"
 	"path/filepath"
 	"strings"
+	"unicode/utf8"
 )
 
 // Errors
@@ -18,8 +21,52 @@ var (
 	// to avoid other packages inventing their own error type.
 	// Additionally, it can be conveniently used via [Unqualified].
 	ErrUnqualifiedName = errors.New("unqualified name")
+
+	// ErrTooManyParts is returned by [ParseNameStrict] for names with more
+	// parts than host, namespace, model and tag.
+	ErrTooManyParts = errors.New("too many parts in name")
+
+	// ErrInvalidDigest is returned by [ParseNameStrict] for names with a
+	// digest that is not a sha256 digest.
+	ErrInvalidDigest = errors.New("digest must be sha256 followed by 64 hexadecimal characters")
 )
 
+// ErrMissingPart is returned by [ParseNameStrict] when a part of a name is
+// empty, such as the namespace in "/model" or the tag in "model:".
+type ErrMissingPart struct {
+	// Part is the kind of the part: "host", "namespace", "model" or "tag".
+	Part string
+}
+
+func (e ErrMissingPart) Error() string {
+	return fmt.Sprintf("missing %s", e.Part)
+}
+
+// ErrPartTooLong is returned by [ParseNameStrict] when a part of a name is
+// longer than allowed.
+type ErrPartTooLong struct {
+	Part string
+	Max  int
+}
+
+func (e ErrPartTooLong) Error() string {
+	return fmt.Sprintf("%s is longer than %d characters", e.Part, e.Max)
+}
+
+// ErrInvalidChar is returned by [ParseNameStrict] when a part of a name
+// contains a character it may not.
+type ErrInvalidChar struct {
+	Part string
+	Char rune
+
+	// Offset is the byte offset of Char in the name string.
+	Offset int
+}
+
+func (e ErrInvalidChar) Error() string {
+	return fmt.Sprintf("invalid character %q in %s at position %d", e.Char, e.Part, e.Offset)
+}
+
 // Unqualified is a helper function that returns an error with
 // ErrUnqualifiedName as the cause and the name as the message.
 func Unqualified(n Name) error {
@@ -91,6 +138,10 @@ type Name struct {
 	Namespace string
 	Model     string
 	Tag       string
+
+	// digest is set with [Name.WithDigest] so that it is only ever
+	// compared as a whole
+	digest string
 }
 
 // ParseName parses and assembles a Name from a name string. The
@@ -123,8 +174,8 @@ type Name struct {
 //	      pattern: { alphanum | "_" } { alphanum | "-" | "_" | "." }*
 //	      length:  [1, 80]
 //	  digest:
-//	      pattern: { alphanum | "_" } { alphanum | "-" | ":" }*
-//	      length:  [1, 80]
+//	      pattern: "sha256" { ":" | "-" } { hex }
+//	      length:  71
 //
 // Most users should use [ParseName] instead, unless need to support
 // different defaults than DefaultName.
@@ -136,12 +187,95 @@ func ParseName(s string) Name {
 	return Merge(ParseNameBare(s), DefaultName())
 }
 
+// ParseNameStrict is like [ParseName] but reports why s is not a valid name
+// instead of returning an invalid one. The error is one of
+// [ErrTooManyParts], [ErrMissingPart], [ErrPartTooLong], [ErrInvalidChar]
+// or [ErrInvalidDigest].
+func ParseNameStrict(s string) (Name, error) {
+	if s == "" {
+		return Name{}, ErrMissingPart{Part: kindModel.String()}
+	}
+
+	// offset is the position of rest within s
+	rest, offset := s, 0
+	scheme := false
+	if i := strings.Index(rest, "://"); i >= 0 && !strings.Contains(rest[:i], "/") {
+		offset = i + len("://")
+		rest, scheme = rest[offset:], true
+	}
+
+	var n Name
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		if rest[i+1:] == "" {
+			return Name{}, ErrMissingPart{Part: kindDigest.String()}
+		} else if !isValidDigest(rest[i+1:]) {
+			return Name{}, ErrInvalidDigest
+		}
+		n.digest, rest = rest[i+1:], rest[:i]
+	}
+
+	if i, j := strings.LastIndex(rest, ":"), strings.LastIndex(rest, "/"); i > j {
+		if err := validatePart(kindTag, rest[i+1:], offset+i+1); err != nil {
+			return Name{}, err
+		}
+		n.Tag, rest = rest[i+1:], rest[:i]
+	}
+
+	parts := strings.Split(rest, "/")
+	if len(parts) > 3 {
+		return Name{}, ErrTooManyParts
+	} else if scheme && len(parts) < 3 {
+		// a scheme is only meaningful in front of a host
+		return Name{}, ErrMissingPart{Part: kindHost.String()}
+	}
+
+	kinds := []partKind{kindHost, kindNamespace, kindModel}[3-len(parts):]
+	values := []*string{&n.Host, &n.Namespace, &n.Model}[3-len(parts):]
+	for i, part := range parts {
+		if err := validatePart(kinds[i], part, offset); err != nil {
+			return Name{}, err
+		}
+		*values[i] = part
+		offset += len(part) + 1
+	}
+
+	return Merge(n, DefaultName()), nil
+}
+
+// validatePart returns the error describing why s is not a valid part of
+// the given kind, if it is not. offset is the position of s in the name
+// string.
+func validatePart(kind partKind, s string, offset int) error {
+	if s == "" {
+		return ErrMissingPart{Part: kind.String()}
+	}
+
+	if !isValidLen(kind, s) {
+		return ErrPartTooLong{Part: kind.String(), Max: maxLen(kind)}
+	}
+
+	for i, r := range s {
+		// isValidPart checks a byte at a time, so any multi-byte
+		// character is invalid
+		if r >= utf8.RuneSelf || !isValidPart(kind, s[:i+1]) {
+			return ErrInvalidChar{Part: kind.String(), Char: r, Offset: offset + i}
+		}
+	}
+
+	return nil
+}
+
 // ParseNameBare parses s as a name string and returns a Name. No merge with
 // [DefaultName] is performed.
 func ParseNameBare(s string) Name {
 	var n Name
 	var promised bool
 
+	// the digest may contain ":" so it is cut before the tag
+	if strings.Contains(s, "@") {
+		s, n.digest, _ = cutPromised(s, "@")
+	}
+
 	// "/" is an illegal tag character, so we can use it to split the host
 	if strings.LastIndex(s, ":") > strings.LastIndex(s, "/") {
 		s, n.Tag, _ = cutPromised(s, ":")
@@ -216,6 +350,10 @@ func (n Name) String() string {
 		b.WriteByte(':')
 		b.WriteString(n.Tag)
 	}
+	if n.digest != "" {
+		b.WriteByte('@')
+		b.WriteString(n.digest)
+	}
 	return b.String()
 }
 
@@ -240,6 +378,89 @@ func (n Name) DisplayShortest() string {
 	return sb.String()
 }
 
+// DisplayComplete returns the name with all of its parts, including the
+// digest if it has one. Unlike [Name.DisplayShortest], default parts are
+// never omitted.
+func (n Name) DisplayComplete() string {
+	var sb strings.Builder
+	sb.WriteString(n.Host)
+	sb.WriteByte('/')
+	sb.WriteString(n.Namespace)
+	sb.WriteByte('/')
+	sb.WriteString(n.Model)
+	sb.WriteByte(':')
+	sb.WriteString(n.Tag)
+	if n.digest != "" {
+		sb.WriteByte('@')
+		sb.WriteString(n.digest)
+	}
+	return sb.String()
+}
+
+// HasDigest reports whether the name references a digest, as in
+// "model:tag@sha256:...".
+func (n Name) HasDigest() bool {
+	return n.digest != ""
+}
+
+// Digest returns the digest of the name, in the form it was given, or the
+// empty string if it has none.
+func (n Name) Digest() string {
+	return n.digest
+}
+
+// WithHost returns a copy of n with host h, or the reason h is not a valid
+// host as [ParseNameStrict] would report it. Offsets in errors are relative
+// to h.
+func (n Name) WithHost(h string) (Name, error) {
+	if err := validatePart(kindHost, h, 0); err != nil {
+		return Name{}, err
+	}
+	n.Host = h
+	return n, nil
+}
+
+// WithNamespace returns a copy of n with namespace ns, or the reason ns is
+// not a valid namespace. Offsets in errors are relative to ns.
+func (n Name) WithNamespace(ns string) (Name, error) {
+	if err := validatePart(kindNamespace, ns, 0); err != nil {
+		return Name{}, err
+	}
+	n.Namespace = ns
+	return n, nil
+}
+
+// WithModel returns a copy of n with model m, or the reason m is not a valid
+// model. Offsets in errors are relative to m.
+func (n Name) WithModel(m string) (Name, error) {
+	if err := validatePart(kindModel, m, 0); err != nil {
+		return Name{}, err
+	}
+	n.Model = m
+	return n, nil
+}
+
+// WithTag returns a copy of n with tag t, or the reason t is not a valid
+// tag. Offsets in errors are relative to t.
+func (n Name) WithTag(t string) (Name, error) {
+	if err := validatePart(kindTag, t, 0); err != nil {
+		return Name{}, err
+	}
+	n.Tag = t
+	return n, nil
+}
+
+// WithDigest returns a copy of n that references digest d, or
+// [ErrInvalidDigest] if d is not a sha256 digest. An empty d removes the
+// digest.
+func (n Name) WithDigest(d string) (Name, error) {
+	if d != "" && !isValidDigest(d) {
+		return Name{}, ErrInvalidDigest
+	}
+	n.digest = d
+	return n, nil
+}
+
 // IsValidNamespace reports whether the provided string is a valid
 // namespace.
 func IsValidNamespace(s string) bool {
@@ -248,11 +469,8 @@ func IsValidNamespace(s string) bool {
 
 // IsValid reports whether all parts of the name are present and valid. The
 // digest is a special case, and is checked for validity only if present.
-//
-// Note: The digest check has been removed as is planned to be added back in
-// at a later time.
 func (n Name) IsValid() bool {
-	return n.IsFullyQualified()
+	return n.IsFullyQualified() && (n.digest == "" || isValidDigest(n.digest))
 }
 
 // IsFullyQualified returns true if all parts of the name are present and
@@ -298,11 +516,114 @@ func (n Name) LogValue() slog.Value {
 	return slog.StringValue(n.String())
 }
 
+// MarshalText implements [encoding.TextMarshaler]. It returns the name
+// string as returned by [Name.String].
+func (n Name) MarshalText() ([]byte, error) {
+	return []byte(n.String()), nil
+}
+
+// UnmarshalText implements [encoding.TextUnmarshaler]. It parses text with
+// [ParseNameStrict] and returns its error if text is not a valid name. Empty
+// text unmarshals to the zero Name.
+func (n *Name) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*n = Name{}
+		return nil
+	}
+
+	name, err := ParseNameStrict(string(text))
+	if err != nil {
+		return err
+	}
+
+	*n = name
+	return nil
+}
+
+// MarshalJSON implements [json.Marshaler]. The name is encoded as a JSON
+// string.
+func (n Name) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.String())
+}
+
+// UnmarshalJSON implements [json.Unmarshaler]. It decodes a JSON string as
+// [Name.UnmarshalText] does. A JSON null leaves n unchanged.
+func (n *Name) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	return n.UnmarshalText([]byte(s))
+}
+
+// CanonicalString returns the name string as returned by [Name.String] in
+// lowercase, so names that are equal by [Name.EqualFold] have the same
+// canonical form.
+func (n Name) CanonicalString() string {
+	return strings.ToLower(n.String())
+}
+
+// CompareFold returns an integer comparing two names part by part, from host
+// to digest, ignoring case. The result is 0 if n and o are equal by
+// [Name.EqualFold], -1 if n sorts before o, and +1 otherwise.
+func (n Name) CompareFold(o Name) int {
+	return cmp.Or(
+		compareFold(n.Host, o.Host),
+		compareFold(n.Namespace, o.Namespace),
+		compareFold(n.Model, o.Model),
+		compareFold(n.Tag, o.Tag),
+		compareFold(n.digest, o.digest),
+	)
+}
+
+func compareFold(a, b string) int {
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
 func (n Name) EqualFold(o Name) bool {
 	return strings.EqualFold(n.Host, o.Host) &&
 		strings.EqualFold(n.Namespace, o.Namespace) &&
 		strings.EqualFold(n.Model, o.Model) &&
-		strings.EqualFold(n.Tag, o.Tag)
+		strings.EqualFold(n.Tag, o.Tag) &&
+		strings.EqualFold(n.digest, o.digest)
+}
+
+// Match reports whether n matches pattern. Each part of pattern is matched
+// against the same part of n, ignoring case, with the syntax of [path.Match],
+// so "*" matches any part, as in "example.com/*/mistral:*". Parts of pattern
+// are typically filled in by [ParseName], so "mistral" only matches
+// "registry.ollama.ai/library/mistral:latest". If pattern has a digest, n
+// must have the same digest; otherwise any digest matches.
+//
+// A malformed pattern matches no names.
+func (n Name) Match(pattern Name) bool {
+	parts := [][2]string{
+		{pattern.Host, n.Host},
+		{pattern.Namespace, n.Namespace},
+		{pattern.Model, n.Model},
+		{pattern.Tag, n.Tag},
+	}
+	for _, p := range parts {
+		if ok, err := path.Match(strings.ToLower(p[0]), strings.ToLower(p[1])); err != nil || !ok {
+			return false
+		}
+	}
+
+	return pattern.digest == "" || strings.EqualFold(pattern.digest, n.digest)
+}
+
+func maxLen(kind partKind) int {
+	switch kind {
+	case kindHost:
+		return 350
+	default:
+		return 80
+	}
 }
 
 func isValidLen(kind partKind, s string) bool {
@@ -346,6 +667,26 @@ func isValidPart(kind partKind, s string) bool {
 	return true
 }
 
+// isValidDigest reports whether s is a sha256 digest in either the
+// "sha256:" form of references or the "sha256-" form of blob names.
+func isValidDigest(s string) bool {
+	hex, ok := strings.CutPrefix(s, "sha256:")
+	if !ok {
+		hex, ok = strings.CutPrefix(s, "sha256-")
+	}
+
+	if !ok || len(hex) != 64 {
+		return false
+	}
+
+	for i := range len(hex) {
+		if !(hex[i] >= '0' && hex[i] <= '9' || hex[i] >= 'a' && hex[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
 func isAlphanumericOrUnderscore(c byte) bool {
 	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_'
 }
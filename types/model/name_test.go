@@ -1,14 +1,18 @@
 package model
 
 import (
+	"encoding/json"
+	"errors"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 )
 
 const (
 	part80  = "88888888888888888888888888888888888888888888888888888888888888888888888888888888"
+	digest  = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
 	part350 = "33333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333"
 )
 
@@ -185,10 +189,108 @@ var testCases = map[string]bool{ // name -> valid
 	// hosts
 	"host:https/namespace/model:tag": true,
 
+	// digests
+	"h/n/m:t@" + digest:                  true,
+	"h/n/m:t@sha256-" + digest[7:]:       true,
+	"h/n/m:t@" + digest[:70]:             false,
+	"h/n/m:t@md5:" + digest[7:]:          false,
+	"h/n/m:t@" + strings.ToUpper(digest): false,
+	"h/n/m:t@":                           false,
+
 	// colon in non-host part before tag
 	"host/name:space/model:tag": false,
 }
 
+func TestNameDigest(t *testing.T) {
+	n := ParseName("example.com/library/mistral:7b@" + digest)
+	if !n.IsValid() || !n.HasDigest() || n.Digest() != digest {
+		t.Fatalf("expected valid name with digest %s, got %#v", digest, n)
+	}
+
+	if want := "example.com/library/mistral:7b@" + digest; n.String() != want || n.DisplayComplete() != want {
+		t.Errorf("String() = %q, DisplayComplete() = %q; want %q", n.String(), n.DisplayComplete(), want)
+	}
+
+	if got := n.Filepath(); got != filepath.Join("example.com", "library", "mistral", "7b") {
+		t.Errorf("Filepath() = %q; want it without the digest", got)
+	}
+
+	bare, err := n.WithDigest("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bare.HasDigest() || bare.String() != "example.com/library/mistral:7b" {
+		t.Errorf("WithDigest(\"\") = %q; want no digest", bare)
+	}
+
+	if bare == n || bare.EqualFold(n) {
+		t.Error("expected names with and without a digest to differ")
+	}
+
+	if got, err := bare.WithDigest(digest); err != nil || got != n {
+		t.Errorf("WithDigest(%q) = %v, %v; want %v", digest, got, err, n)
+	}
+
+	if _, err := bare.WithDigest("sha256:1234"); err != ErrInvalidDigest {
+		t.Errorf("WithDigest(%q) error = %v; want %v", "sha256:1234", err, ErrInvalidDigest)
+	}
+
+	if got := ParseName("mistral").DisplayComplete(); got != "registry.ollama.ai/library/mistral:latest" {
+		t.Errorf("DisplayComplete() = %q; want all parts", got)
+	}
+}
+
+func TestNameWith(t *testing.T) {
+	n := ParseName("mistral")
+
+	with := func(fn func(Name, string) (Name, error), s string) Name {
+		t.Helper()
+		got, err := fn(n, s)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", s, err)
+		}
+		return got
+	}
+
+	cases := []struct {
+		got  Name
+		want string
+	}{
+		{with(Name.WithHost, "example.com:5000"), "example.com:5000/library/mistral:latest"},
+		{with(Name.WithNamespace, "team"), "registry.ollama.ai/team/mistral:latest"},
+		{with(Name.WithModel, "llama3.2"), "registry.ollama.ai/library/llama3.2:latest"},
+		{with(Name.WithTag, "7b-q4_K_M"), "registry.ollama.ai/library/mistral:7b-q4_K_M"},
+	}
+
+	for _, tt := range cases {
+		if tt.got.String() != tt.want {
+			t.Errorf("got %q; want %q", tt.got, tt.want)
+		}
+	}
+
+	if n.String() != "registry.ollama.ai/library/mistral:latest" {
+		t.Errorf("expected With methods to leave the name unchanged, got %q", n)
+	}
+
+	errs := []struct {
+		fn   func(Name, string) (Name, error)
+		s    string
+		want error
+	}{
+		{Name.WithHost, "", ErrMissingPart{Part: "host"}},
+		{Name.WithNamespace, "my.team", ErrInvalidChar{Part: "namespace", Char: '.', Offset: 2}},
+		{Name.WithModel, "a/b", ErrInvalidChar{Part: "model", Char: '/', Offset: 1}},
+		{Name.WithTag, part80 + "8", ErrPartTooLong{Part: "tag", Max: 80}},
+	}
+
+	for _, tt := range errs {
+		if got, err := tt.fn(n, tt.s); err != tt.want || got != (Name{}) {
+			t.Errorf("%q: got %v, %v; want %v", tt.s, got, err, tt.want)
+		}
+	}
+}
+
 func TestNameparseNameDefault(t *testing.T) {
 	const name = "xx"
 	n := ParseName(name)
@@ -307,6 +409,92 @@ func TestDisplayShortest(t *testing.T) {
 	}
 }
 
+func TestNameMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"example.com/*/mistral:*", "example.com/jmorgan/mistral:7b", true},
+		{"example.com/*/mistral:*", "example.com/jmorgan/mistral", true},
+		{"example.com/*/mistral:*", "Example.COM/jmorgan/Mistral:7B", true},
+		{"example.com/*/mistral:*", "other.com/jmorgan/mistral:7b", false},
+		{"example.com/*/mistral:*", "example.com/jmorgan/llama3:7b", false},
+		{"*/*/*:*", "mistral", true},
+		{"mistral", "mistral:latest", true},
+		{"mistral", "mistral:7b", false},
+		{"mistral:7b-*", "mistral:7b-instruct", true},
+		{"mistral:7b-*", "mistral:70b", false},
+		{"*/mistral", "mistral", true},
+		{"*/mistral", "example.com/library/mistral", false},
+		{"llama?:*", "llama3:8b", true},
+		{"llama[0-2]:*", "llama3:8b", false},
+		{"example.com:*/*/*:*", "example.com:5000/library/mistral:7b", true},
+		{"mistral:*@" + digest, "mistral:7b@" + digest, true},
+		{"mistral:*@" + digest, "mistral:7b", false},
+		{"mistral:*", "mistral:7b@" + digest, true},
+
+		// malformed patterns match nothing
+		{"mistral:[", "mistral:[", false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if got := ParseName(tt.name).Match(ParseName(tt.pattern)); got != tt.want {
+				t.Errorf("ParseName(%q).Match(%q) = %v; want %v", tt.name, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNameCanonicalString(t *testing.T) {
+	cases := map[string]string{
+		"Mistral":                        "registry.ollama.ai/library/mistral:latest",
+		"Example.COM/Jmorgan/Mistral:7B": "example.com/jmorgan/mistral:7b",
+		"mistral:7b@" + digest:           "registry.ollama.ai/library/mistral:7b@" + digest,
+	}
+
+	for in, want := range cases {
+		t.Run(in, func(t *testing.T) {
+			if got := ParseName(in).CanonicalString(); got != want {
+				t.Errorf("ParseName(%q).CanonicalString() = %q; want %q", in, got, want)
+			}
+		})
+	}
+}
+
+func TestNameCompareFold(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"mistral", "MISTRAL:latest", 0},
+		{"mistral:7b", "mistral:latest", -1},
+		{"mistral:latest", "Mistral:7B", 1},
+		{"llama3", "mistral", -1},
+		// parts are compared in order, so the host is compared first
+		{"a.com/z/model", "b.com/a/model", -1},
+		{"mistral", "mistral@" + digest, -1},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			a, b := ParseName(tt.a), ParseName(tt.b)
+			if got := a.CompareFold(b); got != tt.want {
+				t.Errorf("CompareFold(%q, %q) = %d; want %d", tt.a, tt.b, got, tt.want)
+			}
+
+			if got := b.CompareFold(a); got != -tt.want {
+				t.Errorf("CompareFold(%q, %q) = %d; want %d", tt.b, tt.a, got, -tt.want)
+			}
+
+			if equal := a.EqualFold(b); equal != (tt.want == 0) {
+				t.Errorf("EqualFold(%q, %q) = %v; want %v", tt.a, tt.b, equal, tt.want == 0)
+			}
+		})
+	}
+}
+
 func FuzzName(f *testing.F) {
 	for s := range testCases {
 		f.Add(s)
@@ -356,3 +544,132 @@ func TestIsValidNamespace(t *testing.T) {
 		})
 	}
 }
+
+func TestParseNameStrict(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    Name
+		wantErr error
+	}{
+		{in: "mistral", want: Name{Host: "registry.ollama.ai", Namespace: "library", Model: "mistral", Tag: "latest"}},
+		{in: "user/mistral:7b", want: Name{Host: "registry.ollama.ai", Namespace: "user", Model: "mistral", Tag: "7b"}},
+		{in: "https://host:port/ns/model:tag", want: Name{Host: "host:port", Namespace: "ns", Model: "model", Tag: "tag"}},
+		{in: "", wantErr: ErrMissingPart{Part: "model"}},
+		{in: "model:", wantErr: ErrMissingPart{Part: "tag"}},
+		{in: "/model", wantErr: ErrMissingPart{Part: "namespace"}},
+		{in: "https://ns/model", wantErr: ErrMissingPart{Part: "host"}},
+		{in: "a/b/c/d", wantErr: ErrTooManyParts},
+		{in: "my-team.x/model", wantErr: ErrInvalidChar{Part: "namespace", Char: '.', Offset: 7}},
+		{in: "host/ns/-model", wantErr: ErrInvalidChar{Part: "model", Char: '-', Offset: 8}},
+		{in: "model:t!g", wantErr: ErrInvalidChar{Part: "tag", Char: '!', Offset: 7}},
+		{in: "model:7b@" + digest, want: Name{Host: "registry.ollama.ai", Namespace: "library", Model: "model", Tag: "7b", digest: digest}},
+		{in: "model@", wantErr: ErrMissingPart{Part: "digest"}},
+		{in: "model:t@g", wantErr: ErrInvalidDigest},
+		{in: "model@sha256:ABCDEF", wantErr: ErrInvalidDigest},
+		{in: "scheme://h/n/mödel", wantErr: ErrInvalidChar{Part: "model", Char: 'ö', Offset: 14}},
+		{in: part80 + "8", wantErr: ErrPartTooLong{Part: "model", Max: 80}},
+		{in: part350 + "3/n/m", wantErr: ErrPartTooLong{Part: "host", Max: 350}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseNameStrict(tt.in)
+			if err != tt.wantErr {
+				t.Fatalf("ParseNameStrict(%q) error = %v; want %v", tt.in, err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseNameStrict(%q) = %v; want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNameStrictError(t *testing.T) {
+	_, err := ParseNameStrict("my-team.x/model")
+	if want := `invalid character '.' in namespace at position 7`; err == nil || err.Error() != want {
+		t.Errorf("error = %v; want %q", err, want)
+	}
+
+	var invalid ErrInvalidChar
+	if !errors.As(err, &invalid) || invalid.Part != "namespace" {
+		t.Errorf("expected ErrInvalidChar in namespace, got %#v", err)
+	}
+}
+
+func FuzzParseNameStrict(f *testing.F) {
+	for s := range testCases {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		n, err := ParseNameStrict(s)
+		if valid := ParseName(s).IsValid(); valid != (err == nil) {
+			t.Errorf("ParseName(%q).IsValid() = %v but ParseNameStrict error = %v", s, valid, err)
+		}
+
+		if err == nil && n != ParseName(s) {
+			t.Errorf("ParseNameStrict(%q) = %v; want %v", s, n, ParseName(s))
+		}
+	})
+}
+
+func TestNameMarshalJSON(t *testing.T) {
+	type config struct {
+		Model Name  `json:"model"`
+		Draft *Name `json:"draft,omitempty"`
+	}
+
+	b, err := json.Marshal(config{Model: ParseName("llama3.2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `{"model":"registry.ollama.ai/library/llama3.2:latest"}`; string(b) != want {
+		t.Errorf("Marshal = %s; want %s", b, want)
+	}
+
+	var got config
+	if err := json.Unmarshal([]byte(`{"model":"llama3.2","draft":"example.com/x/draft:1b"}`), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Model != ParseName("llama3.2") {
+		t.Errorf("Model = %v; want %v", got.Model, ParseName("llama3.2"))
+	}
+
+	if got.Draft == nil || *got.Draft != ParseName("example.com/x/draft:1b") {
+		t.Errorf("Draft = %v; want %v", got.Draft, ParseName("example.com/x/draft:1b"))
+	}
+
+	err = json.Unmarshal([]byte(`{"model":"my-team.x/model"}`), &got)
+	var invalid ErrInvalidChar
+	if !errors.As(err, &invalid) || invalid.Offset != 7 {
+		t.Errorf("expected ErrInvalidChar at 7, got %#v", err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"model":""}`), &got); err != nil || got.Model != (Name{}) {
+		t.Errorf("expected zero name for empty string, got %v, %v", got.Model, err)
+	}
+}
+
+func TestNameMarshalText(t *testing.T) {
+	// map keys use encoding.TextMarshaler
+	b, err := json.Marshal(map[Name]int{ParseName("llama3.2"): 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[Name]int
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got[ParseName("llama3.2")] != 1 {
+		t.Errorf("expected round trip of %s, got %v", b, got)
+	}
+
+	var n Name
+	if err := n.UnmarshalText([]byte("a/b/c/d")); !errors.Is(err, ErrTooManyParts) {
+		t.Errorf("expected ErrTooManyParts, got %v", err)
+	}
+}
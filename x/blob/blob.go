@@ -0,0 +1,281 @@
+// Package blob is a content-addressed store for the blobs and manifests of
+// models, laid out like the local model store:
+//
+//	<dir>/blobs/sha256-<hex>
+//	<dir>/manifests/<host>/<namespace>/<model>/<tag>
+//
+// Blobs are referenced by the config and layers of manifests, which are
+// keyed by [model.Name]. Writes go to a temporary file that is renamed into
+// place, so readers never see a partial blob or manifest. [Store.GC] removes
+// the blobs no manifest references.
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ollama/ollama/types/model"
+	"github.com/ollama/ollama/x/manifest"
+)
+
+// ErrInvalidDigest is returned for digests that are not sha256 digests.
+var ErrInvalidDigest = model.ErrInvalidDigest
+
+// tempPrefix starts the names of files being written, which GC removes if
+// they were left behind by an interrupted write.
+const tempPrefix = ".tmp-"
+
+// Store is a blob store in a directory.
+type Store struct {
+	dir string
+
+	// mu keeps GC from removing the temporary files of writes in
+	// progress
+	mu sync.RWMutex
+}
+
+// Open opens the store in dir, creating its directories if needed.
+func Open(dir string) (*Store, error) {
+	for _, d := range []string{"blobs", "manifests"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Store{dir: dir}, nil
+}
+
+// Path returns the path of the blob with digest, in either the "sha256:"
+// form of references or the "sha256-" form of blob names.
+func (s *Store) Path(digest string) (string, error) {
+	digest, err := manifest.ParseDigest(digest)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.dir, "blobs", strings.Replace(digest, ":", "-", 1)), nil
+}
+
+// Put writes the content of r to the store and returns its digest, in the
+// "sha256:" form, and size. Putting a blob the store has is a no-op.
+func (s *Store) Put(r io.Reader) (digest string, size int64, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, err := os.CreateTemp(filepath.Join(s.dir, "blobs"), tempPrefix)
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+	size, err = io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := f.Close(); err != nil {
+		return "", 0, err
+	}
+
+	digest = "sha256:" + hex.EncodeToString(h.Sum(nil))
+	path, err := s.Path(digest)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", 0, err
+	}
+
+	return digest, size, nil
+}
+
+// Open opens the blob with digest for reading.
+func (s *Store) Open(digest string) (*os.File, error) {
+	path, err := s.Path(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(path)
+}
+
+// Has reports whether the store has the blob with digest.
+func (s *Store) Has(digest string) bool {
+	path, err := s.Path(digest)
+	if err != nil {
+		return false
+	}
+
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+func (s *Store) manifestPath(name model.Name) (string, error) {
+	if !name.IsFullyQualified() {
+		return "", model.Unqualified(name)
+	}
+
+	return filepath.Join(s.dir, "manifests", name.Filepath()), nil
+}
+
+// PutManifest writes the manifest of name, replacing any previous one. Every
+// blob the manifest references must be in the store.
+func (s *Store) PutManifest(name model.Name, raw []byte) error {
+	path, err := s.manifestPath(name)
+	if err != nil {
+		return err
+	}
+
+	var m manifest.Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return err
+	}
+
+	for _, digest := range m.Digests() {
+		if !s.Has(digest) {
+			return fmt.Errorf("manifest references missing blob %s: %w", digest, fs.ErrNotExist)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), tempPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(raw); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// Manifest returns the manifest of name.
+func (s *Store) Manifest(name model.Name) ([]byte, error) {
+	path, err := s.manifestPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(path)
+}
+
+// DeleteManifest removes the manifest of name. Its blobs are left for GC, as
+// other manifests may reference them.
+func (s *Store) DeleteManifest(name model.Name) error {
+	path, err := s.manifestPath(name)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// References returns the digests of the blobs referenced by each manifest,
+// keyed by the canonical string of its name.
+func (s *Store) References() (map[string][]string, error) {
+	root := filepath.Join(s.dir, "manifests")
+	refs := make(map[string][]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), tempPrefix) {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		name := model.ParseNameFromFilepath(rel)
+		if !name.IsValid() {
+			return fmt.Errorf("%s: invalid manifest name", rel)
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var m manifest.Manifest
+		if err := json.Unmarshal(b, &m); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		refs[name.CanonicalString()] = m.Digests()
+		return nil
+	})
+
+	return refs, err
+}
+
+// GC removes the blobs no manifest references, and the temporary files of
+// interrupted writes, and returns the digests of the blobs it removed. It
+// removes nothing if a manifest cannot be read. Blobs put for a manifest
+// that is not written yet are removed too, so GC should not run while models
+// are being pulled or created.
+func (s *Store) GC() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refs, err := s.References()
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	for _, digests := range refs {
+		for _, digest := range digests {
+			path, err := s.Path(digest)
+			if err != nil {
+				return nil, err
+			}
+			used[path] = true
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(s.dir, "blobs"))
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	var errs []error
+	for _, e := range entries {
+		path := filepath.Join(s.dir, "blobs", e.Name())
+		if used[path] || e.IsDir() {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if digest, ok := strings.CutPrefix(e.Name(), "sha256-"); ok {
+			removed = append(removed, "sha256:"+digest)
+		}
+	}
+
+	return removed, errors.Join(errs...)
+}
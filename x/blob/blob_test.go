@@ -0,0 +1,197 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestStorePut(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest, size, err := s.Put(strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if digest != want || size != 5 {
+		t.Errorf("Put = %s, %d; want %s, 5", digest, size, want)
+	}
+
+	if !s.Has(digest) || !s.Has(strings.Replace(digest, ":", "-", 1)) {
+		t.Error("expected the store to have the blob")
+	}
+
+	f, err := s.Open(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Errorf("blob = %q; want %q", b, "hello")
+	}
+
+	// putting the same content again is a no-op
+	if again, _, err := s.Put(strings.NewReader("hello")); err != nil || again != digest {
+		t.Errorf("Put = %s, %v; want %s", again, err, digest)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(s.dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the blob, got %v", entries)
+	}
+}
+
+func TestStorePath(t *testing.T) {
+	s := &Store{dir: "models"}
+	for _, digest := range []string{"", "sha256:abc", "md5-" + strings.Repeat("a", 64), "sha256:" + strings.Repeat("A", 64)} {
+		if _, err := s.Path(digest); !errors.Is(err, ErrInvalidDigest) {
+			t.Errorf("Path(%q) err = %v; want %v", digest, err, ErrInvalidDigest)
+		}
+	}
+}
+
+func TestStoreManifest(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := model.ParseName("mistral")
+	raw := []byte(`{"config":{"digest":"sha256:` + strings.Repeat("0", 64) + `"},"layers":[]}`)
+	if err := s.PutManifest(name, raw); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("PutManifest err = %v; want %v", err, fs.ErrNotExist)
+	}
+
+	if err := s.PutManifest(model.ParseNameBare("mistral"), raw); !errors.Is(err, model.ErrUnqualifiedName) {
+		t.Errorf("PutManifest err = %v; want %v", err, model.ErrUnqualifiedName)
+	}
+
+	config, _, err := s.Put(strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw = manifestFor(config)
+	if err := s.PutManifest(name, raw); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Manifest(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(raw) {
+		t.Errorf("Manifest = %s; want %s", got, raw)
+	}
+
+	if err := s.DeleteManifest(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Manifest(name); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Manifest err = %v; want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestStoreGC(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(content string) string {
+		digest, _, err := s.Put(strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return digest
+	}
+
+	config, shared, unique, orphan := put("config"), put("shared"), put("unique"), put("orphan")
+	if err := s.PutManifest(model.ParseName("a"), manifestFor(config, shared)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutManifest(model.ParseName("b"), manifestFor(config, shared, unique)); err != nil {
+		t.Fatal(err)
+	}
+
+	// left behind by an interrupted write
+	if err := os.WriteFile(filepath.Join(s.dir, "blobs", tempPrefix+"123"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := s.References()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refs[model.ParseName("B").CanonicalString()]; !slices.Equal(got, []string{config, shared, unique}) {
+		t.Errorf("References = %v", refs)
+	}
+
+	removed, err := s.GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(removed, []string{orphan}) {
+		t.Errorf("GC removed %v; want %v", removed, []string{orphan})
+	}
+
+	if err := s.DeleteManifest(model.ParseName("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err = s.GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(removed, []string{unique}) {
+		t.Errorf("GC removed %v; want %v", removed, []string{unique})
+	}
+
+	for _, digest := range []string{config, shared} {
+		if !s.Has(digest) {
+			t.Errorf("GC removed %s which is still referenced", digest)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(s.dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected 2 blobs, got %v", entries)
+	}
+}
+
+func manifestFor(config string, layers ...string) []byte {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `{"schemaVersion":2,"config":{"digest":%q},"layers":[`, config)
+	for i, l := range layers {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, `{"digest":%q}`, l)
+	}
+	sb.WriteString("]}")
+	return []byte(sb.String())
+}
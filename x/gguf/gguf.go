@@ -0,0 +1,630 @@
+// Package gguf reads and writes the metadata of GGUF model files: the
+// key-values and the tensor index at the start of the file. Tensor data is
+// never loaded, so reading a file's metadata costs the same for a 70B model
+// as for a 1B one, and rewriting it copies the tensor data unchanged.
+//
+// Only little-endian files of version 2 and 3 are supported, which covers
+// every file written since GGUF replaced GGML.
+package gguf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+)
+
+// ErrUnsupported is returned when decoding a file that isn't GGUF or is a
+// version of it this package doesn't support.
+var ErrUnsupported = errors.New("gguf: unsupported file")
+
+const magic = "GGUF"
+
+// maxStringLen bounds the strings read, so that a corrupt length fails the
+// decode rather than an allocation
+const maxStringLen = 1 << 30
+
+// Type is the type of a metadata value or of the elements of an array.
+type Type uint32
+
+const (
+	TypeUint8 Type = iota
+	TypeInt8
+	TypeUint16
+	TypeInt16
+	TypeUint32
+	TypeInt32
+	TypeFloat32
+	TypeBool
+	TypeString
+	TypeArray
+	TypeUint64
+	TypeInt64
+	TypeFloat64
+)
+
+// size is the encoded size of a value of type t, or 0 if it varies.
+func (t Type) size() int {
+	switch t {
+	case TypeUint8, TypeInt8, TypeBool:
+		return 1
+	case TypeUint16, TypeInt16:
+		return 2
+	case TypeUint32, TypeInt32, TypeFloat32:
+		return 4
+	case TypeUint64, TypeInt64, TypeFloat64:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// Array is an array value. Its elements are kept encoded until Values is
+// called, so that arrays such as a tokenizer's vocabulary are cheap to read
+// and are written back byte for byte.
+type Array struct {
+	Type Type
+	Len  uint64
+
+	data []byte
+}
+
+// Values decodes the elements of a.
+func (a *Array) Values() ([]any, error) {
+	r := bytes.NewReader(a.data)
+	values := make([]any, a.Len)
+	for i := range values {
+		v, err := readValue(r, a.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = v
+	}
+
+	return values, nil
+}
+
+// KeyValue is a metadata key and its value: an integer, float, bool or
+// string of the Go type matching its [Type], or an [*Array].
+type KeyValue struct {
+	Key   string
+	Value any
+}
+
+// Tensor is an entry of the tensor index.
+type Tensor struct {
+	Name  string
+	Shape []uint64
+
+	// Type is the ggml type of the tensor's elements.
+	Type uint32
+
+	// Offset is the offset of the tensor's data from the start of the
+	// tensor data.
+	Offset uint64
+}
+
+// File is the metadata of a GGUF file.
+type File struct {
+	Version uint32
+	KV      []KeyValue
+	Tensors []Tensor
+
+	// DataOffset is the offset of the tensor data from the start of the
+	// file.
+	DataOffset int64
+}
+
+// Open decodes the metadata of the GGUF file at path.
+func Open(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Decode(f)
+}
+
+// Decode decodes the metadata at the start of the GGUF file read from r. r
+// is read through a buffer, so it may be read past the end of the metadata
+// but the tensor data is otherwise skipped.
+func Decode(r io.Reader) (*File, error) {
+	cr := &countingReader{r: bufio.NewReaderSize(r, 1<<20)}
+
+	var header struct {
+		Magic      [4]byte
+		Version    uint32
+		NumTensors uint64
+		NumKV      uint64
+	}
+
+	if err := binary.Read(cr, binary.LittleEndian, &header.Magic); err != nil {
+		return nil, err
+	}
+
+	if string(header.Magic[:]) != magic {
+		return nil, ErrUnsupported
+	}
+
+	if err := binary.Read(cr, binary.LittleEndian, &header.Version); err != nil {
+		return nil, err
+	}
+
+	if header.Version != 2 && header.Version != 3 {
+		return nil, fmt.Errorf("%w: version %d", ErrUnsupported, header.Version)
+	}
+
+	if err := binary.Read(cr, binary.LittleEndian, &header.NumTensors); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(cr, binary.LittleEndian, &header.NumKV); err != nil {
+		return nil, err
+	}
+
+	f := File{Version: header.Version}
+	for range header.NumKV {
+		k, err := readString(cr)
+		if err != nil {
+			return nil, err
+		}
+
+		var t Type
+		if err := binary.Read(cr, binary.LittleEndian, &t); err != nil {
+			return nil, err
+		}
+
+		v, err := readValue(cr, t)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+
+		f.KV = append(f.KV, KeyValue{k, v})
+	}
+
+	for range header.NumTensors {
+		var t Tensor
+		var err error
+		if t.Name, err = readString(cr); err != nil {
+			return nil, err
+		}
+
+		var dims uint32
+		if err := binary.Read(cr, binary.LittleEndian, &dims); err != nil {
+			return nil, err
+		}
+
+		t.Shape = make([]uint64, dims)
+		if err := binary.Read(cr, binary.LittleEndian, t.Shape); err != nil {
+			return nil, err
+		}
+
+		if err := binary.Read(cr, binary.LittleEndian, &t.Type); err != nil {
+			return nil, err
+		}
+
+		if err := binary.Read(cr, binary.LittleEndian, &t.Offset); err != nil {
+			return nil, err
+		}
+
+		f.Tensors = append(f.Tensors, t)
+	}
+
+	f.DataOffset = cr.n + padding(cr.n, f.Alignment())
+	return &f, nil
+}
+
+// Get returns the value of key.
+func (f *File) Get(key string) (any, bool) {
+	i := slices.IndexFunc(f.KV, func(kv KeyValue) bool { return kv.Key == key })
+	if i < 0 {
+		return nil, false
+	}
+
+	return f.KV[i].Value, true
+}
+
+// Set sets the value of key, adding it if it isn't set. The value must be
+// one [File.WriteTo] can encode.
+func (f *File) Set(key string, value any) {
+	i := slices.IndexFunc(f.KV, func(kv KeyValue) bool { return kv.Key == key })
+	if i < 0 {
+		f.KV = append(f.KV, KeyValue{key, value})
+		return
+	}
+
+	f.KV[i].Value = value
+}
+
+// Delete removes key.
+func (f *File) Delete(key string) {
+	f.KV = slices.DeleteFunc(f.KV, func(kv KeyValue) bool { return kv.Key == key })
+}
+
+// Uint returns the value of key if it's an unsigned integer.
+func (f *File) Uint(key string) (uint64, bool) {
+	v, _ := f.Get(key)
+	switch v := v.(type) {
+	case uint8:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// String returns the value of key if it's a string.
+func (f *File) String(key string) (string, bool) {
+	v, _ := f.Get(key)
+	s, ok := v.(string)
+	return s, ok
+}
+
+// Alignment is the alignment of the tensor data, 32 bytes unless set by
+// general.alignment.
+func (f *File) Alignment() int64 {
+	if n, ok := f.Uint("general.alignment"); ok && n > 0 {
+		return int64(n)
+	}
+
+	return 32
+}
+
+// Architecture is the model architecture, such as "llama".
+func (f *File) Architecture() string {
+	s, _ := f.String("general.architecture")
+	return s
+}
+
+// ContextLength is the context length the model was trained with, or 0 if
+// it isn't set.
+func (f *File) ContextLength() uint64 {
+	n, _ := f.Uint(f.Architecture() + ".context_length")
+	return n
+}
+
+// FileType is the general.file_type of the model, which names the
+// quantization of most of its tensors.
+func (f *File) FileType() (uint32, bool) {
+	n, ok := f.Uint("general.file_type")
+	return uint32(n), ok
+}
+
+// Parameters is the number of parameters in the model's tensors.
+func (f *File) Parameters() uint64 {
+	var n uint64
+	for _, t := range f.Tensors {
+		p := uint64(1)
+		for _, d := range t.Shape {
+			p *= d
+		}
+
+		n += p
+	}
+
+	return n
+}
+
+// WriteTo writes f as the header of a version 3 GGUF file, padded to where
+// its tensor data starts.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	var err error
+	write := func(v any) {
+		if err == nil {
+			err = binary.Write(cw, binary.LittleEndian, v)
+		}
+	}
+
+	write([]byte(magic))
+	write(uint32(3))
+	write(uint64(len(f.Tensors)))
+	write(uint64(len(f.KV)))
+
+	for _, kv := range f.KV {
+		write(uint64(len(kv.Key)))
+		write([]byte(kv.Key))
+		if err == nil {
+			err = writeValue(cw, kv.Key, kv.Value)
+		}
+	}
+
+	for _, t := range f.Tensors {
+		write(uint64(len(t.Name)))
+		write([]byte(t.Name))
+		write(uint32(len(t.Shape)))
+		write(t.Shape)
+		write(t.Type)
+		write(t.Offset)
+	}
+
+	write(make([]byte, padding(cw.n, f.Alignment())))
+	if err != nil {
+		return cw.n, err
+	}
+
+	return cw.n, cw.w.(*bufio.Writer).Flush()
+}
+
+// Rewrite copies the GGUF file src to dst with its metadata changed by fn.
+// The tensor data is copied unchanged, so fn may change the key-values but
+// not the tensors or the alignment.
+func Rewrite(dst io.Writer, src io.ReadSeeker, fn func(*File) error) error {
+	f, err := Decode(src)
+	if err != nil {
+		return err
+	}
+
+	alignment, tensors := f.Alignment(), slices.Clone(f.Tensors)
+	if err := fn(f); err != nil {
+		return err
+	}
+
+	if f.Alignment() != alignment || !slices.EqualFunc(f.Tensors, tensors, func(a, b Tensor) bool {
+		return a.Name == b.Name && a.Type == b.Type && a.Offset == b.Offset && slices.Equal(a.Shape, b.Shape)
+	}) {
+		return errors.New("gguf: rewrite can't change the tensors or alignment")
+	}
+
+	if _, err := f.WriteTo(dst); err != nil {
+		return err
+	}
+
+	if _, err := src.Seek(f.DataOffset, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func readString(r io.Reader) (string, error) {
+	var n uint64
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return "", err
+	}
+
+	if n > maxStringLen {
+		return "", fmt.Errorf("gguf: string length %d too long", n)
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func readValue(r io.Reader, t Type) (any, error) {
+	var v any
+	switch t {
+	case TypeUint8:
+		v = new(uint8)
+	case TypeInt8:
+		v = new(int8)
+	case TypeUint16:
+		v = new(uint16)
+	case TypeInt16:
+		v = new(int16)
+	case TypeUint32:
+		v = new(uint32)
+	case TypeInt32:
+		v = new(int32)
+	case TypeUint64:
+		v = new(uint64)
+	case TypeInt64:
+		v = new(int64)
+	case TypeFloat32:
+		v = new(float32)
+	case TypeFloat64:
+		v = new(float64)
+	case TypeBool:
+		v = new(bool)
+	case TypeString:
+		return readString(r)
+	case TypeArray:
+		return readArray(r)
+	default:
+		return nil, fmt.Errorf("gguf: invalid type %d", t)
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+		return nil, err
+	}
+
+	switch v := v.(type) {
+	case *uint8:
+		return *v, nil
+	case *int8:
+		return *v, nil
+	case *uint16:
+		return *v, nil
+	case *int16:
+		return *v, nil
+	case *uint32:
+		return *v, nil
+	case *int32:
+		return *v, nil
+	case *uint64:
+		return *v, nil
+	case *int64:
+		return *v, nil
+	case *float32:
+		return *v, nil
+	case *float64:
+		return *v, nil
+	default:
+		return *v.(*bool), nil
+	}
+}
+
+// readArray reads an array, keeping its elements encoded.
+func readArray(r io.Reader) (*Array, error) {
+	var a Array
+	if err := binary.Read(r, binary.LittleEndian, &a.Type); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &a.Len); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	switch size := a.Type.size(); {
+	case size > 0:
+		if a.Len > math.MaxInt64/uint64(size) {
+			return nil, fmt.Errorf("gguf: array length %d too long", a.Len)
+		}
+
+		if _, err := io.CopyN(&b, r, int64(a.Len)*int64(size)); err != nil {
+			return nil, err
+		}
+	case a.Type == TypeString:
+		for range a.Len {
+			var n uint64
+			if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+				return nil, err
+			}
+
+			if n > maxStringLen {
+				return nil, fmt.Errorf("gguf: string length %d too long", n)
+			}
+
+			binary.Write(&b, binary.LittleEndian, n)
+			if _, err := io.CopyN(&b, r, int64(n)); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		// arrays of arrays aren't used by any model
+		return nil, fmt.Errorf("gguf: invalid array type %d", a.Type)
+	}
+
+	a.data = b.Bytes()
+	return &a, nil
+}
+
+func writeValue(w io.Writer, key string, v any) error {
+	var t Type
+	switch v := v.(type) {
+	case uint8:
+		t = TypeUint8
+	case int8:
+		t = TypeInt8
+	case uint16:
+		t = TypeUint16
+	case int16:
+		t = TypeInt16
+	case uint32:
+		t = TypeUint32
+	case int32:
+		t = TypeInt32
+	case uint64:
+		t = TypeUint64
+	case int64:
+		t = TypeInt64
+	case float32:
+		t = TypeFloat32
+	case float64:
+		t = TypeFloat64
+	case bool:
+		t = TypeBool
+	case string:
+		if err := binary.Write(w, binary.LittleEndian, TypeString); err != nil {
+			return err
+		}
+
+		return writeString(w, v)
+	case *Array:
+		if err := binary.Write(w, binary.LittleEndian, TypeArray); err != nil {
+			return err
+		}
+
+		if err := binary.Write(w, binary.LittleEndian, v.Type); err != nil {
+			return err
+		}
+
+		if err := binary.Write(w, binary.LittleEndian, v.Len); err != nil {
+			return err
+		}
+
+		_, err := w.Write(v.data)
+		return err
+	case []string:
+		var b bytes.Buffer
+		for _, s := range v {
+			writeString(&b, s)
+		}
+
+		return writeValue(w, key, &Array{Type: TypeString, Len: uint64(len(v)), data: b.Bytes()})
+	case []int32:
+		return writeValue(w, key, newArray(TypeInt32, v))
+	case []uint32:
+		return writeValue(w, key, newArray(TypeUint32, v))
+	case []float32:
+		return writeValue(w, key, newArray(TypeFloat32, v))
+	default:
+		return fmt.Errorf("gguf: %s: can't encode %T", key, v)
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, t); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.LittleEndian, v)
+}
+
+func newArray[E int32 | uint32 | float32](t Type, s []E) *Array {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, s)
+	return &Array{Type: t, Len: uint64(len(s)), data: b.Bytes()}
+}
+
+func writeString(w io.Writer, s string) error {
+	if err := binary.Write(w, binary.LittleEndian, uint64(len(s))); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+func padding(offset, alignment int64) int64 {
+	return (alignment - offset%alignment) % alignment
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
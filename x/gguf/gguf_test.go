@@ -0,0 +1,163 @@
+package gguf
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testFile returns a GGUF file with some metadata and two tensors, and its
+// tensor data.
+func testFile(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+
+	f := File{
+		KV: []KeyValue{
+			{"general.architecture", "llama"},
+			{"general.file_type", uint32(15)},
+			{"llama.context_length", uint32(8192)},
+			{"llama.rope.freq_base", float32(500000)},
+			{"tokenizer.ggml.tokens", []string{"<s>", "</s>", "hello"}},
+			{"tokenizer.ggml.scores", []float32{0, 0, -1.5}},
+			{"tokenizer.chat_template", "{{ messages }}"},
+		},
+		Tensors: []Tensor{
+			{Name: "token_embd.weight", Shape: []uint64{4, 3}, Type: 0, Offset: 0},
+			{Name: "output_norm.weight", Shape: []uint64{4}, Type: 0, Offset: 64},
+		},
+	}
+
+	var b bytes.Buffer
+	if _, err := f.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Len()%32 != 0 {
+		t.Fatalf("expected the header to be padded to 32 bytes, got %d", b.Len())
+	}
+
+	data := bytes.Repeat([]byte{1, 2, 3, 4}, 20)
+	b.Write(data)
+	return b.Bytes(), data
+}
+
+func TestDecode(t *testing.T) {
+	b, data := testFile(t)
+
+	f, err := Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Architecture() != "llama" {
+		t.Errorf("expected architecture llama, got %q", f.Architecture())
+	}
+
+	if f.ContextLength() != 8192 {
+		t.Errorf("expected context length 8192, got %d", f.ContextLength())
+	}
+
+	if ft, ok := f.FileType(); !ok || ft != 15 {
+		t.Errorf("expected file type 15, got %d", ft)
+	}
+
+	if f.Parameters() != 16 {
+		t.Errorf("expected 16 parameters, got %d", f.Parameters())
+	}
+
+	if got := b[f.DataOffset:]; !bytes.Equal(got, data) {
+		t.Errorf("expected tensor data at offset %d", f.DataOffset)
+	}
+
+	v, _ := f.Get("tokenizer.ggml.tokens")
+	tokens, err := v.(*Array).Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]any{"<s>", "</s>", "hello"}, tokens); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	v, _ = f.Get("tokenizer.ggml.scores")
+	scores, err := v.(*Array).Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]any{float32(0), float32(0), float32(-1.5)}, scores); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecodeUnsupported(t *testing.T) {
+	cases := map[string][]byte{
+		"ggml":      []byte("lmgg\x00\x00\x00\x00"),
+		"version 1": []byte("GGUF\x01\x00\x00\x00"),
+	}
+
+	for name, b := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Decode(bytes.NewReader(b)); !errors.Is(err, ErrUnsupported) {
+				t.Errorf("expected ErrUnsupported, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	b, data := testFile(t)
+
+	var out bytes.Buffer
+	if err := Rewrite(&out, bytes.NewReader(b), func(f *File) error {
+		f.Set("tokenizer.chat_template", strings.Repeat("{{ .Prompt }}", 10))
+		f.Set("general.name", "test")
+		f.Delete("llama.rope.freq_base")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Decode(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	for _, kv := range f.KV {
+		keys = append(keys, kv.Key)
+	}
+
+	want := []string{
+		"general.architecture",
+		"general.file_type",
+		"llama.context_length",
+		"tokenizer.ggml.tokens",
+		"tokenizer.ggml.scores",
+		"tokenizer.chat_template",
+		"general.name",
+	}
+
+	if diff := cmp.Diff(want, keys); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if s, _ := f.String("tokenizer.chat_template"); s != strings.Repeat("{{ .Prompt }}", 10) {
+		t.Errorf("expected the chat template to be updated, got %q", s)
+	}
+
+	if got := out.Bytes()[f.DataOffset:]; !bytes.Equal(got, data) {
+		t.Error("expected the tensor data to be copied unchanged")
+	}
+
+	// the tensors can't be changed since their data is copied as is
+	if err := Rewrite(&out, bytes.NewReader(b), func(f *File) error {
+		f.Tensors = f.Tensors[:1]
+		return nil
+	}); err == nil {
+		t.Error("expected an error changing the tensors")
+	}
+}
@@ -0,0 +1,283 @@
+// Package manifest reads and writes the manifests of models in the local
+// model store, where the manifest of a name is kept at
+//
+//	<dir>/<host>/<namespace>/<model>/<tag>
+//
+// and indexes them so the names that reference a blob can be found, as when
+// deciding whether removing a model leaves one of its layers unused.
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/types/model"
+)
+
+// Media types of manifests and of the layers of models.
+const (
+	MediaTypeManifest  = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeConfig    = "application/vnd.docker.container.image.v1+json"
+	MediaTypeModel     = "application/vnd.ollama.image.model"
+	MediaTypeAdapter   = "application/vnd.ollama.image.adapter"
+	MediaTypeProjector = "application/vnd.ollama.image.projector"
+	MediaTypeTemplate  = "application/vnd.ollama.image.template"
+	MediaTypeSystem    = "application/vnd.ollama.image.system"
+	MediaTypeParams    = "application/vnd.ollama.image.params"
+	MediaTypeMessages  = "application/vnd.ollama.image.messages"
+	MediaTypeLicense   = "application/vnd.ollama.image.license"
+)
+
+// Layer references a blob of a model.
+type Layer struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	From      string `json:"from,omitempty"`
+}
+
+// Manifest lists the config and layers of a model.
+type Manifest struct {
+	SchemaVersion int     `json:"schemaVersion"`
+	MediaType     string  `json:"mediaType"`
+	Config        Layer   `json:"config"`
+	Layers        []Layer `json:"layers"`
+}
+
+// ParseDigest returns digest, in either the "sha256:" form of references or
+// the "sha256-" form of blob names, in the "sha256:" form, or
+// [model.ErrInvalidDigest] if it is not a sha256 digest.
+func ParseDigest(digest string) (string, error) {
+	hex, ok := strings.CutPrefix(digest, "sha256:")
+	if !ok {
+		hex, ok = strings.CutPrefix(digest, "sha256-")
+	}
+
+	if !ok || len(hex) != 64 || strings.Trim(hex, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("%q: %w", digest, model.ErrInvalidDigest)
+	}
+
+	return "sha256:" + hex, nil
+}
+
+// Load reads the manifest of name from the manifests directory dir.
+func Load(dir string, name model.Name) (*Manifest, error) {
+	if !name.IsFullyQualified() {
+		return nil, model.Unqualified(name)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, name.Filepath()))
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return &m, nil
+}
+
+// Save writes m as the manifest of name in the manifests directory dir,
+// replacing any previous one. The manifest is written to a temporary file
+// first so readers never see a partial manifest.
+func (m *Manifest) Save(dir string, name model.Name) error {
+	if !name.IsFullyQualified() {
+		return model.Unqualified(name)
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, name.Filepath())
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// LayersOf returns the layers of m with mediaType, in order.
+func (m *Manifest) LayersOf(mediaType string) []Layer {
+	var layers []Layer
+	for _, l := range m.Layers {
+		if l.MediaType == mediaType {
+			layers = append(layers, l)
+		}
+	}
+
+	return layers
+}
+
+// layerOf returns the last layer of m with mediaType, which is the one that
+// applies when a model has several.
+func (m *Manifest) layerOf(mediaType string) (Layer, bool) {
+	layers := m.LayersOf(mediaType)
+	if len(layers) == 0 {
+		return Layer{}, false
+	}
+
+	return layers[len(layers)-1], true
+}
+
+// Model returns the layer of the model weights.
+func (m *Manifest) Model() (Layer, bool) { return m.layerOf(MediaTypeModel) }
+
+// Template returns the layer of the prompt template.
+func (m *Manifest) Template() (Layer, bool) { return m.layerOf(MediaTypeTemplate) }
+
+// System returns the layer of the system message.
+func (m *Manifest) System() (Layer, bool) { return m.layerOf(MediaTypeSystem) }
+
+// Params returns the layer of the parameters.
+func (m *Manifest) Params() (Layer, bool) { return m.layerOf(MediaTypeParams) }
+
+// Licenses returns the layers of the licenses, of which a model may have
+// several.
+func (m *Manifest) Licenses() []Layer { return m.LayersOf(MediaTypeLicense) }
+
+// Digests returns the digests of the config and layers of m.
+func (m *Manifest) Digests() []string {
+	digests := []string{m.Config.Digest}
+	for _, l := range m.Layers {
+		digests = append(digests, l.Digest)
+	}
+
+	return digests
+}
+
+// Index maps the digests of blobs to the names of the manifests that
+// reference them. Digests may be in either the "sha256:" or the "sha256-"
+// form and are returned in the "sha256:" form. It is not safe for
+// concurrent use.
+type Index struct {
+	names     map[string][]model.Name
+	manifests map[string]*Manifest
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{
+		names:     make(map[string][]model.Name),
+		manifests: make(map[string]*Manifest),
+	}
+}
+
+// BuildIndex indexes the manifests in the manifests directory dir. A manifest
+// that cannot be read is an error, as the blobs it references would appear
+// unused.
+func BuildIndex(dir string) (*Index, error) {
+	ix := NewIndex()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == dir {
+			return filepath.SkipAll
+		} else if err != nil || d.IsDir() || d.Name()[0] == '.' {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		name := model.ParseNameFromFilepath(rel)
+		if !name.IsValid() {
+			return fmt.Errorf("%s: invalid manifest name", rel)
+		}
+
+		m, err := Load(dir, name)
+		if err != nil {
+			return err
+		}
+
+		ix.Add(name, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ix, nil
+}
+
+// Add indexes m as the manifest of name, replacing any manifest previously
+// indexed for it.
+func (ix *Index) Add(name model.Name, m *Manifest) {
+	ix.Remove(name)
+	ix.manifests[name.CanonicalString()] = m
+	for _, digest := range m.Digests() {
+		digest = indexDigest(digest)
+		if !slices.ContainsFunc(ix.names[digest], name.EqualFold) {
+			ix.names[digest] = append(ix.names[digest], name)
+		}
+	}
+}
+
+// Remove removes the manifest of name from the index and returns the digests
+// of its blobs that no other manifest references, which may be deleted.
+func (ix *Index) Remove(name model.Name) []string {
+	m, ok := ix.manifests[name.CanonicalString()]
+	if !ok {
+		return nil
+	}
+	delete(ix.manifests, name.CanonicalString())
+
+	var unused []string
+	for _, digest := range m.Digests() {
+		digest = indexDigest(digest)
+		names := slices.DeleteFunc(ix.names[digest], name.EqualFold)
+		if len(names) > 0 {
+			ix.names[digest] = names
+		} else if _, ok := ix.names[digest]; ok {
+			delete(ix.names, digest)
+			unused = append(unused, digest)
+		}
+	}
+
+	return unused
+}
+
+// Names returns the names of the manifests that reference the blob with
+// digest.
+func (ix *Index) Names(digest string) []model.Name {
+	return slices.Clone(ix.names[indexDigest(digest)])
+}
+
+// Referenced reports whether any manifest references the blob with digest.
+func (ix *Index) Referenced(digest string) bool {
+	return len(ix.names[indexDigest(digest)]) > 0
+}
+
+// indexDigest returns digest in the "sha256:" form, or as it is if it is
+// not a valid digest, so that both forms find the same blob.
+func indexDigest(digest string) string {
+	if d, err := ParseDigest(digest); err == nil {
+		return d
+	}
+
+	return digest
+}
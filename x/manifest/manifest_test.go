@@ -0,0 +1,165 @@
+package manifest
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/types/model"
+)
+
+func digest(c byte) string {
+	b := make([]byte, 64)
+	for i := range b {
+		b[i] = c
+	}
+	return "sha256:" + string(b)
+}
+
+func TestLoadSave(t *testing.T) {
+	dir := t.TempDir()
+	name := model.ParseName("llama3.2")
+
+	m := &Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifest,
+		Config:        Layer{MediaType: MediaTypeConfig, Digest: digest('0'), Size: 1},
+		Layers: []Layer{
+			{MediaType: MediaTypeModel, Digest: digest('1'), Size: 10},
+			{MediaType: MediaTypeTemplate, Digest: digest('2'), Size: 2},
+			{MediaType: MediaTypeLicense, Digest: digest('3'), Size: 3},
+			{MediaType: MediaTypeLicense, Digest: digest('4'), Size: 4},
+			{MediaType: MediaTypeTemplate, Digest: digest('5'), Size: 5},
+		},
+	}
+
+	if err := m.Save(dir, name); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Load(dir, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l, ok := got.Model(); !ok || l.Digest != digest('1') {
+		t.Errorf("Model() = %v, %v", l, ok)
+	}
+	if l, ok := got.Template(); !ok || l.Digest != digest('5') {
+		t.Errorf("Template() = %v, %v; want the last template", l, ok)
+	}
+	if _, ok := got.System(); ok {
+		t.Error("System() = true; want false")
+	}
+	if licenses := got.Licenses(); len(licenses) != 2 || licenses[0].Digest != digest('3') {
+		t.Errorf("Licenses() = %v", licenses)
+	}
+	if want := []string{digest('0'), digest('1'), digest('2'), digest('3'), digest('4'), digest('5')}; !slices.Equal(got.Digests(), want) {
+		t.Errorf("Digests() = %v; want %v", got.Digests(), want)
+	}
+
+	if _, err := Load(dir, model.ParseName("missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Load err = %v; want %v", err, fs.ErrNotExist)
+	}
+	if err := m.Save(dir, model.ParseNameBare("llama3.2")); !errors.Is(err, model.ErrUnqualifiedName) {
+		t.Errorf("Save err = %v; want %v", err, model.ErrUnqualifiedName)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	dir := t.TempDir()
+
+	base := &Manifest{
+		Config: Layer{Digest: digest('0')},
+		Layers: []Layer{{MediaType: MediaTypeModel, Digest: digest('1')}},
+	}
+	derived := &Manifest{
+		Config: Layer{Digest: digest('2')},
+		Layers: []Layer{
+			{MediaType: MediaTypeModel, Digest: digest('1')},
+			{MediaType: MediaTypeSystem, Digest: digest('3')},
+		},
+	}
+
+	a, b := model.ParseName("base"), model.ParseName("example.com/me/derived:v1")
+	if err := base.Save(dir, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := derived.Save(dir, b); err != nil {
+		t.Fatal(err)
+	}
+
+	ix, err := BuildIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := ix.Names(digest('1')); len(names) != 2 {
+		t.Errorf("Names(%s) = %v; want both models", digest('1'), names)
+	}
+	if names := ix.Names(digest('3')); len(names) != 1 || !names[0].EqualFold(b) {
+		t.Errorf("Names(%s) = %v; want %v", digest('3'), names, b)
+	}
+
+	// blob names find the same manifests as references
+	if blobName := strings.Replace(digest('1'), ":", "-", 1); len(ix.Names(blobName)) != 2 || !ix.Referenced(blobName) {
+		t.Errorf("Names(%s) = %v; want both models", blobName, ix.Names(blobName))
+	}
+
+	// removing the derived model leaves the shared weights
+	unused := ix.Remove(model.ParseName("EXAMPLE.com/me/derived:V1"))
+	slices.Sort(unused)
+	if want := []string{digest('2'), digest('3')}; !slices.Equal(unused, want) {
+		t.Errorf("Remove = %v; want %v", unused, want)
+	}
+	if !ix.Referenced(digest('1')) || ix.Referenced(digest('3')) {
+		t.Error("unexpected references after Remove")
+	}
+
+	if unused := ix.Remove(b); unused != nil {
+		t.Errorf("Remove of a removed name = %v; want nil", unused)
+	}
+
+	// re-adding a manifest replaces its references
+	ix.Add(a, derived)
+	if ix.Referenced(digest('0')) || !ix.Referenced(digest('3')) {
+		t.Error("Add did not replace the previous manifest")
+	}
+}
+
+func TestBuildIndexInvalid(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := BuildIndex(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("BuildIndex of a missing directory: %v", err)
+	}
+
+	path := filepath.Join(dir, model.ParseName("broken").Filepath())
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := BuildIndex(dir); err == nil {
+		t.Error("expected an error for a corrupt manifest")
+	}
+}
+
+func TestParseDigest(t *testing.T) {
+	for _, d := range []string{digest('a'), strings.Replace(digest('a'), ":", "-", 1)} {
+		if got, err := ParseDigest(d); err != nil || got != digest('a') {
+			t.Errorf("ParseDigest(%q) = %q, %v; want %q", d, got, err, digest('a'))
+		}
+	}
+
+	for _, d := range []string{"", "sha256:abc", "sha512:" + strings.Repeat("a", 64), "sha256:" + strings.Repeat("A", 64)} {
+		if _, err := ParseDigest(d); !errors.Is(err, model.ErrInvalidDigest) {
+			t.Errorf("ParseDigest(%q) = %v; want %v", d, err, model.ErrInvalidDigest)
+		}
+	}
+}
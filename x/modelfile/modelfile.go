@@ -0,0 +1,301 @@
+// Package modelfile parses Modelfiles into a typed syntax tree and formats
+// them back, for tools that lint, rewrite or generate Modelfiles.
+//
+// A Modelfile is a list of directives, one per node of a [File], and
+// comments:
+//
+//	# comment
+//	FROM llama3.2
+//	PARAMETER temperature 0.7
+//	SYSTEM """You are a helpful assistant."""
+//
+// Parsing is done by the same parser as ollama create, so a File describes
+// exactly what the server will see.
+package modelfile
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/parser"
+)
+
+// Pos is a position in a Modelfile. Line and Column start at 1, and Column
+// counts runes rather than bytes.
+type Pos = parser.Pos
+
+// Error is an error at a position of a Modelfile.
+type Error = parser.ParserError
+
+// Errors is the list of errors found parsing a Modelfile, in order of their
+// position.
+type Errors = parser.ParserErrors
+
+// Node is a node of a [File]: a [*Comment] or one of the directives, such
+// as [*From] or [*Parameter].
+type Node interface {
+	// Pos is the position of the first character of the node, the zero
+	// Pos for a node that was not parsed.
+	Pos() Pos
+
+	end() int
+}
+
+// Comment is a comment on a line of its own, or following a directive.
+type Comment struct {
+	Position Pos
+	// Text is the comment without the leading "#".
+	Text string
+}
+
+func (c *Comment) Pos() Pos { return c.Position }
+func (c *Comment) end() int { return c.Position.Line }
+
+// Directive holds the fields common to all directives.
+type Directive struct {
+	Position Pos
+	// End is the last line of the directive, or 0 if it was not parsed.
+	End int
+	// Comment follows the directive on its last line, if any.
+	Comment *Comment
+}
+
+func (d *Directive) Pos() Pos { return d.Position }
+func (d *Directive) end() int { return d.End }
+
+// From is the model, GGUF file or Safetensors directory a model is built
+// from.
+type From struct {
+	Directive
+	Model string
+}
+
+// Parameter sets a parameter the model runs with, such as temperature.
+type Parameter struct {
+	Directive
+	Name  string
+	Value string
+}
+
+// Template is the prompt template of the model.
+type Template struct {
+	Directive
+	Text string
+}
+
+// System is the default system message of the model.
+type System struct {
+	Directive
+	Text string
+}
+
+// Adapter is a LoRA adapter applied to the model.
+type Adapter struct {
+	Directive
+	Path string
+}
+
+// Tokenizer replaces the tokenizer of the model with an external one.
+type Tokenizer struct {
+	Directive
+	Path string
+}
+
+// Quantize is the level the model is quantized to when it is created.
+type Quantize struct {
+	Directive
+	Type string
+}
+
+// License is a license the model is distributed under.
+type License struct {
+	Directive
+	Text string
+}
+
+// Message is a message of the conversation history of the model.
+type Message struct {
+	Directive
+	// Role is "system", "user" or "assistant".
+	Role    string
+	Content string
+}
+
+// Profile sets a parameter of a named parameter profile.
+type Profile struct {
+	Directive
+	Profile string
+	Name    string
+	Value   string
+}
+
+// Router makes the model a router, which dispatches requests to the models
+// of its routes by classifying the prompt with Classifier.
+type Router struct {
+	Directive
+	Classifier string
+}
+
+// Route is the model a router dispatches requests classified as Label to.
+type Route struct {
+	Directive
+	Label string
+	Model string
+}
+
+// File is the syntax tree of a Modelfile.
+type File struct {
+	Nodes []Node
+}
+
+// Parse parses the Modelfile read from r. Parsing continues past errors, so
+// that all of them are reported at once as [Errors] along with the nodes
+// that could be parsed. Unlike ollama create, Parse does not require a FROM.
+func Parse(r io.Reader) (*File, error) {
+	pf, err := parser.Parse(r)
+	if pf == nil {
+		return nil, err
+	}
+
+	var f File
+	var errs Errors
+	for _, n := range pf.Nodes {
+		switch n := n.(type) {
+		case *parser.Comment:
+			f.Nodes = append(f.Nodes, &Comment{Position: n.Position, Text: n.Text})
+		case *parser.Directive:
+			node, err := fromDirective(n)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			f.Nodes = append(f.Nodes, node)
+		}
+	}
+
+	// report unknown commands along with the errors of the parser
+	var perrs Errors
+	if len(errs) > 0 && (err == nil || errors.As(err, &perrs)) {
+		errs = append(perrs, errs...)
+		slices.SortStableFunc(errs, func(a, b *Error) int {
+			return cmp.Or(cmp.Compare(a.LineNumber, b.LineNumber), cmp.Compare(a.Column, b.Column))
+		})
+		err = errs
+	}
+
+	return &f, err
+}
+
+// fromDirective returns the node of a parsed directive, or an error for a
+// command this package does not know.
+func fromDirective(pd *parser.Directive) (Node, *Error) {
+	d := Directive{Position: pd.Position, End: pd.EndLine()}
+	if pd.Comment != nil {
+		d.Comment = &Comment{Position: pd.Comment.Position, Text: pd.Comment.Text}
+	}
+
+	text := pd.Value.Text
+	switch strings.ToLower(pd.Keyword) {
+	case "from":
+		return &From{Directive: d, Model: text}, nil
+	case "parameter":
+		return &Parameter{Directive: d, Name: pd.Args[0], Value: text}, nil
+	case "template":
+		return &Template{Directive: d, Text: text}, nil
+	case "system":
+		return &System{Directive: d, Text: text}, nil
+	case "adapter":
+		return &Adapter{Directive: d, Path: text}, nil
+	case "tokenizer":
+		return &Tokenizer{Directive: d, Path: text}, nil
+	case "quantize":
+		return &Quantize{Directive: d, Type: text}, nil
+	case "license":
+		return &License{Directive: d, Text: text}, nil
+	case "message":
+		return &Message{Directive: d, Role: pd.Args[0], Content: text}, nil
+	case "profile":
+		return &Profile{Directive: d, Profile: pd.Args[0], Name: pd.Args[1], Value: text}, nil
+	case "router":
+		return &Router{Directive: d, Classifier: text}, nil
+	case "route":
+		label, model, _ := strings.Cut(text, " ")
+		return &Route{Directive: d, Label: label, Model: strings.TrimSpace(model)}, nil
+	default:
+		return nil, &Error{LineNumber: pd.Position.Line, Column: pd.Position.Column, Msg: fmt.Sprintf("unknown command %q", pd.Keyword)}
+	}
+}
+
+// Format prints f as a canonical Modelfile: commands are uppercase and
+// separated from their arguments by single spaces, comments are kept, and
+// runs of blank lines between parsed nodes are collapsed into one. Values
+// are quoted only where needed for them to parse back unchanged. Nodes of
+// types this package does not define are an error.
+func Format(f *File) (string, error) {
+	var pf parser.File
+	for _, n := range f.Nodes {
+		switch n := n.(type) {
+		case *Comment:
+			pf.Nodes = append(pf.Nodes, &parser.Comment{Position: n.Position, Text: n.Text})
+		default:
+			d, err := toDirective(n)
+			if err != nil {
+				return "", err
+			}
+			pf.Nodes = append(pf.Nodes, d)
+		}
+	}
+
+	return parser.FormatModelfile(&pf), nil
+}
+
+func toDirective(n Node) (*parser.Directive, error) {
+	var d *Directive
+	var keyword, text string
+	var args []string
+	switch n := n.(type) {
+	case *From:
+		d, keyword, text = &n.Directive, "FROM", n.Model
+	case *Parameter:
+		d, keyword, args, text = &n.Directive, "PARAMETER", []string{n.Name}, n.Value
+	case *Template:
+		d, keyword, text = &n.Directive, "TEMPLATE", n.Text
+	case *System:
+		d, keyword, text = &n.Directive, "SYSTEM", n.Text
+	case *Adapter:
+		d, keyword, text = &n.Directive, "ADAPTER", n.Path
+	case *Tokenizer:
+		d, keyword, text = &n.Directive, "TOKENIZER", n.Path
+	case *Quantize:
+		d, keyword, text = &n.Directive, "QUANTIZE", n.Type
+	case *License:
+		d, keyword, text = &n.Directive, "LICENSE", n.Text
+	case *Message:
+		d, keyword, args, text = &n.Directive, "MESSAGE", []string{n.Role}, n.Content
+	case *Profile:
+		d, keyword, args, text = &n.Directive, "PROFILE", []string{n.Profile, n.Name}, n.Value
+	case *Router:
+		d, keyword, text = &n.Directive, "ROUTER", n.Classifier
+	case *Route:
+		d, keyword, text = &n.Directive, "ROUTE", n.Label+" "+n.Model
+	default:
+		return nil, fmt.Errorf("modelfile: unknown node %T", n)
+	}
+
+	pd := &parser.Directive{
+		Position: d.Position,
+		Keyword:  keyword,
+		Args:     args,
+		Value:    parser.Value{Text: text, EndLine: d.End},
+	}
+
+	if d.Comment != nil {
+		pd.Comment = &parser.Comment{Position: d.Comment.Position, Text: d.Comment.Text}
+	}
+
+	return pd, nil
+}
@@ -0,0 +1,154 @@
+package modelfile
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	input := `# a model
+FROM llama3.2
+parameter temperature 0.7
+PARAMETER stop "<|end|>" # end of turn
+
+SYSTEM """You are
+a helpful assistant."""
+MESSAGE user Hi
+QUANTIZE q4_K_M
+PROFILE precise seed 42
+`
+
+	f, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Node{
+		&Comment{Position: Pos{Line: 1, Column: 1}, Text: " a model"},
+		&From{Directive: Directive{Position: Pos{Line: 2, Column: 1}, End: 2}, Model: "llama3.2"},
+		&Parameter{Directive: Directive{Position: Pos{Line: 3, Column: 1}, End: 3}, Name: "temperature", Value: "0.7"},
+		&Parameter{
+			Directive: Directive{Position: Pos{Line: 4, Column: 1}, End: 4, Comment: &Comment{Position: Pos{Line: 4, Column: 26}, Text: " end of turn"}},
+			Name:      "stop",
+			Value:     "<|end|>",
+		},
+		&System{Directive: Directive{Position: Pos{Line: 6, Column: 1}, End: 7}, Text: "You are\na helpful assistant."},
+		&Message{Directive: Directive{Position: Pos{Line: 8, Column: 1}, End: 8}, Role: "user", Content: "Hi"},
+		&Quantize{Directive: Directive{Position: Pos{Line: 9, Column: 1}, End: 9}, Type: "q4_K_M"},
+		&Profile{Directive: Directive{Position: Pos{Line: 10, Column: 1}, End: 10}, Profile: "precise", Name: "seed", Value: "42"},
+	}
+
+	if diff := cmp.Diff(want, f.Nodes); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	f, err := Parse(strings.NewReader("FROM llama3.2\nBOGUS value\nSYSTEM \"\"\"unterminated\n"))
+
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", err)
+	}
+
+	if errs[0].LineNumber != 2 || errs[0].Column != 1 {
+		t.Errorf("expected an error at 2:1, got %v", errs[0])
+	}
+
+	if errs[1].LineNumber != 3 || !errors.Is(errs[1], io.ErrUnexpectedEOF) {
+		t.Errorf("expected an unexpected EOF error on line 3, got %v", errs[1])
+	}
+
+	// the nodes before the errors are still returned
+	if len(f.Nodes) != 1 {
+		t.Errorf("expected 1 node, got %d", len(f.Nodes))
+	}
+}
+
+func TestFormat(t *testing.T) {
+	input := `# a model
+from llama3.2
+parameter   temperature 0.7
+
+
+SYSTEM """You are
+a helpful assistant.""" # default
+ROUTE chat llama3.2
+`
+
+	f, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# a model
+FROM llama3.2
+PARAMETER temperature 0.7
+
+SYSTEM """You are
+a helpful assistant.""" # default
+ROUTE chat llama3.2
+`
+
+	if diff := cmp.Diff(want, format(t, f)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// nodes built by hand have no positions and are printed one per line
+	f = &File{Nodes: []Node{
+		&From{Model: "./model.gguf"},
+		&Template{Text: "{{ .Prompt }}"},
+		&License{Text: " MIT "},
+		&Message{Role: "assistant", Content: "say\n\"\"\"hi\"\"\""},
+	}}
+
+	want = `FROM ./model.gguf
+TEMPLATE {{ .Prompt }}
+LICENSE """ MIT """
+MESSAGE assistant <<EOF
+say
+"""hi"""
+EOF
+`
+
+	if diff := cmp.Diff(want, format(t, f)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// the output parses back to the same values
+	g, err := Parse(strings.NewReader(format(t, f)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := g.Nodes[3].(*Message).Content; got != "say\n\"\"\"hi\"\"\"" {
+		t.Errorf("expected the message to parse back unchanged, got %q", got)
+	}
+}
+
+func format(t *testing.T, f *File) string {
+	t.Helper()
+
+	s, err := Format(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+type customNode struct {
+	Directive
+}
+
+func TestFormatUnknownNode(t *testing.T) {
+	for _, n := range []Node{&customNode{}, nil} {
+		if _, err := Format(&File{Nodes: []Node{&From{Model: "llama3.2"}, n}}); err == nil {
+			t.Errorf("expected an error for %T", n)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+// Package registry is a client for registries that serve models over the OCI
+// distribution protocol, such as registry.ollama.ai. Models are addressed by
+// [model.Name]: the host of the name is the registry, its namespace and model
+// are the repository, and its digest, or else its tag, is the reference.
+//
+// Blobs are kept in a directory with one file per blob, named by digest in
+// the "sha256-<hex>" form used by the local model store.
+package registry
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ollama/ollama/types/model"
+	"github.com/ollama/ollama/x/manifest"
+)
+
+// DefaultChunkSize is the size of the ranges blobs are downloaded in when
+// [Client.ChunkSize] is zero.
+const DefaultChunkSize = 64 << 20
+
+var (
+	// ErrNotFound is returned when the registry has no manifest or blob
+	// for a reference.
+	ErrNotFound = errors.New("not found")
+
+	// ErrUnauthorized is returned when the registry rejects a request
+	// even after authenticating.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrDigestMismatch is returned when the content of a blob or manifest
+	// does not match its digest. A partially downloaded blob is removed
+	// so the next attempt starts over.
+	ErrDigestMismatch = errors.New("digest mismatch")
+)
+
+// Client pulls and pushes models. The zero value is ready to use.
+type Client struct {
+	// HTTPClient makes the requests. If nil, [http.DefaultClient] is used.
+	HTTPClient *http.Client
+
+	// Insecure makes requests over http instead of https.
+	Insecure bool
+
+	// Username and Password, if set, are sent with basic auth to the
+	// realm of bearer challenges to request tokens.
+	Username string
+	Password string
+
+	// ChunkSize is the size of the ranges blobs are downloaded in. If
+	// zero, [DefaultChunkSize] is used.
+	ChunkSize int64
+
+	mu sync.Mutex
+	// tokens are the bearer tokens obtained for each host
+	tokens map[string]string
+}
+
+// Resolve returns the manifest of name, its raw bytes as served, and their
+// digest. If name has a digest, the manifest is verified against it.
+func (c *Client) Resolve(ctx context.Context, name model.Name) (*manifest.Manifest, []byte, string, error) {
+	ref := name.Tag
+	if name.HasDigest() {
+		ref = referenceDigest(name.Digest())
+	}
+
+	header := http.Header{"Accept": {manifest.MediaTypeManifest}}
+	resp, err := c.do(ctx, http.MethodGet, name, "manifests/"+ref, header, nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	sum := sha256.Sum256(raw)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if name.HasDigest() && digest != ref {
+		return nil, nil, "", fmt.Errorf("manifest %s: %w", ref, ErrDigestMismatch)
+	}
+
+	var m manifest.Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, nil, "", err
+	}
+
+	return &m, raw, digest, nil
+}
+
+// Pull downloads the config and layers of name into dir, skipping blobs
+// already there, and returns its manifest and raw bytes. Interrupted
+// downloads resume from where they stopped on the next pull.
+func (c *Client) Pull(ctx context.Context, name model.Name, dir string) (*manifest.Manifest, []byte, error) {
+	m, raw, _, err := c.Resolve(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, l := range append([]manifest.Layer{m.Config}, m.Layers...) {
+		if err := c.DownloadBlob(ctx, name, l, dir); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return m, raw, nil
+}
+
+// DownloadBlob downloads the blob of l from the repository of name into dir,
+// in ranges of [Client.ChunkSize]. The blob is written to a ".partial" file
+// which is renamed once the blob is complete and matches its digest, so a
+// later call resumes a download that was interrupted.
+func (c *Client) DownloadBlob(ctx context.Context, name model.Name, l manifest.Layer, dir string) error {
+	path, err := BlobPath(dir, l.Digest)
+	if err != nil {
+		return err
+	}
+
+	if fi, err := os.Stat(path); err == nil && fi.Size() == l.Size {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	partial := path + ".partial"
+	f, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// hash what was downloaded before so only the rest is requested
+	h := sha256.New()
+	offset, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+
+	if offset > l.Size {
+		offset = 0
+		h.Reset()
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	chunkSize := c.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	w := io.MultiWriter(f, h)
+	for offset < l.Size {
+		end := min(offset+chunkSize, l.Size) - 1
+		header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", offset, end)}}
+		resp, err := c.do(ctx, http.MethodGet, name, "blobs/"+referenceDigest(l.Digest), header, nil)
+		if err != nil {
+			return err
+		}
+
+		// a registry that ignores ranges sends the whole blob
+		body := io.Reader(resp.Body)
+		if resp.StatusCode == http.StatusOK && offset > 0 {
+			if _, err := io.CopyN(io.Discard, body, offset); err != nil {
+				resp.Body.Close()
+				return err
+			}
+		}
+
+		n, err := io.Copy(w, io.LimitReader(body, end-offset+1))
+		resp.Body.Close()
+		offset += n
+		if err != nil {
+			return err
+		} else if n == 0 {
+			return fmt.Errorf("blob %s: %w", l.Digest, io.ErrUnexpectedEOF)
+		}
+	}
+
+	if digest := "sha256:" + hex.EncodeToString(h.Sum(nil)); digest != referenceDigest(l.Digest) {
+		f.Close()
+		os.Remove(partial)
+		return fmt.Errorf("blob %s: %w", l.Digest, ErrDigestMismatch)
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(partial, path)
+}
+
+// Push uploads the blobs of manifest raw from dir to the repository of name,
+// skipping those the registry already has, then the manifest itself under
+// the tag of name.
+func (c *Client) Push(ctx context.Context, name model.Name, raw []byte, dir string) error {
+	var m manifest.Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return err
+	}
+
+	for _, l := range append([]manifest.Layer{m.Config}, m.Layers...) {
+		if err := c.UploadBlob(ctx, name, l, dir); err != nil {
+			return err
+		}
+	}
+
+	header := http.Header{"Content-Type": {manifest.MediaTypeManifest}}
+	resp, err := c.do(ctx, http.MethodPut, name, "manifests/"+name.Tag, header, raw)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// UploadBlob uploads the blob of l from dir to the repository of name, unless
+// the registry already has it.
+func (c *Client) UploadBlob(ctx context.Context, name model.Name, l manifest.Layer, dir string) error {
+	digest := referenceDigest(l.Digest)
+	resp, err := c.do(ctx, http.MethodHead, name, "blobs/"+digest, nil, nil)
+	switch {
+	case err == nil:
+		return resp.Body.Close()
+	case !errors.Is(err, ErrNotFound):
+		return err
+	}
+
+	path, err := BlobPath(dir, l.Digest)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	resp, err = c.do(ctx, http.MethodPost, name, "blobs/uploads/", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	location, err := resp.Location()
+	if err != nil {
+		return err
+	}
+
+	values := location.Query()
+	values.Set("digest", digest)
+	location.RawQuery = values.Encode()
+
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	resp, err = c.doURL(ctx, http.MethodPut, location, header, io.NewSectionReader(f, 0, info.Size()))
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// BlobPath returns the path of the blob with digest in dir. The digest may be
+// in either the "sha256:" form of references or the "sha256-" form of blob
+// names.
+func BlobPath(dir, digest string) (string, error) {
+	digest, err := manifest.ParseDigest(digest)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, strings.Replace(digest, ":", "-", 1)), nil
+}
+
+// referenceDigest returns digest in the "sha256:" form of references.
+func referenceDigest(digest string) string {
+	return strings.Replace(digest, "-", ":", 1)
+}
+
+func (c *Client) do(ctx context.Context, method string, name model.Name, path string, header http.Header, body []byte) (*http.Response, error) {
+	scheme := "https"
+	if c.Insecure {
+		scheme = "http"
+	}
+
+	u := &url.URL{
+		Scheme: scheme,
+		Host:   name.Host,
+		Path:   fmt.Sprintf("/v2/%s/%s/%s", name.Namespace, name.Model, path),
+	}
+
+	var r *io.SectionReader
+	if body != nil {
+		r = io.NewSectionReader(bytes.NewReader(body), 0, int64(len(body)))
+	}
+
+	return c.doURL(ctx, method, u, header, r)
+}
+
+// doURL makes a request, authenticating and retrying once if the registry
+// answers with a bearer challenge. Error statuses are returned as errors.
+// The body, if any, is streamed and read again from its start for retries
+// and redirects, so blobs are never held in memory.
+func (c *Client) doURL(ctx context.Context, method string, u *url.URL, header http.Header, body *io.SectionReader) (*http.Response, error) {
+	for range 2 {
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if body != nil && body.Size() > 0 {
+			req.ContentLength = body.Size()
+			req.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(io.NewSectionReader(body, 0, body.Size())), nil
+			}
+			req.Body, _ = req.GetBody()
+		}
+
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		if token := c.token(u.Host); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := c.httpClient().Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized:
+			resp.Body.Close()
+			challenge := resp.Header.Get("WWW-Authenticate")
+			if !strings.HasPrefix(challenge, "Bearer ") {
+				return nil, ErrUnauthorized
+			}
+
+			if err := c.authenticate(ctx, u.Host, challenge); err != nil {
+				return nil, err
+			}
+		case resp.StatusCode == http.StatusNotFound:
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s %s: %w", method, u.Path, ErrNotFound)
+		case resp.StatusCode >= http.StatusBadRequest:
+			defer resp.Body.Close()
+			b, _ := io.ReadAll(resp.Body)
+			return nil, fmt.Errorf("%s %s: %d: %s", method, u.Path, resp.StatusCode, bytes.TrimSpace(b))
+		default:
+			return resp, nil
+		}
+	}
+
+	return nil, ErrUnauthorized
+}
+
+// authenticate requests a token from the realm of a bearer challenge and
+// keeps it for later requests to host.
+func (c *Client) authenticate(ctx context.Context, host, challenge string) error {
+	params := parseChallenge(strings.TrimPrefix(challenge, "Bearer "))
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("invalid challenge %q", challenge)
+	}
+
+	values := realm.Query()
+	if service := params["service"]; service != "" {
+		values.Set("service", service)
+	}
+	for _, scope := range strings.Fields(params["scope"]) {
+		values.Add("scope", scope)
+	}
+	realm.RawQuery = values.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token: %d: %w", resp.StatusCode, ErrUnauthorized)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokens == nil {
+		c.tokens = make(map[string]string)
+	}
+	c.tokens[host] = cmp.Or(token.Token, token.AccessToken)
+	return nil
+}
+
+func (c *Client) token(host string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens[host]
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	return http.DefaultClient
+}
+
+// parseChallenge parses the comma separated key="value" parameters of a
+// WWW-Authenticate challenge. Values may contain commas.
+func parseChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for s != "" {
+		key, rest, ok := strings.Cut(strings.TrimLeft(s, ", "), "=")
+		if !ok {
+			break
+		}
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+
+		params[strings.ToLower(strings.TrimSpace(key))] = value
+		s = rest
+	}
+
+	return params
+}
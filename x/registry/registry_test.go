@@ -0,0 +1,292 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/types/model"
+	"github.com/ollama/ollama/x/manifest"
+)
+
+func digestOf(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// testRegistry is a registry that requires a bearer token and serves ranges
+// of blobs.
+type testRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	ranges    []string
+}
+
+func newTestRegistry(t *testing.T) (*testRegistry, *httptest.Server) {
+	r := &testRegistry{blobs: make(map[string][]byte), manifests: make(map[string][]byte)}
+
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("GET /token", func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("service") != "test" || req.URL.Query().Get("scope") == "" {
+			http.Error(w, "bad token request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "secret"})
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:library/m:pull,push"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		repo, rest, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/v2/"), "/manifests/")
+		if rest != "" {
+			switch req.Method {
+			case http.MethodGet:
+				b, ok := r.manifests[repo+":"+rest]
+				if !ok {
+					http.NotFound(w, req)
+					return
+				}
+				w.Write(b)
+			case http.MethodPut:
+				b, _ := io.ReadAll(req.Body)
+				r.manifests[repo+":"+rest] = b
+				w.WriteHeader(http.StatusCreated)
+			}
+			return
+		}
+
+		_, rest, _ = strings.Cut(req.URL.Path, "/blobs/")
+		switch {
+		case rest == "uploads/" && req.Method == http.MethodPost:
+			w.Header().Set("Location", "/v2/upload/1?state=abc")
+			w.WriteHeader(http.StatusAccepted)
+		case req.URL.Path == "/v2/upload/1" && req.Method == http.MethodPut:
+			// uploads are redirected, so the body is sent again
+			http.Redirect(w, req, "/v2/upload/2?"+req.URL.RawQuery, http.StatusTemporaryRedirect)
+		case req.URL.Path == "/v2/upload/2" && req.Method == http.MethodPut:
+			b, _ := io.ReadAll(req.Body)
+			if req.URL.Query().Get("state") != "abc" || digestOf(b) != req.URL.Query().Get("digest") {
+				http.Error(w, "bad upload", http.StatusBadRequest)
+				return
+			}
+			r.blobs[digestOf(b)] = b
+			w.WriteHeader(http.StatusCreated)
+		default:
+			b, ok := r.blobs[rest]
+			if !ok {
+				http.NotFound(w, req)
+				return
+			}
+			r.ranges = append(r.ranges, req.Header.Get("Range"))
+			http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(b))
+		}
+	})
+
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+func (r *testRegistry) addModel(t *testing.T, blobs ...[]byte) []byte {
+	var m manifest.Manifest
+	m.SchemaVersion = 2
+	m.MediaType = manifest.MediaTypeManifest
+	for i, b := range blobs {
+		r.blobs[digestOf(b)] = b
+		l := manifest.Layer{MediaType: manifest.MediaTypeModel, Digest: digestOf(b), Size: int64(len(b))}
+		if i == 0 {
+			m.Config = l
+		} else {
+			m.Layers = append(m.Layers, l)
+		}
+	}
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.manifests["library/m:latest"] = raw
+	r.manifests["library/m:"+digestOf(raw)] = raw
+	return raw
+}
+
+func testName(t *testing.T, srv *httptest.Server) model.Name {
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model.ParseName(u.Host + "/library/m")
+}
+
+func TestPull(t *testing.T) {
+	r, srv := newTestRegistry(t)
+	config, weights := []byte(`{"model_format":"gguf"}`), bytes.Repeat([]byte("0123456789"), 10)
+	raw := r.addModel(t, config, weights)
+
+	dir := t.TempDir()
+	// half of the weights were downloaded before
+	path, err := BlobPath(dir, digestOf(weights))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".partial", weights[:50], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := Client{Insecure: true, ChunkSize: 30}
+	m, got, err := c.Pull(context.Background(), testName(t, srv), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, raw) {
+		t.Errorf("manifest = %s; want %s", got, raw)
+	}
+	if len(m.Layers) != 1 || m.Layers[0].Digest != digestOf(weights) {
+		t.Errorf("unexpected manifest %+v", m)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, weights) {
+		t.Errorf("weights = %q; want %q", b, weights)
+	}
+
+	want := []string{"bytes=0-22", "bytes=50-79", "bytes=80-99"}
+	if fmt.Sprint(r.ranges) != fmt.Sprint(want) {
+		t.Errorf("ranges = %q; want %q", r.ranges, want)
+	}
+	if _, err := os.Stat(path + ".partial"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("partial file was not removed: %v", err)
+	}
+}
+
+func TestPullDigest(t *testing.T) {
+	r, srv := newTestRegistry(t)
+	raw := r.addModel(t, []byte("config"))
+
+	c := Client{Insecure: true}
+	name, err := testName(t, srv).WithDigest(digestOf(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Pull(context.Background(), name, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	r.manifests["library/m:"+digestOf(raw)] = []byte(`{}`)
+	if _, _, err := c.Pull(context.Background(), name, t.TempDir()); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("err = %v; want %v", err, ErrDigestMismatch)
+	}
+}
+
+func TestPullBlobMismatch(t *testing.T) {
+	r, srv := newTestRegistry(t)
+	config := []byte("config")
+	r.addModel(t, config)
+	r.blobs[digestOf(config)] = []byte("CONFIG")
+
+	dir := t.TempDir()
+	c := Client{Insecure: true}
+	if _, _, err := c.Pull(context.Background(), testName(t, srv), dir); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("err = %v; want %v", err, ErrDigestMismatch)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected no blobs, got %v", entries)
+	}
+}
+
+func TestPullNotFound(t *testing.T) {
+	_, srv := newTestRegistry(t)
+
+	c := Client{Insecure: true}
+	if _, _, err := c.Pull(context.Background(), testName(t, srv), t.TempDir()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v; want %v", err, ErrNotFound)
+	}
+}
+
+func TestPush(t *testing.T) {
+	r, srv := newTestRegistry(t)
+	config, weights := []byte("config"), []byte("weights")
+
+	m := manifest.Manifest{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeManifest,
+		Config:        manifest.Layer{Digest: digestOf(config), Size: int64(len(config))},
+		Layers:        []manifest.Layer{{Digest: digestOf(weights), Size: int64(len(weights))}},
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for _, b := range [][]byte{config, weights} {
+		path, err := BlobPath(dir, digestOf(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the registry already has the config
+	r.blobs[digestOf(config)] = config
+
+	c := Client{Insecure: true}
+	if err := c.Push(context.Background(), testName(t, srv), raw, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(r.blobs[digestOf(weights)], weights) {
+		t.Errorf("weights were not uploaded")
+	}
+	if !bytes.Equal(r.manifests["library/m:latest"], raw) {
+		t.Errorf("manifest = %s; want %s", r.manifests["library/m:latest"], raw)
+	}
+}
+
+func TestBlobPath(t *testing.T) {
+	hex := strings.Repeat("a", 64)
+	for _, digest := range []string{"sha256:" + hex, "sha256-" + hex} {
+		path, err := BlobPath("blobs", digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join("blobs", "sha256-"+hex); path != want {
+			t.Errorf("BlobPath(%q) = %q; want %q", digest, path, want)
+		}
+	}
+
+	for _, digest := range []string{"", "sha256:abc", "md5:" + hex, "sha256:../" + hex[3:]} {
+		if _, err := BlobPath("blobs", digest); !errors.Is(err, model.ErrInvalidDigest) {
+			t.Errorf("BlobPath(%q) err = %v; want %v", digest, err, model.ErrInvalidDigest)
+		}
+	}
+}